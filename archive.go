@@ -0,0 +1,299 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ArchivePolicy moves the records older than After, by the date in Attribute, to an archive.
+type ArchivePolicy struct {
+	// Attribute is the date property of the records compared to the archival threshold, for example "createdAt".
+	Attribute string
+	// After is the age of the records to archive.
+	After time.Duration
+}
+
+// GetArchivePolicy returns the archival policy of the repository (property "archive"), or nil if the
+// records are not archived. The policy can be given as *ArchivePolicy, or as a map:
+//
+//	"archive": map[string]interface{}{"attribute": "createdAt", "after": "8760h"}
+func (m RepositoryDefinitionMap) GetArchivePolicy() *ArchivePolicy {
+	if value, ok := m["archive"]; ok {
+		policy, err := parseArchivePolicy(value)
+		if err != nil {
+			panic(err)
+		}
+		return policy
+	}
+	return nil
+}
+
+func parseArchivePolicy(value interface{}) (*ArchivePolicy, error) {
+	switch ap := value.(type) {
+	case *ArchivePolicy:
+		return ap, nil
+	case ArchivePolicy:
+		return &ap, nil
+	case map[string]interface{}:
+		options := BackendOptions(ap)
+		return &ArchivePolicy{
+			Attribute: options.GetString("attribute"),
+			After:     options.GetDuration("after"),
+		}, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("invalid archive policy %v", value))
+}
+
+// ArchiveStore keeps the archived records, usually on another ("cold") backend.
+type ArchiveStore interface {
+	// Archive stores the records. A record stored again replaces the archived one, so an interrupted
+	// archival can be repeated.
+	Archive(records []map[string]interface{}) error
+	// GetArchived reads the archived record matched by the filter into the result. Returns ErrNotFound if
+	// there is no such record.
+	GetArchived(filter Filter, result interface{}) (interface{}, error)
+}
+
+// RepositoryArchive returns the archive store keeping the records in the repository. The records keep
+// their IDs, so the repository should be defined with "customId" (or with an idType other than objectId
+// on MongoDB).
+func RepositoryArchive(repo Repository) ArchiveStore {
+	return &repositoryArchive{repo: repo}
+}
+
+type repositoryArchive struct {
+	repo Repository
+}
+
+func (a *repositoryArchive) Archive(records []map[string]interface{}) error {
+	for _, record := range records {
+		if err := importRecord(a.repo, record, []string{"id"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *repositoryArchive) GetArchived(filter Filter, result interface{}) (interface{}, error) {
+	return a.repo.GetOne(filter, result)
+}
+
+// FileArchive returns the archive store keeping every record as a JSON file named by its ID ("<id>.json"),
+// in the files of the repository: S3 for DynamoDB (with the "filesBucket" option), GridFS for MongoDB.
+// The archived records can be read only by ID.
+func FileArchive(repo Repository) ArchiveStore {
+	return &fileArchive{repo: repo}
+}
+
+type fileArchive struct {
+	repo Repository
+}
+
+func (a *fileArchive) Archive(records []map[string]interface{}) error {
+	for _, record := range records {
+		content, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := SaveFile(a.repo, archiveFileName(record["id"]), "application/json", bytes.NewReader(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *fileArchive) GetArchived(filter Filter, result interface{}) (interface{}, error) {
+	id, ok := filter["id"]
+	if !ok || len(filter) != 1 {
+		return nil, ErrInvalidInput("the archived files can be read only by id")
+	}
+	file, _, err := GetFile(a.repo, archiveFileName(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	record := map[string]interface{}{}
+	if err := json.NewDecoder(file).Decode(&record); err != nil {
+		return nil, err
+	}
+	if err := MapToInterface(&record, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func archiveFileName(id interface{}) string {
+	return fmt.Sprintf("%v.json", id)
+}
+
+// WithArchive returns the repository reading the records missing in the repository from the archive:
+// GetOne falls back to the archive store when the record is not found. The other operations use only
+// the repository, so the archived records are not listed by GetAll.
+func WithArchive(repo Repository, store ArchiveStore) Repository {
+	return &archivedRepository{Repository: repo, store: store}
+}
+
+type archivedRepository struct {
+	Repository
+	store ArchiveStore
+}
+
+// GetOne returns the record from the repository, or from the archive if it is not in the repository.
+func (r *archivedRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	found, err := r.Repository.GetOne(filter, result)
+	if err != nil && IsErrNotFound(err) {
+		return r.store.GetArchived(filter, result)
+	}
+	return found, err
+}
+
+// ArchiverConfig configures the Archiver.
+type ArchiverConfig struct {
+	// Interval between the archival runs. Defaults to 1 hour.
+	Interval time.Duration
+	// Jitter is the maximal random delay added to every interval, so multiple instances do not archive at the same time.
+	Jitter time.Duration
+	// BatchSize is the maximal number of records moved in one batch. Defaults to 100.
+	BatchSize int
+}
+
+// Archiver periodically moves the records of a repository to the archive store, according to the
+// archival policy of the repository definition (property "archive"). The records are stored in the
+// archive before they are deleted from the repository, so no record is lost if an archival fails.
+type Archiver struct {
+	repo   Repository
+	def    RepositoryDefinition
+	store  ArchiveStore
+	config ArchiverConfig
+	stop   chan struct{}
+	once   *sync.Once
+}
+
+// NewArchiver creates an archiver for the repository. Call Start to begin archiving in the background:
+//
+//	archiver := backends.NewArchiver(ordersRepo, ordersDef, backends.RepositoryArchive(coldRepo), backends.ArchiverConfig{})
+//	archiver.Start()
+//	backend.(*backends.RepositoriesBackend).OnShutdown(archiver.Stop)
+func NewArchiver(repo Repository, def RepositoryDefinition, store ArchiveStore, config ArchiverConfig) *Archiver {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &Archiver{
+		repo:   repo,
+		def:    def,
+		store:  store,
+		config: config,
+		stop:   make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// Start runs the archival in the background until Stop is called.
+func (a *Archiver) Start() {
+	if a.def.GetArchivePolicy() == nil {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-time.After(a.nextInterval()):
+			}
+			if _, err := a.Archive(); err != nil {
+				log.Printf("ERROR: failed to archive the records of %s: %s\n", a.def.GetName(), err.Error())
+			}
+		}
+	}()
+}
+
+// Stop stops the background archival.
+func (a *Archiver) Stop() {
+	a.once.Do(func() {
+		close(a.stop)
+	})
+}
+
+func (a *Archiver) nextInterval() time.Duration {
+	if a.config.Jitter <= 0 {
+		return a.config.Interval
+	}
+	return a.config.Interval + time.Duration(rand.Int63n(int64(a.config.Jitter)))
+}
+
+// Archive moves the records older than the threshold of the archival policy to the archive store, in
+// batches. Returns the number of archived records.
+func (a *Archiver) Archive() (int, error) {
+	policy := a.def.GetArchivePolicy()
+	if policy == nil {
+		return 0, nil
+	}
+	if policy.Attribute == "" || policy.After <= 0 {
+		return 0, ErrInvalidInput("the archive policy needs the attribute and the age of the records")
+	}
+	filter := NewFilter().Until(policy.Attribute, time.Now().Add(-policy.After))
+
+	total := 0
+	for {
+		archived, err := a.archiveBatch(filter)
+		total += archived
+		if err != nil || archived < a.config.BatchSize || a.stopped() {
+			return total, err
+		}
+	}
+}
+
+// archiveBatch moves a batch of the records matched by the filter to the archive store.
+func (a *Archiver) archiveBatch(filter Filter) (int, error) {
+	results, err := a.repo.GetAll(filter, map[string]interface{}{}, "", "", a.config.BatchSize, 0)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	records := []map[string]interface{}{}
+	err = IterateOverSlice(results, func(i int, item interface{}) error {
+		record, err := toAuditMap(item)
+		if err != nil {
+			return err
+		}
+		if record["id"] == nil {
+			return ErrInvalidInput(fmt.Sprintf("can not archive a record without id from %s", a.def.GetName()))
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	if err := a.store.Archive(records); err != nil {
+		return 0, err
+	}
+	for i, record := range records {
+		if err := a.repo.DeleteOne(Filter{"id": record["id"]}); err != nil && !IsErrNotFound(err) {
+			return i, err
+		}
+	}
+	return len(records), nil
+}
+
+func (a *Archiver) stopped() bool {
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,152 @@
+package backends
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// datedMemoryRepo is a memoryRepo supporting the date range filters.
+type datedMemoryRepo struct {
+	*memoryRepo
+}
+
+func (r *datedMemoryRepo) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	results := []map[string]interface{}{}
+	for _, record := range r.records {
+		if matchesDatedFilter(record, filter) {
+			results = append(results, record)
+		}
+	}
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return &results, nil
+}
+
+// matchesDatedFilter matches the values, and the dates by the upper bound of the date ranges.
+func matchesDatedFilter(record map[string]interface{}, filter Filter) bool {
+	for key, value := range filter {
+		dates, ok := filterDateRange(value)
+		if !ok {
+			if record[key] != value {
+				return false
+			}
+			continue
+		}
+		until, _ := dateBound(dates.until)
+		at, ok := asTime(record[key])
+		if !ok || at.After(until) {
+			return false
+		}
+	}
+	return true
+}
+
+type failingArchive struct{}
+
+func (failingArchive) Archive(records []map[string]interface{}) error {
+	return errors.New("archive not available")
+}
+
+func (failingArchive) GetArchived(filter Filter, result interface{}) (interface{}, error) {
+	return nil, ErrNotFound("not archived")
+}
+
+func TestGetArchivePolicy(t *testing.T) {
+	def := (&CollectionConfig{
+		Archive: map[string]interface{}{"attribute": "createdAt", "after": "8760h"},
+	}).Definition("orders")
+
+	policy := def.GetArchivePolicy()
+	if policy == nil || policy.Attribute != "createdAt" || policy.After != 8760*time.Hour {
+		t.Fatalf("Unexpected policy: %+v", policy)
+	}
+	if (RepositoryDefinitionMap{}).GetArchivePolicy() != nil {
+		t.Fatal("Expected no policy by default")
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	now := time.Now()
+	primary := &datedMemoryRepo{&memoryRepo{
+		records: []map[string]interface{}{
+			{"id": "1", "createdAt": now.Add(-48 * time.Hour)},
+			{"id": "2", "createdAt": now},
+			{"id": "3", "createdAt": now.Add(-72 * time.Hour).Format(time.RFC3339)},
+		},
+	}}
+	cold := &memoryRepo{}
+	def := RepositoryDefinitionMap{
+		"name":    "orders",
+		"archive": &ArchivePolicy{Attribute: "createdAt", After: 24 * time.Hour},
+	}
+	archiver := NewArchiver(primary, def, RepositoryArchive(cold), ArchiverConfig{BatchSize: 1})
+
+	archived, err := archiver.Archive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 2 || len(primary.records) != 1 || primary.records[0]["id"] != "2" || len(cold.records) != 2 {
+		t.Fatal("Expected the old records to be moved to the archive. Got: ", archived, primary.records, cold.records)
+	}
+	if archived, err = archiver.Archive(); err != nil || archived != 0 {
+		t.Fatal("Expected nothing to archive. Got: ", archived, err)
+	}
+
+	repo := WithArchive(primary, RepositoryArchive(cold))
+	for _, id := range []string{"1", "2"} {
+		record := map[string]interface{}{}
+		if _, err := repo.GetOne(Filter{"id": id}, &record); err != nil || record["id"] != id {
+			t.Fatalf("Expected the record %s. Got: %v %v", id, record, err)
+		}
+	}
+	if _, err := repo.GetOne(Filter{"id": "4"}, &map[string]interface{}{}); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+}
+
+func TestArchiverKeepsRecordsOnFailure(t *testing.T) {
+	primary := &datedMemoryRepo{&memoryRepo{
+		records: []map[string]interface{}{{"id": "1", "createdAt": time.Now().Add(-48 * time.Hour)}},
+	}}
+	def := RepositoryDefinitionMap{"archive": &ArchivePolicy{Attribute: "createdAt", After: time.Hour}}
+
+	if _, err := NewArchiver(primary, def, failingArchive{}, ArchiverConfig{}).Archive(); err == nil {
+		t.Fatal("Expected the error of the archive")
+	}
+	if len(primary.records) != 1 {
+		t.Fatal("Expected the record to be kept. Got: ", primary.records)
+	}
+	// without a policy nothing is archived
+	if archived, err := NewArchiver(primary, RepositoryDefinitionMap{}, failingArchive{}, ArchiverConfig{}).Archive(); err != nil || archived != 0 {
+		t.Fatal("Expected nothing to archive. Got: ", archived, err)
+	}
+}
+
+func TestFileArchive(t *testing.T) {
+	storage := &memoryS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+	store := FileArchive(newS3Collection(t, server, BackendOptions{"filesBucket": "archive"}))
+
+	err := store.Archive([]map[string]interface{}{{"id": "1", "total": 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storage.objects["/archive/users/1.json"] == "" || storage.types["/archive/users/1.json"] != "application/json" {
+		t.Fatal("Expected the record as a JSON file. Got: ", storage.objects)
+	}
+
+	record := map[string]interface{}{}
+	if _, err := store.GetArchived(Filter{"id": "1"}, &record); err != nil || record["total"] != float64(10) {
+		t.Fatal("Expected the archived record. Got: ", record, err)
+	}
+	if _, err := store.GetArchived(Filter{"id": "2"}, &record); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+	if _, err := store.GetArchived(Filter{"total": 10}, &record); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a filter without id. Got: ", err)
+	}
+}
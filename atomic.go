@@ -0,0 +1,290 @@
+package backends
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// dynamoClaimAttempts is the number of records tried by PopOne and GetAndUpdate on DynamoDB before
+// giving up, when the matched records are changed concurrently.
+const dynamoClaimAttempts = 5
+
+// AtomicRepository is implemented by the repositories that can find and change a record in a single
+// atomic operation.
+type AtomicRepository interface {
+	// PopOne deletes a record that matches the filter and returns it.
+	PopOne(filter Filter, result interface{}) (interface{}, error)
+
+	// GetAndUpdate updates a record that matches the filter with the properties of the update,
+	// and returns the updated record.
+	GetAndUpdate(filter Filter, update interface{}, result interface{}) (interface{}, error)
+}
+
+// PopOne atomically deletes a record that matches the filter and returns it. A record is returned to
+// only one of the concurrent callers, so the records can be consumed as a work queue. For example:
+//
+//	job, err := backends.PopOne(jobsRepo, backends.Filter{"queue": "emails"}, &Job{})
+//
+// Returns ErrNotFound if no record matches the filter, and an error if the repository does not support
+// atomic operations.
+func PopOne(repo Repository, filter Filter, result interface{}) (interface{}, error) {
+	if r, ok := repo.(AtomicRepository); ok {
+		return r.PopOne(filter, result)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("atomic operations are not supported on %T", repo))
+}
+
+// GetAndUpdate atomically updates a record that matches the filter and returns the updated record. Only one
+// of the concurrent callers updates a record while it still matches the filter, so a record can be claimed
+// by changing a property of the filter. For example, to take the next pending job:
+//
+//	job, err := backends.GetAndUpdate(jobsRepo, backends.Filter{"status": "pending"}, &map[string]interface{}{"status": "running"}, &Job{})
+//
+// Returns ErrNotFound if no record matches the filter, and an error if the repository does not support
+// atomic operations.
+func GetAndUpdate(repo Repository, filter Filter, update interface{}, result interface{}) (interface{}, error) {
+	if r, ok := repo.(AtomicRepository); ok {
+		return r.GetAndUpdate(filter, update, result)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("atomic operations are not supported on %T", repo))
+}
+
+// PopOne deletes the record on the active backend.
+func (r *failoverRepository) PopOne(filter Filter, result interface{}) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return PopOne(repository, filter, result)
+}
+
+// GetAndUpdate updates the record on the active backend.
+func (r *failoverRepository) GetAndUpdate(filter Filter, update interface{}, result interface{}) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return GetAndUpdate(repository, filter, update, result)
+}
+
+// PopOne deletes the first matched record with findAndModify.
+func (s *MongoSession) PopOne(filter Filter, result interface{}) (interface{}, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return nil, err
+	}
+	query, err := s.atomicQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	return s.applyChange(c, query, mgo.Change{Remove: true}, result)
+}
+
+// GetAndUpdate updates the first matched record with findAndModify.
+func (s *MongoSession) GetAndUpdate(filter Filter, update interface{}, result interface{}) (interface{}, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return nil, err
+	}
+	query, err := s.atomicQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := interfaceToMap(update, s.repoDef.GetFieldNaming())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDocument(*payload, s.repoDef, false); err != nil {
+		return nil, err
+	}
+	applyTimestamps(*payload, s.repoDef, false)
+	if err := applyAttribution(*payload, s.repoDef, false, ActorFromContext(s.operation.Context)); err != nil {
+		return nil, err
+	}
+	*payload = mongoValues(*payload)
+	// we can't update MongoDB's own id - it is immutable.
+	delete(*payload, "_id")
+
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	return s.applyChange(c, query, mgo.Change{Update: bson.M{"$set": payload}, ReturnNew: true}, result)
+}
+
+// atomicQuery checks the filter and translates it into the query of an atomic operation.
+func (s *MongoSession) atomicQuery(filter Filter) (Filter, error) {
+	if err := checkQueryFields(s.repoDef, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+	filter = copyFilter(filter)
+	if err := s.idFilter(filter, false); err != nil {
+		return nil, err
+	}
+	return toMongoQuery(filter)
+}
+
+// PopOne deletes a matched record with a delete conditioned on the record still matching the filter.
+// If the record is deleted or changed concurrently, the next matched record is tried.
+func (c *DynamoCollection) PopOne(filter Filter, result interface{}) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := c.maintenance.check(c.RepositoryDefinition); err != nil {
+		return nil, err
+	}
+	filter = copyFilter(filter)
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
+	}
+
+	return c.claim(filter, result, func(found map[string]interface{}) (map[string]interface{}, error) {
+		if c.unique != nil {
+			if err := c.deleteUnique(found, filter); err != nil {
+				return nil, err
+			}
+			return found, nil
+		}
+
+		hashKey := c.RepositoryDefinition.GetHashKey()
+		rangeKey := c.RepositoryDefinition.GetRangeKey()
+		query := c.Table.Delete(hashKey, found[hashKey])
+		if rangeKey != "" {
+			query = query.Range(rangeKey, found[rangeKey])
+		}
+
+		var old map[string]*dynamodb.AttributeValue
+		if err := query.If(c.existsCondition(filter)).OldValue(&old); err != nil {
+			if IsConditionalCheckErr(err) {
+				return nil, ErrConditionFailed("the record no longer matches the filter")
+			}
+			return nil, err
+		}
+		return unmarshalRecord(old)
+	})
+}
+
+// GetAndUpdate updates a matched record with an update conditioned on the record still matching the filter.
+// If the record is deleted or changed concurrently, the next matched record is tried.
+func (c *DynamoCollection) GetAndUpdate(filter Filter, update interface{}, result interface{}) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := c.maintenance.check(c.RepositoryDefinition); err != nil {
+		return nil, err
+	}
+	filter = copyFilter(filter)
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
+	}
+
+	payload, err := c.prepareItem(update, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+
+	return c.claim(filter, result, func(found map[string]interface{}) (map[string]interface{}, error) {
+		if c.unique != nil {
+			current, err := c.currentItem(found[hashKey], found[rangeKey])
+			if err != nil {
+				return nil, err
+			}
+			tx := NewDynamoTransaction()
+			if tx.collection(c) == nil {
+				return nil, tx.err
+			}
+			tx.update(c, found[hashKey], found[rangeKey], current, *payload, filter)
+			if err := tx.Commit(); err != nil {
+				return nil, err
+			}
+			// the record as written by the transaction; the keys are not updated
+			updated := mergeItem(current, *payload)
+			updated[hashKey] = current[hashKey]
+			if rangeKey != "" {
+				updated[rangeKey] = current[rangeKey]
+			}
+			return updated, nil
+		}
+
+		query := c.Table.Update(hashKey, found[hashKey])
+		if rangeKey != "" {
+			query = query.Range(rangeKey, found[rangeKey])
+		}
+		for k, v := range *payload {
+			if k != hashKey && k != rangeKey {
+				query = query.Set(k, v)
+			}
+		}
+
+		var updated map[string]*dynamodb.AttributeValue
+		if err := query.If(c.existsCondition(filter)).Value(&updated); err != nil {
+			if IsConditionalCheckErr(err) {
+				return nil, ErrConditionFailed("the record no longer matches the filter")
+			}
+			return nil, err
+		}
+		return unmarshalRecord(updated)
+	})
+}
+
+// claim finds a record that matches the filter and writes it. The write must be conditioned on the record
+// still matching the filter; if the condition fails (ErrConditionFailed, or ErrTransactionConflict on
+// repositories with unique indexes), the record has been taken by another caller and the next matched
+// record is tried.
+func (c *DynamoCollection) claim(filter Filter, result interface{}, write func(found map[string]interface{}) (map[string]interface{}, error)) (interface{}, error) {
+	for attempt := 0; attempt < dynamoClaimAttempts; attempt++ {
+		var item interface{}
+		if _, err := c.GetOne(copyFilter(filter), &item); err != nil {
+			return nil, err
+		}
+
+		record, err := write(item.(map[string]interface{}))
+		if err != nil {
+			if IsErrConditionFailed(err) || IsErrTransactionConflict(err) || IsErrNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if err := MapToInterface(&record, &result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return nil, ErrTransactionConflict(fmt.Sprintf("the records matching the filter were changed concurrently %d times", dynamoClaimAttempts))
+}
@@ -0,0 +1,63 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/guregu/dynamo"
+)
+
+func TestAtomicOperationsNotSupported(t *testing.T) {
+	repo := &memoryRepo{records: []map[string]interface{}{{"id": "1", "status": "pending"}}}
+
+	if _, err := PopOne(repo, Filter{"status": "pending"}, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+	if _, err := GetAndUpdate(repo, Filter{"status": "pending"}, &map[string]interface{}{"status": "running"}, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+	if len(repo.records) != 1 || repo.records[0]["status"] != "pending" {
+		t.Fatal("Expected the record to be unchanged. Got: ", repo.records)
+	}
+}
+
+func TestDynamoExistsCondition(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"hashKey": "id"},
+	}
+
+	condition, args := repo.existsCondition(nil)
+	if condition != "attribute_exists($)" || len(args) != 1 || args[0] != "id" {
+		t.Fatal("Unexpected condition: ", condition, args)
+	}
+
+	condition, args = repo.existsCondition(Filter{"status": "pending"})
+	if condition != "attribute_exists($) AND $ = ?" || len(args) != 3 || args[1] != "status" || args[2] != "pending" {
+		t.Fatal("Unexpected condition: ", condition, args)
+	}
+}
+
+func TestDynamoAtomicFilterNotChanged(t *testing.T) {
+	sess := testRetrySession(t, BackendOptions{})
+	sess.Handlers.Send.Clear()
+	sess.Handlers.Send.PushBack(func(r *request.Request) {
+		r.Error = awserr.New("ValidationException", "no table", nil)
+	})
+	table := dynamo.New(sess).Table("jobs")
+	repo := &DynamoCollection{
+		Table:                &table,
+		RepositoryDefinition: RepositoryDefinitionMap{"name": "jobs", "hashKey": "id", "idType": IDTypeInt},
+	}
+
+	filter := Filter{"id": "42"}
+	if _, err := repo.PopOne(filter, &map[string]interface{}{}); err == nil {
+		t.Fatal("Expected the error of the table")
+	}
+	if _, err := repo.GetAndUpdate(filter, &map[string]interface{}{"status": "running"}, &map[string]interface{}{}); err == nil {
+		t.Fatal("Expected the error of the table")
+	}
+	if filter["id"] != "42" {
+		t.Fatalf("Expected the filter of the caller to be unchanged. Got: %#v", filter["id"])
+	}
+}
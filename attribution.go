@@ -0,0 +1,53 @@
+package backends
+
+import (
+	"fmt"
+)
+
+// Attribution modes of the repositories ("attribution" property).
+const (
+	// AttributionOptional sets the CreatedByField and the UpdatedByField when the principal is known.
+	AttributionOptional = "optional"
+	// AttributionRequired sets the fields and rejects the saves without a principal with ErrInvalidInput.
+	AttributionRequired = "required"
+)
+
+// GetAttribution returns the attribution mode of the repository ("attribution" property), or an empty string
+// if the records are not attributed to the principals that save them.
+func (m RepositoryDefinitionMap) GetAttribution() string {
+	if attribution, ok := m["attribution"]; ok {
+		return attribution.(string)
+	}
+	return ""
+}
+
+// validAttribution returns an error if the attribution mode is not known.
+func validAttribution(attribution string) error {
+	switch attribution {
+	case "", AttributionOptional, AttributionRequired:
+		return nil
+	}
+	return ErrInvalidInput(fmt.Sprintf("unknown attribution %s", attribution))
+}
+
+// applyAttribution sets the UpdatedByField of the payload to the actor and, for new records, the CreatedByField.
+// On update the CreatedByField is never overwritten.
+func applyAttribution(payload map[string]interface{}, repoDef RepositoryDefinition, create bool, actor string) error {
+	attribution := repoDef.GetAttribution()
+	if attribution == "" {
+		return nil
+	}
+	if actor == "" {
+		if attribution == AttributionRequired {
+			return ErrInvalidInput(fmt.Sprintf("the principal saving the record in %s is not set", repoDef.GetName()))
+		}
+		return nil
+	}
+	if create {
+		payload[CreatedByField] = actor
+	} else {
+		delete(payload, CreatedByField)
+	}
+	payload[UpdatedByField] = actor
+	return nil
+}
@@ -0,0 +1,78 @@
+package backends
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApplyAttribution(t *testing.T) {
+	def := RepositoryDefinitionMap{"name": "orders", "attribution": AttributionOptional}
+
+	payload := map[string]interface{}{}
+	if err := applyAttribution(payload, def, true, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if payload[CreatedByField] != "u1" || payload[UpdatedByField] != "u1" {
+		t.Fatal("Expected the principal on a new record. Got: ", payload)
+	}
+
+	payload = map[string]interface{}{CreatedByField: "u2"}
+	if err := applyAttribution(payload, def, false, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload[CreatedByField]; ok || payload[UpdatedByField] != "u1" {
+		t.Fatal("Expected only the updating principal. Got: ", payload)
+	}
+
+	payload = map[string]interface{}{}
+	if err := applyAttribution(payload, def, true, ""); err != nil || len(payload) != 0 {
+		t.Fatal("Expected no attribution without a principal. Got: ", payload, err)
+	}
+	if err := applyAttribution(payload, RepositoryDefinitionMap{}, true, "u1"); err != nil || len(payload) != 0 {
+		t.Fatal("Expected no attribution by default. Got: ", payload, err)
+	}
+
+	def["attribution"] = AttributionRequired
+	if err := applyAttribution(payload, def, false, ""); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a principal. Got: ", err)
+	}
+}
+
+func TestDynamoAttribution(t *testing.T) {
+	repo := &DynamoCollection{RepositoryDefinition: RepositoryDefinitionMap{
+		"name":        "orders",
+		"attribution": AttributionRequired,
+	}}
+	if _, err := repo.prepareItem(&map[string]interface{}{"id": "1"}, true); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a principal. Got: ", err)
+	}
+
+	ctx := WithPrincipal(context.Background(), Principal{ID: "svc-billing", Type: PrincipalService})
+	payload, err := WithContext(repo, ctx).(*DynamoCollection).prepareItem(&map[string]interface{}{"id": "1"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*payload)[CreatedByField] != "svc-billing" || (*payload)[UpdatedByField] != "svc-billing" {
+		t.Fatal("Expected the principal on the item. Got: ", *payload)
+	}
+}
+
+func TestAttributionDefinition(t *testing.T) {
+	def := (&CollectionConfig{Attribution: AttributionRequired}).Definition("orders")
+	if def.GetAttribution() != AttributionRequired {
+		t.Fatal("Expected the attribution of the config. Got: ", def.GetAttribution())
+	}
+	if err := validAttribution("always"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown mode. Got: ", err)
+	}
+
+	structDef, err := NewRepoDefFromStruct(&struct {
+		_ struct{} `backend:"name=orders,attribution=optional"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if structDef.GetAttribution() != AttributionOptional {
+		t.Fatal("Expected the attribution of the struct. Got: ", structDef.GetAttribution())
+	}
+}
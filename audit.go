@@ -0,0 +1,344 @@
+package backends
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ACTOR_CTX_KEY is the context key for the identity of the caller, recorded in the audit trail.
+var ACTOR_CTX_KEY = "BACKENDS_CALLER_ACTOR"
+
+// WithActor returns a copy of the context that carries the identity (user ID, service name) of the caller.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ACTOR_CTX_KEY, actor)
+}
+
+// ActorFromContext returns the identity of the caller: the actor set with WithActor, otherwise the id of
+// the Principal, or empty string if neither is set.
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if actor, ok := ctx.Value(ACTOR_CTX_KEY).(string); ok {
+		return actor
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.ID
+	}
+	return ""
+}
+
+const (
+	// AuditSave is the audit operation for created and updated records.
+	AuditSave = "save"
+	// AuditDelete is the audit operation for deleted records.
+	AuditDelete = "delete"
+)
+
+// AuditChange holds the old and the new value of a changed property.
+type AuditChange struct {
+	Old interface{} `json:"old" bson:"old"`
+	New interface{} `json:"new" bson:"new"`
+}
+
+// AuditEntry is a record in the audit trail.
+// Every Auditor writes its entries in a chain: the entries have consecutive sequence numbers and each entry
+// holds the hash of the previous one, so modified, removed or reordered entries can be detected with VerifyAuditTrail.
+type AuditEntry struct {
+	Chain      string                  `json:"chain" bson:"chain"`
+	Sequence   int64                   `json:"sequence" bson:"sequence"`
+	Actor      string                  `json:"actor" bson:"actor"`
+	Time       string                  `json:"time" bson:"time"`
+	Collection string                  `json:"collection" bson:"collection"`
+	Operation  string                  `json:"operation" bson:"operation"`
+	Filter     map[string]interface{}  `json:"filter" bson:"filter"`
+	Before     map[string]interface{}  `json:"before" bson:"before"`
+	After      map[string]interface{}  `json:"after" bson:"after"`
+	Diff       map[string]*AuditChange `json:"diff" bson:"diff"`
+	PrevHash   string                  `json:"prevHash" bson:"prevHash"`
+	Hash       string                  `json:"hash" bson:"hash"`
+	Signature  string                  `json:"signature" bson:"signature"`
+}
+
+// computeHash returns the hash of the entry content, including the hash of the previous entry.
+func (e *AuditEntry) computeHash() (string, error) {
+	entry := *e
+	entry.Hash = ""
+	entry.Signature = ""
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func signAuditHash(hash string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Auditor writes the audit entries into the audit repository.
+type Auditor struct {
+	repo     Repository
+	secret   []byte
+	chain    string
+	sequence int64
+	lastHash string
+	mutex    *sync.Mutex
+}
+
+// NewAuditor creates an Auditor that records the changes into the given repository (on the same or on a separate backend).
+// If secret is set, every entry is signed with HMAC-SHA256, so the entries cannot be rewritten without the secret.
+func NewAuditor(auditRepo Repository, secret []byte) (*Auditor, error) {
+	chain, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	return &Auditor{
+		repo:   auditRepo,
+		secret: secret,
+		chain:  chain.String(),
+		mutex:  &sync.Mutex{},
+	}, nil
+}
+
+// Wrap returns a repository that records every Save and Delete on the given repository in the audit trail.
+func (a *Auditor) Wrap(repo Repository, collection string) *AuditingRepository {
+	return &AuditingRepository{
+		Repository: repo,
+		auditor:    a,
+		collection: collection,
+		ctx:        context.Background(),
+	}
+}
+
+func (a *Auditor) record(entry *AuditEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry.Chain = a.chain
+	entry.Sequence = a.sequence + 1
+	entry.PrevHash = a.lastHash
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	entry.Diff = auditDiff(entry.Before, entry.After)
+
+	hash, err := entry.computeHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	if len(a.secret) > 0 {
+		entry.Signature = signAuditHash(hash, a.secret)
+	}
+
+	if _, err = a.repo.Save(entry, nil); err != nil {
+		return err
+	}
+
+	a.sequence = entry.Sequence
+	a.lastHash = entry.Hash
+	return nil
+}
+
+// VerifyAuditTrail checks the integrity of the audit entries: the hash (and the signature, if secret is set)
+// of every entry, and that no entry is missing or reordered in its chain. Returns ErrInvalidInput describing the
+// first inconsistency found.
+func VerifyAuditTrail(entries []*AuditEntry, secret []byte) error {
+	chains := map[string][]*AuditEntry{}
+	for _, entry := range entries {
+		chains[entry.Chain] = append(chains[entry.Chain], entry)
+	}
+
+	for chain, chainEntries := range chains {
+		sort.Slice(chainEntries, func(i, j int) bool {
+			return chainEntries[i].Sequence < chainEntries[j].Sequence
+		})
+
+		prevHash := ""
+		for i, entry := range chainEntries {
+			if entry.Sequence != int64(i+1) {
+				return ErrInvalidInput(fmt.Sprintf("chain %s: missing entry before sequence %d", chain, entry.Sequence))
+			}
+			if entry.PrevHash != prevHash {
+				return ErrInvalidInput(fmt.Sprintf("chain %s: entry %d does not follow the previous entry", chain, entry.Sequence))
+			}
+			hash, err := entry.computeHash()
+			if err != nil {
+				return err
+			}
+			if hash != entry.Hash {
+				return ErrInvalidInput(fmt.Sprintf("chain %s: entry %d has been modified", chain, entry.Sequence))
+			}
+			if len(secret) > 0 && !hmac.Equal([]byte(signAuditHash(hash, secret)), []byte(entry.Signature)) {
+				return ErrInvalidInput(fmt.Sprintf("chain %s: entry %d has an invalid signature", chain, entry.Sequence))
+			}
+			prevHash = entry.Hash
+		}
+	}
+
+	return nil
+}
+
+// AuditingRepository wraps a Repository and records the changes in the audit trail.
+// The actor is taken from the context bound with WithContext:
+// 		repo := auditor.Wrap(usersRepo, "users")
+// 		_, err := repo.WithContext(backends.WithActor(ctx, userID)).Save(&user, filter)
+type AuditingRepository struct {
+	Repository
+	auditor    *Auditor
+	collection string
+	ctx        context.Context
+}
+
+// WithContext returns a copy of the repository that records the actor from the context.
+func (r *AuditingRepository) WithContext(ctx context.Context) Repository {
+	return &AuditingRepository{
+		Repository: WithContext(r.Repository, ctx),
+		auditor:    r.auditor,
+		collection: r.collection,
+		ctx:        ctx,
+	}
+}
+
+// Save saves the object and records the change. If the change is saved, but the audit entry cannot be written,
+// the saved record is returned together with the error.
+func (r *AuditingRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	var before map[string]interface{}
+	if filter != nil {
+		existing, err := r.getOne(filter)
+		if err != nil && !IsErrNotFound(err) {
+			return nil, err
+		}
+		before = existing
+	}
+
+	result, err := r.Repository.Save(object, copyFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := toAuditMap(result)
+	if err != nil {
+		return result, err
+	}
+
+	if err = r.record(AuditSave, filter, before, after); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// DeleteOne deletes the record and records the deletion.
+func (r *AuditingRepository) DeleteOne(filter Filter) error {
+	before, err := r.getOne(filter)
+	if err != nil {
+		return err
+	}
+
+	if err = r.Repository.DeleteOne(copyFilter(filter)); err != nil {
+		return err
+	}
+
+	return r.record(AuditDelete, filter, before, nil)
+}
+
+// DeleteAll deletes the matched records and records a deletion for every record.
+func (r *AuditingRepository) DeleteAll(filter Filter) error {
+	records, err := r.Repository.GetAll(copyFilter(filter), map[string]interface{}{}, "", "", 0, 0)
+	if err != nil && !IsErrNotFound(err) {
+		return err
+	}
+
+	if err = r.Repository.DeleteAll(copyFilter(filter)); err != nil {
+		return err
+	}
+
+	return IterateOverSlice(records, func(i int, item interface{}) error {
+		before, err := toAuditMap(item)
+		if err != nil {
+			return err
+		}
+		return r.record(AuditDelete, filter, before, nil)
+	})
+}
+
+func (r *AuditingRepository) getOne(filter Filter) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	result, err := r.Repository.GetOne(copyFilter(filter), &record)
+	if err != nil {
+		return nil, err
+	}
+	return toAuditMap(result)
+}
+
+func (r *AuditingRepository) record(operation string, filter Filter, before, after map[string]interface{}) error {
+	filterMap, err := toAuditMap(map[string]interface{}(filter))
+	if err != nil {
+		return err
+	}
+	err = r.auditor.record(&AuditEntry{
+		Actor:      ActorFromContext(r.ctx),
+		Collection: r.collection,
+		Operation:  operation,
+		Filter:     filterMap,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		return ErrBackendError(fmt.Sprintf("failed to write the audit entry: %s", err.Error()))
+	}
+	return nil
+}
+
+// copyFilter returns a copy of the filter. The backends may modify the filter (for example convert the id).
+func copyFilter(filter Filter) Filter {
+	if filter == nil {
+		return nil
+	}
+	filterCopy := Filter{}
+	for k, v := range filter {
+		filterCopy[k] = v
+	}
+	return filterCopy
+}
+
+// toAuditMap converts the record to a map with JSON values, so the entry hash is stable when the
+// entry is read back from the audit repository.
+func toAuditMap(record interface{}) (map[string]interface{}, error) {
+	if record == nil || (reflect.ValueOf(record).Kind() == reflect.Ptr && reflect.ValueOf(record).IsNil()) {
+		return nil, nil
+	}
+	result := map[string]interface{}{}
+	if err := MapToInterface(record, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// auditDiff returns the properties that differ between the two versions of the record.
+func auditDiff(before, after map[string]interface{}) map[string]*AuditChange {
+	diff := map[string]*AuditChange{}
+	for k, old := range before {
+		if value, ok := after[k]; !ok || !reflect.DeepEqual(old, value) {
+			diff[k] = &AuditChange{Old: old, New: after[k]}
+		}
+	}
+	for k, value := range after {
+		if _, ok := before[k]; !ok {
+			diff[k] = &AuditChange{New: value}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"context"
+	"testing"
+)
+
+func auditEntries(t *testing.T, repo *memoryRepo) []*AuditEntry {
+	entries := []*AuditEntry{}
+	for _, record := range repo.records {
+		entry := &AuditEntry{}
+		if err := MapToInterface(record, entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditingRepository(t *testing.T) {
+	auditRepo := &memoryRepo{}
+	auditor, err := NewAuditor(auditRepo, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &memoryRepo{}
+	repo := auditor.Wrap(users, "users").WithContext(WithActor(context.Background(), "admin"))
+
+	if _, err = repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Save(&map[string]interface{}{"name": "Johnny"}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.DeleteOne(Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := auditEntries(t, auditRepo)
+	if len(entries) != 3 {
+		t.Fatal("Expected 3 audit entries. Got: ", len(entries))
+	}
+
+	update := entries[1]
+	if update.Actor != "admin" || update.Collection != "users" || update.Operation != AuditSave {
+		t.Fatal("Unexpected audit entry: ", update)
+	}
+	if change, ok := update.Diff["name"]; !ok || change.Old != "John" || change.New != "Johnny" {
+		t.Fatal("Expected the name change in the diff. Got: ", update.Diff)
+	}
+	if entries[2].Operation != AuditDelete || entries[2].Before["name"] != "Johnny" || entries[2].After != nil {
+		t.Fatal("Unexpected delete entry: ", entries[2])
+	}
+
+	if err = VerifyAuditTrail(entries, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = VerifyAuditTrail(entries, []byte("other")); err == nil {
+		t.Fatal("Expected the signature check to fail")
+	}
+
+	if err = VerifyAuditTrail([]*AuditEntry{entries[0], entries[2]}, nil); err == nil {
+		t.Fatal("Expected the missing entry to be detected")
+	}
+
+	entries[1].Actor = "someone else"
+	if err = VerifyAuditTrail(entries, nil); err == nil {
+		t.Fatal("Expected the modified entry to be detected")
+	}
+}
@@ -0,0 +1,337 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BackendConfig is the typed configuration of a backend. The "validate" tags list the rules checked by
+// ParseAndValidate in addition to the schema of the backend: "required" and the named validators
+// (see RegisterValidator).
+type BackendConfig struct {
+	DBName             string                       `json:"dbName" yaml:"dbName" validate:"required"`
+	Host               string                       `json:"host,omitempty" yaml:"host,omitempty" validate:"hostport"`
+	Database           string                       `json:"database,omitempty" yaml:"database,omitempty"`
+	User               string                       `json:"user,omitempty" yaml:"user,omitempty"`
+	Pass               string                       `json:"pass,omitempty" yaml:"pass,omitempty"`
+	Credentials        string                       `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	Endpoint           string                       `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	AWSRegion          string                       `json:"awsRegion,omitempty" yaml:"awsRegion,omitempty"`
+	AWSSecretKeyID     string                       `json:"awsSecretKeyId,omitempty" yaml:"awsSecretKeyId,omitempty"`
+	AWSSecretAccessKey string                       `json:"awsSecretAccessKey,omitempty" yaml:"awsSecretAccessKey,omitempty"`
+	AWSSessionToken    string                       `json:"awsSessionToken,omitempty" yaml:"awsSessionToken,omitempty"`
+	Options            map[string]interface{}       `json:"options,omitempty" yaml:"options,omitempty"`
+	Collections        map[string]*CollectionConfig `json:"collections,omitempty" yaml:"collections,omitempty"`
+}
+
+// CollectionConfig is the typed configuration of a repository (collection/table).
+type CollectionConfig struct {
+	Indexes          []string               `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	UniqueIndexes    []string               `json:"uniqueIndexes,omitempty" yaml:"uniqueIndexes,omitempty"`
+	EnableTTL        bool                   `json:"enableTTL,omitempty" yaml:"enableTTL,omitempty"`
+	TTL              int                    `json:"TTL,omitempty" yaml:"TTL,omitempty"`
+	TTLAttribute     string                 `json:"ttlAttribute,omitempty" yaml:"ttlAttribute,omitempty"`
+	TTLMode          string                 `json:"ttlMode,omitempty" yaml:"ttlMode,omitempty"`
+	CustomID         bool                   `json:"customId,omitempty" yaml:"customId,omitempty"`
+	Timestamps       bool                   `json:"timestamps,omitempty" yaml:"timestamps,omitempty"`
+	Database         string                 `json:"database,omitempty" yaml:"database,omitempty"`
+	HashKey          string                 `json:"hashKey,omitempty" yaml:"hashKey,omitempty"`
+	RangeKey         string                 `json:"rangeKey,omitempty" yaml:"rangeKey,omitempty"`
+	HashKeyType      string                 `json:"hashKeyType,omitempty" yaml:"hashKeyType,omitempty"`
+	RangeKeyType     string                 `json:"rangeKeyType,omitempty" yaml:"rangeKeyType,omitempty"`
+	ReadCapacity     int64                  `json:"readCapacity,omitempty" yaml:"readCapacity,omitempty"`
+	WriteCapacity    int64                  `json:"writeCapacity,omitempty" yaml:"writeCapacity,omitempty"`
+	GSI              map[string]interface{} `json:"GSI,omitempty" yaml:"GSI,omitempty"`
+	ReadPreference   string                 `json:"readPreference,omitempty" yaml:"readPreference,omitempty"`
+	ConsistentRead   bool                   `json:"consistentRead,omitempty" yaml:"consistentRead,omitempty"`
+	BillingMode      string                 `json:"billingMode,omitempty" yaml:"billingMode,omitempty"`
+	AutoScaling      map[string]interface{} `json:"autoScaling,omitempty" yaml:"autoScaling,omitempty"`
+	WriteConcern     map[string]interface{} `json:"writeConcern,omitempty" yaml:"writeConcern,omitempty"`
+	Bootstrap        map[string]interface{} `json:"bootstrap,omitempty" yaml:"bootstrap,omitempty"`
+	Schema           *DocumentSchema        `json:"schema,omitempty" yaml:"schema,omitempty"`
+	FilterableFields []string               `json:"filterableFields,omitempty" yaml:"filterableFields,omitempty"`
+	SortableFields   []string               `json:"sortableFields,omitempty" yaml:"sortableFields,omitempty"`
+	IDGenerator      string                 `json:"idGenerator,omitempty" yaml:"idGenerator,omitempty"`
+	IDType           string                 `json:"idType,omitempty" yaml:"idType,omitempty"`
+	FieldNaming      string                 `json:"fieldNaming,omitempty" yaml:"fieldNaming,omitempty"`
+	Attribution      string                 `json:"attribution,omitempty" yaml:"attribution,omitempty"`
+	// CollectionOptions are the MongoDB collection options, see GetCollectionOptions.
+	CollectionOptions map[string]interface{} `json:"collectionOptions,omitempty" yaml:"collectionOptions,omitempty"`
+	// Archive is the archival policy, see GetArchivePolicy.
+	Archive map[string]interface{} `json:"archive,omitempty" yaml:"archive,omitempty"`
+	// Relations are the relations to the other repositories, see GetRelations.
+	Relations map[string]interface{} `json:"relations,omitempty" yaml:"relations,omitempty"`
+}
+
+// ConfigValidationError is returned by ParseAndValidate when the configuration is not valid.
+// It is of the ErrInvalidInput class and holds the validation result.
+type ConfigValidationError struct {
+	Result *ValidationResult
+}
+
+// Error returns the error class message.
+func (e *ConfigValidationError) Error() string {
+	return ErrInvalidInput().Error()
+}
+
+// Details returns all validation errors.
+func (e *ConfigValidationError) Details() string {
+	return strings.Join(e.Result.Errors, "; ")
+}
+
+// ParseAndValidate parses the JSON or YAML backend configuration into a BackendConfig.
+// The configuration can be the whole service configuration (with a "database" section) or just
+// the database section, with or without "dbInfo" (see ValidateConfig). The environment variable references
+// are expanded (see ExpandEnv). The configuration is validated against the
+// schema of the backend and the "validate" tags of the config structs. If it is not valid,
+// a *ConfigValidationError is returned with all errors.
+func ParseAndValidate(data []byte, manager BackendManager) (*BackendConfig, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	conf, ok := normalizeYAML(raw).(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidInput("the configuration must be an object")
+	}
+	conf, err := expandEnvConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	backendConf := flattenBackendConfig(conf)
+
+	result := newValidationResult()
+	if backendType, ok := backendConf["dbName"].(string); ok && backendType != "" {
+		schema, err := manager.GetRequiredBackendProperties(backendType)
+		if err != nil {
+			result.addMismatch(validationPath{"dbName"}, "unsupported", fmt.Sprintf("backend %s is not supported", backendType), "", backendType)
+		} else {
+			result = ValidateBackend(backendConf, schema)
+		}
+	}
+
+	backendConfig := &BackendConfig{}
+	if result.Valid {
+		// the types are already validated against the schema
+		data, err := json.Marshal(backendConf)
+		if err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+		if err := json.Unmarshal(data, backendConfig); err != nil {
+			result.addError(validationPath{}, "type", err.Error())
+		} else {
+			validateStructTags(validationPath{}, reflect.ValueOf(backendConfig), result)
+		}
+	}
+
+	if !result.Valid {
+		return nil, &ConfigValidationError{Result: result}
+	}
+	return backendConfig, nil
+}
+
+// ParseAndValidateFile reads the backend configuration from a JSON or YAML file. See ParseAndValidate.
+func ParseAndValidateFile(path string, manager BackendManager) (*BackendConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAndValidate(data, manager)
+}
+
+// DBInfo returns the connection configuration for the BackendManager.
+func (c *BackendConfig) DBInfo() *config.DBInfo {
+	return &config.DBInfo{
+		Host:               c.Host,
+		Username:           c.User,
+		Password:           c.Pass,
+		DatabaseName:       c.Database,
+		AWSCredentials:     c.Credentials,
+		AWSEndpoint:        c.Endpoint,
+		AWSRegion:          c.AWSRegion,
+		AWSSecretKeyID:     c.AWSSecretKeyID,
+		AWSSecretAccessKey: c.AWSSecretAccessKey,
+		AWSSessionToken:    c.AWSSessionToken,
+	}
+}
+
+// BackendOptions returns the backend options, to be set with BackendManager.SetBackendOptions.
+func (c *BackendConfig) BackendOptions() BackendOptions {
+	options := BackendOptions{}
+	for key, value := range c.Options {
+		options[key] = value
+	}
+	return options
+}
+
+// Definitions returns the repository definitions of all collections by name.
+func (c *BackendConfig) Definitions() map[string]RepositoryDefinition {
+	definitions := map[string]RepositoryDefinition{}
+	for name, collection := range c.Collections {
+		definitions[name] = collection.Definition(name)
+	}
+	return definitions
+}
+
+// Definition returns the repository definition for the collection with the given name.
+func (c *CollectionConfig) Definition(name string) RepositoryDefinitionMap {
+	def := RepositoryDefinitionMap{
+		"name":       name,
+		"enableTtl":  c.EnableTTL,
+		"ttl":        c.TTL,
+		"customId":   c.CustomID,
+		"timestamps": c.Timestamps,
+	}
+	if c.ConsistentRead {
+		def["consistentRead"] = true
+	}
+
+	indexes := []Index{}
+	indexes = append(indexes, indexesFromConfig(toInterfaceSlice(c.Indexes), false)...)
+	indexes = append(indexes, indexesFromConfig(toInterfaceSlice(c.UniqueIndexes), true)...)
+	if len(indexes) > 0 {
+		def["indexes"] = indexes
+	}
+
+	properties := map[string]string{
+		"ttlAttribute":   c.TTLAttribute,
+		"ttlMode":        c.TTLMode,
+		"database":       c.Database,
+		"hashKey":        c.HashKey,
+		"rangeKey":       c.RangeKey,
+		"hashKeyType":    c.HashKeyType,
+		"rangeKeyType":   c.RangeKeyType,
+		"readPreference": c.ReadPreference,
+		"billingMode":    c.BillingMode,
+		"idGenerator":    c.IDGenerator,
+		"idType":         c.IDType,
+		"fieldNaming":    c.FieldNaming,
+		"attribution":    c.Attribution,
+	}
+	for key, value := range properties {
+		if value != "" {
+			def[key] = value
+		}
+	}
+
+	if c.ReadCapacity != 0 {
+		def["readCapacity"] = c.ReadCapacity
+	}
+	if c.WriteCapacity != 0 {
+		def["writeCapacity"] = c.WriteCapacity
+	}
+	if c.GSI != nil {
+		def["GSI"] = c.GSI
+	}
+	if c.WriteConcern != nil {
+		def["writeConcern"] = c.WriteConcern
+	}
+	if c.Bootstrap != nil {
+		def["bootstrap"] = c.Bootstrap
+	}
+	if c.FilterableFields != nil {
+		def["filterableFields"] = c.FilterableFields
+	}
+	if c.SortableFields != nil {
+		def["sortableFields"] = c.SortableFields
+	}
+	if c.AutoScaling != nil {
+		def["autoScaling"] = c.AutoScaling
+	}
+	if c.Schema != nil {
+		def["schema"] = c.Schema
+	}
+	if c.CollectionOptions != nil {
+		def["collectionOptions"] = c.CollectionOptions
+	}
+	if c.Archive != nil {
+		def["archive"] = c.Archive
+	}
+	if c.Relations != nil {
+		def["relations"] = c.Relations
+	}
+	return def
+}
+
+// validateStructTags checks the "validate" tags of the struct fields. Errors already reported
+// for a field by the schema validation are not repeated.
+func validateStructTags(path validationPath, value reflect.Value, result *ValidationResult) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		keys := map[string]interface{}{}
+		for _, key := range value.MapKeys() {
+			keys[fmt.Sprintf("%v", key.Interface())] = key
+		}
+		for _, key := range sortedKeys(keys) {
+			validateStructTags(path.with(key), value.MapIndex(keys[key].(reflect.Value)), result)
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		name := fieldName(field)
+		fieldPath := path.with(name)
+		fieldValue := value.Field(i)
+
+		if rules, ok := field.Tag.Lookup("validate"); ok && !result.hasError(fieldPath) {
+			validatorNames := []string{}
+			for _, rule := range strings.Split(rules, ",") {
+				if rule == "required" {
+					if isZero(fieldValue) {
+						result.addError(fieldPath, "required", "is required")
+					}
+					continue
+				}
+				validatorNames = append(validatorNames, rule)
+			}
+			if !isZero(fieldValue) {
+				applyValidators(fieldPath, fieldValue.Interface(), validatorNames, result)
+			}
+		}
+
+		if fieldValue.Kind() == reflect.Map && fieldValue.Type().Elem().Kind() == reflect.Ptr {
+			validateStructTags(fieldPath, fieldValue, result)
+		}
+	}
+}
+
+// hasError checks if an error is already reported for the property on the given path.
+func (r *ValidationResult) hasError(path validationPath) bool {
+	pointer := path.Pointer()
+	for _, detail := range r.Details {
+		if detail.Path == pointer {
+			return true
+		}
+	}
+	return false
+}
+
+func isZero(value reflect.Value) bool {
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	result := []interface{}{}
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestParseAndValidate(t *testing.T) {
+	manager := NewBackendSupport(map[string]*config.DBInfo{})
+
+	conf, err := ParseAndValidate([]byte(`
+database:
+  dbName: mongodb
+  dbInfo:
+    host: mongo:27017
+    database: users
+    user: restapi
+    pass: secret
+  options:
+    lazyConnect: true
+  collections:
+    users:
+      indexes: [email]
+      uniqueIndexes: [username]
+      enableTTL: true
+      TTL: 3600
+      ttlAttribute: created_at
+      timestamps: true
+      schema:
+        type: object
+        required: [email]
+`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.DBName != "mongodb" || conf.Host != "mongo:27017" || conf.Database != "users" {
+		t.Errorf("Unexpected config: %+v", conf)
+	}
+
+	dbInfo := conf.DBInfo()
+	if dbInfo.Username != "restapi" || dbInfo.Password != "secret" || dbInfo.DatabaseName != "users" {
+		t.Errorf("Unexpected DBInfo: %+v", dbInfo)
+	}
+	if !conf.BackendOptions().GetBool("lazyConnect") {
+		t.Error("Expected lazyConnect option")
+	}
+
+	users, ok := conf.Collections["users"]
+	if !ok {
+		t.Fatal("Expected users collection")
+	}
+	if users.TTL != 3600 || !users.EnableTTL || users.TTLAttribute != "created_at" {
+		t.Errorf("Unexpected collection config: %+v", users)
+	}
+
+	def := conf.Definitions()["users"]
+	if def.GetName() != "users" || !def.EnableTTL() || def.GetTTL() != 3600 || !def.UseTimestamps() {
+		t.Errorf("Unexpected definition: %v", def)
+	}
+	if len(def.GetIndexes()) != 2 {
+		t.Errorf("Expected 2 indexes, got %d", len(def.GetIndexes()))
+	}
+	if schema := def.GetSchema(); schema == nil || len(schema.Required) != 1 {
+		t.Errorf("Expected the document schema, got %v", schema)
+	}
+}
+
+func TestParseAndValidateInvalid(t *testing.T) {
+	manager := NewBackendSupport(map[string]*config.DBInfo{})
+
+	cases := map[string]string{
+		`{"host": "mongo:27017"}`: "/dbName",
+		`{"dbName": "mongodb", "collections": {"users": {"TTL": "1h"}}}`: "/collections/users/TTL",
+		`{"dbName": "dynamodb", "host": "192.168.1.90:89-9"}`:            "/host",
+		`{"dbName": "cassandra"}`:                                        "/dbName",
+	}
+
+	for data, path := range cases {
+		_, err := ParseAndValidate([]byte(data), manager)
+		if err == nil {
+			t.Errorf("Expected an error for %s", data)
+			continue
+		}
+		if !IsErrInvalidInput(err) {
+			t.Errorf("Expected invalid input error, got %s", err)
+		}
+		validationErr, ok := err.(*ConfigValidationError)
+		if !ok {
+			t.Errorf("Expected ConfigValidationError, got %T", err)
+			continue
+		}
+		details := validationErr.Result.Details
+		if len(details) != 1 || details[0].Path != path {
+			t.Errorf("Expected one error on %s for %s, got %v", path, data, validationErr.Details())
+		}
+	}
+}
+
+func TestCollectionConfigDefinition(t *testing.T) {
+	def := (&CollectionConfig{
+		HashKey:       "token",
+		ReadCapacity:  5,
+		WriteCapacity: 2,
+	}).Definition("tokens")
+
+	if def.GetHashKey() != "token" || def.GetReadCapacity() != 5 || def.GetWriteCapacity() != 2 {
+		t.Errorf("Unexpected definition: %v", def)
+	}
+	if def.EnableTTL() || def.GetTTLMode() != TTLFixed || def.GetRangeKey() != "" {
+		t.Errorf("Expected the defaults, got %v", def)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
 )
@@ -44,6 +45,118 @@ func (f Filter) MatchPattern(property, value string) Filter {
 	return f
 }
 
+// Contains matches the entries where the array property contains all of the given values.
+// For example:
+// 		filter := backends.NewFilter().Contains("tags", "go", "aws")
+// would match the entries tagged with both "go" and "aws".
+func (f Filter) Contains(property string, values ...interface{}) Filter {
+	f[property] = map[string]interface{}{
+		"$all": values,
+	}
+	return f
+}
+
+// ElemMatch matches the entries where an element of the array property matches the given filter.
+// For example:
+// 		filter := backends.NewFilter().ElemMatch("roles", backends.NewFilter().Match("name", "admin").Match("scope", "billing"))
+// On DynamoDB the element must be equal to the filter, as the elements are compared as a whole.
+func (f Filter) ElemMatch(property string, match Filter) Filter {
+	f[property] = map[string]interface{}{
+		"$elemMatch": match,
+	}
+	return f
+}
+
+// PatternOptions are the options of a pattern match.
+type PatternOptions struct {
+	// CaseInsensitive ignores the case of the letters. It is not supported on DynamoDB.
+	CaseInsensitive bool
+	// Unanchored matches the pattern anywhere in the value, as if it started and ended with "%".
+	Unanchored bool
+}
+
+// MatchPatternWith sets a pattern match with options for the given property.
+// For example:
+// 		filter := backends.NewFilter().MatchPatternWith("name", "john", backends.PatternOptions{CaseInsensitive: true, Unanchored: true})
+// would match "John", "Johnny" and "Little john".
+func (f Filter) MatchPatternWith(property, value string, options PatternOptions) Filter {
+	specs := map[string]string{
+		"$pattern": value,
+	}
+	if options.CaseInsensitive {
+		specs["$caseInsensitive"] = "true"
+	}
+	if options.Unanchored {
+		specs["$anchored"] = "false"
+	}
+	f[property] = specs
+	return f
+}
+
+// MatchPrefix matches the values that start with the prefix. The prefix is matched literally ("%" is
+// not a wildcard), with an index-friendly anchored regex on MongoDB and begins_with on DynamoDB.
+func (f Filter) MatchPrefix(property, prefix string) Filter {
+	f[property] = map[string]string{
+		"$prefix": prefix,
+	}
+	return f
+}
+
+// MatchSuffix matches the values that end with the suffix. The suffix is matched literally.
+// DynamoDB has no suffix match, so it matches the values that contain the suffix.
+func (f Filter) MatchSuffix(property, suffix string) Filter {
+	f[property] = map[string]string{
+		"$suffix": suffix,
+	}
+	return f
+}
+
+// Exists matches the entries that have (or, if exists is false, do not have) the given property.
+// A property with a null value exists.
+func (f Filter) Exists(property string, exists bool) Filter {
+	f[property] = map[string]interface{}{
+		"$exists": exists,
+	}
+	return f
+}
+
+// IsNull matches the entries where the property is explicitly set to null (or, if null is false, is set
+// to a value other than null). Entries without the property do not match, use Exists for them.
+func (f Filter) IsNull(property string, null bool) Filter {
+	f[property] = map[string]interface{}{
+		"$null": null,
+	}
+	return f
+}
+
+// Since matches the entries where the date property is at or after the given time.
+// For example, the records created in the last 7 days:
+// 		filter := backends.NewFilter().Since("createdAt", time.Now().AddDate(0, 0, -7))
+func (f Filter) Since(property string, since time.Time) Filter {
+	f[property] = map[string]interface{}{
+		"$since": since,
+	}
+	return f
+}
+
+// Until matches the entries where the date property is at or before the given time.
+func (f Filter) Until(property string, until time.Time) Filter {
+	f[property] = map[string]interface{}{
+		"$until": until,
+	}
+	return f
+}
+
+// Between matches the entries where the date property is between the given times, inclusive.
+// The dates stored as time.Time (MongoDB dates), RFC3339 strings and epoch seconds are matched.
+func (f Filter) Between(property string, since, until time.Time) Filter {
+	f[property] = map[string]interface{}{
+		"$since": since,
+		"$until": until,
+	}
+	return f
+}
+
 // Set is an alias for Filter.Match - do an exact match on the given property.
 func (f Filter) Set(property string, value interface{}) Filter {
 	f[property] = value
@@ -53,16 +166,24 @@ func (f Filter) Set(property string, value interface{}) Filter {
 // Repository defines the interface for accessing the data
 type Repository interface {
 	GetOne(filter Filter, result interface{}) (interface{}, error)
+	// GetAll returns the matched records.
+	//
+	// Deprecated: use Find, which takes a Query instead of the positional order, sorting, limit and offset.
 	GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error)
 	Save(object interface{}, filter Filter) (interface{}, error)
 	DeleteOne(filter Filter) error
 	DeleteAll(filter Filter) error
 }
 
+// Index defines an index on a collection. Fields prefixed with "-" are indexed in descending order.
 type Index interface {
 	GetName() string
 	GetFields() []string
 	Unique() bool
+	Sparse() bool
+	DropDups() bool
+	GetPartialFilter() map[string]interface{}
+	GetCollation() *Collation
 }
 
 // RepositoryDefinition defines interface for accessing collection props
@@ -72,6 +193,7 @@ type RepositoryDefinition interface {
 	EnableTTL() bool
 	GetTTL() int
 	GetTTLAttribute() string
+	GetTTLMode() string
 	GetHashKey() string
 	GetRangeKey() string
 	GetHashKeyType() string
@@ -80,15 +202,38 @@ type RepositoryDefinition interface {
 	GetWriteCapacity() int64
 	GetGSI() map[string]interface{}
 	IsCustomID() bool
+	GetBootstrap() *BootstrapSpec
+	GetReadPreference() string
+	IsConsistentRead() bool
+	GetBillingMode() string
+	GetAutoScaling() *AutoScaling
+	GetWriteConcern() (*WriteConcern, error)
+	GetDatabase() string
+	UseTimestamps() bool
+	GetSchema() *DocumentSchema
+	GetFilterableFields() []string
+	GetSortableFields() []string
+	GetIDGenerator() string
+	GetIDType() string
+	GetCollectionOptions() *CollectionOptions
+	GetArchivePolicy() *ArchivePolicy
+	GetRelations() []*Relation
+	GetFieldNaming() string
+	GetAttribution() string
 }
 
 // Backend defines interface for defining the repository
 type Backend interface {
 	DefineRepository(name string, def RepositoryDefinition) (Repository, error)
+	GetOrCreateRepository(name string, def RepositoryDefinition) (Repository, error)
 	GetRepository(name string) (Repository, error)
 	GetConfig() *config.DBInfo
 	GetFromContext(key string) interface{}
 	SetInContext(key string, value interface{})
+	Capabilities() *Capabilities
+	Locks() *LockManager
+	Session(ctx context.Context) (*Session, error)
+	Close(ctx context.Context) error
 	Shutdown()
 }
 
@@ -98,6 +243,15 @@ type BackendManager interface {
 	SupportBackend(backendType string, builder BackendBuilder, properties map[string]interface{})
 	GetSupportedBackends() []string
 	GetRequiredBackendProperties(backendType string) (map[string]interface{}, error)
+	SetBackendOptions(backendType string, options BackendOptions)
+	GetBackendOptions(backendType string) BackendOptions
+	Shutdown(ctx context.Context) error
+	RegisterMigrations(backendType, repository string, migrations ...*Migration)
+	Backup(ctx context.Context, target BackupTarget) (*BackupManifest, error)
+	Restore(ctx context.Context, source BackupSource, onConflict BootstrapConflictPolicy) (*BackupManifest, error)
+	Migrate(ctx context.Context) error
+	Reload(ctx context.Context, dbConfig map[string]*config.DBInfo) error
+	SetMaintenance(backendType string, mode MaintenanceMode) error
 }
 
 // BackendBuilder builds the backend
@@ -106,6 +260,25 @@ type BackendBuilder func(conf *config.DBInfo, manager BackendManager) (Backend,
 // RepoBuilder builds the repo (collection or table)
 type RepoBuilder func(def RepositoryDefinition, backend Backend) (Repository, error)
 
+const (
+	// TTLFixed expires the records TTL seconds after they are saved.
+	TTLFixed = "fixed"
+	// TTLExpireAt expires every record at the date held in its TTL attribute.
+	TTLExpireAt = "expireAt"
+)
+
+const (
+	// CreatedAtField holds the time the record was created, when timestamps are enabled for the repository.
+	CreatedAtField = "createdAt"
+	// UpdatedAtField holds the time the record was last saved, when timestamps are enabled for the repository.
+	UpdatedAtField = "updatedAt"
+	// CreatedByField holds the id of the principal that created the record, when attribution is enabled for the
+	// repository.
+	CreatedByField = "createdBy"
+	// UpdatedByField holds the id of the principal that last saved the record.
+	UpdatedByField = "updatedBy"
+)
+
 // RepositoryDefinitionMap is the configuration map
 type RepositoryDefinitionMap map[string]interface{}
 
@@ -117,18 +290,26 @@ type DefaultBackendManager struct {
 	backendBuilders map[string]BackendBuilder
 	backends        map[string]Backend
 	backendProps    map[string]interface{}
+	backendOptions  map[string]BackendOptions
+	backendsOrder   []string
+	migrations      map[string]map[string][]*Migration
 	dbConfig        map[string]*config.DBInfo
 	mutex           *sync.Mutex
+	// optionsMutex guards backendOptions. The builders read the options while the manager is locked.
+	optionsMutex sync.RWMutex
 }
 
 // RepositoriesBackend represents the repository store
 type RepositoriesBackend struct {
 	repositories      map[string]Repository
+	definitions       map[string]RepositoryDefinition
+	building          map[string]*repositoryCall
 	repositoryBuilder RepoBuilder
 	mutex             *sync.Mutex
 	DBInfo            *config.DBInfo
 	ctx               context.Context
 	cleanupFn         BackendCleanup
+	cleanups          []BackendCleanup
 }
 
 // GetIndexes returns the indexes for colletion or table
@@ -147,12 +328,12 @@ func (m RepositoryDefinitionMap) GetIndexes() []Index {
 
 // IsCustomID returns if the ID (property "id") has custom handling.
 // If customId is false, then the hadling of the ID is left to the
-// underlying backend.
+// underlying backend. The IDs generated with an ID generator are custom IDs.
 func (m RepositoryDefinitionMap) IsCustomID() bool {
-	if customID, ok := m["customId"]; ok {
-		return customID.(bool)
+	if customID, ok := m["customId"]; ok && customID.(bool) {
+		return true
 	}
-	return false
+	return m.GetIDGenerator() != ""
 }
 
 // GetName returns the collection/table name
@@ -164,6 +345,25 @@ func (m RepositoryDefinitionMap) GetName() string {
 	return ""
 }
 
+// GetDatabase returns the database name for the collection, overriding the backend database.
+// Returns empty string if the collection is in the backend database.
+func (m RepositoryDefinitionMap) GetDatabase() string {
+	if database, ok := m["database"]; ok {
+		return database.(string)
+	}
+
+	return ""
+}
+
+// UseTimestamps returns whether the CreatedAtField and UpdatedAtField are maintained on Save (property "timestamps").
+func (m RepositoryDefinitionMap) UseTimestamps() bool {
+	if timestamps, ok := m["timestamps"]; ok {
+		return timestamps.(bool)
+	}
+
+	return false
+}
+
 // EnableTTL set the TTL for collection or table
 func (m RepositoryDefinitionMap) EnableTTL() bool {
 	if ttlEnabled, ok := m["enableTtl"]; ok {
@@ -191,6 +391,16 @@ func (m RepositoryDefinitionMap) GetTTLAttribute() string {
 	return ""
 }
 
+// GetTTLMode returns how the records expire (property "ttlMode"): TTLFixed (default) - TTL seconds after they are
+// saved, or TTLExpireAt - at the date held in the TTL attribute of every record.
+func (m RepositoryDefinitionMap) GetTTLMode() string {
+	if ttlMode, ok := m["ttlMode"]; ok {
+		return ttlMode.(string)
+	}
+
+	return TTLFixed
+}
+
 // GetHashKey return the hashKey for dynamoDB
 func (m RepositoryDefinitionMap) GetHashKey() string {
 	if hashKey, ok := m["hashKey"]; ok {
@@ -252,27 +462,96 @@ func (m RepositoryDefinitionMap) GetRangeKeyType() string {
 	return ""
 }
 
-// DefineRepository defines the repository (collection/table)
+// repositoryCall is a repository being built by GetOrCreateRepository.
+type repositoryCall struct {
+	done       chan struct{}
+	repository Repository
+	err        error
+}
+
+// DefineRepository defines the repository (collection/table). If the repository is already defined, the
+// defined repository is returned. See GetOrCreateRepository.
 func (m *RepositoriesBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	return m.GetOrCreateRepository(name, def)
+}
 
+// GetOrCreateRepository returns the repository with the name, building it with the definition on the first
+// use, so the repositories don't have to be defined at startup. It is safe for concurrent use: the
+// concurrent calls for the same name wait for a single build and get its result, while the repositories
+// with different names are built in parallel. A failed build is not cached; the next call builds the
+// repository again.
+func (m *RepositoriesBackend) GetOrCreateRepository(name string, def RepositoryDefinition) (Repository, error) {
+	m.mutex.Lock()
 	if repository, ok := m.repositories[name]; ok {
+		m.mutex.Unlock()
 		return repository, nil
 	}
+	if call, ok := m.building[name]; ok {
+		m.mutex.Unlock()
+		<-call.done
+		return call.repository, call.err
+	}
+	if def == nil {
+		m.mutex.Unlock()
+		return nil, ErrInvalidInput(fmt.Sprintf("no definition for the repository %s", name))
+	}
+	call := &repositoryCall{done: make(chan struct{})}
+	if m.building == nil {
+		m.building = map[string]*repositoryCall{}
+	}
+	m.building[name] = call
+	m.mutex.Unlock()
+
+	call.repository, call.err = m.buildRepository(namespaceDefinition(def, optionsFromBackend(m)))
 
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	delete(m.building, name)
+	if call.err == nil {
+		m.repositories[name] = call.repository
+		if m.definitions == nil {
+			m.definitions = map[string]RepositoryDefinition{}
+		}
+		m.definitions[name] = def
+	}
+	m.mutex.Unlock()
+	close(call.done)
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	database := def.GetDatabase()
+	if database == "" {
+		database = m.DBInfo.DatabaseName
+	}
+
+	Events.Publish(&Event{
+		Type:       EventRepositoryProvisioned,
+		Database:   database,
+		Repository: name,
+	})
 
+	return call.repository, nil
+}
+
+// buildRepository builds the repository and applies its bootstrap.
+func (m *RepositoriesBackend) buildRepository(def RepositoryDefinition) (Repository, error) {
 	repository, err := m.repositoryBuilder(def, m)
 	if err != nil {
 		return nil, err
 	}
 
-	m.repositories[name] = repository
+	if err = ApplyBootstrap(repository, def.GetBootstrap()); err != nil && !IsErrBackendUnavailable(err) {
+		// lazily connected backends apply the bootstrap once connected
+		return nil, err
+	}
 	return repository, nil
 }
 
 // GetRepository return the repository (collection/table)
 func (m *RepositoriesBackend) GetRepository(name string) (Repository, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if repo, ok := m.repositories[name]; ok {
 		return repo, nil
 	}
@@ -298,20 +577,32 @@ func (m *RepositoriesBackend) SetInContext(key string, value interface{}) {
 	m.ctx = context.WithValue(m.ctx, key, value)
 }
 
-// Shutdown close the session
-func (m *RepositoriesBackend) Shutdown() {
-	if m.cleanupFn != nil {
-		m.cleanupFn()
+// Capabilities returns the features supported by the database server. If the capabilities
+// were not detected by the backend builder, an empty Capabilities is returned.
+func (m *RepositoriesBackend) Capabilities() *Capabilities {
+	switch capabilities := m.GetFromContext(CAPABILITIES_CTX_KEY).(type) {
+	case *Capabilities:
+		return capabilities
+	case interface{ Capabilities() *Capabilities }:
+		// detected once the backend connects
+		return capabilities.Capabilities()
 	}
+	return &Capabilities{}
+}
+
+// Shutdown close the session. It does not wait for the in-flight operations, see Close.
+func (m *RepositoriesBackend) Shutdown() {
+	m.runCleanup()
 }
 
 // GetBackend returns the RepositoryBackend
 func (m *DefaultBackendManager) GetBackend(backendType string) (Backend, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if backend, ok := m.backends[backendType]; ok {
 		return backend, nil
 	}
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
 
 	backend, err := m.buildBackend(backendType)
 	if err != nil {
@@ -345,33 +636,121 @@ func (m *DefaultBackendManager) GetRequiredBackendProperties(backendType string)
 	return nil, fmt.Errorf("backend not supported")
 }
 
+// SetBackendOptions sets the additional options for the backend. The options must be
+// set before the backend is built (before the first call to GetBackend).
+func (m *DefaultBackendManager) SetBackendOptions(backendType string, options BackendOptions) {
+	m.optionsMutex.Lock()
+	defer m.optionsMutex.Unlock()
+
+	if m.backendOptions == nil {
+		m.backendOptions = map[string]BackendOptions{}
+	}
+	m.backendOptions[backendType] = options
+}
+
+// GetBackendOptions returns the additional options for the backend. If no options were set,
+// an empty BackendOptions is returned.
+func (m *DefaultBackendManager) GetBackendOptions(backendType string) BackendOptions {
+	m.optionsMutex.RLock()
+	defer m.optionsMutex.RUnlock()
+	if options, ok := m.backendOptions[backendType]; ok && options != nil {
+		return options
+	}
+	return BackendOptions{}
+}
+
 // buildBackend builds new backend
 func (m *DefaultBackendManager) buildBackend(backendType string) (Backend, error) {
-	if backendBuilder, ok := m.backendBuilders[backendType]; ok {
-		dbInfo, ok := m.dbConfig[backendType]
-		if !ok || dbInfo == nil {
-			return nil, fmt.Errorf("backend not configured")
-		}
-		backend, err := backendBuilder(dbInfo, m)
-		if err != nil {
-			return nil, err
-		}
-		m.backends[backendType] = backend
+	if _, ok := m.backendBuilders[backendType]; !ok {
+		return nil, fmt.Errorf("backend not supported")
+	}
+	dbInfo, ok := m.dbConfig[backendType]
+	if !ok || dbInfo == nil {
+		return nil, fmt.Errorf("backend not configured")
+	}
+	backend, err := m.newBackend(backendType, dbInfo)
+	if err != nil {
+		return nil, err
+	}
+	m.backends[backendType] = backend
+	m.backendsOrder = append(m.backendsOrder, backendType)
+
+	return backend, nil
+}
+
+// newBackend builds a backend for the connection configuration, without registering it in the manager.
+// If the "standby" backend option is set, a FailoverBackend is built for the primary and the standby cluster.
+func (m *DefaultBackendManager) newBackend(backendType string, dbInfo *config.DBInfo) (Backend, error) {
+	backendBuilder, ok := m.backendBuilders[backendType]
+	if !ok {
+		return nil, fmt.Errorf("backend not supported")
+	}
+	dbInfo, err := expandDBInfo(dbInfo)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := m.connectBackend(backendType, backendBuilder, dbInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	options := m.GetBackendOptions(backendType)
+	standbyInfo := standbyDBInfo(dbInfo, options)
+	if standbyInfo == nil {
 		return backend, nil
 	}
-	return nil, fmt.Errorf("backend not supported")
+	standby, err := m.connectBackend(backendType, backendBuilder, standbyInfo)
+	if err != nil {
+		backend.Close(context.Background())
+		return nil, err
+	}
+	failover := NewFailoverBackend(backendType, backend, standby, failoverConfigFromOptions(options))
+	failover.Start()
+
+	return failover, nil
+}
+
+// connectBackend builds the backend with the builder and publishes the connection event.
+func (m *DefaultBackendManager) connectBackend(backendType string, backendBuilder BackendBuilder, dbInfo *config.DBInfo) (Backend, error) {
+	backend, err := backendBuilder(dbInfo, m)
+	if err != nil {
+		Events.Publish(&Event{
+			Type:     EventBackendDegraded,
+			Backend:  backendType,
+			Database: dbInfo.DatabaseName,
+			Error:    err,
+		})
+		return nil, err
+	}
+
+	Events.Publish(&Event{
+		Type:     EventBackendConnected,
+		Backend:  backendType,
+		Database: dbInfo.DatabaseName,
+	})
+
+	return backend, nil
 }
 
 // NewRepositoriesBackend sets new RepositoriesBackend
 func NewRepositoriesBackend(ctx context.Context, dbInfo *config.DBInfo, repoBuilder RepoBuilder, cleanup BackendCleanup) Backend {
-	return &RepositoriesBackend{
+	options, _ := ctx.Value(OPTIONS_CTX_KEY).(BackendOptions)
+	ctx = context.WithValue(ctx, TRACKER_CTX_KEY, newOperationTracker())
+	maintenance := newMaintenanceState(ctx, options)
+	ctx = context.WithValue(ctx, MAINTENANCE_CTX_KEY, maintenance)
+	backend := &RepositoriesBackend{
 		DBInfo:            dbInfo,
 		mutex:             &sync.Mutex{},
 		repositories:      map[string]Repository{},
+		definitions:       map[string]RepositoryDefinition{},
 		repositoryBuilder: repoBuilder,
 		ctx:               ctx,
 		cleanupFn:         cleanup,
 	}
+	if maintenance.offlineJournal {
+		backend.startOfflineReplay(maintenance, options.GetDuration("offlineReplayInterval"))
+	}
+	return backend
 }
 
 // NewBackendManager returns new backend manager
@@ -379,6 +758,7 @@ func NewBackendManager(dbConfig map[string]*config.DBInfo) BackendManager {
 	return &DefaultBackendManager{
 		backendBuilders: map[string]BackendBuilder{},
 		backendProps:    map[string]interface{}{},
+		backendOptions:  map[string]BackendOptions{},
 		backends:        map[string]Backend{},
 		dbConfig:        dbConfig,
 		mutex:           &sync.Mutex{},
@@ -404,6 +784,22 @@ func (f *fieldsIndex) Unique() bool {
 	return f.unique
 }
 
+func (f *fieldsIndex) Sparse() bool {
+	return false
+}
+
+func (f *fieldsIndex) DropDups() bool {
+	return false
+}
+
+func (f *fieldsIndex) GetPartialFilter() map[string]interface{} {
+	return nil
+}
+
+func (f *fieldsIndex) GetCollation() *Collation {
+	return nil
+}
+
 func NewIndex(name string, unique bool, fields ...string) Index {
 	if fields == nil {
 		fields = []string{}
@@ -70,6 +70,15 @@ func repoBuilderFn(repoDef RepositoryDefinition, backend Backend) (Repository, e
 	repo := DynamoCollection{
 		&dynamo.Table{},
 		&collectionInfo,
+		nil,
+		false,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		OperationOptions{},
+		nil,
 	}
 
 	return &repo, nil
@@ -91,6 +100,17 @@ func TestGetName(t *testing.T) {
 	}
 }
 
+func TestGetDatabase(t *testing.T) {
+	if database := collectionInfo.GetDatabase(); database != "" {
+		t.Errorf("Expected no database override, got %s", database)
+	}
+
+	def := RepositoryDefinitionMap{"name": "events", "database": "audit"}
+	if database := def.GetDatabase(); database != "audit" {
+		t.Errorf("Expected database was audit, got %s", database)
+	}
+}
+
 func TestEnableTTL(t *testing.T) {
 	ttl := collectionInfo.EnableTTL()
 
@@ -115,6 +135,17 @@ func TestGetTTLAttribute(t *testing.T) {
 	}
 }
 
+func TestGetTTLMode(t *testing.T) {
+	if mode := collectionInfo.GetTTLMode(); mode != TTLFixed {
+		t.Errorf("Expected TTL mode was fixed, got %s", mode)
+	}
+
+	def := RepositoryDefinitionMap{"ttlMode": TTLExpireAt}
+	if mode := def.GetTTLMode(); mode != TTLExpireAt {
+		t.Errorf("Expected TTL mode was expireAt, got %s", mode)
+	}
+}
+
 func TestGetHashKey(t *testing.T) {
 	hashKey := collectionInfo.GetHashKey()
 
@@ -178,6 +209,68 @@ func TestGetRepository(t *testing.T) {
 	}
 }
 
+func TestGetOrCreateRepository(t *testing.T) {
+	var mutex sync.Mutex
+	builds := 0
+	release := make(chan struct{})
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		mutex.Lock()
+		builds++
+		mutex.Unlock()
+		<-release
+		return repoBuilderFn(def, backend)
+	}, func() {})
+
+	var wg sync.WaitGroup
+	repositories := make([]Repository, 10)
+	for i := range repositories {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo, err := backend.GetOrCreateRepository("lazy", RepositoryDefinitionMap{"name": "lazy"})
+			if err != nil {
+				t.Error(err)
+			}
+			repositories[i] = repo
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+
+	if builds != 1 {
+		t.Fatal("Expected the repository to be built once. Got builds: ", builds)
+	}
+	for _, repo := range repositories {
+		if repo == nil || repo != repositories[0] {
+			t.Fatal("Expected the same repository for all calls")
+		}
+	}
+	if repo, err := backend.GetRepository("lazy"); err != nil || repo != repositories[0] {
+		t.Fatal("Expected the created repository to be defined. Got: ", err)
+	}
+	if _, err := backend.GetOrCreateRepository("undefined", nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a definition. Got: ", err)
+	}
+}
+
+func TestGetOrCreateRepositoryRetriesFailedBuild(t *testing.T) {
+	fail := true
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		if fail {
+			return nil, ErrBackendUnavailable("not connected")
+		}
+		return repoBuilderFn(def, backend)
+	}, func() {})
+
+	if _, err := backend.GetOrCreateRepository("lazy", RepositoryDefinitionMap{"name": "lazy"}); err == nil {
+		t.Fatal("Expected the build error")
+	}
+	fail = false
+	if repo, err := backend.GetOrCreateRepository("lazy", RepositoryDefinitionMap{"name": "lazy"}); err != nil || repo == nil {
+		t.Fatal("Expected the repository to be built again. Got: ", err)
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	conf := repoBuilder.GetConfig()
 
@@ -237,3 +330,27 @@ func TestGetRequiredBackendProperties(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 }
+
+func TestBackendOptionsConcurrentAccess(t *testing.T) {
+	manager := NewBackendManager(map[string]*config.DBInfo{"db": &config.DBInfo{}})
+	manager.SupportBackend("db", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		// the builder reads the options while the manager is locked
+		manager.GetBackendOptions("db").GetString("namePrefix")
+		return NewRepositoriesBackend(context.Background(), dbInfo, repoBuilderFn, nil), nil
+	}, map[string]interface{}{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			manager.SetBackendOptions("db", BackendOptions{"namePrefix": "test_"})
+		}
+	}()
+	if _, err := manager.GetBackend("db"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		manager.GetBackendOptions("db")
+	}
+	<-done
+}
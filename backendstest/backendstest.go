@@ -0,0 +1,235 @@
+// Package backendstest runs MongoDB and DynamoDB Local in Docker containers for the integration tests of
+// the services using the backends, and builds backends against them. For the unit tests, it provides
+// mocks of the Repository, Backend and BackendManager interfaces (see MockRepository).
+//
+// The containers are usually started once per test package, in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		mongo, err := backendstest.StartMongoDB()
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		manager = backendstest.NewBackendManager(mongo)
+//		code := m.Run()
+//		mongo.Stop()
+//		os.Exit(code)
+//	}
+//
+// The records are removed between the tests with Truncate. If the MONGODB_TEST_HOST (or
+// DYNAMODB_TEST_ENDPOINT) environment variable is set, the server at that address is used instead of
+// starting a container, for example a service container of the CI pipeline.
+package backendstest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/backends"
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/mgo.v2"
+)
+
+// Default images of the containers. The MongoDB driver supports the servers up to MongoDB 4.
+var (
+	MongoDBImage       = "mongo:4.0"
+	DynamoDBLocalImage = "amazon/dynamodb-local"
+)
+
+// StartTimeout is the time to wait for the database in a started container to accept connections.
+var StartTimeout = time.Minute
+
+// Database names of the backends built with NewBackendManager.
+const (
+	MongoDBDatabase  = "backendstest"
+	DynamoDBDatabase = "backendstest"
+	// DynamoDBRegion is the region of the DynamoDB Local backend; DynamoDB Local keeps separate tables per region.
+	DynamoDBRegion = "us-east-1"
+)
+
+// Container is a database server for the tests, in a Docker container started by StartMongoDB or
+// StartDynamoDBLocal, or an existing server given by an environment variable.
+type Container struct {
+	// ID is the ID of the Docker container, or empty for an existing server.
+	ID string
+	// BackendType is the backend of the database ("mongodb" or "dynamodb").
+	BackendType string
+	// Address is the host:port of the database.
+	Address string
+}
+
+// StartMongoDB starts a MongoDB container (or uses the server at MONGODB_TEST_HOST) and waits for it to
+// accept connections.
+func StartMongoDB() (*Container, error) {
+	container, err := start("mongodb", "MONGODB_TEST_HOST", MongoDBImage, "27017/tcp")
+	if err != nil {
+		return nil, err
+	}
+	err = container.waitFor(func() error {
+		session, err := mgo.DialWithTimeout(container.Address, time.Second)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		return session.Ping()
+	})
+	return container, err
+}
+
+// StartDynamoDBLocal starts a DynamoDB Local container (or uses the endpoint at DYNAMODB_TEST_ENDPOINT) and
+// waits for it to accept requests.
+func StartDynamoDBLocal() (*Container, error) {
+	container, err := start("dynamodb", "DYNAMODB_TEST_ENDPOINT", DynamoDBLocalImage, "8000/tcp")
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(DynamoDBRegion),
+		Endpoint:    aws.String(container.Endpoint()),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		container.Stop()
+		return nil, err
+	}
+	err = container.waitFor(func() error {
+		_, err := dynamodb.New(sess).ListTables(&dynamodb.ListTablesInput{Limit: aws.Int64(1)})
+		return err
+	})
+	return container, err
+}
+
+// Endpoint returns the URL of the database, as the DynamoDB endpoint.
+func (c *Container) Endpoint() string {
+	if strings.Contains(c.Address, "://") {
+		return c.Address
+	}
+	return "http://" + c.Address
+}
+
+// DBInfo returns the backend configuration for the database.
+func (c *Container) DBInfo() *config.DBInfo {
+	if c.BackendType == "dynamodb" {
+		return &config.DBInfo{
+			DatabaseName:       DynamoDBDatabase,
+			AWSEndpoint:        c.Endpoint(),
+			AWSRegion:          DynamoDBRegion,
+			AWSSecretKeyID:     "test",
+			AWSSecretAccessKey: "test",
+		}
+	}
+	return &config.DBInfo{
+		DatabaseName: MongoDBDatabase,
+		Host:         c.Address,
+	}
+}
+
+// Stop removes the container. The existing servers are not stopped.
+func (c *Container) Stop() error {
+	if c.ID == "" {
+		return nil
+	}
+	_, err := docker("rm", "--force", "--volumes", c.ID)
+	return err
+}
+
+// NewBackendManager returns a backend manager with the backends of the databases.
+func NewBackendManager(containers ...*Container) backends.BackendManager {
+	dbConfig := map[string]*config.DBInfo{}
+	for _, container := range containers {
+		dbConfig[container.BackendType] = container.DBInfo()
+	}
+	return backends.NewBackendSupport(dbConfig)
+}
+
+// Truncate deletes all records of the repositories, to start the next test with empty collections and tables.
+func Truncate(repositories ...backends.Repository) error {
+	for _, repo := range repositories {
+		if err := repo.DeleteAll(backends.Filter{}); err != nil && !backends.IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DockerAvailable returns true if the Docker CLI can reach the Docker daemon. The tests that need
+// the containers can be skipped if it is not available.
+func DockerAvailable() bool {
+	_, err := docker("version", "--format", "{{.Server.Version}}")
+	return err == nil
+}
+
+// start starts a container from the image with the port published on a random host port,
+// unless the address of an existing server is set in the environment variable.
+func start(backendType, env, image, port string) (*Container, error) {
+	if address := os.Getenv(env); address != "" {
+		return &Container{BackendType: backendType, Address: address}, nil
+	}
+
+	id, err := docker("run", "--detach", "--publish", port, image)
+	if err != nil {
+		return nil, err
+	}
+	container := &Container{ID: id, BackendType: backendType}
+
+	published, err := docker("port", id, port)
+	if err != nil {
+		container.Stop()
+		return nil, err
+	}
+	if container.Address, err = hostAddress(published); err != nil {
+		container.Stop()
+		return nil, err
+	}
+	return container, nil
+}
+
+// hostAddress returns the localhost address of the first published port in the output of "docker port",
+// for example "0.0.0.0:49153".
+func hostAddress(published string) (string, error) {
+	for _, line := range strings.Split(strings.TrimSpace(published), "\n") {
+		_, port, err := net.SplitHostPort(strings.TrimSpace(line))
+		if err == nil && port != "" {
+			return net.JoinHostPort("localhost", port), nil
+		}
+	}
+	return "", fmt.Errorf("no published port in %q", published)
+}
+
+// waitFor calls the check until it succeeds or the StartTimeout expires. The container is stopped
+// if the database does not become ready.
+func (c *Container) waitFor(check func() error) error {
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			c.Stop()
+			return fmt.Errorf("%s at %s is not ready after %s: %s", c.BackendType, c.Address, StartTimeout, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// docker runs the Docker CLI and returns its trimmed output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,61 @@
+package backendstest
+
+import (
+	"testing"
+
+	"github.com/Microkubes/backends"
+)
+
+func TestHostAddress(t *testing.T) {
+	address, err := hostAddress("0.0.0.0:49153\n[::]:49153\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != "localhost:49153" {
+		t.Fatal("Expected localhost:49153. Got: ", address)
+	}
+	if _, err := hostAddress(""); err == nil {
+		t.Fatal("Expected an error without a published port")
+	}
+}
+
+func TestDBInfo(t *testing.T) {
+	dynamo := &Container{BackendType: "dynamodb", Address: "localhost:8000"}
+	if info := dynamo.DBInfo(); info.AWSEndpoint != "http://localhost:8000" || info.AWSRegion == "" {
+		t.Fatal("Unexpected DynamoDB config: ", info)
+	}
+	mongo := &Container{BackendType: "mongodb", Address: "localhost:27017"}
+	if info := mongo.DBInfo(); info.Host != "localhost:27017" || info.DatabaseName != MongoDBDatabase {
+		t.Fatal("Unexpected MongoDB config: ", info)
+	}
+}
+
+func TestMongoDBContainer(t *testing.T) {
+	if testing.Short() || !DockerAvailable() {
+		t.Skip("Skipping integration test in short mode or without Docker.")
+	}
+
+	container, err := StartMongoDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Stop()
+
+	backend, err := NewBackendManager(container).GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("items", backends.RepositoryDefinitionMap{"name": "items"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "item"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Truncate(repo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetOne(backends.Filter{"name": "item"}, &map[string]interface{}{}); !backends.IsErrNotFound(err) {
+		t.Fatal("Expected the collection to be empty. Got: ", err)
+	}
+}
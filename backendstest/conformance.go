@@ -0,0 +1,242 @@
+package backendstest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Microkubes/backends"
+)
+
+// RepositoryBuilder builds a repository for the definition on the backend under test. The definitions of
+// the conformance suite have unique names ("conformance_<test>") and "id" as the hash key. The builder
+// should fail the test if the repository can not be built.
+type RepositoryBuilder func(t *testing.T, def backends.RepositoryDefinitionMap) backends.Repository
+
+// RunRepositoryConformanceTests checks that the repositories built by the builder follow the contract of
+// backends.Repository: the CRUD operations, the filters, the unique indexes, the TTL definitions, the
+// pagination with limit and offset, and the error classes. A backend implementation runs the suite in its
+// tests:
+//
+//	func TestConformance(t *testing.T) {
+//		backendstest.RunRepositoryConformanceTests(t, func(t *testing.T, def backends.RepositoryDefinitionMap) backends.Repository {
+//			repo, err := backend.DefineRepository(def.GetName(), def)
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return repo
+//		})
+//	}
+//
+// The repositories are truncated before every test, so the suite can run against persistent databases.
+func RunRepositoryConformanceTests(t *testing.T, builder RepositoryBuilder) {
+	t.Run("CRUD", func(t *testing.T) {
+		testCRUD(t, buildRepository(t, builder, "crud", nil))
+	})
+	t.Run("Filters", func(t *testing.T) {
+		testFilters(t, buildRepository(t, builder, "filters", nil))
+	})
+	t.Run("UniqueConstraints", func(t *testing.T) {
+		testUniqueConstraints(t, buildRepository(t, builder, "unique", backends.RepositoryDefinitionMap{
+			"indexes": []backends.Index{backends.NewUniqueIndex("email")},
+		}))
+	})
+	t.Run("TTL", func(t *testing.T) {
+		testTTL(t, buildRepository(t, builder, "ttl", backends.RepositoryDefinitionMap{
+			"enableTtl":    true,
+			"ttlAttribute": "expiresAt",
+			"ttl":          3600,
+		}))
+	})
+	t.Run("Pagination", func(t *testing.T) {
+		testPagination(t, buildRepository(t, builder, "pagination", nil))
+	})
+	t.Run("Errors", func(t *testing.T) {
+		testErrors(t, buildRepository(t, builder, "errors", nil))
+	})
+}
+
+// buildRepository builds the repository of the test with the extra properties, and truncates it.
+func buildRepository(t *testing.T, builder RepositoryBuilder, name string, properties backends.RepositoryDefinitionMap) backends.Repository {
+	def := backends.RepositoryDefinitionMap{
+		"name":    "conformance_" + name,
+		"hashKey": "id",
+	}
+	for key, value := range properties {
+		def[key] = value
+	}
+	repo := builder(t, def)
+	if err := Truncate(repo); err != nil {
+		t.Fatal("Truncate: ", err)
+	}
+	return repo
+}
+
+func testCRUD(t *testing.T, repo backends.Repository) {
+	id := mustCreate(t, repo, map[string]interface{}{"name": "ann", "age": 30})
+
+	found := mustGetOne(t, repo, backends.Filter{"id": id})
+	if found["name"] != "ann" || fmt.Sprint(found["age"]) != "30" {
+		t.Fatal("GetOne: expected the saved record. Got: ", found)
+	}
+
+	updated, err := repo.Save(&map[string]interface{}{"age": 31}, backends.Filter{"id": id})
+	if err != nil {
+		t.Fatal("Save (update): ", err)
+	}
+	if record := toRecord(t, updated); fmt.Sprint(record["age"]) != "31" || record["name"] != "ann" {
+		t.Fatal("Save (update): expected the updated record with the other properties unchanged. Got: ", record)
+	}
+	if found = mustGetOne(t, repo, backends.Filter{"id": id}); fmt.Sprint(found["age"]) != "31" {
+		t.Fatal("GetOne: expected the updated record. Got: ", found)
+	}
+
+	if err := repo.DeleteOne(backends.Filter{"id": id}); err != nil {
+		t.Fatal("DeleteOne: ", err)
+	}
+	if _, err := repo.GetOne(backends.Filter{"id": id}, &map[string]interface{}{}); !backends.IsErrNotFound(err) {
+		t.Fatal("GetOne: expected ErrNotFound for a deleted record. Got: ", err)
+	}
+}
+
+func testFilters(t *testing.T, repo backends.Repository) {
+	mustCreate(t, repo, map[string]interface{}{"name": "ann", "team": "a"})
+	mustCreate(t, repo, map[string]interface{}{"name": "bob", "team": "a"})
+	mustCreate(t, repo, map[string]interface{}{"name": "cid", "team": "b"})
+
+	tests := []struct {
+		filter   backends.Filter
+		expected int
+	}{
+		{backends.Filter{"team": "a"}, 2},
+		{backends.Filter{"team": "a", "name": "bob"}, 1},
+		{backends.NewFilter().MatchPrefix("name", "b"), 1},
+		{backends.Filter{"team": "c"}, 0},
+		{nil, 3},
+	}
+	for _, test := range tests {
+		if records := mustGetAll(t, repo, test.filter, 0, 0); len(records) != test.expected {
+			t.Fatalf("GetAll(%v): expected %d records. Got: %v", test.filter, test.expected, records)
+		}
+	}
+
+	if err := repo.DeleteAll(backends.Filter{"team": "a"}); err != nil {
+		t.Fatal("DeleteAll: ", err)
+	}
+	if records := mustGetAll(t, repo, nil, 0, 0); len(records) != 1 || records[0]["name"] != "cid" {
+		t.Fatal("DeleteAll: expected only the matched records to be deleted. Got: ", records)
+	}
+}
+
+func testUniqueConstraints(t *testing.T, repo backends.Repository) {
+	id := mustCreate(t, repo, map[string]interface{}{"email": "ann@example.com"})
+	if _, err := repo.Save(&map[string]interface{}{"email": "ann@example.com"}, nil); !backends.IsErrAlreadyExists(err) {
+		t.Fatal("Save: expected ErrAlreadyExists for a duplicate value. Got: ", err)
+	}
+
+	other := mustCreate(t, repo, map[string]interface{}{"email": "bob@example.com"})
+	if _, err := repo.Save(&map[string]interface{}{"email": "ann@example.com"}, backends.Filter{"id": other}); !backends.IsErrAlreadyExists(err) {
+		t.Fatal("Save (update): expected ErrAlreadyExists for a duplicate value. Got: ", err)
+	}
+
+	// the value is free again once the record is deleted
+	if err := repo.DeleteOne(backends.Filter{"id": id}); err != nil {
+		t.Fatal("DeleteOne: ", err)
+	}
+	mustCreate(t, repo, map[string]interface{}{"email": "ann@example.com"})
+}
+
+func testTTL(t *testing.T, repo backends.Repository) {
+	id := mustCreate(t, repo, map[string]interface{}{"name": "session"})
+	if found := mustGetOne(t, repo, backends.Filter{"id": id}); found["name"] != "session" {
+		t.Fatal("GetOne: expected the record before it expires. Got: ", found)
+	}
+}
+
+func testPagination(t *testing.T, repo backends.Repository) {
+	for i := 0; i < 5; i++ {
+		mustCreate(t, repo, map[string]interface{}{"name": fmt.Sprintf("record-%d", i)})
+	}
+
+	seen := map[interface{}]bool{}
+	for offset, expected := range map[int]int{0: 2, 2: 2, 4: 1, 6: 0} {
+		page := mustGetAll(t, repo, nil, 2, offset)
+		if len(page) != expected {
+			t.Fatalf("GetAll(limit 2, offset %d): expected %d records. Got: %v", offset, expected, page)
+		}
+		for _, record := range page {
+			if seen[record["name"]] {
+				t.Fatal("GetAll: the pages overlap on ", record["name"])
+			}
+			seen[record["name"]] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatal("GetAll: expected the pages to cover all records. Got: ", seen)
+	}
+}
+
+func testErrors(t *testing.T, repo backends.Repository) {
+	id := mustCreate(t, repo, map[string]interface{}{"name": "ann"})
+	if err := repo.DeleteOne(backends.Filter{"id": id}); err != nil {
+		t.Fatal("DeleteOne: ", err)
+	}
+
+	if _, err := repo.GetOne(backends.Filter{"name": "nobody"}, &map[string]interface{}{}); !backends.IsErrNotFound(err) {
+		t.Fatal("GetOne: expected ErrNotFound. Got: ", err)
+	}
+	if err := repo.DeleteOne(backends.Filter{"id": id}); !backends.IsErrNotFound(err) {
+		t.Fatal("DeleteOne: expected ErrNotFound for a missing record. Got: ", err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "bob"}, backends.Filter{"id": id}); !backends.IsErrNotFound(err) {
+		t.Fatal("Save (update): expected ErrNotFound for a missing record. Got: ", err)
+	}
+	if _, err := repo.Save(map[string]interface{}{"name": "bob"}, nil); !backends.IsErrInvalidInput(err) {
+		t.Fatal("Save: expected ErrInvalidInput for an object that is not a pointer. Got: ", err)
+	}
+}
+
+// mustCreate saves a new record and returns its id.
+func mustCreate(t *testing.T, repo backends.Repository, record map[string]interface{}) interface{} {
+	saved, err := repo.Save(&record, nil)
+	if err != nil {
+		t.Fatal("Save: ", err)
+	}
+	id, ok := toRecord(t, saved)["id"]
+	if !ok || id == "" {
+		t.Fatal("Save: expected the saved record to have an id. Got: ", saved)
+	}
+	return id
+}
+
+func mustGetOne(t *testing.T, repo backends.Repository, filter backends.Filter) map[string]interface{} {
+	found, err := repo.GetOne(filter, &map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("GetOne(%v): %s", filter, err)
+	}
+	return toRecord(t, found)
+}
+
+// mustGetAll returns the matched records. ErrNotFound is accepted for no records.
+func mustGetAll(t *testing.T, repo backends.Repository, filter backends.Filter, limit, offset int) []map[string]interface{} {
+	results, err := repo.GetAll(filter, map[string]interface{}{}, "", "", limit, offset)
+	if err != nil && !backends.IsErrNotFound(err) {
+		t.Fatalf("GetAll(%v): %s", filter, err)
+	}
+	records := []map[string]interface{}{}
+	err = backends.IterateOverSlice(results, func(i int, item interface{}) error {
+		records = append(records, toRecord(t, item))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("GetAll: expected a slice of records. Got: ", err)
+	}
+	return records
+}
+
+func toRecord(t *testing.T, value interface{}) map[string]interface{} {
+	record := map[string]interface{}{}
+	if err := backends.MapToInterface(value, &record); err != nil {
+		t.Fatal("expected a record. Got: ", err)
+	}
+	return record
+}
@@ -0,0 +1,173 @@
+package backendstest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Microkubes/backends"
+)
+
+// memoryRepository is a minimal in-memory repository following the contract checked by the suite.
+type memoryRepository struct {
+	sync.Mutex
+	records []map[string]interface{}
+	unique  []string
+	nextID  int
+}
+
+func newMemoryRepository(def backends.RepositoryDefinitionMap) *memoryRepository {
+	repo := &memoryRepository{}
+	if indexes, ok := def["indexes"].([]backends.Index); ok {
+		for _, index := range indexes {
+			if index.Unique() {
+				repo.unique = append(repo.unique, index.GetFields()...)
+			}
+		}
+	}
+	return repo
+}
+
+func (m *memoryRepository) matches(record map[string]interface{}, filter backends.Filter) bool {
+	for key, value := range filter {
+		if specs, ok := value.(map[string]string); ok {
+			if s, ok := record[key].(string); !ok || !strings.HasPrefix(s, specs["$prefix"]) {
+				return false
+			}
+			continue
+		}
+		if fmt.Sprint(record[key]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *memoryRepository) find(filter backends.Filter) int {
+	for i, record := range m.records {
+		if m.matches(record, filter) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memoryRepository) GetOne(filter backends.Filter, result interface{}) (interface{}, error) {
+	m.Lock()
+	defer m.Unlock()
+	i := m.find(filter)
+	if i < 0 {
+		return nil, backends.ErrNotFound("not found")
+	}
+	return result, backends.MapToInterface(m.records[i], result)
+}
+
+func (m *memoryRepository) GetAll(filter backends.Filter, resultsTypeHint interface{}, order, sorting string, limit, offset int) (interface{}, error) {
+	m.Lock()
+	defer m.Unlock()
+	results := []map[string]interface{}{}
+	for _, record := range m.records {
+		if m.matches(record, filter) {
+			results = append(results, record)
+		}
+	}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *memoryRepository) Save(object interface{}, filter backends.Filter) (interface{}, error) {
+	m.Lock()
+	defer m.Unlock()
+	payload, err := backends.InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]interface{}{}
+	i := -1
+	if filter != nil {
+		if i = m.find(filter); i < 0 {
+			return nil, backends.ErrNotFound("not found")
+		}
+		for key, value := range m.records[i] {
+			record[key] = value
+		}
+	} else {
+		m.nextID++
+		record["id"] = fmt.Sprint(m.nextID)
+	}
+	for key, value := range *payload {
+		record[key] = value
+	}
+	for _, field := range m.unique {
+		if j := m.find(backends.Filter{field: record[field]}); j >= 0 && j != i {
+			return nil, backends.ErrAlreadyExists("duplicate " + field)
+		}
+	}
+	if i < 0 {
+		m.records = append(m.records, record)
+	} else {
+		m.records[i] = record
+	}
+	return &record, nil
+}
+
+func (m *memoryRepository) DeleteOne(filter backends.Filter) error {
+	m.Lock()
+	defer m.Unlock()
+	i := m.find(filter)
+	if i < 0 {
+		return backends.ErrNotFound("not found")
+	}
+	m.records = append(m.records[:i], m.records[i+1:]...)
+	return nil
+}
+
+func (m *memoryRepository) DeleteAll(filter backends.Filter) error {
+	m.Lock()
+	defer m.Unlock()
+	kept := []map[string]interface{}{}
+	for _, record := range m.records {
+		if !m.matches(record, filter) {
+			kept = append(kept, record)
+		}
+	}
+	m.records = kept
+	return nil
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	RunRepositoryConformanceTests(t, func(t *testing.T, def backends.RepositoryDefinitionMap) backends.Repository {
+		return newMemoryRepository(def)
+	})
+}
+
+func TestMongoDBConformance(t *testing.T) {
+	if testing.Short() || !DockerAvailable() {
+		t.Skip("Skipping integration test in short mode or without Docker.")
+	}
+
+	container, err := StartMongoDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Stop()
+
+	backend, err := NewBackendManager(container).GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RunRepositoryConformanceTests(t, func(t *testing.T, def backends.RepositoryDefinitionMap) backends.Repository {
+		repo, err := backend.DefineRepository(def.GetName(), def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
@@ -0,0 +1,451 @@
+package backendstest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/Microkubes/backends"
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// Call is a recorded call of a mock method.
+type Call struct {
+	// Method is the name of the called method.
+	Method string
+	// Args are the arguments of the call.
+	Args []interface{}
+}
+
+// Recorder records the calls of a mock. It is safe for concurrent use.
+type Recorder struct {
+	mutex sync.Mutex
+	calls []Call
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls of the method, or all calls if the method is empty.
+func (r *Recorder) Calls(method string) []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	calls := []Call{}
+	for _, call := range r.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallCount returns the number of the recorded calls of the method.
+func (r *Recorder) CallCount(method string) int {
+	return len(r.Calls(method))
+}
+
+// Reset forgets the recorded calls.
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = nil
+}
+
+// MockRepository is a backends.Repository that records the calls and returns the results of the
+// programmed functions. Without a function, GetOne returns ErrNotFound, GetAll returns an empty slice,
+// Save returns the saved object and the deletes succeed. For example:
+//
+//	repo := &backendstest.MockRepository{}
+//	repo.ReturnOne(&User{ID: "1", Name: "ann"}, nil)
+//	// ... call the code using repo
+//	if repo.CallCount("Save") != 1 {
+//		t.Fatal("Expected the user to be saved")
+//	}
+type MockRepository struct {
+	Recorder
+
+	GetOneFunc    func(filter backends.Filter, result interface{}) (interface{}, error)
+	GetAllFunc    func(filter backends.Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error)
+	SaveFunc      func(object interface{}, filter backends.Filter) (interface{}, error)
+	DeleteOneFunc func(filter backends.Filter) error
+	DeleteAllFunc func(filter backends.Filter) error
+}
+
+// GetOne records the call and returns the result of GetOneFunc.
+func (m *MockRepository) GetOne(filter backends.Filter, result interface{}) (interface{}, error) {
+	m.record("GetOne", filter, result)
+	if m.GetOneFunc != nil {
+		return m.GetOneFunc(filter, result)
+	}
+	return nil, backends.ErrNotFound("not found")
+}
+
+// GetAll records the call and returns the result of GetAllFunc.
+func (m *MockRepository) GetAll(filter backends.Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	m.record("GetAll", filter, resultsTypeHint, order, sorting, limit, offset)
+	if m.GetAllFunc != nil {
+		return m.GetAllFunc(filter, resultsTypeHint, order, sorting, limit, offset)
+	}
+	results := backends.NewSliceOfType(backends.AsPtr(resultsTypeHint))
+	slicePointer := reflect.New(results.Type())
+	slicePointer.Elem().Set(results)
+	return slicePointer.Interface(), nil
+}
+
+// Save records the call and returns the result of SaveFunc.
+func (m *MockRepository) Save(object interface{}, filter backends.Filter) (interface{}, error) {
+	m.record("Save", object, filter)
+	if m.SaveFunc != nil {
+		return m.SaveFunc(object, filter)
+	}
+	return object, nil
+}
+
+// DeleteOne records the call and returns the result of DeleteOneFunc.
+func (m *MockRepository) DeleteOne(filter backends.Filter) error {
+	m.record("DeleteOne", filter)
+	if m.DeleteOneFunc != nil {
+		return m.DeleteOneFunc(filter)
+	}
+	return nil
+}
+
+// DeleteAll records the call and returns the result of DeleteAllFunc.
+func (m *MockRepository) DeleteAll(filter backends.Filter) error {
+	m.record("DeleteAll", filter)
+	if m.DeleteAllFunc != nil {
+		return m.DeleteAllFunc(filter)
+	}
+	return nil
+}
+
+// ReturnOne programs GetOne to decode the record into the result, or to return the error.
+func (m *MockRepository) ReturnOne(record interface{}, err error) {
+	m.GetOneFunc = func(filter backends.Filter, result interface{}) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		if err := backends.MapToInterface(record, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// ReturnAll programs GetAll to return the records (a slice), or the error.
+func (m *MockRepository) ReturnAll(records interface{}, err error) {
+	m.GetAllFunc = func(backends.Filter, interface{}, string, string, int, int) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+}
+
+// MockBackend is a backends.Backend that records the calls. The defined repositories are MockRepositories,
+// unless DefineRepositoryFunc is set.
+type MockBackend struct {
+	Recorder
+
+	// Config is returned by GetConfig.
+	Config *config.DBInfo
+	// Caps is returned by Capabilities. An empty Capabilities is returned if not set.
+	Caps *backends.Capabilities
+	// DefineRepositoryFunc, if set, builds the defined repositories.
+	DefineRepositoryFunc func(name string, def backends.RepositoryDefinition) (backends.Repository, error)
+	// CloseFunc, if set, returns the result of Close.
+	CloseFunc func(ctx context.Context) error
+
+	mutex        sync.Mutex
+	repositories map[string]backends.Repository
+	values       map[string]interface{}
+}
+
+// DefineRepository records the call and returns the repository with the name, defining it on the first call.
+func (m *MockBackend) DefineRepository(name string, def backends.RepositoryDefinition) (backends.Repository, error) {
+	m.record("DefineRepository", name, def)
+	return m.define(name, def)
+}
+
+func (m *MockBackend) define(name string, def backends.RepositoryDefinition) (backends.Repository, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if repository, ok := m.repositories[name]; ok {
+		return repository, nil
+	}
+	var repository backends.Repository = &MockRepository{}
+	if m.DefineRepositoryFunc != nil {
+		var err error
+		if repository, err = m.DefineRepositoryFunc(name, def); err != nil {
+			return nil, err
+		}
+	}
+	if m.repositories == nil {
+		m.repositories = map[string]backends.Repository{}
+	}
+	m.repositories[name] = repository
+	return repository, nil
+}
+
+// GetOrCreateRepository records the call and returns the repository with the name, defining it on the first call.
+func (m *MockBackend) GetOrCreateRepository(name string, def backends.RepositoryDefinition) (backends.Repository, error) {
+	m.record("GetOrCreateRepository", name, def)
+	return m.define(name, def)
+}
+
+// SetRepository sets the repository returned for the name.
+func (m *MockBackend) SetRepository(name string, repository backends.Repository) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.repositories == nil {
+		m.repositories = map[string]backends.Repository{}
+	}
+	m.repositories[name] = repository
+}
+
+// GetRepository records the call and returns the defined repository.
+func (m *MockBackend) GetRepository(name string) (backends.Repository, error) {
+	m.record("GetRepository", name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if repository, ok := m.repositories[name]; ok {
+		return repository, nil
+	}
+	return nil, fmt.Errorf("unknown repo")
+}
+
+// GetConfig records the call and returns the Config.
+func (m *MockBackend) GetConfig() *config.DBInfo {
+	m.record("GetConfig")
+	return m.Config
+}
+
+// GetFromContext records the call and returns the value set with SetInContext.
+func (m *MockBackend) GetFromContext(key string) interface{} {
+	m.record("GetFromContext", key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.values[key]
+}
+
+// SetInContext records the call and sets the value.
+func (m *MockBackend) SetInContext(key string, value interface{}) {
+	m.record("SetInContext", key, value)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.values == nil {
+		m.values = map[string]interface{}{}
+	}
+	m.values[key] = value
+}
+
+// Capabilities records the call and returns the Caps.
+func (m *MockBackend) Capabilities() *backends.Capabilities {
+	m.record("Capabilities")
+	if m.Caps == nil {
+		return &backends.Capabilities{}
+	}
+	return m.Caps
+}
+
+// Locks records the call and returns a lock manager keeping the locks in the repositories of the backend.
+func (m *MockBackend) Locks() *backends.LockManager {
+	m.record("Locks")
+	return backends.NewLockManager(m)
+}
+
+// Session records the call and returns a session on the mock backend.
+func (m *MockBackend) Session(ctx context.Context) (*backends.Session, error) {
+	m.record("Session", ctx)
+	return backends.NewBackendSession(m, ctx), nil
+}
+
+// Close records the call and returns the result of CloseFunc.
+func (m *MockBackend) Close(ctx context.Context) error {
+	m.record("Close", ctx)
+	if m.CloseFunc != nil {
+		return m.CloseFunc(ctx)
+	}
+	return nil
+}
+
+// Shutdown records the call.
+func (m *MockBackend) Shutdown() {
+	m.record("Shutdown")
+}
+
+// MockBackendManager is a backends.BackendManager that records the calls. GetBackend returns a MockBackend
+// per backend type, unless GetBackendFunc is set.
+type MockBackendManager struct {
+	Recorder
+
+	// GetBackendFunc, if set, returns the backends.
+	GetBackendFunc func(backendType string) (backends.Backend, error)
+	// MigrateFunc, if set, returns the result of Migrate.
+	MigrateFunc func(ctx context.Context) error
+	// ReloadFunc, if set, returns the result of Reload.
+	ReloadFunc func(ctx context.Context, dbConfig map[string]*config.DBInfo) error
+	// BackupFunc, if set, returns the result of Backup.
+	BackupFunc func(ctx context.Context, target backends.BackupTarget) (*backends.BackupManifest, error)
+	// RestoreFunc, if set, returns the result of Restore.
+	RestoreFunc func(ctx context.Context, source backends.BackupSource, onConflict backends.BootstrapConflictPolicy) (*backends.BackupManifest, error)
+	// SetMaintenanceFunc, if set, returns the result of SetMaintenance.
+	SetMaintenanceFunc func(backendType string, mode backends.MaintenanceMode) error
+
+	mutex      sync.Mutex
+	backends   map[string]backends.Backend
+	properties map[string]map[string]interface{}
+	options    map[string]backends.BackendOptions
+}
+
+// GetBackend records the call and returns the backend of the type.
+func (m *MockBackendManager) GetBackend(backendType string) (backends.Backend, error) {
+	m.record("GetBackend", backendType)
+	if m.GetBackendFunc != nil {
+		return m.GetBackendFunc(backendType)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if backend, ok := m.backends[backendType]; ok {
+		return backend, nil
+	}
+	if m.backends == nil {
+		m.backends = map[string]backends.Backend{}
+	}
+	backend := &MockBackend{Config: &config.DBInfo{}}
+	m.backends[backendType] = backend
+	return backend, nil
+}
+
+// SetBackend sets the backend returned for the type.
+func (m *MockBackendManager) SetBackend(backendType string, backend backends.Backend) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.backends == nil {
+		m.backends = map[string]backends.Backend{}
+	}
+	m.backends[backendType] = backend
+}
+
+// SupportBackend records the call and registers the properties of the backend type.
+func (m *MockBackendManager) SupportBackend(backendType string, builder backends.BackendBuilder, properties map[string]interface{}) {
+	m.record("SupportBackend", backendType, builder, properties)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.properties == nil {
+		m.properties = map[string]map[string]interface{}{}
+	}
+	m.properties[backendType] = properties
+}
+
+// GetSupportedBackends records the call and returns the types registered with SupportBackend.
+func (m *MockBackendManager) GetSupportedBackends() []string {
+	m.record("GetSupportedBackends")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	supported := []string{}
+	for backendType := range m.properties {
+		supported = append(supported, backendType)
+	}
+	return supported
+}
+
+// GetRequiredBackendProperties records the call and returns the properties registered with SupportBackend.
+func (m *MockBackendManager) GetRequiredBackendProperties(backendType string) (map[string]interface{}, error) {
+	m.record("GetRequiredBackendProperties", backendType)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if properties, ok := m.properties[backendType]; ok {
+		return properties, nil
+	}
+	return nil, fmt.Errorf("backend %s is not supported", backendType)
+}
+
+// SetBackendOptions records the call and sets the options.
+func (m *MockBackendManager) SetBackendOptions(backendType string, options backends.BackendOptions) {
+	m.record("SetBackendOptions", backendType, options)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.options == nil {
+		m.options = map[string]backends.BackendOptions{}
+	}
+	m.options[backendType] = options
+}
+
+// GetBackendOptions records the call and returns the options set with SetBackendOptions.
+func (m *MockBackendManager) GetBackendOptions(backendType string) backends.BackendOptions {
+	m.record("GetBackendOptions", backendType)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if options, ok := m.options[backendType]; ok {
+		return options
+	}
+	return backends.BackendOptions{}
+}
+
+// Shutdown records the call.
+func (m *MockBackendManager) Shutdown(ctx context.Context) error {
+	m.record("Shutdown", ctx)
+	return nil
+}
+
+// RegisterMigrations records the call.
+func (m *MockBackendManager) RegisterMigrations(backendType, repository string, migrations ...*backends.Migration) {
+	m.record("RegisterMigrations", backendType, repository, migrations)
+}
+
+// Migrate records the call and returns the result of MigrateFunc.
+func (m *MockBackendManager) Migrate(ctx context.Context) error {
+	m.record("Migrate", ctx)
+	if m.MigrateFunc != nil {
+		return m.MigrateFunc(ctx)
+	}
+	return nil
+}
+
+// Reload records the call and returns the result of ReloadFunc.
+func (m *MockBackendManager) Reload(ctx context.Context, dbConfig map[string]*config.DBInfo) error {
+	m.record("Reload", ctx, dbConfig)
+	if m.ReloadFunc != nil {
+		return m.ReloadFunc(ctx, dbConfig)
+	}
+	return nil
+}
+
+// Backup records the call and returns the result of BackupFunc, or an empty manifest.
+func (m *MockBackendManager) Backup(ctx context.Context, target backends.BackupTarget) (*backends.BackupManifest, error) {
+	m.record("Backup", ctx, target)
+	if m.BackupFunc != nil {
+		return m.BackupFunc(ctx, target)
+	}
+	return &backends.BackupManifest{Repositories: []*backends.BackupEntry{}}, nil
+}
+
+// Restore records the call and returns the result of RestoreFunc, or an empty manifest.
+func (m *MockBackendManager) Restore(ctx context.Context, source backends.BackupSource, onConflict backends.BootstrapConflictPolicy) (*backends.BackupManifest, error) {
+	m.record("Restore", ctx, source, onConflict)
+	if m.RestoreFunc != nil {
+		return m.RestoreFunc(ctx, source, onConflict)
+	}
+	return &backends.BackupManifest{Repositories: []*backends.BackupEntry{}}, nil
+}
+
+// SetMaintenance records the call and returns the result of SetMaintenanceFunc.
+func (m *MockBackendManager) SetMaintenance(backendType string, mode backends.MaintenanceMode) error {
+	m.record("SetMaintenance", backendType, mode)
+	if m.SetMaintenanceFunc != nil {
+		return m.SetMaintenanceFunc(backendType, mode)
+	}
+	return nil
+}
+
+var (
+	_ backends.Repository     = (*MockRepository)(nil)
+	_ backends.Backend        = (*MockBackend)(nil)
+	_ backends.BackendManager = (*MockBackendManager)(nil)
+)
@@ -0,0 +1,77 @@
+package backendstest
+
+import (
+	"testing"
+
+	"github.com/Microkubes/backends"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMockRepository(t *testing.T) {
+	repo := &MockRepository{}
+	if _, err := repo.GetOne(backends.Filter{"id": "1"}, &user{}); !backends.IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound by default. Got: ", err)
+	}
+
+	repo.ReturnOne(map[string]interface{}{"id": "1", "name": "ann"}, nil)
+	found, err := repo.GetOne(backends.Filter{"id": "1"}, &user{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.(*user).Name != "ann" {
+		t.Fatal("Expected the programmed record. Got: ", found)
+	}
+
+	results, err := repo.GetAll(nil, &user{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users, ok := results.(*[]*user); !ok || len(*users) != 0 {
+		t.Fatalf("Expected an empty slice of the hint type. Got: %T", results)
+	}
+
+	if _, err := repo.Save(&user{Name: "bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if repo.CallCount("GetOne") != 2 || repo.CallCount("Save") != 1 || len(repo.Calls("")) != 4 {
+		t.Fatal("Unexpected calls: ", repo.Calls(""))
+	}
+	if filter := repo.Calls("GetOne")[0].Args[0].(backends.Filter); filter["id"] != "1" {
+		t.Fatal("Expected the recorded filter. Got: ", filter)
+	}
+	repo.Reset()
+	if repo.CallCount("") != 0 {
+		t.Fatal("Expected the calls to be forgotten")
+	}
+}
+
+func TestMockBackendManager(t *testing.T) {
+	manager := &MockBackendManager{}
+	backend, err := manager.GetBackend("mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := backend.DefineRepository("users", backends.RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.(*MockRepository); !ok {
+		t.Fatalf("Expected a MockRepository. Got: %T", repo)
+	}
+	if same, _ := backend.GetRepository("users"); same != repo {
+		t.Fatal("Expected the defined repository")
+	}
+	if same, _ := backend.GetOrCreateRepository("users", nil); same != repo {
+		t.Fatal("Expected the defined repository")
+	}
+	if again, _ := manager.GetBackend("mongodb"); again != backend {
+		t.Fatal("Expected the same backend for the type")
+	}
+	if manager.CallCount("GetBackend") != 2 {
+		t.Fatal("Unexpected calls: ", manager.Calls(""))
+	}
+}
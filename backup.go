@@ -0,0 +1,401 @@
+package backends
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// BackupManifestFile is the name of the manifest of a backup. It is written after all repositories
+// are backed up, so a backup without the manifest is not complete.
+const BackupManifestFile = "manifest.json"
+
+// BackupTarget stores the files of a backup.
+type BackupTarget interface {
+	// Create returns the writer of the file. The file is complete once the writer is closed.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// BackupSource reads the files of a backup.
+type BackupSource interface {
+	// Open returns the reader of the file. Returns ErrNotFound if there is no such file.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// BackupManifest lists the repositories in a backup.
+type BackupManifest struct {
+	CreatedAt    time.Time      `json:"createdAt"`
+	Repositories []*BackupEntry `json:"repositories"`
+}
+
+// BackupEntry is a repository in a backup.
+type BackupEntry struct {
+	Backend    string `json:"backend"`
+	Repository string `json:"repository"`
+	// File is the name of the file with the records of the repository.
+	File string `json:"file"`
+	// Records is the number of backed up (or restored) records.
+	Records int `json:"records"`
+}
+
+// BackupStore is both a BackupTarget and a BackupSource.
+type BackupStore interface {
+	BackupTarget
+	BackupSource
+}
+
+// RestoringRepository is implemented by the repositories that can restore a record with its ID and all of
+// its properties. Other repositories restore the records with Save.
+type RestoringRepository interface {
+	// RestoreRecord creates the record, or replaces the record with the same id.
+	RestoreRecord(record map[string]interface{}) error
+}
+
+// DirectoryBackup stores the files of a backup in a local directory. It is both a BackupTarget and a BackupSource.
+type DirectoryBackup string
+
+// Create creates the file in the directory, and its parent directories.
+func (d DirectoryBackup) Create(name string) (io.WriteCloser, error) {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// Open opens the file in the directory.
+func (d DirectoryBackup) Open(name string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound(err)
+	}
+	return file, err
+}
+
+// FilesBackup returns the BackupTarget and BackupSource storing the files of a backup in the files of the
+// repository, under the prefix: S3 for DynamoDB (with the "filesBucket" option), GridFS for MongoDB.
+func FilesBackup(repo Repository, prefix string) BackupStore {
+	return &filesBackup{repo: repo, prefix: prefix}
+}
+
+type filesBackup struct {
+	repo   Repository
+	prefix string
+}
+
+func (f *filesBackup) Create(name string) (io.WriteCloser, error) {
+	return CreateFile(f.repo, f.prefix+name, "application/x-ndjson")
+}
+
+func (f *filesBackup) Open(name string) (io.ReadCloser, error) {
+	file, _, err := GetFile(f.repo, f.prefix+name)
+	return file, err
+}
+
+// Backup writes the records of all repositories defined on the backends to the target, one file of JSON
+// Lines per repository ("<backend>/<repository>.jsonl"), and the manifest. The values are written as
+// MongoDB extended JSON, so the dates, ObjectIDs and 64-bit integers are restored with their types. For
+// example, to back up to a directory:
+//
+//	manifest, err := manager.Backup(ctx, backends.DirectoryBackup("/var/backups/2021-06-01"))
+//
+// Only the backends already built (by GetBackend) are backed up.
+func (m *DefaultBackendManager) Backup(ctx context.Context, target BackupTarget) (*BackupManifest, error) {
+	manifest := &BackupManifest{
+		CreatedAt:    time.Now().UTC(),
+		Repositories: []*BackupEntry{},
+	}
+	for _, backendType := range m.builtBackends() {
+		backend, err := m.GetBackend(backendType)
+		if err != nil {
+			return nil, err
+		}
+		definer, ok := backend.(interface {
+			RepositoryDefinitions() map[string]RepositoryDefinition
+		})
+		if !ok {
+			continue
+		}
+		names := map[string]interface{}{}
+		for name := range definer.RepositoryDefinitions() {
+			names[name] = nil
+		}
+		for _, name := range sortedKeys(names) {
+			repo, err := backend.GetRepository(name)
+			if err != nil {
+				return nil, err
+			}
+			entry := &BackupEntry{
+				Backend:    backendType,
+				Repository: name,
+				File:       backendType + "/" + name + ".jsonl",
+			}
+			if entry.Records, err = backupRepository(ctx, repo, target, entry.File); err != nil {
+				return nil, err
+			}
+			manifest.Repositories = append(manifest.Repositories, entry)
+		}
+	}
+
+	writer, err := target.Create(BackupManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(writer).Encode(manifest); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	return manifest, writer.Close()
+}
+
+// Restore saves the records of the backup to the repositories, which must be defined on the backends.
+// The records that already exist (by id) are handled by the conflict policy: BootstrapSkip (the default)
+// keeps the existing record, BootstrapOverwrite replaces it, and BootstrapFail stops the restore with
+// ErrAlreadyExists. Returns the manifest with the number of restored records of the repositories.
+func (m *DefaultBackendManager) Restore(ctx context.Context, source BackupSource, onConflict BootstrapConflictPolicy) (*BackupManifest, error) {
+	if onConflict == "" {
+		onConflict = BootstrapSkip
+	}
+	if onConflict != BootstrapSkip && onConflict != BootstrapOverwrite && onConflict != BootstrapFail {
+		return nil, ErrInvalidInput(fmt.Sprintf("unknown conflict policy %s", onConflict))
+	}
+
+	reader, err := source.Open(BackupManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	err = json.NewDecoder(reader).Decode(manifest)
+	reader.Close()
+	if err != nil {
+		return nil, ErrInvalidInput(fmt.Sprintf("invalid backup manifest: %s", err))
+	}
+
+	restored := &BackupManifest{CreatedAt: manifest.CreatedAt, Repositories: []*BackupEntry{}}
+	for _, entry := range manifest.Repositories {
+		backend, err := m.GetBackend(entry.Backend)
+		if err != nil {
+			return restored, err
+		}
+		repo, err := backend.GetRepository(entry.Repository)
+		if err != nil {
+			return restored, err
+		}
+		count, err := restoreRepository(ctx, repo, source, entry.File, onConflict)
+		restored.Repositories = append(restored.Repositories, &BackupEntry{
+			Backend:    entry.Backend,
+			Repository: entry.Repository,
+			File:       entry.File,
+			Records:    count,
+		})
+		if err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
+
+// builtBackends returns the types of the built backends, in the order they were built.
+func (m *DefaultBackendManager) builtBackends() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string{}, m.backendsOrder...)
+}
+
+// backupRepository writes the records of the repository to the file of the target, in batches.
+func backupRepository(ctx context.Context, repo Repository, target BackupTarget, file string) (int, error) {
+	writer, err := target.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	buffered := bufio.NewWriter(writer)
+
+	written := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			writer.Close()
+			return written, err
+		}
+		records, err := readRecords(repo, nil, defaultTransferBatchSize, written)
+		if err != nil {
+			writer.Close()
+			return written, err
+		}
+		for _, record := range records {
+			line, err := bson.MarshalJSON(record)
+			if err != nil {
+				writer.Close()
+				return written, err
+			}
+			buffered.Write(bytes.TrimSpace(line))
+			buffered.WriteByte('\n')
+			written++
+		}
+		if len(records) < defaultTransferBatchSize {
+			break
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		writer.Close()
+		return written, err
+	}
+	return written, writer.Close()
+}
+
+// restoreRepository saves the records in the file of the source to the repository.
+func restoreRepository(ctx context.Context, repo Repository, source BackupSource, file string, onConflict BootstrapConflictPolicy) (int, error) {
+	reader, err := source.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	lines := bufio.NewReader(reader)
+	restored := 0
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return restored, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return restored, ctxErr
+			}
+			record := map[string]interface{}{}
+			if err := bson.UnmarshalJSON(line, &record); err != nil {
+				return restored, ErrInvalidInput(fmt.Sprintf("%s, record %d: %s", file, restored+1, err))
+			}
+			if err := restoreRecord(repo, record, onConflict); err != nil {
+				return restored, err
+			}
+			restored++
+		}
+		if err == io.EOF {
+			return restored, nil
+		}
+	}
+}
+
+// restoreRecord saves the record by its id, according to the conflict policy.
+func restoreRecord(repo Repository, record map[string]interface{}, onConflict BootstrapConflictPolicy) error {
+	exists, err := recordExists(repo, record)
+	if err != nil {
+		return err
+	}
+	if exists {
+		switch onConflict {
+		case BootstrapSkip:
+			return nil
+		case BootstrapFail:
+			return ErrAlreadyExists(fmt.Sprintf("the record %v already exists", record["id"]))
+		}
+	}
+	return saveRestored(repo, record, exists)
+}
+
+// recordExists checks if the repository has a record with the id of the record.
+func recordExists(repo Repository, record map[string]interface{}) (bool, error) {
+	id, ok := record["id"]
+	if !ok {
+		return false, ErrInvalidInput("can not restore a record without id")
+	}
+	_, err := repo.GetOne(Filter{"id": id}, &map[string]interface{}{})
+	if err != nil && !IsErrNotFound(err) {
+		return false, err
+	}
+	return err == nil, nil
+}
+
+// saveRestored restores the record with RestoreRecord, or with Save if the repository can not restore records.
+func saveRestored(repo Repository, record map[string]interface{}, exists bool) error {
+	if r, ok := repo.(RestoringRepository); ok {
+		return r.RestoreRecord(record)
+	}
+	var err error
+	if exists {
+		_, err = repo.Save(&record, Filter{"id": record["id"]})
+	} else {
+		_, err = repo.Save(&record, nil)
+	}
+	return err
+}
+
+// RestoreRecord restores the record on the repository of the active backend.
+func (r *failoverRepository) RestoreRecord(record map[string]interface{}) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	if restoring, ok := repository.(RestoringRepository); ok {
+		return restoring.RestoreRecord(record)
+	}
+	exists, err := recordExists(repository, record)
+	if err != nil {
+		return err
+	}
+	return saveRestored(repository, record, exists)
+}
+
+// RestoreRecord replaces the document with the id of the record (upsert), keeping the ObjectId of the backup.
+// The record is not validated and its timestamps are kept.
+func (s *MongoSession) RestoreRecord(record map[string]interface{}) error {
+	done, err := s.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return err
+	}
+	if err := s.checkConnected(); err != nil {
+		return err
+	}
+
+	document := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		document[key] = value
+	}
+	delete(document, "_id")
+
+	var selector bson.M
+	if s.repoDef.IsCustomID() {
+		id := document["id"]
+		if idType := s.repoDef.GetIDType(); idType != "" {
+			value, err := toIDValue(id, idType)
+			if err != nil {
+				return err
+			}
+			id = value
+			document["id"] = value
+		}
+		selector = bson.M{"id": id}
+	} else {
+		id, err := toIDValue(document["id"], s.mongoIDType())
+		if err != nil {
+			return err
+		}
+		delete(document, "id")
+		selector = bson.M{"_id": id}
+	}
+
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	if _, err := c.Upsert(selector, document); err != nil {
+		if mgo.IsDup(err) {
+			return mongoDuplicateKeyError(err, s.repoDef)
+		}
+		return err
+	}
+	return nil
+}
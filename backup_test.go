@@ -0,0 +1,143 @@
+package backends
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// newBackupManager returns a manager with a memory backend defining the repositories.
+func newBackupManager(t *testing.T, repositories map[string]*memoryRepo) BackendManager {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return repositories[def.GetName()], nil
+	}, nil)
+	for name := range repositories {
+		if _, err := backend.DefineRepository(name, RepositoryDefinitionMap{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manager := NewBackendManager(map[string]*config.DBInfo{"memory": &config.DBInfo{}})
+	manager.SupportBackend("memory", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return backend, nil
+	}, map[string]interface{}{})
+	if _, err := manager.GetBackend("memory"); err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	createdAt := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	source := newBackupManager(t, map[string]*memoryRepo{
+		"users": {records: []map[string]interface{}{
+			{"id": "1", "name": "ann", "createdAt": createdAt},
+			{"id": "2", "name": "bob", "visits": int64(1) << 60},
+		}},
+		"orders": {records: []map[string]interface{}{{"id": "o1", "total": 10.5}}},
+	})
+
+	manifest, err := source.Backup(context.Background(), DirectoryBackup(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Repositories) != 2 || manifest.Repositories[0].Repository != "orders" || manifest.Repositories[1].Records != 2 {
+		t.Fatalf("Unexpected manifest: %+v", manifest.Repositories)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "memory", "users.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"$date"`) {
+		t.Fatal("Expected a line per record with the extended JSON types. Got: ", string(content))
+	}
+
+	users := &memoryRepo{records: []map[string]interface{}{{"id": "2", "name": "changed"}}}
+	orders := &memoryRepo{}
+	target := newBackupManager(t, map[string]*memoryRepo{"users": users, "orders": orders})
+
+	if _, err := target.Restore(context.Background(), DirectoryBackup(dir), BootstrapFail); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists. Got: ", err)
+	}
+	restored, err := target.Restore(context.Background(), DirectoryBackup(dir), BootstrapSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Repositories) != 2 || restored.Repositories[1].Records != 2 || len(orders.records) != 1 {
+		t.Fatalf("Unexpected restore: %+v %v", restored.Repositories, orders.records)
+	}
+	if len(users.records) != 2 || users.records[0]["name"] != "changed" {
+		t.Fatal("Expected the existing record to be kept. Got: ", users.records)
+	}
+	if at, ok := users.records[1]["createdAt"].(time.Time); !ok || !at.Equal(createdAt) {
+		t.Fatal("Expected the date to be restored as time.Time. Got: ", users.records[1])
+	}
+
+	if _, err := target.Restore(context.Background(), DirectoryBackup(dir), BootstrapOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	if users.records[0]["name"] != "bob" || users.records[0]["visits"] != int64(1)<<60 {
+		t.Fatal("Expected the existing record to be overwritten. Got: ", users.records[0])
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manager := newBackupManager(t, map[string]*memoryRepo{"users": {records: []map[string]interface{}{{"id": "1"}}}})
+
+	if _, err := manager.Restore(context.Background(), DirectoryBackup(dir), BootstrapSkip); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound without the manifest. Got: ", err)
+	}
+	if _, err := manager.Restore(context.Background(), DirectoryBackup(dir), "merge"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown policy. Got: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := manager.Backup(ctx, DirectoryBackup(dir)); err != context.Canceled {
+		t.Fatal("Expected the backup to stop with the context. Got: ", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, BackupManifestFile)); !os.IsNotExist(err) {
+		t.Fatal("Expected no manifest for an incomplete backup")
+	}
+}
+
+func TestFilesBackup(t *testing.T) {
+	storage := &memoryS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+	store := FilesBackup(newS3Collection(t, server, BackendOptions{"filesBucket": "backups"}), "2021-06-01/")
+
+	users := &memoryRepo{records: []map[string]interface{}{{"id": "1", "name": "ann"}}}
+	manager := newBackupManager(t, map[string]*memoryRepo{"users": users})
+	if _, err := manager.Backup(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if storage.objects["/backups/users/2021-06-01/manifest.json"] == "" || storage.objects["/backups/users/2021-06-01/memory/users.jsonl"] == "" {
+		t.Fatal("Expected the backup files in S3. Got: ", storage.objects)
+	}
+
+	users.records = nil
+	if _, err := manager.Restore(context.Background(), store, BootstrapSkip); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.records) != 1 || users.records[0]["name"] != "ann" {
+		t.Fatal("Expected the restored record. Got: ", users.records)
+	}
+}
@@ -0,0 +1,183 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// BatchRepository is implemented by the repositories that can fetch multiple records by ID in a single request.
+type BatchRepository interface {
+	// GetMany returns the records with the given IDs, in no particular order. IDs of records that
+	// do not exist are skipped.
+	GetMany(ids []string, resultsTypeHint interface{}) (interface{}, error)
+}
+
+// GetMany returns the records with the given IDs. For example, to load the authors of a list of posts:
+//
+//	authors, err := backends.GetMany(usersRepo, authorIDs, &User{})
+//
+// Returns an error if the repository does not support fetching multiple records by ID.
+func GetMany(repo Repository, ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	if r, ok := repo.(BatchRepository); ok {
+		return r.GetMany(ids, resultsTypeHint)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("fetching multiple records by ID is not supported on %T", repo))
+}
+
+// GetMany returns the records from the repository on the active backend.
+func (r *failoverRepository) GetMany(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return GetMany(repository, ids, resultsTypeHint)
+}
+
+// GetMany fetches the records with an _id (or id, for repositories with custom IDs) in the given IDs.
+func (s *MongoSession) GetMany(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	resultsTypeHint = AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultsTypeHint)
+	if len(ids) == 0 {
+		return results.Interface(), nil
+	}
+
+	slicePointer := reflect.New(results.Type())
+	slicePointer.Elem().Set(results)
+
+	idType, property := s.mongoIDType(), "_id"
+	if s.repoDef.IsCustomID() {
+		idType, property = s.repoDef.GetIDType(), "id"
+	}
+	values := []interface{}{}
+	for _, id := range ids {
+		value, err := toIDValue(id, idType)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	filter := bson.M{property: bson.M{"$in": values}}
+
+	session, c := s.getReadCollection()
+	defer session.Close()
+
+	if err := c.Find(filter).All(slicePointer.Interface()); err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	if err := s.mapIDs(slicePointer.Interface()); err != nil {
+		return nil, err
+	}
+	return slicePointer.Interface(), nil
+}
+
+// GetMany fetches the records with the given hash key values with BatchGetItem, in requests of up to
+// 100 keys. The keys that DynamoDB does not process (due to the capacity or response size limits)
+// are requested again with exponential backoff, and ErrThrottled is returned if some keys are still not
+// processed when the retries time out. The table must not have a range key.
+func (c *DynamoCollection) GetMany(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if c.RepositoryDefinition.GetRangeKey() != "" {
+		return nil, ErrInvalidInput(fmt.Sprintf("table %s has a range key, the records cannot be fetched by ID only", c.RepositoryDefinition.GetName()))
+	}
+
+	resultHint := AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultHint)
+
+	keys, err := dynamoBatchKeys(ids, c.RepositoryDefinition.GetHashKeyType())
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return results.Interface(), nil
+	}
+
+	itr := c.Table.Batch(c.RepositoryDefinition.GetHashKey()).Get(keys...).Consistent(c.consistentRead).Iter()
+	var item map[string]*dynamodb.AttributeValue
+	for itr.Next(&item) {
+		if c.expired(item) {
+			continue
+		}
+		record, err := CreateNewAsExample(resultHint)
+		if err != nil {
+			return nil, err
+		}
+		if err = dynamo.UnmarshalItem(item, record); err != nil {
+			return nil, err
+		}
+		results = reflect.Append(results, reflect.ValueOf(record))
+	}
+	if err := itr.Err(); err != nil && err != dynamo.ErrNotFound {
+		if err == context.DeadlineExceeded {
+			return nil, ErrThrottled(fmt.Sprintf("unprocessed keys in %s after the retries", c.RepositoryDefinition.GetName()))
+		}
+		return nil, err
+	}
+	return results.Interface(), nil
+}
+
+// dynamoBatchKeys returns the unique hash keys for the IDs. DynamoDB rejects batches with duplicate keys.
+func dynamoBatchKeys(ids []string, hashKeyType string) ([]dynamo.Keyed, error) {
+	keys := []dynamo.Keyed{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if hashKeyType != "N" {
+			keys = append(keys, dynamo.Keys{id})
+			continue
+		}
+		if value, err := strconv.ParseInt(id, 10, 64); err == nil {
+			keys = append(keys, dynamo.Keys{value})
+			continue
+		}
+		value, err := strconv.ParseFloat(id, 64)
+		if err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("id %s is not a number", id))
+		}
+		keys = append(keys, dynamo.Keys{value})
+	}
+	return keys, nil
+}
+
+// expired checks if the TTL attribute of the item is in the past. DynamoDB deletes the expired items
+// with a delay, so they are excluded from the results.
+func (c *DynamoCollection) expired(item map[string]*dynamodb.AttributeValue) bool {
+	if !c.RepositoryDefinition.EnableTTL() {
+		return false
+	}
+	value, ok := item[c.RepositoryDefinition.GetTTLAttribute()]
+	if !ok {
+		return false
+	}
+	var expiresAt time.Time
+	if err := dynamo.Unmarshal(value, &expiresAt); err != nil {
+		return false
+	}
+	return !expiresAt.After(time.Now())
+}
@@ -0,0 +1,69 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+func TestDynamoBatchKeys(t *testing.T) {
+	keys, err := dynamoBatchKeys([]string{"a", "b", "a"}, "S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].HashKey() != "a" || keys[1].HashKey() != "b" {
+		t.Fatal("Expected unique string keys. Got: ", keys)
+	}
+
+	keys, err = dynamoBatchKeys([]string{"42", "1.5"}, "N")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[0].HashKey() != int64(42) || keys[1].HashKey() != 1.5 {
+		t.Fatal("Expected number keys. Got: ", keys)
+	}
+
+	if _, err := dynamoBatchKeys([]string{"abc"}, "N"); err == nil {
+		t.Fatal("Expected error for a non-numeric id")
+	}
+}
+
+func TestDynamoGetManyRangeKey(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"name": "users", "hashKey": "tenant", "rangeKey": "id"},
+	}
+	if _, err := repo.GetMany([]string{"1"}, map[string]interface{}{}); err == nil {
+		t.Fatal("Expected error for a table with a range key")
+	}
+}
+
+func TestDynamoExpired(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"enableTtl": true, "ttlAttribute": "expiresAt"},
+	}
+	marshal := func(at time.Time) map[string]*dynamodb.AttributeValue {
+		item, err := dynamo.MarshalItem(map[string]interface{}{"id": "1", "expiresAt": at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+
+	if !repo.expired(marshal(time.Now().Add(-time.Minute))) {
+		t.Fatal("Expected the item to be expired")
+	}
+	if repo.expired(marshal(time.Now().Add(time.Hour))) {
+		t.Fatal("Expected the item not to be expired")
+	}
+	if repo.expired(map[string]*dynamodb.AttributeValue{}) {
+		t.Fatal("Expected an item without TTL attribute not to be expired")
+	}
+}
+
+func TestGetManyNotSupported(t *testing.T) {
+	if _, err := GetMany(&memoryRepo{}, []string{"1"}, map[string]interface{}{}); err == nil {
+		t.Fatal("Expected error for a repository without batch get")
+	}
+}
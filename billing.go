@@ -0,0 +1,315 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Billing modes of the DynamoDB tables.
+const (
+	// BillingProvisioned uses the provisioned read and write capacity (the default).
+	BillingProvisioned = "PROVISIONED"
+	// BillingPayPerRequest uses the on-demand capacity.
+	BillingPayPerRequest = "PAY_PER_REQUEST"
+)
+
+const defaultTargetUtilization = 70
+
+// AutoScaling configures the auto-scaling of the provisioned capacity of a DynamoDB table and its
+// global secondary indexes.
+type AutoScaling struct {
+	MinReadCapacity  int64
+	MaxReadCapacity  int64
+	MinWriteCapacity int64
+	MaxWriteCapacity int64
+	// TargetUtilization is the target percentage of the consumed capacity (20-90). Defaults to 70.
+	TargetUtilization float64
+}
+
+// GetBillingMode returns the billing mode of the table ("billingMode" property), or empty string
+// for the backend default.
+func (m RepositoryDefinitionMap) GetBillingMode() string {
+	if mode, ok := m["billingMode"]; ok {
+		return mode.(string)
+	}
+	return ""
+}
+
+// GetAutoScaling returns the auto-scaling of the table ("autoScaling" property), or nil for the backend default.
+func (m RepositoryDefinitionMap) GetAutoScaling() *AutoScaling {
+	if value, ok := m["autoScaling"]; ok {
+		autoScaling, err := parseAutoScaling(value)
+		if err != nil {
+			panic(err)
+		}
+		return autoScaling
+	}
+	return nil
+}
+
+// GetAutoScaling returns the backend level auto-scaling ("autoScaling" option), or nil if not set.
+func (o BackendOptions) GetAutoScaling() (*AutoScaling, error) {
+	if value, ok := o["autoScaling"]; ok {
+		return parseAutoScaling(value)
+	}
+	return nil, nil
+}
+
+func parseAutoScaling(value interface{}) (*AutoScaling, error) {
+	switch as := value.(type) {
+	case *AutoScaling:
+		return as, nil
+	case AutoScaling:
+		return &as, nil
+	case map[string]interface{}:
+		options := BackendOptions(as)
+		autoScaling := &AutoScaling{
+			MinReadCapacity:  int64(options.GetInt("minRead")),
+			MaxReadCapacity:  int64(options.GetInt("maxRead")),
+			MinWriteCapacity: int64(options.GetInt("minWrite")),
+			MaxWriteCapacity: int64(options.GetInt("maxWrite")),
+		}
+		if target, ok := as["targetUtilization"].(float64); ok {
+			autoScaling.TargetUtilization = target
+		} else {
+			autoScaling.TargetUtilization = float64(options.GetInt("targetUtilization"))
+		}
+		return autoScaling, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("invalid auto-scaling %v", value))
+}
+
+// validate checks the capacity limits and the target utilization.
+func (a *AutoScaling) validate() error {
+	if a.MinReadCapacity <= 0 || a.MinWriteCapacity <= 0 {
+		return ErrInvalidInput("auto-scaling minimal capacity must be greater than zero")
+	}
+	if a.MaxReadCapacity < a.MinReadCapacity || a.MaxWriteCapacity < a.MinWriteCapacity {
+		return ErrInvalidInput("auto-scaling maximal capacity must not be less than the minimal capacity")
+	}
+	if a.TargetUtilization != 0 && (a.TargetUtilization < 20 || a.TargetUtilization > 90) {
+		return ErrInvalidInput("auto-scaling target utilization must be between 20 and 90")
+	}
+	return nil
+}
+
+// dynamoBilling is the billing of a table, resolved from the repository definition and the backend options.
+type dynamoBilling struct {
+	mode        string
+	autoScaling *AutoScaling
+}
+
+// dynamoBillingFor resolves the billing of the table. The "billingMode" and "autoScaling" properties of the
+// repository definition override the backend options.
+func dynamoBillingFor(repoDef RepositoryDefinition, options BackendOptions) (*dynamoBilling, error) {
+	billing := &dynamoBilling{
+		mode: options.GetString("billingMode"),
+	}
+	autoScaling, err := options.GetAutoScaling()
+	if err != nil {
+		return nil, err
+	}
+	billing.autoScaling = autoScaling
+
+	if mode := repoDef.GetBillingMode(); mode != "" {
+		billing.mode = mode
+	}
+	if autoScaling := repoDef.GetAutoScaling(); autoScaling != nil {
+		billing.autoScaling = autoScaling
+	}
+
+	if billing.mode == "" {
+		billing.mode = BillingProvisioned
+	}
+	switch billing.mode {
+	case BillingProvisioned:
+	case BillingPayPerRequest:
+		if billing.autoScaling != nil {
+			return nil, ErrInvalidInput("auto-scaling is not supported with on-demand billing")
+		}
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("unknown billing mode %s", billing.mode))
+	}
+	if billing.autoScaling != nil {
+		if err := billing.autoScaling.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return billing, nil
+}
+
+func (b *dynamoBilling) onDemand() bool {
+	return b != nil && b.mode == BillingPayPerRequest
+}
+
+// throughput returns the provisioned throughput for the capacity, or nil for on-demand tables.
+// With auto-scaling, the capacity is kept within the auto-scaling limits.
+func (b *dynamoBilling) throughput(readCapacity, writeCapacity int64) *dynamodb.ProvisionedThroughput {
+	if b.onDemand() {
+		return nil
+	}
+	if b != nil && b.autoScaling != nil {
+		readCapacity = clampCapacity(readCapacity, b.autoScaling.MinReadCapacity, b.autoScaling.MaxReadCapacity)
+		writeCapacity = clampCapacity(writeCapacity, b.autoScaling.MinWriteCapacity, b.autoScaling.MaxWriteCapacity)
+	}
+	return &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(readCapacity),
+		WriteCapacityUnits: aws.Int64(writeCapacity),
+	}
+}
+
+func clampCapacity(capacity, min, max int64) int64 {
+	if capacity < min {
+		return min
+	}
+	if capacity > max {
+		return max
+	}
+	return capacity
+}
+
+// reconcileBilling switches the billing mode of an existing table if it differs from the configured one.
+// The provisioned capacity of a table without auto-scaling is updated to the configured capacity.
+// DynamoDB allows switching the billing mode once per 24 hours, so a failed switch is logged and ignored.
+func reconcileBilling(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition, billing *dynamoBilling) error {
+	tableName := repoDef.GetName()
+	result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	table := result.Table
+
+	currentMode := BillingProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != nil {
+		currentMode = aws.StringValue(table.BillingModeSummary.BillingMode)
+	}
+
+	input := &dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+	}
+	throughput := billing.throughput(repoDef.GetReadCapacity(), repoDef.GetWriteCapacity())
+
+	switch {
+	case currentMode != billing.mode:
+		input.BillingMode = aws.String(billing.mode)
+		input.ProvisionedThroughput = throughput
+		if !billing.onDemand() {
+			// the global indexes need provisioned capacity as well
+			for _, index := range table.GlobalSecondaryIndexes {
+				input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, &dynamodb.GlobalSecondaryIndexUpdate{
+					Update: &dynamodb.UpdateGlobalSecondaryIndexAction{
+						IndexName:             index.IndexName,
+						ProvisionedThroughput: throughput,
+					},
+				})
+			}
+		}
+	case billing.onDemand() || billing.autoScaling != nil:
+		return nil
+	case repoDef.GetReadCapacity() > 0 && repoDef.GetWriteCapacity() > 0 && throughputChanged(table.ProvisionedThroughput, throughput):
+		input.ProvisionedThroughput = throughput
+	default:
+		return nil
+	}
+
+	if _, err := svc.UpdateTable(input); err != nil {
+		log.Printf("WARN: failed to update the billing of table %s: %s\n", tableName, err.Error())
+		return nil
+	}
+	return waitForIndexes(svc, tableName)
+}
+
+// dynamoScalingTarget is a capacity dimension of a table or index scaled by Application Auto Scaling.
+type dynamoScalingTarget struct {
+	resourceID string
+	dimension  string
+	metric     string
+	min        int64
+	max        int64
+}
+
+// dynamoScalingTargets returns the read and write capacity scaling targets of the table and its global indexes.
+func dynamoScalingTargets(tableName string, indexNames []string, autoScaling *AutoScaling) []*dynamoScalingTarget {
+	targets := []*dynamoScalingTarget{}
+	add := func(resourceID, resourceType string) {
+		targets = append(targets,
+			&dynamoScalingTarget{
+				resourceID: resourceID,
+				dimension:  fmt.Sprintf("dynamodb:%s:ReadCapacityUnits", resourceType),
+				metric:     applicationautoscaling.MetricTypeDynamoDbreadCapacityUtilization,
+				min:        autoScaling.MinReadCapacity,
+				max:        autoScaling.MaxReadCapacity,
+			},
+			&dynamoScalingTarget{
+				resourceID: resourceID,
+				dimension:  fmt.Sprintf("dynamodb:%s:WriteCapacityUnits", resourceType),
+				metric:     applicationautoscaling.MetricTypeDynamoDbwriteCapacityUtilization,
+				min:        autoScaling.MinWriteCapacity,
+				max:        autoScaling.MaxWriteCapacity,
+			},
+		)
+	}
+	add(fmt.Sprintf("table/%s", tableName), "table")
+	for _, indexName := range indexNames {
+		add(fmt.Sprintf("table/%s/index/%s", tableName, indexName), "index")
+	}
+	return targets
+}
+
+// registerAutoScaling registers the scaling targets and the target tracking policies of the table
+// and its global indexes. Registering is idempotent, so the limits are reconciled on every start.
+func registerAutoScaling(sess *session.Session, svc *dynamodb.DynamoDB, tableName string, autoScaling *AutoScaling) error {
+	result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	indexNames := []string{}
+	for _, index := range result.Table.GlobalSecondaryIndexes {
+		indexNames = append(indexNames, aws.StringValue(index.IndexName))
+	}
+
+	targetUtilization := autoScaling.TargetUtilization
+	if targetUtilization == 0 {
+		targetUtilization = defaultTargetUtilization
+	}
+
+	scaling := applicationautoscaling.New(sess)
+	for _, target := range dynamoScalingTargets(tableName, indexNames, autoScaling) {
+		_, err := scaling.RegisterScalableTarget(&applicationautoscaling.RegisterScalableTargetInput{
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceDynamodb),
+			ResourceId:        aws.String(target.resourceID),
+			ScalableDimension: aws.String(target.dimension),
+			MinCapacity:       aws.Int64(target.min),
+			MaxCapacity:       aws.Int64(target.max),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = scaling.PutScalingPolicy(&applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(fmt.Sprintf("%s-%s", target.resourceID, target.metric)),
+			PolicyType:        aws.String(applicationautoscaling.PolicyTypeTargetTrackingScaling),
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceDynamodb),
+			ResourceId:        aws.String(target.resourceID),
+			ScalableDimension: aws.String(target.dimension),
+			TargetTrackingScalingPolicyConfiguration: &applicationautoscaling.TargetTrackingScalingPolicyConfiguration{
+				TargetValue: aws.Float64(targetUtilization),
+				PredefinedMetricSpecification: &applicationautoscaling.PredefinedMetricSpecification{
+					PredefinedMetricType: aws.String(target.metric),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
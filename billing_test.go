@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestDynamoBillingFor(t *testing.T) {
+	billing, err := dynamoBillingFor(RepositoryDefinitionMap{}, BackendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if billing.mode != BillingProvisioned || billing.autoScaling != nil {
+		t.Fatal("Expected provisioned billing by default. Got: ", billing)
+	}
+
+	billing, err = dynamoBillingFor(RepositoryDefinitionMap{}, BackendOptions{"billingMode": BillingPayPerRequest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !billing.onDemand() || billing.throughput(5, 5) != nil {
+		t.Fatal("Expected on-demand billing without provisioned throughput")
+	}
+
+	options := BackendOptions{
+		"billingMode": BillingPayPerRequest,
+	}
+	billing, err = dynamoBillingFor(RepositoryDefinitionMap{
+		"billingMode": BillingProvisioned,
+		"autoScaling": map[string]interface{}{
+			"minRead":           float64(5),
+			"maxRead":           float64(100),
+			"minWrite":          float64(1),
+			"maxWrite":          float64(20),
+			"targetUtilization": float64(50),
+		},
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if billing.onDemand() || billing.autoScaling == nil || billing.autoScaling.TargetUtilization != 50 {
+		t.Fatal("Expected the repository billing to override the backend options. Got: ", billing)
+	}
+	throughput := billing.throughput(0, 50)
+	if aws.Int64Value(throughput.ReadCapacityUnits) != 5 || aws.Int64Value(throughput.WriteCapacityUnits) != 20 {
+		t.Fatal("Expected the capacity within the auto-scaling limits. Got: ", throughput)
+	}
+}
+
+func TestDynamoBillingForInvalid(t *testing.T) {
+	for _, def := range []RepositoryDefinitionMap{
+		{"billingMode": "FREE"},
+		{"billingMode": BillingPayPerRequest, "autoScaling": &AutoScaling{MinReadCapacity: 1, MaxReadCapacity: 1, MinWriteCapacity: 1, MaxWriteCapacity: 1}},
+		{"autoScaling": &AutoScaling{MinReadCapacity: 5, MaxReadCapacity: 1, MinWriteCapacity: 1, MaxWriteCapacity: 1}},
+		{"autoScaling": &AutoScaling{MinReadCapacity: 1, MaxReadCapacity: 1, MinWriteCapacity: 1, MaxWriteCapacity: 1, TargetUtilization: 95}},
+	} {
+		if _, err := dynamoBillingFor(def, BackendOptions{}); !IsErrInvalidInput(err) {
+			t.Errorf("Expected invalid input for %v. Got: %v", def, err)
+		}
+	}
+}
+
+func TestDynamoScalingTargets(t *testing.T) {
+	targets := dynamoScalingTargets("users", []string{"email"}, &AutoScaling{
+		MinReadCapacity:  5,
+		MaxReadCapacity:  100,
+		MinWriteCapacity: 1,
+		MaxWriteCapacity: 20,
+	})
+	if len(targets) != 4 {
+		t.Fatal("Expected 4 scaling targets. Got: ", len(targets))
+	}
+	if targets[0].resourceID != "table/users" || targets[0].dimension != "dynamodb:table:ReadCapacityUnits" || targets[0].max != 100 {
+		t.Fatal("Unexpected table target: ", targets[0])
+	}
+	if targets[3].resourceID != "table/users/index/email" || targets[3].dimension != "dynamodb:index:WriteCapacityUnits" || targets[3].min != 1 {
+		t.Fatal("Unexpected index target: ", targets[3])
+	}
+}
@@ -0,0 +1,154 @@
+package backends
+
+import "fmt"
+
+// BootstrapConflictPolicy defines what happens when a bootstrap document already exists in the repository.
+type BootstrapConflictPolicy string
+
+const (
+	// BootstrapSkip leaves the existing document untouched.
+	BootstrapSkip BootstrapConflictPolicy = "skip"
+	// BootstrapOverwrite updates the existing document with the declared values.
+	BootstrapOverwrite BootstrapConflictPolicy = "overwrite"
+	// BootstrapFail aborts the provisioning of the repository with ErrAlreadyExists.
+	BootstrapFail BootstrapConflictPolicy = "fail"
+)
+
+// BootstrapSpec declares the documents that must exist in a repository once it is provisioned.
+// Documents are identified by the values of the Key properties (defaults to "id").
+type BootstrapSpec struct {
+	Key        []string
+	OnConflict BootstrapConflictPolicy
+	Documents  []map[string]interface{}
+}
+
+// GetBootstrap returns the bootstrap section of the repository definition, or nil if not set.
+// The section can be given as *BootstrapSpec or as a map (as loaded from JSON config):
+// 		"bootstrap": map[string]interface{}{
+// 			"key":        []string{"name"},
+// 			"onConflict": "skip",
+// 			"documents":  []interface{}{map[string]interface{}{"name": "admin"}},
+// 		}
+func (m RepositoryDefinitionMap) GetBootstrap() *BootstrapSpec {
+	bootstrap, ok := m["bootstrap"]
+	if !ok {
+		return nil
+	}
+	switch spec := bootstrap.(type) {
+	case *BootstrapSpec:
+		return spec
+	case BootstrapSpec:
+		return &spec
+	case map[string]interface{}:
+		return bootstrapFromMap(spec)
+	}
+	return nil
+}
+
+func bootstrapFromMap(m map[string]interface{}) *BootstrapSpec {
+	spec := &BootstrapSpec{
+		Key:       []string{},
+		Documents: []map[string]interface{}{},
+	}
+
+	switch key := m["key"].(type) {
+	case string:
+		spec.Key = append(spec.Key, key)
+	case []string:
+		spec.Key = key
+	case []interface{}:
+		for _, k := range key {
+			if ks, ok := k.(string); ok {
+				spec.Key = append(spec.Key, ks)
+			}
+		}
+	}
+
+	if onConflict, ok := m["onConflict"].(string); ok {
+		spec.OnConflict = BootstrapConflictPolicy(onConflict)
+	}
+
+	switch docs := m["documents"].(type) {
+	case []map[string]interface{}:
+		spec.Documents = docs
+	case []interface{}:
+		for _, doc := range docs {
+			if docMap, ok := doc.(map[string]interface{}); ok {
+				spec.Documents = append(spec.Documents, docMap)
+			}
+		}
+	}
+
+	return spec
+}
+
+// ApplyBootstrap makes sure that all documents declared in the bootstrap spec exist in the repository.
+// It is safe to call it multiple times - existing documents are handled according to the conflict policy
+// (BootstrapSkip by default).
+func ApplyBootstrap(repo Repository, spec *BootstrapSpec) error {
+	if spec == nil {
+		return nil
+	}
+
+	key := spec.Key
+	if len(key) == 0 {
+		key = []string{"id"}
+	}
+
+	policy := spec.OnConflict
+	if policy == "" {
+		policy = BootstrapSkip
+	}
+	if policy != BootstrapSkip && policy != BootstrapOverwrite && policy != BootstrapFail {
+		return ErrInvalidInput(fmt.Sprintf("unknown bootstrap conflict policy %s", policy))
+	}
+
+	for _, doc := range spec.Documents {
+		filter, err := bootstrapFilter(key, doc)
+		if err != nil {
+			return err
+		}
+
+		_, err = repo.GetOne(filter, &map[string]interface{}{})
+		if err != nil && !IsErrNotFound(err) {
+			return err
+		}
+
+		payload := map[string]interface{}{}
+		for k, v := range doc {
+			payload[k] = v
+		}
+
+		if err != nil {
+			// not found, so create it
+			if _, err = repo.Save(&payload, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch policy {
+		case BootstrapFail:
+			return ErrAlreadyExists(fmt.Sprintf("bootstrap document %v already exists", filter))
+		case BootstrapOverwrite:
+			filter, _ = bootstrapFilter(key, doc)
+			if _, err = repo.Save(&payload, filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func bootstrapFilter(key []string, doc map[string]interface{}) (Filter, error) {
+	filter := NewFilter()
+	for _, k := range key {
+		value, ok := doc[k]
+		if !ok {
+			return nil, ErrInvalidInput(fmt.Sprintf("bootstrap document is missing the key property %s", k))
+		}
+		filter.Match(k, value)
+	}
+	return filter, nil
+}
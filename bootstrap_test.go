@@ -0,0 +1,128 @@
+package backends
+
+import "testing"
+
+type memoryRepo struct {
+	records []map[string]interface{}
+}
+
+func (r *memoryRepo) find(filter Filter) int {
+	for i, record := range r.records {
+		if matchesFilter(record, filter) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesFilter(record map[string]interface{}, filter Filter) bool {
+	for k, v := range filter {
+		if record[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *memoryRepo) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	i := r.find(filter)
+	if i < 0 {
+		return nil, ErrNotFound("not found")
+	}
+	return result, MapToInterface(r.records[i], result)
+}
+
+func (r *memoryRepo) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	results := []map[string]interface{}{}
+	for _, record := range r.records {
+		if matchesFilter(record, filter) {
+			result := map[string]interface{}{}
+			for k, v := range record {
+				result[k] = v
+			}
+			results = append(results, result)
+		}
+	}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return &results, nil
+}
+
+func (r *memoryRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		r.records = append(r.records, *payload)
+		return *payload, nil
+	}
+	i := r.find(filter)
+	if i < 0 {
+		return nil, ErrNotFound("not found")
+	}
+	for k, v := range *payload {
+		r.records[i][k] = v
+	}
+	return r.records[i], nil
+}
+
+func (r *memoryRepo) DeleteOne(filter Filter) error {
+	i := r.find(filter)
+	if i < 0 {
+		return ErrNotFound("not found")
+	}
+	r.records = append(r.records[:i], r.records[i+1:]...)
+	return nil
+}
+
+func (r *memoryRepo) DeleteAll(filter Filter) error {
+	for i := r.find(filter); i >= 0; i = r.find(filter) {
+		r.records = append(r.records[:i], r.records[i+1:]...)
+	}
+	return nil
+}
+
+func TestApplyBootstrap(t *testing.T) {
+	repo := &memoryRepo{}
+	spec := RepositoryDefinitionMap{
+		"bootstrap": map[string]interface{}{
+			"key": []interface{}{"name"},
+			"documents": []interface{}{
+				map[string]interface{}{"name": "admin", "level": "high"},
+				map[string]interface{}{"name": "user", "level": "low"},
+			},
+		},
+	}.GetBootstrap()
+
+	if err := ApplyBootstrap(repo, spec); err != nil {
+		t.Fatal(err)
+	}
+	// applying it twice must not create duplicates
+	if err := ApplyBootstrap(repo, spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.records) != 2 {
+		t.Fatal("Expected 2 records, got: ", len(repo.records))
+	}
+
+	repo.records[0]["level"] = "changed"
+
+	spec.OnConflict = BootstrapOverwrite
+	if err := ApplyBootstrap(repo, spec); err != nil {
+		t.Fatal(err)
+	}
+	if repo.records[0]["level"] != "high" {
+		t.Fatal("Expected the document to be overwritten. Got: ", repo.records[0])
+	}
+
+	spec.OnConflict = BootstrapFail
+	if err := ApplyBootstrap(repo, spec); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected already exists error, got: ", err)
+	}
+}
@@ -0,0 +1,181 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CAPABILITIES_CTX_KEY is the backend context key for the detected Capabilities.
+var CAPABILITIES_CTX_KEY = "CAPABILITIES"
+
+// Capabilities holds the server version and the features supported by the database server
+// the backend is connected to. It is detected when the backend is built.
+type Capabilities struct {
+	// ServerVersion is the version of the database server (MongoDB only).
+	ServerVersion string
+	// WireVersion is the MongoDB wire protocol version (MongoDB only).
+	WireVersion int
+	// Endpoint is the type of the endpoint - "replicaset", "standalone" or "sharded" for MongoDB,
+	// "aws" or "custom" (DynamoDB Local, localstack) for DynamoDB.
+	Endpoint string
+	// Transactions is true if multi-document transactions are supported by the backend (DynamoDB only, the
+	// MongoDB backend has no transaction API).
+	Transactions bool
+	// ChangeStreams is true if change streams (DynamoDB Streams) are supported.
+	ChangeStreams bool
+	// Collation is true if collation (case-insensitive indexes) is supported. On MongoDB servers without
+	// collation, the collation of the indexes and the collections is ignored.
+	Collation bool
+}
+
+// Features that can be required with the backend options. If a required feature is not
+// supported by the server, the backend fails to build. Otherwise the feature is disabled
+// in the Capabilities and a warning is logged.
+const (
+	RequireTransactions  = "requireTransactions"
+	RequireChangeStreams = "requireChangeStreams"
+	RequireCollation     = "requireCollation"
+)
+
+// checkRequired verifies that the features required in the backend options are supported.
+func (c *Capabilities) checkRequired(options BackendOptions) error {
+	features := map[string]bool{
+		RequireTransactions:  c.Transactions,
+		RequireChangeStreams: c.ChangeStreams,
+		RequireCollation:     c.Collation,
+	}
+	for _, option := range []string{RequireTransactions, RequireChangeStreams, RequireCollation} {
+		if features[option] {
+			continue
+		}
+		feature := strings.TrimPrefix(option, "require")
+		if options.GetBool(option) {
+			return ErrBackendError(fmt.Sprintf("%s are required but not supported", feature))
+		}
+	}
+	return nil
+}
+
+// detectMongoCapabilities detects the MongoDB server version and features.
+func detectMongoCapabilities(session *mgo.Session) (*Capabilities, error) {
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	isMaster := bson.M{}
+	if err = session.Run("isMaster", &isMaster); err != nil {
+		return nil, err
+	}
+
+	capabilities := &Capabilities{
+		ServerVersion: buildInfo.Version,
+		Endpoint:      "standalone",
+	}
+	if wireVersion, ok := isMaster["maxWireVersion"].(int); ok {
+		capabilities.WireVersion = wireVersion
+	}
+	if _, ok := isMaster["setName"]; ok {
+		capabilities.Endpoint = "replicaset"
+	}
+	if msg, ok := isMaster["msg"]; ok && msg == "isdbgrid" {
+		capabilities.Endpoint = "sharded"
+	}
+
+	clustered := capabilities.Endpoint != "standalone"
+	capabilities.Collation = buildInfo.VersionAtLeast(3, 4)
+	capabilities.ChangeStreams = clustered && buildInfo.VersionAtLeast(3, 6)
+	// the MongoDB backend does not run transactions, whatever the server supports
+
+	return capabilities, nil
+}
+
+// dynamoCapabilities returns the capabilities of the DynamoDB endpoint. The case-insensitive unique indexes
+// are supported with case-folded guard items.
+func dynamoCapabilities(endpoint string) *Capabilities {
+	capabilities := &Capabilities{
+		Endpoint:      "aws",
+		Transactions:  true,
+		ChangeStreams: true,
+		Collation:     true,
+	}
+	if endpoint != "" && !strings.Contains(endpoint, "amazonaws.com") {
+		capabilities.Endpoint = "custom"
+	}
+	return capabilities
+}
+
+// logDisabledFeatures logs a warning for every feature not supported by the server.
+func logDisabledFeatures(backendType string, capabilities *Capabilities) {
+	if !capabilities.Transactions && backendType != "mongodb" {
+		log.Printf("WARN: %s: transactions are not supported by the server and are disabled.\n", backendType)
+	}
+	if !capabilities.ChangeStreams {
+		log.Printf("WARN: %s: change streams are not supported by the server and are disabled.\n", backendType)
+	}
+	if !capabilities.Collation {
+		log.Printf("WARN: %s: collation is not supported by the server and is ignored.\n", backendType)
+	}
+}
+
+// withoutCollation returns the repository definition with the collation of the collection and of the indexes
+// removed, if the MongoDB server does not support collation. The capabilities of a backend that is not
+// connected are not known, so the definition is not changed.
+func withoutCollation(repoDef RepositoryDefinition, capabilities *Capabilities) RepositoryDefinition {
+	if capabilities == nil || capabilities.ServerVersion == "" || capabilities.Collation {
+		return repoDef
+	}
+	hasCollation := false
+	if options := repoDef.GetCollectionOptions(); options != nil && options.Collation != nil {
+		hasCollation = true
+	}
+	for _, index := range repoDef.GetIndexes() {
+		if index.GetCollation() != nil {
+			hasCollation = true
+		}
+	}
+	if !hasCollation {
+		return repoDef
+	}
+	log.Printf("WARN: MongoDB %s does not support collation, the collation of %s is ignored.\n", capabilities.ServerVersion, repoDef.GetName())
+	return &noCollationDefinition{repoDef}
+}
+
+// noCollationDefinition is a repository definition without collation.
+type noCollationDefinition struct {
+	RepositoryDefinition
+}
+
+// GetIndexes returns the indexes without collation.
+func (d *noCollationDefinition) GetIndexes() []Index {
+	indexes := []Index{}
+	for _, index := range d.RepositoryDefinition.GetIndexes() {
+		indexes = append(indexes, &noCollationIndex{index})
+	}
+	return indexes
+}
+
+// GetCollectionOptions returns the collection options without collation.
+func (d *noCollationDefinition) GetCollectionOptions() *CollectionOptions {
+	options := d.RepositoryDefinition.GetCollectionOptions()
+	if options == nil {
+		return nil
+	}
+	optionsCopy := *options
+	optionsCopy.Collation = nil
+	return &optionsCopy
+}
+
+// noCollationIndex is an index without collation.
+type noCollationIndex struct {
+	Index
+}
+
+// GetCollation returns nil, the binary comparison.
+func (i *noCollationIndex) GetCollation() *Collation {
+	return nil
+}
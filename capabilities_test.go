@@ -0,0 +1,74 @@
+package backends
+
+import "testing"
+
+func TestCapabilitiesCheckRequired(t *testing.T) {
+	capabilities := &Capabilities{
+		Transactions: false,
+		Collation:    true,
+	}
+
+	if err := capabilities.checkRequired(BackendOptions{RequireCollation: true}); err != nil {
+		t.Fatal("Expected collation requirement to pass. Got: ", err)
+	}
+	if err := capabilities.checkRequired(BackendOptions{RequireTransactions: false}); err != nil {
+		t.Fatal("Expected no error when the feature is not required. Got: ", err)
+	}
+	if err := capabilities.checkRequired(BackendOptions{RequireTransactions: true}); err == nil {
+		t.Fatal("Expected an error when transactions are required")
+	}
+}
+
+func TestDynamoCapabilities(t *testing.T) {
+	if c := dynamoCapabilities(""); c.Endpoint != "aws" {
+		t.Fatal("Expected aws endpoint. Got: ", c.Endpoint)
+	}
+	if c := dynamoCapabilities("http://dynamo:8000"); c.Endpoint != "custom" {
+		t.Fatal("Expected custom endpoint. Got: ", c.Endpoint)
+	}
+	if err := dynamoCapabilities("").checkRequired(BackendOptions{RequireCollation: true}); err != nil {
+		t.Fatal("Expected collation to be supported by DynamoDB. Got: ", err)
+	}
+}
+
+func TestWithoutCollation(t *testing.T) {
+	def := RepositoryDefinitionMap{
+		"indexes": []Index{
+			NewUniqueIndex("email"),
+			NewIndexSpec("username").AsUnique().CaseInsensitive("en"),
+		},
+		"collectionOptions": map[string]interface{}{
+			"collation": map[string]interface{}{"locale": "en", "strength": 2},
+		},
+	}
+
+	if withoutCollation(def, &Capabilities{}) == nil || withoutCollation(def, nil) == nil {
+		t.Fatal("Expected a definition")
+	}
+	if _, changed := withoutCollation(def, &Capabilities{}).(*noCollationDefinition); changed {
+		t.Fatal("Expected the definition not to change when the capabilities are not known")
+	}
+	if _, changed := withoutCollation(def, &Capabilities{ServerVersion: "3.6.0", Collation: true}).(*noCollationDefinition); changed {
+		t.Fatal("Expected the definition not to change when collation is supported")
+	}
+
+	stripped := withoutCollation(def, &Capabilities{ServerVersion: "3.2.0"})
+	if options := stripped.GetCollectionOptions(); options == nil || options.Collation != nil {
+		t.Fatalf("Expected the collection options without collation. Got: %+v", options)
+	}
+	if def.GetCollectionOptions().Collation == nil {
+		t.Fatal("Expected the original collection options to keep the collation")
+	}
+	indexes, err := mongoIndexes(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range indexes {
+		if index.needsCommand() {
+			t.Fatal("Expected an index without collation. Got: ", index)
+		}
+	}
+	if indexes[1].Key[0] != "username" || !indexes[1].Unique {
+		t.Fatal("Unexpected index: ", indexes[1])
+	}
+}
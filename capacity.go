@@ -0,0 +1,236 @@
+package backends
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CapacityUsage is the database capacity consumed by one operation on a repository.
+type CapacityUsage struct {
+	// Operation is the name of the operation: the DynamoDB API operation ("Query", "PutItem", ...), or the
+	// repository method on MongoDB ("GetOne", "GetAll", "Save", "DeleteOne" or "DeleteAll").
+	Operation string
+	// ReadUnits and WriteUnits are the read and write capacity units consumed by DynamoDB.
+	ReadUnits  float64
+	WriteUnits float64
+	// DocsExamined is the approximate number of the documents read by MongoDB. It is the number of the
+	// returned documents, as the documents examined by the server are not reported for the operations.
+	DocsExamined int
+	// DocsWritten is the number of the documents inserted, updated or removed by MongoDB.
+	DocsWritten int
+}
+
+// dynamoReadOperations are the DynamoDB operations that consume read capacity.
+var dynamoReadOperations = map[string]bool{
+	"GetItem":          true,
+	"BatchGetItem":     true,
+	"Query":            true,
+	"Scan":             true,
+	"TransactGetItems": true,
+}
+
+// setupDynamoCapacity requests the consumed capacity of the DynamoDB requests made with the session, and
+// publishes it with EventCapacityConsumed, once per table the request used.
+func setupDynamoCapacity(sess *session.Session, database string) {
+	sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "backends.ReturnConsumedCapacity",
+		Fn: func(r *request.Request) {
+			requestConsumedCapacity(r.Params)
+		},
+	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "backends.ConsumedCapacity",
+		Fn: func(r *request.Request) {
+			if r.Error != nil || r.Operation == nil {
+				return
+			}
+			for _, usage := range dynamoCapacityUsage(r.Operation.Name, r.Data) {
+				Events.Publish(&Event{
+					Type:       EventCapacityConsumed,
+					Backend:    "dynamodb",
+					Database:   database,
+					Repository: usage.table,
+					Attributes: traceAttributes(r.Context()),
+					Capacity:   usage.CapacityUsage,
+				})
+			}
+		},
+	})
+}
+
+// requestConsumedCapacity sets ReturnConsumedCapacity of the request input to TOTAL, unless the capacity
+// is already requested (with INDEXES by the queries that collect their consumed capacity).
+func requestConsumedCapacity(params interface{}) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := v.Elem().FieldByName("ReturnConsumedCapacity")
+	if field.IsValid() && field.Type() == reflect.TypeOf((*string)(nil)) && field.IsNil() {
+		field.Set(reflect.ValueOf(aws.String(dynamodb.ReturnConsumedCapacityTotal)))
+	}
+}
+
+type tableCapacityUsage struct {
+	*CapacityUsage
+	table string
+}
+
+// dynamoCapacityUsage returns the capacity consumed per table from the ConsumedCapacity of the request
+// output: a single value, or a list for the batch and the transaction operations.
+func dynamoCapacityUsage(operation string, output interface{}) []tableCapacityUsage {
+	v := reflect.ValueOf(output)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.Elem().FieldByName("ConsumedCapacity")
+	if !field.IsValid() {
+		return nil
+	}
+
+	consumed := []*dynamodb.ConsumedCapacity{}
+	switch capacity := field.Interface().(type) {
+	case *dynamodb.ConsumedCapacity:
+		consumed = append(consumed, capacity)
+	case []*dynamodb.ConsumedCapacity:
+		consumed = capacity
+	}
+
+	usages := []tableCapacityUsage{}
+	for _, capacity := range consumed {
+		if capacity == nil || capacity.TableName == nil {
+			continue
+		}
+		usage := &CapacityUsage{
+			Operation:  operation,
+			ReadUnits:  aws.Float64Value(capacity.ReadCapacityUnits),
+			WriteUnits: aws.Float64Value(capacity.WriteCapacityUnits),
+		}
+		if usage.ReadUnits == 0 && usage.WriteUnits == 0 {
+			// only the total is returned with TOTAL
+			if dynamoReadOperations[operation] {
+				usage.ReadUnits = aws.Float64Value(capacity.CapacityUnits)
+			} else {
+				usage.WriteUnits = aws.Float64Value(capacity.CapacityUnits)
+			}
+		}
+		usages = append(usages, tableCapacityUsage{CapacityUsage: usage, table: *capacity.TableName})
+	}
+	return usages
+}
+
+// reportUsage publishes the documents read and written by an operation, if the "reportCapacity" option
+// is set on the backend.
+func (s *MongoSession) reportUsage(operation string, examined, written int) {
+	if !s.reportCapacity {
+		return
+	}
+	Events.Publish(&Event{
+		Type:       EventCapacityConsumed,
+		Backend:    "mongodb",
+		Database:   s.databaseName,
+		Repository: s.collectionName,
+		Attributes: s.operation.TraceAttributes,
+		Capacity: &CapacityUsage{
+			Operation:    operation,
+			DocsExamined: examined,
+			DocsWritten:  written,
+		},
+	})
+}
+
+// RepositoryUsage is the capacity consumed by the operations on a repository.
+type RepositoryUsage struct {
+	Backend    string
+	Database   string
+	Repository string
+	// Operations is the number of the reported operations.
+	Operations   int
+	ReadUnits    float64
+	WriteUnits   float64
+	DocsExamined int
+	DocsWritten  int
+}
+
+type repositoryUsageKey struct {
+	backend    string
+	database   string
+	repository string
+}
+
+// CapacityTracker aggregates the consumed capacity per repository from the EventCapacityConsumed events.
+type CapacityTracker struct {
+	usage       map[repositoryUsageKey]*RepositoryUsage
+	mutex       *sync.RWMutex
+	unsubscribe func()
+}
+
+// NewCapacityTracker creates new CapacityTracker that aggregates the capacity events published on the bus.
+// The capacity is reported by the backends with the "reportCapacity" option set.
+func NewCapacityTracker(bus *EventBus) *CapacityTracker {
+	tracker := &CapacityTracker{
+		usage: map[repositoryUsageKey]*RepositoryUsage{},
+		mutex: &sync.RWMutex{},
+	}
+	tracker.unsubscribe = bus.Subscribe(tracker.add, EventCapacityConsumed)
+	return tracker
+}
+
+func (t *CapacityTracker) add(event *Event) {
+	if event.Capacity == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := repositoryUsageKey{backend: event.Backend, database: event.Database, repository: event.Repository}
+	usage, ok := t.usage[key]
+	if !ok {
+		usage = &RepositoryUsage{Backend: event.Backend, Database: event.Database, Repository: event.Repository}
+		t.usage[key] = usage
+	}
+	usage.Operations++
+	usage.ReadUnits += event.Capacity.ReadUnits
+	usage.WriteUnits += event.Capacity.WriteUnits
+	usage.DocsExamined += event.Capacity.DocsExamined
+	usage.DocsWritten += event.Capacity.DocsWritten
+}
+
+// Usage returns the consumed capacity of the repositories, sorted by backend, database and repository.
+func (t *CapacityTracker) Usage() []RepositoryUsage {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	usages := make([]RepositoryUsage, 0, len(t.usage))
+	for _, usage := range t.usage {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Backend != usages[j].Backend {
+			return usages[i].Backend < usages[j].Backend
+		}
+		if usages[i].Database != usages[j].Database {
+			return usages[i].Database < usages[j].Database
+		}
+		return usages[i].Repository < usages[j].Repository
+	})
+	return usages
+}
+
+// Reset clears the aggregated capacity, for example after it is exported for a billing period.
+func (t *CapacityTracker) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.usage = map[repositoryUsageKey]*RepositoryUsage{}
+}
+
+// Close stops the tracker from receiving the capacity events.
+func (t *CapacityTracker) Close() {
+	t.unsubscribe()
+}
@@ -0,0 +1,112 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestRequestConsumedCapacity(t *testing.T) {
+	query := &dynamodb.QueryInput{}
+	requestConsumedCapacity(query)
+	if aws.StringValue(query.ReturnConsumedCapacity) != dynamodb.ReturnConsumedCapacityTotal {
+		t.Fatal("Expected the total capacity to be requested. Got: ", query.ReturnConsumedCapacity)
+	}
+
+	scan := &dynamodb.ScanInput{ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityIndexes)}
+	requestConsumedCapacity(scan)
+	if aws.StringValue(scan.ReturnConsumedCapacity) != dynamodb.ReturnConsumedCapacityIndexes {
+		t.Fatal("Expected the requested capacity to be kept. Got: ", scan.ReturnConsumedCapacity)
+	}
+
+	// inputs without the field are not changed
+	requestConsumedCapacity(&dynamodb.ListTablesInput{})
+	requestConsumedCapacity(nil)
+}
+
+func TestDynamoCapacityUsage(t *testing.T) {
+	usages := dynamoCapacityUsage("Query", &dynamodb.QueryOutput{
+		ConsumedCapacity: &dynamodb.ConsumedCapacity{TableName: aws.String("users"), CapacityUnits: aws.Float64(2.5)},
+	})
+	if len(usages) != 1 || usages[0].table != "users" || usages[0].ReadUnits != 2.5 || usages[0].WriteUnits != 0 {
+		t.Fatalf("Expected the read capacity of the query. Got: %+v", usages)
+	}
+
+	usages = dynamoCapacityUsage("BatchWriteItem", &dynamodb.BatchWriteItemOutput{
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{
+			{TableName: aws.String("users"), CapacityUnits: aws.Float64(3)},
+			{TableName: aws.String("orders"), CapacityUnits: aws.Float64(1)},
+		},
+	})
+	if len(usages) != 2 || usages[0].WriteUnits != 3 || usages[1].table != "orders" || usages[1].WriteUnits != 1 {
+		t.Fatalf("Expected the write capacity per table. Got: %+v", usages)
+	}
+
+	usages = dynamoCapacityUsage("TransactWriteItems", &dynamodb.TransactWriteItemsOutput{
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{
+			{TableName: aws.String("users"), CapacityUnits: aws.Float64(4), ReadCapacityUnits: aws.Float64(1), WriteCapacityUnits: aws.Float64(3)},
+		},
+	})
+	if len(usages) != 1 || usages[0].ReadUnits != 1 || usages[0].WriteUnits != 3 {
+		t.Fatalf("Expected the read and write capacity. Got: %+v", usages)
+	}
+
+	if usages := dynamoCapacityUsage("PutItem", &dynamodb.PutItemOutput{}); len(usages) != 0 {
+		t.Fatalf("Expected no capacity without ConsumedCapacity. Got: %+v", usages)
+	}
+	if usages := dynamoCapacityUsage("ListTables", &dynamodb.ListTablesOutput{}); len(usages) != 0 {
+		t.Fatalf("Expected no capacity for ListTables. Got: %+v", usages)
+	}
+}
+
+func TestCapacityTracker(t *testing.T) {
+	bus := NewEventBus()
+	tracker := NewCapacityTracker(bus)
+
+	bus.Publish(&Event{Type: EventCapacityConsumed, Backend: "dynamodb", Repository: "users", Capacity: &CapacityUsage{Operation: "Query", ReadUnits: 1.5}})
+	bus.Publish(&Event{Type: EventCapacityConsumed, Backend: "dynamodb", Repository: "users", Capacity: &CapacityUsage{Operation: "PutItem", WriteUnits: 2}})
+	bus.Publish(&Event{Type: EventCapacityConsumed, Backend: "mongodb", Database: "app", Repository: "orders", Capacity: &CapacityUsage{Operation: "GetAll", DocsExamined: 10}})
+	bus.Publish(&Event{Type: EventRepositoryScan, Backend: "dynamodb", Repository: "users"})
+
+	usage := tracker.Usage()
+	if len(usage) != 2 {
+		t.Fatalf("Expected the usage of two repositories. Got: %+v", usage)
+	}
+	users := usage[0]
+	if users.Repository != "users" || users.Operations != 2 || users.ReadUnits != 1.5 || users.WriteUnits != 2 {
+		t.Fatalf("Expected the aggregated capacity of users. Got: %+v", users)
+	}
+	if orders := usage[1]; orders.Repository != "orders" || orders.Database != "app" || orders.DocsExamined != 10 {
+		t.Fatalf("Expected the documents examined in orders. Got: %+v", orders)
+	}
+
+	tracker.Reset()
+	if usage := tracker.Usage(); len(usage) != 0 {
+		t.Fatalf("Expected no usage after reset. Got: %+v", usage)
+	}
+
+	tracker.Close()
+	bus.Publish(&Event{Type: EventCapacityConsumed, Backend: "dynamodb", Repository: "users", Capacity: &CapacityUsage{ReadUnits: 1}})
+	if usage := tracker.Usage(); len(usage) != 0 {
+		t.Fatalf("Expected no usage after close. Got: %+v", usage)
+	}
+}
+
+func TestMongoReportUsage(t *testing.T) {
+	events := []*Event{}
+	unsubscribe := Events.Subscribe(func(event *Event) {
+		events = append(events, event)
+	}, EventCapacityConsumed)
+	defer unsubscribe()
+
+	(&MongoSession{databaseName: "app", collectionName: "orders"}).reportUsage("GetAll", 3, 0)
+	if len(events) != 0 {
+		t.Fatal("Expected no events without the reportCapacity option. Got: ", events)
+	}
+
+	(&MongoSession{databaseName: "app", collectionName: "orders", reportCapacity: true}).reportUsage("DeleteAll", 2, 2)
+	if len(events) != 1 || events[0].Repository != "orders" || events[0].Capacity.Operation != "DeleteAll" || events[0].Capacity.DocsWritten != 2 {
+		t.Fatalf("Expected the usage of the operation. Got: %+v", events)
+	}
+}
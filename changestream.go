@@ -0,0 +1,73 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Change operations.
+const (
+	// ChangeInsert is a created record.
+	ChangeInsert = "insert"
+	// ChangeUpdate is an updated record.
+	ChangeUpdate = "update"
+	// ChangeDelete is a deleted record.
+	ChangeDelete = "delete"
+)
+
+// ChangeEvent is a change of a record in a repository.
+type ChangeEvent struct {
+	// Operation is ChangeInsert, ChangeUpdate or ChangeDelete.
+	Operation string
+	// Repository is the name of the changed repository.
+	Repository string
+	// Key holds the key properties of the changed record.
+	Key map[string]interface{}
+	// Document is the record after the change, nil for deleted records.
+	Document map[string]interface{}
+	// OldDocument is the record before the change, nil for created records.
+	OldDocument map[string]interface{}
+	// Time is the (approximate) time of the change.
+	Time time.Time
+	// Position is the position of the change in the stream (the sequence number on DynamoDB).
+	Position string
+}
+
+// ChangeHandler handles the change events. If the handler returns an error, watching stops and the
+// events after the last checkpoint are delivered again the next time the repository is watched.
+type ChangeHandler func(event *ChangeEvent) error
+
+// ChangeStreamRepository is implemented by the repositories that can deliver the changes of their records.
+type ChangeStreamRepository interface {
+	// Watch delivers the changes of the records to the handler until the context is done or the handler
+	// returns an error. Returns nil when the context is done.
+	Watch(ctx context.Context, handler ChangeHandler) error
+}
+
+// Watch delivers the changes of the records in the repository to the handler. For example, to index
+// the users in a search engine:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	err := backends.Watch(ctx, usersRepo, func(event *backends.ChangeEvent) error {
+//		return searchIndex.Update(event.Key, event.Document)
+//	})
+//
+// Returns an error if the repository does not support change streams.
+func Watch(ctx context.Context, repo Repository, handler ChangeHandler) error {
+	if r, ok := repo.(ChangeStreamRepository); ok {
+		return r.Watch(ctx, handler)
+	}
+	return ErrInvalidInput(fmt.Sprintf("change streams are not supported on %T", repo))
+}
+
+// Watch delivers the changes of the records in the repository on the primary backend. The standby
+// is a separate cluster with its own stream, so the changes are not followed after a failover.
+func (r *failoverRepository) Watch(ctx context.Context, handler ChangeHandler) error {
+	repository, err := r.backend.primary.GetRepository(r.name)
+	if err != nil {
+		return err
+	}
+	return Watch(ctx, repository, handler)
+}
@@ -0,0 +1,95 @@
+// generate-repositories generates typed repositories from the collection schemas of a backend configuration.
+//
+// Usage:
+// 		generate-repositories -config config.json -output repositories_gen.go
+// 		generate-repositories -config config.yaml -collections users,orders -package models
+// 		generate-repositories -config config.json -output repositories_gen.go -check
+//
+// With go:generate, the package defaults to the package of the file:
+//
+// 		//go:generate go run github.com/Microkubes/backends/cmd/generate-repositories -config config.json -output repositories_gen.go
+//
+// With -check, the code is not written: the command fails if the output file is not up to date with
+// the configuration, to catch schema drift in CI.
+//
+// Exit codes:
+// 		0 - the code was generated (or is up to date)
+// 		1 - the output file is not up to date (-check)
+// 		2 - the configuration could not be read, or the code could not be generated
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Microkubes/backends"
+)
+
+const (
+	exitGenerated = 0
+	exitOutdated  = 1
+	exitError     = 2
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "Path to the JSON or YAML configuration file")
+	output := flag.String("output", "", "Path to the generated file. Prints the code if not set")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "Package of the generated code")
+	collections := flag.String("collections", "", "Comma-separated collections to generate. All collections with a schema if not set")
+	check := flag.Bool("check", false, "Fail if the output file is not up to date, instead of writing it")
+	flag.Parse()
+
+	code, err := generate(*configFile, *pkg, *collections)
+	if err != nil {
+		fail(err)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(code)
+		os.Exit(exitGenerated)
+	}
+	if *check {
+		current, err := ioutil.ReadFile(*output)
+		if err != nil && !os.IsNotExist(err) {
+			fail(err)
+		}
+		if !bytes.Equal(current, code) {
+			fmt.Fprintf(os.Stderr, "%s is not up to date with %s\n", *output, *configFile)
+			os.Exit(exitOutdated)
+		}
+		os.Exit(exitGenerated)
+	}
+	if err := ioutil.WriteFile(*output, code, 0644); err != nil {
+		fail(err)
+	}
+	os.Exit(exitGenerated)
+}
+
+func generate(configFile, pkg, collections string) ([]byte, error) {
+	config, err := backends.ParseAndValidateFile(configFile, backends.NewBackendSupport(nil))
+	if err != nil {
+		return nil, err
+	}
+	options := backends.GenerateOptions{
+		Package: pkg,
+		Source:  filepath.Base(configFile),
+	}
+	if collections != "" {
+		options.Collections = strings.Split(collections, ",")
+	}
+	return backends.GenerateRepositories(config, options)
+}
+
+func fail(err error) {
+	if details, ok := err.(interface{ Details() string }); ok {
+		fmt.Fprintln(os.Stderr, err.Error()+": "+details.Details())
+	} else {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	os.Exit(exitError)
+}
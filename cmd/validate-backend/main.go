@@ -0,0 +1,98 @@
+// validate-backend validates a backend configuration file and prints the result as JSON.
+//
+// Usage:
+// 		validate-backend -config config.json
+// 		validate-backend -config config.json -schema schema.json
+// 		validate-backend -print-schema mongodb
+//
+// With -schema, the configuration is validated against the given JSON Schema (draft-07) file
+// instead of the schema of the configured backend. With -print-schema, the schema of the backend
+// is printed as JSON Schema, to be used by external tools.
+//
+// Exit codes:
+// 		0 - the configuration is valid
+// 		1 - the configuration is invalid
+// 		2 - the configuration could not be read or parsed
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Microkubes/backends"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+type errorOutput struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+func main() {
+	configFile := flag.String("config", "config.json", "Path to the JSON configuration file")
+	schemaFile := flag.String("schema", "", "Path to a JSON Schema file to validate against")
+	printSchema := flag.String("print-schema", "", "Print the JSON Schema of the given backend and exit")
+	flag.Parse()
+
+	manager := backends.NewBackendSupport(nil)
+
+	if *printSchema != "" {
+		schema, err := manager.GetRequiredBackendProperties(*printSchema)
+		if err != nil {
+			printJSON(&errorOutput{
+				Valid: false,
+				Error: err.Error(),
+			})
+			os.Exit(exitError)
+		}
+		printJSON(backends.ToJSONSchema(schema))
+		os.Exit(exitValid)
+	}
+
+	result, err := validate(*configFile, *schemaFile, manager)
+	if err != nil {
+		printJSON(&errorOutput{
+			Valid: false,
+			Error: err.Error(),
+		})
+		os.Exit(exitError)
+	}
+
+	printJSON(result)
+	if !result.Valid {
+		os.Exit(exitInvalid)
+	}
+	os.Exit(exitValid)
+}
+
+func validate(configFile, schemaFile string, manager backends.BackendManager) (*backends.ValidationResult, error) {
+	if schemaFile == "" {
+		return backends.ValidateConfigFile(configFile, manager)
+	}
+	schema, err := backends.LoadJSONSchema(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return backends.ValidateConfigWithSchema(data, schema)
+}
+
+func printJSON(value interface{}) {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(exitError)
+	}
+	fmt.Println(string(out))
+}
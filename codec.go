@@ -0,0 +1,1020 @@
+package backends
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The codec maps records (maps of properties) to structs and back without marshalling through JSON.
+// The metadata of the struct types is resolved once and cached. The decoding follows the rules of
+// encoding/json: the properties are matched to the JSON names of the fields (case-insensitively if there
+// is no exact match), values that do not fit a field are skipped, and values decoded into interface{} are
+// converted to the JSON types (map[string]interface{}, []interface{}, float64, string, bool). The records
+// are also read back the way InterfaceToMap stores them: the properties are matched to the bson names and
+// to the fields of inline structs, the other properties go to the inline map, and the fields tagged with
+// "-" are not decoded.
+
+// codecField is the metadata of a struct field.
+type codecField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	// excluded is set on the JSON fields that are not stored in the records under their name: the fields
+	// tagged with "-", and the inline fields, the properties of which are stored at the top level.
+	excluded bool
+}
+
+// codecStruct is the cached metadata of a struct type.
+type codecStruct struct {
+	// keys are the fields with the property names used by InterfaceToMap, including the fields of
+	// inline and embedded structs.
+	keys []*codecField
+	// inlineMap is the index of the inline map field, the properties of which are added to the document.
+	inlineMap []int
+	// fields are the fields visible to JSON, including the fields of embedded structs.
+	fields []*codecField
+	byName map[string]*codecField
+	// byKey are the fields by the property names used by InterfaceToMap.
+	byKey map[string]*codecField
+	// byFold are the fields by their folded names (see foldName), to read back the properties stored
+	// with any naming strategy.
+	byFold map[string]*codecField
+}
+
+// codecKey is the key of the cached metadata: the struct type and the naming strategy of its fields.
+type codecKey struct {
+	t      reflect.Type
+	naming string
+}
+
+var codecStructs sync.Map
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	objectIDType        = reflect.TypeOf(bson.ObjectId(""))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	bsonGetterType      = reflect.TypeOf((*bson.Getter)(nil)).Elem()
+	binaryType          = reflect.TypeOf(bson.Binary{})
+	genericMapType      = reflect.TypeOf(map[string]interface{}{})
+)
+
+// structCodec returns the cached metadata of the struct type, with the default naming strategy.
+func structCodec(t reflect.Type) *codecStruct {
+	return namedStructCodec(t, FieldNamingLowercase)
+}
+
+// namedStructCodec returns the cached metadata of the struct type, with the naming strategy of the
+// fields without a bson or json name.
+func namedStructCodec(t reflect.Type, naming string) *codecStruct {
+	if naming == "" {
+		naming = FieldNamingLowercase
+	}
+	key := codecKey{t: t, naming: naming}
+	if cached, ok := codecStructs.Load(key); ok {
+		return cached.(*codecStruct)
+	}
+	info := &codecStruct{
+		byName: map[string]*codecField{},
+		byKey:  map[string]*codecField{},
+		byFold: map[string]*codecField{},
+	}
+	info.keys, info.inlineMap = documentFields(t, naming)
+	for _, field := range info.keys {
+		info.byKey[field.name] = field
+		info.byFold[foldName(field.name)] = field
+	}
+	info.fields = jsonFields(t)
+	for _, field := range info.fields {
+		name, options := fieldTag(t.FieldByIndex(field.index))
+		if name == "-" || strings.Contains(","+options+",", ",inline,") {
+			field.excluded = true
+		}
+		info.byName[field.name] = field
+		if _, ok := info.byFold[foldName(field.name)]; !ok && !field.excluded {
+			info.byFold[foldName(field.name)] = field
+		}
+	}
+	cached, _ := codecStructs.LoadOrStore(key, info)
+	return cached.(*codecStruct)
+}
+
+// documentFields returns the fields of the struct type as InterfaceToMap stores them: exported fields by
+// their bson (or json) name, or the field name with the naming strategy. The fields of embedded structs without a name and
+// of the fields tagged with ",inline" are promoted, unless a field with the same name is closer to the top.
+func documentFields(t reflect.Type, naming string) ([]*codecField, []int) {
+	type candidate struct {
+		field *codecField
+		depth int
+	}
+	candidates := []candidate{}
+	var inlineMap []int
+
+	var walk func(t reflect.Type, index []int, depth int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, depth int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			name, options := fieldTag(field)
+			if name == "-" {
+				continue
+			}
+			fieldIndex := append(append([]int{}, index...), i)
+
+			inline := strings.Contains(","+options+",", ",inline,") || field.Anonymous && name == ""
+			switch {
+			case inline && fieldType.Kind() == reflect.Struct && fieldType != timeType:
+				walk(fieldType, fieldIndex, depth+1, visited)
+				continue
+			case inline && fieldType.Kind() == reflect.Map && fieldType.Key().Kind() == reflect.String && field.PkgPath == "":
+				if inlineMap == nil {
+					inlineMap = fieldIndex
+				}
+				continue
+			case field.PkgPath != "":
+				continue
+			}
+
+			if name == "" {
+				name = fieldNameOf(field.Name, naming)
+			}
+			candidates = append(candidates, candidate{
+				field: &codecField{
+					index:     fieldIndex,
+					name:      name,
+					omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+				},
+				depth: depth,
+			})
+		}
+	}
+	walk(t, nil, 0, map[reflect.Type]bool{})
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].depth < candidates[j].depth
+	})
+	fields := []*codecField{}
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if !seen[c.field.name] {
+			seen[c.field.name] = true
+			fields = append(fields, c.field)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return lessIndex(fields[i].index, fields[j].index)
+	})
+	return fields, inlineMap
+}
+
+// jsonFields returns the fields of the struct type as encoding/json sees them: exported fields by their JSON
+// name, with the fields of embedded structs promoted. A name at a lower depth hides the deeper ones, and
+// names that are ambiguous at the same depth are dropped.
+func jsonFields(t reflect.Type) []*codecField {
+	type candidate struct {
+		field  *codecField
+		depth  int
+		tagged bool
+	}
+	candidates := map[string][]candidate{}
+	order := []string{}
+
+	var walk func(t reflect.Type, index []int, depth int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, depth int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous {
+				if field.PkgPath != "" && fieldType.Kind() != reflect.Struct {
+					continue
+				}
+			} else if field.PkgPath != "" {
+				continue
+			}
+
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := tag
+			options := ""
+			if comma := strings.Index(tag, ","); comma >= 0 {
+				name, options = tag[:comma], tag[comma+1:]
+			}
+
+			fieldIndex := append(append([]int{}, index...), i)
+			if name == "" && field.Anonymous && fieldType.Kind() == reflect.Struct {
+				walk(fieldType, fieldIndex, depth+1, visited)
+				continue
+			}
+
+			tagged := name != ""
+			if !tagged {
+				name = field.Name
+			}
+			if _, ok := candidates[name]; !ok {
+				order = append(order, name)
+			}
+			candidates[name] = append(candidates[name], candidate{
+				field: &codecField{
+					index:     fieldIndex,
+					name:      name,
+					omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+				},
+				depth:  depth,
+				tagged: tagged,
+			})
+		}
+	}
+	walk(t, nil, 0, map[reflect.Type]bool{})
+
+	fields := []*codecField{}
+	for _, name := range order {
+		dominant := []candidate{}
+		for _, c := range candidates[name] {
+			if len(dominant) == 0 || c.depth < dominant[0].depth {
+				dominant = []candidate{c}
+			} else if c.depth == dominant[0].depth {
+				dominant = append(dominant, c)
+			}
+		}
+		if len(dominant) > 1 {
+			tagged := []candidate{}
+			for _, c := range dominant {
+				if c.tagged {
+					tagged = append(tagged, c)
+				}
+			}
+			dominant = tagged
+		}
+		if len(dominant) == 1 {
+			fields = append(fields, dominant[0].field)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return lessIndex(fields[i].index, fields[j].index)
+	})
+	return fields
+}
+
+func lessIndex(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// lookup returns the field for the property name: by the JSON name, by the name InterfaceToMap stores
+// the field with (bson tags and inline structs), by the JSON name matched case-insensitively, or by the
+// folded name, which matches the names of all naming strategies. The excluded fields are not matched
+// by their JSON names.
+func (s *codecStruct) lookup(name string) *codecField {
+	if field, ok := s.byName[name]; ok && !field.excluded {
+		return field
+	}
+	if field, ok := s.byKey[name]; ok {
+		return field
+	}
+	for _, field := range s.fields {
+		if !field.excluded && strings.EqualFold(field.name, name) {
+			return field
+		}
+	}
+	return s.byFold[foldName(name)]
+}
+
+// decodeValue decodes the value into dst, as json.Unmarshal of the JSON encoding of the value would.
+// Values that do not fit dst are skipped. Returns an error only if the value cannot be encoded.
+func decodeValue(value interface{}, dst reflect.Value) error {
+	if value == nil {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+	if dst.Type() == genericMapType {
+		if record, ok := genericRecord(value); ok {
+			return decodeGenericMap(record, dst)
+		}
+	}
+	src := reflect.ValueOf(value)
+	for src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface {
+		if src.IsNil() {
+			return decodeValue(nil, dst)
+		}
+		if src.Kind() == reflect.Ptr && implementsMarshaler(src.Type()) && !implementsMarshaler(src.Type().Elem()) &&
+			!isDecimalType(src.Type().Elem()) {
+			break
+		}
+		src = src.Elem()
+	}
+	if src.Kind() == reflect.Ptr {
+		// a pointer implementing json.Marshaler
+		return decodeJSON(src.Interface(), dst)
+	}
+	if (src.Kind() == reflect.Map || src.Kind() == reflect.Slice) && src.IsNil() && !implementsMarshaler(src.Type()) {
+		// encoded as null
+		return decodeValue(nil, dst)
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if !dst.IsNil() && dst.Elem().Kind() == reflect.Ptr && !dst.Elem().IsNil() {
+			return decodeValue(src.Interface(), dst.Elem().Elem())
+		}
+		if dst.NumMethod() != 0 {
+			return nil
+		}
+		generic, err := genericOf(src.Interface())
+		if err != nil {
+			return err
+		}
+		if generic == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(generic))
+		}
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(src.Interface(), dst.Elem())
+	}
+
+	switch dst.Type() {
+	case timeType:
+		return decodeTime(src, dst)
+	case objectIDType:
+		return decodeObjectID(src, dst)
+	}
+	if isDecimalType(dst.Type()) {
+		return decodeDecimal(src, dst)
+	}
+	if reflect.PtrTo(dst.Type()).Implements(jsonUnmarshalerType) || reflect.PtrTo(dst.Type()).Implements(textUnmarshalerType) {
+		return decodeJSON(src.Interface(), dst)
+	}
+	if implementsMarshaler(src.Type()) && src.Type() != timeType && src.Type() != objectIDType && !isDecimalType(src.Type()) {
+		return decodeJSON(src.Interface(), dst)
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		return decodeStruct(src, dst)
+	case reflect.Map:
+		return decodeMap(src, dst)
+	case reflect.Slice:
+		return decodeSlice(src, dst)
+	case reflect.Array:
+		return decodeJSON(src.Interface(), dst)
+	case reflect.String:
+		if s, ok := genericString(src); ok {
+			dst.SetString(s)
+		}
+	case reflect.Bool:
+		if src.Kind() == reflect.Bool {
+			dst.SetBool(src.Bool())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := intValue(src); ok && !dst.OverflowInt(i) {
+			dst.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u, ok := uintValue(src); ok && !dst.OverflowUint(u) {
+			dst.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := numberValue(src); ok && !dst.OverflowFloat(f) {
+			dst.SetFloat(f)
+		}
+	}
+	return nil
+}
+
+func decodeStruct(src, dst reflect.Value) error {
+	if src.Kind() == reflect.Struct {
+		src = reflect.ValueOf(structValues(src))
+	}
+	if src.Kind() != reflect.Map || src.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	info := structCodec(dst.Type())
+
+	// the properties are decoded in the order of the JSON encoding of the map
+	keys := src.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	var inline reflect.Value
+	for _, key := range keys {
+		field := info.lookup(key.String())
+		if field == nil {
+			if info.inlineMap == nil {
+				continue
+			}
+			// the other properties are decoded into the inline map
+			if !inline.IsValid() {
+				target, ok := fieldByIndex(dst, info.inlineMap)
+				if !ok {
+					continue
+				}
+				if target.IsNil() {
+					target.Set(reflect.MakeMap(target.Type()))
+				}
+				inline = target
+			}
+			elem := reflect.New(inline.Type().Elem()).Elem()
+			if err := decodeValue(src.MapIndex(key).Interface(), elem); err != nil {
+				return err
+			}
+			inline.SetMapIndex(reflect.ValueOf(key.String()).Convert(inline.Type().Key()), elem)
+			continue
+		}
+		target, ok := fieldByIndex(dst, field.index)
+		if !ok {
+			continue
+		}
+		if err := decodeValue(src.MapIndex(key).Interface(), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the (nested) field, allocating the nil pointers to embedded structs.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+func decodeMap(src, dst reflect.Value) error {
+	if src.Kind() == reflect.Struct {
+		src = reflect.ValueOf(structValues(src))
+	}
+	if src.Kind() != reflect.Map {
+		return nil
+	}
+	if src.Type().Key().Kind() != reflect.String || dst.Type().Key().Kind() != reflect.String {
+		return decodeJSON(src.Interface(), dst)
+	}
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+	}
+	elemType := dst.Type().Elem()
+	for _, key := range src.MapKeys() {
+		elem := reflect.New(elemType).Elem()
+		if err := decodeValue(src.MapIndex(key).Interface(), elem); err != nil {
+			return err
+		}
+		dst.SetMapIndex(reflect.ValueOf(key.String()).Convert(dst.Type().Key()), elem)
+	}
+	return nil
+}
+
+func decodeSlice(src, dst reflect.Value) error {
+	if dst.Type().Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(dst.Type().Elem()).Implements(jsonUnmarshalerType) {
+		// []byte is encoded as a base64 string
+		switch {
+		case src.Kind() == reflect.String:
+			b, err := base64.StdEncoding.DecodeString(src.String())
+			if err == nil {
+				dst.SetBytes(b)
+			}
+			return nil
+		case src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes(append([]byte{}, src.Bytes()...))
+			return nil
+		case src.Type() == binaryType:
+			dst.SetBytes(append([]byte{}, src.Interface().(bson.Binary).Data...))
+			return nil
+		}
+	}
+	if src.Kind() != reflect.Slice && src.Kind() != reflect.Array {
+		return nil
+	}
+	if src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8 {
+		// a []byte source is a base64 string in JSON
+		return nil
+	}
+	result := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+	for i := 0; i < src.Len(); i++ {
+		if err := decodeValue(src.Index(i).Interface(), result.Index(i)); err != nil {
+			return err
+		}
+	}
+	dst.Set(result)
+	return nil
+}
+
+// decodeTime decodes a time.Time, an RFC3339 string or an epoch time in seconds (the format of the
+// DynamoDB TTL attributes).
+func decodeTime(src, dst reflect.Value) error {
+	value := src.Interface()
+	if seconds, ok := intValue(src); ok {
+		value = seconds
+	} else if src.Kind() == reflect.String {
+		value = src.String()
+	}
+	if t, ok := asTime(value); ok {
+		dst.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+func decodeObjectID(src, dst reflect.Value) error {
+	if src.Kind() != reflect.String {
+		return nil
+	}
+	if id, ok := src.Interface().(bson.ObjectId); ok {
+		dst.Set(reflect.ValueOf(id))
+		return nil
+	}
+	if s := src.String(); s == "" || bson.IsObjectIdHex(s) {
+		dst.Set(reflect.ValueOf(bson.ObjectIdHex(s)))
+	}
+	return nil
+}
+
+// decodeJSON decodes the value through its JSON encoding. It is used for the types with custom JSON encoding.
+func decodeJSON(value interface{}, dst reflect.Value) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	json.Unmarshal(data, dst.Addr().Interface())
+	return nil
+}
+
+func implementsMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// genericValue converts the value to the value json.Unmarshal would decode its JSON encoding to in interface{}.
+func genericValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if y := t.Year(); y < 0 || y >= 10000 {
+			return nil, fmt.Errorf("time %v has a year outside of range [0,9999]", t)
+		}
+		return t.Format(time.RFC3339Nano), nil
+	}
+	if v.Type() == objectIDType {
+		return v.Interface().(bson.ObjectId).Hex(), nil
+	}
+	if text, ok := exactNumberText(v); ok {
+		return genericNumber(text), nil
+	}
+	if v.Type() == binaryType {
+		return append([]byte{}, v.Interface().(bson.Binary).Data...), nil
+	}
+	if implementsMarshaler(v.Type()) {
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		json.Unmarshal(data, &generic)
+		return generic, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return genericValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		f, _ := numberValue(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("unsupported value: %v", f)
+		}
+		return f, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return genericJSON(v.Interface())
+		}
+		result := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			value, err := genericValue(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			result[key.String()] = value
+		}
+		return result, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && !implementsMarshaler(v.Type().Elem()) {
+			// the bytes are kept, not encoded to base64
+			return append([]byte{}, v.Bytes()...), nil
+		}
+		fallthrough
+	case reflect.Array:
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, err := genericValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case reflect.Struct:
+		info := structCodec(v.Type())
+		result := make(map[string]interface{}, len(info.fields))
+		for _, field := range info.fields {
+			fv, ok := fieldValue(v, field.index)
+			if !ok || field.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			value, err := genericValue(fv)
+			if err != nil {
+				return nil, err
+			}
+			result[field.name] = value
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %s", v.Type())
+}
+
+// genericOf is genericValue with a fast path for the values of the records read into maps (maps, slices,
+// strings, numbers and booleans), which are converted without reflection.
+func genericOf(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	case bool:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("unsupported value: %v", v)
+		}
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case json.Number:
+		return v, nil
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		return append([]byte{}, v...), nil
+	case []interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			generic, err := genericOf(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = generic
+		}
+		return result, nil
+	}
+	if record, ok := genericRecord(value); ok {
+		if record == nil {
+			return nil, nil
+		}
+		result := make(map[string]interface{}, len(record))
+		for key, item := range record {
+			generic, err := genericOf(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = generic
+		}
+		return result, nil
+	}
+	return genericValue(reflect.ValueOf(value))
+}
+
+// genericRecord returns the value as map[string]interface{} if it is a record: a map[string]interface{},
+// a bson.M (the nested documents read from MongoDB), or a pointer to one of them.
+func genericRecord(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case bson.M:
+		return v, true
+	case *map[string]interface{}:
+		if v != nil {
+			return *v, true
+		}
+	case *bson.M:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return nil, false
+}
+
+// decodeGenericMap is the fast path of decodeMap for decoding a record into map[string]interface{}.
+func decodeGenericMap(record map[string]interface{}, dst reflect.Value) error {
+	if record == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.IsNil() {
+		dst.Set(reflect.ValueOf(make(map[string]interface{}, len(record))))
+	}
+	result := dst.Interface().(map[string]interface{})
+	for key, value := range record {
+		generic, err := genericOf(value)
+		if err != nil {
+			return err
+		}
+		result[key] = generic
+	}
+	return nil
+}
+
+// genericJSON converts the value through its JSON encoding.
+func genericJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	json.Unmarshal(data, &generic)
+	return generic, nil
+}
+
+// structValues returns the values of the JSON-visible fields of the struct by their JSON names. Unlike
+// genericValue, the values keep their types, so they are decoded without loss of precision.
+func structValues(v reflect.Value) map[string]interface{} {
+	info := structCodec(v.Type())
+	values := make(map[string]interface{}, len(info.fields))
+	for _, field := range info.fields {
+		fv, ok := fieldValue(v, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		values[field.name] = fv.Interface()
+	}
+	return values
+}
+
+// structDocument converts the struct to the document stored by InterfaceToMap, with the naming strategy
+// of the fields.
+func structDocument(v reflect.Value, naming string) map[string]interface{} {
+	info := namedStructCodec(v.Type(), naming)
+	document := make(map[string]interface{}, len(info.keys))
+	if info.inlineMap != nil {
+		if inline, ok := fieldValue(v, info.inlineMap); ok {
+			for _, key := range inline.MapKeys() {
+				document[key.String()] = documentValue(inline.MapIndex(key), naming)
+			}
+		}
+	}
+	for _, field := range info.keys {
+		fv, ok := fieldValue(v, field.index)
+		if !ok || field.omitEmpty && (isEmptyValue(fv) || fv.Kind() == reflect.Struct && fv.IsZero()) {
+			continue
+		}
+		document[field.name] = documentValue(fv, naming)
+	}
+	return document
+}
+
+// documentValue returns the value as it is stored in a document. Nested structs are converted to documents,
+// also in pointers, slices and maps. Other values, and the types with a custom encoding, are kept as they are.
+func documentValue(v reflect.Value, naming string) interface{} {
+	if !isDocumentType(v.Type()) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		return documentValue(v.Elem(), naming)
+	case reflect.Struct:
+		return structDocument(v, naming)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v.Interface()
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = documentValue(v.Index(i), naming)
+		}
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		values := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			values[key.String()] = documentValue(v.MapIndex(key), naming)
+		}
+		return values
+	}
+	return v.Interface()
+}
+
+// isDocumentType checks if the values of the type may hold structs that are converted to documents.
+func isDocumentType(t reflect.Type) bool {
+	if t == timeType || implementsMarshaler(t) || t.Implements(bsonGetterType) || isDecimalType(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Struct:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return isDocumentType(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && isDocumentType(t.Elem())
+	}
+	return false
+}
+
+// fieldValue returns the (nested) field. Returns false if an embedded struct pointer is nil.
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func genericString(v reflect.Value) (string, bool) {
+	switch {
+	case v.Type() == timeType:
+		generic, err := genericValue(v)
+		if err != nil {
+			return "", false
+		}
+		return generic.(string), true
+	case v.Type() == objectIDType:
+		return v.Interface().(bson.ObjectId).Hex(), true
+	case v.Kind() == reflect.String:
+		return v.String(), true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return base64.StdEncoding.EncodeToString(v.Bytes()), true
+	}
+	return "", false
+}
+
+func numberValue(v reflect.Value) (float64, bool) {
+	switch {
+	case isIntKind(v.Kind()):
+		return float64(v.Int()), true
+	case isUintKind(v.Kind()):
+		return float64(v.Uint()), true
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float(), true
+	case v.Kind() == reflect.String || v.Kind() == reflect.Struct:
+		return exactNumberValue(v)
+	}
+	return 0, false
+}
+
+// intValue returns the integer value of an integer, or of a float without a fraction.
+func intValue(v reflect.Value) (int64, bool) {
+	switch {
+	case isIntKind(v.Kind()):
+		return v.Int(), true
+	case isUintKind(v.Kind()):
+		return int64(v.Uint()), v.Uint() <= math.MaxInt64
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		f := v.Float()
+		return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	case v.Kind() == reflect.String || v.Kind() == reflect.Struct:
+		if text, ok := exactNumberText(v); ok {
+			i, err := strconv.ParseInt(text, 10, 64)
+			return i, err == nil
+		}
+	}
+	return 0, false
+}
+
+// uintValue returns the value of a non-negative integer, or of a non-negative float without a fraction.
+func uintValue(v reflect.Value) (uint64, bool) {
+	switch {
+	case isIntKind(v.Kind()):
+		return uint64(v.Int()), v.Int() >= 0
+	case isUintKind(v.Kind()):
+		return v.Uint(), true
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		f := v.Float()
+		return uint64(f), f == math.Trunc(f) && f >= 0 && f < math.MaxUint64
+	case v.Kind() == reflect.String || v.Kind() == reflect.Struct:
+		if text, ok := exactNumberText(v); ok {
+			u, err := strconv.ParseUint(text, 10, 64)
+			return u, err == nil
+		}
+	}
+	return 0, false
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// isEmptyValue reports whether the value is empty for the omitempty option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
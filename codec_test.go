@@ -0,0 +1,304 @@
+package backends
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type codecBase struct {
+	ID      string `json:"id"`
+	Version int    `json:"version,omitempty"`
+}
+
+type codecAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type codecCustomer struct {
+	codecBase
+	Name      string            `json:"name"`
+	Email     *string           `json:"email,omitempty"`
+	Balance   float64           `json:"balance"`
+	Orders    uint              `json:"orders"`
+	Active    bool              `json:"active"`
+	Tags      []string          `json:"tags,omitempty"`
+	Avatar    []byte            `json:"avatar,omitempty"`
+	Address   *codecAddress     `json:"address,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Extra     interface{}       `json:"extra,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Owner     bson.ObjectId     `json:"owner,omitempty"`
+	Ignored   string            `json:"-"`
+	internal  string
+}
+
+// jsonRoundTrip maps the value the way MapToInterface did before the codecs.
+func jsonRoundTrip(t *testing.T, value interface{}, result interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, result); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapToInterfaceMatchesJSON(t *testing.T) {
+	email := "john@example.com"
+	customer := &codecCustomer{
+		codecBase: codecBase{ID: "c1", Version: 3},
+		Name:      "John",
+		Email:     &email,
+		Balance:   12.5,
+		Orders:    7,
+		Active:    true,
+		Tags:      []string{"vip"},
+		Avatar:    []byte{1, 2, 3},
+		Address:   &codecAddress{City: "Skopje"},
+		Labels:    map[string]string{"tier": "gold"},
+		Extra:     map[string]interface{}{"score": 10},
+		CreatedAt: time.Date(2019, 5, 1, 10, 30, 0, 123, time.UTC),
+		Owner:     bson.ObjectIdHex("5975c461f9f8eb02aae053f3"),
+		Ignored:   "ignored",
+		internal:  "internal",
+	}
+
+	records := []interface{}{
+		customer,
+		map[string]interface{}{
+			"id":        "c2",
+			"NAME":      "Jane",
+			"balance":   10,
+			"orders":    int64(2),
+			"tags":      []interface{}{"a", "b"},
+			"avatar":    "AQID",
+			"address":   map[string]interface{}{"city": "Ohrid", "unknown": true},
+			"createdAt": "2019-05-01T10:30:00Z",
+			"owner":     "5975c461f9f8eb02aae053f3",
+			"extra":     []interface{}{1, "x", nil},
+			"Ignored":   "ignored",
+		},
+		map[string]interface{}{"id": nil, "tags": nil, "address": nil, "labels": map[string]interface{}{}},
+	}
+
+	for _, record := range records {
+		expected := &codecCustomer{}
+		jsonRoundTrip(t, record, expected)
+		result := &codecCustomer{}
+		if err := MapToInterface(record, result); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+
+		var expectedGeneric interface{}
+		jsonRoundTrip(t, record, &expectedGeneric)
+		if record == customer {
+			// the bytes are kept, not encoded to base64
+			expectedGeneric.(map[string]interface{})["avatar"] = []byte{1, 2, 3}
+		}
+		var generic interface{}
+		if err := MapToInterface(record, &generic); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expectedGeneric, generic) {
+			t.Fatalf("Expected %v, got %v", expectedGeneric, generic)
+		}
+	}
+}
+
+func TestMapToInterfaceTypedNil(t *testing.T) {
+	entry := struct {
+		After map[string]interface{} `json:"after"`
+	}{}
+	if err := MapToInterface(map[string]interface{}{"after": map[string]interface{}(nil)}, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.After != nil {
+		t.Fatalf("Expected a nil map, got %v", entry.After)
+	}
+}
+
+func TestInterfaceToMapSkipsUnexported(t *testing.T) {
+	result, err := InterfaceToMap(&codecCustomer{Name: "John", internal: "internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*result)["name"] != "John" {
+		t.Fatalf("Expected the name, got %v", *result)
+	}
+	if _, ok := (*result)["internal"]; ok {
+		t.Fatal("Expected the unexported field to be skipped")
+	}
+}
+
+func BenchmarkMapToInterface(b *testing.B) {
+	record := map[string]interface{}{
+		"id":        "c1",
+		"name":      "John",
+		"balance":   12.5,
+		"tags":      []interface{}{"a", "b"},
+		"address":   map[string]interface{}{"city": "Skopje"},
+		"createdAt": "2019-05-01T10:30:00Z",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := MapToInterface(record, &codecCustomer{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type codecEvent struct {
+	ID        int64         `json:"id"`
+	Sequence  uint64        `json:"sequence"`
+	At        time.Time     `json:"at"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	Nested    *codecEvent   `json:"nested,omitempty"`
+	History   []*codecEvent `json:"history,omitempty"`
+}
+
+func TestMapToInterfacePreservesTypes(t *testing.T) {
+	at := time.Date(2019, 5, 1, 10, 30, 0, 123456789, time.UTC)
+	event := &codecEvent{
+		ID:       math.MaxInt64 - 1,
+		Sequence: math.MaxUint64 - 1,
+		At:       at,
+		Nested:   &codecEvent{ID: 1<<53 + 1, At: at},
+		History:  []*codecEvent{{ID: 1<<60 + 3}},
+	}
+
+	record, err := InterfaceToMap(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &codecEvent{}
+	if err := MapToInterface(record, result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event, result) {
+		t.Fatalf("Expected %+v, got %+v", event, result)
+	}
+
+	// as read from DynamoDB
+	result = &codecEvent{}
+	err = MapToInterface(map[string]interface{}{
+		"id":        int64(1<<53 + 1),
+		"at":        "2019-05-01T10:30:00.123456789Z",
+		"expiresAt": int64(1556706600),
+	}, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != 1<<53+1 || !result.At.Equal(at) || result.ExpiresAt.Unix() != 1556706600 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+}
+
+// benchmarkRecord is a record as read from the database into a map.
+func benchmarkRecord() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        "c1",
+		"name":      "John",
+		"balance":   12.5,
+		"orders":    3,
+		"active":    true,
+		"tags":      []interface{}{"a", "b", "c"},
+		"address":   map[string]interface{}{"city": "Skopje", "zip": "1000"},
+		"createdAt": "2019-05-01T10:30:00Z",
+	}
+}
+
+func BenchmarkMapToInterfaceMap(b *testing.B) {
+	record := benchmarkRecord()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := MapToInterface(&record, &map[string]interface{}{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInterfaceToMapStruct(b *testing.B) {
+	email := "john@example.com"
+	customer := &codecCustomer{
+		Name:      "John",
+		Email:     &email,
+		Balance:   12.5,
+		Tags:      []string{"a", "b"},
+		Address:   &codecAddress{City: "Skopje"},
+		CreatedAt: time.Now(),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := InterfaceToMap(customer); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInterfaceToMapMap(b *testing.B) {
+	record := benchmarkRecord()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := InterfaceToMap(&record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMapToInterfaceMapFastPath(t *testing.T) {
+	at := time.Date(2019, 5, 1, 10, 30, 0, 0, time.UTC)
+	record := map[string]interface{}{
+		"count":   int64(3),
+		"at":      at,
+		"owner":   bson.M{"id": bson.ObjectIdHex("5cc9c8a7e8a2c61f4c1b2a3d"), "age": 30},
+		"tags":    []interface{}{"a", int32(1), nil},
+		"missing": nil,
+	}
+	result := map[string]interface{}{}
+	if err := MapToInterface(&record, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	// as decoded from the JSON encoding
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{}
+	json.Unmarshal(data, &expected)
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %v, got %v", expected, result)
+	}
+}
+
+// TestMappingAllocationBudget guards the fast paths for the records read into maps: a regression to the
+// reflection or JSON paths exceeds the budgets.
+func TestMappingAllocationBudget(t *testing.T) {
+	record := benchmarkRecord()
+	budgets := []struct {
+		name   string
+		budget float64
+		run    func()
+	}{
+		{"InterfaceToMap(map)", 0, func() {
+			InterfaceToMap(&record)
+		}},
+		{"MapToInterface(map, map)", 20, func() {
+			MapToInterface(&record, &map[string]interface{}{})
+		}},
+	}
+	for _, b := range budgets {
+		if allocs := testing.AllocsPerRun(100, b.run); allocs > b.budget {
+			t.Errorf("%s: %v allocations, the budget is %v", b.name, allocs, b.budget)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package backends
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GenerateOptions are the options of GenerateRepositories.
+type GenerateOptions struct {
+	// Package is the name of the package of the generated code.
+	Package string
+	// Collections are the names of the collections to generate. By default, all collections with a schema.
+	Collections []string
+	// Source is the name of the configuration file, mentioned in the header of the generated code.
+	Source string
+}
+
+// generatedField is a field of a generated record.
+type generatedField struct {
+	Name     string
+	Property string
+	// Type is the Go type of the field, Convert the helper converting a record value to it.
+	Type     string
+	Convert  string
+	Required bool
+	Scalar   bool
+}
+
+// GenerateRepositories generates the Go code of typed repositories for the collections of the configuration,
+// from the document schemas of the collections (see GetSchema). For every collection, for example "users",
+// it generates:
+//
+//	UsersRecord        the record struct, with ToMap and UsersRecordFromMap
+//	UsersFilter        the filter, with a method per filterable field of a scalar type
+//	UsersRepository    the repository with GetOne, GetAll, Save, DeleteOne and DeleteAll on the typed records
+//
+// The records are converted to and from maps by the generated code, without reflection. The filters have
+// methods only for the declared fields, so a field removed from the schema fails the build of the code
+// that filters by it.
+func GenerateRepositories(config *BackendConfig, options GenerateOptions) ([]byte, error) {
+	if options.Package == "" {
+		return nil, ErrInvalidInput("the package of the generated code is required")
+	}
+	names := options.Collections
+	if len(names) == 0 {
+		for name, collection := range config.Collections {
+			if collection != nil && collection.Schema != nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return nil, ErrInvalidInput("no collection with a schema to generate")
+	}
+
+	out := &bytes.Buffer{}
+	header := "// Code generated by generate-repositories. DO NOT EDIT.\n"
+	if options.Source != "" {
+		header = fmt.Sprintf("// Code generated by generate-repositories from %s. DO NOT EDIT.\n", options.Source)
+	}
+	out.WriteString(header)
+	fmt.Fprintf(out, "\npackage %s\n\nimport (\n\t\"fmt\"\n\t\"time\"\n\n\t\"github.com/Microkubes/backends\"\n)\n", options.Package)
+
+	for _, name := range names {
+		collection, ok := config.Collections[name]
+		if !ok || collection == nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("collection %s is not configured", name))
+		}
+		if collection.Schema == nil || collection.Schema.Type != "object" {
+			return nil, ErrInvalidInput(fmt.Sprintf("collection %s has no object schema", name))
+		}
+		fields, err := generatedFields(collection.Schema)
+		if err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("collection %s: %s", name, err.Error()))
+		}
+		generateRepository(out, name, fields, collection.FilterableFields)
+	}
+	out.WriteString(generatedHelpers)
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, ErrBackendError(fmt.Sprintf("failed to format the generated code: %s", err.Error()))
+	}
+	return source, nil
+}
+
+// generatedFields returns the fields of the record with the schema, sorted by property name. The id field
+// is added if the schema does not declare it.
+func generatedFields(schema *DocumentSchema) ([]*generatedField, error) {
+	required := map[string]bool{}
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+	properties := []string{}
+	for property := range schema.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	if _, ok := schema.Properties["id"]; !ok {
+		properties = append([]string{"id"}, properties...)
+	}
+
+	fields := []*generatedField{}
+	names := map[string]string{}
+	for _, property := range properties {
+		field := &generatedField{
+			Name:     goFieldName(property),
+			Property: property,
+			Required: required[property],
+		}
+		if field.Name == "" || field.Name == "ToMap" {
+			return nil, fmt.Errorf("the property %s has no valid Go name", property)
+		}
+		if other, ok := names[field.Name]; ok {
+			return nil, fmt.Errorf("the properties %s and %s have the same Go name %s", other, property, field.Name)
+		}
+		names[field.Name] = property
+
+		propertySchema := schema.Properties[property]
+		if propertySchema == nil {
+			// the id, if not declared
+			propertySchema = &DocumentSchema{Type: "string"}
+		}
+		field.Type, field.Convert, field.Scalar = goFieldType(propertySchema)
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// goFieldType returns the Go type of the values of the schema, the helper converting to it, and whether
+// the type is a scalar.
+func goFieldType(schema *DocumentSchema) (string, string, bool) {
+	switch schema.Type {
+	case "string":
+		if schema.Format == "date-time" {
+			return "time.Time", "genTime", true
+		}
+		return "string", "genString", true
+	case "integer":
+		return "int64", "genInt", true
+	case "number":
+		return "float64", "genFloat", true
+	case "boolean":
+		return "bool", "genBool", true
+	case "object":
+		return "map[string]interface{}", "genObject", false
+	case "array":
+		if schema.Items != nil {
+			switch itemType, _, _ := goFieldType(schema.Items); itemType {
+			case "string":
+				return "[]string", "genStrings", false
+			case "int64":
+				return "[]int64", "genInts", false
+			case "float64":
+				return "[]float64", "genFloats", false
+			case "bool":
+				return "[]bool", "genBools", false
+			}
+		}
+		return "[]interface{}", "genArray", false
+	}
+	return "interface{}", "", false
+}
+
+// generateRepository writes the record, the filter and the repository of the collection.
+func generateRepository(out *bytes.Buffer, name string, fields []*generatedField, filterable []string) {
+	prefix := goFieldName(name)
+	record := prefix + "Record"
+	filter := prefix + "Filter"
+	repository := prefix + "Repository"
+
+	fmt.Fprintf(out, "\n// %s is a record of the %s repository.\ntype %s struct {\n", record, name, record)
+	for _, field := range fields {
+		omitempty := ",omitempty"
+		if field.Required {
+			omitempty = ""
+		}
+		fmt.Fprintf(out, "\t%s %s `json:\"%s%s\" bson:\"%s%s\"`\n", field.Name, field.Type, field.Property, omitempty, field.Property, omitempty)
+	}
+	out.WriteString("}\n")
+
+	fmt.Fprintf(out, "\n// ToMap returns the record as a map of its properties. The optional properties with empty values are left out.\n")
+	fmt.Fprintf(out, "func (r *%s) ToMap() map[string]interface{} {\n\tm := map[string]interface{}{}\n", record)
+	for _, field := range fields {
+		if field.Required {
+			fmt.Fprintf(out, "\tm[%q] = r.%s\n", field.Property, field.Name)
+			continue
+		}
+		fmt.Fprintf(out, "\tif %s {\n\t\tm[%q] = r.%s\n\t}\n", emptyCheck(field), field.Property, field.Name)
+	}
+	out.WriteString("\treturn m\n}\n")
+
+	fmt.Fprintf(out, "\n// %sFromMap returns the record with the properties of the map. The values that do not fit the fields are skipped.\n", record)
+	fmt.Fprintf(out, "func %sFromMap(m map[string]interface{}) *%s {\n\tr := &%s{}\n", record, record, record)
+	for _, field := range fields {
+		if field.Convert == "" {
+			fmt.Fprintf(out, "\tr.%s = m[%q]\n", field.Name, field.Property)
+			continue
+		}
+		fmt.Fprintf(out, "\tr.%s = %s(m[%q])\n", field.Name, field.Convert, field.Property)
+	}
+	out.WriteString("\treturn r\n}\n")
+
+	allowed := map[string]bool{}
+	for _, property := range filterable {
+		allowed[property] = true
+	}
+	fmt.Fprintf(out, "\n// %s is a filter of the %s records by their declared fields.\ntype %s backends.Filter\n", filter, name, filter)
+	fmt.Fprintf(out, "\n// New%s returns an empty filter.\nfunc New%s() %s {\n\treturn %s{}\n}\n", filter, filter, filter, filter)
+	for _, field := range fields {
+		if !field.Scalar || (len(allowed) > 0 && !allowed[field.Property] && field.Property != "id") {
+			continue
+		}
+		fmt.Fprintf(out, "\n// %s matches the records with the %s.\nfunc (f %s) %s(value %s) %s {\n\tf[%q] = value\n\treturn f\n}\n",
+			field.Name, field.Property, filter, field.Name, field.Type, filter, field.Property)
+	}
+
+	fmt.Fprintf(out, `
+// %[1]s is the typed repository of the %[2]s records.
+type %[1]s struct {
+	Repository backends.Repository
+}
+
+// New%[1]s returns the typed repository of the %[2]s repository of the backend.
+func New%[1]s(backend backends.Backend) (*%[1]s, error) {
+	repo, err := backend.GetRepository(%[2]q)
+	if err != nil {
+		return nil, err
+	}
+	return &%[1]s{Repository: repo}, nil
+}
+
+// GetOne returns the first record matched by the filter.
+func (r *%[1]s) GetOne(filter %[3]s) (*%[4]s, error) {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(backends.Filter(filter), &record); err != nil {
+		return nil, err
+	}
+	return %[4]sFromMap(record), nil
+}
+
+// GetAll returns the records matched by the filter.
+func (r *%[1]s) GetAll(filter %[3]s, order string, sorting string, limit int, offset int) ([]*%[4]s, error) {
+	results, err := r.Repository.GetAll(backends.Filter(filter), map[string]interface{}{}, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	records := []*%[4]s{}
+	err = backends.IterateOverSlice(results, func(i int, item interface{}) error {
+		record, err := genRecord(item)
+		if err != nil {
+			return err
+		}
+		records = append(records, %[4]sFromMap(record))
+		return nil
+	})
+	return records, err
+}
+
+// Save saves the record, or updates the record matched by the filter if the filter is not nil.
+func (r *%[1]s) Save(record *%[4]s, filter %[3]s) (*%[4]s, error) {
+	payload := record.ToMap()
+	result, err := r.Repository.Save(&payload, backends.Filter(filter))
+	if err != nil {
+		return nil, err
+	}
+	saved, err := genRecord(result)
+	if err != nil {
+		return nil, err
+	}
+	return %[4]sFromMap(saved), nil
+}
+
+// DeleteOne deletes the first record matched by the filter.
+func (r *%[1]s) DeleteOne(filter %[3]s) error {
+	return r.Repository.DeleteOne(backends.Filter(filter))
+}
+
+// DeleteAll deletes all records matched by the filter.
+func (r *%[1]s) DeleteAll(filter %[3]s) error {
+	return r.Repository.DeleteAll(backends.Filter(filter))
+}
+`, repository, name, filter, record)
+}
+
+// emptyCheck returns the condition of a non-empty value of the field.
+func emptyCheck(field *generatedField) string {
+	switch field.Type {
+	case "string":
+		return fmt.Sprintf("r.%s != \"\"", field.Name)
+	case "int64", "float64":
+		return fmt.Sprintf("r.%s != 0", field.Name)
+	case "bool":
+		return fmt.Sprintf("r.%s", field.Name)
+	case "time.Time":
+		return fmt.Sprintf("!r.%s.IsZero()", field.Name)
+	}
+	return fmt.Sprintf("r.%s != nil", field.Name)
+}
+
+// goInitialisms are the words written in upper case in the Go names.
+var goInitialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true, "JSON": true, "TTL": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// goFieldName returns the exported Go name of the property: "createdAt" is CreatedAt, "user_id" is UserID.
+func goFieldName(property string) string {
+	words := []string{}
+	word := []rune{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = []rune{}
+		}
+	}
+	for _, r := range property {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+
+	name := ""
+	for _, w := range words {
+		if upper := strings.ToUpper(w); goInitialisms[upper] {
+			name += upper
+			continue
+		}
+		runes := []rune(w)
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+	if name != "" && unicode.IsDigit([]rune(name)[0]) {
+		name = "F" + name
+	}
+	return name
+}
+
+// generatedHelpers are the conversions of the record values used by the generated code.
+const generatedHelpers = `
+func genRecord(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case *map[string]interface{}:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	record, err := backends.InterfaceToMap(value)
+	if err != nil {
+		return nil, err
+	}
+	return *record, nil
+}
+
+func genString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case interface{ Hex() string }:
+		return v.Hex()
+	}
+	return fmt.Sprint(value)
+}
+
+func genInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func genFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func genBool(value interface{}) bool {
+	v, _ := value.(bool)
+	return v
+}
+
+func genTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	case float64:
+		// epoch seconds, as the DynamoDB TTL attributes
+		return time.Unix(int64(v), 0)
+	case int64:
+		return time.Unix(v, 0)
+	}
+	return time.Time{}
+}
+
+func genObject(value interface{}) map[string]interface{} {
+	v, _ := value.(map[string]interface{})
+	return v
+}
+
+func genArray(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	}
+	return nil
+}
+
+func genStrings(value interface{}) []string {
+	items := genArray(value)
+	if items == nil {
+		return nil
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = genString(item)
+	}
+	return values
+}
+
+func genInts(value interface{}) []int64 {
+	items := genArray(value)
+	if items == nil {
+		return nil
+	}
+	values := make([]int64, len(items))
+	for i, item := range items {
+		values[i] = genInt(item)
+	}
+	return values
+}
+
+func genFloats(value interface{}) []float64 {
+	items := genArray(value)
+	if items == nil {
+		return nil
+	}
+	values := make([]float64, len(items))
+	for i, item := range items {
+		values[i] = genFloat(item)
+	}
+	return values
+}
+
+func genBools(value interface{}) []bool {
+	items := genArray(value)
+	if items == nil {
+		return nil
+	}
+	values := make([]bool, len(items))
+	for i, item := range items {
+		values[i] = genBool(item)
+	}
+	return values
+}
+`
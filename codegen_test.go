@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRepositories(t *testing.T) {
+	config, err := ParseAndValidate([]byte(`{
+		"dbName": "mongodb",
+		"host": "localhost:27017",
+		"database": "app",
+		"collections": {
+			"user_accounts": {
+				"filterableFields": ["email"],
+				"schema": {
+					"type": "object",
+					"required": ["email"],
+					"properties": {
+						"email": {"type": "string"},
+						"age": {"type": "integer"},
+						"createdAt": {"type": "string", "format": "date-time"},
+						"roles": {"type": "array", "items": {"type": "string"}}
+					}
+				}
+			},
+			"sessions": {}
+		}
+	}`), NewBackendSupport(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := GenerateRepositories(config, GenerateOptions{Package: "models", Source: "config.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "models_gen.go", code, 0)
+	if err != nil {
+		t.Fatal("Expected valid Go code: ", err, string(code))
+	}
+	declared := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil {
+				receiver := d.Recv.List[0].Type
+				if star, ok := receiver.(*ast.StarExpr); ok {
+					receiver = star.X
+				}
+				name = receiver.(*ast.Ident).Name + "." + name
+			}
+			declared[name] = true
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					declared[typeSpec.Name.Name] = true
+				}
+			}
+		}
+	}
+	for _, name := range []string{"UserAccountsRecord", "UserAccountsRecord.ToMap", "UserAccountsRecordFromMap", "UserAccountsFilter.Email",
+		"UserAccountsFilter.ID", "NewUserAccountsRepository", "UserAccountsRepository.GetAll", "UserAccountsRepository.Save"} {
+		if !declared[name] {
+			t.Fatal("Expected the generated code to declare ", name)
+		}
+	}
+	if declared["UserAccountsFilter.Age"] || declared["SessionsRecord"] {
+		t.Fatal("Expected no filter on the fields that are not filterable, and no collection without a schema")
+	}
+	source := strings.Join(strings.Fields(string(code)), " ")
+	for _, field := range []string{"CreatedAt time.Time", "Roles []string", "`json:\"email\" bson:\"email\"`"} {
+		if !strings.Contains(source, field) {
+			t.Fatal("Expected the generated code to contain ", field)
+		}
+	}
+
+	if _, err := GenerateRepositories(config, GenerateOptions{Package: "models", Collections: []string{"sessions"}}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a collection without a schema. Got: ", err)
+	}
+	if _, err := GenerateRepositories(config, GenerateOptions{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without the package. Got: ", err)
+	}
+}
+
+func TestGoFieldName(t *testing.T) {
+	names := map[string]string{
+		"id":           "ID",
+		"createdAt":    "CreatedAt",
+		"user_id":      "UserID",
+		"avatarURL":    "AvatarURL",
+		"external-url": "ExternalURL",
+		"2fa":          "F2fa",
+	}
+	for property, expected := range names {
+		if name := goFieldName(property); name != expected {
+			t.Fatalf("Expected %s for %s. Got: %s", expected, property, name)
+		}
+	}
+}
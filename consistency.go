@@ -0,0 +1,38 @@
+package backends
+
+// ConsistentReadRepository is implemented by the repositories that can choose between eventually
+// and strongly consistent reads.
+type ConsistentReadRepository interface {
+	// WithConsistentRead returns a view of the repository that uses strongly consistent reads
+	// (if consistent is true) or eventually consistent reads for GetOne and GetAll.
+	WithConsistentRead(consistent bool) Repository
+}
+
+// WithConsistentRead returns a view of the repository with strongly consistent reads. For example, to
+// read a record right after it was saved:
+//
+//	user, err := backends.WithConsistentRead(repo, true).GetOne(filter, &User{})
+//
+// If the repository does not support the read consistency option (MongoDB), it is returned unchanged.
+func WithConsistentRead(repo Repository, consistent bool) Repository {
+	if r, ok := repo.(ConsistentReadRepository); ok {
+		return r.WithConsistentRead(consistent)
+	}
+	return repo
+}
+
+// IsConsistentRead returns true if the repository uses strongly consistent reads by default
+// ("consistentRead" property). The default is eventually consistent reads.
+func (m RepositoryDefinitionMap) IsConsistentRead() bool {
+	if consistent, ok := m["consistentRead"]; ok {
+		return consistent.(bool)
+	}
+	return false
+}
+
+// WithConsistentRead returns a copy of the DynamoCollection that reads with the given consistency.
+func (c *DynamoCollection) WithConsistentRead(consistent bool) Repository {
+	collectionCopy := *c
+	collectionCopy.consistentRead = consistent
+	return &collectionCopy
+}
@@ -0,0 +1,36 @@
+package backends
+
+import "testing"
+
+func TestWithConsistentRead(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"consistentRead": true},
+		consistentRead:       true,
+	}
+
+	eventual, ok := WithConsistentRead(repo, false).(*DynamoCollection)
+	if !ok {
+		t.Fatal("Expected a DynamoCollection")
+	}
+	if eventual.consistentRead {
+		t.Fatal("Expected eventually consistent reads")
+	}
+	if !repo.consistentRead {
+		t.Fatal("Expected the original repository to be unchanged")
+	}
+
+	mongoRepo := &MongoSession{}
+	if WithConsistentRead(mongoRepo, true) != mongoRepo {
+		t.Fatal("Expected the repository to be returned unchanged")
+	}
+}
+
+func TestIsConsistentRead(t *testing.T) {
+	if (RepositoryDefinitionMap{}).IsConsistentRead() {
+		t.Fatal("Expected eventually consistent reads by default")
+	}
+	def := (&CollectionConfig{ConsistentRead: true}).Definition("tokens")
+	if !def.IsConsistentRead() {
+		t.Fatal("Expected strongly consistent reads")
+	}
+}
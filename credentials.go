@@ -0,0 +1,151 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes for secret references in the credential properties of the DB config.
+// Instead of a plain value, the property can reference an environment variable:
+// 		"pass": "env:MONGO_PASSWORD"
+// or a mounted secret file:
+// 		"pass": "file:/var/run/secrets/mongo-password"
+const (
+	EnvSecretPrefix  = "env:"
+	FileSecretPrefix = "file:"
+)
+
+// IsSecretReference checks if the value is a reference to an environment variable or a secret file.
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, EnvSecretPrefix) || strings.HasPrefix(value, FileSecretPrefix)
+}
+
+// ResolveSecret returns the value of the secret reference. If the value is not a reference, it is
+// returned unchanged. Trailing new lines are trimmed from secret files.
+func ResolveSecret(value string) (string, error) {
+	if strings.HasPrefix(value, EnvSecretPrefix) {
+		name := strings.TrimPrefix(value, EnvSecretPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", ErrInvalidInput(fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return secret, nil
+	}
+	if strings.HasPrefix(value, FileSecretPrefix) {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, FileSecretPrefix))
+		if err != nil {
+			return "", ErrInvalidInput(err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// SecretWatcher periodically re-reads a set of secret references and calls the
+// onChange callback with the new values when any of them changes.
+type SecretWatcher struct {
+	refs     []string
+	values   []string
+	interval time.Duration
+	onChange func(values []string)
+	mutex    sync.Mutex
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewSecretWatcher creates new SecretWatcher and resolves the initial values of the references.
+// The watcher must be started with Start.
+func NewSecretWatcher(interval time.Duration, refs []string, onChange func(values []string)) (*SecretWatcher, error) {
+	values, err := resolveSecrets(refs)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretWatcher{
+		refs:     refs,
+		values:   values,
+		interval: interval,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Values returns the last resolved values, in the same order as the references.
+func (w *SecretWatcher) Values() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.values
+}
+
+// Start starts watching the secrets in background.
+func (w *SecretWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Check re-reads the secrets and calls onChange if any of the values changed.
+// Errors while reading are logged and the previous values are kept.
+func (w *SecretWatcher) Check() {
+	values, err := resolveSecrets(w.refs)
+	if err != nil {
+		log.Println("WARN: failed to re-read credentials: ", err.Error())
+		return
+	}
+
+	w.mutex.Lock()
+	changed := false
+	for i, value := range values {
+		if w.values[i] != value {
+			changed = true
+			break
+		}
+	}
+	w.values = values
+	w.mutex.Unlock()
+
+	if changed && w.onChange != nil {
+		w.onChange(values)
+	}
+}
+
+// Stop stops watching the secrets. It is safe to call Stop multiple times.
+func (w *SecretWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+func resolveSecrets(refs []string) ([]string, error) {
+	values := []string{}
+	for _, ref := range refs {
+		value, err := ResolveSecret(ref)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func hasSecretReference(values ...string) bool {
+	for _, value := range values {
+		if IsSecretReference(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_SECRET", "from-env")
+	defer os.Unsetenv("BACKENDS_TEST_SECRET")
+
+	value, err := ResolveSecret("env:BACKENDS_TEST_SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-env" {
+		t.Fatal("Expected secret from env. Got: ", value)
+	}
+
+	file, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("from-file\n")
+	file.Close()
+
+	value, err = ResolveSecret("file:" + file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-file" {
+		t.Fatal("Expected secret from file. Got: ", value)
+	}
+
+	value, err = ResolveSecret("plain")
+	if err != nil || value != "plain" {
+		t.Fatal("Expected plain value to be unchanged. Got: ", value, err)
+	}
+
+	if _, err = ResolveSecret("env:BACKENDS_TEST_MISSING"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input for missing env variable. Got: ", err)
+	}
+}
+
+func TestSecretWatcher(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_ROTATED", "first")
+	defer os.Unsetenv("BACKENDS_TEST_ROTATED")
+
+	changed := []string{}
+	watcher, err := NewSecretWatcher(time.Minute, []string{"env:BACKENDS_TEST_ROTATED"}, func(values []string) {
+		changed = values
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	watcher.Check()
+	if len(changed) != 0 {
+		t.Fatal("Expected no change to be reported")
+	}
+
+	os.Setenv("BACKENDS_TEST_ROTATED", "second")
+	watcher.Check()
+	if len(changed) != 1 || changed[0] != "second" {
+		t.Fatal("Expected the rotated value to be reported. Got: ", changed)
+	}
+}
@@ -0,0 +1,158 @@
+package backends
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// CursorRepository is implemented by the repositories that can return the records page by page.
+type CursorRepository interface {
+	// GetPage returns up to pageSize records matching the filter, starting after the cursor (empty for the
+	// first page), and the cursor of the next page. The next cursor is empty when there are no more records.
+	GetPage(filter Filter, resultsTypeHint interface{}, pageSize int, cursor string) (interface{}, string, error)
+}
+
+// GetPage returns a page of the records matching the filter and the cursor of the next page. For example,
+// to read all users in pages of 100:
+//
+//	cursor := ""
+//	for {
+//		users, next, err := backends.GetPage(repo, filter, &User{}, 100, cursor)
+//		...
+//		if next == "" {
+//			break
+//		}
+//		cursor = next
+//	}
+//
+// Returns an error if the repository does not support cursors.
+func GetPage(repo Repository, filter Filter, resultsTypeHint interface{}, pageSize int, cursor string) (interface{}, string, error) {
+	if r, ok := repo.(CursorRepository); ok {
+		return r.GetPage(filter, resultsTypeHint, pageSize, cursor)
+	}
+	return nil, "", ErrInvalidInput(fmt.Sprintf("cursors are not supported on %T", repo))
+}
+
+// GetPage returns the page of records from the repository on the active backend.
+func (r *failoverRepository) GetPage(filter Filter, resultsTypeHint interface{}, pageSize int, cursor string) (interface{}, string, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, "", err
+	}
+	return GetPage(repository, filter, resultsTypeHint, pageSize, cursor)
+}
+
+// GetPage returns a page of the records matching the filter. The cursor is the DynamoDB
+// pagination key (ExclusiveStartKey) of the page, encoded as a string.
+func (c *DynamoCollection) GetPage(filter Filter, resultsTypeHint interface{}, pageSize int, cursor string) (interface{}, string, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, "", err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return nil, "", err
+	}
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, "", err
+	}
+	if pageSize <= 0 {
+		return nil, "", ErrInvalidInput("page size must be greater than zero")
+	}
+	startKey, err := DecodeDynamoCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resultHint := AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultHint)
+
+	itr, paths := c.iter(filter, "", "", startKey, nil)
+	var item, last map[string]*dynamodb.AttributeValue
+	for i := 0; itr.Next(&item); i++ {
+		if i == pageSize {
+			// there are more records, continue after the last one on the page
+			next, err := EncodeDynamoCursor(pagingKey(last, paths...))
+			if err != nil {
+				return nil, "", err
+			}
+			return results.Interface(), next, nil
+		}
+		record, err := CreateNewAsExample(resultHint)
+		if err != nil {
+			return nil, "", err
+		}
+		if err = dynamo.UnmarshalItem(item, record); err != nil {
+			return nil, "", err
+		}
+		results = reflect.Append(results, reflect.ValueOf(record))
+		last = item
+	}
+	if itr.Err() != nil {
+		return nil, "", itr.Err()
+	}
+	return results.Interface(), "", nil
+}
+
+// dynamoCursorValue is the JSON representation of a key attribute value in the cursor.
+// The key attributes are strings, numbers or binary.
+type dynamoCursorValue struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// EncodeDynamoCursor encodes the DynamoDB pagination key (LastEvaluatedKey) as a cursor.
+// Returns empty cursor for an empty key.
+func EncodeDynamoCursor(key dynamo.PagingKey) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	values := map[string]*dynamoCursorValue{}
+	for name, value := range key {
+		values[name] = &dynamoCursorValue{
+			S: value.S,
+			N: value.N,
+			B: value.B,
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeDynamoCursor decodes the cursor to the DynamoDB pagination key (ExclusiveStartKey).
+// Returns nil for an empty cursor.
+func DecodeDynamoCursor(cursor string) (dynamo.PagingKey, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidInput("invalid cursor")
+	}
+	values := map[string]*dynamoCursorValue{}
+	if err := json.Unmarshal(data, &values); err != nil || len(values) == 0 {
+		return nil, ErrInvalidInput("invalid cursor")
+	}
+	key := dynamo.PagingKey{}
+	for name, value := range values {
+		if value == nil || (value.S == nil && value.N == nil && value.B == nil) {
+			return nil, ErrInvalidInput("invalid cursor")
+		}
+		key[name] = &dynamodb.AttributeValue{
+			S: value.S,
+			N: value.N,
+			B: value.B,
+		}
+	}
+	return key, nil
+}
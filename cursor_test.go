@@ -0,0 +1,76 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+func TestDynamoCursor(t *testing.T) {
+	key := dynamo.PagingKey{
+		"tenant":  &dynamodb.AttributeValue{S: aws.String("acme")},
+		"version": &dynamodb.AttributeValue{N: aws.String("42")},
+	}
+	cursor, err := EncodeDynamoCursor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor == "" {
+		t.Fatal("Expected a cursor")
+	}
+
+	decoded, err := DecodeDynamoCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || aws.StringValue(decoded["tenant"].S) != "acme" || aws.StringValue(decoded["version"].N) != "42" {
+		t.Fatal("Unexpected key: ", decoded)
+	}
+}
+
+func TestDynamoCursorEmpty(t *testing.T) {
+	cursor, err := EncodeDynamoCursor(nil)
+	if err != nil || cursor != "" {
+		t.Fatal("Expected empty cursor for empty key")
+	}
+	key, err := DecodeDynamoCursor("")
+	if err != nil || key != nil {
+		t.Fatal("Expected nil key for empty cursor")
+	}
+}
+
+func TestDynamoCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "e30", "eyJpZCI6e319"} {
+		if _, err := DecodeDynamoCursor(cursor); err == nil {
+			t.Fatal("Expected error for cursor ", cursor)
+		}
+	}
+}
+
+func TestPagingKey(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"tenant": &dynamodb.AttributeValue{S: aws.String("acme")},
+		"id":     &dynamodb.AttributeValue{S: aws.String("1")},
+		"email":  &dynamodb.AttributeValue{S: aws.String("john@example.com")},
+		"name":   &dynamodb.AttributeValue{S: aws.String("John")},
+	}
+	paths := testAccessPaths()
+
+	key := pagingKey(item, paths[0])
+	if len(key) != 2 || key["tenant"] == nil || key["id"] == nil {
+		t.Fatal("Expected the table key. Got: ", key)
+	}
+
+	key = pagingKey(item, paths[0], paths[2])
+	if len(key) != 3 || key["email"] == nil {
+		t.Fatal("Expected the table and the index key. Got: ", key)
+	}
+}
+
+func TestGetPageNotSupported(t *testing.T) {
+	if _, _, err := GetPage(&memoryRepo{}, Filter{}, map[string]interface{}{}, 10, ""); err == nil {
+		t.Fatal("Expected error for a repository without cursors")
+	}
+}
@@ -0,0 +1,59 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateRange is a date range filter value ($since, $until or $between). The bounds are inclusive,
+// a nil bound is open.
+type dateRange struct {
+	since interface{}
+	until interface{}
+}
+
+// filterDateRange returns the date range of a Since, Until or Between filter value.
+func filterDateRange(value interface{}) (*dateRange, bool) {
+	specs, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if between, ok := specs["$between"].([]interface{}); ok && len(between) == 2 {
+		return &dateRange{since: between[0], until: between[1]}, true
+	}
+	since, hasSince := specs["$since"]
+	until, hasUntil := specs["$until"]
+	if !hasSince && !hasUntil {
+		return nil, false
+	}
+	return &dateRange{since: since, until: until}, true
+}
+
+// dateBound parses a bound of a date range: a time.Time, an RFC3339 string or a date (2006-01-02).
+func dateBound(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v, expected a time.Time or an RFC3339 string", value)
+}
+
+// dateString returns the bound as it is compared to the dates stored as strings: an RFC3339 string in UTC.
+func dateString(value interface{}) string {
+	t, err := dateBound(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
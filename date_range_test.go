@@ -0,0 +1,48 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterDateRange(t *testing.T) {
+	since := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 0, 7)
+
+	cases := []struct {
+		value interface{}
+		since interface{}
+		until interface{}
+	}{
+		{NewFilter().Since("createdAt", since)["createdAt"], since, nil},
+		{NewFilter().Until("createdAt", until)["createdAt"], nil, until},
+		{NewFilter().Between("createdAt", since, until)["createdAt"], since, until},
+		{map[string]interface{}{"$between": []interface{}{"2019-05-01", "2019-05-08T00:00:00Z"}}, "2019-05-01", "2019-05-08T00:00:00Z"},
+	}
+	for _, c := range cases {
+		dates, ok := filterDateRange(c.value)
+		if !ok || dates.since != c.since || dates.until != c.until {
+			t.Errorf("Unexpected date range for %v: %+v", c.value, dates)
+		}
+	}
+
+	if _, ok := filterDateRange(map[string]interface{}{"$exists": true}); ok {
+		t.Error("Expected an Exists filter not to be a date range")
+	}
+}
+
+func TestDateBound(t *testing.T) {
+	expected := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, value := range []interface{}{expected, &expected, "2019-05-01T00:00:00Z", "2019-05-01"} {
+		bound, err := dateBound(value)
+		if err != nil || !bound.Equal(expected) {
+			t.Errorf("Unexpected bound for %v: %v %v", value, bound, err)
+		}
+	}
+	if _, err := dateBound("last week"); err == nil {
+		t.Error("Expected an error for an invalid date")
+	}
+	if s := dateString(time.Date(2019, 5, 1, 2, 0, 0, 0, time.FixedZone("CEST", 7200))); s != "2019-05-01T00:00:00Z" {
+		t.Error("Expected the date in UTC, got ", s)
+	}
+}
@@ -0,0 +1,309 @@
+package backends
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	bigIntType     = reflect.TypeOf(big.Int{})
+	decimal128Type = reflect.TypeOf(bson.Decimal128{})
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+	dynamoNumType  = reflect.TypeOf(dynamoNumber(""))
+
+	// numberPattern matches the decimal text that is a valid JSON number.
+	numberPattern = regexp.MustCompile(`^-?(\d+)(?:\.(\d+))?(?:[eE]([+-]?\d+))?$`)
+)
+
+var decimalTypes = struct {
+	sync.RWMutex
+	byType map[reflect.Type]bool
+}{
+	byType: map[reflect.Type]bool{},
+}
+
+// RegisterDecimalType registers a decimal type, such as decimal.Decimal of github.com/shopspring/decimal,
+// so its values are stored as exact numbers instead of their JSON encoding:
+//
+//	backends.RegisterDecimalType(decimal.Decimal{})
+//
+// The type must implement encoding.TextMarshaler and encoding.TextUnmarshaler with the decimal text of
+// the value. *big.Int and bson.Decimal128 are supported without registration.
+func RegisterDecimalType(example interface{}) error {
+	t := reflect.TypeOf(example)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || !reflect.PtrTo(t).Implements(textMarshalerType) || !reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return ErrInvalidInput(fmt.Sprintf("%T must implement encoding.TextMarshaler and encoding.TextUnmarshaler", example))
+	}
+	decimalTypes.Lock()
+	defer decimalTypes.Unlock()
+	decimalTypes.byType[t] = true
+	return nil
+}
+
+// isDecimalType checks if the values of the type are decimals: big.Int, bson.Decimal128 or a registered type.
+func isDecimalType(t reflect.Type) bool {
+	if t == bigIntType || t == decimal128Type {
+		return true
+	}
+	decimalTypes.RLock()
+	defer decimalTypes.RUnlock()
+	return decimalTypes.byType[t]
+}
+
+// exactNumberText returns the decimal text of a decimal value, or of an exact number read from a
+// database (json.Number), without a loss of precision.
+func exactNumberText(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if v.Type() == jsonNumberType || v.Type() == dynamoNumType {
+			return v.String(), true
+		}
+		return "", false
+	case reflect.Struct:
+	default:
+		return "", false
+	}
+	switch t := v.Type(); {
+	case t == decimal128Type:
+		return v.Interface().(bson.Decimal128).String(), true
+	case t == bigIntType:
+		return addressable(v).Interface().(*big.Int).String(), true
+	case isDecimalType(t):
+		text, err := addressable(v).Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err == nil
+	}
+	return "", false
+}
+
+// addressable returns a pointer to the value, or to a copy of the value if it is not addressable.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p
+}
+
+// decodeDecimal decodes a decimal, a json.Number, a string or a number into the decimal type. Values
+// that are not exact in the type are not decoded.
+func decodeDecimal(src, dst reflect.Value) error {
+	text, ok := exactNumberText(src)
+	if !ok {
+		switch {
+		case src.Kind() == reflect.String:
+			text = src.String()
+		case isIntKind(src.Kind()):
+			text = strconv.FormatInt(src.Int(), 10)
+		case isUintKind(src.Kind()):
+			text = strconv.FormatUint(src.Uint(), 10)
+		case src.Kind() == reflect.Float32 || src.Kind() == reflect.Float64:
+			text = strconv.FormatFloat(src.Float(), 'f', -1, 64)
+		default:
+			return nil
+		}
+	}
+
+	switch dst.Type() {
+	case decimal128Type:
+		if d, err := bson.ParseDecimal128(text); err == nil {
+			dst.Set(reflect.ValueOf(d))
+		}
+	case bigIntType:
+		if r, ok := new(big.Rat).SetString(text); ok && r.IsInt() {
+			dst.Addr().Interface().(*big.Int).Set(r.Num())
+		}
+	default:
+		p := reflect.New(dst.Type())
+		if err := p.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err == nil {
+			dst.Set(p.Elem())
+		}
+	}
+	return nil
+}
+
+// exactNumberValue returns the float64 value of an exact number, for decoding it into a number.
+func exactNumberValue(v reflect.Value) (float64, bool) {
+	text, ok := exactNumberText(v)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	return f, err == nil
+}
+
+// genericNumber returns the decimal text as a json.Number, or as a string if it is not a JSON number (NaN).
+func genericNumber(text string) interface{} {
+	if numberPattern.MatchString(text) {
+		return json.Number(text)
+	}
+	return text
+}
+
+// isExactFloat checks if the float is read from the decimal text without a loss of precision.
+func isExactFloat(text string, f float64) bool {
+	exact, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return false
+	}
+	shortest, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return ok && exact.Cmp(shortest) == 0
+}
+
+// exactValues returns the record with the exact numbers (decimals and json.Number), also in nested
+// documents and arrays, replaced by their database values.
+func exactValues(record map[string]interface{}, convert func(text string, decimal bool) interface{}) map[string]interface{} {
+	if record == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		result[key] = exactValue(value, convert)
+	}
+	return result
+}
+
+func exactValue(value interface{}, convert func(text string, decimal bool) interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int64, float64, []byte:
+		return value
+	case map[string]interface{}:
+		return exactValues(v, convert)
+	case bson.M:
+		return exactValues(v, convert)
+	case []interface{}:
+		if v == nil {
+			return value
+		}
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = exactValue(item, convert)
+		}
+		return result
+	}
+
+	rv := reflect.ValueOf(value)
+	if text, ok := exactNumberText(rv); ok {
+		return convert(text, rv.Type() != jsonNumberType)
+	}
+	t := rv.Type()
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && rv.IsNil() || !isDecimalType(derefType(t.Elem())) {
+			return value
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = exactValue(rv.Index(i).Interface(), convert)
+		}
+		return result
+	case reflect.Map:
+		if rv.IsNil() || t.Key().Kind() != reflect.String || !isDecimalType(derefType(t.Elem())) {
+			return value
+		}
+		result := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			result[key.String()] = exactValue(rv.MapIndex(key).Interface(), convert)
+		}
+		return result
+	}
+	return value
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// mongoValues returns the document with the decimals stored as bson.Decimal128. The decimals with more
+// than 34 significant digits are stored as strings. Integer json.Number values are stored as integers.
+func mongoValues(document map[string]interface{}) map[string]interface{} {
+	return exactValues(document, func(text string, decimal bool) interface{} {
+		if !decimal {
+			if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return i
+			}
+		}
+		if d, err := bson.ParseDecimal128(text); err == nil {
+			return d
+		}
+		return text
+	})
+}
+
+// dynamoValues returns the item with the decimals stored as DynamoDB numbers. The decimals that are not
+// valid DynamoDB numbers (more than 38 significant digits, or out of range) are stored as strings.
+func dynamoValues(item map[string]interface{}) map[string]interface{} {
+	return exactValues(item, func(text string, decimal bool) interface{} {
+		if isDynamoNumber(text) {
+			return dynamoNumber(text)
+		}
+		return text
+	})
+}
+
+// isDynamoNumber checks if the decimal text is a number DynamoDB stores exactly: up to 38 significant
+// digits, with the magnitude between 1E-130 and 1E+126.
+func isDynamoNumber(text string) bool {
+	match := numberPattern.FindStringSubmatch(text)
+	if match == nil {
+		return false
+	}
+	exponent := 0
+	if match[3] != "" {
+		var err error
+		if exponent, err = strconv.Atoi(match[3]); err != nil {
+			return false
+		}
+	}
+	// the value is digits × 10^exponent
+	digits := strings.TrimLeft(match[1]+match[2], "0")
+	exponent -= len(match[2])
+	if digits == "" {
+		return true
+	}
+	significant := strings.TrimRight(digits, "0")
+	exponent += len(digits) - len(significant)
+	if len(significant) > 38 {
+		return false
+	}
+	// the value is 0.significant × 10^magnitude
+	magnitude := exponent + len(significant)
+	return magnitude >= -129 && magnitude <= 126
+}
+
+// dynamoNumber is a decimal stored as a DynamoDB number (N).
+type dynamoNumber string
+
+// MarshalDynamo marshals the number for the dynamo package.
+func (n dynamoNumber) MarshalDynamo() (*dynamodb.AttributeValue, error) {
+	return &dynamodb.AttributeValue{N: aws.String(string(n))}, nil
+}
+
+// MarshalDynamoDBAttributeValue marshals the number for the dynamodbattribute package.
+func (n dynamoNumber) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	av.N = aws.String(string(n))
+	return nil
+}
@@ -0,0 +1,205 @@
+package backends
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// testDecimal is a decimal type with a text encoding, like decimal.Decimal.
+type testDecimal struct {
+	value *big.Rat
+}
+
+func (d testDecimal) MarshalText() ([]byte, error) {
+	return []byte(d.value.FloatString(4)), nil
+}
+
+func (d *testDecimal) UnmarshalText(text []byte) error {
+	value, ok := new(big.Rat).SetString(string(text))
+	if !ok {
+		return ErrInvalidInput("invalid decimal")
+	}
+	d.value = value
+	return nil
+}
+
+type decimalRecord struct {
+	Amount  *big.Int        `json:"amount"`
+	Price   bson.Decimal128 `json:"price"`
+	Rate    testDecimal     `json:"rate"`
+	Balance []*big.Int      `json:"balance"`
+	Data    []byte          `json:"data"`
+}
+
+func newDecimalRecord(t *testing.T, amount string) *decimalRecord {
+	if err := RegisterDecimalType(testDecimal{}); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := new(big.Int).SetString(amount, 10)
+	price, _ := bson.ParseDecimal128("12345678901234567890.1234")
+	rate, _ := new(big.Rat).SetString("0.1234")
+	return &decimalRecord{
+		Amount:  n,
+		Price:   price,
+		Rate:    testDecimal{value: rate},
+		Balance: []*big.Int{big.NewInt(1), n},
+		Data:    []byte{0, 1, 2, 255},
+	}
+}
+
+func TestDecimalsMongoRoundTrip(t *testing.T) {
+	for _, amount := range []string{"123456789012345678901234567890", "1234567890123456789012345678901234567890"} {
+		record := newDecimalRecord(t, amount)
+		payload, err := InterfaceToMap(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		document := mongoValues(*payload)
+		if _, ok := document["price"].(bson.Decimal128); !ok {
+			t.Fatalf("Expected the price to be stored as Decimal128. Got: %T", document["price"])
+		}
+		if _, ok := document["rate"].(bson.Decimal128); !ok {
+			t.Fatalf("Expected the registered decimal to be stored as Decimal128. Got: %T", document["rate"])
+		}
+		if _, ok := document["data"].([]byte); !ok {
+			t.Fatalf("Expected the bytes to be stored as binary. Got: %T", document["data"])
+		}
+
+		// the document is read back through its BSON encoding
+		data, err := bson.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := bson.M{}
+		if err := bson.Unmarshal(data, &read); err != nil {
+			t.Fatal(err)
+		}
+		result := &decimalRecord{}
+		if err := MapToInterface(read, result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Amount.String() != amount || result.Balance[1].String() != amount {
+			t.Fatalf("Expected the amount %s. Got: %v", amount, result.Amount)
+		}
+		if result.Price != record.Price || result.Rate.value.Cmp(record.Rate.value) != 0 {
+			t.Fatalf("Expected the decimals to round-trip. Got: %v, %v", result.Price, result.Rate.value)
+		}
+		if !reflect.DeepEqual(result.Data, record.Data) {
+			t.Fatalf("Expected the bytes to round-trip. Got: %v", result.Data)
+		}
+	}
+}
+
+func TestDecimalsDynamoRoundTrip(t *testing.T) {
+	for _, amount := range []string{"123456789012345678901234567890", "1234567890123456789012345678901234567890"} {
+		record := newDecimalRecord(t, amount)
+		payload, err := InterfaceToMap(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := dynamodbattribute.MarshalMap(dynamoValues(*payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item["price"].N == nil || *item["price"].N != "12345678901234567890.1234" {
+			t.Fatal("Expected the price to be stored as a number. Got: ", item["price"])
+		}
+		if len(amount) <= 38 && item["amount"].N == nil || len(amount) > 38 && item["amount"].S == nil {
+			t.Fatal("Expected the amount to be stored as a number up to 38 digits. Got: ", item["amount"])
+		}
+		if item["data"].B == nil {
+			t.Fatal("Expected the bytes to be stored as binary. Got: ", item["data"])
+		}
+
+		read, err := unmarshalRecord(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &decimalRecord{}
+		if err := MapToInterface(read, result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Amount.String() != amount || result.Price != record.Price || result.Rate.value.Cmp(record.Rate.value) != 0 {
+			t.Fatalf("Expected the decimals to round-trip. Got: %v, %v, %v", result.Amount, result.Price, result.Rate.value)
+		}
+		if !reflect.DeepEqual(result.Data, record.Data) {
+			t.Fatalf("Expected the bytes to round-trip. Got: %v", result.Data)
+		}
+	}
+}
+
+func TestDecimalsGeneric(t *testing.T) {
+	record := newDecimalRecord(t, "123456789012345678901234567890")
+	generic := map[string]interface{}{}
+	if err := MapToInterface(record, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if generic["amount"] != json.Number("123456789012345678901234567890") || generic["rate"] != json.Number("0.1234") {
+		t.Fatal("Expected the decimals as exact numbers. Got: ", generic)
+	}
+	if !reflect.DeepEqual(generic["data"], []byte{0, 1, 2, 255}) {
+		t.Fatal("Expected the bytes. Got: ", generic["data"])
+	}
+
+	def, err := NewRepoDefFromStruct(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors := def.GetSchema().Validate(record, false); def.GetSchema().Properties["price"].Type != "number" || len(errors) != 0 {
+		t.Fatal("Expected the decimals to be valid numbers. Got: ", errors)
+	}
+
+	var balance float64
+	if err := MapToInterface(json.Number("12.5"), &balance); err != nil || balance != 12.5 {
+		t.Fatal("Expected an exact number to decode into a float. Got: ", balance, err)
+	}
+	if err := RegisterDecimalType(""); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a type without a text encoding. Got: ", err)
+	}
+}
+
+func TestUnmarshalExactNumbers(t *testing.T) {
+	numbers := map[string]interface{}{
+		"42":                       int64(42),
+		"0.1":                      0.1,
+		"12345678901234567890.5":   json.Number("12345678901234567890.5"),
+		"123456789012345678901234": json.Number("123456789012345678901234"),
+	}
+	for n, expected := range numbers {
+		value, err := unmarshalAttribute(&dynamodb.AttributeValue{N: aws.String(n)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Fatalf("Expected %v (%T) for %s. Got: %v (%T)", expected, expected, n, value, value)
+		}
+	}
+}
+
+func TestIsDynamoNumber(t *testing.T) {
+	numbers := map[string]bool{
+		"0":                             true,
+		"-12.50":                        true,
+		"1E-130":                        true,
+		"1E-131":                        false,
+		"9.9E+125":                      true,
+		"1E+126":                        false,
+		strings.Repeat("9", 38):         true,
+		strings.Repeat("9", 39):         false,
+		strings.Repeat("9", 38) + "000": true,
+		"NaN":                           false,
+	}
+	for text, expected := range numbers {
+		if isDynamoNumber(text) != expected {
+			t.Fatalf("Expected %v for %s", expected, text)
+		}
+	}
+}
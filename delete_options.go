@@ -0,0 +1,53 @@
+package backends
+
+// DeleteOptions are the options of DeleteAllWithOptions.
+type DeleteOptions struct {
+	// DryRun counts the matched records without deleting them.
+	DryRun bool
+}
+
+// DeleteCountRepository is implemented by the repositories that return the number of records deleted by DeleteAll.
+type DeleteCountRepository interface {
+	// DeleteAllWithOptions deletes the matched records (or counts them on a dry run) and returns their number.
+	DeleteAllWithOptions(filter Filter, options DeleteOptions) (int, error)
+}
+
+// DeleteAllWithOptions deletes all records that match the filter and returns the number of deleted records.
+// With DryRun, it returns the number of records that would be deleted, so a cleanup can be checked before
+// it is run:
+//
+//	count, err := backends.DeleteAllWithOptions(repo, filter, backends.DeleteOptions{DryRun: true})
+//
+// On the repositories that do not implement DeleteCountRepository, the matched records are counted with
+// GetAll before they are deleted with DeleteAll.
+func DeleteAllWithOptions(repo Repository, filter Filter, options DeleteOptions) (int, error) {
+	if r, ok := repo.(DeleteCountRepository); ok {
+		return r.DeleteAllWithOptions(filter, options)
+	}
+
+	results, err := repo.GetAll(copyFilter(filter), map[string]interface{}{}, "", "", 0, 0)
+	if err != nil && !IsErrNotFound(err) {
+		return 0, err
+	}
+	count := 0
+	err = IterateOverSlice(results, func(i int, item interface{}) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if options.DryRun || count == 0 {
+		return count, nil
+	}
+	return count, repo.DeleteAll(filter)
+}
+
+// DeleteAllWithOptions deletes the records on the active backend.
+func (r *failoverRepository) DeleteAllWithOptions(filter Filter, options DeleteOptions) (int, error) {
+	repository, err := r.active()
+	if err != nil {
+		return 0, err
+	}
+	return DeleteAllWithOptions(repository, filter, options)
+}
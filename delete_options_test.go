@@ -0,0 +1,31 @@
+package backends
+
+import "testing"
+
+func TestDeleteAllWithOptions(t *testing.T) {
+	repo := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "status": "expired"},
+		{"id": "2", "status": "active"},
+		{"id": "3", "status": "expired"},
+	}}
+
+	count, err := DeleteAllWithOptions(repo, Filter{"status": "expired"}, DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(repo.records) != 3 {
+		t.Fatalf("Expected 2 matched records and nothing deleted. Got %d, %v", count, repo.records)
+	}
+
+	count, err = DeleteAllWithOptions(repo, Filter{"status": "expired"}, DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(repo.records) != 1 || repo.records[0]["id"] != "2" {
+		t.Fatalf("Expected 2 deleted records. Got %d, %v", count, repo.records)
+	}
+
+	if count, err = DeleteAllWithOptions(repo, Filter{"status": "expired"}, DeleteOptions{}); err != nil || count != 0 {
+		t.Fatal("Expected no deleted records. Got: ", count, err)
+	}
+}
@@ -0,0 +1,258 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DocumentSchema describes the documents of a repository with a subset of JSON Schema: "type",
+// "properties", "required", "additionalProperties", "items", "enum", "minimum", "maximum",
+// "minLength", "maxLength", "pattern" and "format" ("date-time" or "email").
+type DocumentSchema struct {
+	Type                 string                     `json:"type,omitempty"`
+	Properties           map[string]*DocumentSchema `json:"properties,omitempty"`
+	Required             []string                   `json:"required,omitempty"`
+	AdditionalProperties *bool                      `json:"additionalProperties,omitempty"`
+	Items                *DocumentSchema            `json:"items,omitempty"`
+	Enum                 []interface{}              `json:"enum,omitempty"`
+	Minimum              *float64                   `json:"minimum,omitempty"`
+	Maximum              *float64                   `json:"maximum,omitempty"`
+	MinLength            *int                       `json:"minLength,omitempty"`
+	MaxLength            *int                       `json:"maxLength,omitempty"`
+	Pattern              string                     `json:"pattern,omitempty"`
+	Format               string                     `json:"format,omitempty"`
+}
+
+// FieldError is a validation error of a single document field.
+type FieldError struct {
+	// Field is the path to the field, for example "address.city" or "tags.0".
+	Field string `json:"field"`
+	// Code is the schema keyword that failed: "required", "type", "enum", "minimum", "pattern"...
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// DocumentValidationError is returned by Save when the document does not match the schema of
+// the repository. It is of the ErrInvalidInput class and holds all field errors.
+type DocumentValidationError struct {
+	Errors []*FieldError
+}
+
+// Error returns the error class message.
+func (e *DocumentValidationError) Error() string {
+	return ErrInvalidInput().Error()
+}
+
+// Details returns all field errors.
+func (e *DocumentValidationError) Details() string {
+	messages := []string{}
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// GetSchema returns the document schema of the repository (property "schema"), or nil if the
+// documents are not validated. The schema can be given as *DocumentSchema or as a map (as loaded
+// from JSON config):
+// 		"schema": map[string]interface{}{
+// 			"type":     "object",
+// 			"required": []string{"email"},
+// 			"properties": map[string]interface{}{
+// 				"email": map[string]interface{}{"type": "string", "format": "email"},
+// 			},
+// 		}
+func (m RepositoryDefinitionMap) GetSchema() *DocumentSchema {
+	switch schema := m["schema"].(type) {
+	case *DocumentSchema:
+		return schema
+	case map[string]interface{}:
+		result := &DocumentSchema{}
+		if err := MapToInterface(schema, result); err != nil {
+			return nil
+		}
+		return result
+	}
+	return nil
+}
+
+// Validate validates the document against the schema and returns the field errors.
+// With partial set, the required properties of the document itself are not checked (updates).
+func (s *DocumentSchema) Validate(document interface{}, partial bool) []*FieldError {
+	errors := []*FieldError{}
+	if s == nil {
+		return errors
+	}
+	value, err := toAuditMap(document)
+	if err != nil {
+		return append(errors, &FieldError{Code: "type", Message: err.Error()})
+	}
+	s.validate("", value, partial, &errors)
+	return errors
+}
+
+// validateDocument validates the payload against the schema of the repository before it is saved.
+func validateDocument(payload map[string]interface{}, repoDef RepositoryDefinition, create bool) error {
+	schema := repoDef.GetSchema()
+	if schema == nil {
+		return nil
+	}
+	if errors := schema.Validate(payload, !create); len(errors) > 0 {
+		return &DocumentValidationError{Errors: errors}
+	}
+	return nil
+}
+
+func (s *DocumentSchema) validate(path string, value interface{}, partial bool, errors *[]*FieldError) {
+	addError := func(code, message string, args ...interface{}) {
+		*errors = append(*errors, &FieldError{
+			Field:   path,
+			Code:    code,
+			Message: fmt.Sprintf(message, args...),
+		})
+	}
+
+	if s.Type != "" && !isOfSchemaType(value, s.Type) {
+		addError("type", "expected %s, got %s", s.Type, typeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		addError("enum", "must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if !partial {
+			for _, property := range s.Required {
+				if _, ok := v[property]; !ok {
+					*errors = append(*errors, &FieldError{
+						Field:   joinPath(path, property),
+						Code:    "required",
+						Message: "is required",
+					})
+				}
+			}
+		}
+		for _, key := range sortedKeys(v) {
+			propSchema, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errors = append(*errors, &FieldError{
+						Field:   joinPath(path, key),
+						Code:    "additionalProperties",
+						Message: "is not allowed",
+					})
+				}
+				continue
+			}
+			// nested documents are always validated in full
+			propSchema.validate(joinPath(path, key), v[key], false, errors)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(joinPath(path, fmt.Sprintf("%d", i)), item, false, errors)
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			addError("minLength", "must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			addError("maxLength", "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				addError("pattern", "invalid pattern %s: %s", s.Pattern, err)
+			} else if !re.MatchString(v) {
+				addError("pattern", "must match %s", s.Pattern)
+			}
+		}
+		if s.Format != "" && !matchesFormat(v, s.Format) {
+			addError("format", "must be a valid %s", s.Format)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			addError("minimum", "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			addError("maximum", "must be at most %v", *s.Maximum)
+		}
+	case json.Number:
+		// decimals and big integers are compared exactly
+		n, ok := new(big.Rat).SetString(string(v))
+		if !ok {
+			break
+		}
+		if s.Minimum != nil && n.Cmp(new(big.Rat).SetFloat64(*s.Minimum)) < 0 {
+			addError("minimum", "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n.Cmp(new(big.Rat).SetFloat64(*s.Maximum)) > 0 {
+			addError("maximum", "must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func isOfSchemaType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		switch value.(type) {
+		case float64, json.Number:
+			return true
+		}
+		return false
+	case "integer":
+		if n, ok := value.(json.Number); ok {
+			r, ok := new(big.Rat).SetString(string(n))
+			return ok && r.IsInt()
+		}
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesFormat(value, format string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	}
+	// unknown formats are not validated
+	return true
+}
@@ -0,0 +1,145 @@
+package backends
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var userSchemaDef = RepositoryDefinitionMap{
+	"name": "users",
+	"schema": map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"email", "age"},
+		"properties": map[string]interface{}{
+			"email": map[string]interface{}{"type": "string", "format": "email"},
+			"age":   map[string]interface{}{"type": "integer", "minimum": 0},
+			"role":  map[string]interface{}{"enum": []interface{}{"admin", "user"}},
+			"name":  map[string]interface{}{"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"address": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"city"},
+			},
+		},
+	},
+}
+
+func fieldErrorCodes(errors []*FieldError) map[string]string {
+	codes := map[string]string{}
+	for _, fieldErr := range errors {
+		codes[fieldErr.Field] = fieldErr.Code
+	}
+	return codes
+}
+
+func TestGetSchema(t *testing.T) {
+	if (RepositoryDefinitionMap{}).GetSchema() != nil {
+		t.Error("Expected no schema")
+	}
+	schema := userSchemaDef.GetSchema()
+	if schema == nil {
+		t.Fatal("Expected schema")
+	}
+	if schema.Properties["age"].Minimum == nil || *schema.Properties["age"].Minimum != 0 {
+		t.Errorf("Expected age minimum to be decoded")
+	}
+}
+
+func TestDocumentSchemaValidate(t *testing.T) {
+	schema := userSchemaDef.GetSchema()
+
+	valid := map[string]interface{}{
+		"email": "john@example.com",
+		"age":   30,
+		"role":  "admin",
+		"name":  "John",
+		"tags":  []string{"a", "b"},
+	}
+	if errors := schema.Validate(valid, false); len(errors) != 0 {
+		t.Fatalf("Expected valid document, got %v", fieldErrorCodes(errors))
+	}
+
+	invalid := map[string]interface{}{
+		"email":   "not an email",
+		"age":     1.5,
+		"role":    "guest",
+		"name":    "j",
+		"tags":    []interface{}{"a", 1},
+		"address": map[string]interface{}{},
+	}
+	codes := fieldErrorCodes(schema.Validate(invalid, false))
+	expected := map[string]string{
+		"email":        "format",
+		"age":          "type",
+		"role":         "enum",
+		"name":         "pattern",
+		"tags.1":       "type",
+		"address.city": "required",
+	}
+	for field, code := range expected {
+		if codes[field] != code {
+			t.Errorf("Expected %s error for %s, got %q", code, field, codes[field])
+		}
+	}
+}
+
+func TestDocumentSchemaValidateNumberBounds(t *testing.T) {
+	schema := RepositoryDefinitionMap{
+		"schema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"price": map[string]interface{}{"type": "number", "minimum": 0, "maximum": 100},
+			},
+		},
+	}.GetSchema()
+	for value, code := range map[json.Number]string{
+		"-0.01":                    "minimum",
+		"100.000000000000000001":   "maximum",
+		"123456789012345678901234": "maximum",
+		"0":                        "",
+		"99.99":                    "",
+	} {
+		codes := fieldErrorCodes(schema.Validate(map[string]interface{}{"price": value}, false))
+		if codes["price"] != code {
+			t.Errorf("Expected %q error for %s, got %q", code, value, codes["price"])
+		}
+	}
+}
+
+func TestDocumentSchemaValidatePartial(t *testing.T) {
+	schema := userSchemaDef.GetSchema()
+
+	if errors := schema.Validate(map[string]interface{}{"name": "John"}, true); len(errors) != 0 {
+		t.Errorf("Expected partial document to be valid, got %v", fieldErrorCodes(errors))
+	}
+
+	codes := fieldErrorCodes(schema.Validate(map[string]interface{}{"name": "John"}, false))
+	if codes["email"] != "required" || codes["age"] != "required" {
+		t.Errorf("Expected required errors, got %v", codes)
+	}
+}
+
+func TestValidateDocument(t *testing.T) {
+	if err := validateDocument(map[string]interface{}{"any": 1}, RepositoryDefinitionMap{}, true); err != nil {
+		t.Errorf("Expected no validation without schema, got %s", err)
+	}
+
+	err := validateDocument(map[string]interface{}{"email": "john@example.com"}, userSchemaDef, true)
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	if !IsErrInvalidInput(err) {
+		t.Errorf("Expected invalid input error, got %s", err)
+	}
+	validationErr, ok := err.(*DocumentValidationError)
+	if !ok {
+		t.Fatalf("Expected DocumentValidationError, got %T", err)
+	}
+	if !strings.Contains(validationErr.Details(), "age: is required") {
+		t.Errorf("Unexpected details: %s", validationErr.Details())
+	}
+}
@@ -0,0 +1,308 @@
+package backends
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ErrChecksumMismatch is an error class for a copy of a repository that does not match the source.
+var ErrChecksumMismatch = ErrorClass("checksum mismatch")
+
+// IsErrChecksumMismatch checks if the error is of the ErrChecksumMismatch class.
+func IsErrChecksumMismatch(err error) bool {
+	return IsErrorOfType(err, ErrChecksumMismatch(""))
+}
+
+// CopyOptions configures CopyRepository.
+type CopyOptions struct {
+	// BatchSize is the number of records read from the source at once. Defaults to 100.
+	BatchSize int
+	// OnConflict handles the records that already exist in the target (by id): BootstrapOverwrite
+	// (the default) replaces them, BootstrapSkip keeps them and BootstrapFail stops the copy.
+	OnConflict BootstrapConflictPolicy
+	// Progress, if set, is called after every batch with the number of records copied so far.
+	Progress func(copied int)
+}
+
+// CopyRepository copies the records of the source repository to the target repository, usually on another
+// backend. The records keep their ids, restored as in BackendManager.Restore. The copy can be repeated: the
+// records copied before are overwritten. Returns the number of copied records.
+func CopyRepository(ctx context.Context, source, target Repository, options CopyOptions) (int, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultTransferBatchSize
+	}
+	onConflict := options.OnConflict
+	if onConflict == "" {
+		onConflict = BootstrapOverwrite
+	}
+
+	copied := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		records, err := readRecords(source, nil, batchSize, copied)
+		if err != nil {
+			return copied, err
+		}
+		for _, record := range records {
+			if err := restoreRecord(target, record, onConflict); err != nil {
+				return copied, err
+			}
+			copied++
+		}
+		if options.Progress != nil && len(records) > 0 {
+			options.Progress(copied)
+		}
+		if len(records) < batchSize {
+			return copied, nil
+		}
+	}
+}
+
+// readRecords reads a page of the records of the repository matched by the filter. The map records are
+// returned as they are, MapToInterface would convert the dates and ObjectIDs to strings.
+func readRecords(repo Repository, filter Filter, limit, offset int) ([]map[string]interface{}, error) {
+	page, err := repo.GetAll(filter, map[string]interface{}{}, "", "", limit, offset)
+	if err != nil && !IsErrNotFound(err) {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	err = IterateOverSlice(page, func(i int, item interface{}) error {
+		record, ok := genericRecord(item)
+		if !ok {
+			var err error
+			if record, err = toAuditMap(item); err != nil {
+				return err
+			}
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// Checksum is the checksum of the records of a repository.
+type Checksum struct {
+	// Records is the number of records.
+	Records int
+	// Sum is the hex encoded checksum. It does not depend on the order of the records.
+	Sum string
+}
+
+// RepositoryChecksum computes the checksum of the records of the repository. The records are compared by
+// their JSON values, so the checksums of a record stored on different backends are the same (for example,
+// a date is the same as its RFC3339 string). The ignored properties, such as the timestamps set again by
+// the copy, are not part of the checksum.
+func RepositoryChecksum(ctx context.Context, repo Repository, ignore ...string) (*Checksum, error) {
+	sum := make([]byte, sha256.Size)
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		records, err := readRecords(repo, nil, defaultTransferBatchSize, count)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			digest, err := recordDigest(record, ignore)
+			if err != nil {
+				return nil, err
+			}
+			// XOR does not depend on the order of the records, which differs between the backends
+			for i := range sum {
+				sum[i] ^= digest[i]
+			}
+			count++
+		}
+		if len(records) < defaultTransferBatchSize {
+			return &Checksum{Records: count, Sum: hex.EncodeToString(sum)}, nil
+		}
+	}
+}
+
+// recordDigest returns the SHA-256 of the JSON encoding of the record, without the ignored properties.
+// The keys of the maps are sorted by the JSON encoding.
+func recordDigest(record map[string]interface{}, ignore []string) ([]byte, error) {
+	generic := map[string]interface{}{}
+	if err := MapToInterface(record, &generic); err != nil {
+		return nil, err
+	}
+	delete(generic, "_id")
+	for _, property := range ignore {
+		delete(generic, property)
+	}
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	return digest[:], nil
+}
+
+// VerifyCopy compares the checksums of the source and target repositories. Returns ErrChecksumMismatch if
+// the records differ.
+func VerifyCopy(ctx context.Context, source, target Repository, ignore ...string) error {
+	expected, err := RepositoryChecksum(ctx, source, ignore...)
+	if err != nil {
+		return err
+	}
+	actual, err := RepositoryChecksum(ctx, target, ignore...)
+	if err != nil {
+		return err
+	}
+	if *expected != *actual {
+		return ErrChecksumMismatch(fmt.Sprintf("the source has %d records (%s), the target %d records (%s)",
+			expected.Records, expected.Sum, actual.Records, actual.Sum))
+	}
+	return nil
+}
+
+// TailChanges applies the changes of the source repository to the target repository until the context is
+// done, so the target follows the source while the services still write to it. The source must support
+// change streams (see Watch). Start it before CopyRepository, so no change made during the copy is missed.
+func TailChanges(ctx context.Context, source, target Repository) error {
+	return Watch(ctx, source, func(event *ChangeEvent) error {
+		return applyChange(target, event)
+	})
+}
+
+// applyChange applies the change event to the repository.
+func applyChange(repo Repository, event *ChangeEvent) error {
+	if event.Operation == ChangeDelete {
+		if err := repo.DeleteOne(Filter(event.Key)); err != nil && !IsErrNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	if event.Document == nil {
+		return nil
+	}
+	return restoreRecord(repo, event.Document, BootstrapOverwrite)
+}
+
+// DualWriteRepository writes to two repositories while the data is moved from one backend to another. The
+// primary repository serves the reads and the writes, and every write is repeated on the secondary
+// repository (by id). Cutover swaps the repositories, so the new backend becomes the primary while the old
+// one still gets the writes, in case the migration is rolled back:
+//
+//	repo := backends.NewDualWriteRepository(dynamoUsers, mongoUsers)
+//	// ... copy and verify the records
+//	repo.Cutover()
+//
+// A failed write on the secondary repository does not fail the operation; it is passed to OnMirrorError.
+type DualWriteRepository struct {
+	// OnMirrorError, if set, is called with the errors of the writes on the secondary repository. By default
+	// the errors are logged.
+	OnMirrorError func(err error)
+
+	mutex     sync.RWMutex
+	primary   Repository
+	secondary Repository
+}
+
+// NewDualWriteRepository returns a repository writing to both repositories, with reads from the primary.
+func NewDualWriteRepository(primary, secondary Repository) *DualWriteRepository {
+	return &DualWriteRepository{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// Cutover swaps the primary and the secondary repositories.
+func (d *DualWriteRepository) Cutover() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.primary, d.secondary = d.secondary, d.primary
+}
+
+// Primary returns the repository serving the reads.
+func (d *DualWriteRepository) Primary() Repository {
+	primary, _ := d.repositories()
+	return primary
+}
+
+func (d *DualWriteRepository) repositories() (Repository, Repository) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.primary, d.secondary
+}
+
+func (d *DualWriteRepository) mirrorError(err error) {
+	if d.OnMirrorError != nil {
+		d.OnMirrorError(err)
+		return
+	}
+	log.Printf("ERROR: failed to write to the secondary repository: %s\n", err.Error())
+}
+
+// GetOne reads the record from the primary repository.
+func (d *DualWriteRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	primary, _ := d.repositories()
+	return primary.GetOne(filter, result)
+}
+
+// GetAll reads the records from the primary repository.
+func (d *DualWriteRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	primary, _ := d.repositories()
+	return primary.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// Save saves the record to the primary repository, and the saved record to the secondary repository.
+func (d *DualWriteRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	primary, secondary := d.repositories()
+	result, err := primary.Save(object, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := toAuditMap(result)
+	if err != nil || saved == nil || saved["id"] == nil {
+		d.mirrorError(fmt.Errorf("the saved record has no id: %v", err))
+		return result, nil
+	}
+	// the record is read back, so all of its properties are written with their types
+	records, err := readRecords(primary, Filter{"id": saved["id"]}, 1, 0)
+	if err == nil && len(records) > 0 {
+		err = restoreRecord(secondary, records[0], BootstrapOverwrite)
+	}
+	if err != nil {
+		d.mirrorError(err)
+	}
+	return result, nil
+}
+
+// DeleteOne deletes the record from both repositories.
+func (d *DualWriteRepository) DeleteOne(filter Filter) error {
+	primary, secondary := d.repositories()
+	record := map[string]interface{}{}
+	if _, err := primary.GetOne(copyFilter(filter), &record); err != nil {
+		return err
+	}
+	if err := primary.DeleteOne(filter); err != nil {
+		return err
+	}
+	if err := secondary.DeleteOne(Filter{"id": record["id"]}); err != nil && !IsErrNotFound(err) {
+		d.mirrorError(err)
+	}
+	return nil
+}
+
+// DeleteAll deletes the matched records from both repositories.
+func (d *DualWriteRepository) DeleteAll(filter Filter) error {
+	primary, secondary := d.repositories()
+	if err := primary.DeleteAll(copyFilter(filter)); err != nil {
+		return err
+	}
+	if err := secondary.DeleteAll(filter); err != nil && !IsErrNotFound(err) {
+		d.mirrorError(err)
+	}
+	return nil
+}
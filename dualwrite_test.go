@@ -0,0 +1,151 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// readOnlyRepo is a memoryRepo failing the writes.
+type readOnlyRepo struct {
+	*memoryRepo
+}
+
+func (r *readOnlyRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	return nil, errors.New("read only")
+}
+
+func TestCopyRepository(t *testing.T) {
+	createdAt := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	source := &memoryRepo{}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		source.records = append(source.records, map[string]interface{}{"id": id, "name": "user " + id, "createdAt": createdAt})
+	}
+	target := &memoryRepo{records: []map[string]interface{}{{"id": "2", "name": "old"}}}
+
+	progress := []int{}
+	copied, err := CopyRepository(context.Background(), source, target, CopyOptions{
+		BatchSize: 2,
+		Progress:  func(copied int) { progress = append(progress, copied) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 5 || len(target.records) != 5 || target.records[0]["name"] != "user 2" {
+		t.Fatal("Expected the records to be copied over the existing ones. Got: ", copied, target.records)
+	}
+	if len(progress) != 3 || progress[2] != 5 {
+		t.Fatal("Expected a progress callback per batch. Got: ", progress)
+	}
+	if _, ok := target.records[1]["createdAt"].(time.Time); !ok {
+		t.Fatal("Expected the dates to keep their type. Got: ", target.records[1])
+	}
+
+	if err := VerifyCopy(context.Background(), source, target); err != nil {
+		t.Fatal(err)
+	}
+	target.records[3]["name"] = "changed"
+	if err := VerifyCopy(context.Background(), source, target); !IsErrChecksumMismatch(err) {
+		t.Fatal("Expected ErrChecksumMismatch. Got: ", err)
+	}
+	if err := VerifyCopy(context.Background(), source, target, "name"); err != nil {
+		t.Fatal("Expected the ignored property not to be compared. Got: ", err)
+	}
+}
+
+func TestRepositoryChecksum(t *testing.T) {
+	at := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	first := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "at": at, "count": int64(3)},
+		{"id": "2", "tags": []interface{}{"a"}},
+	}}
+	// the same records in another order, with the types of another backend
+	second := &memoryRepo{records: []map[string]interface{}{
+		{"id": "2", "tags": []interface{}{"a"}},
+		{"id": "1", "at": "2021-06-01T10:00:00Z", "count": float64(3)},
+	}}
+
+	expected, err := RepositoryChecksum(context.Background(), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := RepositoryChecksum(context.Background(), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *expected != *actual || expected.Records != 2 {
+		t.Fatalf("Expected the same checksums. Got: %+v %+v", expected, actual)
+	}
+}
+
+func TestApplyChange(t *testing.T) {
+	target := &memoryRepo{records: []map[string]interface{}{{"id": "1", "name": "ann"}}}
+	events := []*ChangeEvent{
+		{Operation: ChangeInsert, Key: map[string]interface{}{"id": "2"}, Document: map[string]interface{}{"id": "2", "name": "bob"}},
+		{Operation: ChangeUpdate, Key: map[string]interface{}{"id": "1"}, Document: map[string]interface{}{"id": "1", "name": "anne"}},
+		{Operation: ChangeDelete, Key: map[string]interface{}{"id": "3"}},
+		{Operation: ChangeDelete, Key: map[string]interface{}{"id": "2"}},
+	}
+	for _, event := range events {
+		if err := applyChange(target, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(target.records) != 1 || target.records[0]["name"] != "anne" {
+		t.Fatal("Expected the changes to be applied. Got: ", target.records)
+	}
+
+	if err := TailChanges(context.Background(), &memoryRepo{}, target); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a source without change streams. Got: ", err)
+	}
+}
+
+func TestDualWriteRepository(t *testing.T) {
+	old := &memoryRepo{}
+	current := &memoryRepo{}
+	repo := NewDualWriteRepository(old, current)
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "name": "ann"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "anne"}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"id": "2", "name": "bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(current.records) != 2 || current.records[0]["name"] != "anne" {
+		t.Fatal("Expected the writes on the secondary repository. Got: ", current.records)
+	}
+	if err := repo.DeleteOne(Filter{"name": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(old.records) != 1 || len(current.records) != 1 {
+		t.Fatal("Expected the record to be deleted from both repositories. Got: ", old.records, current.records)
+	}
+
+	repo.Cutover()
+	if repo.Primary() != current {
+		t.Fatal("Expected the secondary repository to serve the reads after the cutover")
+	}
+	current.records[0]["name"] = "new"
+	record := map[string]interface{}{}
+	if _, err := repo.GetOne(Filter{"id": "1"}, &record); err != nil || record["name"] != "new" {
+		t.Fatal("Expected the record of the new primary. Got: ", record, err)
+	}
+}
+
+func TestDualWriteMirrorError(t *testing.T) {
+	primary := &memoryRepo{}
+	repo := NewDualWriteRepository(primary, &readOnlyRepo{&memoryRepo{}})
+	mirrorErrors := []error{}
+	repo.OnMirrorError = func(err error) { mirrorErrors = append(mirrorErrors, err) }
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1"}, nil); err != nil {
+		t.Fatal("Expected the write to succeed on the primary. Got: ", err)
+	}
+	if len(primary.records) != 1 || len(mirrorErrors) != 1 {
+		t.Fatal("Expected the error of the secondary repository. Got: ", primary.records, mirrorErrors)
+	}
+}
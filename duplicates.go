@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DuplicateKeyError is returned when a record has the value of a unique index (or of the primary key) that
+// another record already has. It is of the ErrAlreadyExists class and holds the conflicting index, so the
+// API layers can tell which value is taken ("email already taken") instead of reporting a generic conflict.
+type DuplicateKeyError struct {
+	// Collection is the name of the collection or table.
+	Collection string `json:"collection"`
+	// Index is the name of the unique index. It is empty for the primary key of a DynamoDB table.
+	Index string `json:"index,omitempty"`
+	// Fields are the fields of the index, or nil if they are not known.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Error returns the error class message.
+func (e *DuplicateKeyError) Error() string {
+	return ErrAlreadyExists().Error()
+}
+
+// Details returns the conflicting index and its fields.
+func (e *DuplicateKeyError) Details() string {
+	index := "the primary key"
+	if e.Index != "" {
+		index = "the unique index " + e.Index
+	}
+	if len(e.Fields) > 0 {
+		index = fmt.Sprintf("%s (%s)", index, strings.Join(e.Fields, ", "))
+	}
+	return fmt.Sprintf("duplicate value for %s of %s", index, e.Collection)
+}
+
+var (
+	mongoDupIndexPattern = regexp.MustCompile(`index: (\S+)`)
+	mongoDupKeyPattern   = regexp.MustCompile(`dup key: \{ (.*) \}`)
+	mongoDupFieldPattern = regexp.MustCompile(`(?:^|, )([^:,{}\s]+): `)
+)
+
+// mongoDuplicateKeyError parses the index of the E11000 duplicate key error message:
+//
+//	E11000 duplicate key error collection: db.users index: email_1 dup key: { email: "john@example.com" }
+//
+// The older servers report the index as "db.users.$email_1" and do not name the fields in the key.
+// The fields are taken from the index of the repository with that name, or from the key if the index
+// is not declared.
+func mongoDuplicateKeyError(err error, repoDef RepositoryDefinition) *DuplicateKeyError {
+	dupErr := &DuplicateKeyError{Collection: repoDef.GetName()}
+
+	message := err.Error()
+	match := mongoDupIndexPattern.FindStringSubmatch(message)
+	if match == nil {
+		return dupErr
+	}
+	name := match[1]
+	if i := strings.LastIndex(name, ".$"); i >= 0 {
+		name = name[i+2:]
+	}
+	dupErr.Index = name
+
+	if name == "_id_" {
+		dupErr.Fields = []string{"_id"}
+		if !repoDef.IsCustomID() {
+			dupErr.Fields = []string{"id"}
+		}
+		return dupErr
+	}
+	for _, index := range repoDef.GetIndexes() {
+		def := mongoIndex(index)
+		if def.Name == name || (def.Name == "" && mongoIndexName(def.Key) == name) {
+			for _, elem := range mongoIndexKeyDoc(def.Key) {
+				dupErr.Fields = append(dupErr.Fields, elem.Name)
+			}
+			return dupErr
+		}
+	}
+	if key := mongoDupKeyPattern.FindStringSubmatch(message); key != nil {
+		for _, field := range mongoDupFieldPattern.FindAllStringSubmatch(key[1], -1) {
+			dupErr.Fields = append(dupErr.Fields, field[1])
+		}
+	}
+	return dupErr
+}
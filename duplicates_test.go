@@ -0,0 +1,55 @@
+package backends
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMongoDuplicateKeyError(t *testing.T) {
+	repoDef := RepositoryDefinitionMap{
+		"name": "users",
+		"indexes": []Index{
+			NewUniqueIndex("email"),
+			NewIndex("tenant_username", true, "tenant", "-username"),
+		},
+	}
+
+	cases := map[string]*DuplicateKeyError{
+		`E11000 duplicate key error collection: db.users index: email_1 dup key: { email: "john@example.com" }`: {
+			Collection: "users", Index: "email_1", Fields: []string{"email"},
+		},
+		`E11000 duplicate key error index: db.users.$tenant_username dup key: { : "acme", : "john" }`: {
+			Collection: "users", Index: "tenant_username", Fields: []string{"tenant", "username"},
+		},
+		`E11000 duplicate key error collection: db.users index: _id_ dup key: { _id: ObjectId('5cf0029caff5056591b0ce7d') }`: {
+			Collection: "users", Index: "_id_", Fields: []string{"id"},
+		},
+		`E11000 duplicate key error collection: db.users index: phone_1_country_1 dup key: { phone: "555", country: "MK" }`: {
+			Collection: "users", Index: "phone_1_country_1", Fields: []string{"phone", "country"},
+		},
+		`E11000 duplicate key error`: {
+			Collection: "users",
+		},
+	}
+	for message, expected := range cases {
+		dupErr := mongoDuplicateKeyError(errors.New(message), repoDef)
+		if !reflect.DeepEqual(dupErr, expected) {
+			t.Errorf("Expected %#v for %q, got %#v", expected, message, dupErr)
+		}
+		if !IsErrAlreadyExists(dupErr) {
+			t.Errorf("Expected an ErrAlreadyExists error for %q", message)
+		}
+	}
+}
+
+func TestDuplicateKeyErrorDetails(t *testing.T) {
+	dupErr := &DuplicateKeyError{Collection: "users", Index: "email_1", Fields: []string{"email"}}
+	if details := dupErr.Details(); details != "duplicate value for the unique index email_1 (email) of users" {
+		t.Fatal("Unexpected details: ", details)
+	}
+	dupErr = &DuplicateKeyError{Collection: "users", Fields: []string{"id"}}
+	if details := dupErr.Details(); details != "duplicate value for the primary key (id) of users" {
+		t.Fatal("Unexpected details: ", details)
+	}
+}
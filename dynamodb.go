@@ -2,20 +2,22 @@ package backends
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/guregu/dynamo"
-	"github.com/satori/go.uuid"
 )
 
 // DYNAMO_CTX_KEY is dynamoDB context key
@@ -25,6 +27,15 @@ var DYNAMO_CTX_KEY = "DYNAMO_SESSION"
 type DynamoCollection struct {
 	*dynamo.Table
 	RepositoryDefinition
+	tracker        *operationTracker
+	consistentRead bool
+	accessPaths    []*dynamoAccessPath
+	session        *session.Session
+	options        BackendOptions
+	unique         *dynamoUniqueness
+	sequence       *dynamo.Table
+	operation      OperationOptions
+	maintenance    *maintenanceState
 }
 
 type patternCondition struct {
@@ -56,8 +67,26 @@ func DynamoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposit
 		return nil, ErrBackendError("table name is missing and required")
 	}
 
+	billing, err := dynamoBillingFor(repoDef, optionsFromBackend(backend))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validIDGenerator(repoDef.GetIDGenerator()); err != nil {
+		return nil, err
+	}
+	if err := validIDType(repoDef.GetIDType()); err != nil {
+		return nil, err
+	}
+	if err := validFieldNaming(repoDef.GetFieldNaming()); err != nil {
+		return nil, err
+	}
+	if err := validAttribution(repoDef.GetAttribution()); err != nil {
+		return nil, err
+	}
+
 	svc := dynamodb.New(sessionAWS)
-	err := createTable(svc, repoDef)
+	err = createTable(svc, repoDef, billing)
 	if err != nil {
 		return nil, err
 	}
@@ -67,18 +96,54 @@ func DynamoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposit
 		return nil, err
 	}
 
+	if billing.autoScaling != nil {
+		if err = registerAutoScaling(sessionAWS, svc, tableName, billing.autoScaling); err != nil {
+			return nil, err
+		}
+	}
+
 	db := dynamo.New(sessionAWS)
 	table := db.Table(tableName)
 
+	unique, err := newDynamoUniqueness(svc, db, repoDef)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, err := newDynamoSequence(svc, db, repoDef)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DynamoCollection{
 		&table,
 		repoDef,
+		trackerFromBackend(backend),
+		repoDef.IsConsistentRead(),
+		describeAccessPaths(svc, repoDef),
+		sessionAWS,
+		optionsFromBackend(backend),
+		unique,
+		sequence,
+		OperationOptions{},
+		maintenanceFromBackend(backend),
 	}, nil
 }
 
 // DynamoDBBackendBuilder returns RepositoriesBackend
+// If neither static credentials nor a credentials file are configured, the default AWS
+// credential chain is used (environment, shared config, web identity tokens (IRSA), ECS task role
+// and EC2 instance profile).
+// Additionally, a role can be assumed with the "assumeRoleArn" (and optional "assumeRoleExternalId",
+// "assumeRoleSessionName" and "assumeRoleDuration") dynamodb backend options.
+// The retries of throttled requests are configured with the "retryMode" and "maxRetries" options.
 func DynamoDBBackendBuilder(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
 
+	options := manager.GetBackendOptions("dynamodb")
+	if err := validOverflow(options.GetString("maintenanceOverflow")); err != nil {
+		return nil, err
+	}
+
 	staticCredentials := dbInfo.AWSSecretKeyID != "" || dbInfo.AWSSecretAccessKey != "" || dbInfo.AWSSessionToken != ""
 
 	if staticCredentials {
@@ -88,8 +153,6 @@ func DynamoDBBackendBuilder(dbInfo *config.DBInfo, manager BackendManager) (Back
 		if dbInfo.AWSSecretAccessKey == "" {
 			return nil, ErrBackendError("AWSSecretAccessKey missing")
 		}
-	} else if dbInfo.AWSCredentials == "" {
-		return nil, ErrBackendError("either AWSCredentials file or AWSSecretKeyID/AWSSecretAccessKey must be specified")
 	}
 
 	if dbInfo.AWSRegion == "" {
@@ -100,34 +163,127 @@ func DynamoDBBackendBuilder(dbInfo *config.DBInfo, manager BackendManager) (Back
 		Region: aws.String(dbInfo.AWSRegion),
 	}
 
+	if maxRetries := options.GetInt("maxRetries"); maxRetries > 0 {
+		configAWS.MaxRetries = aws.Int(maxRetries)
+	}
+
 	if dbInfo.AWSEndpoint != "" {
 		configAWS.Endpoint = aws.String(dbInfo.AWSEndpoint)
 		log.Println("Using AWS Endpoint: ", dbInfo.AWSEndpoint)
 	}
 
 	if staticCredentials {
-		log.Println("Using static AWS Credentials.")
-		configAWS.Credentials = credentials.NewStaticCredentials(dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken)
+		if hasSecretReference(dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken) {
+			log.Println("Using AWS Credentials from secrets.")
+			configAWS.Credentials = credentials.NewCredentials(&secretCredentialsProvider{
+				refs:     []string{dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken},
+				interval: options.GetDuration("credentialsRefreshInterval"),
+			})
+		} else {
+			log.Println("Using static AWS Credentials.")
+			configAWS.Credentials = credentials.NewStaticCredentials(dbInfo.AWSSecretKeyID, dbInfo.AWSSecretAccessKey, dbInfo.AWSSessionToken)
+		}
 	}
 
 	if dbInfo.AWSCredentials != "" {
 		log.Println("Using Shared AWS Credentials from file.")
 		configAWS.Credentials = credentials.NewSharedCredentials(dbInfo.AWSCredentials, "")
 	}
-	sess, err := session.NewSession(configAWS)
+
+	if !staticCredentials && dbInfo.AWSCredentials == "" {
+		log.Println("Using the default AWS credential chain.")
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *configAWS,
+		SharedConfigState: session.SharedConfigEnable,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if roleARN := options.GetString("assumeRoleArn"); roleARN != "" {
+		log.Println("Assuming AWS role: ", roleARN)
+		configAWS.Credentials = stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+			if externalID := options.GetString("assumeRoleExternalId"); externalID != "" {
+				p.ExternalID = aws.String(externalID)
+			}
+			if sessionName := options.GetString("assumeRoleSessionName"); sessionName != "" {
+				p.RoleSessionName = sessionName
+			}
+			if duration := options.GetDuration("assumeRoleDuration"); duration > 0 {
+				p.Duration = duration
+			}
+		})
+		sess, err = session.NewSession(configAWS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = setupDynamoRetries(sess, options); err != nil {
+		return nil, err
+	}
+	if options.GetBool("reportCapacity") {
+		setupDynamoCapacity(sess, dbInfo.DatabaseName)
+	}
+
+	capabilities := dynamoCapabilities(dbInfo.AWSEndpoint)
+	if err = capabilities.checkRequired(options); err != nil {
+		return nil, err
+	}
+
 	ctx := context.WithValue(context.Background(), DYNAMO_CTX_KEY, sess)
+	ctx = context.WithValue(ctx, OPTIONS_CTX_KEY, options)
+	ctx = context.WithValue(ctx, CAPABILITIES_CTX_KEY, capabilities)
+	if ctx, err = withOfflineJournal(ctx, dbInfo, options); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, HEALTH_CHECK_CTX_KEY, func() error {
+		_, err := dynamodb.New(sess).ListTables(&dynamodb.ListTablesInput{Limit: aws.Int64(1)})
+		return err
+	})
 	cleanup := func() {}
 
 	return NewRepositoriesBackend(ctx, dbInfo, DynamoDBRepoBuilder, cleanup), nil
 
 }
 
-// createTable creates table if it does not exist
-func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
+// secretCredentialsProvider provides AWS credentials from environment variables or secret files.
+// The credentials are re-read after the refresh interval expires, so rotated secrets are picked up
+// without restarting the service. If the interval is 0, the credentials are read only once.
+type secretCredentialsProvider struct {
+	refs      []string
+	interval  time.Duration
+	retrieved time.Time
+}
+
+// Retrieve reads the credentials from the secret references.
+func (p *secretCredentialsProvider) Retrieve() (credentials.Value, error) {
+	values, err := resolveSecrets(p.refs)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	p.retrieved = time.Now()
+	return credentials.Value{
+		AccessKeyID:     values[0],
+		SecretAccessKey: values[1],
+		SessionToken:    values[2],
+		ProviderName:    "SecretCredentialsProvider",
+	}, nil
+}
+
+// IsExpired returns true when the credentials should be re-read.
+func (p *secretCredentialsProvider) IsExpired() bool {
+	if p.retrieved.IsZero() {
+		return true
+	}
+	return p.interval > 0 && time.Since(p.retrieved) > p.interval
+}
+
+// createTable creates table if it does not exist. The billing mode and the secondary indexes of an
+// existing table are reconciled with the repository definition.
+func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition, billing *dynamoBilling) error {
 	result, err := svc.ListTables(&dynamodb.ListTablesInput{})
 	if err != nil {
 		return err
@@ -143,7 +299,10 @@ func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
 	rangeKey := repoDef.GetRangeKey()
 
 	if contains(tableNames, tableName) {
-		return nil
+		if err := reconcileBilling(svc, repoDef, billing); err != nil {
+			return err
+		}
+		return updateSecondaryIndexes(svc, repoDef, billing)
 	}
 
 	if hashKey != "" {
@@ -207,23 +366,26 @@ func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
 				Projection: &dynamodb.Projection{
 					ProjectionType: aws.String("ALL"),
 				},
-				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-					ReadCapacityUnits:  aws.Int64(int64(v["readCapacity"].(int))),
-					WriteCapacityUnits: aws.Int64(int64(v["writeCapacity"].(int))),
-				},
+				ProvisionedThroughput: billing.throughput(int64(v["readCapacity"].(int)), int64(v["writeCapacity"].(int))),
 			})
 		}
 	}
 
+	indexes, err := dynamoSecondaryIndexes(repoDef, billing)
+	if err != nil {
+		return err
+	}
+	attributes = mergeAttributeDefinitions(attributes, indexes.attributeDefinitions())
+	globalSecondaryIndexes = append(globalSecondaryIndexes, indexes.global...)
+
 	input := &dynamodb.CreateTableInput{
 		AttributeDefinitions:   attributes,
 		KeySchema:              keySchemaElements,
 		GlobalSecondaryIndexes: globalSecondaryIndexes,
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(repoDef.GetReadCapacity()),
-			WriteCapacityUnits: aws.Int64(repoDef.GetWriteCapacity()),
-		},
-		TableName: aws.String(tableName),
+		LocalSecondaryIndexes:  indexes.local,
+		BillingMode:            aws.String(billing.mode),
+		ProvisionedThroughput:  billing.throughput(repoDef.GetReadCapacity(), repoDef.GetWriteCapacity()),
+		TableName:              aws.String(tableName),
 	}
 
 	// Create the table
@@ -234,39 +396,25 @@ func createTable(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
 
 	log.Printf("Table created: %v\n", cto)
 
-	return nil
-}
-
-// setTTL sets TimeToLive to the table
-func setTTL(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
-
-	if repoDef.EnableTTL() {
-		enabled := repoDef.EnableTTL()
-		attribute := repoDef.GetTTLAttribute()
-		tableName := repoDef.GetName()
-		TTL := repoDef.GetTTL()
-
-		if attribute == "" {
-			return ErrBackendError("TTL attribute is reqired when TTL is enabled")
-		}
-
-		if TTL == 0 {
-			return ErrBackendError("TTL value is missing and must be greater than zero")
-		}
-
-		err := svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{
-			TableName: &tableName,
-		})
-		if err != nil {
-			return nil
-		}
-
-		svc.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
-			TableName: &tableName,
-			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
-				AttributeName: &attribute,
-				Enabled:       &enabled,
-			},
+	if len(indexes.global) == 0 && len(indexes.local) == 0 {
+		return nil
+	}
+	if err = waitForIndexes(svc, tableName); err != nil {
+		return err
+	}
+	indexNames := []string{}
+	for _, index := range indexes.global {
+		indexNames = append(indexNames, aws.StringValue(index.IndexName))
+	}
+	for _, index := range indexes.local {
+		indexNames = append(indexNames, aws.StringValue(index.IndexName))
+	}
+	for _, indexName := range indexNames {
+		Events.Publish(&Event{
+			Type:       EventIndexCreated,
+			Backend:    "dynamodb",
+			Repository: tableName,
+			Index:      indexName,
 		})
 	}
 
@@ -279,33 +427,46 @@ func setTTL(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
 // 		"id":    "54acb6c5-baeb-4213-b10f-e707a6055e64",
 // }
 func (c *DynamoCollection) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 
-	var record map[string]interface{}
-	var records []map[string]interface{}
-
-	var query []string
-	var args []interface{}
-	for k, v := range filter {
-		query = append(query, "$ = ?")
-		args = append(args, k)
-		args = append(args, v)
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
 	}
 
-	if c.RepositoryDefinition.EnableTTL() {
-		query = append(query, "$ > ?")
-		args = append(args, c.RepositoryDefinition.GetTTLAttribute())
-		args = append(args, time.Now())
+	var item map[string]*dynamodb.AttributeValue
+
+	if query, _ := c.planQuery(filter); query != nil {
+		itr := query.Iter()
+		if !itr.Next(&item) {
+			if err := itr.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrNotFound("Record not found")
+		}
+	} else {
+		var items []map[string]*dynamodb.AttributeValue
+		query, args := c.filterConditions(filter)
+		err := c.projectScan(c.Table.Scan()).Filter(strings.Join(query, " AND "), args...).Consistent(c.consistentRead).Limit(int64(1)).All(&items)
+		if err != nil {
+			return nil, err
+		}
+		if items == nil {
+			return nil, ErrNotFound("Record not found")
+		}
+		item = items[0]
 	}
 
-	err := c.Table.Scan().Filter(strings.Join(query, " AND "), args...).Limit(int64(1)).All(&records)
+	record, err := unmarshalRecord(item)
 	if err != nil {
 		return nil, err
 	}
-	if records == nil {
-		return nil, ErrNotFound("Record not found")
-	}
-
-	record = records[0]
 	err = MapToInterface(&record, &result)
 	if err != nil {
 		return nil, err
@@ -314,61 +475,63 @@ func (c *DynamoCollection) GetOne(filter Filter, result interface{}) (interface{
 }
 
 // GetAll returns all matched records. You can specify limit and offset as well.
+// If the filter matches the partition key of the table or of a secondary index exactly, the records are
+// read with a Query on that key (sorted by the sort key, if order is the sort key), otherwise the table is scanned.
 func (c *DynamoCollection) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
-	var results reflect.Value
-
-	resultHint := AsPtr(resultsTypeHint)
-
-	results = NewSliceOfType(resultHint)
-
-	var query []string
-	var args []interface{}
-	for k, v := range filter {
-		if specs, ok := v.(map[string]interface{}); ok {
-			if pattern, ok := specs["$pattern"]; ok {
-				for _, cond := range patternToDynamodbCondition(pattern.(string)) {
-					query = append(query, fmt.Sprintf("$ %s ?", cond.condition))
-					args = append(args, k)
-					args = append(args, cond.value)
-				}
-			}
-			continue
-		}
-		query = append(query, "$ = ?")
-		args = append(args, k)
-		args = append(args, v)
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
 	}
+	defer done()
 
-	if c.RepositoryDefinition.EnableTTL() {
-		query = append(query, "$ > ?")
-		args = append(args, c.RepositoryDefinition.GetTTLAttribute())
-		args = append(args, time.Now())
+	if err := checkQueryFields(c.RepositoryDefinition, filter, order); err != nil {
+		return nil, err
 	}
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
+	}
+	itr, _ := c.iter(filter, order, sorting, nil, nil)
+	return collectRecords(itr, resultsTypeHint, limit, offset)
+}
 
-	startFrom := 1
-	if offset != 0 {
-		startFrom = offset + 1
+// collectRecords reads the records from the iterator into a slice of pointers of the type of the hint,
+// skipping the first offset records. All records are read if the limit is 0.
+func collectRecords(itr dynamo.Iter, resultsTypeHint interface{}, limit, offset int) (interface{}, error) {
+	resultHint := AsPtr(resultsTypeHint)
+	if _, ok := resultHint.(*map[string]interface{}); ok {
+		// the records read into maps are collected without reflection
+		results := []*map[string]interface{}{}
+		for i := 0; limit == 0 || i < offset+limit; i++ {
+			record := &map[string]interface{}{}
+			if !itr.Next(record) {
+				break
+			}
+			if i >= offset {
+				results = append(results, record)
+			}
+		}
+		if itr.Err() != nil {
+			return nil, itr.Err()
+		}
+		return results, nil
 	}
 
-	itr := c.Table.Scan().Filter(strings.Join(query, " AND "), args...).SearchLimit(int64(startFrom)).Iter()
-	for i := 0; ; i++ {
+	results := NewSliceOfType(resultHint)
+	for i := 0; limit == 0 || i < offset+limit; i++ {
 		record, err := CreateNewAsExample(resultHint)
 		if err != nil {
 			return nil, err
 		}
-		more := itr.Next(record)
-		if itr.Err() != nil {
-			return nil, itr.Err()
-		}
-		if !more {
+		if !itr.Next(record) {
 			break
 		}
-		if limit != 0 && i >= limit {
-			break
+		if i < offset {
+			continue
 		}
-		results = reflect.ValueOf(reflect.Append(results, reflect.ValueOf(record)).Interface())
-
-		itr = c.Table.Scan().StartFrom(itr.LastEvaluatedKey()).SearchLimit(1).Iter()
+		results = reflect.Append(results, reflect.ValueOf(record))
+	}
+	if itr.Err() != nil {
+		return nil, itr.Err()
 	}
 
 	return results.Interface(), nil
@@ -376,10 +539,35 @@ func (c *DynamoCollection) GetAll(filter Filter, resultsTypeHint interface{}, or
 
 // Save creates new item or updates the existing one
 func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := c.maintenance.gate(c.operation.Context, c.RepositoryDefinition, JournalSave, object, filter); err != nil {
+		return object, err
+	}
+	journaled := copyFilter(filter)
+	result, err := c.save(object, filter)
+	if queued := c.maintenance.queueUnreachable(c.operation.Context, c.RepositoryDefinition, JournalSave, object, journaled, err); queued != nil {
+		return object, queued
+	}
+	return result, err
+}
+
+// save inserts or updates the record, once the write passed the maintenance gate.
+func (c *DynamoCollection) save(object interface{}, filter Filter) (interface{}, error) {
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
+	}
 
 	var result interface{}
 
-	payload, err := InterfaceToMap(object)
+	payload, err := c.prepareItem(object, filter == nil)
 	if err != nil {
 		return nil, err
 	}
@@ -387,24 +575,12 @@ func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{},
 	hashKey := c.RepositoryDefinition.GetHashKey()
 	rangeKey := c.RepositoryDefinition.GetRangeKey()
 
+	if c.unique != nil {
+		return c.saveUnique(payload, filter)
+	}
+
 	if filter == nil {
 		// Create item
-		if _, ok := (*payload)["id"]; !ok {
-			id, err := uuid.NewV4()
-			if err != nil {
-				return nil, err
-			}
-
-			(*payload)["id"] = id.String()
-		}
-
-		if c.RepositoryDefinition.EnableTTL() {
-			attribute := c.RepositoryDefinition.GetTTLAttribute()
-			TTL := c.RepositoryDefinition.GetTTL()
-
-			(*payload)[attribute] = time.Now().Add(time.Second * time.Duration(TTL))
-		}
-
 		av, err := dynamodbattribute.MarshalMap(payload)
 		if err != nil {
 			return nil, err
@@ -413,19 +589,27 @@ func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{},
 		err = c.Table.Put(av).If("attribute_not_exists($)", hashKey).Run()
 		if err != nil {
 			if IsConditionalCheckErr(err) {
-				return nil, ErrAlreadyExists("record already exists!")
+				dupErr := &DuplicateKeyError{Collection: c.RepositoryDefinition.GetName(), Fields: []string{hashKey}}
+				if rangeKey != "" {
+					dupErr.Fields = append(dupErr.Fields, rangeKey)
+				}
+				return nil, dupErr
 			}
 			return nil, err
 		}
 	} else {
 		// Update item
 
-		var item interface{}
-		_, err = c.GetOne(filter, &item)
-		if err != nil {
-			return nil, err
+		res, ok := c.filterKey(filter)
+		if !ok {
+			// the key of the record is read first
+			var item interface{}
+			_, err = c.GetOne(filter, &item)
+			if err != nil {
+				return nil, err
+			}
+			res = item.(map[string]interface{})
 		}
-		res := item.(map[string]interface{})
 
 		query := c.Table.Update(hashKey, res[hashKey])
 		if rangeKey != "" {
@@ -438,13 +622,24 @@ func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{},
 			}
 		}
 
-		var updatedItem map[string]interface{}
+		// the record must exist (and must not be expired), the update must not create it
+		query = query.If(c.existsCondition(Filter{}))
+
+		// the updated record is returned with ReturnValues=ALL_NEW
+		var updatedItem map[string]*dynamodb.AttributeValue
 		err = query.Value(&updatedItem)
 		if err != nil {
+			if IsConditionalCheckErr(err) {
+				return nil, ErrNotFound("Record not found")
+			}
 			return nil, err
 		}
 
-		payload = &updatedItem
+		updated, err := unmarshalRecord(updatedItem)
+		if err != nil {
+			return nil, err
+		}
+		payload = &updated
 	}
 
 	err = MapToInterface(payload, &result)
@@ -455,12 +650,142 @@ func (c *DynamoCollection) Save(object interface{}, filter Filter) (interface{},
 	return result, nil
 }
 
+// filterKey returns the key of the record if the filter matches exactly the key of the table (the hash key
+// and the range key, if the table has one), so the record can be updated without reading it first.
+func (c *DynamoCollection) filterKey(filter Filter) (map[string]interface{}, bool) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+
+	keys := []string{hashKey}
+	if rangeKey != "" {
+		keys = append(keys, rangeKey)
+	}
+	if len(filter) != len(keys) {
+		return nil, false
+	}
+	key := map[string]interface{}{}
+	for _, property := range keys {
+		value, ok := filter[property]
+		if !ok || value == nil || isFilterSpec(value) {
+			return nil, false
+		}
+		key[property] = value
+	}
+	return key, true
+}
+
+// prepareItem converts the object to the item payload, validates it and sets the timestamps and the TTL.
+// New items get a generated id unless one is set.
+func (c *DynamoCollection) prepareItem(object interface{}, create bool) (*map[string]interface{}, error) {
+	payload, err := interfaceToMap(object, c.RepositoryDefinition.GetFieldNaming())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDocument(*payload, c.RepositoryDefinition, create); err != nil {
+		return nil, err
+	}
+
+	applyTimestamps(*payload, c.RepositoryDefinition, create)
+	if err := applyAttribution(*payload, c.RepositoryDefinition, create, ActorFromContext(c.operation.Context)); err != nil {
+		return nil, err
+	}
+
+	if create {
+		if err := generateID(*payload, c.RepositoryDefinition.GetIDGenerator(), IDUUIDv4, c.nextSequence); err != nil {
+			return nil, err
+		}
+	}
+	if id, ok := (*payload)["id"]; ok && c.RepositoryDefinition.GetIDType() != "" {
+		value, err := toIDValue(id, c.RepositoryDefinition.GetIDType())
+		if err != nil {
+			return nil, err
+		}
+		(*payload)["id"] = value
+	}
+
+	if err := applyDynamoTTL(*payload, c.RepositoryDefinition, create); err != nil {
+		return nil, err
+	}
+	*payload = dynamoValues(*payload)
+	return payload, nil
+}
+
+// unmarshalRecord decodes a DynamoDB item to a record. Unlike dynamo.UnmarshalItem, whole numbers are
+// decoded to int64, and the numbers beyond the precision of float64 to json.Number, so they are read
+// back exactly.
+func unmarshalRecord(item map[string]*dynamodb.AttributeValue) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(item))
+	for name, av := range item {
+		value, err := unmarshalAttribute(av)
+		if err != nil {
+			return nil, err
+		}
+		record[name] = value
+	}
+	return record, nil
+}
+
+func unmarshalAttribute(av *dynamodb.AttributeValue) (interface{}, error) {
+	switch {
+	case av.N != nil:
+		if i, err := strconv.ParseInt(*av.N, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(*av.N, 64); err == nil && isExactFloat(*av.N, f) {
+			return f, nil
+		}
+		// the decimals beyond the precision of float64 are read as exact numbers
+		return json.Number(*av.N), nil
+	case av.L != nil:
+		list := make([]interface{}, 0, len(av.L))
+		for _, item := range av.L {
+			value, err := unmarshalAttribute(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case av.M != nil:
+		return unmarshalRecord(av.M)
+	}
+	var value interface{}
+	err := dynamodbattribute.Unmarshal(av, &value)
+	return value, err
+}
+
 // DeleteOne deletes only one item at the time
 // Example filter:
 //	filter := map[string]interface{}{
 // 		"email": "keitaro-user1@keitaro.com",
 // }
 func (c *DynamoCollection) DeleteOne(filter Filter) error {
+	done, err := c.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return err
+	}
+	if err := c.maintenance.gate(c.operation.Context, c.RepositoryDefinition, JournalDeleteOne, nil, filter); err != nil {
+		return err
+	}
+	journaled := copyFilter(filter)
+	err = c.deleteOne(filter)
+	if queued := c.maintenance.queueUnreachable(c.operation.Context, c.RepositoryDefinition, JournalDeleteOne, nil, journaled, err); queued != nil {
+		return queued
+	}
+	return err
+}
+
+// deleteOne deletes the matched record, once the write passed the maintenance gate.
+func (c *DynamoCollection) deleteOne(filter Filter) error {
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return err
+	}
 
 	hashKey := c.RepositoryDefinition.GetHashKey()
 	rangeKey := c.RepositoryDefinition.GetRangeKey()
@@ -472,6 +797,10 @@ func (c *DynamoCollection) DeleteOne(filter Filter) error {
 	}
 	result := item.(map[string]interface{})
 
+	if c.unique != nil {
+		return c.deleteUnique(result, nil)
+	}
+
 	query := c.Table.Delete(hashKey, result[hashKey])
 
 	if rangeKey != "" {
@@ -498,20 +827,56 @@ func (c *DynamoCollection) DeleteOne(filter Filter) error {
 // 		}
 // email is the hash key, id is the range key
 func (c *DynamoCollection) DeleteAll(filter Filter) error {
+	_, err := c.DeleteAllWithOptions(filter, DeleteOptions{})
+	return err
+}
+
+// DeleteAllWithOptions deletes all matched records and returns the number of deleted records.
+// On a dry run, the matched records are counted. The filter must match the hash key.
+func (c *DynamoCollection) DeleteAllWithOptions(filter Filter, options DeleteOptions) (int, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, ""); err != nil {
+		return 0, err
+	}
+	if options.DryRun {
+		return c.deleteAll(filter, options)
+	}
+	if err := c.maintenance.gate(c.operation.Context, c.RepositoryDefinition, JournalDeleteAll, nil, filter); err != nil {
+		return 0, err
+	}
+	journaled := copyFilter(filter)
+	deleted, err := c.deleteAll(filter, options)
+	if queued := c.maintenance.queueUnreachable(c.operation.Context, c.RepositoryDefinition, JournalDeleteAll, nil, journaled, err); queued != nil {
+		return 0, queued
+	}
+	return deleted, err
+}
+
+// deleteAll deletes (or counts, on a dry run) the matched records.
+func (c *DynamoCollection) deleteAll(filter Filter, options DeleteOptions) (int, error) {
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return 0, err
+	}
 	hashKey := c.RepositoryDefinition.GetHashKey()
 	rangeKey := c.RepositoryDefinition.GetRangeKey()
 
 	if _, ok := filter[hashKey]; !ok {
-		return ErrInvalidInput("range hash key must be provided")
+		return 0, ErrInvalidInput("range hash key must be provided")
 	}
 
 	batchSize := 128
 	offset := 0
+	count := 0
 
 	for {
 		resultsIntf, err := c.GetAll(filter, &map[string]interface{}{}, hashKey, "ascending", batchSize, offset)
 		if err != nil {
-			return err
+			return count, err
 		}
 		results := resultsIntf.([]*map[string]interface{})
 
@@ -519,19 +884,35 @@ func (c *DynamoCollection) DeleteAll(filter Filter) error {
 			break
 		}
 
+		if options.DryRun {
+			count += len(results)
+			offset += len(results)
+			continue
+		}
+
+		// the deleted records are no longer matched, so the next batch starts from the beginning;
+		// an eventually consistent read may still return records that are already deleted
+		deleted := 0
 		for _, result := range results {
 			delFilter := NewFilter().Match(hashKey, (*result)[hashKey])
 			if rangeKey != "" {
 				delFilter = delFilter.Match(rangeKey, (*result)[rangeKey])
 			}
 			if err = c.DeleteOne(delFilter); err != nil {
-				return err
+				if IsErrNotFound(err) {
+					continue
+				}
+				return count, err
 			}
+			deleted++
 		}
-		offset += len(results)
+		if deleted == 0 {
+			break
+		}
+		count += deleted
 	}
 
-	return nil
+	return count, nil
 }
 
 func patternToDynamodbCondition(pattern string) []*patternCondition {
@@ -0,0 +1,166 @@
+package backends
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// filesBucket returns the S3 bucket of the files ("filesBucket" backend option).
+func (c *DynamoCollection) filesBucket() (string, error) {
+	bucket := c.options.GetString("filesBucket")
+	if bucket == "" {
+		return "", ErrBackendError("the filesBucket option is not set, files are not supported")
+	}
+	return bucket, nil
+}
+
+// fileKey returns the S3 key of the file: the files of a table are kept under the "<table>/" prefix.
+func (c *DynamoCollection) fileKey(name string) string {
+	return c.RepositoryDefinition.GetName() + "/" + name
+}
+
+// SaveFile uploads the file to S3. Large files are uploaded in parts, so the content is not read into memory.
+func (c *DynamoCollection) SaveFile(name, contentType string, content io.Reader) (*FileInfo, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := c.maintenance.check(c.RepositoryDefinition); err != nil {
+		return nil, err
+	}
+	bucket, err := c.filesBucket()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(c.fileKey(name)),
+		Body:   &countingReader{reader: content},
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if _, err := s3manager.NewUploader(c.session).Upload(input); err != nil {
+		return nil, err
+	}
+	return &FileInfo{
+		Name:        name,
+		ContentType: contentType,
+		Size:        input.Body.(*countingReader).count,
+		UploadedAt:  time.Now(),
+	}, nil
+}
+
+// CreateFile returns a writer that uploads the file to S3 while it is written.
+func (c *DynamoCollection) CreateFile(name, contentType string) (io.WriteCloser, error) {
+	if err := c.maintenance.check(c.RepositoryDefinition); err != nil {
+		return nil, err
+	}
+	if _, err := c.filesBucket(); err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.SaveFile(name, contentType, reader)
+		// a failed upload fails the following writes
+		reader.CloseWithError(err)
+		done <- err
+	}()
+	return &s3FileWriter{PipeWriter: writer, done: done}, nil
+}
+
+// GetFile opens the S3 object of the file.
+func (c *DynamoCollection) GetFile(name string) (io.ReadCloser, *FileInfo, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+
+	bucket, err := c.filesBucket()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err := s3.New(c.session).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(c.fileKey(name)),
+	})
+	if err != nil {
+		if awsErrorCode(err) == s3.ErrCodeNoSuchKey {
+			return nil, nil, ErrNotFound(fmt.Sprintf("file %s not found", name))
+		}
+		return nil, nil, err
+	}
+	return output.Body, &FileInfo{
+		Name:        name,
+		ContentType: aws.StringValue(output.ContentType),
+		Size:        aws.Int64Value(output.ContentLength),
+		UploadedAt:  aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+// DeleteFile deletes the S3 object of the file.
+func (c *DynamoCollection) DeleteFile(name string) error {
+	done, err := c.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := c.maintenance.check(c.RepositoryDefinition); err != nil {
+		return err
+	}
+	bucket, err := c.filesBucket()
+	if err != nil {
+		return err
+	}
+
+	svc := s3.New(c.session)
+	key := c.fileKey(name)
+	// S3 deletes are idempotent, so the file is checked first to report the missing files
+	_, err = svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		if code := awsErrorCode(err); code == "NotFound" || code == s3.ErrCodeNoSuchKey {
+			return ErrNotFound(fmt.Sprintf("file %s not found", name))
+		}
+		return err
+	}
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	return err
+}
+
+// s3FileWriter writes the content to the upload. Close waits for the upload to complete.
+type s3FileWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (w *s3FileWriter) Close() error {
+	if err := w.PipeWriter.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+// countingReader counts the bytes read from the reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
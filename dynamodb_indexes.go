@@ -0,0 +1,287 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// dynamoIndexPollInterval is the interval between the checks of the index status while waiting for
+// the indexes to become ACTIVE.
+var dynamoIndexPollInterval = 5 * time.Second
+
+// dynamoIndexes holds the DynamoDB secondary indexes of a repository and the definitions of the indexed attributes.
+type dynamoIndexes struct {
+	local      []*dynamodb.LocalSecondaryIndex
+	global     []*dynamodb.GlobalSecondaryIndex
+	attributes map[string]string
+}
+
+// attributeDefinitions returns the attribute definitions for the indexed attributes, in a stable order.
+func (d *dynamoIndexes) attributeDefinitions() []*dynamodb.AttributeDefinition {
+	names := map[string]interface{}{}
+	for name := range d.attributes {
+		names[name] = nil
+	}
+	attributes := []*dynamodb.AttributeDefinition{}
+	for _, name := range sortedKeys(names) {
+		attributes = append(attributes, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String(d.attributes[name]),
+		})
+	}
+	return attributes
+}
+
+func (d *dynamoIndexes) addAttribute(name, attributeType string) error {
+	if existing, ok := d.attributes[name]; ok && existing != attributeType {
+		return ErrBackendError(fmt.Sprintf("attribute %s is indexed as %s and %s", name, existing, attributeType))
+	}
+	d.attributes[name] = attributeType
+	return nil
+}
+
+// dynamoSecondaryIndexes builds the DynamoDB secondary indexes for the indexes of the repository definition.
+// Indexes that are not a SecondaryIndex are global indexes with all attributes projected and the capacity of the table.
+// The global indexes of on-demand tables have no provisioned throughput.
+func dynamoSecondaryIndexes(repoDef RepositoryDefinition, billing *dynamoBilling) (*dynamoIndexes, error) {
+	indexes := &dynamoIndexes{
+		attributes: map[string]string{},
+	}
+
+	hashKeyType := repoDef.GetHashKeyType()
+	if hashKeyType == "" {
+		hashKeyType = "S"
+	}
+	rangeKeyType := repoDef.GetRangeKeyType()
+	if rangeKeyType == "" {
+		rangeKeyType = "S"
+	}
+
+	for _, index := range repoDef.GetIndexes() {
+		name := index.GetName()
+		fields := []string{}
+		for _, field := range index.GetFields() {
+			fields = append(fields, strings.TrimPrefix(field, "-"))
+		}
+
+		spec, ok := index.(SecondaryIndex)
+		if !ok {
+			spec = NewIndexSpec(index.GetFields()...).Named(name)
+		}
+
+		attributeType := func(field string) string {
+			switch field {
+			case repoDef.GetHashKey():
+				return hashKeyType
+			case repoDef.GetRangeKey():
+				return rangeKeyType
+			}
+			return spec.GetAttributeType(field)
+		}
+
+		projectionType, nonKeyAttributes := spec.GetProjection()
+		projection := &dynamodb.Projection{
+			ProjectionType: aws.String(projectionType),
+		}
+		if projectionType == ProjectInclude {
+			projection.NonKeyAttributes = aws.StringSlice(nonKeyAttributes)
+		}
+
+		if spec.Local() {
+			if len(fields) != 1 {
+				return nil, ErrBackendError(fmt.Sprintf("local index %s must have exactly one (sort key) field", name))
+			}
+			if repoDef.GetRangeKey() == "" {
+				return nil, ErrBackendError(fmt.Sprintf("local index %s requires a table with a range key", name))
+			}
+			if err := indexes.addAttribute(fields[0], attributeType(fields[0])); err != nil {
+				return nil, err
+			}
+			indexes.local = append(indexes.local, &dynamodb.LocalSecondaryIndex{
+				IndexName: aws.String(name),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String(repoDef.GetHashKey()), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String(fields[0]), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: projection,
+			})
+			continue
+		}
+
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, ErrBackendError(fmt.Sprintf("global index %s must have one or two fields", name))
+		}
+		keySchema := []*dynamodb.KeySchemaElement{}
+		for i, field := range fields {
+			keyType := dynamodb.KeyTypeHash
+			if i == 1 {
+				keyType = dynamodb.KeyTypeRange
+			}
+			if err := indexes.addAttribute(field, attributeType(field)); err != nil {
+				return nil, err
+			}
+			keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+				AttributeName: aws.String(field),
+				KeyType:       aws.String(keyType),
+			})
+		}
+
+		readCapacity, writeCapacity := spec.GetThroughput()
+		if readCapacity == 0 {
+			readCapacity = repoDef.GetReadCapacity()
+		}
+		if writeCapacity == 0 {
+			writeCapacity = repoDef.GetWriteCapacity()
+		}
+		indexes.global = append(indexes.global, &dynamodb.GlobalSecondaryIndex{
+			IndexName:             aws.String(name),
+			KeySchema:             keySchema,
+			Projection:            projection,
+			ProvisionedThroughput: billing.throughput(readCapacity, writeCapacity),
+		})
+	}
+
+	return indexes, nil
+}
+
+// mergeAttributeDefinitions adds the attribute definitions that are not already defined.
+func mergeAttributeDefinitions(attributes []*dynamodb.AttributeDefinition, additional []*dynamodb.AttributeDefinition) []*dynamodb.AttributeDefinition {
+	defined := map[string]bool{}
+	for _, attribute := range attributes {
+		defined[aws.StringValue(attribute.AttributeName)] = true
+	}
+	for _, attribute := range additional {
+		if !defined[aws.StringValue(attribute.AttributeName)] {
+			attributes = append(attributes, attribute)
+			defined[aws.StringValue(attribute.AttributeName)] = true
+		}
+	}
+	return attributes
+}
+
+// updateSecondaryIndexes creates the global secondary indexes that are missing on an existing table,
+// and updates the provisioned throughput of the existing ones, unless the capacity is auto-scaled.
+// The indexes are created one at a time, waiting for each to become ACTIVE. Local secondary indexes
+// can only be created with the table, so the missing ones are reported in the log.
+func updateSecondaryIndexes(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition, billing *dynamoBilling) error {
+	indexes, err := dynamoSecondaryIndexes(repoDef, billing)
+	if err != nil {
+		return err
+	}
+	if len(indexes.local) == 0 && len(indexes.global) == 0 {
+		return nil
+	}
+
+	tableName := repoDef.GetName()
+	result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+
+	localIndexes := map[string]bool{}
+	for _, index := range result.Table.LocalSecondaryIndexes {
+		localIndexes[aws.StringValue(index.IndexName)] = true
+	}
+	for _, index := range indexes.local {
+		if !localIndexes[aws.StringValue(index.IndexName)] {
+			log.Printf("WARN: local index %s cannot be added to the existing table %s\n", aws.StringValue(index.IndexName), tableName)
+		}
+	}
+
+	globalIndexes := map[string]*dynamodb.GlobalSecondaryIndexDescription{}
+	for _, index := range result.Table.GlobalSecondaryIndexes {
+		globalIndexes[aws.StringValue(index.IndexName)] = index
+	}
+
+	for _, index := range indexes.global {
+		update := &dynamodb.GlobalSecondaryIndexUpdate{}
+		existing, ok := globalIndexes[aws.StringValue(index.IndexName)]
+		switch {
+		case !ok:
+			update.Create = &dynamodb.CreateGlobalSecondaryIndexAction{
+				IndexName:             index.IndexName,
+				KeySchema:             index.KeySchema,
+				Projection:            index.Projection,
+				ProvisionedThroughput: index.ProvisionedThroughput,
+			}
+		case billing.autoScaling == nil && throughputChanged(existing.ProvisionedThroughput, index.ProvisionedThroughput):
+			update.Update = &dynamodb.UpdateGlobalSecondaryIndexAction{
+				IndexName:             index.IndexName,
+				ProvisionedThroughput: index.ProvisionedThroughput,
+			}
+		default:
+			continue
+		}
+
+		_, err := svc.UpdateTable(&dynamodb.UpdateTableInput{
+			TableName:                   aws.String(tableName),
+			AttributeDefinitions:        indexes.attributeDefinitions(),
+			GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{update},
+		})
+		if err != nil {
+			return err
+		}
+		if err = waitForIndexes(svc, tableName); err != nil {
+			return err
+		}
+
+		if update.Create != nil {
+			Events.Publish(&Event{
+				Type:       EventIndexCreated,
+				Backend:    "dynamodb",
+				Repository: tableName,
+				Index:      aws.StringValue(index.IndexName),
+			})
+		}
+	}
+
+	return nil
+}
+
+func throughputChanged(existing *dynamodb.ProvisionedThroughputDescription, throughput *dynamodb.ProvisionedThroughput) bool {
+	if existing == nil || throughput == nil {
+		return false
+	}
+	// on-demand tables report zero capacity
+	if aws.Int64Value(existing.ReadCapacityUnits) == 0 && aws.Int64Value(existing.WriteCapacityUnits) == 0 {
+		return false
+	}
+	return aws.Int64Value(existing.ReadCapacityUnits) != aws.Int64Value(throughput.ReadCapacityUnits) ||
+		aws.Int64Value(existing.WriteCapacityUnits) != aws.Int64Value(throughput.WriteCapacityUnits)
+}
+
+// waitForIndexes waits until the table and all of its global secondary indexes are ACTIVE.
+func waitForIndexes(svc *dynamodb.DynamoDB, tableName string) error {
+	for {
+		result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		})
+		if err != nil {
+			return err
+		}
+		if indexesActive(result.Table) {
+			return nil
+		}
+		log.Printf("Waiting for the indexes of table %s to become active...\n", tableName)
+		time.Sleep(dynamoIndexPollInterval)
+	}
+}
+
+func indexesActive(table *dynamodb.TableDescription) bool {
+	if aws.StringValue(table.TableStatus) != dynamodb.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexStatus) != dynamodb.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
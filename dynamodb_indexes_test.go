@@ -0,0 +1,102 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestDynamoSecondaryIndexes(t *testing.T) {
+	indexes, err := dynamoSecondaryIndexes(RepositoryDefinitionMap{
+		"name":          "users",
+		"hashKey":       "tenant",
+		"rangeKey":      "id",
+		"readCapacity":  int64(5),
+		"writeCapacity": int64(2),
+		"indexes": []Index{
+			NewNonUniqueIndex("email"),
+			NewIndexSpec("status", "-createdAt").Named("status-created").
+				Project(ProjectInclude, "name").
+				WithThroughput(10, 1).
+				WithAttributeType("createdAt", "N"),
+			NewIndexSpec("name").Named("tenant-name").AsLocal().Project(ProjectKeysOnly),
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(indexes.global) != 2 || len(indexes.local) != 1 {
+		t.Fatalf("Expected 2 global and 1 local index, got %d and %d", len(indexes.global), len(indexes.local))
+	}
+
+	email := indexes.global[0]
+	if aws.StringValue(email.IndexName) != "email" || aws.StringValue(email.Projection.ProjectionType) != ProjectAll {
+		t.Errorf("Unexpected email index: %v", email)
+	}
+	if aws.Int64Value(email.ProvisionedThroughput.ReadCapacityUnits) != 5 {
+		t.Errorf("Expected the table capacity, got %v", email.ProvisionedThroughput)
+	}
+
+	status := indexes.global[1]
+	if len(status.KeySchema) != 2 || aws.StringValue(status.KeySchema[1].AttributeName) != "createdAt" ||
+		aws.StringValue(status.KeySchema[1].KeyType) != dynamodb.KeyTypeRange {
+		t.Errorf("Unexpected key schema: %v", status.KeySchema)
+	}
+	if aws.Int64Value(status.ProvisionedThroughput.ReadCapacityUnits) != 10 || len(status.Projection.NonKeyAttributes) != 1 {
+		t.Errorf("Unexpected status index: %v", status)
+	}
+
+	local := indexes.local[0]
+	if aws.StringValue(local.KeySchema[0].AttributeName) != "tenant" || aws.StringValue(local.KeySchema[1].AttributeName) != "name" {
+		t.Errorf("Unexpected local key schema: %v", local.KeySchema)
+	}
+
+	if indexes.attributes["createdAt"] != "N" || indexes.attributes["email"] != "S" || len(indexes.attributes) != 4 {
+		t.Errorf("Unexpected attributes: %v", indexes.attributes)
+	}
+}
+
+func TestDynamoSecondaryIndexesInvalid(t *testing.T) {
+	for _, index := range []Index{
+		NewIndexSpec("a", "b").AsLocal(),
+		NewIndexSpec("a", "b", "c"),
+	} {
+		_, err := dynamoSecondaryIndexes(RepositoryDefinitionMap{
+			"name":     "users",
+			"hashKey":  "id",
+			"rangeKey": "createdAt",
+			"indexes":  []Index{index},
+		}, nil)
+		if err == nil {
+			t.Errorf("Expected an error for %v", index.GetFields())
+		}
+	}
+
+	_, err := dynamoSecondaryIndexes(RepositoryDefinitionMap{
+		"name":    "users",
+		"hashKey": "id",
+		"indexes": []Index{NewIndexSpec("name").AsLocal()},
+	}, nil)
+	if err == nil {
+		t.Error("Expected an error for a local index on a table without range key")
+	}
+}
+
+func TestIndexesActive(t *testing.T) {
+	table := &dynamodb.TableDescription{
+		TableStatus: aws.String(dynamodb.TableStatusActive),
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndexDescription{
+			{IndexStatus: aws.String(dynamodb.IndexStatusActive)},
+			{IndexStatus: aws.String(dynamodb.IndexStatusCreating)},
+		},
+	}
+	if indexesActive(table) {
+		t.Fatal("Expected the indexes to be inactive while creating")
+	}
+	table.GlobalSecondaryIndexes[1].IndexStatus = aws.String(dynamodb.IndexStatusActive)
+	if !indexesActive(table) {
+		t.Fatal("Expected the indexes to be active")
+	}
+}
@@ -0,0 +1,425 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// dynamoAccessPath is a key schema that can be queried: the table key schema or the key schema of a secondary index.
+type dynamoAccessPath struct {
+	// Index is the name of the index, empty for the table.
+	Index    string
+	HashKey  string
+	RangeKey string
+	// Global is true for global secondary indexes, which do not support consistent reads.
+	Global bool
+}
+
+// dynamoQueryPlan is a Query on an access path. The filter properties that are not part of the
+// key condition are applied as a filter expression.
+type dynamoQueryPlan struct {
+	path       *dynamoAccessPath
+	hashValue  interface{}
+	rangeOp    dynamo.Operator
+	rangeValue interface{}
+	filter     Filter
+}
+
+// describeAccessPaths reads the key schemas of the table and its secondary indexes. If the table cannot be
+// described, the table key schema from the repository definition is used.
+func describeAccessPaths(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) []*dynamoAccessPath {
+	result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(repoDef.GetName()),
+	})
+	if err != nil {
+		log.Printf("WARN: failed to describe table %s, using the key schema from the definition: %s\n", repoDef.GetName(), err.Error())
+		return []*dynamoAccessPath{
+			&dynamoAccessPath{
+				HashKey:  repoDef.GetHashKey(),
+				RangeKey: repoDef.GetRangeKey(),
+			},
+		}
+	}
+	return accessPathsFromTable(result.Table)
+}
+
+// accessPathsFromTable returns the access paths of the table, starting with the table key schema,
+// then the local and the global secondary indexes.
+func accessPathsFromTable(table *dynamodb.TableDescription) []*dynamoAccessPath {
+	paths := []*dynamoAccessPath{accessPathFromKeySchema("", table.KeySchema, false)}
+	for _, index := range table.LocalSecondaryIndexes {
+		paths = append(paths, accessPathFromKeySchema(aws.StringValue(index.IndexName), index.KeySchema, false))
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		paths = append(paths, accessPathFromKeySchema(aws.StringValue(index.IndexName), index.KeySchema, true))
+	}
+	return paths
+}
+
+func accessPathFromKeySchema(index string, keySchema []*dynamodb.KeySchemaElement, global bool) *dynamoAccessPath {
+	path := &dynamoAccessPath{
+		Index:  index,
+		Global: global,
+	}
+	for _, key := range keySchema {
+		switch aws.StringValue(key.KeyType) {
+		case dynamodb.KeyTypeHash:
+			path.HashKey = aws.StringValue(key.AttributeName)
+		case dynamodb.KeyTypeRange:
+			path.RangeKey = aws.StringValue(key.AttributeName)
+		}
+	}
+	return path
+}
+
+// planDynamoQuery selects the access path for the filter. The filter must match the partition (hash) key
+// of the access path exactly; access paths whose sort (range) key is also covered by the filter are preferred,
+// then the table over the indexes. Returns nil if no access path can be used and the table must be scanned.
+func planDynamoQuery(paths []*dynamoAccessPath, filter Filter) *dynamoQueryPlan {
+	var best *dynamoQueryPlan
+	for _, path := range paths {
+		if path.HashKey == "" {
+			continue
+		}
+		hashValue, ok := filter[path.HashKey]
+		if !ok {
+			continue
+		}
+		if isFilterSpec(hashValue) {
+			continue
+		}
+
+		plan := &dynamoQueryPlan{
+			path:      path,
+			hashValue: hashValue,
+			filter:    Filter{},
+		}
+		for key, value := range filter {
+			if key != path.HashKey {
+				plan.filter[key] = value
+			}
+		}
+		if rangeValue, ok := filter[path.RangeKey]; ok && path.RangeKey != "" {
+			plan.rangeOp, plan.rangeValue = rangeCondition(rangeValue)
+			if plan.rangeOp != "" {
+				delete(plan.filter, path.RangeKey)
+			}
+		}
+
+		if best == nil || (best.rangeOp == "" && plan.rangeOp != "") {
+			best = plan
+		}
+	}
+	return best
+}
+
+// rangeCondition returns the key condition for the sort key value: an exact match, or a prefix
+// match for patterns like "abc%". Returns empty operator if the value cannot be a key condition.
+func rangeCondition(value interface{}) (dynamo.Operator, interface{}) {
+	pattern, ok := parsePatternFilter(value)
+	if !ok {
+		if isFilterSpec(value) {
+			return "", nil
+		}
+		return dynamo.Equal, value
+	}
+	conditions := pattern.dynamoConditions()
+	if len(conditions) != 1 {
+		return "", nil
+	}
+	switch conditions[0].condition {
+	case "EQ":
+		return dynamo.Equal, conditions[0].value
+	case "BEGINS_WITH":
+		return dynamo.BeginsWith, conditions[0].value
+	}
+	return "", nil
+}
+
+// dynamoConditions returns the conditions of the pattern. DynamoDB has no case-insensitive comparisons,
+// so the patterns are always matched case-sensitively.
+func (p *patternFilter) dynamoConditions() []*patternCondition {
+	if p.caseInsensitive {
+		log.Printf("WARN: case-insensitive pattern %s is matched case-sensitively on DynamoDB\n", p.value)
+	}
+	switch p.kind {
+	case patternPrefix:
+		return []*patternCondition{{condition: "BEGINS_WITH", value: p.value}}
+	case patternSuffix:
+		return []*patternCondition{{condition: "CONTAINS", value: p.value}}
+	}
+	conditions := patternToDynamodbCondition(p.value)
+	if p.unanchored {
+		for _, cond := range conditions {
+			cond.condition = "CONTAINS"
+		}
+	}
+	return conditions
+}
+
+// expression returns the filter expression of the condition.
+func (p *patternCondition) expression() string {
+	switch p.condition {
+	case "BEGINS_WITH":
+		return "begins_with($, ?)"
+	case "CONTAINS":
+		return "contains($, ?)"
+	}
+	return "$ = ?"
+}
+
+// filterContains returns the values of a Contains filter value.
+func filterContains(value interface{}) ([]interface{}, bool) {
+	if specs, ok := value.(map[string]interface{}); ok {
+		values, ok := specs["$all"].([]interface{})
+		return values, ok
+	}
+	return nil, false
+}
+
+// filterElemMatch returns the filter of an ElemMatch filter value.
+func filterElemMatch(value interface{}) (Filter, bool) {
+	if specs, ok := value.(map[string]interface{}); ok {
+		match, ok := specs["$elemMatch"].(Filter)
+		return match, ok
+	}
+	return nil, false
+}
+
+// filterExists returns the value of an Exists filter value.
+func filterExists(value interface{}) (bool, bool) {
+	if specs, ok := value.(map[string]interface{}); ok {
+		exists, ok := specs["$exists"].(bool)
+		return exists, ok
+	}
+	return false, false
+}
+
+// filterNull returns the value of an IsNull filter value.
+func filterNull(value interface{}) (bool, bool) {
+	if specs, ok := value.(map[string]interface{}); ok {
+		null, ok := specs["$null"].(bool)
+		return null, ok
+	}
+	return false, false
+}
+
+// dynamoCondition returns the filter expression of the date range on the property. The dates stored as
+// RFC3339 strings and as epoch seconds (the TTL attributes) are compared separately, as DynamoDB compares
+// only values of the same type. Bounds that are not dates are compared as strings.
+func (d *dateRange) dynamoCondition(property string) (string, []interface{}) {
+	stringConditions, epochConditions := []string{}, []string{}
+	stringArgs, epochArgs := []interface{}{}, []interface{}{}
+	epoch := true
+	for _, bound := range []struct {
+		operator string
+		value    interface{}
+	}{{">=", d.since}, {"<=", d.until}} {
+		if bound.value == nil {
+			continue
+		}
+		stringConditions = append(stringConditions, "$ "+bound.operator+" ?")
+		stringArgs = append(stringArgs, property, dateString(bound.value))
+		t, err := dateBound(bound.value)
+		if err != nil {
+			epoch = false
+			continue
+		}
+		epochConditions = append(epochConditions, "$ "+bound.operator+" ?")
+		epochArgs = append(epochArgs, property, t.Unix())
+	}
+	condition := strings.Join(stringConditions, " AND ")
+	if !epoch {
+		return condition, stringArgs
+	}
+	return fmt.Sprintf("((%s) OR (%s))", condition, strings.Join(epochConditions, " AND ")), append(stringArgs, epochArgs...)
+}
+
+// isFilterSpec checks if the filter value is a pattern or an array filter rather than an exact match.
+func isFilterSpec(value interface{}) bool {
+	_, isPattern := parsePatternFilter(value)
+	_, isContains := filterContains(value)
+	_, isElemMatch := filterElemMatch(value)
+	_, isExists := filterExists(value)
+	_, isNull := filterNull(value)
+	_, isDateRange := filterDateRange(value)
+	return isPattern || isContains || isElemMatch || isExists || isNull || isDateRange
+}
+
+// filterConditions builds the filter expression for the filter: exact matches, patterns, array filters
+// (contains() of every value for Contains, contains() of the whole element for ElemMatch) and
+// Exists and IsNull (attribute_exists(), attribute_not_exists() and attribute_type()) and date ranges.
+// The expired records are excluded if TTL is enabled for the repository.
+func (c *DynamoCollection) filterConditions(filter Filter) ([]string, []interface{}) {
+	var query []string
+	var args []interface{}
+	for k, v := range filter {
+		if pattern, ok := parsePatternFilter(v); ok {
+			for _, cond := range pattern.dynamoConditions() {
+				query = append(query, cond.expression())
+				args = append(args, k)
+				args = append(args, cond.value)
+			}
+			continue
+		}
+		if values, ok := filterContains(v); ok {
+			for _, value := range values {
+				query = append(query, "contains($, ?)")
+				args = append(args, k, value)
+			}
+			continue
+		}
+		if match, ok := filterElemMatch(v); ok {
+			query = append(query, "contains($, ?)")
+			args = append(args, k, map[string]interface{}(match))
+			continue
+		}
+		if dates, ok := filterDateRange(v); ok {
+			condition, dateArgs := dates.dynamoCondition(k)
+			query = append(query, condition)
+			args = append(args, dateArgs...)
+			continue
+		}
+		if exists, ok := filterExists(v); ok {
+			if exists {
+				query = append(query, "attribute_exists($)")
+			} else {
+				query = append(query, "attribute_not_exists($)")
+			}
+			args = append(args, k)
+			continue
+		}
+		if null, ok := filterNull(v); ok {
+			if null {
+				query = append(query, "attribute_type($, ?)")
+				args = append(args, k, "NULL")
+			} else {
+				query = append(query, "(attribute_exists($) AND NOT attribute_type($, ?))")
+				args = append(args, k, k, "NULL")
+			}
+			continue
+		}
+		query = append(query, "$ = ?")
+		args = append(args, k)
+		args = append(args, v)
+	}
+
+	if c.RepositoryDefinition.EnableTTL() {
+		// the TTL attribute holds the epoch time; records saved before the TTL was
+		// converted to epoch time hold the expiry date as RFC3339 string
+		now := time.Now()
+		attribute := c.RepositoryDefinition.GetTTLAttribute()
+		query = append(query, "($ > ? OR $ > ?)")
+		args = append(args, attribute, now.Unix(), attribute, now)
+	}
+	return query, args
+}
+
+// existsCondition returns the condition expression that the record exists and, if the filter is not nil,
+// matches the filter (an expired record does not match any filter).
+func (c *DynamoCollection) existsCondition(filter Filter) (string, []interface{}) {
+	conditions := []string{"attribute_exists($)"}
+	args := []interface{}{c.RepositoryDefinition.GetHashKey()}
+	if filter != nil {
+		filterConditions, filterArgs := c.filterConditions(filter)
+		conditions = append(conditions, filterConditions...)
+		args = append(args, filterArgs...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// planQuery returns the Query for the filter and the queried access path, or nil if the table must be
+// scanned. On a Scan, an EventRepositoryScan event is published, so the slow and expensive reads can be detected.
+func (c *DynamoCollection) planQuery(filter Filter) (*dynamo.Query, *dynamoAccessPath) {
+	plan := planDynamoQuery(c.accessPaths, filter)
+	if plan == nil {
+		Events.Publish(&Event{
+			Type:       EventRepositoryScan,
+			Backend:    "dynamodb",
+			Repository: c.RepositoryDefinition.GetName(),
+			Attributes: c.operation.TraceAttributes,
+		})
+		return nil, nil
+	}
+
+	query := c.Table.Get(plan.path.HashKey, plan.hashValue)
+	if properties := c.projection(); properties != nil {
+		query = query.Project(properties...)
+	}
+	if plan.path.Index != "" {
+		query = query.Index(plan.path.Index)
+	}
+	if plan.rangeOp != "" {
+		query = query.Range(plan.path.RangeKey, plan.rangeOp, plan.rangeValue)
+	}
+	if conditions, args := c.filterConditions(plan.filter); len(conditions) > 0 {
+		query = query.Filter(strings.Join(conditions, " AND "), args...)
+	}
+	// global secondary indexes support only eventually consistent reads
+	return query.Consistent(c.consistentRead && !plan.path.Global), plan.path
+}
+
+// iter returns the iterator over the records matching the filter, starting after startKey (nil to start from
+// the first record). The iterator follows LastEvaluatedKey, so the results are not truncated at the 1MB
+// response limit of DynamoDB. Results of a Query on the sort key are in descending order if sorting is "desc".
+// The returned access paths hold the key attributes that identify the position of a record in the results.
+// The consumed capacity is added to cc, if it is not nil.
+func (c *DynamoCollection) iter(filter Filter, order, sorting string, startKey dynamo.PagingKey, cc *dynamo.ConsumedCapacity) (dynamo.PagingIter, []*dynamoAccessPath) {
+	if query, path := c.planQuery(filter); query != nil {
+		if cc != nil {
+			query = query.ConsumedCapacity(cc)
+		}
+		if order != "" && order == path.RangeKey && sorting == "desc" {
+			query = query.Order(dynamo.Descending)
+		}
+		if startKey != nil {
+			query = query.StartFrom(startKey)
+		}
+		return query.Iter(), []*dynamoAccessPath{c.tablePath(), path}
+	}
+
+	scan := c.projectScan(c.Table.Scan()).Consistent(c.consistentRead)
+	if conditions, args := c.filterConditions(filter); len(conditions) > 0 {
+		scan = scan.Filter(strings.Join(conditions, " AND "), args...)
+	}
+	if startKey != nil {
+		scan = scan.StartFrom(startKey)
+	}
+	if cc != nil {
+		scan = scan.ConsumedCapacity(cc)
+	}
+	return scan.Iter(), []*dynamoAccessPath{c.tablePath()}
+}
+
+// tablePath returns the access path of the table key schema.
+func (c *DynamoCollection) tablePath() *dynamoAccessPath {
+	for _, path := range c.accessPaths {
+		if path.Index == "" {
+			return path
+		}
+	}
+	return &dynamoAccessPath{
+		HashKey:  c.RepositoryDefinition.GetHashKey(),
+		RangeKey: c.RepositoryDefinition.GetRangeKey(),
+	}
+}
+
+// pagingKey returns the key of the item on the access paths. Used as ExclusiveStartKey, it continues the
+// Query or Scan right after the item.
+func pagingKey(item map[string]*dynamodb.AttributeValue, paths ...*dynamoAccessPath) dynamo.PagingKey {
+	key := dynamo.PagingKey{}
+	for _, path := range paths {
+		for _, attribute := range []string{path.HashKey, path.RangeKey} {
+			if value, ok := item[attribute]; ok && attribute != "" {
+				key[attribute] = value
+			}
+		}
+	}
+	return key
+}
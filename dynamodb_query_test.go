@@ -0,0 +1,195 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+func testAccessPaths() []*dynamoAccessPath {
+	return accessPathsFromTable(&dynamodb.TableDescription{
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("tenant"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		LocalSecondaryIndexes: []*dynamodb.LocalSecondaryIndexDescription{
+			{
+				IndexName: aws.String("tenant-name-index"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("tenant"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String("name"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+			},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndexDescription{
+			{
+				IndexName: aws.String("email-index"),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("email"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+				},
+			},
+		},
+	})
+}
+
+func TestAccessPathsFromTable(t *testing.T) {
+	paths := testAccessPaths()
+	if len(paths) != 3 {
+		t.Fatal("Expected 3 access paths. Got: ", len(paths))
+	}
+	if paths[0].Index != "" || paths[0].HashKey != "tenant" || paths[0].RangeKey != "id" {
+		t.Fatal("Unexpected table key schema: ", paths[0])
+	}
+	if paths[1].Index != "tenant-name-index" || paths[1].Global || paths[1].RangeKey != "name" {
+		t.Fatal("Unexpected local index: ", paths[1])
+	}
+	if paths[2].Index != "email-index" || !paths[2].Global || paths[2].HashKey != "email" {
+		t.Fatal("Unexpected global index: ", paths[2])
+	}
+}
+
+func TestPlanDynamoQuery(t *testing.T) {
+	paths := testAccessPaths()
+
+	cases := []struct {
+		filter  Filter
+		index   string
+		rangeOp dynamo.Operator
+		rest    int
+	}{
+		{NewFilter().Match("tenant", "t1"), "", "", 0},
+		{NewFilter().Match("tenant", "t1").Match("id", "1"), "", dynamo.Equal, 0},
+		{NewFilter().Match("tenant", "t1").MatchPattern("name", "Jo%"), "tenant-name-index", dynamo.BeginsWith, 0},
+		{NewFilter().Match("tenant", "t1").MatchPattern("name", "%oh%"), "", "", 1},
+		{NewFilter().Match("email", "john@example.com").Match("active", true), "email-index", "", 1},
+		{NewFilter().Match("tenant", "t1").Contains("name", "John"), "", "", 1},
+		{NewFilter().Match("tenant", "t1").MatchPrefix("name", "Jo%"), "tenant-name-index", dynamo.BeginsWith, 0},
+		{NewFilter().Match("tenant", "t1").MatchPatternWith("name", "Jo", PatternOptions{Unanchored: true}), "", "", 1},
+	}
+	for _, c := range cases {
+		plan := planDynamoQuery(paths, c.filter)
+		if plan == nil {
+			t.Errorf("Expected a query for %v", c.filter)
+			continue
+		}
+		if plan.path.Index != c.index || plan.rangeOp != c.rangeOp || len(plan.filter) != c.rest {
+			t.Errorf("Unexpected plan for %v: index=%s range=%s filter=%v", c.filter, plan.path.Index, plan.rangeOp, plan.filter)
+		}
+	}
+
+	for _, filter := range []Filter{
+		NewFilter().Match("name", "John"),
+		NewFilter().MatchPattern("tenant", "t%"),
+		NewFilter().Contains("tenant", "t1"),
+		NewFilter(),
+	} {
+		if plan := planDynamoQuery(paths, filter); plan != nil {
+			t.Errorf("Expected a scan for %v, got a query on %s", filter, plan.path.Index)
+		}
+	}
+}
+
+func TestFilterConditionsArrayFilters(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{},
+	}
+
+	query, args := repo.filterConditions(NewFilter().Contains("tags", "go", "aws"))
+	if len(query) != 2 || query[0] != "contains($, ?)" || args[0] != "tags" || args[1] != "go" || args[3] != "aws" {
+		t.Fatal("Unexpected conditions: ", query, args)
+	}
+
+	query, args = repo.filterConditions(NewFilter().ElemMatch("roles", NewFilter().Match("name", "admin")))
+	if len(query) != 1 || query[0] != "contains($, ?)" || args[0] != "roles" {
+		t.Fatal("Unexpected conditions: ", query, args)
+	}
+	if element, ok := args[1].(map[string]interface{}); !ok || element["name"] != "admin" {
+		t.Fatal("Expected the element to be matched as a map, got ", args[1])
+	}
+}
+
+func TestFilterConditionsPatterns(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{},
+	}
+
+	cases := []struct {
+		filter     Filter
+		expression string
+		value      string
+	}{
+		{NewFilter().MatchPattern("name", "Jo%"), "begins_with($, ?)", "Jo"},
+		{NewFilter().MatchPattern("name", "John"), "$ = ?", "John"},
+		{NewFilter().MatchPatternWith("name", "John", PatternOptions{Unanchored: true}), "contains($, ?)", "John"},
+		{NewFilter().MatchPrefix("name", "50%"), "begins_with($, ?)", "50%"},
+		{NewFilter().MatchSuffix("email", "@example.com"), "contains($, ?)", "@example.com"},
+	}
+	for _, c := range cases {
+		query, args := repo.filterConditions(c.filter)
+		if len(query) != 1 || query[0] != c.expression || args[1] != c.value {
+			t.Errorf("Unexpected conditions for %v: %v %v", c.filter, query, args)
+		}
+	}
+}
+
+func TestFilterConditionsNullFilters(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{},
+	}
+
+	cases := []struct {
+		filter     Filter
+		expression string
+		args       int
+	}{
+		{NewFilter().Exists("deletedAt", true), "attribute_exists($)", 1},
+		{NewFilter().Exists("deletedAt", false), "attribute_not_exists($)", 1},
+		{NewFilter().IsNull("manager", true), "attribute_type($, ?)", 2},
+		{NewFilter().IsNull("manager", false), "(attribute_exists($) AND NOT attribute_type($, ?))", 3},
+	}
+	for _, c := range cases {
+		query, args := repo.filterConditions(c.filter)
+		if len(query) != 1 || query[0] != c.expression || len(args) != c.args {
+			t.Errorf("Unexpected conditions for %v: %v %v", c.filter, query, args)
+		}
+	}
+
+	if plan := planDynamoQuery(testAccessPaths(), NewFilter().Exists("tenant", true)); plan != nil {
+		t.Error("Expected a scan for an Exists filter on the hash key")
+	}
+}
+
+func TestFilterConditionsDateRange(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{},
+	}
+	since := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 0, 7)
+
+	query, args := repo.filterConditions(NewFilter().Between("createdAt", since, until))
+	if len(query) != 1 || query[0] != "(($ >= ? AND $ <= ?) OR ($ >= ? AND $ <= ?))" {
+		t.Fatal("Unexpected conditions: ", query)
+	}
+	if args[1] != "2019-05-01T00:00:00Z" || args[3] != "2019-05-08T00:00:00Z" || args[5] != since.Unix() || args[7] != until.Unix() {
+		t.Fatal("Unexpected arguments: ", args)
+	}
+
+	query, args = repo.filterConditions(Filter{"createdAt": map[string]interface{}{"$since": "2019-05"}})
+	if len(query) != 1 || query[0] != "$ >= ?" || args[1] != "2019-05" {
+		t.Fatal("Expected a string comparison for a partial date, got ", query, args)
+	}
+}
+
+func BenchmarkFilterConditions(b *testing.B) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"enableTtl": true, "ttlAttribute": "expiresAt"},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		filter := NewFilter().Match("tenant", "t1").MatchPrefix("name", "jo").Contains("tags", "go")
+		repo.filterConditions(filter)
+	}
+}
@@ -0,0 +1,200 @@
+package backends
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrThrottled is an error class for requests that DynamoDB kept throttling (the provisioned throughput or
+// the request limits were exceeded) after the retries were exhausted. The request can be retried later.
+var ErrThrottled = ErrorClass("throttled")
+
+// IsErrThrottled checks if the error is of the ErrThrottled class.
+func IsErrThrottled(err error) bool {
+	return IsErrorOfType(err, ErrThrottled(""))
+}
+
+// Retry modes of the DynamoDB backend ("retryMode" option).
+const (
+	// RetryStandard retries the throttled requests with exponential backoff.
+	RetryStandard = "standard"
+	// RetryAdaptive additionally limits the rate of the requests on the client while DynamoDB throttles them.
+	RetryAdaptive = "adaptive"
+)
+
+// dynamoThrottleCodes are the error codes of throttled DynamoDB requests.
+var dynamoThrottleCodes = map[string]bool{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: true,
+	dynamodb.ErrCodeRequestLimitExceeded:                   true,
+	"ThrottlingException":                                  true,
+}
+
+func isThrottleErr(err error) bool {
+	return err != nil && dynamoThrottleCodes[awsErrorCode(err)]
+}
+
+// setupDynamoRetries configures the retries of the DynamoDB requests made with the session. The number of
+// retries is set with the "maxRetries" option (10 by default). In the adaptive retry mode (the default),
+// the requests are rate limited on the client after they are throttled. Requests that are still throttled
+// when the retries are exhausted fail with ErrThrottled.
+func setupDynamoRetries(sess *session.Session, options BackendOptions) error {
+	switch mode := options.GetString("retryMode"); mode {
+	case "", RetryAdaptive:
+		limiter := newAdaptiveRateLimiter()
+		sess.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+			Name: "backends.AdaptiveRateLimit",
+			Fn: func(r *request.Request) {
+				if err := limiter.acquire(r.Context()); err != nil {
+					r.Error = err
+				}
+			},
+		})
+		sess.Handlers.CompleteAttempt.PushBackNamed(request.NamedHandler{
+			Name: "backends.AdaptiveRateUpdate",
+			Fn: func(r *request.Request) {
+				if throttled := isThrottleErr(r.Error) || hasUnprocessedItems(r.Data); r.Error == nil || throttled {
+					limiter.update(throttled)
+				}
+			},
+		})
+	case RetryStandard:
+	default:
+		return ErrInvalidInput(fmt.Sprintf("unknown retry mode %s", mode))
+	}
+
+	// the error is cleared after retry handling if the request is retried
+	sess.Handlers.AfterRetry.PushBackNamed(request.NamedHandler{
+		Name: "backends.ThrottledError",
+		Fn: func(r *request.Request) {
+			if isThrottleErr(r.Error) {
+				r.Error = ErrThrottled(fmt.Sprintf("%s: %s", awsErrorCode(r.Error), awsErrorMessage(r.Error)))
+			}
+		},
+	})
+	return nil
+}
+
+// hasUnprocessedItems checks if a batch request was partially throttled.
+func hasUnprocessedItems(data interface{}) bool {
+	switch output := data.(type) {
+	case *dynamodb.BatchGetItemOutput:
+		return len(output.UnprocessedKeys) > 0
+	case *dynamodb.BatchWriteItemOutput:
+		return len(output.UnprocessedItems) > 0
+	}
+	return false
+}
+
+// Parameters of the adaptive rate limiting.
+const (
+	// minRequestRate is the lowest rate (requests per second) the requests are limited to.
+	minRequestRate = 0.5
+	// rateDecrease is the factor the rate is decreased with when a request is throttled.
+	rateDecrease = 0.7
+	// rateIncrease is the factor the rate is increased with for every second without throttled requests.
+	rateIncrease = 1.2
+)
+
+// adaptiveRateLimiter limits the rate of the requests with a token bucket. The limiting starts when a
+// request is throttled, at a rate below the measured rate of the requests. The rate is decreased on every
+// throttled request (at most once per second) and increased while the requests succeed.
+type adaptiveRateLimiter struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	enabled     bool
+	rate        float64
+	tokens      float64
+	lastFill    time.Time
+	lastChange  time.Time
+	windowStart time.Time
+	windowCount int
+	measured    float64
+}
+
+func newAdaptiveRateLimiter() *adaptiveRateLimiter {
+	return &adaptiveRateLimiter{
+		now: time.Now,
+	}
+}
+
+// acquire waits until a request can be sent. Returns an error if the context is done while waiting.
+func (l *adaptiveRateLimiter) acquire(ctx aws.Context) error {
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			return nil
+		}
+		if err := aws.SleepWithContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token for a request. Returns the time to wait for a token if there is none.
+func (l *adaptiveRateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.enabled {
+		return 0
+	}
+	l.refill(l.now())
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *adaptiveRateLimiter) refill(now time.Time) {
+	if !l.lastFill.IsZero() {
+		l.tokens += now.Sub(l.lastFill).Seconds() * l.rate
+	}
+	l.tokens = math.Min(l.tokens, math.Max(l.rate, 1))
+	l.lastFill = now
+}
+
+// update adjusts the rate after a request was sent.
+func (l *adaptiveRateLimiter) update(throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	// the rate of the sent requests is measured over one-second windows
+	if l.windowStart.IsZero() {
+		l.windowStart = now
+	}
+	if elapsed := now.Sub(l.windowStart); elapsed >= time.Second {
+		l.measured = float64(l.windowCount) / elapsed.Seconds()
+		l.windowStart = now
+		l.windowCount = 0
+	}
+	l.windowCount++
+
+	if throttled {
+		if l.enabled && now.Sub(l.lastChange) < time.Second {
+			// a burst of throttled requests decreases the rate once
+			return
+		}
+		rate := math.Max(l.measured, float64(l.windowCount))
+		if l.enabled {
+			rate = math.Min(rate, l.rate)
+		}
+		l.refill(now)
+		l.rate = math.Max(minRequestRate, rate*rateDecrease)
+		l.tokens = math.Min(l.tokens, math.Max(l.rate, 1))
+		l.enabled = true
+		l.lastChange = now
+		return
+	}
+	if l.enabled && now.Sub(l.lastChange) >= time.Second {
+		l.rate *= rateIncrease
+		l.lastChange = now
+	}
+}
@@ -0,0 +1,95 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := newAdaptiveRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		limiter.update(false)
+		now = now.Add(100 * time.Millisecond)
+	}
+	if limiter.reserve() != 0 {
+		t.Fatal("Expected no limiting before the requests are throttled")
+	}
+
+	limiter.update(true)
+	if limiter.rate != 7 {
+		t.Fatal("Expected the rate to be decreased below the measured rate. Got: ", limiter.rate)
+	}
+	if wait := limiter.reserve(); wait <= 0 || wait > time.Second/7+time.Millisecond {
+		t.Fatal("Expected to wait for a token. Got: ", wait)
+	}
+
+	limiter.update(true)
+	if limiter.rate != 7 {
+		t.Fatal("Expected one decrease for a burst of throttled requests. Got: ", limiter.rate)
+	}
+
+	now = now.Add(time.Second)
+	if limiter.reserve() != 0 {
+		t.Fatal("Expected a token after a second")
+	}
+	limiter.update(false)
+	if limiter.rate <= 7 {
+		t.Fatal("Expected the rate to be increased. Got: ", limiter.rate)
+	}
+}
+
+func testRetrySession(t *testing.T, options BackendOptions) *session.Session {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setupDynamoRetries(sess, options); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestSetupDynamoRetriesThrottled(t *testing.T) {
+	req, _ := dynamodb.New(testRetrySession(t, BackendOptions{})).ListTablesRequest(&dynamodb.ListTablesInput{})
+	req.Handlers.Send.Clear()
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		r.Error = awserr.NewRequestFailure(awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil), 400, "request-1")
+	})
+
+	if err := req.Send(); !IsErrThrottled(err) {
+		t.Fatal("Expected a throttled error. Got: ", err)
+	}
+}
+
+func TestSetupDynamoRetriesUnknownMode(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setupDynamoRetries(sess, BackendOptions{"retryMode": "legacy"}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for an unknown retry mode. Got: ", err)
+	}
+}
+
+func TestHasUnprocessedItems(t *testing.T) {
+	output := &dynamodb.BatchGetItemOutput{
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{"users": {}},
+	}
+	if !hasUnprocessedItems(output) || hasUnprocessedItems(&dynamodb.BatchGetItemOutput{}) || hasUnprocessedItems(nil) {
+		t.Fatal("Unexpected unprocessed items check")
+	}
+}
@@ -0,0 +1,545 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/guregu/dynamo"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	defaultStreamLeaseDuration = 30 * time.Second
+	defaultStreamPollInterval  = time.Second
+)
+
+// StreamConfig configures the DynamoDB Streams consumer.
+type StreamConfig struct {
+	// LeaseTable is the table holding the leases and the checkpoints of the stream shards.
+	// Defaults to "<table>-leases". The table is created if it does not exist.
+	LeaseTable string
+	// WorkerID identifies the consumer in the leases. Defaults to a random ID.
+	WorkerID string
+	// LeaseDuration is the time after which a lease that is not renewed can be taken over by another consumer.
+	// Defaults to 30 seconds.
+	LeaseDuration time.Duration
+	// PollInterval is the interval between the reads of the stream. Defaults to 1 second.
+	PollInterval time.Duration
+	// StartFromLatest starts reading the shards without a checkpoint at the latest record, instead of the
+	// oldest record in the stream.
+	StartFromLatest bool
+}
+
+// streamConfigFromOptions reads the stream consumer configuration from the backend options ("streamLeaseTable",
+// "streamLeaseDuration", "streamPollInterval" and "streamStartFromLatest").
+func streamConfigFromOptions(options BackendOptions) StreamConfig {
+	return StreamConfig{
+		LeaseTable:      options.GetString("streamLeaseTable"),
+		LeaseDuration:   options.GetDuration("streamLeaseDuration"),
+		PollInterval:    options.GetDuration("streamPollInterval"),
+		StartFromLatest: options.GetBool("streamStartFromLatest"),
+	}
+}
+
+func (s *StreamConfig) setDefaults(tableName string) error {
+	if s.LeaseTable == "" {
+		s.LeaseTable = tableName + "-leases"
+	}
+	if s.WorkerID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		s.WorkerID = id.String()
+	}
+	if s.LeaseDuration <= 0 {
+		s.LeaseDuration = defaultStreamLeaseDuration
+	}
+	if s.PollInterval <= 0 {
+		s.PollInterval = defaultStreamPollInterval
+	}
+	return nil
+}
+
+// Watch enables DynamoDB Streams on the table and delivers the changes of the records to the handler.
+// The consumer leases the shards of the stream in the lease table, so multiple instances of a service can
+// watch the same table and every change is delivered to one of them. The position in the shard is checkpointed
+// after every batch of records, and the changes are delivered at least once.
+func (c *DynamoCollection) Watch(ctx context.Context, handler ChangeHandler) error {
+	if c.session == nil {
+		return ErrBackendError("dynamo session not configured")
+	}
+	tableName := c.RepositoryDefinition.GetName()
+	config := streamConfigFromOptions(c.options)
+	if err := config.setDefaults(tableName); err != nil {
+		return err
+	}
+
+	svc := dynamodb.New(c.session)
+	streamARN, err := enableStream(svc, tableName)
+	if err != nil {
+		return err
+	}
+	if err = createOnDemandTable(svc, config.LeaseTable, "shardId"); err != nil {
+		return err
+	}
+
+	leaseTable := dynamo.New(c.session).Table(config.LeaseTable)
+	consumer := newDynamoStreamConsumer(dynamodbstreams.New(c.session), &dynamoLeaseTable{&leaseTable}, streamARN, tableName, config)
+	return consumer.run(ctx, handler)
+}
+
+// enableStream enables DynamoDB Streams with the new and old images of the records on the table, unless
+// a stream is already enabled. Returns the ARN of the stream.
+func enableStream(svc *dynamodb.DynamoDB, tableName string) (string, error) {
+	result, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return "", err
+	}
+	if spec := result.Table.StreamSpecification; spec != nil && aws.BoolValue(spec.StreamEnabled) {
+		if aws.StringValue(spec.StreamViewType) != dynamodb.StreamViewTypeNewAndOldImages {
+			log.Printf("WARN: the stream of table %s has view type %s, the change events will not have all documents\n", tableName, aws.StringValue(spec.StreamViewType))
+		}
+		return aws.StringValue(result.Table.LatestStreamArn), nil
+	}
+
+	_, err = svc.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+		StreamSpecification: &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = waitForIndexes(svc, tableName); err != nil {
+		return "", err
+	}
+
+	result, err = svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(result.Table.LatestStreamArn), nil
+}
+
+// createOnDemandTable creates an on-demand table with a string hash key, such as the lease table,
+// if it does not exist.
+func createOnDemandTable(svc *dynamodb.DynamoDB, tableName, hashKey string) error {
+	_, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err == nil {
+		return nil
+	}
+	if awsErrorCode(err) != dynamodb.ErrCodeResourceNotFoundException {
+		return err
+	}
+
+	_, err = svc.CreateTable(&dynamodb.CreateTableInput{
+		TableName:   aws.String(tableName),
+		BillingMode: aws.String(BillingPayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(hashKey), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(hashKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+	})
+	if err != nil {
+		if awsErrorCode(err) == dynamodb.ErrCodeResourceInUseException {
+			// created by another instance in the meantime
+			return svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+		}
+		return err
+	}
+	return svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+}
+
+// dynamoLease is the lease of a stream shard and the checkpoint of the last handled record in the shard.
+type dynamoLease struct {
+	ShardID    string `dynamo:"shardId,hash"`
+	Owner      string `dynamo:"owner"`
+	ExpiresAt  int64  `dynamo:"expiresAt"`
+	Checkpoint string `dynamo:"checkpoint"`
+	Done       bool   `dynamo:"done"`
+}
+
+var errLeaseLost = fmt.Errorf("shard lease lost")
+
+// leaseStore keeps the leases of the stream shards.
+type leaseStore interface {
+	// acquire takes or renews the lease of the shard until the given time. Returns nil if the lease
+	// is held by another consumer.
+	acquire(shardID, owner string, until time.Time) (*dynamoLease, error)
+	// checkpoint saves the sequence number of the last handled record and renews the lease.
+	// Returns errLeaseLost if the lease was taken over by another consumer.
+	checkpoint(shardID, owner, sequenceNumber string, until time.Time) error
+	// finish marks the shard as completely read.
+	finish(shardID, owner string) error
+	// release gives up the lease, so another consumer can take it over right away.
+	release(shardID, owner string) error
+	// done checks if the shard was completely read.
+	done(shardID string) (bool, error)
+}
+
+// dynamoLeaseTable keeps the leases in a DynamoDB table. The leases are updated with conditional writes.
+type dynamoLeaseTable struct {
+	table *dynamo.Table
+}
+
+func (t *dynamoLeaseTable) acquire(shardID, owner string, until time.Time) (*dynamoLease, error) {
+	lease := &dynamoLease{}
+	err := t.table.Update("shardId", shardID).
+		Set("owner", owner).
+		Set("expiresAt", until.Unix()).
+		If("attribute_not_exists($) OR $ = ? OR $ < ?", "owner", "owner", owner, "expiresAt", time.Now().Unix()).
+		Value(lease)
+	if IsConditionalCheckErr(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func (t *dynamoLeaseTable) checkpoint(shardID, owner, sequenceNumber string, until time.Time) error {
+	err := t.table.Update("shardId", shardID).
+		Set("checkpoint", sequenceNumber).
+		Set("expiresAt", until.Unix()).
+		If("$ = ?", "owner", owner).
+		Run()
+	if IsConditionalCheckErr(err) {
+		return errLeaseLost
+	}
+	return err
+}
+
+func (t *dynamoLeaseTable) finish(shardID, owner string) error {
+	err := t.table.Update("shardId", shardID).
+		Set("done", true).
+		If("$ = ?", "owner", owner).
+		Run()
+	if IsConditionalCheckErr(err) {
+		return errLeaseLost
+	}
+	return err
+}
+
+func (t *dynamoLeaseTable) release(shardID, owner string) error {
+	err := t.table.Update("shardId", shardID).
+		Set("expiresAt", 0).
+		If("$ = ?", "owner", owner).
+		Run()
+	if IsConditionalCheckErr(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *dynamoLeaseTable) done(shardID string) (bool, error) {
+	lease := &dynamoLease{}
+	err := t.table.Get("shardId", shardID).Consistent(true).One(lease)
+	if err == dynamo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return lease.Done, nil
+}
+
+// dynamoShardReader is the position of the consumer in a leased shard.
+type dynamoShardReader struct {
+	iterator       string
+	sequenceNumber string
+	latest         bool
+	renewAt        time.Time
+}
+
+// dynamoStreamConsumer reads the shards of a stream it holds the leases for. A shard created by a split
+// is read only after its parent shard is completely read, so the changes of a record are delivered in order.
+type dynamoStreamConsumer struct {
+	streams    dynamodbstreamsiface.DynamoDBStreamsAPI
+	leases     leaseStore
+	streamARN  string
+	repository string
+	config     StreamConfig
+	shards     map[string]*dynamoShardReader
+	finished   map[string]bool
+}
+
+func newDynamoStreamConsumer(streams dynamodbstreamsiface.DynamoDBStreamsAPI, leases leaseStore, streamARN, repository string, config StreamConfig) *dynamoStreamConsumer {
+	return &dynamoStreamConsumer{
+		streams:    streams,
+		leases:     leases,
+		streamARN:  streamARN,
+		repository: repository,
+		config:     config,
+		shards:     map[string]*dynamoShardReader{},
+		finished:   map[string]bool{},
+	}
+}
+
+// run reads the stream until the context is done or the handler returns an error. The leases are released on return.
+func (c *dynamoStreamConsumer) run(ctx context.Context, handler ChangeHandler) error {
+	defer c.releaseAll()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := c.poll(handler); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.config.PollInterval):
+		}
+	}
+}
+
+// poll acquires the leases of the available shards and reads the next batch of records from every leased shard.
+func (c *dynamoStreamConsumer) poll(handler ChangeHandler) error {
+	shards, err := c.describeShards()
+	if err != nil {
+		return err
+	}
+	inStream := map[string]bool{}
+	for _, shard := range shards {
+		inStream[aws.StringValue(shard.ShardId)] = true
+	}
+
+	for _, shard := range shards {
+		shardID := aws.StringValue(shard.ShardId)
+		if c.finished[shardID] {
+			continue
+		}
+		reader, ok := c.shards[shardID]
+		if !ok {
+			parentID := aws.StringValue(shard.ParentShardId)
+			if parentID != "" && inStream[parentID] {
+				done, err := c.parentDone(parentID)
+				if err != nil {
+					return err
+				}
+				if !done {
+					continue
+				}
+			}
+			// start at the latest record only in the shards that existed when the consumer started
+			latest := c.config.StartFromLatest && (parentID == "" || !inStream[parentID])
+			if reader, err = c.acquire(shardID, latest); err != nil {
+				return err
+			}
+			if reader == nil {
+				continue
+			}
+			c.shards[shardID] = reader
+		}
+
+		err := c.read(shardID, reader, handler)
+		if err == errLeaseLost {
+			log.Printf("WARN: the lease of shard %s of %s was taken over by another consumer\n", shardID, c.repository)
+			delete(c.shards, shardID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *dynamoStreamConsumer) parentDone(parentID string) (bool, error) {
+	if c.finished[parentID] {
+		return true, nil
+	}
+	return c.leases.done(parentID)
+}
+
+// describeShards returns all shards of the stream.
+func (c *dynamoStreamConsumer) describeShards() ([]*dynamodbstreams.Shard, error) {
+	shards := []*dynamodbstreams.Shard{}
+	input := &dynamodbstreams.DescribeStreamInput{
+		StreamArn: aws.String(c.streamARN),
+	}
+	for {
+		result, err := c.streams.DescribeStream(input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, result.StreamDescription.Shards...)
+		if result.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = result.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// acquire takes the lease of the shard. Returns nil if the lease is held by another consumer or the shard
+// was completely read.
+func (c *dynamoStreamConsumer) acquire(shardID string, latest bool) (*dynamoShardReader, error) {
+	lease, err := c.leases.acquire(shardID, c.config.WorkerID, time.Now().Add(c.config.LeaseDuration))
+	if err != nil || lease == nil {
+		return nil, err
+	}
+	if lease.Done {
+		c.finished[shardID] = true
+		return nil, c.leases.release(shardID, c.config.WorkerID)
+	}
+	return &dynamoShardReader{
+		sequenceNumber: lease.Checkpoint,
+		latest:         latest,
+		renewAt:        time.Now().Add(c.config.LeaseDuration / 2),
+	}, nil
+}
+
+// shardIterator returns the iterator that continues after the last handled record of the shard.
+func (c *dynamoStreamConsumer) shardIterator(shardID string, reader *dynamoShardReader) (string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(c.streamARN),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon),
+	}
+	switch {
+	case reader.sequenceNumber != "":
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(reader.sequenceNumber)
+	case reader.latest:
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeLatest)
+	}
+	result, err := c.streams.GetShardIterator(input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(result.ShardIterator), nil
+}
+
+// read delivers the next batch of records of the shard and checkpoints the last one.
+func (c *dynamoStreamConsumer) read(shardID string, reader *dynamoShardReader, handler ChangeHandler) error {
+	if reader.iterator == "" {
+		iterator, err := c.shardIterator(shardID, reader)
+		if err != nil {
+			return err
+		}
+		reader.iterator = iterator
+	}
+
+	result, err := c.streams.GetRecords(&dynamodbstreams.GetRecordsInput{
+		ShardIterator: aws.String(reader.iterator),
+	})
+	if err != nil {
+		if awsErrorCode(err) == dynamodbstreams.ErrCodeExpiredIteratorException {
+			// the iterators expire after 15 minutes, get a new one on the next poll
+			reader.iterator = ""
+			return nil
+		}
+		return err
+	}
+
+	for _, record := range result.Records {
+		event, err := streamChangeEvent(c.repository, record)
+		if err != nil {
+			return err
+		}
+		if err = handler(event); err != nil {
+			return err
+		}
+		reader.sequenceNumber = event.Position
+	}
+
+	until := time.Now().Add(c.config.LeaseDuration)
+	if len(result.Records) > 0 {
+		if err := c.leases.checkpoint(shardID, c.config.WorkerID, reader.sequenceNumber, until); err != nil {
+			return err
+		}
+		reader.renewAt = time.Now().Add(c.config.LeaseDuration / 2)
+	} else if time.Now().After(reader.renewAt) {
+		lease, err := c.leases.acquire(shardID, c.config.WorkerID, until)
+		if err != nil {
+			return err
+		}
+		if lease == nil {
+			return errLeaseLost
+		}
+		reader.renewAt = time.Now().Add(c.config.LeaseDuration / 2)
+	}
+
+	if result.NextShardIterator == nil {
+		// the shard was closed and all its records are read
+		if err := c.leases.finish(shardID, c.config.WorkerID); err != nil {
+			return err
+		}
+		delete(c.shards, shardID)
+		c.finished[shardID] = true
+		return nil
+	}
+	reader.iterator = aws.StringValue(result.NextShardIterator)
+	return nil
+}
+
+// releaseAll releases the leases of the shards that are not completely read.
+func (c *dynamoStreamConsumer) releaseAll() {
+	for shardID := range c.shards {
+		if err := c.leases.release(shardID, c.config.WorkerID); err != nil {
+			log.Printf("WARN: failed to release the lease of shard %s of %s: %s\n", shardID, c.repository, err.Error())
+		}
+	}
+	c.shards = map[string]*dynamoShardReader{}
+}
+
+// streamChangeEvent converts the stream record to a ChangeEvent.
+func streamChangeEvent(repository string, record *dynamodbstreams.Record) (*ChangeEvent, error) {
+	event := &ChangeEvent{
+		Repository: repository,
+	}
+	switch aws.StringValue(record.EventName) {
+	case dynamodbstreams.OperationTypeInsert:
+		event.Operation = ChangeInsert
+	case dynamodbstreams.OperationTypeModify:
+		event.Operation = ChangeUpdate
+	case dynamodbstreams.OperationTypeRemove:
+		event.Operation = ChangeDelete
+	default:
+		return nil, ErrBackendError(fmt.Sprintf("unknown stream event %s", aws.StringValue(record.EventName)))
+	}
+	if record.Dynamodb == nil {
+		return event, nil
+	}
+
+	var err error
+	if event.Key, err = streamImage(record.Dynamodb.Keys); err != nil {
+		return nil, err
+	}
+	if event.Document, err = streamImage(record.Dynamodb.NewImage); err != nil {
+		return nil, err
+	}
+	if event.OldDocument, err = streamImage(record.Dynamodb.OldImage); err != nil {
+		return nil, err
+	}
+	event.Time = aws.TimeValue(record.Dynamodb.ApproximateCreationDateTime)
+	event.Position = aws.StringValue(record.Dynamodb.SequenceNumber)
+	return event, nil
+}
+
+func streamImage(image map[string]*dynamodb.AttributeValue) (map[string]interface{}, error) {
+	if image == nil {
+		return nil, nil
+	}
+	return unmarshalRecord(image)
+}
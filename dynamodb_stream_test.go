@@ -0,0 +1,267 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+)
+
+// fakeStreams serves the records of the shards one record per GetRecords call.
+// A shard without an entry in open is closed after its records are read.
+type fakeStreams struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+	shards  []*dynamodbstreams.Shard
+	records map[string][]*dynamodbstreams.Record
+	open    map[string]bool
+}
+
+func (f *fakeStreams) DescribeStream(input *dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &dynamodbstreams.StreamDescription{Shards: f.shards},
+	}, nil
+}
+
+func (f *fakeStreams) GetShardIterator(input *dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	position := 0
+	if aws.StringValue(input.ShardIteratorType) == dynamodbstreams.ShardIteratorTypeAfterSequenceNumber {
+		for i, record := range f.records[aws.StringValue(input.ShardId)] {
+			if aws.StringValue(record.Dynamodb.SequenceNumber) == aws.StringValue(input.SequenceNumber) {
+				position = i + 1
+			}
+		}
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String(fmt.Sprintf("%s:%d", aws.StringValue(input.ShardId), position)),
+	}, nil
+}
+
+func (f *fakeStreams) GetRecords(input *dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error) {
+	iterator := aws.StringValue(input.ShardIterator)
+	separator := strings.LastIndex(iterator, ":")
+	shardID := iterator[:separator]
+	position, _ := strconv.Atoi(iterator[separator+1:])
+	records := f.records[shardID]
+	output := &dynamodbstreams.GetRecordsOutput{}
+	if position < len(records) {
+		output.Records = records[position : position+1]
+		position++
+	}
+	if position < len(records) || f.open[shardID] {
+		output.NextShardIterator = aws.String(fmt.Sprintf("%s:%d", shardID, position))
+	}
+	return output, nil
+}
+
+type memoryLeases struct {
+	leases map[string]*dynamoLease
+}
+
+func (m *memoryLeases) acquire(shardID, owner string, until time.Time) (*dynamoLease, error) {
+	lease, ok := m.leases[shardID]
+	if !ok {
+		lease = &dynamoLease{ShardID: shardID}
+		m.leases[shardID] = lease
+	}
+	if lease.Owner != "" && lease.Owner != owner && lease.ExpiresAt >= time.Now().Unix() {
+		return nil, nil
+	}
+	lease.Owner = owner
+	lease.ExpiresAt = until.Unix()
+	acquired := *lease
+	return &acquired, nil
+}
+
+func (m *memoryLeases) checkpoint(shardID, owner, sequenceNumber string, until time.Time) error {
+	lease := m.leases[shardID]
+	if lease == nil || lease.Owner != owner {
+		return errLeaseLost
+	}
+	lease.Checkpoint = sequenceNumber
+	lease.ExpiresAt = until.Unix()
+	return nil
+}
+
+func (m *memoryLeases) finish(shardID, owner string) error {
+	lease := m.leases[shardID]
+	if lease == nil || lease.Owner != owner {
+		return errLeaseLost
+	}
+	lease.Done = true
+	return nil
+}
+
+func (m *memoryLeases) release(shardID, owner string) error {
+	if lease := m.leases[shardID]; lease != nil && lease.Owner == owner {
+		lease.ExpiresAt = 0
+	}
+	return nil
+}
+
+func (m *memoryLeases) done(shardID string) (bool, error) {
+	lease := m.leases[shardID]
+	return lease != nil && lease.Done, nil
+}
+
+func streamRecord(eventName, id, sequenceNumber string) *dynamodbstreams.Record {
+	return &dynamodbstreams.Record{
+		EventName: aws.String(eventName),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			Keys: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(id)},
+			},
+			NewImage: map[string]*dynamodb.AttributeValue{
+				"id":   {S: aws.String(id)},
+				"name": {S: aws.String("user " + id)},
+			},
+			SequenceNumber: aws.String(sequenceNumber),
+		},
+	}
+}
+
+func testStreamConsumer(streams *fakeStreams, leases *memoryLeases) *dynamoStreamConsumer {
+	config := StreamConfig{WorkerID: "worker-1"}
+	config.setDefaults("users")
+	return newDynamoStreamConsumer(streams, leases, "arn:stream", "users", config)
+}
+
+func TestStreamChangeEvent(t *testing.T) {
+	event, err := streamChangeEvent("users", streamRecord(dynamodbstreams.OperationTypeModify, "1", "100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Operation != ChangeUpdate || event.Repository != "users" || event.Position != "100" {
+		t.Fatal("Unexpected event: ", event)
+	}
+	if event.Key["id"] != "1" || event.Document["name"] != "user 1" || event.OldDocument != nil {
+		t.Fatal("Unexpected documents: ", event.Key, event.Document, event.OldDocument)
+	}
+
+	if _, err := streamChangeEvent("users", &dynamodbstreams.Record{EventName: aws.String("UNKNOWN")}); err == nil {
+		t.Fatal("Expected error for an unknown event")
+	}
+}
+
+func TestStreamConsumerReadsParentShardFirst(t *testing.T) {
+	streams := &fakeStreams{
+		shards: []*dynamodbstreams.Shard{
+			{ShardId: aws.String("child"), ParentShardId: aws.String("parent")},
+			{ShardId: aws.String("parent")},
+		},
+		records: map[string][]*dynamodbstreams.Record{
+			"parent": {
+				streamRecord(dynamodbstreams.OperationTypeInsert, "1", "100"),
+				streamRecord(dynamodbstreams.OperationTypeModify, "1", "101"),
+			},
+			"child": {
+				streamRecord(dynamodbstreams.OperationTypeRemove, "1", "200"),
+			},
+		},
+		open: map[string]bool{"child": true},
+	}
+	leases := &memoryLeases{leases: map[string]*dynamoLease{}}
+	consumer := testStreamConsumer(streams, leases)
+
+	positions := []string{}
+	handler := func(event *ChangeEvent) error {
+		positions = append(positions, event.Position)
+		return nil
+	}
+	for i := 0; i < 4; i++ {
+		if err := consumer.poll(handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fmt.Sprint(positions) != "[100 101 200]" {
+		t.Fatal("Expected the parent shard to be read first. Got: ", positions)
+	}
+	if !leases.leases["parent"].Done || leases.leases["parent"].Checkpoint != "101" {
+		t.Fatal("Expected the parent shard to be finished: ", leases.leases["parent"])
+	}
+	if leases.leases["child"].Checkpoint != "200" || leases.leases["child"].Done {
+		t.Fatal("Expected the child shard to be checkpointed: ", leases.leases["child"])
+	}
+}
+
+func TestStreamConsumerResumesFromCheckpoint(t *testing.T) {
+	streams := &fakeStreams{
+		shards: []*dynamodbstreams.Shard{{ShardId: aws.String("shard")}},
+		records: map[string][]*dynamodbstreams.Record{
+			"shard": {
+				streamRecord(dynamodbstreams.OperationTypeInsert, "1", "100"),
+				streamRecord(dynamodbstreams.OperationTypeInsert, "2", "101"),
+			},
+		},
+		open: map[string]bool{"shard": true},
+	}
+	leases := &memoryLeases{leases: map[string]*dynamoLease{
+		"shard": {ShardID: "shard", Checkpoint: "100"},
+	}}
+
+	positions := []string{}
+	if err := testStreamConsumer(streams, leases).poll(func(event *ChangeEvent) error {
+		positions = append(positions, event.Position)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(positions) != "[101]" {
+		t.Fatal("Expected to continue after the checkpoint. Got: ", positions)
+	}
+}
+
+func TestStreamConsumerSkipsLeasedShards(t *testing.T) {
+	streams := &fakeStreams{
+		shards: []*dynamodbstreams.Shard{{ShardId: aws.String("shard")}},
+		records: map[string][]*dynamodbstreams.Record{
+			"shard": {streamRecord(dynamodbstreams.OperationTypeInsert, "1", "100")},
+		},
+	}
+	leases := &memoryLeases{leases: map[string]*dynamoLease{
+		"shard": {ShardID: "shard", Owner: "worker-2", ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	}}
+
+	if err := testStreamConsumer(streams, leases).poll(func(event *ChangeEvent) error {
+		t.Fatal("Expected no events from a shard leased by another consumer")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamConsumerHandlerError(t *testing.T) {
+	streams := &fakeStreams{
+		shards: []*dynamodbstreams.Shard{{ShardId: aws.String("shard")}},
+		records: map[string][]*dynamodbstreams.Record{
+			"shard": {streamRecord(dynamodbstreams.OperationTypeInsert, "1", "100")},
+		},
+		open: map[string]bool{"shard": true},
+	}
+	leases := &memoryLeases{leases: map[string]*dynamoLease{}}
+	consumer := testStreamConsumer(streams, leases)
+
+	err := consumer.run(context.Background(), func(event *ChangeEvent) error {
+		return fmt.Errorf("handler failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the handler error")
+	}
+	lease := leases.leases["shard"]
+	if lease.Checkpoint != "" || lease.ExpiresAt != 0 {
+		t.Fatal("Expected no checkpoint and a released lease: ", lease)
+	}
+}
+
+func TestWatchNotSupported(t *testing.T) {
+	if err := Watch(context.Background(), &memoryRepo{}, func(event *ChangeEvent) error { return nil }); err == nil {
+		t.Fatal("Expected error for a repository without change streams")
+	}
+}
@@ -1,7 +1,12 @@
 package backends
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
 )
 
 func TestTokenize(t *testing.T) {
@@ -194,3 +199,117 @@ func TestPatternToDynamoDBCondition(t *testing.T) {
 		t.Fatal("Invalid conditions. Got: ", conds)
 	}
 }
+
+func TestUnmarshalRecord(t *testing.T) {
+	record, err := unmarshalRecord(map[string]*dynamodb.AttributeValue{
+		"id":    {N: aws.String("9007199254740993")},
+		"price": {N: aws.String("12.5")},
+		"name":  {S: aws.String("John")},
+		"tags":  {L: []*dynamodb.AttributeValue{{N: aws.String("1")}, {S: aws.String("a")}}},
+		"owner": {M: map[string]*dynamodb.AttributeValue{"age": {N: aws.String("30")}}},
+		"none":  {NULL: aws.Bool(true)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record["id"] != int64(9007199254740993) || record["price"] != 12.5 || record["name"] != "John" || record["none"] != nil {
+		t.Fatal("Unexpected record: ", record)
+	}
+	if tags := record["tags"].([]interface{}); tags[0] != int64(1) || tags[1] != "a" {
+		t.Fatal("Unexpected list: ", tags)
+	}
+	if owner := record["owner"].(map[string]interface{}); owner["age"] != int64(30) {
+		t.Fatal("Unexpected map: ", owner)
+	}
+}
+
+func TestFilterKey(t *testing.T) {
+	repo := &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"hashKey": "email", "rangeKey": "id"},
+	}
+
+	key, ok := repo.filterKey(Filter{"email": "john@example.com", "id": "1"})
+	if !ok || key["email"] != "john@example.com" || key["id"] != "1" {
+		t.Fatal("Expected the key of the record. Got: ", key)
+	}
+
+	for _, filter := range []Filter{
+		{"email": "john@example.com"},
+		{"email": "john@example.com", "id": "1", "name": "John"},
+		{"email": "john@example.com", "name": "John"},
+		NewFilter().Match("email", "john@example.com").MatchPrefix("id", "1"),
+	} {
+		if _, ok := repo.filterKey(filter); ok {
+			t.Error("Expected the record to be read first for ", filter)
+		}
+	}
+}
+
+// itemsIter iterates over the items as a scan would.
+type itemsIter struct {
+	items []map[string]*dynamodb.AttributeValue
+	next  int
+}
+
+func (i *itemsIter) Next(out interface{}) bool {
+	if i.next >= len(i.items) {
+		return false
+	}
+	i.next++
+	return dynamo.UnmarshalItem(i.items[i.next-1], out) == nil
+}
+
+func (i *itemsIter) NextWithContext(ctx aws.Context, out interface{}) bool {
+	return i.Next(out)
+}
+
+func (i *itemsIter) Err() error {
+	return nil
+}
+
+func testItems(count int) []map[string]*dynamodb.AttributeValue {
+	items := make([]map[string]*dynamodb.AttributeValue, count)
+	for i := range items {
+		items[i] = map[string]*dynamodb.AttributeValue{
+			"id":    {S: aws.String(fmt.Sprintf("item-%d", i))},
+			"name":  {S: aws.String("John")},
+			"price": {N: aws.String("12.5")},
+			"tags":  {L: []*dynamodb.AttributeValue{{S: aws.String("a")}, {S: aws.String("b")}}},
+		}
+	}
+	return items
+}
+
+func TestCollectRecords(t *testing.T) {
+	results, err := collectRecords(&itemsIter{items: testItems(5)}, map[string]interface{}{}, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, ok := results.([]*map[string]interface{})
+	if !ok || len(records) != 2 || (*records[0])["id"] != "item-1" || (*records[1])["id"] != "item-2" {
+		t.Fatalf("Expected the second page of records. Got: %#v", results)
+	}
+
+	type item struct {
+		ID    string  `dynamo:"id"`
+		Price float64 `dynamo:"price"`
+	}
+	results, err = collectRecords(&itemsIter{items: testItems(3)}, &item{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, ok := results.([]*item)
+	if !ok || len(items) != 3 || items[2].ID != "item-2" || items[2].Price != 12.5 {
+		t.Fatalf("Expected all records. Got: %#v", results)
+	}
+}
+
+func BenchmarkCollectRecords(b *testing.B) {
+	items := testItems(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := collectRecords(&itemsIter{items: items}, map[string]interface{}{}, 0, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
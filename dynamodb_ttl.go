@@ -0,0 +1,106 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// setTTL enables TimeToLive on the TTL attribute of the table. Nothing is changed if TTL is already
+// enabled on the attribute.
+func setTTL(svc *dynamodb.DynamoDB, repoDef RepositoryDefinition) error {
+	if !repoDef.EnableTTL() {
+		return nil
+	}
+
+	attribute := repoDef.GetTTLAttribute()
+	tableName := repoDef.GetName()
+
+	if attribute == "" {
+		return ErrBackendError("TTL attribute is reqired when TTL is enabled")
+	}
+	if repoDef.GetTTL() == 0 && repoDef.GetTTLMode() != TTLExpireAt {
+		return ErrBackendError("TTL value is missing and must be greater than zero")
+	}
+
+	err := svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := svc.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	specification, err := ttlSpecification(tableName, result.TimeToLiveDescription, attribute)
+	if err != nil || specification == nil {
+		return err
+	}
+
+	_, err = svc.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		TableName:               aws.String(tableName),
+		TimeToLiveSpecification: specification,
+	})
+	return err
+}
+
+// ttlSpecification returns the TimeToLive specification that enables TTL on the attribute, or nil if TTL is
+// already enabled on it. DynamoDB allows a single TTL attribute per table, so TTL enabled on another attribute
+// must be disabled first.
+func ttlSpecification(tableName string, description *dynamodb.TimeToLiveDescription, attribute string) (*dynamodb.TimeToLiveSpecification, error) {
+	status := dynamodb.TimeToLiveStatusDisabled
+	current := ""
+	if description != nil {
+		status = aws.StringValue(description.TimeToLiveStatus)
+		current = aws.StringValue(description.AttributeName)
+	}
+
+	switch status {
+	case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+		if current == attribute {
+			return nil, nil
+		}
+		return nil, ErrBackendError(fmt.Sprintf("TTL of table %s is enabled on attribute %s, disable it to use attribute %s", tableName, current, attribute))
+	case dynamodb.TimeToLiveStatusDisabling:
+		return nil, ErrBackendError(fmt.Sprintf("TTL of table %s is being disabled, retry later", tableName))
+	}
+
+	return &dynamodb.TimeToLiveSpecification{
+		AttributeName: aws.String(attribute),
+		Enabled:       aws.Bool(true),
+	}, nil
+}
+
+// applyDynamoTTL sets the TTL attribute of the payload to the expiry time as epoch time in seconds, the
+// format DynamoDB TTL requires. With TTLFixed, new records expire TTL seconds after they are created.
+// With TTLExpireAt, the date in the TTL attribute (time.Time, RFC3339 string or epoch time) is converted.
+func applyDynamoTTL(payload map[string]interface{}, repoDef RepositoryDefinition, create bool) error {
+	if !repoDef.EnableTTL() {
+		return nil
+	}
+	attribute := repoDef.GetTTLAttribute()
+
+	if repoDef.GetTTLMode() != TTLExpireAt {
+		if create {
+			payload[attribute] = time.Now().Add(time.Second * time.Duration(repoDef.GetTTL())).Unix()
+		}
+		return nil
+	}
+
+	value, ok := payload[attribute]
+	if !ok || value == nil {
+		return nil
+	}
+	expiresAt, ok := asTime(value)
+	if !ok {
+		return ErrInvalidInput(fmt.Sprintf("%s must be a date", attribute))
+	}
+	payload[attribute] = expiresAt.Unix()
+	return nil
+}
@@ -0,0 +1,85 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTTLSpecification(t *testing.T) {
+	specification, err := ttlSpecification("users", nil, "expiresAt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(specification.AttributeName) != "expiresAt" || !aws.BoolValue(specification.Enabled) {
+		t.Fatal("Expected TTL to be enabled on the attribute. Got: ", specification)
+	}
+
+	specification, err = ttlSpecification("users", &dynamodb.TimeToLiveDescription{
+		AttributeName:    aws.String("expiresAt"),
+		TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusEnabled),
+	}, "expiresAt")
+	if err != nil || specification != nil {
+		t.Fatal("Expected no change when TTL is already enabled")
+	}
+
+	_, err = ttlSpecification("users", &dynamodb.TimeToLiveDescription{
+		AttributeName:    aws.String("created_at"),
+		TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusEnabled),
+	}, "expiresAt")
+	if err == nil {
+		t.Fatal("Expected error when TTL is enabled on another attribute")
+	}
+
+	_, err = ttlSpecification("users", &dynamodb.TimeToLiveDescription{
+		TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusDisabling),
+	}, "expiresAt")
+	if err == nil {
+		t.Fatal("Expected error while TTL is being disabled")
+	}
+}
+
+func TestApplyDynamoTTLFixed(t *testing.T) {
+	def := RepositoryDefinitionMap{"enableTtl": true, "ttlAttribute": "expiresAt", "ttl": 60}
+
+	payload := map[string]interface{}{}
+	if err := applyDynamoTTL(payload, def, true); err != nil {
+		t.Fatal(err)
+	}
+	expiresAt, ok := payload["expiresAt"].(int64)
+	if !ok {
+		t.Fatalf("Expected epoch time, got %T", payload["expiresAt"])
+	}
+	if expiresAt < time.Now().Add(59*time.Second).Unix() || expiresAt > time.Now().Add(61*time.Second).Unix() {
+		t.Fatal("Unexpected expiry time: ", expiresAt)
+	}
+
+	payload = map[string]interface{}{}
+	if err := applyDynamoTTL(payload, def, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["expiresAt"]; ok {
+		t.Fatal("Expected the expiry time not to change on update")
+	}
+}
+
+func TestApplyDynamoTTLExpireAt(t *testing.T) {
+	def := RepositoryDefinitionMap{"enableTtl": true, "ttlAttribute": "expiresAt", "ttlMode": TTLExpireAt}
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, value := range []interface{}{at, at.Format(time.RFC3339), at.Unix()} {
+		payload := map[string]interface{}{"expiresAt": value}
+		if err := applyDynamoTTL(payload, def, true); err != nil {
+			t.Fatal(err)
+		}
+		if payload["expiresAt"] != at.Unix() {
+			t.Fatalf("Expected epoch time for %v, got %v", value, payload["expiresAt"])
+		}
+	}
+
+	if err := applyDynamoTTL(map[string]interface{}{"expiresAt": "tomorrow"}, def, true); err == nil {
+		t.Fatal("Expected error for an invalid date")
+	}
+}
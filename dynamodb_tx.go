@@ -0,0 +1,365 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/guregu/dynamo"
+)
+
+// ErrTransactionConflict is an error class for transactions that were cancelled because another
+// transaction or write on the same items was in progress. The transaction can be retried.
+var ErrTransactionConflict = ErrorClass("transaction conflict")
+
+// ErrConditionFailed is an error class for transactions that were cancelled because a condition check failed.
+var ErrConditionFailed = ErrorClass("condition failed")
+
+// IsErrTransactionConflict checks if the error is of the ErrTransactionConflict class.
+func IsErrTransactionConflict(err error) bool {
+	return IsErrorOfType(err, ErrTransactionConflict(""))
+}
+
+// IsErrConditionFailed checks if the error is of the ErrConditionFailed class.
+func IsErrConditionFailed(err error) bool {
+	return IsErrorOfType(err, ErrConditionFailed(""))
+}
+
+// maxDynamoTransactionWrites is the maximum number of writes in a DynamoDB transaction.
+const maxDynamoTransactionWrites = 100
+
+// Kinds of the writes in a transaction. They determine the error returned when the condition of the write fails.
+const (
+	txCreate = "create"
+	txUpdate = "update"
+	txDelete = "delete"
+	txCheck  = "check"
+)
+
+// dynamoTxWrite is a write in a DynamoTransaction. The index is set on the writes of unique index guards.
+// The writes conditioned on the values read before the transaction are marked as optimistic: when their
+// condition fails, the record was changed concurrently.
+type dynamoTxWrite struct {
+	kind       string
+	table      string
+	index      string
+	fields     []string
+	optimistic bool
+}
+
+// DynamoTransaction is a set of writes on DynamoDB repositories that are committed atomically with
+// TransactWriteItems: either all writes succeed or none is applied. For example, to create an order
+// for an active customer and mark the cart as ordered:
+//
+//	err := backends.NewDynamoTransaction().
+//		Create(ordersRepo, order).
+//		Update(cartsRepo, backends.Filter{"id": order.CartID}, &map[string]interface{}{"ordered": true}).
+//		Check(customersRepo, backends.Filter{"id": order.CustomerID}, "$ = ?", "status", "active").
+//		Commit()
+//
+// The writes must be on different items, on tables in the same account and region. The writes on
+// repositories with unique indexes also write the guards of the indexes (see dynamoUniqueness), and
+// fail with ErrAlreadyExists on a duplicate value.
+type DynamoTransaction struct {
+	tx     *dynamo.WriteTx
+	writes []*dynamoTxWrite
+	err    error
+}
+
+// NewDynamoTransaction creates an empty transaction.
+func NewDynamoTransaction() *DynamoTransaction {
+	return &DynamoTransaction{}
+}
+
+// Create adds a new record to the transaction. The transaction fails with ErrAlreadyExists if a record
+// with the same key exists.
+func (t *DynamoTransaction) Create(repo Repository, object interface{}) *DynamoTransaction {
+	c := t.collection(repo)
+	if c == nil {
+		return t
+	}
+	payload, err := c.prepareItem(object, true)
+	if err != nil {
+		t.setError(err)
+		return t
+	}
+	t.create(c, *payload)
+	return t
+}
+
+func (t *DynamoTransaction) create(c *DynamoCollection, payload map[string]interface{}) {
+	item, err := dynamodbattribute.MarshalMap(payload)
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	t.tx.Put(c.Table.Put(item).If("attribute_not_exists($)", hashKey))
+	t.add(txCreate, c)
+	if c.unique != nil {
+		t.guard(c, c.recordOwner(payload[hashKey], payload[c.RepositoryDefinition.GetRangeKey()]), nil, payload)
+	}
+}
+
+// Update adds an update of the record with the key to the transaction. The properties of the object,
+// except the key properties, are set on the record. The transaction fails with ErrNotFound if the record
+// does not exist.
+func (t *DynamoTransaction) Update(repo Repository, key Filter, object interface{}) *DynamoTransaction {
+	c := t.collection(repo)
+	if c == nil {
+		return t
+	}
+	hashValue, rangeValue, err := c.itemKey(key)
+	if err != nil {
+		t.setError(err)
+		return t
+	}
+	payload, err := c.prepareItem(object, false)
+	if err != nil {
+		t.setError(err)
+		return t
+	}
+	var current map[string]interface{}
+	if c.unique != nil {
+		if current, err = c.currentItem(hashValue, rangeValue); err != nil {
+			t.setError(err)
+			return t
+		}
+	}
+	t.update(c, hashValue, rangeValue, current, *payload, nil)
+	return t
+}
+
+// update adds the update of the record. The current record is required for repositories with unique indexes.
+// If the filter is not nil, the record must still match it.
+func (t *DynamoTransaction) update(c *DynamoCollection, hashValue, rangeValue interface{}, current, payload map[string]interface{}, filter Filter) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+	update := c.Table.Update(hashKey, hashValue)
+	if rangeKey != "" {
+		update = update.Range(rangeKey, rangeValue)
+	}
+	for k, v := range payload {
+		if k != hashKey && k != rangeKey {
+			update = update.Set(k, v)
+		}
+	}
+	update = update.If(c.existsCondition(filter))
+	if c.unique == nil {
+		t.tx.Update(update)
+		t.add(txUpdate, c)
+		return
+	}
+	condition, args := c.unique.unchangedCondition(current)
+	t.tx.Update(update.If(condition, args...))
+	t.addOptimistic(txUpdate, c)
+	t.guard(c, c.recordOwner(hashValue, rangeValue), current, mergeItem(current, payload))
+}
+
+// Delete adds a delete of the record with the key to the transaction. The transaction fails with
+// ErrNotFound if the record does not exist.
+func (t *DynamoTransaction) Delete(repo Repository, key Filter) *DynamoTransaction {
+	c := t.collection(repo)
+	if c == nil {
+		return t
+	}
+	hashValue, rangeValue, err := c.itemKey(key)
+	if err != nil {
+		t.setError(err)
+		return t
+	}
+	var current map[string]interface{}
+	if c.unique != nil {
+		if current, err = c.currentItem(hashValue, rangeValue); err != nil {
+			t.setError(err)
+			return t
+		}
+	}
+	t.remove(c, hashValue, rangeValue, current, nil)
+	return t
+}
+
+// remove adds the delete of the record. The current record is required for repositories with unique indexes.
+// If the filter is not nil, the record must still match it.
+func (t *DynamoTransaction) remove(c *DynamoCollection, hashValue, rangeValue interface{}, current map[string]interface{}, filter Filter) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+	deletion := c.Table.Delete(hashKey, hashValue)
+	if rangeKey != "" {
+		deletion = deletion.Range(rangeKey, rangeValue)
+	}
+	deletion = deletion.If(c.existsCondition(filter))
+	if c.unique == nil {
+		t.tx.Delete(deletion)
+		t.add(txDelete, c)
+		return
+	}
+	condition, args := c.unique.unchangedCondition(current)
+	t.tx.Delete(deletion.If(condition, args...))
+	t.addOptimistic(txDelete, c)
+	t.guard(c, c.recordOwner(hashValue, rangeValue), current, nil)
+}
+
+// Check adds a condition on the record with the key to the transaction, without changing the record.
+// The condition is a DynamoDB condition expression with $ for the attribute names and ? for the values,
+// e.g. Check(accountsRepo, Filter{"id": id}, "$ >= ?", "balance", amount). The transaction fails with
+// ErrConditionFailed if the condition is not met.
+func (t *DynamoTransaction) Check(repo Repository, key Filter, condition string, args ...interface{}) *DynamoTransaction {
+	c := t.collection(repo)
+	if c == nil {
+		return t
+	}
+	hashValue, rangeValue, err := c.itemKey(key)
+	if err != nil {
+		t.setError(err)
+		return t
+	}
+
+	check := c.Table.Check(c.RepositoryDefinition.GetHashKey(), hashValue)
+	if rangeKey := c.RepositoryDefinition.GetRangeKey(); rangeKey != "" {
+		check = check.Range(rangeKey, rangeValue)
+	}
+	t.tx.Check(check.If(condition, args...))
+	t.add(txCheck, c)
+	return t
+}
+
+// Commit runs the transaction. If the transaction is cancelled, the reason of the first failed write is
+// returned as ErrAlreadyExists, ErrNotFound, ErrConditionFailed, ErrTransactionConflict, ErrThrottled
+// (insufficient capacity) or ErrInvalidInput.
+func (t *DynamoTransaction) Commit() error {
+	if t.err != nil {
+		return t.err
+	}
+	if len(t.writes) == 0 {
+		return nil
+	}
+	return dynamoTransactionError(t.tx.Idempotent(true).Run(), t.writes)
+}
+
+func (t *DynamoTransaction) collection(repo Repository) *DynamoCollection {
+	if t.err != nil {
+		return nil
+	}
+	if r, ok := repo.(*failoverRepository); ok {
+		active, err := r.active()
+		if err != nil {
+			t.setError(err)
+			return nil
+		}
+		repo = active
+	}
+	c, ok := repo.(*DynamoCollection)
+	if !ok {
+		t.setError(ErrInvalidInput(fmt.Sprintf("transactions are not supported on %T", repo)))
+		return nil
+	}
+	if t.tx == nil {
+		if c.session == nil {
+			t.setError(ErrBackendError("dynamo session not configured"))
+			return nil
+		}
+		t.tx = dynamo.New(c.session).WriteTx()
+	}
+	return c
+}
+
+func (t *DynamoTransaction) add(kind string, c *DynamoCollection) {
+	t.writes = append(t.writes, &dynamoTxWrite{
+		kind:  kind,
+		table: c.RepositoryDefinition.GetName(),
+	})
+}
+
+func (t *DynamoTransaction) addOptimistic(kind string, c *DynamoCollection) {
+	t.add(kind, c)
+	t.writes[len(t.writes)-1].optimistic = true
+}
+
+func (t *DynamoTransaction) setError(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// itemKey returns the values of the hash and range keys from the key filter.
+func (c *DynamoCollection) itemKey(key Filter) (interface{}, interface{}, error) {
+	hashKey := c.RepositoryDefinition.GetHashKey()
+	hashValue, ok := key[hashKey]
+	if !ok {
+		return nil, nil, ErrInvalidInput(fmt.Sprintf("key must have the hash key %s", hashKey))
+	}
+	rangeKey := c.RepositoryDefinition.GetRangeKey()
+	if rangeKey == "" {
+		return hashValue, nil, nil
+	}
+	rangeValue, ok := key[rangeKey]
+	if !ok {
+		return nil, nil, ErrInvalidInput(fmt.Sprintf("key must have the range key %s", rangeKey))
+	}
+	return hashValue, rangeValue, nil
+}
+
+// dynamoTransactionError translates the error of TransactWriteItems into the backend errors. The cancellation
+// reasons are listed in the message of TransactionCanceledException in the order of the writes.
+func dynamoTransactionError(err error, writes []*dynamoTxWrite) error {
+	switch awsErrorCode(err) {
+	case dynamodb.ErrCodeTransactionConflictException:
+		return ErrTransactionConflict(awsErrorMessage(err))
+	case dynamodb.ErrCodeTransactionCanceledException:
+	default:
+		return err
+	}
+
+	message := awsErrorMessage(err)
+	for i, reason := range transactionCancellationReasons(message) {
+		if reason == "None" || i >= len(writes) {
+			continue
+		}
+		write := writes[i]
+		details := fmt.Sprintf("%s of a record in %s failed: %s", write.kind, write.table, reason)
+		switch reason {
+		case "ConditionalCheckFailed":
+			if write.index != "" {
+				if write.kind == txCreate {
+					return &DuplicateKeyError{Collection: write.table, Index: write.index, Fields: write.fields}
+				}
+				return ErrConditionFailed(fmt.Sprintf("the unique index %s of %s is held by another record", write.index, write.table))
+			}
+			if write.optimistic {
+				return ErrTransactionConflict(fmt.Sprintf("the record in %s was changed concurrently", write.table))
+			}
+			switch write.kind {
+			case txCreate:
+				return ErrAlreadyExists(details)
+			case txUpdate, txDelete:
+				return ErrNotFound(details)
+			}
+			return ErrConditionFailed(details)
+		case "TransactionConflict":
+			return ErrTransactionConflict(details)
+		case "ProvisionedThroughputExceeded", "ThrottlingError":
+			return ErrThrottled(details)
+		case "ValidationError", "ItemCollectionSizeLimitExceeded":
+			return ErrInvalidInput(details)
+		}
+		return ErrBackendError(details)
+	}
+	return ErrBackendError(message)
+}
+
+// transactionCancellationReasons parses the reasons from the TransactionCanceledException message, e.g.
+// "Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed]".
+func transactionCancellationReasons(message string) []string {
+	start := strings.LastIndex(message, "[")
+	end := strings.LastIndex(message, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+	reasons := []string{}
+	for _, reason := range strings.Split(message[start+1:end], ",") {
+		reasons = append(reasons, strings.TrimSpace(reason))
+	}
+	return reasons
+}
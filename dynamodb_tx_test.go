@@ -0,0 +1,97 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+func testTxCollection(t *testing.T, def RepositoryDefinitionMap) *DynamoCollection {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := dynamo.New(sess).Table(def.GetName())
+	return &DynamoCollection{
+		Table:                &table,
+		RepositoryDefinition: def,
+		session:              sess,
+	}
+}
+
+func cancelledTransaction(reasons string) error {
+	return awserr.New(dynamodb.ErrCodeTransactionCanceledException, "Transaction cancelled, please refer cancellation reasons for specific reasons ["+reasons+"]", nil)
+}
+
+func TestTransactionCancellationReasons(t *testing.T) {
+	reasons := transactionCancellationReasons("Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed]")
+	if len(reasons) != 2 || reasons[0] != "None" || reasons[1] != "ConditionalCheckFailed" {
+		t.Fatal("Unexpected reasons: ", reasons)
+	}
+	if reasons := transactionCancellationReasons("Transaction cancelled"); len(reasons) != 0 {
+		t.Fatal("Expected no reasons. Got: ", reasons)
+	}
+}
+
+func TestDynamoTransactionError(t *testing.T) {
+	writes := []*dynamoTxWrite{
+		{kind: txCreate, table: "users"},
+		{kind: txUpdate, table: "accounts"},
+		{kind: txCheck, table: "limits"},
+	}
+	cases := map[string]func(error) bool{
+		"ConditionalCheckFailed, None, None":        IsErrAlreadyExists,
+		"None, ConditionalCheckFailed, None":        IsErrNotFound,
+		"None, None, ConditionalCheckFailed":        IsErrConditionFailed,
+		"None, TransactionConflict, None":           IsErrTransactionConflict,
+		"ProvisionedThroughputExceeded, None, None": IsErrThrottled,
+		"None, ValidationError, None":               IsErrInvalidInput,
+	}
+	for reasons, check := range cases {
+		if err := dynamoTransactionError(cancelledTransaction(reasons), writes); !check(err) {
+			t.Fatalf("Unexpected error for reasons %s: %v", reasons, err)
+		}
+	}
+
+	conflict := awserr.New(dynamodb.ErrCodeTransactionConflictException, "conflict", nil)
+	if !IsErrTransactionConflict(dynamoTransactionError(conflict, writes)) {
+		t.Fatal("Expected a transaction conflict")
+	}
+	if dynamoTransactionError(nil, writes) != nil {
+		t.Fatal("Expected no error")
+	}
+}
+
+func TestDynamoTransactionBuild(t *testing.T) {
+	users := testTxCollection(t, RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+	emails := testTxCollection(t, RepositoryDefinitionMap{"name": "emails", "hashKey": "email"})
+
+	tx := NewDynamoTransaction().
+		Create(users, &map[string]interface{}{"name": "john"}).
+		Create(emails, &map[string]interface{}{"email": "john@example.com"}).
+		Check(users, Filter{"id": "1"}, "attribute_exists($)", "id")
+	if tx.err != nil {
+		t.Fatal(tx.err)
+	}
+	if len(tx.writes) != 3 || tx.writes[1].kind != txCreate || tx.writes[1].table != "emails" || tx.writes[2].kind != txCheck {
+		t.Fatal("Unexpected writes: ", tx.writes)
+	}
+}
+
+func TestDynamoTransactionInvalid(t *testing.T) {
+	users := testTxCollection(t, RepositoryDefinitionMap{"name": "users", "hashKey": "tenant", "rangeKey": "id"})
+
+	if err := NewDynamoTransaction().Delete(users, Filter{"tenant": "acme"}).Commit(); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a key without the range key. Got: ", err)
+	}
+	if err := NewDynamoTransaction().Create(&memoryRepo{}, &map[string]interface{}{}).Commit(); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a repository without transactions. Got: ", err)
+	}
+	if err := NewDynamoTransaction().Commit(); err != nil {
+		t.Fatal("Expected an empty transaction to succeed: ", err)
+	}
+}
@@ -0,0 +1,275 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+// dynamoUniqueGuard is an item in the uniqueness table. It holds the value of a unique index and the key
+// of the record that has the value, so a second record with the same value cannot be written.
+type dynamoUniqueGuard struct {
+	Key   string `dynamo:"key,hash"`
+	Owner string `dynamo:"owner"`
+	Index string `dynamo:"index"`
+}
+
+// dynamoUniqueIndex is a unique index of a DynamoDB repository.
+type dynamoUniqueIndex struct {
+	name          string
+	fields        []string
+	caseFold      bool
+	partialFilter map[string]interface{}
+}
+
+// dynamoUniqueness enforces the unique indexes of a repository with guard items in the uniqueness table
+// ("<table>-unique"). The guards are written in the same transaction as the record.
+type dynamoUniqueness struct {
+	table   *dynamo.Table
+	indexes []*dynamoUniqueIndex
+}
+
+// dynamoUniqueIndexes returns the unique indexes of the repository definition.
+func dynamoUniqueIndexes(repoDef RepositoryDefinition) []*dynamoUniqueIndex {
+	indexes := []*dynamoUniqueIndex{}
+	for _, index := range repoDef.GetIndexes() {
+		if !index.Unique() {
+			continue
+		}
+		unique := &dynamoUniqueIndex{
+			name: index.GetName(),
+		}
+		for _, field := range index.GetFields() {
+			unique.fields = append(unique.fields, strings.TrimPrefix(field, "-"))
+		}
+		if spec, ok := index.(SecondaryIndex); ok {
+			if collation := spec.GetCollation(); collation != nil && collation.Strength > 0 && collation.Strength <= 2 {
+				unique.caseFold = true
+			}
+			unique.partialFilter = spec.GetPartialFilter()
+		}
+		if len(unique.fields) == 0 {
+			continue
+		}
+		if unique.name == "" {
+			unique.name = strings.Join(unique.fields, "_")
+		}
+		indexes = append(indexes, unique)
+	}
+	return indexes
+}
+
+// newDynamoUniqueness creates the uniqueness table if the repository has unique indexes.
+// Returns nil if there are no unique indexes.
+func newDynamoUniqueness(svc *dynamodb.DynamoDB, db *dynamo.DB, repoDef RepositoryDefinition) (*dynamoUniqueness, error) {
+	indexes := dynamoUniqueIndexes(repoDef)
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	tableName := uniqueTableName(repoDef.GetName())
+	if err := createOnDemandTable(svc, tableName, "key"); err != nil {
+		return nil, err
+	}
+	table := db.Table(tableName)
+	return &dynamoUniqueness{
+		table:   &table,
+		indexes: indexes,
+	}, nil
+}
+
+func uniqueTableName(tableName string) string {
+	return tableName + "-unique"
+}
+
+// guardKey returns the key of the guard item for the record, or an empty string if the record is
+// not in the index: a field is missing or the record does not match the partial filter (only equality
+// partial filters are supported).
+// Case-insensitive indexes compare the lower-case values.
+func (u *dynamoUniqueIndex) guardKey(record map[string]interface{}) string {
+	if record == nil {
+		return ""
+	}
+	for field, value := range u.partialFilter {
+		if fmt.Sprint(record[field]) != fmt.Sprint(value) {
+			return ""
+		}
+	}
+	values := []interface{}{}
+	for _, field := range u.fields {
+		value, ok := record[field]
+		if !ok || value == nil {
+			return ""
+		}
+		if s, ok := value.(string); ok && u.caseFold {
+			value = strings.ToLower(s)
+		}
+		values = append(values, value)
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return u.name + "#" + string(encoded)
+}
+
+// fields returns the fields of all unique indexes.
+func (d *dynamoUniqueness) fields() []string {
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, index := range d.indexes {
+		for _, field := range index.fields {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// unchangedCondition returns the condition that the unique fields of the record still have the values
+// in current, so the guards of the values are not released for a record that was changed in the meantime.
+func (d *dynamoUniqueness) unchangedCondition(current map[string]interface{}) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	for _, field := range d.fields() {
+		value, ok := current[field]
+		if !ok || value == nil {
+			conditions = append(conditions, "attribute_not_exists($)")
+			args = append(args, field)
+			continue
+		}
+		conditions = append(conditions, "$ = ?")
+		args = append(args, field, value)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// recordOwner returns the key of the record as the owner of its guards.
+func (c *DynamoCollection) recordOwner(hashValue, rangeValue interface{}) string {
+	if c.RepositoryDefinition.GetRangeKey() == "" {
+		return fmt.Sprint(hashValue)
+	}
+	return fmt.Sprintf("%v#%v", hashValue, rangeValue)
+}
+
+// currentItem reads the record with the key with a strongly consistent read.
+func (c *DynamoCollection) currentItem(hashValue, rangeValue interface{}) (map[string]interface{}, error) {
+	get := c.Table.Get(c.RepositoryDefinition.GetHashKey(), hashValue)
+	if rangeKey := c.RepositoryDefinition.GetRangeKey(); rangeKey != "" {
+		get = get.Range(rangeKey, dynamo.Equal, rangeValue)
+	}
+	var item map[string]*dynamodb.AttributeValue
+	if err := get.Consistent(true).One(&item); err != nil {
+		if err == dynamo.ErrNotFound {
+			return nil, ErrNotFound("Record not found")
+		}
+		return nil, err
+	}
+	return unmarshalRecord(item)
+}
+
+// saveUnique creates or updates the record in a transaction with the guards of its unique indexes.
+func (c *DynamoCollection) saveUnique(payload *map[string]interface{}, filter Filter) (interface{}, error) {
+	tx := NewDynamoTransaction()
+	if tx.collection(c) == nil {
+		return nil, tx.err
+	}
+
+	if filter == nil {
+		tx.create(c, *payload)
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	} else {
+		var item interface{}
+		if _, err := c.GetOne(filter, &item); err != nil {
+			return nil, err
+		}
+		found := item.(map[string]interface{})
+		hashValue := found[c.RepositoryDefinition.GetHashKey()]
+		rangeValue := found[c.RepositoryDefinition.GetRangeKey()]
+
+		current, err := c.currentItem(hashValue, rangeValue)
+		if err != nil {
+			return nil, err
+		}
+		tx.update(c, hashValue, rangeValue, current, *payload, nil)
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		updated, err := c.currentItem(hashValue, rangeValue)
+		if err != nil {
+			return nil, err
+		}
+		payload = &updated
+	}
+
+	var result interface{}
+	if err := MapToInterface(payload, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// deleteUnique deletes the record in a transaction with the guards of its unique indexes.
+// If the filter is not nil, the record must still match it.
+func (c *DynamoCollection) deleteUnique(found map[string]interface{}, filter Filter) error {
+	hashValue := found[c.RepositoryDefinition.GetHashKey()]
+	rangeValue := found[c.RepositoryDefinition.GetRangeKey()]
+	current, err := c.currentItem(hashValue, rangeValue)
+	if err != nil {
+		return err
+	}
+
+	tx := NewDynamoTransaction()
+	if tx.collection(c) == nil {
+		return tx.err
+	}
+	tx.remove(c, hashValue, rangeValue, current, filter)
+	return tx.Commit()
+}
+
+// guard adds the writes of the guard items for a record that changes from current to updated. A nil
+// current is a new record, a nil updated is a deleted record. The guards of the updated record are
+// always written, so records saved before an index was declared are guarded after their next update.
+func (t *DynamoTransaction) guard(c *DynamoCollection, owner string, current, updated map[string]interface{}) {
+	for _, index := range c.unique.indexes {
+		oldKey := index.guardKey(current)
+		newKey := index.guardKey(updated)
+		if newKey != "" {
+			guard := &dynamoUniqueGuard{Key: newKey, Owner: owner, Index: index.name}
+			t.tx.Put(c.unique.table.Put(guard).If("attribute_not_exists($) OR $ = ?", "key", "owner", owner))
+			t.addGuard(txCreate, c, index)
+		}
+		if oldKey != "" && oldKey != newKey {
+			t.tx.Delete(c.unique.table.Delete("key", oldKey).If("attribute_not_exists($) OR $ = ?", "key", "owner", owner))
+			t.addGuard(txDelete, c, index)
+		}
+	}
+}
+
+func (t *DynamoTransaction) addGuard(kind string, c *DynamoCollection, index *dynamoUniqueIndex) {
+	t.writes = append(t.writes, &dynamoTxWrite{
+		kind:  kind,
+		table:  c.RepositoryDefinition.GetName(),
+		index:  index.name,
+		fields: index.fields,
+	})
+}
+
+// mergeItem returns the record with the properties of the payload set.
+func mergeItem(current, payload map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range payload {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"testing"
+)
+
+func testUniqueCollection(t *testing.T) *DynamoCollection {
+	def := RepositoryDefinitionMap{
+		"name":    "users",
+		"hashKey": "id",
+		"indexes": []Index{
+			NewUniqueIndex("email"),
+			NewIndexSpec("username").AsUnique().CaseInsensitive("en").Named("username_ci"),
+			NewIndexSpec("name"),
+		},
+	}
+	c := testTxCollection(t, def)
+	table := *c.Table
+	c.unique = &dynamoUniqueness{
+		table:   &table,
+		indexes: dynamoUniqueIndexes(def),
+	}
+	return c
+}
+
+func TestDynamoUniqueIndexes(t *testing.T) {
+	indexes := testUniqueCollection(t).unique.indexes
+	if len(indexes) != 2 {
+		t.Fatal("Expected only the unique indexes. Got: ", len(indexes))
+	}
+	if indexes[0].caseFold || !indexes[1].caseFold || indexes[1].name != "username_ci" {
+		t.Fatal("Unexpected indexes: ", indexes[0], indexes[1])
+	}
+}
+
+func TestUniqueGuardKey(t *testing.T) {
+	index := &dynamoUniqueIndex{name: "tenant_email", fields: []string{"tenant", "email"}, caseFold: true}
+
+	if key := index.guardKey(map[string]interface{}{"tenant": "acme", "email": "John@Example.com"}); key != `tenant_email#["acme","john@example.com"]` {
+		t.Fatal("Unexpected key: ", key)
+	}
+	if key := index.guardKey(map[string]interface{}{"tenant": "acme"}); key != "" {
+		t.Fatal("Expected no key for a record without the email. Got: ", key)
+	}
+
+	index.partialFilter = map[string]interface{}{"active": true}
+	if key := index.guardKey(map[string]interface{}{"tenant": "acme", "email": "john@example.com", "active": false}); key != "" {
+		t.Fatal("Expected no key for a record outside the partial filter. Got: ", key)
+	}
+	if key := index.guardKey(map[string]interface{}{"tenant": "acme", "email": "john@example.com", "active": true}); key == "" {
+		t.Fatal("Expected a key for a record in the partial filter")
+	}
+}
+
+func TestDynamoTransactionUniqueGuards(t *testing.T) {
+	c := testUniqueCollection(t)
+	kinds := func(tx *DynamoTransaction) []string {
+		if tx.err != nil {
+			t.Fatal(tx.err)
+		}
+		result := []string{}
+		for _, write := range tx.writes {
+			result = append(result, write.kind+":"+write.index)
+		}
+		return result
+	}
+
+	tx := NewDynamoTransaction()
+	tx.collection(c)
+	tx.create(c, map[string]interface{}{"id": "1", "email": "john@example.com"})
+	if writes := kinds(tx); len(writes) != 2 || writes[1] != "create:email" {
+		t.Fatal("Expected a guard for the email. Got: ", writes)
+	}
+
+	current := map[string]interface{}{"id": "1", "email": "john@example.com", "username": "John"}
+	tx = NewDynamoTransaction()
+	tx.collection(c)
+	tx.update(c, "1", nil, current, map[string]interface{}{"email": "jdoe@example.com"}, nil)
+	if writes := kinds(tx); len(writes) != 4 || writes[1] != "create:email" || writes[2] != "delete:email" || writes[3] != "create:username_ci" {
+		t.Fatal("Expected the email guard to be moved. Got: ", writes)
+	}
+	if !tx.writes[0].optimistic {
+		t.Fatal("Expected the update to be conditioned on the unique fields")
+	}
+
+	tx = NewDynamoTransaction()
+	tx.collection(c)
+	tx.remove(c, "1", nil, current, nil)
+	if writes := kinds(tx); len(writes) != 3 || writes[1] != "delete:email" || writes[2] != "delete:username_ci" {
+		t.Fatal("Expected the guards to be deleted. Got: ", writes)
+	}
+}
+
+func TestUniqueTransactionErrors(t *testing.T) {
+	writes := []*dynamoTxWrite{
+		{kind: txUpdate, table: "users", optimistic: true},
+		{kind: txCreate, table: "users", index: "email", fields: []string{"email"}},
+	}
+	err := dynamoTransactionError(cancelledTransaction("None, ConditionalCheckFailed"), writes)
+	if !IsErrAlreadyExists(err) {
+		t.Fatal("Expected a duplicate value error. Got: ", err)
+	}
+	if dupErr, ok := err.(*DuplicateKeyError); !ok || dupErr.Index != "email" || dupErr.Fields[0] != "email" {
+		t.Fatalf("Expected the duplicate email index. Got: %#v", err)
+	}
+	if err := dynamoTransactionError(cancelledTransaction("ConditionalCheckFailed, None"), writes); !IsErrTransactionConflict(err) {
+		t.Fatal("Expected a conflict for a concurrently changed record. Got: ", err)
+	}
+}
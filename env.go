@@ -0,0 +1,102 @@
+package backends
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// envPattern matches ${VAR} and ${VAR:-default}. A reference prefixed with another "$" ($${VAR}) is escaped.
+var envPattern = regexp.MustCompile(`\$(\$)?\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandEnv replaces the environment variable references in all string values of the configuration:
+// ${VAR} is replaced with the value of VAR, and ${VAR:-default} with the value of VAR or the default
+// if VAR is not set or empty. Use $${VAR} for a literal ${VAR}. Maps and slices are expanded recursively.
+// ErrInvalidInput is returned if a variable without default is not set.
+func ExpandEnv(value interface{}) (interface{}, error) {
+	return expandEnvValue(value, os.LookupEnv)
+}
+
+func expandEnvValue(value interface{}, lookup func(string) (string, bool)) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expandEnvString(v, lookup)
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			expanded, err := expandEnvValue(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = expanded
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded, err := expandEnvValue(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+func expandEnvString(value string, lookup func(string) (string, bool)) (string, error) {
+	missing := []string{}
+	result := envPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		match := envPattern.FindStringSubmatch(reference)
+		if match[1] != "" {
+			// escaped
+			return reference[1:]
+		}
+		name, hasDefault, defaultValue := match[2], match[3] != "", match[4]
+		if envValue, ok := lookup(name); ok && (envValue != "" || !hasDefault) {
+			return envValue
+		}
+		if hasDefault {
+			return defaultValue
+		}
+		missing = append(missing, name)
+		return reference
+	})
+	if len(missing) > 0 {
+		return "", ErrInvalidInput(fmt.Sprintf("environment variable %s is not set", strings.Join(missing, ", ")))
+	}
+	return result, nil
+}
+
+// expandEnvConfig expands the environment variable references in the configuration map.
+func expandEnvConfig(conf map[string]interface{}) (map[string]interface{}, error) {
+	expanded, err := ExpandEnv(conf)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(map[string]interface{}), nil
+}
+
+// expandDBInfo returns a copy of the connection configuration with the environment variable
+// references expanded in all properties.
+func expandDBInfo(dbInfo *config.DBInfo) (*config.DBInfo, error) {
+	expanded := *dbInfo
+	value := reflect.ValueOf(&expanded).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.String || !field.CanSet() {
+			continue
+		}
+		result, err := expandEnvString(field.String(), os.LookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		field.SetString(result)
+	}
+	return &expanded, nil
+}
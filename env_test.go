@@ -0,0 +1,102 @@
+package backends
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestExpandEnvString(t *testing.T) {
+	env := map[string]string{
+		"MONGO_HOST": "mongo",
+		"EMPTY":      "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	cases := map[string]string{
+		"${MONGO_HOST}:27017":       "mongo:27017",
+		"${MONGO_PORT:-27017}":      "27017",
+		"${EMPTY:-fallback}":        "fallback",
+		"${EMPTY}":                  "",
+		"${MONGO_HOST:-other}/db":   "mongo/db",
+		"$${MONGO_HOST}":            "${MONGO_HOST}",
+		"pa$$word":                  "pa$$word",
+		"no references":             "no references",
+		"${MONGO_HOST}-${EMPTY:-x}": "mongo-x",
+	}
+	for value, expected := range cases {
+		result, err := expandEnvString(value, lookup)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", value, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("Expected %s to expand to %q, got %q", value, expected, result)
+		}
+	}
+
+	if _, err := expandEnvString("${MISSING}", lookup); err == nil || !IsErrInvalidInput(err) {
+		t.Errorf("Expected invalid input error for a missing variable, got %v", err)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_DB", "users")
+	defer os.Unsetenv("BACKENDS_TEST_DB")
+
+	expanded, err := ExpandEnv(map[string]interface{}{
+		"database": "${BACKENDS_TEST_DB}",
+		"TTL":      3600,
+		"indexes":  []interface{}{"${BACKENDS_TEST_INDEX:-email}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := expanded.(map[string]interface{})
+	if conf["database"] != "users" || conf["TTL"] != 3600 || conf["indexes"].([]interface{})[0] != "email" {
+		t.Errorf("Unexpected expanded config: %v", conf)
+	}
+}
+
+func TestValidateConfigExpandsEnv(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_HOST", "192.168.1.90:89-9")
+	defer os.Unsetenv("BACKENDS_TEST_HOST")
+
+	manager := NewBackendSupport(nil)
+	result, err := ValidateConfig([]byte(`{"dbName": "mongodb", "dbInfo": {"host": "${BACKENDS_TEST_HOST}"}}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid {
+		t.Fatal("Expected the expanded host to be validated")
+	}
+
+	if _, err := ValidateConfig([]byte(`{"dbName": "mongodb", "dbInfo": {"host": "${BACKENDS_TEST_MISSING}"}}`), manager); err == nil {
+		t.Fatal("Expected an error for a missing variable")
+	}
+}
+
+func TestExpandDBInfo(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_USER", "restapi")
+	defer os.Unsetenv("BACKENDS_TEST_USER")
+
+	dbInfo := &config.DBInfo{
+		Host:         "${BACKENDS_TEST_MONGO:-localhost:27017}",
+		Username:     "${BACKENDS_TEST_USER}",
+		DatabaseName: "users",
+	}
+	expanded, err := expandDBInfo(dbInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expanded.Host != "localhost:27017" || expanded.Username != "restapi" || expanded.DatabaseName != "users" {
+		t.Errorf("Unexpected expanded DBInfo: %+v", expanded)
+	}
+	if dbInfo.Username != "${BACKENDS_TEST_USER}" {
+		t.Error("Expected the original DBInfo to be unchanged")
+	}
+}
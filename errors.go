@@ -65,12 +65,20 @@ func toString(args ...interface{}) string {
 // ErrNotFound is the error class for errors returned when the desired enityt is not found.
 var ErrNotFound = ErrorClass("not found")
 
+// RawNotFoundErrors restores the old behavior of MongoDB GetOne returning the raw mgo.ErrNotFound
+// instead of an ErrNotFound error. Set it only for the callers that still compare with mgo.ErrNotFound.
+var RawNotFoundErrors = false
+
 // ErrAlreadyExists is an error class that captures duplication errors.
 var ErrAlreadyExists = ErrorClass("already exists")
 
 // ErrInvalidInput is a generic error class related to invalid input parameters specified on a backend function.
 var ErrInvalidInput = ErrorClass("invalid input")
 
+// ErrConflict is an error class for writes that conflict with the state of other records, such as the delete
+// of a record that other records refer to.
+var ErrConflict = ErrorClass("conflict")
+
 // ErrBackendError is a genering error class capturing errors that happened during processing in the backend.
 var ErrBackendError = func(args ...interface{}) error {
 	return &BackendErrorInfo{
@@ -97,3 +105,8 @@ func IsErrAlreadyExists(err error) bool {
 func IsErrInvalidInput(err error) bool {
 	return IsErrorOfType(err, ErrInvalidInput(""))
 }
+
+// IsErrConflict check of the error is of the ErrConflict class.
+func IsErrConflict(err error) bool {
+	return IsErrorOfType(err, ErrConflict(""))
+}
@@ -0,0 +1,122 @@
+package backends
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of a backend lifecycle event.
+type EventType string
+
+const (
+	// EventBackendConnected is emitted when a backend is built and connected to the database.
+	EventBackendConnected EventType = "backend.connected"
+	// EventBackendReconnected is emitted when a backend re-establishes the connection (or re-authenticates).
+	EventBackendReconnected EventType = "backend.reconnected"
+	// EventBackendDegraded is emitted when a backend fails to connect or loses the connection.
+	EventBackendDegraded EventType = "backend.degraded"
+	// EventRepositoryProvisioned is emitted when a repository (collection/table) is defined.
+	EventRepositoryProvisioned EventType = "repository.provisioned"
+	// EventIndexCreated is emitted when an index is created (or ensured) on a collection.
+	EventIndexCreated EventType = "index.created"
+	// EventRepositoryScan is emitted when a DynamoDB read cannot use a key condition and scans the whole table.
+	EventRepositoryScan EventType = "repository.scan"
+	// EventBackendFailover is emitted when the operations of a backend are routed to the standby cluster.
+	EventBackendFailover EventType = "backend.failover"
+	// EventBackendFailback is emitted when the operations of a backend are routed back to the primary cluster.
+	EventBackendFailback EventType = "backend.failback"
+	// EventCapacityConsumed is emitted after an operation with the capacity it consumed, if the "reportCapacity"
+	// option is set on the backend.
+	EventCapacityConsumed EventType = "capacity.consumed"
+	// EventBackendMaintenance is emitted when the maintenance mode of a backend is set with SetMaintenance.
+	EventBackendMaintenance EventType = "backend.maintenance"
+)
+
+// Event holds the data for a backend lifecycle event.
+type Event struct {
+	Type       EventType
+	Backend    string
+	Database   string
+	Repository string
+	Index      string
+	Error      error
+	Time       time.Time
+	// Capacity is the consumed capacity of an EventCapacityConsumed event.
+	Capacity *CapacityUsage
+	// Attributes are the trace attributes of the operation the event was published for (see TraceAttributeOption).
+	Attributes map[string]string
+	// Maintenance is the maintenance mode set by an EventBackendMaintenance event.
+	Maintenance MaintenanceMode
+}
+
+// EventHandler handles the events delivered by the EventBus.
+// Handlers are called synchronously, so they should not block.
+type EventHandler func(event *Event)
+
+type eventSubscription struct {
+	handler EventHandler
+	types   map[EventType]bool
+}
+
+// EventBus delivers the lifecycle events to the subscribed handlers.
+type EventBus struct {
+	subscriptions map[int]*eventSubscription
+	nextID        int
+	mutex         *sync.RWMutex
+}
+
+// Events is the event bus on which all backends in this package publish their lifecycle events.
+var Events = NewEventBus()
+
+// NewEventBus creates new EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscriptions: map[int]*eventSubscription{},
+		mutex:         &sync.RWMutex{},
+	}
+}
+
+// Subscribe registers the handler for the given event types. If no types are given, the handler
+// receives all events. Returns a function that removes the subscription.
+func (b *EventBus) Subscribe(handler EventHandler, types ...EventType) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	subscription := &eventSubscription{
+		handler: handler,
+		types:   map[EventType]bool{},
+	}
+	for _, eventType := range types {
+		subscription.types[eventType] = true
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subscriptions[id] = subscription
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscriptions, id)
+	}
+}
+
+// Publish delivers the event to all handlers subscribed to the event type.
+func (b *EventBus) Publish(event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.RLock()
+	handlers := []EventHandler{}
+	for _, subscription := range b.subscriptions {
+		if len(subscription.types) == 0 || subscription.types[event.Type] {
+			handlers = append(handlers, subscription.handler)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,36 @@
+package backends
+
+import "testing"
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	all := []*Event{}
+	provisioned := []*Event{}
+
+	bus.Subscribe(func(event *Event) {
+		all = append(all, event)
+	})
+	unsubscribe := bus.Subscribe(func(event *Event) {
+		provisioned = append(provisioned, event)
+	}, EventRepositoryProvisioned)
+
+	bus.Publish(&Event{Type: EventBackendConnected, Backend: "mongodb"})
+	bus.Publish(&Event{Type: EventRepositoryProvisioned, Repository: "users"})
+
+	if len(all) != 2 {
+		t.Fatal("Expected 2 events, got: ", len(all))
+	}
+	if len(provisioned) != 1 || provisioned[0].Repository != "users" {
+		t.Fatal("Expected only the provisioned event. Got: ", provisioned)
+	}
+	if all[0].Time.IsZero() {
+		t.Fatal("Expected event time to be set")
+	}
+
+	unsubscribe()
+	bus.Publish(&Event{Type: EventRepositoryProvisioned, Repository: "tokens"})
+	if len(provisioned) != 1 {
+		t.Fatal("Expected no events after unsubscribe")
+	}
+}
@@ -0,0 +1,190 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/guregu/dynamo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// QueryPlan is the query plan of a GetAll, normalized over the backends.
+type QueryPlan struct {
+	// Backend is the backend that ran the query: "mongodb" or "dynamodb".
+	Backend string
+	// Operation is how the records are read: "Query" or "Scan" on DynamoDB, and the stage of the winning
+	// plan that reads the records on MongoDB, for example "IXSCAN", "COLLSCAN" or "IDHACK".
+	Operation string
+	// Index is the name of the used index. It is empty for a collection scan, and for a DynamoDB Query
+	// on the key of the table.
+	Index string
+	// UsesIndex is true if the records are found by an index or by the key of the DynamoDB table, instead
+	// of a full scan.
+	UsesIndex bool
+	// KeysExamined and DocsExamined are the numbers of the index keys and the documents examined by MongoDB.
+	KeysExamined int
+	DocsExamined int
+	// Returned is the number of the returned records.
+	Returned int
+	// ConsumedCapacity is the read capacity consumed by DynamoDB.
+	ConsumedCapacity float64
+	// Native is the explain output of MongoDB (bson.M), or the *dynamo.ConsumedCapacity of DynamoDB.
+	Native interface{}
+}
+
+// ExplainRepository is implemented by the repositories that can explain their queries.
+type ExplainRepository interface {
+	// ExplainGetAll returns the plan of GetAll with the filter and the options.
+	ExplainGetAll(filter Filter, options QueryOptions) (*QueryPlan, error)
+}
+
+// ExplainGetAll returns the plan of GetAll with the filter and the options, to check that a filter uses an
+// index before it is shipped:
+//
+//	plan, err := backends.ExplainGetAll(repo, backends.Filter{"email": email}, backends.QueryOptions{})
+//	if err == nil && !plan.UsesIndex {
+//		log.Printf("the query scans the %s collection", repo)
+//	}
+//
+// The query is run to collect its statistics: MongoDB runs explain, and DynamoDB reads the matched records
+// and consumes the read capacity of the GetAll. Returns an error if the repository does not support explain.
+func ExplainGetAll(repo Repository, filter Filter, options QueryOptions) (*QueryPlan, error) {
+	if r, ok := repo.(ExplainRepository); ok {
+		return r.ExplainGetAll(filter, options)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("explain is not supported on %T", repo))
+}
+
+// ExplainGetAll explains the query on the active backend.
+func (r *failoverRepository) ExplainGetAll(filter Filter, options QueryOptions) (*QueryPlan, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return ExplainGetAll(repository, filter, options)
+}
+
+// ExplainGetAll runs explain on the find query of GetAll.
+func (s *MongoSession) ExplainGetAll(filter Filter, options QueryOptions) (*QueryPlan, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(s.repoDef, filter, options.Order); err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, c := s.getReadCollection()
+	defer session.Close()
+
+	query, err := s.findQuery(c, filter, SortBy(options.Order, options.Sorting), options.Limit, options.Offset)
+	if err != nil {
+		return nil, err
+	}
+	explain := bson.M{}
+	if err := query.Explain(&explain); err != nil {
+		return nil, err
+	}
+	return mongoQueryPlan(explain), nil
+}
+
+// mongoQueryPlan returns the plan of the MongoDB explain output: the queryPlanner and executionStats of
+// MongoDB 3.0 and later, or the cursor of the older servers.
+func mongoQueryPlan(explain map[string]interface{}) *QueryPlan {
+	plan := &QueryPlan{Backend: "mongodb", Native: explain}
+
+	if cursor, ok := explain["cursor"].(string); ok {
+		// BasicCursor or "BtreeCursor <index>"
+		parts := strings.SplitN(cursor, " ", 2)
+		plan.Operation = parts[0]
+		if len(parts) == 2 {
+			plan.Index = parts[1]
+		}
+		plan.UsesIndex = plan.Index != ""
+		plan.KeysExamined = explainInt(explain["nscanned"])
+		plan.DocsExamined = explainInt(explain["nscannedObjects"])
+		plan.Returned = explainInt(explain["n"])
+		return plan
+	}
+
+	if planner, ok := genericRecord(explain["queryPlanner"]); ok {
+		if winning, ok := genericRecord(planner["winningPlan"]); ok {
+			stage := accessStage(winning)
+			plan.Operation, _ = stage["stage"].(string)
+			switch plan.Operation {
+			case "IDHACK":
+				plan.Index = "_id_"
+			default:
+				plan.Index, _ = stage["indexName"].(string)
+			}
+			plan.UsesIndex = plan.Index != ""
+		}
+	}
+	if stats, ok := genericRecord(explain["executionStats"]); ok {
+		plan.KeysExamined = explainInt(stats["totalKeysExamined"])
+		plan.DocsExamined = explainInt(stats["totalDocsExamined"])
+		plan.Returned = explainInt(stats["nReturned"])
+	}
+	return plan
+}
+
+// accessStage returns the innermost stage of the plan, which reads the records from the collection or an index.
+func accessStage(stage map[string]interface{}) map[string]interface{} {
+	if input, ok := genericRecord(stage["inputStage"]); ok {
+		return accessStage(input)
+	}
+	if inputs, ok := stage["inputStages"].([]interface{}); ok && len(inputs) > 0 {
+		if input, ok := genericRecord(inputs[0]); ok {
+			return accessStage(input)
+		}
+	}
+	return stage
+}
+
+func explainInt(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	i, _ := intValue(reflect.ValueOf(value))
+	return int(i)
+}
+
+// ExplainGetAll returns the Query or Scan that GetAll runs for the filter, with the read capacity it consumes.
+func (c *DynamoCollection) ExplainGetAll(filter Filter, options QueryOptions) (*QueryPlan, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(c.RepositoryDefinition, filter, options.Order); err != nil {
+		return nil, err
+	}
+	if err := convertIDFilter(filter, c.RepositoryDefinition.GetIDType(), false); err != nil {
+		return nil, err
+	}
+
+	cc := &dynamo.ConsumedCapacity{}
+	itr, paths := c.iter(filter, options.Order, options.Sorting, nil, cc)
+	plan := &QueryPlan{Backend: "dynamodb", Operation: "Scan", Native: cc}
+	if len(paths) > 1 {
+		// a Query on the access path
+		plan.Operation = "Query"
+		plan.Index = paths[len(paths)-1].Index
+		plan.UsesIndex = true
+	}
+
+	results, err := collectRecords(itr, map[string]interface{}{}, options.Limit, options.Offset)
+	if err != nil {
+		return nil, err
+	}
+	plan.Returned = len(results.([]*map[string]interface{}))
+	plan.ConsumedCapacity = cc.Total
+	return plan, nil
+}
@@ -0,0 +1,56 @@
+package backends
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestMongoQueryPlan(t *testing.T) {
+	explain := bson.M{
+		"queryPlanner": bson.M{
+			"winningPlan": bson.M{
+				"stage": "LIMIT",
+				"inputStage": bson.M{
+					"stage": "FETCH",
+					"inputStage": bson.M{
+						"stage":     "IXSCAN",
+						"indexName": "email_1",
+					},
+				},
+			},
+		},
+		"executionStats": bson.M{
+			"nReturned":         1,
+			"totalKeysExamined": int64(1),
+			"totalDocsExamined": 1.0,
+		},
+	}
+	plan := mongoQueryPlan(explain)
+	if plan.Operation != "IXSCAN" || plan.Index != "email_1" || !plan.UsesIndex {
+		t.Fatalf("Expected an index scan. Got: %+v", plan)
+	}
+	if plan.KeysExamined != 1 || plan.DocsExamined != 1 || plan.Returned != 1 {
+		t.Fatalf("Expected the execution stats. Got: %+v", plan)
+	}
+
+	plan = mongoQueryPlan(bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"stage": "COLLSCAN"}}})
+	if plan.Operation != "COLLSCAN" || plan.UsesIndex {
+		t.Fatalf("Expected a collection scan. Got: %+v", plan)
+	}
+	plan = mongoQueryPlan(bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"stage": "IDHACK"}}})
+	if plan.Index != "_id_" || !plan.UsesIndex {
+		t.Fatalf("Expected the _id index. Got: %+v", plan)
+	}
+
+	plan = mongoQueryPlan(bson.M{"cursor": "BtreeCursor email_1", "n": 2, "nscanned": 2, "nscannedObjects": 2})
+	if plan.Operation != "BtreeCursor" || plan.Index != "email_1" || plan.Returned != 2 {
+		t.Fatalf("Expected the plan of the legacy output. Got: %+v", plan)
+	}
+}
+
+func TestExplainGetAllUnsupported(t *testing.T) {
+	if _, err := ExplainGetAll(&memoryRepo{}, Filter{}, QueryOptions{}); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a repository without explain. Got: ", err)
+	}
+}
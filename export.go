@@ -0,0 +1,322 @@
+package backends
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats of the exported records.
+const (
+	// FormatJSONLines writes one JSON object per line.
+	FormatJSONLines = "jsonl"
+	// FormatCSV writes a header row with the property names and one row per record.
+	FormatCSV = "csv"
+)
+
+// defaultTransferBatchSize is the number of records read (or imported) between the progress callbacks.
+const defaultTransferBatchSize = 100
+
+// ExportOptions configures ExportCollection.
+type ExportOptions struct {
+	// BatchSize is the number of records read from the repository at once. Defaults to 100.
+	BatchSize int
+	// Fields are the exported properties. All properties are exported if not set; the CSV columns are then
+	// the properties of the first batch of records.
+	Fields []string
+	// Progress, if set, is called after every batch with the number of records exported so far.
+	Progress func(exported int)
+}
+
+// ImportOptions configures ImportCollection.
+type ImportOptions struct {
+	// BatchSize is the number of records imported between the progress callbacks. Defaults to 100.
+	BatchSize int
+	// Key are the properties identifying a record. If set, the records that match the key of an imported
+	// record are updated instead of creating new ones, so an import can be repeated.
+	Key []string
+	// Progress, if set, is called after every batch with the number of records imported so far.
+	Progress func(imported int)
+}
+
+// ExportCollection writes the records of the repository that match the filter in the format (FormatJSONLines or
+// FormatCSV). The records are read in batches, so large collections are not loaded into memory. For example,
+// to export the data of a user:
+//
+//	exported, err := backends.ExportCollection(ordersRepo, backends.Filter{"userId": userID}, w, backends.FormatJSONLines, backends.ExportOptions{})
+//
+// Returns the number of exported records.
+func ExportCollection(repo Repository, filter Filter, writer io.Writer, format string, options ExportOptions) (int, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultTransferBatchSize
+	}
+	var encoder recordEncoder
+	switch format {
+	case FormatJSONLines:
+		encoder = &jsonLinesEncoder{writer: bufio.NewWriter(writer), fields: options.Fields}
+	case FormatCSV:
+		encoder = &csvEncoder{writer: csv.NewWriter(writer), fields: options.Fields}
+	default:
+		return 0, ErrInvalidInput(fmt.Sprintf("unknown export format %s", format))
+	}
+
+	exported := 0
+	for {
+		page, err := repo.GetAll(copyFilter(filter), map[string]interface{}{}, "", "", batchSize, exported)
+		if err != nil && !IsErrNotFound(err) {
+			return exported, err
+		}
+		records := []map[string]interface{}{}
+		err = IterateOverSlice(page, func(i int, item interface{}) error {
+			record, err := toAuditMap(item)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return exported, err
+		}
+
+		if err := encoder.encode(records); err != nil {
+			return exported, err
+		}
+		exported += len(records)
+		if options.Progress != nil && len(records) > 0 {
+			options.Progress(exported)
+		}
+		if len(records) < batchSize {
+			return exported, encoder.flush()
+		}
+	}
+}
+
+// ImportCollection reads the records in the format (FormatJSONLines or FormatCSV) and saves them to the
+// repository. The records are read one at a time, so large files are not loaded into memory. The values
+// of the CSV cells are imported as strings, except for JSON objects and arrays; use JSON Lines to keep
+// the types of the values. The "_id" of the records is ignored. For example, to seed a repository:
+//
+//	imported, err := backends.ImportCollection(usersRepo, file, backends.FormatJSONLines, backends.ImportOptions{Key: []string{"email"}})
+//
+// Returns the number of imported records.
+func ImportCollection(repo Repository, reader io.Reader, format string, options ImportOptions) (int, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultTransferBatchSize
+	}
+	var decoder recordDecoder
+	switch format {
+	case FormatJSONLines:
+		decoder = &jsonLinesDecoder{decoder: json.NewDecoder(reader)}
+	case FormatCSV:
+		decoder = &csvDecoder{reader: csv.NewReader(reader)}
+	default:
+		return 0, ErrInvalidInput(fmt.Sprintf("unknown import format %s", format))
+	}
+
+	imported := 0
+	for {
+		record, err := decoder.decode()
+		if err == io.EOF {
+			if options.Progress != nil && imported%batchSize != 0 {
+				options.Progress(imported)
+			}
+			return imported, nil
+		}
+		if err != nil {
+			return imported, ErrInvalidInput(fmt.Sprintf("record %d: %s", imported+1, err))
+		}
+		delete(record, "_id")
+
+		if err := importRecord(repo, record, options.Key); err != nil {
+			return imported, err
+		}
+		imported++
+		if options.Progress != nil && imported%batchSize == 0 {
+			options.Progress(imported)
+		}
+	}
+}
+
+// importRecord creates the record, or updates the record with the same key.
+func importRecord(repo Repository, record map[string]interface{}, key []string) error {
+	if len(key) > 0 {
+		filter, err := bootstrapFilter(key, record)
+		if err != nil {
+			return err
+		}
+		_, err = repo.GetOne(filter, &map[string]interface{}{})
+		if err == nil {
+			filter, _ = bootstrapFilter(key, record)
+			_, err = repo.Save(&record, filter)
+			return err
+		}
+		if !IsErrNotFound(err) {
+			return err
+		}
+	}
+	_, err := repo.Save(&record, nil)
+	return err
+}
+
+type recordEncoder interface {
+	encode(records []map[string]interface{}) error
+	flush() error
+}
+
+type jsonLinesEncoder struct {
+	writer *bufio.Writer
+	fields []string
+}
+
+func (e *jsonLinesEncoder) encode(records []map[string]interface{}) error {
+	encoder := json.NewEncoder(e.writer)
+	for _, record := range records {
+		if e.fields != nil {
+			selected := map[string]interface{}{}
+			for _, field := range e.fields {
+				if value, ok := record[field]; ok {
+					selected[field] = value
+				}
+			}
+			record = selected
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonLinesEncoder) flush() error {
+	return e.writer.Flush()
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+	fields []string
+	header bool
+}
+
+func (e *csvEncoder) encode(records []map[string]interface{}) error {
+	if !e.header {
+		if e.fields == nil {
+			e.fields = recordFields(records)
+		}
+		if len(e.fields) > 0 {
+			if err := e.writer.Write(e.fields); err != nil {
+				return err
+			}
+		}
+		e.header = true
+	}
+	for _, record := range records {
+		row := make([]string, len(e.fields))
+		for i, field := range e.fields {
+			cell, err := csvCell(record[field])
+			if err != nil {
+				return err
+			}
+			row[i] = cell
+		}
+		if err := e.writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// recordFields returns the sorted names of the properties of the records.
+func recordFields(records []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, record := range records {
+		for field := range record {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// csvCell formats the value for a CSV cell: strings as they are, times in RFC3339, and objects and
+// arrays as JSON.
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+type recordDecoder interface {
+	decode() (map[string]interface{}, error)
+}
+
+type jsonLinesDecoder struct {
+	decoder *json.Decoder
+}
+
+func (d *jsonLinesDecoder) decode() (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+	if err := d.decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	header []string
+}
+
+func (d *csvDecoder) decode() (map[string]interface{}, error) {
+	if d.header == nil {
+		header, err := d.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		d.header = header
+	}
+	row, err := d.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]interface{}{}
+	for i, cell := range row {
+		if cell == "" {
+			continue
+		}
+		var value interface{} = cell
+		if strings.HasPrefix(cell, "{") || strings.HasPrefix(cell, "[") {
+			var decoded interface{}
+			if json.Unmarshal([]byte(cell), &decoded) == nil {
+				value = decoded
+			}
+		}
+		record[d.header[i]] = value
+	}
+	return record, nil
+}
@@ -0,0 +1,88 @@
+package backends
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportImportJSONLines(t *testing.T) {
+	source := &memoryRepo{}
+	for _, name := range []string{"ann", "bob", "cid", "dan", "eve"} {
+		source.records = append(source.records, map[string]interface{}{"name": name, "team": "a", "tags": []interface{}{"x"}})
+	}
+	source.records[4]["team"] = "b"
+
+	progress := []int{}
+	var buffer bytes.Buffer
+	exported, err := ExportCollection(source, Filter{"team": "a"}, &buffer, FormatJSONLines, ExportOptions{
+		BatchSize: 2,
+		Progress:  func(exported int) { progress = append(progress, exported) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != 4 || len(strings.Split(strings.TrimSpace(buffer.String()), "\n")) != 4 {
+		t.Fatal("Expected 4 exported records. Got: ", exported, buffer.String())
+	}
+	if len(progress) != 2 || progress[1] != 4 {
+		t.Fatal("Expected a progress callback per batch. Got: ", progress)
+	}
+
+	target := &memoryRepo{}
+	data := buffer.String()
+	for i := 0; i < 2; i++ {
+		imported, err := ImportCollection(target, strings.NewReader(data), FormatJSONLines, ImportOptions{Key: []string{"name"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported != 4 {
+			t.Fatal("Expected 4 imported records. Got: ", imported)
+		}
+	}
+	if len(target.records) != 4 {
+		t.Fatal("Expected the repeated import to update the records. Got: ", target.records)
+	}
+	if tags, ok := target.records[0]["tags"].([]interface{}); !ok || tags[0] != "x" {
+		t.Fatal("Expected the arrays to be imported. Got: ", target.records[0])
+	}
+}
+
+func TestExportImportCSV(t *testing.T) {
+	source := &memoryRepo{records: []map[string]interface{}{
+		{"name": "ann", "address": map[string]interface{}{"city": "Skopje"}},
+		{"name": "bob, jr", "age": 42},
+	}}
+
+	var buffer bytes.Buffer
+	if _, err := ExportCollection(source, nil, &buffer, FormatCSV, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "address,age,name\n\"{\"\"city\"\":\"\"Skopje\"\"}\",,ann\n,42,\"bob, jr\"\n"
+	if buffer.String() != expected {
+		t.Fatalf("Unexpected CSV:\n%s", buffer.String())
+	}
+
+	target := &memoryRepo{}
+	if _, err := ImportCollection(target, &buffer, FormatCSV, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.records) != 2 || target.records[1]["age"] != "42" || target.records[1]["name"] != "bob, jr" {
+		t.Fatal("Unexpected records: ", target.records)
+	}
+	if _, ok := target.records[0]["age"]; ok {
+		t.Fatal("Expected the empty cells to be skipped. Got: ", target.records[0])
+	}
+	if address, ok := target.records[0]["address"].(map[string]interface{}); !ok || address["city"] != "Skopje" {
+		t.Fatal("Expected the objects to be imported. Got: ", target.records[0])
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if _, err := ExportCollection(&memoryRepo{}, nil, &bytes.Buffer{}, "xml", ExportOptions{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+	if _, err := ImportCollection(&memoryRepo{}, strings.NewReader("{"), FormatJSONLines, ImportOptions{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid record. Got: ", err)
+	}
+}
@@ -0,0 +1,368 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// HEALTH_CHECK_CTX_KEY is the backend context key for the health check function (func() error).
+var HEALTH_CHECK_CTX_KEY = "HEALTH_CHECK"
+
+const (
+	defaultFailoverThreshold   = 3
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+// FailoverConfig configures the failover to the standby cluster.
+type FailoverConfig struct {
+	// Threshold is the number of consecutive failed health checks of the primary before the operations
+	// are routed to the standby. With AutoFailback, it is also the number of consecutive successful health
+	// checks of the primary before the operations are routed back. Defaults to 3.
+	Threshold int
+	// Interval between the health checks. Defaults to 10 seconds.
+	Interval time.Duration
+	// AutoFailback routes the operations back to the primary once it is healthy again. Otherwise
+	// the fail-back is done manually with FailoverBackend.FailBack.
+	AutoFailback bool
+}
+
+// failoverConfigFromOptions reads the failover configuration from the backend options
+// ("failoverThreshold", "healthCheckInterval" and "autoFailback").
+func failoverConfigFromOptions(options BackendOptions) FailoverConfig {
+	return FailoverConfig{
+		Threshold:    options.GetInt("failoverThreshold"),
+		Interval:     options.GetDuration("healthCheckInterval"),
+		AutoFailback: options.GetBool("autoFailback"),
+	}
+}
+
+// standbyDBInfo returns the connection configuration of the standby cluster: the primary configuration
+// with the properties set in the "standby" backend option. Returns nil if no standby is configured.
+func standbyDBInfo(dbInfo *config.DBInfo, options BackendOptions) *config.DBInfo {
+	standby, ok := options["standby"].(map[string]interface{})
+	if !ok || len(standby) == 0 {
+		return nil
+	}
+	standbyInfo := *dbInfo
+	fields := map[string]*string{
+		"host":        &standbyInfo.Host,
+		"database":    &standbyInfo.DatabaseName,
+		"user":        &standbyInfo.Username,
+		"pass":        &standbyInfo.Password,
+		"credentials": &standbyInfo.AWSCredentials,
+		"endpoint":    &standbyInfo.AWSEndpoint,
+		"awsRegion":   &standbyInfo.AWSRegion,
+	}
+	for key, field := range fields {
+		if value, ok := standby[key].(string); ok && value != "" {
+			*field = value
+		}
+	}
+	return &standbyInfo
+}
+
+// Ping checks the connection to the database with the health check function set by the backend builder.
+// Returns nil if the backend has no health check.
+func (m *RepositoriesBackend) Ping() error {
+	if check, ok := m.GetFromContext(HEALTH_CHECK_CTX_KEY).(func() error); ok {
+		return check()
+	}
+	return nil
+}
+
+// pingBackend checks the connection of the backend, if the backend supports health checks.
+func pingBackend(backend Backend) error {
+	if pinger, ok := backend.(interface{ Ping() error }); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// FailoverBackend routes the repository operations to the primary backend and, when the primary fails
+// the health checks Threshold times in a row, to the standby backend. The repositories are defined on both.
+// The BackendManager builds a FailoverBackend when the "standby" backend option is set.
+type FailoverBackend struct {
+	backendType  string
+	primary      Backend
+	standby      Backend
+	config       FailoverConfig
+	failedOver   bool
+	failures     int
+	successes    int
+	repositories map[string]*failoverRepository
+	mutex        *sync.Mutex
+	stop         chan struct{}
+	once         *sync.Once
+}
+
+// NewFailoverBackend creates a FailoverBackend for the primary and standby backends.
+// Call Start to begin the health checks.
+func NewFailoverBackend(backendType string, primary, standby Backend, config FailoverConfig) *FailoverBackend {
+	if config.Threshold <= 0 {
+		config.Threshold = defaultFailoverThreshold
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultHealthCheckInterval
+	}
+	return &FailoverBackend{
+		backendType:  backendType,
+		primary:      primary,
+		standby:      standby,
+		config:       config,
+		repositories: map[string]*failoverRepository{},
+		mutex:        &sync.Mutex{},
+		stop:         make(chan struct{}),
+		once:         &sync.Once{},
+	}
+}
+
+// Start runs the health checks of the primary in the background until the backend is closed.
+func (b *FailoverBackend) Start() {
+	go func() {
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(b.config.Interval):
+			}
+			b.check()
+		}
+	}()
+}
+
+// check runs one health check of the primary and fails over (or back) when the threshold is reached.
+func (b *FailoverBackend) check() {
+	err := pingBackend(b.primary)
+
+	b.mutex.Lock()
+	if err != nil {
+		b.failures++
+		b.successes = 0
+	} else {
+		b.successes++
+		b.failures = 0
+	}
+	failOver := !b.failedOver && b.failures >= b.config.Threshold
+	failBack := b.failedOver && b.config.AutoFailback && b.successes >= b.config.Threshold
+	b.mutex.Unlock()
+
+	if failOver {
+		log.Printf("WARN: %s primary failed %d health checks, failing over to the standby: %s\n", b.backendType, b.config.Threshold, err.Error())
+		b.switchTo(true, err)
+	}
+	if failBack {
+		log.Printf("%s primary is healthy again, failing back from the standby.\n", b.backendType)
+		b.switchTo(false, nil)
+	}
+}
+
+// FailOver routes the operations to the standby backend.
+func (b *FailoverBackend) FailOver() {
+	b.switchTo(true, nil)
+}
+
+// FailBack routes the operations back to the primary backend.
+func (b *FailoverBackend) FailBack() {
+	b.switchTo(false, nil)
+}
+
+func (b *FailoverBackend) switchTo(standby bool, cause error) {
+	b.mutex.Lock()
+	if b.failedOver == standby {
+		b.mutex.Unlock()
+		return
+	}
+	b.failedOver = standby
+	b.failures = 0
+	b.successes = 0
+	b.mutex.Unlock()
+
+	eventType := EventBackendFailback
+	active := b.primary
+	if standby {
+		eventType = EventBackendFailover
+		active = b.standby
+	}
+	Events.Publish(&Event{
+		Type:     eventType,
+		Backend:  b.backendType,
+		Database: active.GetConfig().DatabaseName,
+		Error:    cause,
+	})
+}
+
+// IsFailedOver checks if the operations are routed to the standby backend.
+func (b *FailoverBackend) IsFailedOver() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failedOver
+}
+
+// Active returns the backend the operations are currently routed to.
+func (b *FailoverBackend) Active() Backend {
+	if b.IsFailedOver() {
+		return b.standby
+	}
+	return b.primary
+}
+
+// Primary returns the primary backend.
+func (b *FailoverBackend) Primary() Backend {
+	return b.primary
+}
+
+// Standby returns the standby backend.
+func (b *FailoverBackend) Standby() Backend {
+	return b.standby
+}
+
+// DefineRepository defines the repository on both backends. The returned repository routes
+// the operations to the active backend.
+func (b *FailoverBackend) DefineRepository(name string, def RepositoryDefinition) (Repository, error) {
+	return b.GetOrCreateRepository(name, def)
+}
+
+// GetOrCreateRepository returns the repository with the name, defining it on both backends on the first use.
+func (b *FailoverBackend) GetOrCreateRepository(name string, def RepositoryDefinition) (Repository, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if repository, ok := b.repositories[name]; ok {
+		return repository, nil
+	}
+	if _, err := b.primary.GetOrCreateRepository(name, def); err != nil {
+		return nil, err
+	}
+	if _, err := b.standby.GetOrCreateRepository(name, def); err != nil {
+		return nil, err
+	}
+	repository := &failoverRepository{
+		backend: b,
+		name:    name,
+	}
+	b.repositories[name] = repository
+	return repository, nil
+}
+
+// GetRepository returns the repository that routes the operations to the active backend.
+func (b *FailoverBackend) GetRepository(name string) (Repository, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if repository, ok := b.repositories[name]; ok {
+		return repository, nil
+	}
+	return nil, fmt.Errorf("unknown repo")
+}
+
+// RepositoryDefinitions returns the definitions of the repositories defined on the primary backend.
+func (b *FailoverBackend) RepositoryDefinitions() map[string]RepositoryDefinition {
+	if definer, ok := b.primary.(interface {
+		RepositoryDefinitions() map[string]RepositoryDefinition
+	}); ok {
+		return definer.RepositoryDefinitions()
+	}
+	return map[string]RepositoryDefinition{}
+}
+
+// GetConfig returns the config of the active backend.
+func (b *FailoverBackend) GetConfig() *config.DBInfo {
+	return b.Active().GetConfig()
+}
+
+// GetFromContext returns the value from the context of the active backend.
+func (b *FailoverBackend) GetFromContext(key string) interface{} {
+	return b.Active().GetFromContext(key)
+}
+
+// SetInContext sets the value in the context of both backends.
+func (b *FailoverBackend) SetInContext(key string, value interface{}) {
+	b.primary.SetInContext(key, value)
+	b.standby.SetInContext(key, value)
+}
+
+// Capabilities returns the features supported by the active backend.
+func (b *FailoverBackend) Capabilities() *Capabilities {
+	return b.Active().Capabilities()
+}
+
+// Ping checks the connection of the active backend.
+func (b *FailoverBackend) Ping() error {
+	return pingBackend(b.Active())
+}
+
+// Close stops the health checks and closes both backends. The first error is returned.
+func (b *FailoverBackend) Close(ctx context.Context) error {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	standbyErr := b.standby.Close(ctx)
+	if err := b.primary.Close(ctx); err != nil {
+		return err
+	}
+	return standbyErr
+}
+
+// Shutdown stops the health checks and shuts down both backends.
+func (b *FailoverBackend) Shutdown() {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	b.standby.Shutdown()
+	b.primary.Shutdown()
+}
+
+// failoverRepository routes every operation to the repository on the active backend.
+type failoverRepository struct {
+	backend *FailoverBackend
+	name    string
+}
+
+func (r *failoverRepository) active() (Repository, error) {
+	return r.backend.Active().GetRepository(r.name)
+}
+
+func (r *failoverRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return repository.GetOne(filter, result)
+}
+
+func (r *failoverRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+func (r *failoverRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return repository.Save(object, filter)
+}
+
+func (r *failoverRepository) DeleteOne(filter Filter) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	return repository.DeleteOne(filter)
+}
+
+func (r *failoverRepository) DeleteAll(filter Filter) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	return repository.DeleteAll(filter)
+}
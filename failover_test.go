@@ -0,0 +1,145 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type pingResult struct {
+	err   error
+	mutex sync.Mutex
+}
+
+func (p *pingResult) set(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.err = err
+}
+
+func (p *pingResult) get() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+func newPingBackend(host string, ping *pingResult) *RepositoriesBackend {
+	ctx := context.WithValue(context.Background(), HEALTH_CHECK_CTX_KEY, ping.get)
+	return NewRepositoriesBackend(ctx, &config.DBInfo{Host: host}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return &memoryRepo{}, nil
+	}, func() {}).(*RepositoriesBackend)
+}
+
+func TestFailoverBackend(t *testing.T) {
+	primaryPing := &pingResult{}
+	primary := newPingBackend("primary:27017", primaryPing)
+	standby := newPingBackend("standby:27017", &pingResult{})
+
+	events := []EventType{}
+	unsubscribe := Events.Subscribe(func(event *Event) {
+		events = append(events, event.Type)
+	}, EventBackendFailover, EventBackendFailback)
+	defer unsubscribe()
+
+	backend := NewFailoverBackend("db", primary, standby, FailoverConfig{Threshold: 2, AutoFailback: true})
+	repo, err := backend.DefineRepository("users", &RepositoryDefinitionMap{"name": "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := standby.GetRepository("users"); err != nil {
+		t.Fatal("Expected the repository to be defined on the standby: ", err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	primaryPing.set(fmt.Errorf("no reachable servers"))
+	backend.check()
+	if backend.IsFailedOver() {
+		t.Fatal("Expected no failover before the threshold")
+	}
+	backend.check()
+	if !backend.IsFailedOver() || backend.GetConfig().Host != "standby:27017" {
+		t.Fatal("Expected failover to the standby")
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	primaryRepo, _ := primary.GetRepository("users")
+	standbyRepo, _ := standby.GetRepository("users")
+	if len(primaryRepo.(*memoryRepo).records) != 1 || len(standbyRepo.(*memoryRepo).records) != 1 {
+		t.Fatal("Expected the operations to be routed to the active backend")
+	}
+
+	primaryPing.set(nil)
+	backend.check()
+	backend.check()
+	if backend.IsFailedOver() {
+		t.Fatal("Expected automatic fail-back to the primary")
+	}
+
+	if len(events) != 2 || events[0] != EventBackendFailover || events[1] != EventBackendFailback {
+		t.Fatal("Unexpected events: ", events)
+	}
+}
+
+func TestFailoverBackendManualFailback(t *testing.T) {
+	primaryPing := &pingResult{err: fmt.Errorf("no reachable servers")}
+	backend := NewFailoverBackend("db", newPingBackend("primary:27017", primaryPing), newPingBackend("standby:27017", &pingResult{}), FailoverConfig{Threshold: 1})
+
+	backend.check()
+	if !backend.IsFailedOver() {
+		t.Fatal("Expected failover to the standby")
+	}
+
+	primaryPing.set(nil)
+	backend.check()
+	backend.check()
+	if !backend.IsFailedOver() {
+		t.Fatal("Expected no automatic fail-back")
+	}
+
+	backend.FailBack()
+	if backend.IsFailedOver() || backend.GetConfig().Host != "primary:27017" {
+		t.Fatal("Expected manual fail-back to the primary")
+	}
+}
+
+func TestBackendManagerStandby(t *testing.T) {
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"db": &config.DBInfo{Host: "primary:27017", DatabaseName: "users"},
+	})
+	manager.SupportBackend("db", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return NewRepositoriesBackend(context.Background(), dbInfo, repoBuilderFn, func() {}), nil
+	}, map[string]interface{}{})
+	manager.SetBackendOptions("db", BackendOptions{
+		"standby": map[string]interface{}{
+			"host": "standby:27017",
+		},
+		"healthCheckInterval": "1h",
+	})
+
+	backend, err := manager.GetBackend("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Shutdown(context.Background())
+
+	failover, ok := backend.(*FailoverBackend)
+	if !ok {
+		t.Fatalf("Expected a FailoverBackend, got %T", backend)
+	}
+	standby := failover.Standby().GetConfig()
+	if standby.Host != "standby:27017" || standby.DatabaseName != "users" {
+		t.Fatal("Unexpected standby config: ", standby)
+	}
+	if failover.config.Interval != time.Hour || failover.config.Threshold != defaultFailoverThreshold {
+		t.Fatal("Unexpected failover config: ", failover.config)
+	}
+}
@@ -0,0 +1,289 @@
+package backends
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	// Name is the name of the file in the repository.
+	Name string `json:"name"`
+	// ContentType is the MIME type of the content, if set when the file was saved.
+	ContentType string `json:"contentType,omitempty"`
+	// Size is the size of the content in bytes.
+	Size int64 `json:"size"`
+	// UploadedAt is the time the file was saved.
+	UploadedAt time.Time `json:"uploadedAt"`
+}
+
+// FileRepository is implemented by the repositories that can store files (avatars, documents...) next to
+// their records. The files are named; saving a file with an existing name replaces it.
+type FileRepository interface {
+	// SaveFile stores the content read from the reader as the named file and returns its info.
+	SaveFile(name, contentType string, content io.Reader) (*FileInfo, error)
+
+	// CreateFile returns a writer that streams the content of the named file to the storage.
+	// The file is stored (and replaces an existing file) when the writer is closed.
+	CreateFile(name, contentType string) (io.WriteCloser, error)
+
+	// GetFile opens the named file for reading. The reader must be closed.
+	GetFile(name string) (io.ReadCloser, *FileInfo, error)
+
+	// DeleteFile deletes the named file.
+	DeleteFile(name string) error
+}
+
+// SaveFile stores the content as the named file of the repository, replacing any file with the same name.
+// The content is streamed, so large files are not read into memory. For example:
+//
+//	info, err := backends.SaveFile(usersRepo, "avatars/"+userID, "image/png", request.Body)
+//
+// Returns an error if the repository does not support files.
+func SaveFile(repo Repository, name, contentType string, content io.Reader) (*FileInfo, error) {
+	r, err := fileRepository(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.SaveFile(name, contentType, content)
+}
+
+// CreateFile returns a writer for the named file of the repository. The file is stored when the writer is
+// closed, and the error of the upload is returned by Close.
+func CreateFile(repo Repository, name, contentType string) (io.WriteCloser, error) {
+	r, err := fileRepository(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.CreateFile(name, contentType)
+}
+
+// GetFile opens the named file of the repository for reading. The reader must be closed.
+// Returns ErrNotFound if there is no file with the name.
+func GetFile(repo Repository, name string) (io.ReadCloser, *FileInfo, error) {
+	r, err := fileRepository(repo, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.GetFile(name)
+}
+
+// DeleteFile deletes the named file of the repository. Returns ErrNotFound if there is no file with the name.
+func DeleteFile(repo Repository, name string) error {
+	r, err := fileRepository(repo, name)
+	if err != nil {
+		return err
+	}
+	return r.DeleteFile(name)
+}
+
+func fileRepository(repo Repository, name string) (FileRepository, error) {
+	if name == "" {
+		return nil, ErrInvalidInput("the file name is required")
+	}
+	if r, ok := repo.(FileRepository); ok {
+		return r, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("files are not supported on %T", repo))
+}
+
+// SaveFile stores the file on the active backend.
+func (r *failoverRepository) SaveFile(name, contentType string, content io.Reader) (*FileInfo, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return SaveFile(repository, name, contentType, content)
+}
+
+// CreateFile creates the file on the active backend.
+func (r *failoverRepository) CreateFile(name, contentType string) (io.WriteCloser, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return CreateFile(repository, name, contentType)
+}
+
+// GetFile opens the file on the active backend.
+func (r *failoverRepository) GetFile(name string) (io.ReadCloser, *FileInfo, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, nil, err
+	}
+	return GetFile(repository, name)
+}
+
+// DeleteFile deletes the file on the active backend.
+func (r *failoverRepository) DeleteFile(name string) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	return DeleteFile(repository, name)
+}
+
+// gridFS returns the GridFS of the collection ("<collection>.files" and "<collection>.chunks") and
+// a session to be closed after.
+func (s *MongoSession) gridFS() (*mgo.Session, *mgo.GridFS) {
+	session, c := s.getWriteCollection()
+	return session, c.Database.GridFS(s.collectionName)
+}
+
+// SaveFile stores the file in GridFS.
+func (s *MongoSession) SaveFile(name, contentType string, content io.Reader) (*FileInfo, error) {
+	writer, err := s.createFile(name, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer.file, content); err != nil {
+		writer.file.Abort()
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return gridFileInfo(writer.file), nil
+}
+
+// CreateFile creates the file in GridFS.
+func (s *MongoSession) CreateFile(name, contentType string) (io.WriteCloser, error) {
+	return s.createFile(name, contentType)
+}
+
+func (s *MongoSession) createFile(name, contentType string) (*gridFileWriter, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, gfs := s.gridFS()
+	file, err := gfs.Create(name)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	file.SetContentType(contentType)
+	return &gridFileWriter{file: file, gfs: gfs, session: session}, nil
+}
+
+// GetFile opens the latest GridFS file with the name.
+func (s *MongoSession) GetFile(name string) (io.ReadCloser, *FileInfo, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+
+	if err := s.checkConnected(); err != nil {
+		return nil, nil, err
+	}
+
+	session, gfs := s.gridFS()
+	file, err := gfs.Open(name)
+	if err != nil {
+		session.Close()
+		if err == mgo.ErrNotFound {
+			return nil, nil, ErrNotFound(fmt.Sprintf("file %s not found", name))
+		}
+		return nil, nil, err
+	}
+	return &gridFileReader{file: file, session: session}, gridFileInfo(file), nil
+}
+
+// DeleteFile deletes the GridFS files with the name.
+func (s *MongoSession) DeleteFile(name string) error {
+	done, err := s.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return err
+	}
+	if err := s.checkConnected(); err != nil {
+		return err
+	}
+
+	session, gfs := s.gridFS()
+	defer session.Close()
+
+	count, err := gfs.Find(bson.M{"filename": name}).Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound(fmt.Sprintf("file %s not found", name))
+	}
+	return gfs.Remove(name)
+}
+
+func gridFileInfo(file *mgo.GridFile) *FileInfo {
+	return &FileInfo{
+		Name:        file.Name(),
+		ContentType: file.ContentType(),
+		Size:        file.Size(),
+		UploadedAt:  file.UploadDate(),
+	}
+}
+
+// gridFileWriter writes a GridFS file. When the file is stored, the older files with the same name are removed.
+type gridFileWriter struct {
+	file    *mgo.GridFile
+	gfs     *mgo.GridFS
+	session *mgo.Session
+}
+
+func (w *gridFileWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *gridFileWriter) Close() error {
+	defer w.session.Close()
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	var older []struct {
+		ID interface{} `bson:"_id"`
+	}
+	query := bson.M{"filename": w.file.Name(), "_id": bson.M{"$ne": w.file.Id()}}
+	if err := w.gfs.Find(query).Select(bson.M{"_id": 1}).All(&older); err != nil {
+		return err
+	}
+	for _, file := range older {
+		if err := w.gfs.RemoveId(file.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gridFileReader reads a GridFS file and closes its session when closed.
+type gridFileReader struct {
+	file    *mgo.GridFile
+	session *mgo.Session
+}
+
+func (r *gridFileReader) Read(p []byte) (int, error) {
+	return r.file.Read(p)
+}
+
+func (r *gridFileReader) Close() error {
+	defer r.session.Close()
+	return r.file.Close()
+}
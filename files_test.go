@@ -0,0 +1,141 @@
+package backends
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// memoryS3 is a minimal S3 API keeping the objects in memory.
+type memoryS3 struct {
+	mutex   sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (m *memoryS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	body, found := m.objects[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		content, _ := ioutil.ReadAll(r.Body)
+		m.objects[r.URL.Path] = string(content)
+		m.types[r.URL.Path] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", m.types[r.URL.Path])
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method == http.MethodGet {
+			io.WriteString(w, body)
+		}
+	case http.MethodDelete:
+		delete(m.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newS3Collection returns a DynamoCollection using the S3 API of the server.
+func newS3Collection(t *testing.T, server *httptest.Server, options BackendOptions) *DynamoCollection {
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DynamoCollection{
+		RepositoryDefinition: RepositoryDefinitionMap{"name": "users"},
+		session:              sess,
+		options:              options,
+	}
+}
+
+func TestFilesNotSupported(t *testing.T) {
+	repo := &memoryRepo{}
+	if _, err := SaveFile(repo, "avatar", "image/png", strings.NewReader("png")); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+	if err := DeleteFile(&DynamoCollection{}, ""); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an empty file name. Got: ", err)
+	}
+}
+
+func TestS3Files(t *testing.T) {
+	storage := &memoryS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+	repo := newS3Collection(t, server, BackendOptions{"filesBucket": "attachments"})
+
+	info, err := SaveFile(repo, "avatar", "image/png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 3 || info.ContentType != "image/png" {
+		t.Fatal("Unexpected file info: ", info)
+	}
+	if storage.objects["/attachments/users/avatar"] != "png" {
+		t.Fatal("Expected the file under the table prefix. Got: ", storage.objects)
+	}
+
+	writer, err := CreateFile(repo, "document", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(writer, "hello ")
+	io.WriteString(writer, "world")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, info, err := GetFile(repo, "document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello world" || info.ContentType != "text/plain" {
+		t.Fatal("Unexpected file: ", string(content), info)
+	}
+
+	if err := DeleteFile(repo, "document"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GetFile(repo, "document"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+	if err := DeleteFile(repo, "document"); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+}
+
+func TestS3FilesBucketRequired(t *testing.T) {
+	server := httptest.NewServer(&memoryS3{})
+	defer server.Close()
+	repo := newS3Collection(t, server, BackendOptions{})
+	if _, err := CreateFile(repo, "avatar", "image/png"); err == nil || !strings.Contains(err.Error(), "filesBucket") {
+		t.Fatal("Expected an error for the missing bucket. Got: ", err)
+	}
+}
@@ -0,0 +1,291 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fixtureRefPrefix starts the values that reference another fixture record.
+const fixtureRefPrefix = "$ref:"
+
+// CollectionFixtures are the fixture records of a collection.
+type CollectionFixtures struct {
+	// Key are the properties identifying a record (defaults to "id"). The fixture records are matched
+	// by the key, so applying the fixtures again updates the records instead of creating duplicates.
+	Key []string
+	// Records maps the name of the fixture record (used in the references) to the record.
+	Records map[string]map[string]interface{}
+}
+
+// Fixtures maps the collection (repository) name to its fixtures.
+type Fixtures map[string]*CollectionFixtures
+
+// ParseFixtures parses the fixtures of a collection from JSON or YAML:
+//
+//	key: [email]
+//	records:
+//	  admin:
+//	    email: admin@example.com
+//	    role: admin
+//
+// The records can also be given as a list, named by their position ("0", "1"...). A string value
+// "$ref:<collection>.<record>" is replaced with the id of the named record of the collection, and
+// "$ref:<collection>.<record>.<property>" with the property of the record.
+func ParseFixtures(data []byte) (*CollectionFixtures, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	conf, ok := normalizeYAML(raw).(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidInput("the fixtures must be an object")
+	}
+
+	fixtures := &CollectionFixtures{
+		Records: map[string]map[string]interface{}{},
+	}
+	switch key := conf["key"].(type) {
+	case string:
+		fixtures.Key = []string{key}
+	case []interface{}:
+		for _, k := range key {
+			if ks, ok := k.(string); ok {
+				fixtures.Key = append(fixtures.Key, ks)
+			}
+		}
+	}
+
+	switch records := conf["records"].(type) {
+	case map[string]interface{}:
+		for name, record := range records {
+			recordMap, ok := record.(map[string]interface{})
+			if !ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("records.%s: expected object", name))
+			}
+			fixtures.Records[name] = recordMap
+		}
+	case []interface{}:
+		for i, record := range records {
+			recordMap, ok := record.(map[string]interface{})
+			if !ok {
+				return nil, ErrInvalidInput(fmt.Sprintf("records.%d: expected object", i))
+			}
+			fixtures.Records[strconv.Itoa(i)] = recordMap
+		}
+	case nil:
+	default:
+		return nil, ErrInvalidInput("records: expected object or list")
+	}
+	return fixtures, nil
+}
+
+// LoadFixtures reads the fixture files (*.json, *.yaml and *.yml) from the directory. Every file holds
+// the fixtures of the collection named by the file name, for example users.yaml for "users".
+// See ParseFixtures.
+func LoadFixtures(dir string) (Fixtures, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := Fixtures{}
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		collection := strings.TrimSuffix(file.Name(), ext)
+		if _, ok := fixtures[collection]; ok {
+			return nil, ErrInvalidInput(fmt.Sprintf("multiple fixture files for %s", collection))
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if fixtures[collection], err = ParseFixtures(data); err != nil {
+			return nil, err
+		}
+	}
+	return fixtures, nil
+}
+
+// Apply upserts the fixture records into the repositories, for example the repositories returned by
+// RepositoriesConfig.Define at startup. The records are matched by the key of their collection: the
+// existing records are updated and the missing ones are created. The referenced records are saved first;
+// circular references are rejected.
+//
+// On the repositories where the backend generates the ids (MongoDB without custom IDs), the records can not
+// be matched by the id, so the fixtures must declare a key.
+func (f Fixtures) Apply(repositories map[string]Repository) error {
+	loader := &fixtureLoader{
+		fixtures:     f,
+		repositories: repositories,
+		saved:        map[string]map[string]interface{}{},
+		loading:      map[string]bool{},
+	}
+	for _, collection := range f.collections() {
+		for _, name := range sortedKeys(f[collection].records()) {
+			if _, err := loader.load(collection, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f Fixtures) collections() []string {
+	names := map[string]interface{}{}
+	for name := range f {
+		names[name] = nil
+	}
+	return sortedKeys(names)
+}
+
+func (c *CollectionFixtures) records() map[string]interface{} {
+	records := map[string]interface{}{}
+	for name, record := range c.Records {
+		records[name] = record
+	}
+	return records
+}
+
+// fixtureLoader saves the fixture records, resolving the references.
+type fixtureLoader struct {
+	fixtures     Fixtures
+	repositories map[string]Repository
+	// saved holds the saved records by "<collection>.<name>"
+	saved map[string]map[string]interface{}
+	// loading holds the records being saved, to detect circular references
+	loading map[string]bool
+}
+
+// load saves the named record of the collection (once) and returns the saved record.
+func (l *fixtureLoader) load(collection, name string) (map[string]interface{}, error) {
+	ref := collection + "." + name
+	if saved, ok := l.saved[ref]; ok {
+		return saved, nil
+	}
+	if l.loading[ref] {
+		return nil, ErrInvalidInput(fmt.Sprintf("circular fixture reference to %s", ref))
+	}
+	l.loading[ref] = true
+	defer delete(l.loading, ref)
+
+	fixtures, ok := l.fixtures[collection]
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("no fixtures for %s", collection))
+	}
+	record, ok := fixtures.Records[name]
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("no fixture record %s", ref))
+	}
+	repo, ok := l.repositories[collection]
+	if !ok {
+		return nil, ErrInvalidInput(fmt.Sprintf("no repository %s for the fixtures", collection))
+	}
+
+	resolved, err := l.resolve(record)
+	if err != nil {
+		return nil, err
+	}
+	payload := resolved.(map[string]interface{})
+
+	saved, err := upsertFixture(repo, fixtures.Key, payload)
+	if err != nil {
+		return nil, err
+	}
+	l.saved[ref] = saved
+	return saved, nil
+}
+
+// resolve returns a copy of the value with the references replaced by the referenced values.
+func (l *fixtureLoader) resolve(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, fixtureRefPrefix) {
+			return v, nil
+		}
+		parts := strings.SplitN(strings.TrimPrefix(v, fixtureRefPrefix), ".", 3)
+		if len(parts) < 2 {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid fixture reference %s", v))
+		}
+		property := "id"
+		if len(parts) == 3 {
+			property = parts[2]
+		}
+		saved, err := l.load(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		referenced, ok := saved[property]
+		if !ok {
+			return nil, ErrInvalidInput(fmt.Sprintf("the fixture record %s.%s has no %s", parts[0], parts[1], property))
+		}
+		return referenced, nil
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			resolved, err := l.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := l.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// upsertFixture updates the record with the key values of the payload, or creates it, and returns the
+// saved record.
+func upsertFixture(repo Repository, key []string, payload map[string]interface{}) (map[string]interface{}, error) {
+	if len(key) == 0 {
+		key = []string{"id"}
+	}
+	generated := generatesIDs(repo)
+	if generated {
+		for _, k := range key {
+			if k == "id" {
+				return nil, ErrInvalidInput("the ids are generated by the backend, the fixtures need a key")
+			}
+		}
+		delete(payload, "id")
+	}
+
+	filter, err := bootstrapFilter(key, payload)
+	if err != nil {
+		return nil, err
+	}
+	var saved interface{}
+	if _, err = repo.GetOne(copyFilter(filter), &map[string]interface{}{}); err == nil {
+		saved, err = repo.Save(&payload, filter)
+	} else if IsErrNotFound(err) {
+		saved, err = repo.Save(&payload, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toAuditMap(saved)
+}
+
+// generatesIDs returns true if the ids of the new records are generated by the backend and can not be set.
+func generatesIDs(repo Repository) bool {
+	if s, ok := repo.(*MongoSession); ok {
+		return !s.repoDef.IsCustomID() && s.mongoIDType() == IDTypeObjectID
+	}
+	return false
+}
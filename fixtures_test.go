@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixturesApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"users.yaml": `
+key: [email]
+records:
+  admin:
+    id: user-1
+    email: admin@example.com
+    team: $ref:teams.core
+`,
+		"teams.json": `{"records": {"core": {"id": "team-1", "name": "core"}}}`,
+		"README.md":  "not a fixture",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 2 {
+		t.Fatal("Expected the fixtures of 2 collections. Got: ", fixtures)
+	}
+
+	users, teams := &memoryRepo{}, &memoryRepo{}
+	repositories := map[string]Repository{"users": users, "teams": teams}
+	for i := 0; i < 2; i++ {
+		if err := fixtures.Apply(repositories); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(users.records) != 1 || len(teams.records) != 1 {
+		t.Fatal("Expected the fixtures to be applied once. Got: ", users.records, teams.records)
+	}
+	if users.records[0]["team"] != "team-1" {
+		t.Fatal("Expected the reference to be resolved to the id. Got: ", users.records[0])
+	}
+}
+
+func TestParseFixturesList(t *testing.T) {
+	fixtures, err := ParseFixtures([]byte("key: name\nrecords:\n  - name: core\n  - name: web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures.Key) != 1 || fixtures.Key[0] != "name" {
+		t.Fatal("Unexpected key: ", fixtures.Key)
+	}
+	if fixtures.Records["1"]["name"] != "web" {
+		t.Fatal("Expected the list records to be named by their position. Got: ", fixtures.Records)
+	}
+}
+
+func TestFixturesCircularReference(t *testing.T) {
+	fixtures := Fixtures{
+		"users": {Records: map[string]map[string]interface{}{
+			"a": {"id": "a", "manager": "$ref:users.b"},
+			"b": {"id": "b", "manager": "$ref:users.a.id"},
+		}},
+	}
+	err := fixtures.Apply(map[string]Repository{"users": &memoryRepo{}})
+	if !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for the circular reference. Got: ", err)
+	}
+}
+
+func TestFixturesGeneratedIDs(t *testing.T) {
+	fixtures := Fixtures{
+		"users": {Records: map[string]map[string]interface{}{"admin": {"email": "admin@example.com"}}},
+	}
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{}}
+	if err := fixtures.Apply(map[string]Repository{"users": repo}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a key. Got: ", err)
+	}
+}
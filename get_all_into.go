@@ -0,0 +1,101 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// QueryOptions are the sorting and paging options of GetAllInto.
+type QueryOptions struct {
+	// Order is the property the records are sorted by.
+	Order string
+	// Sorting is the direction of the sort: "asc" (the default) or "desc".
+	Sorting string
+	// Limit is the maximal number of records. All matched records are returned if it is 0.
+	Limit int
+	// Offset is the number of matched records that are skipped.
+	Offset int
+}
+
+// GetAllInto reads the records that match the filter into the slice that dest points to, so the caller
+// gets the typed records without a type hint and a type assertion of the result of GetAll:
+//
+//	users := []*User{}
+//	err := backends.GetAllInto(repo, filter, &users, backends.QueryOptions{Order: "name", Limit: 10})
+//
+// The elements of the slice can be structs, pointers to structs or maps with string keys. The slice
+// is replaced by the records; it is empty if no record matches. Returns ErrInvalidInput if dest is not
+// a pointer to such a slice.
+func GetAllInto(repo Repository, filter Filter, dest interface{}, options QueryOptions) error {
+	slice, err := destinationSlice(dest)
+	if err != nil {
+		return err
+	}
+	elemType := slice.Type().Elem()
+	recordType := elemType
+	if recordType.Kind() == reflect.Ptr {
+		recordType = recordType.Elem()
+	}
+
+	results, err := repo.GetAll(filter, reflect.New(recordType).Interface(), options.Order, options.Sorting, options.Limit, options.Offset)
+	if err != nil {
+		return err
+	}
+
+	records := reflect.MakeSlice(slice.Type(), 0, 0)
+	err = IterateOverSlice(results, func(i int, item interface{}) error {
+		record, err := recordValue(item, elemType)
+		if err != nil {
+			return fmt.Errorf("record %d: %s", i, err)
+		}
+		records = reflect.Append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slice.Set(records)
+	return nil
+}
+
+// destinationSlice returns the slice dest points to, or ErrInvalidInput if it is not a pointer to a slice
+// of structs, struct pointers or maps.
+func destinationSlice(dest interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}, ErrInvalidInput(fmt.Sprintf("the destination must be a non-nil pointer to a slice, got %T", dest))
+	}
+	slice := v.Elem()
+	if slice.Kind() != reflect.Slice {
+		return reflect.Value{}, ErrInvalidInput(fmt.Sprintf("the destination must be a pointer to a slice, got %T", dest))
+	}
+	elemType := slice.Type().Elem()
+	recordType := elemType
+	if recordType.Kind() == reflect.Ptr {
+		recordType = recordType.Elem()
+	}
+	switch {
+	case recordType.Kind() == reflect.Struct:
+	case recordType.Kind() == reflect.Map && recordType.Key().Kind() == reflect.String && elemType.Kind() != reflect.Ptr:
+	default:
+		return reflect.Value{}, ErrInvalidInput(fmt.Sprintf("the elements of %T must be structs, struct pointers or maps, got %s", dest, elemType))
+	}
+	return slice, nil
+}
+
+// recordValue returns the record as a value of the type: the record itself if it is of the type,
+// otherwise the record decoded into a new value.
+func recordValue(item interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(item)
+	if v.IsValid() && v.Type() == t {
+		return v, nil
+	}
+	if v.IsValid() && v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type() == t {
+		return v.Elem(), nil
+	}
+	record := reflect.New(t)
+	if err := MapToInterface(item, record.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return record.Elem(), nil
+}
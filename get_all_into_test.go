@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"testing"
+)
+
+type getAllUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// typedMemoryRepo returns the records as GetAll of the databases does: a pointer to a slice of pointers
+// of the type hint.
+type typedMemoryRepo struct {
+	*memoryRepo
+}
+
+func (r *typedMemoryRepo) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, _ := r.memoryRepo.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	results := []*getAllUser{}
+	for _, record := range *records.(*[]map[string]interface{}) {
+		user := &getAllUser{}
+		if err := MapToInterface(record, user); err != nil {
+			return nil, err
+		}
+		results = append(results, user)
+	}
+	return &results, nil
+}
+
+func TestGetAllInto(t *testing.T) {
+	memory := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "name": "Ann", "age": 30, "team": "a"},
+		{"id": "2", "name": "Bob", "age": 40, "team": "a"},
+		{"id": "3", "name": "Eve", "age": 50, "team": "b"},
+	}}
+
+	for _, repo := range []Repository{memory, &typedMemoryRepo{memory}} {
+		users := []*getAllUser{{ID: "stale"}}
+		if err := GetAllInto(repo, Filter{"team": "a"}, &users, QueryOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 || users[0].Name != "Ann" || users[1].Age != 40 {
+			t.Fatalf("Expected the users of the team. Got: %+v", users)
+		}
+
+		values := []getAllUser{}
+		if err := GetAllInto(repo, nil, &values, QueryOptions{Limit: 1, Offset: 2}); err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 1 || values[0].ID != "3" {
+			t.Fatalf("Expected the page of the users. Got: %+v", values)
+		}
+	}
+
+	records := []map[string]interface{}{}
+	if err := GetAllInto(memory, Filter{"team": "b"}, &records, QueryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0]["name"] != "Eve" {
+		t.Fatal("Expected the records as maps. Got: ", records)
+	}
+
+	none := []getAllUser{}
+	if err := GetAllInto(memory, Filter{"team": "c"}, &none, QueryOptions{}); err != nil || none == nil || len(none) != 0 {
+		t.Fatal("Expected an empty slice. Got: ", none, err)
+	}
+}
+
+func TestGetAllIntoInvalidDestination(t *testing.T) {
+	repo := &memoryRepo{}
+	var nilSlice *[]getAllUser
+	for _, dest := range []interface{}{nil, []getAllUser{}, nilSlice, &getAllUser{}, &[]string{}, &[]*map[string]interface{}{}} {
+		err := GetAllInto(repo, nil, dest, QueryOptions{})
+		if err == nil || !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %T. Got: %v", dest, err)
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package backends
 
 import (
-	"encoding/json"
+	"errors"
 	"reflect"
-	"strings"
+	"time"
 
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
-// InterfaceToMap converts interface type (struct or map pointer) to *map[string]interface{}
+// InterfaceToMap converts interface type (struct or map pointer) to *map[string]interface{}.
+// Nested structs are converted to maps, and the fields of embedded and inline structs are promoted,
+// by the bson or json tags of the fields (see documentFields).
 func InterfaceToMap(object interface{}) (*map[string]interface{}, error) {
+	return interfaceToMap(object, FieldNamingLowercase)
+}
+
+// interfaceToMap is InterfaceToMap with the naming strategy of the fields without a bson or json name.
+func interfaceToMap(object interface{}, naming string) (*map[string]interface{}, error) {
+	if record, ok := object.(*map[string]interface{}); ok && record != nil {
+		// the payload is already a record
+		return record, nil
+	}
 	if reflect.ValueOf(object).Kind() != reflect.Ptr {
 		return nil, ErrInvalidInput("object should be of pointer type")
 	}
@@ -23,23 +34,7 @@ func InterfaceToMap(object interface{}) (*map[string]interface{}, error) {
 	switch rKind {
 
 	case reflect.Struct:
-		typeOfObject := rValue.Type()
-
-		for i := 0; i < rValue.NumField(); i++ {
-			f := rValue.Field(i)
-			tag := typeOfObject.Field(i).Tag
-			key := strings.ToLower(typeOfObject.Field(i).Name)
-			if bsonName, ok := tag.Lookup("bson"); ok {
-				key = bsonName
-			} else if jsonName, ok := tag.Lookup("json"); ok {
-				key = jsonName
-			}
-			if strings.Contains(key, ",") {
-				key = key[0:strings.Index(key, ",")]
-			}
-			value := f.Interface()
-			(*result)[key] = value
-		}
+		*result = structDocument(rValue, naming)
 	case reflect.Map:
 
 		if _, ok := object.(*map[string]interface{}); ok {
@@ -55,17 +50,17 @@ func InterfaceToMap(object interface{}) (*map[string]interface{}, error) {
 	return result, nil
 }
 
-// MapToInterface decodes object to result
+// MapToInterface decodes object to result. The result is decoded as json.Unmarshal would decode
+// the JSON encoding of the object, without marshalling to JSON (see codec.go), except that typed
+// fields keep the exact values: integers are not converted through float64, and time.Time fields
+// are decoded from time.Time values, RFC3339 strings or epoch seconds.
 func MapToInterface(object interface{}, result interface{}) error {
-
-	jsonStruct, err := json.Marshal(object)
-	if err != nil {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		_, err := genericValue(reflect.ValueOf(object))
 		return err
 	}
-
-	json.Unmarshal(jsonStruct, result)
-
-	return nil
+	return decodeValue(object, rv.Elem())
 }
 
 // IterateOverSlice iterates over a slice viewed as generic itnerface{}. A callback function is called for
@@ -111,33 +106,42 @@ func stringToObjectID(object map[string]interface{}) error {
 	return nil
 }
 
-// sliceToObjectID converts _id key from slice of strings to slice of bson.ObjectId
-func sliceToObjectID(object map[string]interface{}) error {
-	if id, ok := object["id"]; ok {
-		delete(object, "id")
-		ids := strings.Split(id.(string), ",")
-		bsonIds := []bson.ObjectId{}
-		for _, id := range ids {
-			if !bson.IsObjectIdHex(id) {
-				return ErrInvalidInput("id is a invalid hex representation of an ObjectId")
-			}
-
-			if reflect.TypeOf(id).String() != "bson.ObjectId" {
-				bsonIds = append(bsonIds, bson.ObjectIdHex(id))
-			}
-		}
-		object["_id"] = bsonIds
+// applyTimestamps sets the UpdatedAtField of the payload and, for new records, the CreatedAtField.
+// On update the CreatedAtField is never overwritten.
+func applyTimestamps(payload map[string]interface{}, repoDef RepositoryDefinition, create bool) {
+	if !repoDef.UseTimestamps() {
+		return
 	}
-
-	return nil
+	now := time.Now().UTC()
+	if create {
+		payload[CreatedAtField] = now
+	} else {
+		delete(payload, CreatedAtField)
+	}
+	payload[UpdatedAtField] = now
 }
 
 // IsConditionalCheckErr check if err is dynamoDB condition error
 func IsConditionalCheckErr(err error) bool {
-	if ae, ok := err.(awserr.RequestFailure); ok {
-		return ae.Code() == "ConditionalCheckFailedException"
+	return awsErrorCode(err) == "ConditionalCheckFailedException"
+}
+
+// awsErrorCode returns the error code of an AWS API error (awserr.Error), or an empty string for other errors.
+func awsErrorCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
 	}
-	return false
+	return ""
+}
+
+// awsErrorMessage returns the message of an AWS API error, or the error text for other errors.
+func awsErrorMessage(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Message()
+	}
+	return err.Error()
 }
 
 // contains checks if item is in s array
@@ -2,7 +2,11 @@ package backends
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
 func TestInterfaceToMap(t *testing.T) {
@@ -59,6 +63,19 @@ func TestIsConditionalCheckErr(t *testing.T) {
 	}
 }
 
+func TestAWSErrorCode(t *testing.T) {
+	err := fmt.Errorf("put item: %w", awserr.New("ConditionalCheckFailedException", "The conditional request failed", nil))
+	if !IsConditionalCheckErr(err) {
+		t.Errorf("Expected a conditional check error: %v", err)
+	}
+	if message := awsErrorMessage(err); message != "The conditional request failed" {
+		t.Errorf("Unexpected message: %s", message)
+	}
+	if code := awsErrorCode(fmt.Errorf("Some error")); code != "" {
+		t.Errorf("Expected no code. Got: %s", code)
+	}
+}
+
 func TestContains(t *testing.T) {
 	val := "value"
 	arr := []*string{&val}
@@ -69,3 +86,141 @@ func TestContains(t *testing.T) {
 		t.Errorf("Expected array to contain the item 'value'")
 	}
 }
+
+func TestApplyTimestamps(t *testing.T) {
+	def := RepositoryDefinitionMap{"timestamps": true}
+
+	payload := map[string]interface{}{"name": "a"}
+	applyTimestamps(payload, def, true)
+	if _, ok := payload[CreatedAtField]; !ok {
+		t.Error("Expected createdAt to be set on create")
+	}
+	if _, ok := payload[UpdatedAtField]; !ok {
+		t.Error("Expected updatedAt to be set on create")
+	}
+
+	payload = map[string]interface{}{"name": "a", CreatedAtField: "overwritten"}
+	applyTimestamps(payload, def, false)
+	if _, ok := payload[CreatedAtField]; ok {
+		t.Error("Expected createdAt not to be updated")
+	}
+	if _, ok := payload[UpdatedAtField]; !ok {
+		t.Error("Expected updatedAt to be set on update")
+	}
+
+	payload = map[string]interface{}{"name": "a"}
+	applyTimestamps(payload, RepositoryDefinitionMap{}, true)
+	if len(payload) != 1 {
+		t.Errorf("Expected no timestamps, got %v", payload)
+	}
+}
+
+type testProfile struct {
+	Bio     string    `bson:"bio,omitempty"`
+	Website string    `json:"website,omitempty"`
+	Joined  time.Time `bson:"joined"`
+}
+
+type testAddress struct {
+	City string `bson:"city"`
+	Zip  string `bson:"zip,omitempty"`
+}
+
+type testAudit struct {
+	CreatedBy string `bson:"createdBy"`
+}
+
+type testUser struct {
+	testAudit
+	Meta      testMeta               `bson:",inline"`
+	Name      string                 `bson:"name"`
+	Profile   testProfile            `bson:"profile,omitempty"`
+	Address   *testAddress           `bson:"address"`
+	Addresses []testAddress          `bson:"addresses"`
+	Contacts  map[string]testAddress `bson:"contacts"`
+	Extra     map[string]interface{} `bson:",inline"`
+	Secret    string                 `bson:"-"`
+}
+
+type testMeta struct {
+	Version int `bson:"version"`
+}
+
+func TestInterfaceToMapNestedStructs(t *testing.T) {
+	joined := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	user := &testUser{
+		testAudit: testAudit{CreatedBy: "admin"},
+		Meta:      testMeta{Version: 2},
+		Name:      "John",
+		Profile:   testProfile{Bio: "dev", Joined: joined},
+		Address:   &testAddress{City: "Skopje"},
+		Addresses: []testAddress{{City: "Ohrid", Zip: "6000"}},
+		Contacts:  map[string]testAddress{"home": {City: "Bitola"}},
+		Extra:     map[string]interface{}{"source": "import"},
+		Secret:    "secret",
+	}
+
+	result, err := InterfaceToMap(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"createdBy": "admin",
+		"version":   2,
+		"name":      "John",
+		"profile":   map[string]interface{}{"bio": "dev", "joined": joined},
+		"address":   map[string]interface{}{"city": "Skopje"},
+		"addresses": []interface{}{map[string]interface{}{"city": "Ohrid", "zip": "6000"}},
+		"contacts":  map[string]interface{}{"home": map[string]interface{}{"city": "Bitola"}},
+		"source":    "import",
+	}
+	if !reflect.DeepEqual(*result, expected) {
+		t.Fatalf("Expected %v, got %v", expected, *result)
+	}
+
+	result, err = InterfaceToMap(&testUser{Name: "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*result)["profile"]; ok {
+		t.Fatal("Expected the empty profile to be omitted")
+	}
+	if address, ok := (*result)["address"]; !ok || !reflect.ValueOf(address).IsNil() {
+		t.Fatal("Expected a nil address, got ", address)
+	}
+}
+
+func TestMapToInterfaceNestedStructs(t *testing.T) {
+	joined := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	user := &testUser{
+		testAudit: testAudit{CreatedBy: "admin"},
+		Meta:      testMeta{Version: 2},
+		Name:      "John",
+		Profile:   testProfile{Bio: "dev", Joined: joined},
+		Addresses: []testAddress{{City: "Ohrid", Zip: "6000"}},
+		Extra:     map[string]interface{}{"source": "import"},
+	}
+	record, err := InterfaceToMap(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &testUser{}
+	if err := MapToInterface(record, result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, user) {
+		t.Fatalf("Expected the record to be read back into %+v, got %+v", user, result)
+	}
+
+	// the stored names take precedence over the matches of the JSON names
+	entry := &struct {
+		UserName string `bson:"user_name" json:"userName"`
+		Internal string `bson:"-" json:"internal"`
+	}{}
+	if err := MapToInterface(map[string]interface{}{"user_name": "ann", "internal": "x"}, entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.UserName != "ann" || entry.Internal != "" {
+		t.Fatalf("Expected the bson names to be honored, got %+v", entry)
+	}
+}
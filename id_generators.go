@@ -0,0 +1,214 @@
+package backends
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// IDGenerator generates the id of a new record.
+type IDGenerator func() (string, error)
+
+// ID generators of the repositories ("idGenerator" property).
+const (
+	// IDUUIDv4 generates random UUIDs. It is the default on DynamoDB.
+	IDUUIDv4 = "uuidv4"
+	// IDUUIDv7 generates time-ordered UUIDs (a millisecond timestamp followed by random bits).
+	IDUUIDv7 = "uuidv7"
+	// IDULID generates ULIDs: 26 characters, sortable by the creation time.
+	IDULID = "ulid"
+	// IDSnowflake generates 64-bit time-ordered numbers (timestamp, node and sequence).
+	IDSnowflake = "snowflake"
+	// IDSequence generates consecutive numbers (1, 2, 3...) from a counter kept in the database.
+	IDSequence = "sequence"
+)
+
+var idGenerators = struct {
+	sync.RWMutex
+	byName map[string]IDGenerator
+}{
+	byName: map[string]IDGenerator{
+		IDUUIDv4:    newUUIDv4,
+		IDUUIDv7:    newUUIDv7,
+		IDULID:      newULID,
+		IDSnowflake: NewSnowflakeGenerator(randomSnowflakeNode()),
+	},
+}
+
+// RegisterIDGenerator registers a named ID generator that can be set as the "idGenerator" of a repository.
+// Registering a generator with an existing name replaces it; for example, to generate the snowflake IDs
+// with the node number of the instance:
+//
+//	backends.RegisterIDGenerator(backends.IDSnowflake, backends.NewSnowflakeGenerator(nodeID))
+//
+// The "sequence" generator is provided by the backend and can not be replaced.
+func RegisterIDGenerator(name string, generator IDGenerator) {
+	idGenerators.Lock()
+	defer idGenerators.Unlock()
+	idGenerators.byName[name] = generator
+}
+
+func getIDGenerator(name string) (IDGenerator, bool) {
+	idGenerators.RLock()
+	defer idGenerators.RUnlock()
+	generator, ok := idGenerators.byName[name]
+	return generator, ok
+}
+
+// GetIDGenerator returns the name of the ID generator for the new records ("idGenerator" property), or an
+// empty string for the default IDs: ObjectIDs on MongoDB and UUIDs on DynamoDB.
+func (m RepositoryDefinitionMap) GetIDGenerator() string {
+	if generator, ok := m["idGenerator"]; ok {
+		return generator.(string)
+	}
+	return ""
+}
+
+// validIDGenerator returns an error if there is no ID generator with the name.
+func validIDGenerator(name string) error {
+	if name == "" || name == IDSequence {
+		return nil
+	}
+	if _, ok := getIDGenerator(name); !ok {
+		return ErrInvalidInput(fmt.Sprintf("unknown ID generator %s", name))
+	}
+	return nil
+}
+
+// generateID sets a generated id on the new record, unless the record has an id. The generator is the name
+// of the ID generator (or the default generator, if empty), and sequence is the sequence of the backend.
+// Nothing is generated if both the name and the default generator are empty.
+func generateID(record map[string]interface{}, name, defaultGenerator string, sequence IDGenerator) error {
+	if _, ok := record["id"]; ok {
+		return nil
+	}
+	if name == "" {
+		name = defaultGenerator
+	}
+	if name == "" {
+		return nil
+	}
+
+	generator := sequence
+	if name != IDSequence {
+		var ok bool
+		if generator, ok = getIDGenerator(name); !ok {
+			return ErrInvalidInput(fmt.Sprintf("unknown ID generator %s", name))
+		}
+	}
+	id, err := generator()
+	if err != nil {
+		return err
+	}
+	record["id"] = id
+	return nil
+}
+
+func newUUIDv4() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// newUUIDv7 generates a UUID version 7: 48 bits of the Unix time in milliseconds, the version,
+// 12 random bits, the variant and 62 random bits.
+func newUUIDv7() (string, error) {
+	var id uuid.UUID
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	putMillis(id[:6], time.Now())
+	id.SetVersion(7)
+	id.SetVariant(uuid.VariantRFC4122)
+	return id.String(), nil
+}
+
+// crockfordBase32 is the alphabet of the ULIDs.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID generates a ULID: 48 bits of the Unix time in milliseconds and 80 random bits,
+// encoded with Crockford's base32.
+func newULID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	putMillis(id[:6], time.Now())
+	return encodeULID(id), nil
+}
+
+// encodeULID encodes the 128 bits in 26 base32 characters, the first one holding the top 3 bits.
+func encodeULID(id [16]byte) string {
+	value := new(big.Int).SetBytes(id[:])
+	mask := big.NewInt(31)
+	encoded := make([]byte, 26)
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = crockfordBase32[new(big.Int).And(value, mask).Int64()]
+		value.Rsh(value, 5)
+	}
+	return string(encoded)
+}
+
+// putMillis writes the Unix time in milliseconds as a 48-bit big-endian number.
+func putMillis(dst []byte, t time.Time) {
+	var millis [8]byte
+	binary.BigEndian.PutUint64(millis[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+	copy(dst, millis[2:])
+}
+
+// snowflakeEpoch is the start of the snowflake timestamps (2019-01-01 UTC).
+var snowflakeEpoch = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Bits of the snowflake IDs: 41 bits of milliseconds since the epoch, 10 bits of the node, 12 bits of the sequence.
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+)
+
+// NewSnowflakeGenerator returns a snowflake ID generator for the node (0-1023). The IDs generated by the
+// nodes with different numbers never collide; the built-in "snowflake" generator uses a random node number.
+func NewSnowflakeGenerator(node int64) IDGenerator {
+	node &= 1<<snowflakeNodeBits - 1
+	mutex := &sync.Mutex{}
+	var last, sequence int64
+	return func() (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := time.Since(snowflakeEpoch).Nanoseconds() / int64(time.Millisecond)
+		if now < last {
+			// the clock moved backwards
+			now = last
+		}
+		if now == last {
+			sequence = (sequence + 1) & (1<<snowflakeSequenceBits - 1)
+			if sequence == 0 {
+				// the sequence of this millisecond is exhausted
+				for now <= last {
+					time.Sleep(100 * time.Microsecond)
+					now = time.Since(snowflakeEpoch).Nanoseconds() / int64(time.Millisecond)
+				}
+			}
+		} else {
+			sequence = 0
+		}
+		last = now
+
+		id := now<<(snowflakeNodeBits+snowflakeSequenceBits) | node<<snowflakeSequenceBits | sequence
+		return strconv.FormatInt(id, 10), nil
+	}
+}
+
+func randomSnowflakeNode() int64 {
+	var node [2]byte
+	rand.Read(node[:])
+	return int64(binary.BigEndian.Uint16(node[:]))
+}
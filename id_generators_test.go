@@ -0,0 +1,126 @@
+package backends
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIDGenerators(t *testing.T) {
+	formats := map[string]*regexp.Regexp{
+		IDUUIDv4:    regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		IDUUIDv7:    regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		IDULID:      regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		IDSnowflake: regexp.MustCompile(`^[0-9]+$`),
+	}
+	for name, format := range formats {
+		generator, ok := getIDGenerator(name)
+		if !ok {
+			t.Fatal("Missing ID generator ", name)
+		}
+		previous := ""
+		for i := 0; i < 100; i++ {
+			id, err := generator()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !format.MatchString(id) {
+				t.Fatalf("Invalid %s id: %s", name, id)
+			}
+			if id == previous {
+				t.Fatalf("Duplicate %s id: %s", name, id)
+			}
+			previous = id
+		}
+	}
+}
+
+func TestTimeOrderedIDs(t *testing.T) {
+	for _, name := range []string{IDUUIDv7, IDULID} {
+		generator, _ := getIDGenerator(name)
+		first, _ := generator()
+		time.Sleep(2 * time.Millisecond)
+		second, _ := generator()
+		if first >= second {
+			t.Errorf("Expected the %s ids to be ordered by time. Got %s, %s", name, first, second)
+		}
+	}
+
+	generator := NewSnowflakeGenerator(5)
+	previous := int64(0)
+	for i := 0; i < 5000; i++ {
+		id, err := generator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := strconv.ParseInt(id, 10, 64)
+		if value <= previous {
+			t.Fatalf("Expected increasing snowflake ids. Got %d after %d", value, previous)
+		}
+		if node := value >> snowflakeSequenceBits & (1<<snowflakeNodeBits - 1); node != 5 {
+			t.Fatal("Unexpected node: ", node)
+		}
+		previous = value
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	if encoded := encodeULID(max); encoded != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Fatal("Unexpected encoding: ", encoded)
+	}
+	if encoded := encodeULID([16]byte{15: 33}); encoded != "00000000000000000000000011" {
+		t.Fatal("Unexpected encoding: ", encoded)
+	}
+}
+
+func TestGenerateID(t *testing.T) {
+	sequence := func() (string, error) {
+		return "42", nil
+	}
+
+	record := map[string]interface{}{"id": "custom"}
+	if err := generateID(record, IDULID, "", sequence); err != nil || record["id"] != "custom" {
+		t.Fatal("Expected the id to be kept. Got: ", record, err)
+	}
+
+	record = map[string]interface{}{}
+	if err := generateID(record, IDSequence, "", sequence); err != nil || record["id"] != "42" {
+		t.Fatal("Expected the sequence id. Got: ", record, err)
+	}
+
+	record = map[string]interface{}{}
+	if err := generateID(record, "", "", sequence); err != nil || record["id"] != nil {
+		t.Fatal("Expected no id. Got: ", record, err)
+	}
+
+	record = map[string]interface{}{}
+	if err := generateID(record, "", IDUUIDv4, sequence); err != nil || len(record["id"].(string)) != 36 {
+		t.Fatal("Expected a default UUID. Got: ", record, err)
+	}
+
+	if err := generateID(map[string]interface{}{}, "uuidv9", "", sequence); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown generator. Got: ", err)
+	}
+	if err := validIDGenerator("uuidv9"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown generator. Got: ", err)
+	}
+}
+
+func TestRegisterIDGenerator(t *testing.T) {
+	RegisterIDGenerator("test", func() (string, error) {
+		return "test-id", nil
+	})
+	record := map[string]interface{}{}
+	if err := generateID(record, "test", "", nil); err != nil || record["id"] != "test-id" {
+		t.Fatal("Expected the registered generator to be used. Got: ", record, err)
+	}
+
+	if !(RepositoryDefinitionMap{"idGenerator": "test"}).IsCustomID() {
+		t.Fatal("Expected the generated IDs to be custom IDs")
+	}
+}
@@ -0,0 +1,191 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of the record IDs ("idType" property).
+const (
+	// IDTypeObjectID are MongoDB ObjectIDs, as 24-character hex strings. It is the default on MongoDB.
+	IDTypeObjectID = "objectid"
+	// IDTypeString are arbitrary strings. It is the default on DynamoDB.
+	IDTypeString = "string"
+	// IDTypeUUID are UUIDs, in the canonical lower-case form.
+	IDTypeUUID = "uuid"
+	// IDTypeInt are 64-bit integers.
+	IDTypeInt = "int"
+)
+
+// GetIDType returns the type of the record IDs ("idType" property), or an empty string for the default:
+// ObjectIDs on MongoDB and strings on DynamoDB.
+func (m RepositoryDefinitionMap) GetIDType() string {
+	if idType, ok := m["idType"]; ok {
+		return idType.(string)
+	}
+	return ""
+}
+
+// validIDType returns an error if the ID type is not known.
+func validIDType(idType string) error {
+	switch idType {
+	case "", IDTypeObjectID, IDTypeString, IDTypeUUID, IDTypeInt:
+		return nil
+	}
+	return ErrInvalidInput(fmt.Sprintf("unknown ID type %s", idType))
+}
+
+// toIDValue validates the id and converts it to the ID type: a bson.ObjectId, a string, a lower-case UUID
+// string or an int64. Returns ErrInvalidInput if the id is not of the type.
+func toIDValue(id interface{}, idType string) (interface{}, error) {
+	switch idType {
+	case IDTypeObjectID:
+		switch v := id.(type) {
+		case bson.ObjectId:
+			return v, nil
+		case string:
+			if bson.IsObjectIdHex(v) {
+				return bson.ObjectIdHex(v), nil
+			}
+		}
+		return nil, ErrInvalidInput("id is a invalid hex representation of an ObjectId")
+	case IDTypeUUID:
+		if s, ok := id.(string); ok {
+			if parsed, err := uuid.FromString(s); err == nil {
+				return parsed.String(), nil
+			}
+		}
+		return nil, ErrInvalidInput(fmt.Sprintf("id %v is not a UUID", id))
+	case IDTypeInt:
+		switch v := id.(type) {
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				return i, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, ErrInvalidInput(fmt.Sprintf("id %v is not an integer", id))
+	case IDTypeString:
+		if _, ok := id.(string); !ok {
+			return nil, ErrInvalidInput(fmt.Sprintf("id %v is not a string", id))
+		}
+	}
+	return id, nil
+}
+
+// convertIDFilter converts the id of the filter to the ID type. With multiple, a string with comma
+// separated ids is converted to a list of ids. Filter specifications (patterns, ranges...) are not converted.
+func convertIDFilter(filter Filter, idType string, multiple bool) error {
+	id, ok := filter["id"]
+	if !ok || idType == "" || isFilterSpec(id) {
+		return nil
+	}
+	if s, ok := id.(string); ok && multiple && strings.Contains(s, ",") {
+		ids := []interface{}{}
+		for _, part := range strings.Split(s, ",") {
+			value, err := toIDValue(part, idType)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, value)
+		}
+		filter["id"] = ids
+		return nil
+	}
+	value, err := toIDValue(id, idType)
+	if err != nil {
+		return err
+	}
+	filter["id"] = value
+	return nil
+}
+
+// mongoIDType returns the type of the ids stored in the _id of the documents. The custom IDs are stored
+// in the id property and _id is always an ObjectId.
+func (s *MongoSession) mongoIDType() string {
+	if idType := s.repoDef.GetIDType(); idType != "" && !s.repoDef.IsCustomID() {
+		return idType
+	}
+	return IDTypeObjectID
+}
+
+// idFilter converts the id of the filter to the stored id: the _id of the ID type, or the id property
+// (converted to the ID type, if set) for custom IDs. With multiple, comma separated ids are matched with $in.
+func (s *MongoSession) idFilter(filter Filter, multiple bool) error {
+	if s.repoDef.IsCustomID() {
+		return convertIDFilter(filter, s.repoDef.GetIDType(), false)
+	}
+	if err := convertIDFilter(filter, s.mongoIDType(), multiple); err != nil {
+		return err
+	}
+	if id, ok := filter["id"]; ok {
+		delete(filter, "id")
+		if ids, ok := id.([]interface{}); ok {
+			id = bson.M{"$in": ids}
+		}
+		filter["_id"] = id
+	}
+	return nil
+}
+
+// newRecordID returns the _id of a new record. ObjectIDs are always generated. The ids of the other types
+// are taken from the id property of the record, or generated: a UUID for uuid and string ids and the next
+// value of the sequence for int ids. The custom IDs are validated.
+func (s *MongoSession) newRecordID(record map[string]interface{}) (interface{}, error) {
+	if s.repoDef.IsCustomID() {
+		if id, ok := record["id"]; ok && s.repoDef.GetIDType() != "" {
+			value, err := toIDValue(id, s.repoDef.GetIDType())
+			if err != nil {
+				return nil, err
+			}
+			record["id"] = value
+		}
+		return bson.NewObjectId(), nil
+	}
+
+	idType := s.mongoIDType()
+	if idType == IDTypeObjectID {
+		return bson.NewObjectId(), nil
+	}
+	id, ok := record["id"]
+	if !ok {
+		var err error
+		if idType == IDTypeInt {
+			id, err = s.nextSequence()
+		} else {
+			id, err = newUUIDv4()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return toIDValue(id, idType)
+}
+
+// mongoIDValue returns the id as it is returned in the records: ObjectIDs as hex strings,
+// the other ids as they are.
+func mongoIDValue(id interface{}) interface{} {
+	if objectID, ok := id.(bson.ObjectId); ok {
+		return objectID.Hex()
+	}
+	return id
+}
@@ -0,0 +1,121 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestToIDValue(t *testing.T) {
+	objectID := bson.NewObjectId()
+	valid := []struct {
+		id       interface{}
+		idType   string
+		expected interface{}
+	}{
+		{objectID.Hex(), IDTypeObjectID, objectID},
+		{objectID, IDTypeObjectID, objectID},
+		{"6BA7B810-9DAD-11D1-80B4-00C04FD430C8", IDTypeUUID, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{"42", IDTypeInt, int64(42)},
+		{float64(42), IDTypeInt, int64(42)},
+		{42, IDTypeInt, int64(42)},
+		{"key-1", IDTypeString, "key-1"},
+		{"anything", "", "anything"},
+	}
+	for _, test := range valid {
+		value, err := toIDValue(test.id, test.idType)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v (%s): %s", test.id, test.idType, err)
+		}
+		if value != test.expected {
+			t.Fatalf("Expected %v (%T) for %v (%s). Got %v (%T)", test.expected, test.expected, test.id, test.idType, value, value)
+		}
+	}
+
+	invalid := []struct {
+		id     interface{}
+		idType string
+	}{
+		{"not-hex", IDTypeObjectID},
+		{"not-a-uuid", IDTypeUUID},
+		{"4x", IDTypeInt},
+		{1.5, IDTypeInt},
+		{42, IDTypeString},
+	}
+	for _, test := range invalid {
+		if _, err := toIDValue(test.id, test.idType); err == nil || !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %v (%s). Got: %v", test.id, test.idType, err)
+		}
+	}
+}
+
+func TestValidIDType(t *testing.T) {
+	for _, idType := range []string{"", IDTypeObjectID, IDTypeString, IDTypeUUID, IDTypeInt} {
+		if err := validIDType(idType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := validIDType("long"); err == nil {
+		t.Fatal("Expected an error for an unknown ID type")
+	}
+}
+
+func TestMongoIDFilter(t *testing.T) {
+	objectID := bson.NewObjectId()
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{}}
+	filter := Filter{"id": objectID.Hex()}
+	if err := repo.idFilter(filter, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter, Filter{"_id": objectID}) {
+		t.Fatal("Expected a filter by the ObjectId. Got: ", filter)
+	}
+
+	repo = &MongoSession{repoDef: RepositoryDefinitionMap{"idType": IDTypeInt}}
+	filter = Filter{"id": "1,2"}
+	if err := repo.idFilter(filter, true); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter, Filter{"_id": bson.M{"$in": []interface{}{int64(1), int64(2)}}}) {
+		t.Fatal("Expected a filter by the int ids. Got: ", filter)
+	}
+	if err := repo.idFilter(Filter{"id": "one"}, false); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid int id. Got: ", err)
+	}
+
+	repo = &MongoSession{repoDef: RepositoryDefinitionMap{"customId": true, "idType": IDTypeUUID}}
+	filter = Filter{"id": "6BA7B810-9DAD-11D1-80B4-00C04FD430C8"}
+	if err := repo.idFilter(filter, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter, Filter{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}) {
+		t.Fatal("Expected a filter by the custom id. Got: ", filter)
+	}
+}
+
+func TestMongoNewRecordID(t *testing.T) {
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{"idType": IDTypeUUID}}
+	record := map[string]interface{}{}
+	id, err := repo.newRecordID(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toIDValue(id, IDTypeUUID); err != nil {
+		t.Fatal("Expected a generated UUID. Got: ", id)
+	}
+
+	record = map[string]interface{}{"id": "user-1"}
+	repo = &MongoSession{repoDef: RepositoryDefinitionMap{"idType": IDTypeString}}
+	if id, err = repo.newRecordID(record); err != nil || id != "user-1" {
+		t.Fatal("Expected the id of the record. Got: ", id, err)
+	}
+
+	repo = &MongoSession{repoDef: RepositoryDefinitionMap{}}
+	if id, err = repo.newRecordID(record); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := id.(bson.ObjectId); !ok {
+		t.Fatal("Expected a new ObjectId. Got: ", id)
+	}
+}
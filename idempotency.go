@@ -0,0 +1,233 @@
+package backends
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// IdempotencySuffix is appended to the collection name to get the name of the collection of the idempotency keys.
+const IdempotencySuffix = "_idempotency"
+
+// DefaultIdempotencyTTL is how long the idempotency keys are kept, if not set on the repository.
+var DefaultIdempotencyTTL = 24 * time.Hour
+
+// IDEMPOTENCY_KEY_CTX_KEY is the context key for the idempotency key of a write.
+var IDEMPOTENCY_KEY_CTX_KEY = "BACKENDS_IDEMPOTENCY_KEY"
+
+// WithIdempotencyKey returns a copy of the context that carries the idempotency key of the request, usually
+// taken from the Idempotency-Key header.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, IDEMPOTENCY_KEY_CTX_KEY, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key, or empty string if not set.
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if key, ok := ctx.Value(IDEMPOTENCY_KEY_CTX_KEY).(string); ok {
+		return key
+	}
+	return ""
+}
+
+const (
+	idempotencyPending = "pending"
+	idempotencyDone    = "done"
+)
+
+// idempotencyRecord is the result of a write, kept by its idempotency key.
+type idempotencyRecord struct {
+	ID        string                 `json:"id" bson:"id"`
+	State     string                 `json:"state" bson:"state"`
+	Request   string                 `json:"request" bson:"request"`
+	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
+	Result    map[string]interface{} `json:"result,omitempty" bson:"result,omitempty"`
+}
+
+// IdempotentRepository wraps a Repository and makes the writes with an idempotency key safe to repeat. The
+// result of the first Save with a key is kept in the keys repository, and the repeated Saves with the same
+// key return that result instead of saving the object again. The key is taken from the context bound with
+// WithContext:
+//
+//	ctx = backends.WithIdempotencyKey(ctx, req.Header.Get("Idempotency-Key"))
+//	order, err := repo.WithContext(ctx).Save(&order, nil)
+//
+// A key used again with another object (or filter) fails with ErrInvalidInput, and a key of a Save that is
+// still running fails with ErrAlreadyExists. The Saves without a key are not changed.
+type IdempotentRepository struct {
+	Repository
+	keys Repository
+	ttl  time.Duration
+	ctx  context.Context
+}
+
+// NewIdempotentRepository wraps the repository and keeps the idempotency keys in the keys repository for
+// the given time (DefaultIdempotencyTTL if zero). The keys repository must reject a record with an existing
+// id, as the repositories defined with "customId" do.
+func NewIdempotentRepository(repo Repository, keys Repository, ttl time.Duration) *IdempotentRepository {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotentRepository{
+		Repository: repo,
+		keys:       keys,
+		ttl:        ttl,
+	}
+}
+
+// DefineIdempotentRepository defines the repository and its keys repository (named <collection>_idempotency)
+// on the backend, and returns the idempotent repository. The keys expire after the TTL of the definition
+// (property "ttl", in seconds) or after DefaultIdempotencyTTL.
+func DefineIdempotentRepository(backend Backend, name string, def RepositoryDefinition) (*IdempotentRepository, error) {
+	repo, err := backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := DefaultIdempotencyTTL
+	if seconds := def.GetTTL(); seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	keysDef := RepositoryDefinitionMap{
+		"name":          def.GetName() + IdempotencySuffix,
+		"customId":      true,
+		"indexes":       []Index{NewUniqueIndex("id")},
+		"hashKey":       "id",
+		"hashKeyType":   "S",
+		"enableTtl":     true,
+		"ttl":           int(ttl / time.Second),
+		"ttlAttribute":  "createdAt",
+		"readCapacity":  def.GetReadCapacity(),
+		"writeCapacity": def.GetWriteCapacity(),
+	}
+	if database := def.GetDatabase(); database != "" {
+		keysDef["database"] = database
+	}
+
+	keys, err := backend.DefineRepository(name+IdempotencySuffix, keysDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIdempotentRepository(repo, keys, ttl), nil
+}
+
+// WithContext returns a copy of the repository that saves with the idempotency key from the context.
+func (r *IdempotentRepository) WithContext(ctx context.Context) Repository {
+	return &IdempotentRepository{
+		Repository: WithContext(r.Repository, ctx),
+		keys:       r.keys,
+		ttl:        r.ttl,
+		ctx:        ctx,
+	}
+}
+
+// Save saves the object. With an idempotency key in the context, a repeated Save returns the result of the
+// first one, decoded into the object.
+func (r *IdempotentRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	key := IdempotencyKeyFromContext(r.ctx)
+	if key == "" {
+		return r.Repository.Save(object, filter)
+	}
+
+	request, err := idempotencyRequest(object, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := r.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return r.replay(existing, request, object)
+	}
+
+	// the key is reserved first, so a concurrent Save with the same key fails instead of saving a duplicate
+	reserved := &idempotencyRecord{
+		ID:        key,
+		State:     idempotencyPending,
+		Request:   request,
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := r.keys.Save(reserved, nil); err != nil {
+		if IsErrAlreadyExists(err) {
+			return nil, ErrAlreadyExists(fmt.Sprintf("a request with the idempotency key %s is in progress", key))
+		}
+		return nil, err
+	}
+
+	result, err := r.Repository.Save(object, filter)
+	if err != nil {
+		// the request failed, so it can be retried with the same key
+		r.keys.DeleteOne(Filter{"id": key})
+		return nil, err
+	}
+
+	saved, err := toAuditMap(result)
+	if err != nil {
+		return result, err
+	}
+	done := map[string]interface{}{
+		"state":  idempotencyDone,
+		"result": saved,
+	}
+	if _, err := r.keys.Save(&done, Filter{"id": key}); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// getKey returns the record of the idempotency key, or nil if there is no such key or it has expired. The
+// expired keys are deleted, as the backends may remove them some time after they expire.
+func (r *IdempotentRepository) getKey(key string) (*idempotencyRecord, error) {
+	record := &idempotencyRecord{}
+	if _, err := r.keys.GetOne(Filter{"id": key}, record); err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if time.Since(record.CreatedAt) < r.ttl {
+		return record, nil
+	}
+	if err := r.keys.DeleteOne(Filter{"id": key}); err != nil && !IsErrNotFound(err) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// replay returns the result of the write kept with the idempotency key.
+func (r *IdempotentRepository) replay(record *idempotencyRecord, request string, object interface{}) (interface{}, error) {
+	if record.Request != request {
+		return nil, ErrInvalidInput(fmt.Sprintf("the idempotency key %s was used for another request", record.ID))
+	}
+	if record.State != idempotencyDone {
+		return nil, ErrAlreadyExists(fmt.Sprintf("a request with the idempotency key %s is in progress", record.ID))
+	}
+	if err := MapToInterface(record.Result, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// idempotencyRequest returns the digest of the object and the filter of a Save, to tell the repeated
+// requests from the other requests with the same key.
+func idempotencyRequest(object interface{}, filter Filter) (string, error) {
+	payload, err := toAuditMap(object)
+	if err != nil {
+		return "", err
+	}
+	request := map[string]interface{}{"object": payload}
+	if filter != nil {
+		request["filter"] = map[string]interface{}(filter)
+	}
+	digest, err := recordDigest(request, nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest), nil
+}
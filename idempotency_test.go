@@ -0,0 +1,115 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// uniqueMemoryRepo is a memoryRepo rejecting the records with an existing key ("id" by default).
+type uniqueMemoryRepo struct {
+	*memoryRepo
+	key string
+}
+
+func (r *uniqueMemoryRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	if filter == nil {
+		payload, err := InterfaceToMap(object)
+		if err != nil {
+			return nil, err
+		}
+		key := r.key
+		if key == "" {
+			key = "id"
+		}
+		if r.find(Filter{key: (*payload)[key]}) >= 0 {
+			return nil, &DuplicateKeyError{Collection: "keys"}
+		}
+	}
+	return r.memoryRepo.Save(object, filter)
+}
+
+// countingRepo is a memoryRepo generating the ids of the saved records.
+type countingRepo struct {
+	*memoryRepo
+	saves int
+	fail  bool
+}
+
+func (r *countingRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	if r.fail {
+		return nil, errors.New("unavailable")
+	}
+	r.saves++
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	(*payload)["id"] = string(rune('0' + r.saves))
+	return r.memoryRepo.Save(payload, filter)
+}
+
+func TestIdempotentRepositorySave(t *testing.T) {
+	orders := &countingRepo{memoryRepo: &memoryRepo{}}
+	keys := &uniqueMemoryRepo{memoryRepo: &memoryRepo{}}
+	repo := NewIdempotentRepository(orders, keys, time.Hour)
+	ctx := WithIdempotencyKey(context.Background(), "key-1")
+
+	first := map[string]interface{}{"total": 10}
+	if _, err := repo.WithContext(ctx).Save(&first, nil); err != nil {
+		t.Fatal(err)
+	}
+	retried := map[string]interface{}{"total": 10}
+	result, err := repo.WithContext(ctx).Save(&retried, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders.saves != 1 || len(orders.records) != 1 {
+		t.Fatal("Expected the repeated request not to create a duplicate. Got: ", orders.records)
+	}
+	if record := *result.(*map[string]interface{}); record["id"] != "1" {
+		t.Fatal("Expected the result of the first request. Got: ", record)
+	}
+
+	other := map[string]interface{}{"total": 20}
+	if _, err := repo.WithContext(ctx).Save(&other, nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for another request with the same key. Got: ", err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"total": 10}, nil); err != nil || orders.saves != 2 {
+		t.Fatal("Expected a save without a key to create a record. Got: ", orders.saves, err)
+	}
+}
+
+func TestIdempotentRepositoryPendingAndFailed(t *testing.T) {
+	orders := &countingRepo{memoryRepo: &memoryRepo{}}
+	keys := &uniqueMemoryRepo{memoryRepo: &memoryRepo{}}
+	repo := NewIdempotentRepository(orders, keys, time.Hour)
+	ctx := WithIdempotencyKey(context.Background(), "key-1")
+
+	orders.fail = true
+	if _, err := repo.WithContext(ctx).Save(&map[string]interface{}{"total": 10}, nil); err == nil {
+		t.Fatal("Expected the error of the repository")
+	}
+	if len(keys.records) != 0 {
+		t.Fatal("Expected the key of a failed request to be released. Got: ", keys.records)
+	}
+
+	orders.fail = false
+	request, err := idempotencyRequest(&map[string]interface{}{"total": 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.records = []map[string]interface{}{{"id": "key-1", "state": idempotencyPending, "request": request, "createdAt": time.Now().UTC()}}
+	if _, err := repo.WithContext(ctx).Save(&map[string]interface{}{"total": 10}, nil); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists for a request in progress. Got: ", err)
+	}
+
+	keys.records[0]["createdAt"] = time.Now().Add(-2 * time.Hour).UTC()
+	if _, err := repo.WithContext(ctx).Save(&map[string]interface{}{"total": 10}, nil); err != nil {
+		t.Fatal("Expected an expired key to be reused. Got: ", err)
+	}
+	if orders.saves != 1 || len(keys.records) != 1 || keys.records[0]["state"] != idempotencyDone {
+		t.Fatal("Expected the record and the key to be saved. Got: ", orders.records, keys.records)
+	}
+}
@@ -0,0 +1,205 @@
+package backends
+
+// Collation defines the language rules for comparing strings in an index.
+// Strength 1 compares base characters only, 2 also compares diacritics (case-insensitive),
+// 3 (the default) also compares case.
+type Collation struct {
+	Locale   string
+	Strength int
+}
+
+// IndexSpec is an Index with options beyond fields and uniqueness. All methods are chained:
+// 		index := backends.NewIndexSpec("email").AsUnique().CaseInsensitive("en")
+// Fields prefixed with "-" are indexed in descending order:
+// 		index := backends.NewIndexSpec("tenant", "-created_at").Named("tenant_recent")
+type IndexSpec struct {
+	Name           string
+	Fields         []string
+	IsUnique       bool
+	IsSparse       bool
+	DropDuplicates bool
+	PartialFilter  map[string]interface{}
+	Collation      *Collation
+	// DynamoDB secondary index options
+	IsLocal          bool
+	ProjectionType   string
+	NonKeyAttributes []string
+	ReadCapacity     int64
+	WriteCapacity    int64
+	AttributeTypes   map[string]string
+}
+
+// Projection types of the DynamoDB secondary indexes.
+const (
+	ProjectAll      = "ALL"
+	ProjectKeysOnly = "KEYS_ONLY"
+	ProjectInclude  = "INCLUDE"
+)
+
+// SecondaryIndex is an Index with the options of the DynamoDB secondary indexes. On DynamoDB, the first
+// field of a global secondary index is its partition (hash) key and the second field is its sort (range) key.
+// A local secondary index has the partition key of the table, and its only field is the sort key.
+type SecondaryIndex interface {
+	Index
+	// Local returns true for local secondary indexes.
+	Local() bool
+	// GetProjection returns the projection type and the projected non-key attributes (for ProjectInclude).
+	GetProjection() (string, []string)
+	// GetThroughput returns the provisioned read and write capacity of a global secondary index.
+	GetThroughput() (int64, int64)
+	// GetAttributeType returns the DynamoDB type ("S", "N" or "B") of the indexed attribute.
+	GetAttributeType(field string) string
+}
+
+// NewIndexSpec creates new index on the fields.
+func NewIndexSpec(fields ...string) *IndexSpec {
+	if fields == nil {
+		fields = []string{}
+	}
+	return &IndexSpec{
+		Fields: fields,
+	}
+}
+
+// Named sets the name of the index.
+func (i *IndexSpec) Named(name string) *IndexSpec {
+	i.Name = name
+	return i
+}
+
+// AsUnique makes the index unique.
+func (i *IndexSpec) AsUnique() *IndexSpec {
+	i.IsUnique = true
+	return i
+}
+
+// AsSparse makes the index sparse - records without the indexed fields are not indexed.
+// Sparse unique indexes allow multiple records without the fields.
+func (i *IndexSpec) AsSparse() *IndexSpec {
+	i.IsSparse = true
+	return i
+}
+
+// WithDropDups drops the duplicate records when a unique index is created on existing data.
+// Only supported by MongoDB before 3.0. Use with care - the duplicates are deleted.
+func (i *IndexSpec) WithDropDups() *IndexSpec {
+	i.DropDuplicates = true
+	return i
+}
+
+// Partial indexes only the records that match the filter expression, for example:
+// 		index := backends.NewIndexSpec("email").AsUnique().Partial(map[string]interface{}{"deleted": false})
+func (i *IndexSpec) Partial(filter map[string]interface{}) *IndexSpec {
+	i.PartialFilter = filter
+	return i
+}
+
+// WithCollation sets the collation used to compare the string values in the index.
+func (i *IndexSpec) WithCollation(collation *Collation) *IndexSpec {
+	i.Collation = collation
+	return i
+}
+
+// CaseInsensitive sets a collation that ignores the case (strength 2) for the given locale.
+func (i *IndexSpec) CaseInsensitive(locale string) *IndexSpec {
+	return i.WithCollation(&Collation{
+		Locale:   locale,
+		Strength: 2,
+	})
+}
+
+// AsLocal makes the index a DynamoDB local secondary index. Local indexes can be created only with the table.
+func (i *IndexSpec) AsLocal() *IndexSpec {
+	i.IsLocal = true
+	return i
+}
+
+// Project sets the attributes projected into a DynamoDB secondary index (ProjectAll, ProjectKeysOnly or
+// ProjectInclude with the non-key attributes):
+// 		index := backends.NewIndexSpec("email").Project(backends.ProjectInclude, "name", "role")
+func (i *IndexSpec) Project(projectionType string, nonKeyAttributes ...string) *IndexSpec {
+	i.ProjectionType = projectionType
+	i.NonKeyAttributes = nonKeyAttributes
+	return i
+}
+
+// WithThroughput sets the provisioned read and write capacity of a DynamoDB global secondary index.
+// Defaults to the capacity of the table.
+func (i *IndexSpec) WithThroughput(readCapacity, writeCapacity int64) *IndexSpec {
+	i.ReadCapacity = readCapacity
+	i.WriteCapacity = writeCapacity
+	return i
+}
+
+// WithAttributeType sets the DynamoDB type ("S", "N" or "B") of an indexed attribute. Defaults to "S".
+func (i *IndexSpec) WithAttributeType(field, attributeType string) *IndexSpec {
+	if i.AttributeTypes == nil {
+		i.AttributeTypes = map[string]string{}
+	}
+	i.AttributeTypes[field] = attributeType
+	return i
+}
+
+// GetName returns the name of the index. Defaults to the field names joined with "_".
+func (i *IndexSpec) GetName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return indexNameFromFields(i.Fields...)
+}
+
+// GetFields returns the indexed fields.
+func (i *IndexSpec) GetFields() []string {
+	return i.Fields
+}
+
+// Unique returns true if the index is unique.
+func (i *IndexSpec) Unique() bool {
+	return i.IsUnique
+}
+
+// Sparse returns true if the index is sparse.
+func (i *IndexSpec) Sparse() bool {
+	return i.IsSparse
+}
+
+// DropDups returns true if the duplicate records are dropped when creating the index.
+func (i *IndexSpec) DropDups() bool {
+	return i.DropDuplicates
+}
+
+// GetPartialFilter returns the partial filter expression, or nil if all records are indexed.
+func (i *IndexSpec) GetPartialFilter() map[string]interface{} {
+	return i.PartialFilter
+}
+
+// GetCollation returns the collation of the index, or nil for the default binary comparison.
+func (i *IndexSpec) GetCollation() *Collation {
+	return i.Collation
+}
+
+// Local returns true for DynamoDB local secondary indexes.
+func (i *IndexSpec) Local() bool {
+	return i.IsLocal
+}
+
+// GetProjection returns the projection type (defaults to ProjectAll) and the projected non-key attributes.
+func (i *IndexSpec) GetProjection() (string, []string) {
+	if i.ProjectionType == "" {
+		return ProjectAll, nil
+	}
+	return i.ProjectionType, i.NonKeyAttributes
+}
+
+// GetThroughput returns the provisioned read and write capacity of the index.
+func (i *IndexSpec) GetThroughput() (int64, int64) {
+	return i.ReadCapacity, i.WriteCapacity
+}
+
+// GetAttributeType returns the DynamoDB type of the indexed attribute. Defaults to "S".
+func (i *IndexSpec) GetAttributeType(field string) string {
+	if attributeType, ok := i.AttributeTypes[field]; ok {
+		return attributeType
+	}
+	return "S"
+}
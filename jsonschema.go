@@ -0,0 +1,531 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// JSONSchemaDraft07 is the meta-schema URI of the JSON Schema documents generated by ToJSONSchema.
+const JSONSchemaDraft07 = "http://json-schema.org/draft-07/schema#"
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// isJSONSchema checks if the backend properties schema is a JSON Schema document rather than
+// a map of property => type.
+func isJSONSchema(schema map[string]interface{}) bool {
+	if _, ok := schema["$schema"]; ok {
+		return true
+	}
+	_, hasProperties := schema["properties"].(map[string]interface{})
+	return schema["type"] == "object" && hasProperties
+}
+
+// LoadJSONSchema reads a JSON Schema document from a file.
+func LoadJSONSchema(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	return schema, nil
+}
+
+// ToJSONSchema converts the backend properties schema (see ValidateBackend) to a JSON Schema (draft-07)
+// document, so the configuration can be validated by external tools with the same schema.
+// JSON Schema documents are returned unchanged.
+func ToJSONSchema(schema map[string]interface{}) map[string]interface{} {
+	if isJSONSchema(schema) {
+		return schema
+	}
+	result := toJSONSchemaObject(schema)
+	result["$schema"] = JSONSchemaDraft07
+	return result
+}
+
+func toJSONSchemaObject(schema map[string]interface{}) map[string]interface{} {
+	if valueSchema, ok := schema["string"]; ok && len(schema) == 1 {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": toJSONSchemaValue(valueSchema),
+		}
+	}
+	properties := map[string]interface{}{}
+	for key, propSchema := range schema {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		properties[key] = toJSONSchemaValue(propSchema)
+	}
+	result := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	required, conditional := jsonSchemaRequirements(schema)
+	if len(required) > 0 {
+		result["required"] = required
+	}
+	if len(conditional) > 0 {
+		result["allOf"] = conditional
+	}
+	return result
+}
+
+func toJSONSchemaValue(schema interface{}) interface{} {
+	if nested, ok := schema.(map[string]interface{}); ok {
+		return toJSONSchemaObject(nested)
+	}
+	spec, _ := schema.(string)
+	propType, validatorNames := parseTypeSpec(spec)
+
+	var result map[string]interface{}
+	switch propType {
+	case "string":
+		result = map[string]interface{}{"type": "string"}
+	case "bool":
+		return map[string]interface{}{"type": "boolean"}
+	case "int":
+		return map[string]interface{}{"type": "integer"}
+	case "int or string":
+		return map[string]interface{}{"type": []interface{}{"integer", "string"}}
+	case "string array":
+		items := map[string]interface{}{"type": "string"}
+		withFormats(items, validatorNames)
+		return map[string]interface{}{"type": "array", "items": items}
+	case "object array":
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "object"}}
+	default:
+		return true
+	}
+	withFormats(result, validatorNames)
+	return result
+}
+
+// withFormats references the named validators as "format" of the schema. JSON Schema allows only
+// one format per schema, so additional validators are added with "allOf".
+func withFormats(schema map[string]interface{}, validatorNames []string) {
+	for i, name := range validatorNames {
+		if i == 0 {
+			schema["format"] = name
+			continue
+		}
+		allOf, _ := schema["allOf"].([]interface{})
+		schema["allOf"] = append(allOf, map[string]interface{}{"format": name})
+	}
+}
+
+// jsonSchemaValidator validates values against a JSON Schema (draft-07) document.
+// Supported keywords: type, enum, const, properties, required, additionalProperties, patternProperties,
+// dependencies, propertyNames, minProperties, maxProperties, items, additionalItems, minItems, maxItems,
+// uniqueItems, contains, minLength, maxLength, pattern, format, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not, if/then/else and local $ref ("#/definitions/...").
+type jsonSchemaValidator struct {
+	root map[string]interface{}
+}
+
+func validateJSONSchema(value interface{}, schema map[string]interface{}, result *ValidationResult) {
+	validator := &jsonSchemaValidator{root: schema}
+	validator.validate(validationPath{}, normalizeJSONValue(value), schema, result)
+}
+
+// matches checks if the value is valid against the schema, without recording the errors.
+func (v *jsonSchemaValidator) matches(path validationPath, value interface{}, schema interface{}) bool {
+	result := newValidationResult()
+	v.validate(path, value, schema, result)
+	return result.Valid
+}
+
+func (v *jsonSchemaValidator) validate(path validationPath, value interface{}, schemaValue interface{}, result *ValidationResult) {
+	if allowed, ok := schemaValue.(bool); ok {
+		if !allowed {
+			result.addError(path, "false", "no value is allowed")
+		}
+		return
+	}
+	schema, ok := schemaValue.(map[string]interface{})
+	if !ok {
+		result.addError(path, "schema", "invalid schema definition")
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		// in draft-07, all other keywords are ignored next to $ref
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			result.addError(path, "ref", err.Error())
+			return
+		}
+		v.validate(path, value, resolved, result)
+		return
+	}
+
+	if types, ok := schema["type"]; ok && !matchesJSONType(value, types) {
+		result.addTypeError(path, jsonTypesString(types), typeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(normalizeJSONValue(allowed), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.addMismatch(path, "enum", fmt.Sprintf("must be one of %v", enum), fmt.Sprintf("%v", enum), fmt.Sprintf("%v", value))
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !reflect.DeepEqual(normalizeJSONValue(constValue), value) {
+		result.addMismatch(path, "const", fmt.Sprintf("must be %v", constValue), fmt.Sprintf("%v", constValue), fmt.Sprintf("%v", value))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(path, val, schema, result)
+	case []interface{}:
+		v.validateArray(path, val, schema, result)
+	case string:
+		v.validateString(path, val, schema, result)
+	case float64:
+		validateJSONNumber(path, val, schema, result)
+	}
+
+	v.validateCombinators(path, value, schema, result)
+}
+
+func (v *jsonSchemaValidator) validateObject(path validationPath, object map[string]interface{}, schema map[string]interface{}, result *ValidationResult) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, property := range required {
+			name := fmt.Sprintf("%v", property)
+			if _, ok := object[name]; !ok {
+				result.addError(path.with(name), "required", "is required")
+			}
+		}
+	}
+	if min, ok := jsonNumber(schema["minProperties"]); ok && float64(len(object)) < min {
+		result.addError(path, "minProperties", fmt.Sprintf("must have at least %v properties", min))
+	}
+	if max, ok := jsonNumber(schema["maxProperties"]); ok && float64(len(object)) > max {
+		result.addError(path, "maxProperties", fmt.Sprintf("must have at most %v properties", max))
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additionalProperties, hasAdditional := schema["additionalProperties"]
+	propertyNames, hasPropertyNames := schema["propertyNames"]
+
+	for _, key := range sortedKeys(object) {
+		propPath := path.with(key)
+		if hasPropertyNames && !v.matches(propPath, key, propertyNames) {
+			result.addError(propPath, "propertyNames", "invalid property name")
+		}
+
+		matched := false
+		if propSchema, ok := properties[key]; ok {
+			matched = true
+			v.validate(propPath, object[key], propSchema, result)
+		}
+		for _, pattern := range sortedKeys(patternProperties) {
+			propSchema := patternProperties[pattern]
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				result.addError(propPath, "schema", fmt.Sprintf("invalid pattern %s: %s", pattern, err))
+				continue
+			}
+			if re.MatchString(key) {
+				matched = true
+				v.validate(propPath, object[key], propSchema, result)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additionalProperties.(bool); ok && !allowed {
+				result.addError(propPath, "additionalProperties", "is not allowed")
+				continue
+			}
+			v.validate(propPath, object[key], additionalProperties, result)
+		}
+	}
+
+	if dependencies, ok := schema["dependencies"].(map[string]interface{}); ok {
+		for _, key := range sortedKeys(dependencies) {
+			if _, ok := object[key]; !ok {
+				continue
+			}
+			if required, ok := dependencies[key].([]interface{}); ok {
+				for _, property := range required {
+					name := fmt.Sprintf("%v", property)
+					if _, ok := object[name]; !ok {
+						result.addError(path.with(name), "dependencies", fmt.Sprintf("is required when %s is set", key))
+					}
+				}
+				continue
+			}
+			v.validate(path, object, dependencies[key], result)
+		}
+	}
+}
+
+func (v *jsonSchemaValidator) validateArray(path validationPath, array []interface{}, schema map[string]interface{}, result *ValidationResult) {
+	if min, ok := jsonNumber(schema["minItems"]); ok && float64(len(array)) < min {
+		result.addError(path, "minItems", fmt.Sprintf("must have at least %v items", min))
+	}
+	if max, ok := jsonNumber(schema["maxItems"]); ok && float64(len(array)) > max {
+		result.addError(path, "maxItems", fmt.Sprintf("must have at most %v items", max))
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range array {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(array[i], array[j]) {
+					result.addError(path.with(fmt.Sprintf("%d", i)), "uniqueItems", "duplicate item")
+				}
+			}
+		}
+	}
+
+	switch items := schema["items"].(type) {
+	case []interface{}:
+		// tuple validation
+		for i, item := range array {
+			itemPath := path.with(fmt.Sprintf("%d", i))
+			if i < len(items) {
+				v.validate(itemPath, item, items[i], result)
+			} else if additionalItems, ok := schema["additionalItems"]; ok {
+				v.validate(itemPath, item, additionalItems, result)
+			}
+		}
+	case nil:
+	default:
+		for i, item := range array {
+			v.validate(path.with(fmt.Sprintf("%d", i)), item, items, result)
+		}
+	}
+
+	if contains, ok := schema["contains"]; ok {
+		found := false
+		for i, item := range array {
+			if v.matches(path.with(fmt.Sprintf("%d", i)), item, contains) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.addError(path, "contains", "does not contain a matching item")
+		}
+	}
+}
+
+func (v *jsonSchemaValidator) validateString(path validationPath, value string, schema map[string]interface{}, result *ValidationResult) {
+	length := float64(len([]rune(value)))
+	if min, ok := jsonNumber(schema["minLength"]); ok && length < min {
+		result.addError(path, "minLength", fmt.Sprintf("must be at least %v characters long", min))
+	}
+	if max, ok := jsonNumber(schema["maxLength"]); ok && length > max {
+		result.addError(path, "maxLength", fmt.Sprintf("must be at most %v characters long", max))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			result.addError(path, "schema", fmt.Sprintf("invalid pattern %s: %s", pattern, err))
+		} else if !re.MatchString(value) {
+			result.addError(path, "pattern", fmt.Sprintf("must match %s", pattern))
+		}
+	}
+	if format, ok := schema["format"].(string); ok {
+		if _, registered := getValidator(format); registered {
+			applyValidators(path, value, []string{format}, result)
+		} else if !matchesJSONFormat(value, format) {
+			result.addMismatch(path, "format", fmt.Sprintf("must be a valid %s", format), format, value)
+		}
+	}
+}
+
+func validateJSONNumber(path validationPath, value float64, schema map[string]interface{}, result *ValidationResult) {
+	if min, ok := jsonNumber(schema["minimum"]); ok && value < min {
+		result.addError(path, "minimum", fmt.Sprintf("must be at least %v", min))
+	}
+	if max, ok := jsonNumber(schema["maximum"]); ok && value > max {
+		result.addError(path, "maximum", fmt.Sprintf("must be at most %v", max))
+	}
+	if min, ok := jsonNumber(schema["exclusiveMinimum"]); ok && value <= min {
+		result.addError(path, "exclusiveMinimum", fmt.Sprintf("must be greater than %v", min))
+	}
+	if max, ok := jsonNumber(schema["exclusiveMaximum"]); ok && value >= max {
+		result.addError(path, "exclusiveMaximum", fmt.Sprintf("must be less than %v", max))
+	}
+	if multipleOf, ok := jsonNumber(schema["multipleOf"]); ok && multipleOf > 0 {
+		if quotient := value / multipleOf; quotient != math.Trunc(quotient) {
+			result.addError(path, "multipleOf", fmt.Sprintf("must be a multiple of %v", multipleOf))
+		}
+	}
+}
+
+func (v *jsonSchemaValidator) validateCombinators(path validationPath, value interface{}, schema map[string]interface{}, result *ValidationResult) {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, subSchema := range allOf {
+			v.validate(path, value, subSchema, result)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, subSchema := range anyOf {
+			if v.matches(path, value, subSchema) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			result.addError(path, "anyOf", "does not match any of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, subSchema := range oneOf {
+			if v.matches(path, value, subSchema) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			result.addError(path, "oneOf", fmt.Sprintf("must match exactly one schema, matched %d", matched))
+		}
+	}
+	if not, ok := schema["not"]; ok && v.matches(path, value, not) {
+		result.addError(path, "not", "must not match the schema")
+	}
+	if ifSchema, ok := schema["if"]; ok {
+		if v.matches(path, value, ifSchema) {
+			if thenSchema, ok := schema["then"]; ok {
+				v.validate(path, value, thenSchema, result)
+			}
+		} else if elseSchema, ok := schema["else"]; ok {
+			v.validate(path, value, elseSchema, result)
+		}
+	}
+}
+
+// resolve resolves a local reference ("#" or a JSON pointer such as "#/definitions/collection").
+func (v *jsonSchemaValidator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %s: only local references are supported", ref)
+	}
+	var current interface{} = v.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid reference %s", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("invalid reference %s", ref)
+		}
+	}
+	return current, nil
+}
+
+func matchesJSONType(value interface{}, types interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return isOfSchemaType(value, t)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && isOfSchemaType(value, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonTypesString(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := []string{}
+		for _, item := range list {
+			names = append(names, fmt.Sprintf("%v", item))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprintf("%v", types)
+}
+
+func matchesJSONFormat(value, format string) bool {
+	switch format {
+	case "hostname":
+		return hostnamePattern.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && strings.Contains(value, ".")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	}
+	return matchesFormat(value, format)
+}
+
+// jsonNumber returns the numeric value of a schema keyword.
+func jsonNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// normalizeJSONValue converts the configuration values to the types decoded from JSON
+// (float64 numbers, []interface{} arrays and map[string]interface{} objects).
+func normalizeJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			result[key] = normalizeJSONValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeJSONValue(item)
+		}
+		return result
+	}
+	if number, ok := jsonNumber(value); ok {
+		return number
+	}
+	var result interface{}
+	if err := MapToInterface(value, &result); err != nil {
+		return value
+	}
+	return result
+}
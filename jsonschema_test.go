@@ -0,0 +1,168 @@
+package backends
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var backendJSONSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["dbName", "host"],
+	"properties": {
+		"dbName": {"enum": ["mongodb", "dynamodb"]},
+		"host": {"type": "string", "pattern": "^[^:]+:[0-9]+$"},
+		"database": {"type": "string", "minLength": 1},
+		"collections": {
+			"type": "object",
+			"additionalProperties": {"$ref": "#/definitions/collection"}
+		}
+	},
+	"definitions": {
+		"collection": {
+			"type": "object",
+			"properties": {
+				"indexes": {"type": "array", "items": {"type": "string"}, "uniqueItems": true},
+				"enableTTL": {"type": "boolean"},
+				"TTL": {"type": "integer", "minimum": 1}
+			},
+			"additionalProperties": false,
+			"if": {"properties": {"enableTTL": {"const": true}}, "required": ["enableTTL"]},
+			"then": {"required": ["TTL"]}
+		}
+	}
+}`
+
+func parseSchema(t *testing.T, schema string) map[string]interface{} {
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(schema), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestValidateBackendJSONSchemaValid(t *testing.T) {
+	conf := parseConfig(t, `{
+		"dbName": "mongodb",
+		"host": "mongo:27017",
+		"database": "users",
+		"collections": {
+			"roles": {"indexes": ["name"], "enableTTL": true, "TTL": 60},
+			"users": {"indexes": ["email"]}
+		}
+	}`)
+
+	result := ValidateBackend(conf, parseSchema(t, backendJSONSchema))
+	if !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+}
+
+func TestValidateBackendJSONSchemaInvalid(t *testing.T) {
+	conf := parseConfig(t, `{
+		"dbName": "postgres",
+		"database": "",
+		"collections": {
+			"roles": {"indexes": ["name", "name"], "enableTTL": true, "unknown": 1},
+			"users": {"TTL": 1.5}
+		}
+	}`)
+
+	result := ValidateBackend(conf, parseSchema(t, backendJSONSchema))
+	if result.Valid {
+		t.Fatal("Expected the config to be invalid")
+	}
+
+	expected := []string{
+		"host: is required",
+		"collections.roles.indexes.1: duplicate item",
+		"collections.roles.unknown: is not allowed",
+		"collections.roles.TTL: is required",
+		"collections.users.TTL: expected integer, got number",
+		"database: must be at least 1 characters long",
+		"dbName: must be one of [mongodb dynamodb]",
+	}
+	for _, message := range expected {
+		if !containsString(result.Errors, message) {
+			t.Errorf("Expected error %q. Got: %v", message, result.Errors)
+		}
+	}
+	if len(result.Errors) != len(expected) {
+		t.Errorf("Expected %d errors, got %d: %v", len(expected), len(result.Errors), result.Errors)
+	}
+}
+
+func TestValidateBackendJSONSchemaCombinators(t *testing.T) {
+	schema := parseSchema(t, `{
+		"type": "object",
+		"properties": {
+			"port": {"anyOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+$"}]},
+			"mode": {"oneOf": [{"const": "a"}, {"const": "b"}]},
+			"name": {"not": {"const": "admin"}},
+			"ratio": {"type": "number", "exclusiveMaximum": 1, "multipleOf": 0.25}
+		},
+		"dependencies": {"user": ["pass"]}
+	}`)
+
+	result := ValidateBackend(parseConfig(t, `{"port": "80", "mode": "a", "name": "john", "ratio": 0.5}`), schema)
+	if !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+
+	result = ValidateBackend(parseConfig(t, `{"port": true, "mode": "c", "name": "admin", "ratio": 1, "user": "u"}`), schema)
+	if len(result.Errors) != 5 {
+		t.Fatal("Expected 5 errors, got: ", result.Errors)
+	}
+}
+
+func TestToJSONSchema(t *testing.T) {
+	schema := ToJSONSchema(backendSchema)
+	if schema["$schema"] != JSONSchemaDraft07 {
+		t.Fatal("Expected the draft-07 meta-schema")
+	}
+
+	valid := parseConfig(t, `{"host": "localhost", "collections": {"roles": {"indexes": ["name"], "TTL": 0}}}`)
+	if result := ValidateBackend(valid, schema); !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+
+	invalid := parseConfig(t, `{"host": 27017, "collections": {"roles": {"TTL": 1.5}}}`)
+	result := ValidateBackend(invalid, schema)
+	legacy := ValidateBackend(invalid, backendSchema)
+	if len(result.Errors) != len(legacy.Errors) {
+		t.Fatalf("Expected the same errors as the original schema: %v, got %v", legacy.Errors, result.Errors)
+	}
+}
+
+func TestValidateConfigWithSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backends-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	schemaFile := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(schemaFile, []byte(backendJSONSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := LoadJSONSchema(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ValidateConfigWithSchema([]byte(`{
+		"database": {
+			"dbName": "mongodb",
+			"dbInfo": {"host": "mongo:27017"}
+		}
+	}`), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+}
@@ -0,0 +1,183 @@
+package backends
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// LeaderElectorConfig configures the LeaderElector.
+type LeaderElectorConfig struct {
+	// LeaseDuration is how long the leadership is held without a renewal. Defaults to 15 seconds.
+	LeaseDuration time.Duration
+	// RenewInterval between the renewals of the lease, and between the attempts to acquire it.
+	// Defaults to a third of the LeaseDuration.
+	RenewInterval time.Duration
+	// OnStartedLeading, if set, is called in a new goroutine when this instance becomes the leader. The
+	// context is canceled when the leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading, if set, is called when this instance stops being the leader.
+	OnStoppedLeading func()
+}
+
+// LeaderElector elects one leader among the instances of a service, with a lease held as a lock of the
+// backend (see LockManager). The leader renews the lease continuously; if it stops (or fails to renew),
+// another instance takes over once the lease expires:
+//
+//	elector := backends.NewLeaderElector(backend.Locks(), "scheduler", backends.LeaderElectorConfig{
+//		OnStartedLeading: scheduler.Run, // until the context is canceled
+//	})
+//	elector.Start()
+//	backend.(*backends.RepositoriesBackend).OnShutdown(elector.Stop)
+type LeaderElector struct {
+	locks  *LockManager
+	name   string
+	config LeaderElectorConfig
+	stop   chan struct{}
+	once   *sync.Once
+
+	// renewing serializes the renewals with Resign, so a released lease is not renewed again
+	renewing  sync.Mutex
+	mutex     sync.Mutex
+	lock      *Lock
+	expiresAt time.Time
+	cancel    context.CancelFunc
+	// resignedUntil is the end of the lease given up with Resign. The instance does not run for the
+	// leadership before it, so another instance can take over.
+	resignedUntil time.Time
+}
+
+// NewLeaderElector creates an elector for the leadership with the name. Call Start to run for the leadership.
+func NewLeaderElector(locks *LockManager, name string, config LeaderElectorConfig) *LeaderElector {
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = 15 * time.Second
+	}
+	if config.RenewInterval <= 0 {
+		config.RenewInterval = config.LeaseDuration / 3
+	}
+	return &LeaderElector{
+		locks:  locks,
+		name:   name,
+		config: config,
+		stop:   make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// Start runs for the leadership in the background until Stop is called.
+func (e *LeaderElector) Start() {
+	go func() {
+		for {
+			e.renew()
+			select {
+			case <-e.stop:
+				return
+			case <-time.After(e.config.RenewInterval):
+			}
+		}
+	}()
+}
+
+// Stop stops running for the leadership, and gives up the leadership if held.
+func (e *LeaderElector) Stop() {
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	e.Resign()
+}
+
+// IsLeader returns true if this instance is the leader and its lease has not expired.
+func (e *LeaderElector) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.lock != nil && time.Now().Before(e.expiresAt)
+}
+
+// Resign gives up the leadership, if held. The instance runs for the leadership again after a lease
+// duration, so another instance can become the leader.
+func (e *LeaderElector) Resign() {
+	e.renewing.Lock()
+	defer e.renewing.Unlock()
+
+	e.mutex.Lock()
+	lock := e.lock
+	if lock != nil {
+		e.resignedUntil = time.Now().Add(e.config.LeaseDuration)
+	}
+	e.mutex.Unlock()
+	e.stepDown(lock)
+}
+
+// renew renews the lease of the leader, or tries to acquire it.
+func (e *LeaderElector) renew() {
+	e.renewing.Lock()
+	defer e.renewing.Unlock()
+
+	e.mutex.Lock()
+	lock := e.lock
+	resigned := time.Now().Before(e.resignedUntil)
+	e.mutex.Unlock()
+
+	if lock != nil {
+		if err := lock.Refresh(e.config.LeaseDuration); err != nil {
+			log.Printf("ERROR: failed to renew the leadership of %s: %s\n", e.name, err.Error())
+			e.stepDown(lock)
+			return
+		}
+		e.mutex.Lock()
+		e.expiresAt = lock.ExpiresAt
+		e.mutex.Unlock()
+		return
+	}
+	if resigned || e.stopped() {
+		return
+	}
+
+	lock, err := e.locks.AcquireLock(e.name, e.config.LeaseDuration)
+	if err != nil {
+		if !IsErrLockHeld(err) {
+			log.Printf("ERROR: failed to acquire the leadership of %s: %s\n", e.name, err.Error())
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.mutex.Lock()
+	e.lock = lock
+	e.expiresAt = lock.ExpiresAt
+	e.cancel = cancel
+	e.mutex.Unlock()
+
+	if e.config.OnStartedLeading != nil {
+		go e.config.OnStartedLeading(ctx)
+	}
+}
+
+// stepDown releases the lock of the leadership and calls OnStoppedLeading.
+func (e *LeaderElector) stepDown(lock *Lock) {
+	e.mutex.Lock()
+	if lock == nil || e.lock != lock {
+		e.mutex.Unlock()
+		return
+	}
+	e.cancel()
+	e.lock = nil
+	e.cancel = nil
+	e.mutex.Unlock()
+
+	if err := lock.Release(); err != nil && !IsErrNotFound(err) {
+		log.Printf("ERROR: failed to release the leadership of %s: %s\n", e.name, err.Error())
+	}
+	if e.config.OnStoppedLeading != nil {
+		e.config.OnStoppedLeading()
+	}
+}
+
+func (e *LeaderElector) stopped() bool {
+	select {
+	case <-e.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newLocksBackend(locks *uniqueMemoryRepo) Backend {
+	return NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return locks, nil
+	}, nil)
+}
+
+func TestLeaderElector(t *testing.T) {
+	locks := &uniqueMemoryRepo{memoryRepo: &memoryRepo{}, key: "name"}
+	backend := newLocksBackend(locks)
+
+	started := make(chan context.Context, 1)
+	stopped := 0
+	first := NewLeaderElector(backend.Locks(), "scheduler", LeaderElectorConfig{
+		OnStartedLeading: func(ctx context.Context) { started <- ctx },
+		OnStoppedLeading: func() { stopped++ },
+	})
+	second := NewLeaderElector(backend.Locks(), "scheduler", LeaderElectorConfig{})
+
+	first.renew()
+	second.renew()
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatal("Expected only the first instance to be the leader")
+	}
+	leading := <-started
+
+	first.Resign()
+	if first.IsLeader() || stopped != 1 || leading.Err() == nil {
+		t.Fatal("Expected the leadership to be given up. Got: ", stopped, leading.Err())
+	}
+	first.renew()
+	second.renew()
+	if first.IsLeader() || !second.IsLeader() {
+		t.Fatal("Expected the second instance to take over the leadership")
+	}
+
+	// the lease is taken over by another instance
+	locks.records[0]["owner"] = "other"
+	second.renew()
+	if second.IsLeader() {
+		t.Fatal("Expected the leadership to be lost")
+	}
+}
+
+func TestLeaderElectorStartStop(t *testing.T) {
+	locks := &uniqueMemoryRepo{memoryRepo: &memoryRepo{}, key: "name"}
+	started := make(chan context.Context, 1)
+	elector := NewLeaderElector(newLocksBackend(locks).Locks(), "scheduler", LeaderElectorConfig{
+		RenewInterval:    10 * time.Millisecond,
+		OnStartedLeading: func(ctx context.Context) { started <- ctx },
+	})
+	elector.Start()
+
+	var leading context.Context
+	select {
+	case leading = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the instance to become the leader")
+	}
+	elector.Stop()
+	if elector.IsLeader() || leading.Err() == nil || len(locks.records) != 0 {
+		t.Fatal("Expected the leadership to be released. Got: ", locks.records)
+	}
+}
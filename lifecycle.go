@@ -0,0 +1,155 @@
+package backends
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TRACKER_CTX_KEY is the backend context key for the in-flight operations tracker.
+var TRACKER_CTX_KEY = "OPERATION_TRACKER"
+
+// operationTracker counts the in-flight repository operations of a backend,
+// so the backend can wait for them to finish before closing the connections.
+type operationTracker struct {
+	inFlight int
+	closing  bool
+	mutex    *sync.Mutex
+}
+
+func newOperationTracker() *operationTracker {
+	return &operationTracker{
+		mutex: &sync.Mutex{},
+	}
+}
+
+// track marks the start of an operation. Returns a function that marks the end of the operation, or
+// ErrBackendUnavailable once the backend is closing:
+// 		done, err := s.tracker.track()
+// 		if err != nil {
+// 			return nil, err
+// 		}
+// 		defer done()
+func (t *operationTracker) track() (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closing {
+		return nil, ErrBackendUnavailable("the backend is closing")
+	}
+	t.inFlight++
+
+	return func() {
+		t.mutex.Lock()
+		t.inFlight--
+		t.mutex.Unlock()
+	}, nil
+}
+
+// close rejects the new operations, so that drain waits only for the operations already in flight.
+func (t *operationTracker) close() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.closing = true
+	t.mutex.Unlock()
+}
+
+// drain waits for all in-flight operations to finish or until the context is done.
+func (t *operationTracker) drain(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		t.mutex.Lock()
+		inFlight := t.inFlight
+		t.mutex.Unlock()
+		if inFlight == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackerFromBackend returns the operations tracker of the backend, or nil if the backend does not track operations.
+func trackerFromBackend(backend Backend) *operationTracker {
+	if tracker, ok := backend.GetFromContext(TRACKER_CTX_KEY).(*operationTracker); ok {
+		return tracker
+	}
+	return nil
+}
+
+// OnShutdown registers an additional cleanup function. The cleanup functions are called
+// on Close/Shutdown in reverse order of registration (the cleanup passed to NewRepositoriesBackend
+// is called last).
+func (m *RepositoriesBackend) OnShutdown(cleanup BackendCleanup) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cleanups = append(m.cleanups, cleanup)
+}
+
+// Close rejects the new operations with ErrBackendUnavailable, waits for the in-flight operations to
+// finish (until the context is done) and then runs the cleanup functions. The cleanup functions are run
+// even if the wait times out, in which case the context error is returned.
+func (m *RepositoriesBackend) Close(ctx context.Context) error {
+	tracker := trackerFromBackend(m)
+	tracker.close()
+	err := tracker.drain(ctx)
+	m.runCleanup()
+	return err
+}
+
+func (m *RepositoriesBackend) runCleanup() {
+	m.mutex.Lock()
+	cleanups := m.cleanups
+	m.cleanups = nil
+	cleanupFn := m.cleanupFn
+	m.cleanupFn = nil
+	m.mutex.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	if cleanupFn != nil {
+		cleanupFn()
+	}
+}
+
+// Shutdown closes all backends built by the manager, in reverse order of creation.
+// Every backend waits for its in-flight operations until the context is done. All backends
+// are closed even if some of them fail to drain in time; the first error is returned.
+// The backends are removed from the manager before they are drained, so the manager is not locked while
+// waiting for the in-flight operations.
+func (m *DefaultBackendManager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	backends := []Backend{}
+	for i := len(m.backendsOrder) - 1; i >= 0; i-- {
+		backendType := m.backendsOrder[i]
+		if backend, ok := m.backends[backendType]; ok {
+			backends = append(backends, backend)
+			delete(m.backends, backendType)
+		}
+	}
+	m.backendsOrder = nil
+	m.mutex.Unlock()
+
+	var firstErr error
+	for _, backend := range backends {
+		if err := backend.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,117 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestRepositoriesBackendClose(t *testing.T) {
+	calls := []string{}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, repoBuilderFn, func() {
+		calls = append(calls, "cleanup")
+	}).(*RepositoriesBackend)
+	backend.OnShutdown(func() {
+		calls = append(calls, "first")
+	})
+	backend.OnShutdown(func() {
+		calls = append(calls, "second")
+	})
+
+	done, err := trackerFromBackend(backend).track()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := backend.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Expected the drain to time out. Got: ", err)
+	}
+	done()
+	if _, err := trackerFromBackend(backend).track(); err == nil || !IsErrBackendUnavailable(err) {
+		t.Fatal("Expected the new operations to be rejected after Close. Got: ", err)
+	}
+
+	if len(calls) != 3 || calls[0] != "second" || calls[1] != "first" || calls[2] != "cleanup" {
+		t.Fatal("Unexpected cleanup order: ", calls)
+	}
+
+	// cleanup runs only once
+	backend.Shutdown()
+	if len(calls) != 3 {
+		t.Fatal("Expected the cleanup functions to run only once")
+	}
+}
+
+func TestBackendManagerShutdown(t *testing.T) {
+	closed := 0
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"db": &config.DBInfo{},
+	})
+	manager.SupportBackend("db", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return NewRepositoriesBackend(context.Background(), dbInfo, repoBuilderFn, func() {
+			closed++
+		}), nil
+	}, map[string]interface{}{})
+
+	if _, err := manager.GetBackend("db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Fatal("Expected the backend to be closed once. Got: ", closed)
+	}
+}
+
+func TestBackendManagerShutdownUnlocked(t *testing.T) {
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"db": &config.DBInfo{},
+	})
+	manager.SupportBackend("db", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return NewRepositoriesBackend(context.Background(), dbInfo, repoBuilderFn, nil), nil
+	}, map[string]interface{}{})
+
+	backend, err := manager.GetBackend("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, _ := trackerFromBackend(backend).track()
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- manager.Shutdown(ctx)
+	}()
+
+	// wait until the backend is draining
+	for i := 0; i < 100; i++ {
+		next, err := trackerFromBackend(backend).track()
+		if err != nil {
+			break
+		}
+		next()
+		time.Sleep(time.Millisecond)
+	}
+	set := make(chan struct{})
+	go func() {
+		manager.SetBackendOptions("db", BackendOptions{})
+		close(set)
+	}()
+	select {
+	case <-set:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Expected the manager not to be locked while the backends drain")
+	}
+	cancel()
+	if err := <-shutdown; err != context.Canceled {
+		t.Fatal("Expected the drain to be canceled. Got: ", err)
+	}
+}
@@ -0,0 +1,212 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RepositoriesConfig holds the repository definitions declared in a configuration file.
+type RepositoriesConfig struct {
+	// BackendType is the backend (dbName) the repositories are defined on.
+	BackendType string
+	// Definitions maps the repository name to its definition.
+	Definitions map[string]RepositoryDefinition
+}
+
+// LoadRepositoryDefinitions builds the repository definitions from a JSON or YAML configuration.
+// The configuration can be the whole service configuration (with a "database" section) or
+// just the database section:
+// 		dbName: mongodb
+// 		collections:
+// 		  users:
+// 		    indexes: ["email", "-createdAt"]
+// 		    uniqueIndexes: ["username", "tenant,slug"]
+// 		    enableTTL: true
+// 		    TTL: 86400
+// 		    ttlAttribute: created_at
+// 		    customId: true
+// 		    timestamps: true
+// The environment variable references are expanded (see ExpandEnv).
+// The configuration is validated against the schema of the backend (see ValidateBackend) and
+// ErrInvalidInput is returned with all validation errors if it is not valid.
+// Every index is a comma separated list of fields. Properties that are not handled by the loader
+// (for example "hashKey" or "GSI") are passed to the definition as they are.
+func LoadRepositoryDefinitions(data []byte, manager BackendManager) (*RepositoriesConfig, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+
+	conf, ok := normalizeYAML(raw).(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidInput("the configuration must be an object")
+	}
+	conf, err := expandEnvConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	if database, ok := conf["database"].(map[string]interface{}); ok {
+		conf = database
+	}
+
+	backendType, ok := conf["dbName"].(string)
+	if !ok || backendType == "" {
+		return nil, ErrInvalidInput("dbName: backend type is required")
+	}
+
+	schema, err := manager.GetRequiredBackendProperties(backendType)
+	if err != nil {
+		return nil, ErrInvalidInput(fmt.Sprintf("dbName: backend %s is not supported", backendType))
+	}
+
+	collections := map[string]interface{}{}
+	if value, ok := conf["collections"]; ok {
+		// only the collections are validated, the connection properties are in the dbInfo
+		result := ValidateBackend(map[string]interface{}{"collections": value}, schema)
+		if !result.Valid {
+			return nil, ErrInvalidInput(strings.Join(result.Errors, "; "))
+		}
+		collections = value.(map[string]interface{})
+	}
+
+	config := &RepositoriesConfig{
+		BackendType: backendType,
+		Definitions: map[string]RepositoryDefinition{},
+	}
+	for _, name := range sortedKeys(collections) {
+		collection, ok := collections[name].(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidInput(fmt.Sprintf("collections.%s: expected object", name))
+		}
+		config.Definitions[name] = repositoryDefinitionFromConfig(name, collection)
+	}
+
+	return config, nil
+}
+
+// LoadRepositoryDefinitionsFile reads the repository definitions from a JSON or YAML file.
+// See LoadRepositoryDefinitions.
+func LoadRepositoryDefinitionsFile(path string, manager BackendManager) (*RepositoriesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadRepositoryDefinitions(data, manager)
+}
+
+// Define defines all repositories on the configured backend and returns them by name.
+func (c *RepositoriesConfig) Define(manager BackendManager) (map[string]Repository, error) {
+	backend, err := manager.GetBackend(c.BackendType)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := map[string]Repository{}
+	for _, name := range c.names() {
+		repository, err := backend.DefineRepository(name, c.Definitions[name])
+		if err != nil {
+			return nil, err
+		}
+		repositories[name] = repository
+	}
+	return repositories, nil
+}
+
+func (c *RepositoriesConfig) names() []string {
+	names := map[string]interface{}{}
+	for name := range c.Definitions {
+		names[name] = nil
+	}
+	return sortedKeys(names)
+}
+
+// repositoryDefinitionFromConfig maps the properties of the backend schema to the RepositoryDefinitionMap properties.
+func repositoryDefinitionFromConfig(name string, conf map[string]interface{}) RepositoryDefinitionMap {
+	def := RepositoryDefinitionMap{
+		"name": name,
+	}
+	indexes := []Index{}
+
+	for key, value := range conf {
+		switch key {
+		case "indexes":
+			indexes = append(indexes, indexesFromConfig(value, false)...)
+		case "uniqueIndexes":
+			indexes = append(indexes, indexesFromConfig(value, true)...)
+		case "enableTTL":
+			def["enableTtl"] = value
+		case "TTL":
+			def["ttl"] = configInt(value)
+		default:
+			def[key] = value
+		}
+	}
+
+	if len(indexes) > 0 {
+		def["indexes"] = indexes
+	}
+
+	return def
+}
+
+func indexesFromConfig(value interface{}, unique bool) []Index {
+	indexes := []Index{}
+	items, _ := value.([]interface{})
+	for _, item := range items {
+		fields := []string{}
+		for _, field := range strings.Split(item.(string), ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if unique {
+			indexes = append(indexes, NewUniqueIndex(fields...))
+		} else {
+			indexes = append(indexes, NewNonUniqueIndex(fields...))
+		}
+	}
+	return indexes
+}
+
+func configInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(math.Trunc(v))
+	}
+	return 0
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values decoded by the YAML parser to
+// map[string]interface{}, as decoded from JSON.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = normalizeYAML(item)
+		}
+		return result
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+	return value
+}
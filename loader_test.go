@@ -0,0 +1,183 @@
+package backends
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestLoadRepositoryDefinitionsJSON(t *testing.T) {
+	manager := NewBackendSupport(map[string]*config.DBInfo{})
+
+	conf, err := LoadRepositoryDefinitions([]byte(`{
+		"database": {
+			"dbName": "mongodb",
+			"dbInfo": {"host": "mongo:27017"},
+			"collections": {
+				"users": {
+					"indexes": ["email", "tenant, -createdAt"],
+					"uniqueIndexes": ["username"],
+					"enableTTL": true,
+					"TTL": 3600,
+					"ttlAttribute": "created_at",
+					"customId": true,
+					"timestamps": true
+				}
+			}
+		}
+	}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.BackendType != "mongodb" {
+		t.Fatalf("Expected backend type mongodb, got %s", conf.BackendType)
+	}
+
+	def, ok := conf.Definitions["users"]
+	if !ok {
+		t.Fatal("Expected users definition")
+	}
+	if def.GetName() != "users" {
+		t.Errorf("Expected name users, got %s", def.GetName())
+	}
+	if !def.EnableTTL() || def.GetTTL() != 3600 || def.GetTTLAttribute() != "created_at" {
+		t.Errorf("Unexpected TTL settings: %v %d %s", def.EnableTTL(), def.GetTTL(), def.GetTTLAttribute())
+	}
+	if !def.IsCustomID() {
+		t.Error("Expected custom ID")
+	}
+	if !def.UseTimestamps() {
+		t.Error("Expected timestamps")
+	}
+
+	indexes := def.GetIndexes()
+	if len(indexes) != 3 {
+		t.Fatalf("Expected 3 indexes, got %d", len(indexes))
+	}
+	unique := 0
+	for _, index := range indexes {
+		if index.Unique() {
+			unique++
+			if index.GetName() != "username" {
+				t.Errorf("Expected unique index on username, got %s", index.GetName())
+			}
+		}
+		if index.GetName() == "tenant_-createdAt" && len(index.GetFields()) != 2 {
+			t.Errorf("Expected compound index, got %v", index.GetFields())
+		}
+	}
+	if unique != 1 {
+		t.Errorf("Expected 1 unique index, got %d", unique)
+	}
+}
+
+func TestLoadRepositoryDefinitionsYAML(t *testing.T) {
+	manager := NewBackendSupport(map[string]*config.DBInfo{})
+
+	conf, err := LoadRepositoryDefinitions([]byte(`
+dbName: dynamodb
+collections:
+  tokens:
+    hashKey: token
+    readCapacity: 5
+    enableTTL: true
+    TTL: 86400
+    ttlAttribute: expires
+    GSI:
+      token:
+        readCapacity: 2
+    bootstrap:
+      key: [token]
+      documents:
+        - token: root
+`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := conf.Definitions["tokens"]
+	if def.GetHashKey() != "token" {
+		t.Errorf("Expected hash key token, got %s", def.GetHashKey())
+	}
+	if def.GetReadCapacity() != 5 {
+		t.Errorf("Expected read capacity 5, got %d", def.GetReadCapacity())
+	}
+	if def.GetTTL() != 86400 {
+		t.Errorf("Expected TTL 86400, got %d", def.GetTTL())
+	}
+	if _, ok := def.GetGSI()["token"].(map[string]interface{}); !ok {
+		t.Errorf("Expected GSI to be decoded as map, got %v", def.GetGSI())
+	}
+	bootstrap := def.GetBootstrap()
+	if bootstrap == nil || len(bootstrap.Documents) != 1 || bootstrap.Documents[0]["token"] != "root" {
+		t.Errorf("Unexpected bootstrap: %v", bootstrap)
+	}
+	if def.UseTimestamps() {
+		t.Error("Expected timestamps to be disabled by default")
+	}
+}
+
+func TestLoadRepositoryDefinitionsInvalid(t *testing.T) {
+	manager := NewBackendSupport(map[string]*config.DBInfo{})
+
+	for _, data := range []string{
+		`{"collections": {}}`,
+		`{"dbName": "cassandra"}`,
+		`{"dbName": "mongodb", "collections": {"users": {"TTL": "1h", "indexes": "email"}}}`,
+		`{"dbName": "mongodb", "collections": {"sessions": {"enableTTL": true, "TTL": 60}}}`,
+		`[1, 2]`,
+	} {
+		_, err := LoadRepositoryDefinitions([]byte(data), manager)
+		if err == nil {
+			t.Errorf("Expected an error for %s", data)
+			continue
+		}
+		if !IsErrInvalidInput(err) {
+			t.Errorf("Expected invalid input error, got %s", err)
+		}
+	}
+}
+
+func TestRepositoriesConfigDefine(t *testing.T) {
+	manager := &DefaultBackendManager{
+		backendBuilders: map[string]BackendBuilder{},
+		backendProps:    map[string]interface{}{},
+		backends:        map[string]Backend{},
+		dbConfig: map[string]*config.DBInfo{
+			"memory": &config.DBInfo{},
+		},
+		mutex: &sync.Mutex{},
+	}
+	manager.SupportBackend("memory", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return NewRepositoriesBackend(context.Background(), dbInfo, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+			return &memoryRepo{}, nil
+		}, func() {}), nil
+	}, map[string]interface{}{
+		"collections": map[string]interface{}{
+			"string": map[string]interface{}{
+				"indexes": "string array",
+			},
+		},
+	})
+
+	conf, err := LoadRepositoryDefinitions([]byte(`{"dbName": "memory", "collections": {"users": {}, "roles": {}}}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repositories, err := conf.Define(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repositories) != 2 {
+		t.Fatalf("Expected 2 repositories, got %d", len(repositories))
+	}
+
+	backend, _ := manager.GetBackend("memory")
+	if _, err := backend.GetRepository("roles"); err != nil {
+		t.Errorf("Expected roles to be defined: %s", err)
+	}
+}
@@ -0,0 +1,324 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// LocksCollection is the name of the collection (table) holding the locks.
+const LocksCollection = "locks"
+
+// lockPollInterval is the interval between the attempts of WaitLock.
+var lockPollInterval = 1 * time.Second
+
+// ErrLockHeld is an error class for a lock held by another owner.
+var ErrLockHeld = ErrorClass("lock held")
+
+// IsErrLockHeld checks if the error is of the ErrLockHeld class.
+func IsErrLockHeld(err error) bool {
+	return IsErrorOfType(err, ErrLockHeld(""))
+}
+
+// lockRecord is a lock in the locks collection. The record is unique by name.
+type lockRecord struct {
+	Name  string `json:"name" bson:"name"`
+	Owner string `json:"owner" bson:"owner"`
+	// ExpiresAt is the expiration time in Unix milliseconds.
+	ExpiresAt int64 `json:"expiresAt" bson:"expiresAt"`
+}
+
+// lockingRepository is implemented by the repositories that acquire the locks with a single conditional write.
+type lockingRepository interface {
+	acquireLock(name, owner string, expiresAt time.Time) (bool, error)
+	releaseLock(name, owner string) error
+}
+
+// LockManager acquires named locks held in the locks collection of a backend, so the instances of a service
+// can coordinate the jobs that must run on one instance only (migrations, cron jobs):
+//
+//	lock, err := backend.Locks().AcquireLock("daily-report", 5*time.Minute)
+//	if backends.IsErrLockHeld(err) {
+//		return nil // running on another instance
+//	}
+//	defer lock.Release()
+//
+// A lock expires after its TTL, so a crashed instance does not hold it forever. Refresh the lock to hold it
+// longer.
+type LockManager struct {
+	backend Backend
+	mutex   sync.Mutex
+	repo    Repository
+}
+
+// NewLockManager returns the lock manager keeping the locks on the backend.
+func NewLockManager(backend Backend) *LockManager {
+	return &LockManager{backend: backend}
+}
+
+// Locks returns the lock manager of the backend.
+func (m *RepositoriesBackend) Locks() *LockManager {
+	return NewLockManager(m)
+}
+
+// Locks returns the lock manager keeping the locks on the active backend.
+func (b *FailoverBackend) Locks() *LockManager {
+	return NewLockManager(b)
+}
+
+// locks returns the locks repository, defining it on the first call.
+func (l *LockManager) locks() (Repository, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.repo != nil {
+		return l.repo, nil
+	}
+	repo, err := l.backend.GetOrCreateRepository(LocksCollection, RepositoryDefinitionMap{
+		"name":          LocksCollection,
+		"indexes":       []Index{NewUniqueIndex("name")},
+		"hashKey":       "name",
+		"hashKeyType":   "S",
+		"readCapacity":  int64(1),
+		"writeCapacity": int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.repo = repo
+	return repo, nil
+}
+
+// AcquireLock acquires the lock with the name for the ttl. Returns ErrLockHeld if the lock is held by
+// another owner and has not expired.
+func (l *LockManager) AcquireLock(name string, ttl time.Duration) (*Lock, error) {
+	if name == "" || ttl <= 0 {
+		return nil, ErrInvalidInput("the lock needs a name and a ttl")
+	}
+	repo, err := l.locks()
+	if err != nil {
+		return nil, err
+	}
+	owner, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{
+		Name:  name,
+		Owner: owner.String(),
+		repo:  repo,
+	}
+	if err := lock.Refresh(ttl); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// WaitLock acquires the lock with the name for the ttl, waiting until it is released or expires, or until
+// the context is done.
+func (l *LockManager) WaitLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	for {
+		lock, err := l.AcquireLock(name, ttl)
+		if err == nil || !IsErrLockHeld(err) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Lock is an acquired lock.
+type Lock struct {
+	Name string
+	// Owner is the unique id of this holder of the lock.
+	Owner string
+	// ExpiresAt is the time the lock expires, unless refreshed.
+	ExpiresAt time.Time
+
+	repo Repository
+}
+
+// Refresh extends the lock by the ttl from now. Returns ErrLockHeld if the lock expired and was acquired
+// by another owner.
+func (l *Lock) Refresh(ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl)
+	acquired, err := acquireLock(l.repo, l.Name, l.Owner, expiresAt)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrLockHeld(fmt.Sprintf("the lock %s is held by another owner", l.Name))
+	}
+	l.ExpiresAt = expiresAt
+	return nil
+}
+
+// Release releases the lock. Returns ErrNotFound if the lock expired and is no longer held by this owner.
+func (l *Lock) Release() error {
+	return releaseLock(l.repo, l.Name, l.Owner)
+}
+
+// acquireLock acquires (or extends) the lock for the owner, if it is free, expired, or held by the owner.
+// The repositories that do not implement lockingRepository create the lock record with Save, which fails
+// for an existing name.
+func acquireLock(repo Repository, name, owner string, expiresAt time.Time) (bool, error) {
+	if r, ok := repo.(lockingRepository); ok {
+		return r.acquireLock(name, owner, expiresAt)
+	}
+
+	record := &lockRecord{Name: name, Owner: owner, ExpiresAt: lockTime(expiresAt)}
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := repo.Save(record, nil)
+		if err == nil {
+			return true, nil
+		}
+		if !IsErrAlreadyExists(err) {
+			return false, err
+		}
+
+		held := &lockRecord{}
+		if _, err := repo.GetOne(Filter{"name": name}, held); err != nil {
+			if IsErrNotFound(err) {
+				// released in the meantime
+				continue
+			}
+			return false, err
+		}
+		if held.Owner == owner {
+			_, err := repo.Save(&map[string]interface{}{"expiresAt": record.ExpiresAt}, Filter{"name": name, "owner": owner})
+			if err != nil && IsErrNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		}
+		if held.ExpiresAt >= lockTime(time.Now()) {
+			return false, nil
+		}
+		// the owner is part of the filter, so only one instance takes over the expired lock
+		if err := repo.DeleteOne(Filter{"name": name, "owner": held.Owner}); err != nil && !IsErrNotFound(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// releaseLock deletes the lock of the owner.
+func releaseLock(repo Repository, name, owner string) error {
+	if r, ok := repo.(lockingRepository); ok {
+		return r.releaseLock(name, owner)
+	}
+	return repo.DeleteOne(Filter{"name": name, "owner": owner})
+}
+
+func lockTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (r *failoverRepository) acquireLock(name, owner string, expiresAt time.Time) (bool, error) {
+	repository, err := r.active()
+	if err != nil {
+		return false, err
+	}
+	return acquireLock(repository, name, owner, expiresAt)
+}
+
+func (r *failoverRepository) releaseLock(name, owner string) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	return releaseLock(repository, name, owner)
+}
+
+// acquireLock upserts the lock with findAndModify. The lock held by another owner is not matched, and the
+// upsert fails on the unique index of the name.
+func (s *MongoSession) acquireLock(name, owner string, expiresAt time.Time) (bool, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	if err := s.checkConnected(); err != nil {
+		return false, err
+	}
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	selector := bson.M{
+		"name": name,
+		"$or": []bson.M{
+			{"owner": owner},
+			{"expiresAt": bson.M{"$lt": lockTime(time.Now())}},
+		},
+	}
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"owner": owner, "expiresAt": lockTime(expiresAt)}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+	if _, err := c.Find(selector).Apply(change, &bson.M{}); err != nil {
+		if mgo.IsDup(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MongoSession) releaseLock(name, owner string) error {
+	done, err := s.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := s.checkConnected(); err != nil {
+		return err
+	}
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	if err := c.Remove(bson.M{"name": name, "owner": owner}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrNotFound(fmt.Sprintf("the lock %s is not held by %s", name, owner))
+		}
+		return err
+	}
+	return nil
+}
+
+// acquireLock puts the lock with a condition on the owner and the expiration of the existing lock.
+func (c *DynamoCollection) acquireLock(name, owner string, expiresAt time.Time) (bool, error) {
+	item := map[string]interface{}{
+		"name":      name,
+		"owner":     owner,
+		"expiresAt": lockTime(expiresAt),
+	}
+	err := c.Table.Put(item).If("attribute_not_exists($) OR $ = ? OR $ < ?", "name", "owner", owner, "expiresAt", lockTime(time.Now())).Run()
+	if err != nil {
+		if IsConditionalCheckErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *DynamoCollection) releaseLock(name, owner string) error {
+	err := c.Table.Delete("name", name).If("$ = ?", "owner", owner).Run()
+	if err != nil {
+		if IsConditionalCheckErr(err) {
+			return ErrNotFound(fmt.Sprintf("the lock %s is not held by %s", name, owner))
+		}
+		return err
+	}
+	return nil
+}
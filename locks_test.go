@@ -0,0 +1,61 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestLocks(t *testing.T) {
+	locks := &uniqueMemoryRepo{memoryRepo: &memoryRepo{}, key: "name"}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		if def.GetName() != LocksCollection {
+			t.Fatal("Unexpected repository: ", def.GetName())
+		}
+		return locks, nil
+	}, nil)
+
+	first, err := backend.Locks().AcquireLock("report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Locks().AcquireLock("report", time.Minute); !IsErrLockHeld(err) {
+		t.Fatal("Expected ErrLockHeld. Got: ", err)
+	}
+	if err := first.Refresh(time.Hour); err != nil || time.Until(first.ExpiresAt) < 59*time.Minute {
+		t.Fatal("Expected the lock to be extended. Got: ", first.ExpiresAt, err)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := backend.Locks().AcquireLock("report", time.Minute)
+	if err != nil {
+		t.Fatal("Expected the released lock to be acquired. Got: ", err)
+	}
+	locks.records[0]["expiresAt"] = lockTime(time.Now().Add(-time.Second))
+	third, err := backend.Locks().AcquireLock("report", time.Minute)
+	if err != nil {
+		t.Fatal("Expected the expired lock to be taken over. Got: ", err)
+	}
+	if third.Owner == second.Owner || len(locks.records) != 1 {
+		t.Fatal("Expected a new owner of the lock. Got: ", locks.records)
+	}
+	if err := second.Refresh(time.Minute); !IsErrLockHeld(err) {
+		t.Fatal("Expected ErrLockHeld for the expired lock. Got: ", err)
+	}
+	if err := second.Release(); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound for the expired lock. Got: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := backend.Locks().WaitLock(ctx, "report", time.Minute); err != context.Canceled {
+		t.Fatal("Expected WaitLock to stop with the context. Got: ", err)
+	}
+	if _, err := backend.Locks().AcquireLock("report", 0); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a ttl. Got: ", err)
+	}
+}
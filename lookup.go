@@ -0,0 +1,158 @@
+package backends
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Lookup embeds the records referenced by a property of the records, fetched from another repository.
+type Lookup struct {
+	// LocalField is the property holding the ID of the referenced record, or an array of IDs.
+	LocalField string
+	// From is the repository of the referenced records. It must support GetMany (see BatchRepository).
+	From Repository
+	// ForeignField is the ID property of the referenced records. Defaults to "id".
+	ForeignField string
+	// As is the property the referenced record (or the array of the referenced records) is embedded
+	// under. Defaults to the LocalField, replacing the ID.
+	As string
+}
+
+// Hydrate embeds the records referenced by the records of the result set, as returned by GetAll. The
+// referenced records of every lookup are fetched with a single GetMany, instead of a GetOne per record.
+// For example, to embed the authors of the posts:
+//
+//	posts, err := postsRepo.GetAll(filter, &Post{}, "", "", 20, 0)
+//	hydrated, err := backends.Hydrate(posts, &backends.Lookup{LocalField: "authorId", From: usersRepo, As: "author"})
+//	// hydrated[0]["author"] is the user record, or nil if there is no such user
+//
+// An array of IDs is replaced by the array of the found records, in the same order.
+func Hydrate(results interface{}, lookups ...*Lookup) ([]map[string]interface{}, error) {
+	records := []map[string]interface{}{}
+	err := IterateOverSlice(results, func(i int, item interface{}) error {
+		record, ok := genericRecord(item)
+		if !ok {
+			var err error
+			if record, err = toAuditMap(item); err != nil {
+				return err
+			}
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lookup := range lookups {
+		if err := lookup.hydrate(records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (l *Lookup) hydrate(records []map[string]interface{}) error {
+	if l.LocalField == "" || l.From == nil {
+		return ErrInvalidInput("the lookup needs the local field and the repository")
+	}
+	foreignField := l.ForeignField
+	if foreignField == "" {
+		foreignField = "id"
+	}
+	as := l.As
+	if as == "" {
+		as = l.LocalField
+	}
+
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, record := range records {
+		for _, id := range lookupIDs(record[l.LocalField]) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	found := map[string]map[string]interface{}{}
+	if len(ids) > 0 {
+		results, err := GetMany(l.From, ids, map[string]interface{}{})
+		if err != nil {
+			return err
+		}
+		err = IterateOverSlice(results, func(i int, item interface{}) error {
+			referenced, ok := genericRecord(item)
+			if !ok {
+				var err error
+				if referenced, err = toAuditMap(item); err != nil {
+					return err
+				}
+			}
+			found[lookupID(referenced[foreignField])] = referenced
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		value, ok := record[l.LocalField]
+		if !ok || value == nil {
+			continue
+		}
+		switch value.(type) {
+		case []interface{}, []string:
+			embedded := []interface{}{}
+			for _, id := range lookupIDs(value) {
+				if referenced, ok := found[id]; ok {
+					embedded = append(embedded, referenced)
+				}
+			}
+			record[as] = embedded
+			continue
+		}
+		if referenced, ok := found[lookupID(value)]; ok {
+			record[as] = referenced
+		} else {
+			record[as] = nil
+		}
+	}
+	return nil
+}
+
+// lookupIDs returns the IDs in the value of a local field: an ID or an array of IDs.
+func lookupIDs(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		ids := []string{}
+		for _, item := range v {
+			if item != nil {
+				ids = append(ids, lookupID(item))
+			}
+		}
+		return ids
+	case []string:
+		return v
+	}
+	return []string{lookupID(value)}
+}
+
+// lookupID returns the ID as the string passed to GetMany.
+func lookupID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bson.ObjectId:
+		return v.Hex()
+	case float64:
+		// the numbers decoded from JSON
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprint(value)
+}
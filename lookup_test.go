@@ -0,0 +1,65 @@
+package backends
+
+import "testing"
+
+// batchMemoryRepo is a memoryRepo supporting GetMany, counting the calls.
+type batchMemoryRepo struct {
+	*memoryRepo
+	calls int
+}
+
+func (r *batchMemoryRepo) GetMany(ids []string, resultsTypeHint interface{}) (interface{}, error) {
+	r.calls++
+	results := []map[string]interface{}{}
+	for _, id := range ids {
+		if i := r.find(Filter{"id": id}); i >= 0 {
+			results = append(results, r.records[i])
+		}
+	}
+	return &results, nil
+}
+
+func TestHydrate(t *testing.T) {
+	users := &batchMemoryRepo{memoryRepo: &memoryRepo{records: []map[string]interface{}{
+		{"id": "u1", "name": "ann"},
+		{"id": "u2", "name": "bob"},
+	}}}
+	tags := &batchMemoryRepo{memoryRepo: &memoryRepo{records: []map[string]interface{}{
+		{"id": "t1", "label": "go"},
+		{"id": "t2", "label": "db"},
+	}}}
+	posts := &[]map[string]interface{}{
+		{"id": "1", "authorId": "u1", "tags": []interface{}{"t2", "t1"}},
+		{"id": "2", "authorId": "u1"},
+		{"id": "3", "authorId": "u3", "tags": []interface{}{"t3"}},
+		{"id": "4"},
+	}
+
+	hydrated, err := Hydrate(posts,
+		&Lookup{LocalField: "authorId", From: users, As: "author"},
+		&Lookup{LocalField: "tags", From: tags},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.calls != 1 || tags.calls != 1 {
+		t.Fatal("Expected a single GetMany per lookup. Got: ", users.calls, tags.calls)
+	}
+	if author, ok := hydrated[0]["author"].(map[string]interface{}); !ok || author["name"] != "ann" || hydrated[0]["authorId"] != "u1" {
+		t.Fatal("Expected the author to be embedded. Got: ", hydrated[0])
+	}
+	embedded, ok := hydrated[0]["tags"].([]interface{})
+	if !ok || len(embedded) != 2 || embedded[0].(map[string]interface{})["label"] != "db" {
+		t.Fatal("Expected the tags to be embedded in order. Got: ", hydrated[0]["tags"])
+	}
+	if hydrated[2]["author"] != nil || len(hydrated[2]["tags"].([]interface{})) != 0 {
+		t.Fatal("Expected the missing records to be skipped. Got: ", hydrated[2])
+	}
+	if _, ok := hydrated[3]["author"]; ok {
+		t.Fatal("Expected nothing embedded without a reference. Got: ", hydrated[3])
+	}
+
+	if _, err := Hydrate(posts, &Lookup{LocalField: "authorId", From: &memoryRepo{}}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a repository without GetMany. Got: ", err)
+	}
+}
@@ -0,0 +1,460 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// MAINTENANCE_CTX_KEY is the context key for the maintenance state of a backend.
+var MAINTENANCE_CTX_KEY = "MAINTENANCE"
+
+// ErrMaintenance is an error class for the writes rejected while the backend is in maintenance. The write
+// can be retried after the maintenance.
+var ErrMaintenance = ErrorClass("maintenance")
+
+// IsErrMaintenance checks if the error is of the ErrMaintenance class.
+func IsErrMaintenance(err error) bool {
+	return IsErrorOfType(err, ErrMaintenance(""))
+}
+
+// ErrWriteQueued is an error class for the writes recorded in the journal instead of being applied. The write
+// is applied when the journal is replayed, so it should not be retried.
+var ErrWriteQueued = ErrorClass("write queued")
+
+// IsErrWriteQueued checks if the error is of the ErrWriteQueued class.
+func IsErrWriteQueued(err error) bool {
+	return IsErrorOfType(err, ErrWriteQueued(""))
+}
+
+// MaintenanceMode defines how a backend handles the writes during maintenance.
+type MaintenanceMode string
+
+const (
+	// MaintenanceOff applies the writes. It ends the maintenance.
+	MaintenanceOff MaintenanceMode = ""
+	// MaintenanceReject rejects the writes with ErrMaintenance.
+	MaintenanceReject MaintenanceMode = "reject"
+	// MaintenanceQueue records Save, DeleteOne and DeleteAll in the journal, to be applied when the maintenance
+	// ends. They return ErrWriteQueued. The other writes are rejected with ErrMaintenance.
+	MaintenanceQueue MaintenanceMode = "queue"
+)
+
+// Operations of the journal entries.
+const (
+	JournalSave      = "save"
+	JournalDeleteOne = "deleteOne"
+	JournalDeleteAll = "deleteAll"
+)
+
+// JournalEntry is a write recorded in the journal.
+type JournalEntry struct {
+	// Sequence is the position of the entry in the journal. It is set by the journal.
+	Sequence int64 `json:"sequence"`
+	// Repository is the name of the collection or the table.
+	Repository string `json:"repository"`
+	// Operation is JournalSave, JournalDeleteOne or JournalDeleteAll.
+	Operation string                 `json:"operation"`
+	Object    map[string]interface{} `json:"object,omitempty"`
+	Filter    Filter                 `json:"filter,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// WriteJournal keeps the writes until they are applied.
+type WriteJournal interface {
+	// Append records the entry at the end of the journal and sets its sequence.
+	Append(entry *JournalEntry) error
+	// Entries returns the entries of the journal in order.
+	Entries() ([]*JournalEntry, error)
+	// Remove removes the entries up to the sequence (inclusive).
+	Remove(sequence int64) error
+}
+
+// Overflow policies of the journal, applied when an entry is added to a full journal.
+const (
+	// OverflowReject rejects the new entry with ErrMaintenance.
+	OverflowReject = "reject"
+	// OverflowDropOldest removes the oldest entry to make room for the new one.
+	OverflowDropOldest = "dropOldest"
+)
+
+// DefaultJournalSize is the number of the entries the journal of a backend keeps by default.
+const DefaultJournalSize = 1000
+
+type memoryJournal struct {
+	mutex    *sync.Mutex
+	entries  []*JournalEntry
+	size     int
+	overflow string
+	next     int64
+}
+
+// NewMemoryJournal creates a WriteJournal that keeps up to size entries in memory (DefaultJournalSize if zero),
+// with the overflow policy (OverflowReject if empty).
+func NewMemoryJournal(size int, overflow string) (WriteJournal, error) {
+	if err := validOverflow(overflow); err != nil {
+		return nil, err
+	}
+	return newMemoryJournal(size, overflow), nil
+}
+
+func newMemoryJournal(size int, overflow string) *memoryJournal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+	return &memoryJournal{
+		mutex:    &sync.Mutex{},
+		entries:  []*JournalEntry{},
+		size:     size,
+		overflow: overflow,
+	}
+}
+
+func validOverflow(overflow string) error {
+	switch overflow {
+	case "", OverflowReject, OverflowDropOldest:
+		return nil
+	}
+	return ErrInvalidInput(fmt.Sprintf("unknown overflow policy %s", overflow))
+}
+
+// Append records the entry, applying the overflow policy if the journal is full.
+func (j *memoryJournal) Append(entry *JournalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_, err := j.append(entry)
+	return err
+}
+
+// append records the entry and returns true if the oldest entry was dropped to make room for it.
+func (j *memoryJournal) append(entry *JournalEntry) (bool, error) {
+	dropped := false
+	if len(j.entries) >= j.size {
+		if j.overflow != OverflowDropOldest {
+			return false, ErrMaintenance(fmt.Sprintf("the write journal is full (%d entries)", j.size))
+		}
+		oldest := j.entries[0]
+		log.Printf("WARNING: the write journal is full, dropped the %s on %s\n", oldest.Operation, oldest.Repository)
+		j.entries = j.entries[1:]
+		dropped = true
+	}
+	j.next++
+	entry.Sequence = j.next
+	j.entries = append(j.entries, entry)
+	return dropped, nil
+}
+
+// Entries returns a copy of the entries.
+func (j *memoryJournal) Entries() ([]*JournalEntry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return append([]*JournalEntry{}, j.entries...), nil
+}
+
+// Remove removes the entries up to the sequence.
+func (j *memoryJournal) Remove(sequence int64) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.remove(sequence)
+	return nil
+}
+
+func (j *memoryJournal) remove(sequence int64) {
+	i := 0
+	for i < len(j.entries) && j.entries[i].Sequence <= sequence {
+		i++
+	}
+	j.entries = j.entries[i:]
+}
+
+// maintenanceState is the maintenance mode of a backend, shared by its repositories.
+type maintenanceState struct {
+	mutex   *sync.RWMutex
+	mode    MaintenanceMode
+	journal WriteJournal
+	// offline is set while the writes are journaled because the backend was unreachable (see the offline journal).
+	offline        bool
+	offlineJournal bool
+	conflicts      ReplayConflictHandler
+	replaying      *sync.Mutex
+}
+
+// newMaintenanceState creates the maintenance state with the offline journal of the backend context, or with
+// a memory journal. If the offline journal has entries from a previous run, the backend starts offline.
+func newMaintenanceState(ctx context.Context, options BackendOptions) *maintenanceState {
+	state := &maintenanceState{
+		mutex:     &sync.RWMutex{},
+		conflicts: options.GetReplayConflictHandler(),
+		replaying: &sync.Mutex{},
+	}
+	if journal, ok := ctx.Value(JOURNAL_CTX_KEY).(WriteJournal); ok {
+		entries, err := journal.Entries()
+		state.journal = journal
+		state.offlineJournal = true
+		state.offline = err != nil || len(entries) > 0
+		return state
+	}
+	state.journal = newMemoryJournal(options.GetInt("maintenanceJournalSize"), options.GetString("maintenanceOverflow"))
+	return state
+}
+
+// maintenanceFromBackend returns the maintenance state of the backend, or nil if the backend has none.
+func maintenanceFromBackend(backend Backend) *maintenanceState {
+	if state, ok := backend.GetFromContext(MAINTENANCE_CTX_KEY).(*maintenanceState); ok {
+		return state
+	}
+	return nil
+}
+
+type journalReplayKey struct{}
+
+// isReplay checks if the operation replays a journal entry.
+func isReplay(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(journalReplayKey{}) != nil
+}
+
+// gate checks if a Save, DeleteOne or DeleteAll can be applied. In maintenance, the write is rejected with
+// ErrMaintenance, or recorded in the journal and ErrWriteQueued is returned. While the backend is offline,
+// the writes are recorded in the journal behind the writes that failed. The writes replayed from the
+// journal are applied.
+func (m *maintenanceState) gate(ctx context.Context, repoDef RepositoryDefinition, operation string, object interface{}, filter Filter) error {
+	if m == nil || isReplay(ctx) {
+		return nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.mode == MaintenanceReject {
+		return ErrMaintenance(fmt.Sprintf("%s is in maintenance", repoDef.GetName()))
+	}
+	if m.mode == MaintenanceOff && !m.offline {
+		return nil
+	}
+	return m.queue(repoDef, operation, object, filter)
+}
+
+// queueUnreachable records the write in the offline journal if it failed because the backend is unreachable,
+// and returns ErrWriteQueued. The backend is offline until the journal is replayed. Returns nil if the write
+// is not recorded.
+func (m *maintenanceState) queueUnreachable(ctx context.Context, repoDef RepositoryDefinition, operation string, object interface{}, filter Filter, err error) error {
+	if m == nil || !m.offlineJournal || isReplay(ctx) || !isUnreachable(err) {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if queueErr := m.queue(repoDef, operation, object, filter); !IsErrWriteQueued(queueErr) {
+		log.Printf("ERROR: failed to record the %s on %s in the offline journal: %s\n", operation, repoDef.GetName(), queueErr.Error())
+		return nil
+	}
+	if !m.offline {
+		log.Printf("WARN: %s is unreachable, the writes are recorded in the offline journal: %s\n", repoDef.GetName(), err.Error())
+	}
+	m.offline = true
+	return ErrWriteQueued(fmt.Sprintf("%s is unreachable, the %s is queued", repoDef.GetName(), operation))
+}
+
+// queue records the write in the journal and returns ErrWriteQueued.
+func (m *maintenanceState) queue(repoDef RepositoryDefinition, operation string, object interface{}, filter Filter) error {
+	entry := &JournalEntry{
+		Repository: repoDef.GetName(),
+		Operation:  operation,
+		Filter:     copyFilter(filter),
+		Time:       time.Now().UTC(),
+	}
+	if object != nil {
+		payload, err := interfaceToMap(object, repoDef.GetFieldNaming())
+		if err != nil {
+			return err
+		}
+		entry.Object = *payload
+	}
+	if err := m.journal.Append(entry); err != nil {
+		return err
+	}
+	return ErrWriteQueued(fmt.Sprintf("the %s on %s is queued", operation, repoDef.GetName()))
+}
+
+// check returns ErrMaintenance for the writes that cannot be recorded in the journal.
+func (m *maintenanceState) check(repoDef RepositoryDefinition) error {
+	if m == nil {
+		return nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.mode != MaintenanceOff {
+		return ErrMaintenance(fmt.Sprintf("%s is in maintenance", repoDef.GetName()))
+	}
+	return nil
+}
+
+// MaintenanceBackend is implemented by the backends that support the maintenance mode.
+type MaintenanceBackend interface {
+	// SetMaintenance sets the maintenance mode. Setting MaintenanceOff replays the journal.
+	SetMaintenance(mode MaintenanceMode) error
+}
+
+// SetMaintenance sets the maintenance mode of the backend. When the maintenance ends (MaintenanceOff), the
+// queued writes are replayed in order, while the new writes are still queued behind them. If the backend is
+// still unreachable, the replay stops, the backend stays in maintenance and the error is returned. Entries
+// that fail with other errors are passed to the ReplayConflictHandler ("replayConflictHandler" option), or
+// logged and dropped.
+func (m *RepositoriesBackend) SetMaintenance(mode MaintenanceMode) error {
+	state := maintenanceFromBackend(m)
+	if state == nil {
+		return ErrInvalidInput("the backend does not support the maintenance mode")
+	}
+	switch mode {
+	case MaintenanceReject, MaintenanceQueue:
+		state.mutex.Lock()
+		state.mode = mode
+		state.mutex.Unlock()
+		return nil
+	case MaintenanceOff:
+	default:
+		return ErrInvalidInput(fmt.Sprintf("unknown maintenance mode %s", mode))
+	}
+
+	return m.replayJournal(state, func() {
+		state.mode = MaintenanceOff
+	})
+}
+
+// replayJournal replays the journal in order, while the new writes are still queued behind it. Once the
+// journal is empty, done is called and the backend goes online, with no write queued in between. The replay
+// stops if the backend is unreachable, or if the ReplayConflictHandler retries an entry.
+func (m *RepositoriesBackend) replayJournal(state *maintenanceState, done func()) error {
+	state.replaying.Lock()
+	defer state.replaying.Unlock()
+
+	for {
+		entries, err := state.journal.Entries()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			state.mutex.Lock()
+			// no write can be queued while the lock is held
+			entries, err = state.journal.Entries()
+			if err == nil && len(entries) == 0 {
+				done()
+				state.offline = false
+			}
+			state.mutex.Unlock()
+			if err != nil || len(entries) == 0 {
+				return err
+			}
+		}
+		for _, entry := range entries {
+			if err := m.replay(state, entry); err != nil {
+				return err
+			}
+			if err := state.journal.Remove(entry.Sequence); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// replay applies the journal entry on its repository. The failed entries are passed to the
+// ReplayConflictHandler. Returns an error if the entry should be kept in the journal.
+func (m *RepositoriesBackend) replay(state *maintenanceState, entry *JournalEntry) error {
+	repo, err := m.repositoryOf(entry.Repository)
+	if err != nil {
+		log.Printf("ERROR: failed to replay the %s on %s: %s\n", entry.Operation, entry.Repository, err.Error())
+		return nil
+	}
+	repo = WithContext(repo, context.WithValue(context.Background(), journalReplayKey{}, true))
+
+	err = replayEntry(repo, entry)
+	if err == nil || isUnreachable(err) {
+		return err
+	}
+	if state.conflicts == nil {
+		log.Printf("ERROR: failed to replay the %s on %s: %s\n", entry.Operation, entry.Repository, err.Error())
+		return nil
+	}
+	if state.conflicts(repo, entry, err) == ReplayRetry {
+		return err
+	}
+	return nil
+}
+
+// replayEntry applies the write of the journal entry.
+func replayEntry(repo Repository, entry *JournalEntry) (err error) {
+	switch entry.Operation {
+	case JournalSave:
+		object := entry.Object
+		_, err = repo.Save(&object, entry.Filter)
+	case JournalDeleteOne:
+		if err = repo.DeleteOne(entry.Filter); err != nil && IsErrNotFound(err) {
+			err = nil
+		}
+	case JournalDeleteAll:
+		if err = repo.DeleteAll(entry.Filter); err != nil && IsErrNotFound(err) {
+			err = nil
+		}
+	default:
+		err = ErrInvalidInput(fmt.Sprintf("unknown journal operation %s", entry.Operation))
+	}
+	return err
+}
+
+// repositoryOf returns the repository of the collection or the table.
+func (m *RepositoriesBackend) repositoryOf(collection string) (Repository, error) {
+	options := optionsFromBackend(m)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, def := range m.definitions {
+		if namespaceDefinition(def, options).GetName() == collection {
+			return m.repositories[name], nil
+		}
+	}
+	return nil, ErrNotFound(fmt.Sprintf("no repository for %s", collection))
+}
+
+// SetMaintenance sets the maintenance mode of both clusters.
+func (b *FailoverBackend) SetMaintenance(mode MaintenanceMode) error {
+	for _, backend := range []Backend{b.Primary(), b.Standby()} {
+		if err := SetMaintenance(backend, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaintenance sets the maintenance mode of the backend. Returns ErrInvalidInput if the backend does not
+// support the maintenance mode.
+func SetMaintenance(backend Backend, mode MaintenanceMode) error {
+	if b, ok := backend.(MaintenanceBackend); ok {
+		return b.SetMaintenance(mode)
+	}
+	return ErrInvalidInput(fmt.Sprintf("maintenance is not supported on %T", backend))
+}
+
+// SetMaintenance sets the maintenance mode of the backend, so planned database maintenance does not fail the
+// writes with server errors:
+//
+//	err := manager.SetMaintenance("mongodb", backends.MaintenanceQueue)
+//	// ... the maintenance
+//	err = manager.SetMaintenance("mongodb", backends.MaintenanceOff) // replays the queued writes
+//
+// The reads are not affected. The journal keeps up to "maintenanceJournalSize" entries (DefaultJournalSize by
+// default) in memory, and the "maintenanceOverflow" backend option sets the overflow policy.
+func (m *DefaultBackendManager) SetMaintenance(backendType string, mode MaintenanceMode) error {
+	backend, err := m.GetBackend(backendType)
+	if err != nil {
+		return err
+	}
+	if err = SetMaintenance(backend, mode); err != nil {
+		return err
+	}
+	Events.Publish(&Event{
+		Type:        EventBackendMaintenance,
+		Backend:     backendType,
+		Database:    backend.GetConfig().DatabaseName,
+		Maintenance: mode,
+	})
+	return nil
+}
@@ -0,0 +1,102 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestMemoryJournal(t *testing.T) {
+	if _, err := NewMemoryJournal(1, "never"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown overflow policy. Got: ", err)
+	}
+
+	journal, err := NewMemoryJournal(2, OverflowReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := journal.Append(&JournalEntry{Operation: JournalSave}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Append(&JournalEntry{Operation: JournalSave}); !IsErrMaintenance(err) {
+		t.Fatal("Expected ErrMaintenance on a full journal. Got: ", err)
+	}
+
+	journal, _ = NewMemoryJournal(2, OverflowDropOldest)
+	for _, operation := range []string{JournalSave, JournalDeleteOne, JournalDeleteAll} {
+		if err := journal.Append(&JournalEntry{Operation: operation}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := journal.Entries()
+	if len(entries) != 2 || entries[0].Operation != JournalDeleteOne || entries[0].Sequence != 2 {
+		t.Fatalf("Expected the oldest entry to be dropped. Got: %+v", entries)
+	}
+
+	journal.Remove(2)
+	if entries, _ = journal.Entries(); len(entries) != 1 || entries[0].Sequence != 3 {
+		t.Fatalf("Expected the entries up to the sequence to be removed. Got: %+v", entries)
+	}
+}
+
+func TestMaintenanceGate(t *testing.T) {
+	state := newMaintenanceState(context.Background(), BackendOptions{})
+	repo := &DynamoCollection{RepositoryDefinition: RepositoryDefinitionMap{"name": "users"}, maintenance: state}
+
+	state.mode = MaintenanceReject
+	if _, err := repo.Save(&map[string]interface{}{"name": "alice"}, nil); !IsErrMaintenance(err) {
+		t.Fatal("Expected ErrMaintenance. Got: ", err)
+	}
+
+	state.mode = MaintenanceQueue
+	if _, err := repo.Save(&map[string]interface{}{"name": "alice"}, nil); !IsErrWriteQueued(err) {
+		t.Fatal("Expected ErrWriteQueued. Got: ", err)
+	}
+	if err := repo.DeleteOne(Filter{"id": "1"}); !IsErrWriteQueued(err) {
+		t.Fatal("Expected ErrWriteQueued. Got: ", err)
+	}
+	if _, err := repo.PopOne(Filter{"id": "1"}, nil); !IsErrMaintenance(err) {
+		t.Fatal("Expected the atomic operations to be rejected. Got: ", err)
+	}
+
+	entries, _ := state.journal.Entries()
+	if len(entries) != 2 || entries[0].Repository != "users" || entries[0].Object["name"] != "alice" ||
+		entries[1].Operation != JournalDeleteOne || entries[1].Filter["id"] != "1" {
+		t.Fatalf("Expected the writes in the journal. Got: %+v", entries)
+	}
+}
+
+func TestSetMaintenance(t *testing.T) {
+	repo := &memoryRepo{records: []map[string]interface{}{{"id": "1", "name": "bob"}}}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return repo, nil
+	}, nil).(*RepositoriesBackend)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.SetMaintenance("later"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown mode. Got: ", err)
+	}
+	if err := backend.SetMaintenance(MaintenanceQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	state := maintenanceFromBackend(backend)
+	state.journal.Append(&JournalEntry{Repository: "users", Operation: JournalSave, Object: map[string]interface{}{"id": "2", "name": "alice"}})
+	state.journal.Append(&JournalEntry{Repository: "users", Operation: JournalDeleteOne, Filter: Filter{"id": "1"}})
+	state.journal.Append(&JournalEntry{Repository: "users", Operation: JournalDeleteOne, Filter: Filter{"id": "3"}})
+
+	if err := backend.SetMaintenance(MaintenanceOff); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.records) != 1 || repo.records[0]["name"] != "alice" {
+		t.Fatalf("Expected the journal to be replayed in order. Got: %+v", repo.records)
+	}
+	if entries, _ := state.journal.Entries(); len(entries) != 0 || state.mode != MaintenanceOff {
+		t.Fatal("Expected the maintenance to end with an empty journal")
+	}
+}
@@ -0,0 +1,382 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MigrationsCollection is the name of the collection (table) that holds the migrations state of a backend.
+const MigrationsCollection = "migrations_state"
+
+// MigrationLockTimeout is the time after which the migrations lock of a crashed instance is taken over.
+var MigrationLockTimeout = 10 * time.Minute
+
+// migrationLockPollInterval is the interval for checking if the migrations lock has been released.
+var migrationLockPollInterval = 1 * time.Second
+
+const migrationLockName = "lock"
+
+// MigrationFunc migrates the data or the structure of the repository.
+type MigrationFunc func(ctx context.Context, repo Repository) error
+
+// Migration is a versioned migration of a repository. The migrations of a repository are applied in order of
+// their versions, and every migration is applied only once.
+type Migration struct {
+	Version     int
+	Description string
+	Up          MigrationFunc
+}
+
+// migrationState is the record of the last applied migration version of a repository (or the migrations lock).
+type migrationState struct {
+	Name      string `json:"name" bson:"name"`
+	Version   int    `json:"version" bson:"version"`
+	AppliedAt int64  `json:"appliedAt" bson:"appliedAt"`
+	Owner     string `json:"owner" bson:"owner"`
+	ExpiresAt int64  `json:"expiresAt" bson:"expiresAt"`
+}
+
+// RegisterMigrations registers migrations for the repository on the given backend type.
+func (m *DefaultBackendManager) RegisterMigrations(backendType, repository string, migrations ...*Migration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.migrations == nil {
+		m.migrations = map[string]map[string][]*Migration{}
+	}
+	if _, ok := m.migrations[backendType]; !ok {
+		m.migrations[backendType] = map[string][]*Migration{}
+	}
+	m.migrations[backendType][repository] = append(m.migrations[backendType][repository], migrations...)
+}
+
+// Migrate applies the pending migrations on all backends with registered migrations. The repositories must be
+// defined on the backends before calling Migrate.
+// The migrations of a backend run while holding a lock in the migrations state collection, so when multiple
+// instances of a service start at the same time, only one of them runs the migrations while the others wait.
+func (m *DefaultBackendManager) Migrate(ctx context.Context) error {
+	m.mutex.Lock()
+	backendTypes := []string{}
+	for backendType := range m.migrations {
+		backendTypes = append(backendTypes, backendType)
+	}
+	migrations := m.migrations
+	m.mutex.Unlock()
+
+	sort.Strings(backendTypes)
+
+	for _, backendType := range backendTypes {
+		backend, err := m.GetBackend(backendType)
+		if err != nil {
+			return err
+		}
+		if err = RunMigrations(ctx, backend, migrations[backendType]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunMigrations applies the pending migrations (repository name => migrations) on the backend.
+func RunMigrations(ctx context.Context, backend Backend, migrations map[string][]*Migration) error {
+	state, err := backend.DefineRepository(MigrationsCollection, RepositoryDefinitionMap{
+		"name":          MigrationsCollection,
+		"indexes":       []Index{NewUniqueIndex("name")},
+		"hashKey":       "name",
+		"hashKeyType":   "S",
+		"readCapacity":  int64(1),
+		"writeCapacity": int64(1),
+	})
+	if err != nil {
+		return err
+	}
+
+	owner, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	lock := &migrationLock{
+		state: state,
+		owner: owner.String(),
+	}
+	if err = lock.acquire(ctx); err != nil {
+		return err
+	}
+	defer lock.release()
+
+	repositories := []string{}
+	for name := range migrations {
+		repositories = append(repositories, name)
+	}
+	sort.Strings(repositories)
+
+	for _, name := range repositories {
+		repo, err := backend.GetRepository(name)
+		if err != nil {
+			return ErrInvalidInput(fmt.Sprintf("repository %s must be defined before migrating it", name))
+		}
+		if err = migrateRepository(ctx, state, lock, name, repo, migrations[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateRepository(ctx context.Context, state Repository, lock *migrationLock, name string, repo Repository, migrations []*Migration) error {
+	sorted := append([]*Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return ErrInvalidInput(fmt.Sprintf("duplicate migration version %d for repository %s", sorted[i].Version, name))
+		}
+	}
+
+	stateName := "repository:" + name
+	current := &migrationState{}
+	_, err := state.GetOne(Filter{"name": stateName}, current)
+	exists := err == nil
+	if err != nil && !IsErrNotFound(err) {
+		return err
+	}
+
+	for _, migration := range sorted {
+		if migration.Version <= current.Version {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		log.Printf("Migrating %s to version %d: %s\n", name, migration.Version, migration.Description)
+		if err := migration.Up(ctx, repo); err != nil {
+			return ErrBackendError(fmt.Sprintf("migration %d of %s failed: %s", migration.Version, name, err.Error()))
+		}
+
+		applied := &migrationState{
+			Name:      stateName,
+			Version:   migration.Version,
+			AppliedAt: time.Now().Unix(),
+		}
+		if exists {
+			_, err = state.Save(applied, Filter{"name": stateName})
+		} else {
+			_, err = state.Save(applied, nil)
+		}
+		if err != nil {
+			return err
+		}
+		exists = true
+		current = applied
+
+		if err = lock.refresh(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrationLock is a lock record in the migrations state collection. The record is unique by name,
+// so only one instance can create it.
+type migrationLock struct {
+	state Repository
+	owner string
+}
+
+func (l *migrationLock) acquire(ctx context.Context) error {
+	for {
+		_, err := l.state.Save(&migrationState{
+			Name:      migrationLockName,
+			Owner:     l.owner,
+			ExpiresAt: time.Now().Add(MigrationLockTimeout).Unix(),
+		}, nil)
+		if err == nil {
+			return nil
+		}
+		if !IsErrAlreadyExists(err) {
+			return err
+		}
+
+		held := &migrationState{}
+		if _, err = l.state.GetOne(Filter{"name": migrationLockName}, held); err != nil {
+			if IsErrNotFound(err) {
+				// released in the meantime
+				continue
+			}
+			return err
+		}
+		if held.ExpiresAt < time.Now().Unix() {
+			log.Printf("WARN: taking over the expired migrations lock of %s\n", held.Owner)
+			if err = l.state.DeleteOne(Filter{"name": migrationLockName, "owner": held.Owner}); err != nil && !IsErrNotFound(err) {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrBackendError(fmt.Sprintf("timed out waiting for the migrations lock held by %s", held.Owner))
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+}
+
+func (l *migrationLock) refresh() error {
+	_, err := l.state.Save(&map[string]interface{}{
+		"expiresAt": time.Now().Add(MigrationLockTimeout).Unix(),
+	}, Filter{"name": migrationLockName, "owner": l.owner})
+	return err
+}
+
+func (l *migrationLock) release() {
+	if err := l.state.DeleteOne(Filter{"name": migrationLockName, "owner": l.owner}); err != nil {
+		log.Println("ERROR: failed to release the migrations lock: ", err.Error())
+	}
+}
+
+// RenameField returns a migration that renames the property in all records.
+// Supported on MongoDB and DynamoDB repositories.
+func RenameField(from, to string) MigrationFunc {
+	return func(ctx context.Context, repo Repository) error {
+		switch r := repo.(type) {
+		case *MongoSession:
+			if err := r.checkConnected(); err != nil {
+				return err
+			}
+			session, c := r.getWriteCollection()
+			defer session.Close()
+
+			_, err := c.UpdateAll(bson.M{from: bson.M{"$exists": true}}, bson.M{"$rename": bson.M{from: to}})
+			return err
+		case *DynamoCollection:
+			hashKey := r.RepositoryDefinition.GetHashKey()
+			rangeKey := r.RepositoryDefinition.GetRangeKey()
+
+			items := []map[string]interface{}{}
+			if err := r.Table.Scan().All(&items); err != nil {
+				return err
+			}
+			for _, item := range items {
+				value, ok := item[from]
+				if !ok {
+					continue
+				}
+				update := r.Table.Update(hashKey, item[hashKey])
+				if rangeKey != "" {
+					update = update.Range(rangeKey, item[rangeKey])
+				}
+				if err := update.Set(to, value).Remove(from).Run(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return ErrInvalidInput(fmt.Sprintf("renaming fields is not supported on %T", repo))
+	}
+}
+
+// Backfill returns a migration that sets the property on all records that do not have it. The value is computed
+// from the record. The records must have an "id" property.
+func Backfill(field string, value func(record map[string]interface{}) interface{}) MigrationFunc {
+	return func(ctx context.Context, repo Repository) error {
+		records, err := repo.GetAll(nil, map[string]interface{}{}, "", "", 0, 0)
+		if err != nil {
+			if IsErrNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		return IterateOverSlice(records, func(i int, item interface{}) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			record, err := toAuditMap(item)
+			if err != nil {
+				return err
+			}
+			if _, ok := record[field]; ok {
+				return nil
+			}
+			id, ok := record["id"]
+			if !ok {
+				return ErrInvalidInput("cannot backfill records without id")
+			}
+			_, err = repo.Save(&map[string]interface{}{
+				field: value(record),
+			}, Filter{"id": id})
+			return err
+		})
+	}
+}
+
+// Reindex returns a migration that drops and re-creates the indexes, for example to change the index options.
+// Supported on MongoDB repositories.
+func Reindex(indexes ...Index) MigrationFunc {
+	return func(ctx context.Context, repo Repository) error {
+		r, ok := repo.(*MongoSession)
+		if !ok {
+			return ErrInvalidInput(fmt.Sprintf("reindexing is not supported on %T", repo))
+		}
+		if err := r.checkConnected(); err != nil {
+			return err
+		}
+		session, c := r.getWriteCollection()
+		defer session.Close()
+
+		for _, index := range indexes {
+			if err := dropMongoIndex(c, index.GetFields()...); err != nil {
+				return err
+			}
+			if err := ensureMongoIndex(c, mongoIndex(index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ChangeTTL returns a migration that re-creates the TTL index on the attribute with the new expiration time.
+// Supported on MongoDB repositories.
+func ChangeTTL(attribute string, ttl time.Duration) MigrationFunc {
+	return func(ctx context.Context, repo Repository) error {
+		r, ok := repo.(*MongoSession)
+		if !ok {
+			return ErrInvalidInput(fmt.Sprintf("changing the TTL is not supported on %T", repo))
+		}
+		if err := r.checkConnected(); err != nil {
+			return err
+		}
+		session, c := r.getWriteCollection()
+		defer session.Close()
+
+		if err := dropMongoIndex(c, attribute); err != nil {
+			return err
+		}
+		return c.EnsureIndex(mgo.Index{
+			Key:         []string{attribute},
+			Background:  true,
+			Sparse:      true,
+			ExpireAfter: ttl,
+		})
+	}
+}
+
+func dropMongoIndex(c *mgo.Collection, key ...string) error {
+	err := c.DropIndex(key...)
+	if qe, ok := err.(*mgo.QueryError); ok && qe.Code == 27 {
+		// IndexNotFound
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// uniqueNameRepo is a memoryRepo with a unique "name" property, like the migrations state collection.
+type uniqueNameRepo struct {
+	*memoryRepo
+}
+
+func (r *uniqueNameRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	if filter == nil {
+		payload, err := InterfaceToMap(object)
+		if err != nil {
+			return nil, err
+		}
+		if r.find(Filter{"name": (*payload)["name"]}) >= 0 {
+			return nil, ErrAlreadyExists("duplicate name")
+		}
+	}
+	return r.memoryRepo.Save(object, filter)
+}
+
+func newMigrationsBackend(users *memoryRepo, state *uniqueNameRepo) Backend {
+	return NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		if def.GetName() == MigrationsCollection {
+			return state, nil
+		}
+		return users, nil
+	}, nil)
+}
+
+func TestMigrate(t *testing.T) {
+	users := &memoryRepo{
+		records: []map[string]interface{}{
+			{"id": "1", "name": "John"},
+			{"id": "2", "name": "Jane", "role": "admin"},
+		},
+	}
+	state := &uniqueNameRepo{&memoryRepo{}}
+	backend := newMigrationsBackend(users, state)
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"memory": &config.DBInfo{},
+	})
+	manager.SupportBackend("memory", func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		return backend, nil
+	}, map[string]interface{}{})
+
+	applied := 0
+	manager.RegisterMigrations("memory", "users",
+		&Migration{
+			Version:     2,
+			Description: "count",
+			Up: func(ctx context.Context, repo Repository) error {
+				applied++
+				return nil
+			},
+		},
+		&Migration{
+			Version:     1,
+			Description: "default role",
+			Up: Backfill("role", func(record map[string]interface{}) interface{} {
+				return "user"
+			}),
+		},
+	)
+
+	if err := manager.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if users.records[0]["role"] != "user" || users.records[1]["role"] != "admin" {
+		t.Fatal("Expected the role to be backfilled. Got: ", users.records)
+	}
+
+	// already applied
+	if err := manager.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 {
+		t.Fatal("Expected the migration to be applied once. Got: ", applied)
+	}
+
+	current := &migrationState{}
+	if _, err := state.GetOne(Filter{"name": "repository:users"}, current); err != nil || current.Version != 2 {
+		t.Fatal("Expected the state at version 2. Got: ", current, err)
+	}
+	if state.find(Filter{"name": migrationLockName}) >= 0 {
+		t.Fatal("Expected the lock to be released")
+	}
+}
+
+func TestMigrationLock(t *testing.T) {
+	state := &uniqueNameRepo{&memoryRepo{
+		records: []map[string]interface{}{
+			{"name": migrationLockName, "owner": "other", "expiresAt": time.Now().Add(time.Hour).Unix()},
+		},
+	}}
+
+	lock := &migrationLock{state: state, owner: "me"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := lock.acquire(ctx); err == nil {
+		t.Fatal("Expected to wait for the lock held by another instance")
+	}
+
+	// expired lock is taken over
+	state.records[0]["expiresAt"] = time.Now().Add(-time.Minute).Unix()
+	if err := lock.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state.records[0]["owner"] != "me" {
+		t.Fatal("Expected the lock to be taken over. Got: ", state.records)
+	}
+}
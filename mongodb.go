@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
@@ -23,30 +25,65 @@ type MongoSession struct {
 	repoDef        RepositoryDefinition
 	databaseName   string
 	collectionName string
+	readPreference ReadPreference
+	writeConcern   *WriteConcern
+	tracker        *operationTracker
+	connector      *mongoConnector
+	reportCapacity bool
+	operation      OperationOptions
+	maintenance    *maintenanceState
+	pinned         *mgo.Session
 }
 
 // GetCollection returns the collection and a session to be closed after
 func (s *MongoSession) GetCollection() (*mgo.Session, *mgo.Collection) {
-	session := s.Session.Copy()
+	if s.pinned != nil {
+		// the operations of a Session share its connection
+		session := s.pinned.Clone()
+		return session, session.DB(s.databaseName).C(s.collectionName)
+	}
+	session := s.Session
+	if s.connector != nil {
+		session = s.connector.current()
+	}
+	session = session.Copy()
+	if s.operation.Timeout > 0 {
+		session.SetSocketTimeout(s.operation.Timeout)
+	}
 	c := session.DB(s.databaseName).C(s.collectionName)
 	return session, c
 }
 
+// checkConnected returns ErrBackendUnavailable if the (lazily connected) backend is not connected yet.
+func (s *MongoSession) checkConnected() error {
+	if s.connector == nil {
+		return nil
+	}
+	_, err := s.connector.get()
+	return err
+}
+
 // MongoDBRepoBuilder builds new mongo collection.
 // If it does not exist builder will create it
 func MongoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Repository, error) {
 
+	connector, lazy := backend.GetFromContext(MONGO_CONNECTOR_CTX_KEY).(*mongoConnector)
+
 	sessionObj := backend.GetFromContext(MONGO_CTX_KEY)
-	if sessionObj == nil {
+	if sessionObj == nil && !lazy {
 		return nil, ErrBackendError("mongo session not configured")
 	}
 
 	session, ok := sessionObj.(*mgo.Session)
-	if !ok {
+	if !ok && !lazy {
 		return nil, ErrBackendError("unknown session type")
 	}
 
-	databaseName := backend.GetConfig().DatabaseName
+	// the collection may live in another database on the same cluster
+	databaseName := repoDef.GetDatabase()
+	if databaseName == "" {
+		databaseName = backend.GetConfig().DatabaseName
+	}
 	if databaseName == "" {
 		return nil, ErrBackendError("database name is missing and required")
 	}
@@ -56,54 +93,289 @@ func MongoDBRepoBuilder(repoDef RepositoryDefinition, backend Backend) (Reposito
 		return nil, ErrBackendError("collection name is missing and required")
 	}
 
-	_, err := PrepareDB(
-		session,
-		databaseName,
-		collectionName,
-		repoDef.GetIndexes(),
-		repoDef.EnableTTL(),
-		repoDef.GetTTL(),
-		repoDef.GetTTLAttribute(),
-	)
-
+	if err := validReadPreference(repoDef.GetReadPreference()); err != nil {
+		return nil, err
+	}
+	if err := validIDGenerator(repoDef.GetIDGenerator()); err != nil {
+		return nil, err
+	}
+	if err := validIDType(repoDef.GetIDType()); err != nil {
+		return nil, err
+	}
+	if err := validFieldNaming(repoDef.GetFieldNaming()); err != nil {
+		return nil, err
+	}
+	if err := validAttribution(repoDef.GetAttribution()); err != nil {
+		return nil, err
+	}
+	writeConcern, err := repoDef.GetWriteConcern()
 	if err != nil {
 		return nil, err
 	}
+	if err := validCollectionOptions(repoDef); err != nil {
+		return nil, err
+	}
 
-	return &MongoSession{
+	options := optionsFromBackend(backend)
+
+	repo := &MongoSession{
 		Session:        session,
 		repoDef:        repoDef,
 		databaseName:   databaseName,
 		collectionName: collectionName,
-	}, nil
+		readPreference: ReadPreference(repoDef.GetReadPreference()),
+		writeConcern:   writeConcern,
+		tracker:        trackerFromBackend(backend),
+		connector:      connector,
+		reportCapacity: options.GetBool("reportCapacity"),
+		maintenance:    maintenanceFromBackend(backend),
+	}
+
+	if lazy {
+		// the indexes and the bootstrap documents are created once the backend connects
+		connector.whenConnected(func(session *mgo.Session) {
+			if _, err := prepareMongoRepo(session, databaseName, collectionName, withoutCollation(repoDef, connector.Capabilities()), options); err != nil {
+				log.Printf("ERROR: failed to prepare collection %s: %s\n", collectionName, err.Error())
+				return
+			}
+			if err := ApplyBootstrap(repo, repoDef.GetBootstrap()); err != nil {
+				log.Printf("ERROR: failed to bootstrap collection %s: %s\n", collectionName, err.Error())
+			}
+		})
+		return repo, nil
+	}
+
+	if _, err := prepareMongoRepo(session, databaseName, collectionName, withoutCollation(repoDef, backend.Capabilities()), options); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
 }
 
-// MongoDBBackendBuilder returns RepositoriesBackend
+// prepareMongoRepo creates the collection (with its collection options) and the indexes. With the "reconcileIndexes" option, the existing
+// indexes are compared with the repository definition and the changed ones are rebuilt.
+func prepareMongoRepo(session *mgo.Session, databaseName, collectionName string, repoDef RepositoryDefinition, options BackendOptions) (*mgo.Collection, error) {
+	if options.GetBool("reconcileIndexes") {
+		collection := session.DB(databaseName).C(collectionName)
+		if err := ensureMongoCollection(collection.Database, collectionName, repoDef); err != nil {
+			return nil, err
+		}
+		if err := ReconcileIndexes(collection, repoDef, options.GetBool("dropStaleIndexes")); err != nil {
+			return nil, err
+		}
+		return collection, nil
+	}
+
+	return PrepareCollection(session, databaseName, repoDef)
+}
+
+// MongoDBBackendBuilder returns RepositoriesBackend.
+// With the "lazyConnect" option set, the backend is returned immediately and connects in the background,
+// retrying with exponential backoff ("reconnectInitialInterval", "reconnectMaxInterval"). Until connected,
+// the repository operations return ErrBackendUnavailable.
 func MongoDBBackendBuilder(conf *config.DBInfo, manager BackendManager) (Backend, error) {
 
-	session, err := NewSession(conf.Host, conf.Username, conf.Password, conf.DatabaseName)
+	options := manager.GetBackendOptions("mongodb")
+	if err := validOverflow(options.GetString("maintenanceOverflow")); err != nil {
+		return nil, err
+	}
+
+	// user and pass may be references to environment variables or secret files
+	credentials, err := NewSecretWatcher(options.GetDuration("credentialsRefreshInterval"), []string{conf.Username, conf.Password}, nil)
 	if err != nil {
 		return nil, err
 	}
+	resolvedConf := *conf
+	resolvedConf.Username = credentials.Values()[0]
+	resolvedConf.Password = credentials.Values()[1]
+
+	provider := options.GetCredentialsProvider()
+	if provider != nil {
+		dbCredentials, err := provider.GetCredentials()
+		if err != nil {
+			return nil, err
+		}
+		resolvedConf.Username = dbCredentials.Username
+		resolvedConf.Password = dbCredentials.Password
+	}
+
+	dialInfo, err := NewDialInfo(&resolvedConf, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connections are always dialed with the current (rotated) credentials
+	credentialsSource := newMongoCredentials(dialInfo)
+	connect := func() (*mgo.Session, *Capabilities, error) {
+		return mongoConnect(credentialsSource.dialInfo(), options)
+	}
+
+	if options.GetBool("lazyConnect") {
+		connector := newMongoConnector(
+			connect,
+			conf.DatabaseName,
+			options.GetDuration("reconnectInitialInterval"),
+			options.GetDuration("reconnectMaxInterval"),
+		)
+		watchMongoCredentials(provider, credentials, conf, credentialsSource, connector.current)
+		connector.start()
+
+		ctx := context.WithValue(context.Background(), MONGO_CONNECTOR_CTX_KEY, connector)
+		ctx = context.WithValue(ctx, OPTIONS_CTX_KEY, options)
+		ctx = context.WithValue(ctx, CAPABILITIES_CTX_KEY, connector)
+		if ctx, err = withOfflineJournal(ctx, conf, options); err != nil {
+			credentials.Stop()
+			connector.close()
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, HEALTH_CHECK_CTX_KEY, func() error {
+			session, err := connector.get()
+			if err != nil {
+				return err
+			}
+			return pingMongo(session)
+		})
+		cleanup := func() {
+			credentials.Stop()
+			connector.close()
+		}
+
+		return NewRepositoriesBackend(ctx, conf, MongoDBRepoBuilder, cleanup), nil
+	}
+
+	session, capabilities, err := connect()
+	if err != nil {
+		return nil, unwrapPermanent(err)
+	}
+
+	watchMongoCredentials(provider, credentials, conf, credentialsSource, func() *mgo.Session {
+		return session
+	})
 
 	ctx := context.WithValue(context.Background(), MONGO_CTX_KEY, session)
+	ctx = context.WithValue(ctx, OPTIONS_CTX_KEY, options)
+	ctx = context.WithValue(ctx, CAPABILITIES_CTX_KEY, capabilities)
+	if ctx, err = withOfflineJournal(ctx, conf, options); err != nil {
+		credentials.Stop()
+		session.Close()
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, HEALTH_CHECK_CTX_KEY, func() error {
+		return pingMongo(session)
+	})
 	cleanup := func() {
+		credentials.Stop()
 		session.Close()
 	}
 
 	return NewRepositoriesBackend(ctx, conf, MongoDBRepoBuilder, cleanup), nil
 }
 
+// pingMongo checks the connection on a copy of the session.
+func pingMongo(session *mgo.Session) error {
+	sessionCopy := session.Copy()
+	defer sessionCopy.Close()
+	return sessionCopy.Ping()
+}
+
+// mongoConnect dials the database, applies the backend write concern and checks the server capabilities.
+// A required feature missing on the server is a permanentError.
+func mongoConnect(dialInfo *mgo.DialInfo, options BackendOptions) (*mgo.Session, *Capabilities, error) {
+	session, err := NewSessionWithDialInfo(dialInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writeConcern, err := options.GetWriteConcern()
+	if err != nil {
+		session.Close()
+		return nil, nil, err
+	}
+	if writeConcern != nil {
+		session.SetSafe(writeConcern.ToSafe())
+	}
+
+	capabilities, err := detectMongoCapabilities(session)
+	if err != nil {
+		session.Close()
+		return nil, nil, err
+	}
+	if err = capabilities.checkRequired(options); err != nil {
+		session.Close()
+		return nil, nil, &permanentError{err}
+	}
+	logDisabledFeatures("mongodb", capabilities)
+
+	return session, capabilities, nil
+}
+
+// mongoCredentials holds the current credentials of the backend, so the connections dialed after a rotation
+// (reconnects) use the rotated credentials.
+type mongoCredentials struct {
+	info  mgo.DialInfo
+	mutex *sync.Mutex
+}
+
+func newMongoCredentials(dialInfo *mgo.DialInfo) *mongoCredentials {
+	return &mongoCredentials{
+		info:  *dialInfo,
+		mutex: &sync.Mutex{},
+	}
+}
+
+// dialInfo returns a copy of the dial info with the current credentials.
+func (c *mongoCredentials) dialInfo() *mgo.DialInfo {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	info := c.info
+	return &info
+}
+
+// rotate sets the current credentials.
+func (c *mongoCredentials) rotate(username, password string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.info.Username = username
+	c.info.Password = password
+}
+
+// watchMongoCredentials keeps the rotated credentials for the next connections and re-authenticates the
+// current session, if connected.
+func watchMongoCredentials(provider CredentialsProvider, credentials *SecretWatcher, conf *config.DBInfo, credentialsSource *mongoCredentials, currentSession func() *mgo.Session) {
+	relogin := func(username, password string) {
+		credentialsSource.rotate(username, password)
+		if session := currentSession(); session != nil {
+			mongoRelogin(session, credentialsSource.dialInfo(), username, password)
+		}
+	}
+
+	if provider != nil {
+		provider.OnRotate(func(dbCredentials *DBCredentials) {
+			relogin(dbCredentials.Username, dbCredentials.Password)
+		})
+	} else if credentials.interval > 0 && hasSecretReference(conf.Username, conf.Password) {
+		credentials.onChange = func(values []string) {
+			relogin(values[0], values[1])
+		}
+		credentials.Start()
+	}
+}
+
 // NewSession returns a new Mongo Session.
 func NewSession(Host string, Username string, Password string, Database string) (*mgo.Session, error) {
-
-	session, err := mgo.DialWithInfo(&mgo.DialInfo{
+	return NewSessionWithDialInfo(&mgo.DialInfo{
 		Addrs:    []string{Host},
 		Username: Username,
 		Password: Password,
 		Database: Database,
 		Timeout:  30 * time.Second,
 	})
+}
+
+// NewSessionWithDialInfo returns a new Mongo Session for the given dial info.
+func NewSessionWithDialInfo(dialInfo *mgo.DialInfo) (*mgo.Session, error) {
+
+	session, err := mgo.DialWithInfo(dialInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -114,24 +386,70 @@ func NewSession(Host string, Username string, Password string, Database string)
 	return session, nil
 }
 
+// mongoRelogin re-authenticates the session with the rotated credentials.
+func mongoRelogin(session *mgo.Session, dialInfo *mgo.DialInfo, username, password string) {
+	source := dialInfo.Source
+	if source == "" {
+		source = dialInfo.Database
+	}
+
+	session.LogoutAll()
+	err := session.Login(&mgo.Credential{
+		Username:    username,
+		Password:    password,
+		Source:      source,
+		Service:     dialInfo.Service,
+		ServiceHost: dialInfo.ServiceHost,
+		Mechanism:   dialInfo.Mechanism,
+	})
+	if err != nil {
+		log.Println("ERROR: failed to authenticate with the rotated credentials: ", err.Error())
+		Events.Publish(&Event{
+			Type:     EventBackendDegraded,
+			Backend:  "mongodb",
+			Database: dialInfo.Database,
+			Error:    err,
+		})
+		return
+	}
+	session.Refresh()
+	log.Println("MongoDB credentials rotated.")
+	Events.Publish(&Event{
+		Type:     EventBackendReconnected,
+		Backend:  "mongodb",
+		Database: dialInfo.Database,
+	})
+}
+
 // PrepareDB ensure presence of persistent and immutable data in the DB. It creates indexes
 func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []Index, enableTTL bool, TTL int, TTLField string) (*mgo.Collection, error) {
+	return PrepareCollection(session, db, RepositoryDefinitionMap{
+		"name":         dbCollection,
+		"indexes":      indexes,
+		"enableTtl":    enableTTL,
+		"ttl":          TTL,
+		"ttlAttribute": TTLField,
+	})
+}
+
+// PrepareCollection creates the indexes and the TTL index declared in the repository definition.
+// If the TTL index already exists with a different expiration, the expiration is updated in place.
+func PrepareCollection(session *mgo.Session, db string, repoDef RepositoryDefinition) (*mgo.Collection, error) {
 
+	dbCollection := repoDef.GetName()
 	collection := session.DB(db).C(dbCollection)
 
+	// Create the collection with the collection options
+	if err := ensureMongoCollection(collection.Database, dbCollection, repoDef); err != nil {
+		return nil, err
+	}
+
 	// Define indexes
-	for _, elem := range indexes {
-		i := elem.GetFields()
-		index := mgo.Index{
-			Key:        i,
-			Unique:     elem.Unique(),
-			DropDups:   true,
-			Background: true,
-			Sparse:     true,
-		}
+	for _, elem := range repoDef.GetIndexes() {
+		index := mongoIndex(elem)
 
 		// Create indexes
-		if err := collection.EnsureIndex(index); err != nil {
+		if err := ensureMongoIndex(collection, index); err != nil {
 			if qe, ok := err.(*mgo.QueryError); ok {
 				if qe.Code == 85 {
 					// IndexOptionsConflict - see here https://github.com/mongodb/mongo/blob/master/src/mongo/base/error_codes.err
@@ -142,29 +460,35 @@ func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []I
 				log.Println("ERROR: while creating index. of type: ", reflect.TypeOf(err), " and values: ", fmt.Sprintf("%v", err))
 				return nil, err
 			}
-		}
-	}
-
-	if enableTTL == true {
-		if TTLField == "" {
-			return nil, ErrBackendError("TTL attribute is reqired when TTL is enabled")
+			continue
 		}
 
-		if TTL == 0 {
-			return nil, ErrBackendError("TTL value is missing and must be greater than zero")
-		}
+		Events.Publish(&Event{
+			Type:       EventIndexCreated,
+			Backend:    "mongodb",
+			Database:   db,
+			Repository: dbCollection,
+			Index:      elem.GetName(),
+		})
+	}
 
-		index := mgo.Index{
-			Key:         []string{TTLField},
-			Unique:      false,
-			DropDups:    false,
-			Background:  true,
-			Sparse:      true,
-			ExpireAfter: time.Duration(TTL) * time.Second,
-		}
-		if err := collection.EnsureIndex(index); err != nil {
+	// the time-series collections expire the measurements without a TTL index
+	if repoDef.EnableTTL() && !isTimeSeries(repoDef) {
+		index, err := mongoTTLIndex(repoDef)
+		if err != nil {
 			return nil, err
 		}
+		if err := ensureMongoIndex(collection, index); err != nil {
+			qe, ok := err.(*mgo.QueryError)
+			if !ok || qe.Code != 85 {
+				return nil, err
+			}
+			// IndexOptionsConflict - the TTL has changed
+			log.Printf("Updating the TTL of %s on %s.\n", repoDef.GetTTLAttribute(), dbCollection)
+			if err = updateMongoTTL(collection, index); err != nil {
+				return nil, err
+			}
+		}
 
 	}
 
@@ -173,29 +497,38 @@ func PrepareDB(session *mgo.Session, db string, dbCollection string, indexes []I
 
 // GetOne fetches only one record for given filter
 func (s *MongoSession) GetOne(filter Filter, result interface{}) (interface{}, error) {
-	session, c := s.GetCollection()
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(s.repoDef, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, c := s.getReadCollection()
 	defer session.Close()
 
 	var record map[string]interface{}
 
-	if !s.repoDef.IsCustomID() {
-		if err := stringToObjectID(filter); err != nil {
-			return nil, err
-		}
+	if err := s.idFilter(filter, false); err != nil {
+		return nil, err
 	}
 
-	err := c.Find(filter).One(&record)
+	query, err := toMongoQuery(filter)
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			return nil, err
-		}
 		return nil, err
 	}
-	if s.repoDef.IsCustomID() {
-		record["_id"] = record["_id"].(bson.ObjectId).Hex()
-	} else {
-		record["id"] = record["_id"].(bson.ObjectId).Hex()
+	err = c.Find(query).Select(s.projection()).One(&record)
+	if err != nil {
+		return nil, mongoNotFound(err)
 	}
+	s.reportUsage("GetOne", 1, 0)
+	s.mapRecordID(record)
 
 	err = MapToInterface(&record, &result)
 	if err != nil {
@@ -206,30 +539,18 @@ func (s *MongoSession) GetOne(filter Filter, result interface{}) (interface{}, e
 }
 
 // GetAll fetches all matched records for given filter
+//
+// Deprecated: use Find, which takes a Query instead of the positional parameters.
 func (s *MongoSession) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
-	session, c := s.GetCollection()
-	defer session.Close()
-
-	resultsTypeHint = AsPtr(resultsTypeHint)
-	results := NewSliceOfType(resultsTypeHint)
-
-	// Create a pointer to a slice value and set it to the slice
-	slicePointer := reflect.New(results.Type())
-	slicePointer.Elem().Set(results)
+	results, _, err := s.Find(Query{Filter: filter, Sort: SortBy(order, sorting), Limit: limit, Offset: offset}, resultsTypeHint)
+	return results, err
+}
 
-	if !s.repoDef.IsCustomID() {
-		if id, ok := filter["id"]; ok {
-			// check if id field contains values separated by comma
-			if ok := strings.Contains(id.(string), ","); ok {
-				if err := sliceToObjectID(filter); err != nil {
-					return nil, ErrInvalidInput(err)
-				}
-			} else {
-				if err := stringToObjectID(filter); err != nil {
-					return nil, ErrInvalidInput(err)
-				}
-			}
-		}
+// findQuery returns the query of Find.
+func (s *MongoSession) findQuery(c *mgo.Collection, filter Filter, sort []SortSpec, limit int, offset int) (*mgo.Query, error) {
+	// the id may hold values separated by comma
+	if err := s.idFilter(filter, true); err != nil {
+		return nil, err
 	}
 
 	mongoFilter, err := toMongoFilter(filter)
@@ -237,12 +558,9 @@ func (s *MongoSession) GetAll(filter Filter, resultsTypeHint interface{}, order
 		return nil, ErrInvalidInput(err)
 	}
 
-	query := c.Find(mongoFilter)
-	if order != "" {
-		if sorting == "desc" {
-			order = "-" + order
-		}
-		query = query.Sort(order)
+	query := c.Find(mongoFilter).Select(s.projection())
+	if fields := mongoSort(sort); len(fields) > 0 {
+		query = query.Sort(fields...)
 	}
 	if offset != 0 {
 		query = query.Skip(offset)
@@ -250,17 +568,55 @@ func (s *MongoSession) GetAll(filter Filter, resultsTypeHint interface{}, order
 	if limit != 0 {
 		query = query.Limit(limit)
 	}
+	return query, nil
+}
 
-	err = query.All(slicePointer.Interface())
-	if err != nil {
-		if err == mgo.ErrNotFound {
-			return nil, ErrNotFound(err)
+// mongoSort returns the sort fields of the query, prefixed with "-" for descending order.
+func mongoSort(sort []SortSpec) []string {
+	fields := []string{}
+	for _, spec := range sort {
+		if spec.Property == "" {
+			continue
 		}
-		return nil, err
+		if spec.Descending {
+			fields = append(fields, "-"+spec.Property)
+		} else {
+			fields = append(fields, spec.Property)
+		}
+	}
+	return fields
+}
+
+// mapRecordID maps the _id of the record to the HEX string representation of the ObjectId,
+// or to the id of the ID type.
+func (s *MongoSession) mapRecordID(record map[string]interface{}) {
+	if s.repoDef.IsCustomID() {
+		record["_id"] = mongoIDValue(record["_id"])
+	} else {
+		record["id"] = mongoIDValue(record["_id"])
+	}
+}
+
+// mapIDs maps the _id of the records in the results to the HEX string representation of the ObjectId.
+func (s *MongoSession) mapIDs(results interface{}) error {
+	// the results read into maps are mapped without reflection
+	switch records := results.(type) {
+	case *[]*map[string]interface{}:
+		for _, record := range *records {
+			if record != nil {
+				s.mapResultID(*record)
+			}
+		}
+		return nil
+	case *[]map[string]interface{}:
+		for _, record := range *records {
+			s.mapResultID(record)
+		}
+		return nil
 	}
 
 	// results is always a Slice
-	err = IterateOverSlice(slicePointer.Interface(), func(i int, item interface{}) error {
+	return IterateOverSlice(results, func(i int, item interface{}) error {
 		if item == nil {
 			return nil // ignore
 		}
@@ -289,31 +645,90 @@ func (s *MongoSession) GetAll(filter Filter, resultsTypeHint interface{}, order
 						itemValue.SetMapIndex(reflect.ValueOf("_id"), reflect.Value{})
 					}
 
+				} else if !s.repoDef.IsCustomID() {
+					// ids of the other ID types are returned as they are
+					itemValue.SetMapIndex(reflect.ValueOf("id"), idValue)
+					itemValue.SetMapIndex(reflect.ValueOf("_id"), reflect.Value{})
 				}
 			}
 		}
 
 		return nil
 	})
+}
 
-	return slicePointer.Interface(), nil
+// mapResultID maps the _id of a record read into a map, as mapIDs.
+func (s *MongoSession) mapResultID(record map[string]interface{}) {
+	id, ok := record["_id"]
+	if !ok {
+		return
+	}
+	if bsonID, ok := id.(bson.ObjectId); ok && s.repoDef.IsCustomID() {
+		record["_id"] = bsonID.Hex()
+		return
+	}
+	if !s.repoDef.IsCustomID() {
+		record["id"] = mongoIDValue(id)
+		delete(record, "_id")
+	}
 }
 
 // Save creates new record unless it does not exist, otherwise it updates the record
 func (s *MongoSession) Save(object interface{}, filter Filter) (interface{}, error) {
-	session, c := s.GetCollection()
-	defer session.Close()
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if err := checkQueryFields(s.repoDef, filter, ""); err != nil {
+		return nil, err
+	}
+	if err := s.maintenance.gate(s.operation.Context, s.repoDef, JournalSave, object, filter); err != nil {
+		return object, err
+	}
+	journaled := copyFilter(filter)
+	result, err := s.save(object, filter)
+	if queued := s.maintenance.queueUnreachable(s.operation.Context, s.repoDef, JournalSave, object, journaled, err); queued != nil {
+		return object, queued
+	}
+	return result, err
+}
 
-	var result interface{}
+// save inserts or updates the record, once the write passed the maintenance gate.
+func (s *MongoSession) save(object interface{}, filter Filter) (interface{}, error) {
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, c := s.getWriteCollection()
+	defer session.Close()
 
-	payload, err := InterfaceToMap(object)
+	payload, err := interfaceToMap(object, s.repoDef.GetFieldNaming())
 	if err != nil {
 		return nil, err
 	}
 
+	if err := validateDocument(*payload, s.repoDef, filter == nil); err != nil {
+		return nil, err
+	}
+
+	applyTimestamps(*payload, s.repoDef, filter == nil)
+	if err := applyAttribution(*payload, s.repoDef, filter == nil, ActorFromContext(s.operation.Context)); err != nil {
+		return nil, err
+	}
+	*payload = mongoValues(*payload)
+
 	if filter == nil {
 
-		id := bson.NewObjectId()
+		if err := generateID(*payload, s.repoDef.GetIDGenerator(), "", s.nextSequence); err != nil {
+			return nil, err
+		}
+
+		id, err := s.newRecordID(*payload)
+		if err != nil {
+			return nil, err
+		}
 		(*payload)["_id"] = id
 		if !s.repoDef.IsCustomID() {
 			delete(*payload, "id")
@@ -322,13 +737,14 @@ func (s *MongoSession) Save(object interface{}, filter Filter) (interface{}, err
 		err = c.Insert(payload)
 		if err != nil {
 			if mgo.IsDup(err) {
-				return nil, ErrAlreadyExists("record already exists!")
+				return nil, mongoDuplicateKeyError(err, s.repoDef)
 			}
 			return nil, err
 		}
+		s.reportUsage("Save", 0, 1)
 
 		if !s.repoDef.IsCustomID() {
-			(*payload)["id"] = id.Hex()
+			(*payload)["id"] = mongoIDValue(id)
 		}
 		err = MapToInterface(payload, &object)
 		if err != nil {
@@ -338,10 +754,8 @@ func (s *MongoSession) Save(object interface{}, filter Filter) (interface{}, err
 		return object, nil
 	}
 
-	if !s.repoDef.IsCustomID() {
-		if err := stringToObjectID(filter); err != nil {
-			return nil, ErrInvalidInput(err)
-		}
+	if err := s.idFilter(filter, false); err != nil {
+		return nil, err
 	}
 
 	if _, ok := (*payload)["_id"]; ok {
@@ -349,19 +763,36 @@ func (s *MongoSession) Save(object interface{}, filter Filter) (interface{}, err
 		delete(*payload, "_id")
 	}
 
-	err = c.Update(filter, bson.M{"$set": payload})
+	query, err := toMongoQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	// findAndModify returns the updated record, so it is not read back
+	result, err := s.applyChange(c, query, mgo.Change{Update: bson.M{"$set": payload}, ReturnNew: true}, object)
+	if err == nil {
+		s.reportUsage("Save", 1, 1)
+	}
+	return result, err
+}
+
+// applyChange runs findAndModify with the change on the first record matched by the query, and maps
+// the returned record (the updated one for ReturnNew, otherwise the original) into the result.
+func (s *MongoSession) applyChange(c *mgo.Collection, query Filter, change mgo.Change, result interface{}) (interface{}, error) {
+	var record map[string]interface{}
+	_, err := c.Find(query).Apply(change, &record)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, ErrNotFound(err)
 		}
 		if mgo.IsDup(err) {
-			return nil, ErrAlreadyExists("record already exists!")
+			return nil, mongoDuplicateKeyError(err, s.repoDef)
 		}
 
 		return nil, err
 	}
+	s.mapRecordID(record)
 
-	result, err = s.GetOne(filter, object)
+	err = MapToInterface(&record, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -371,60 +802,230 @@ func (s *MongoSession) Save(object interface{}, filter Filter) (interface{}, err
 
 // DeleteOne deletes only one record for given filter
 func (s *MongoSession) DeleteOne(filter Filter) error {
-	session, c := s.GetCollection()
+	done, err := s.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := checkQueryFields(s.repoDef, filter, ""); err != nil {
+		return err
+	}
+	if err := s.maintenance.gate(s.operation.Context, s.repoDef, JournalDeleteOne, nil, filter); err != nil {
+		return err
+	}
+	journaled := copyFilter(filter)
+	err = s.deleteOne(filter)
+	if queued := s.maintenance.queueUnreachable(s.operation.Context, s.repoDef, JournalDeleteOne, nil, journaled, err); queued != nil {
+		return queued
+	}
+	return err
+}
+
+// deleteOne deletes the matched record, once the write passed the maintenance gate.
+func (s *MongoSession) deleteOne(filter Filter) error {
+	if err := s.checkConnected(); err != nil {
+		return err
+	}
+
+	session, c := s.getWriteCollection()
 	defer session.Close()
 
-	if !s.repoDef.IsCustomID() {
-		if err := stringToObjectID(filter); err != nil {
-			return ErrInvalidInput(err)
-		}
+	if err := s.idFilter(filter, false); err != nil {
+		return err
 	}
 
-	err := c.Remove(filter)
+	query, err := toMongoQuery(filter)
+	if err != nil {
+		return err
+	}
+	err = c.Remove(query)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return ErrNotFound(err)
 		}
 		return err
 	}
+	s.reportUsage("DeleteOne", 1, 1)
 
 	return nil
 }
 
 // DeleteAll deletes all matched records for given filter
 func (s *MongoSession) DeleteAll(filter Filter) error {
-	session, c := s.GetCollection()
+	_, err := s.DeleteAllWithOptions(filter, DeleteOptions{})
+	return err
+}
+
+// DeleteAllWithOptions deletes all matched records and returns the number of deleted records.
+// On a dry run, the matched records are counted.
+func (s *MongoSession) DeleteAllWithOptions(filter Filter, options DeleteOptions) (int, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if err := checkQueryFields(s.repoDef, filter, ""); err != nil {
+		return 0, err
+	}
+	if options.DryRun {
+		return s.deleteAll(filter, options)
+	}
+	if err := s.maintenance.gate(s.operation.Context, s.repoDef, JournalDeleteAll, nil, filter); err != nil {
+		return 0, err
+	}
+	journaled := copyFilter(filter)
+	removed, err := s.deleteAll(filter, options)
+	if queued := s.maintenance.queueUnreachable(s.operation.Context, s.repoDef, JournalDeleteAll, nil, journaled, err); queued != nil {
+		return 0, queued
+	}
+	return removed, err
+}
+
+// deleteAll deletes (or counts, on a dry run) the matched records.
+func (s *MongoSession) deleteAll(filter Filter, options DeleteOptions) (int, error) {
+	if err := s.checkConnected(); err != nil {
+		return 0, err
+	}
+
+	session, c := s.getWriteCollection()
 	defer session.Close()
 
-	if !s.repoDef.IsCustomID() {
-		if err := stringToObjectID(filter); err != nil {
-			return ErrInvalidInput(err)
-		}
+	if err := s.idFilter(filter, false); err != nil {
+		return 0, err
 	}
 
-	_, err := c.RemoveAll(filter)
+	query, err := toMongoQuery(filter)
+	if err != nil {
+		return 0, err
+	}
+	if options.DryRun {
+		return c.Find(query).Count()
+	}
+	info, err := c.RemoveAll(query)
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return ErrNotFound(err)
+			return 0, ErrNotFound(err)
 		}
-		return err
+		return 0, err
 	}
+	s.reportUsage("DeleteAll", info.Removed, info.Removed)
 
-	return nil
+	return info.Removed, nil
+}
+
+// mongoFilterSpec translates a filter specification (a pattern, ElemMatch or IsNull) to a MongoDB query.
+// Contains and Exists are MongoDB queries already. Returns false if the value is not translated.
+func mongoFilterSpec(value interface{}) (interface{}, bool, error) {
+	if pattern, ok := parsePatternFilter(value); ok {
+		return pattern.mongoRegex(), true, nil
+	}
+	if _, ok := value.(map[string]string); ok {
+		return nil, true, fmt.Errorf("unknown filter specification - supported types are $pattern, $prefix and $suffix")
+	}
+	if match, ok := filterElemMatch(value); ok {
+		elemFilter, err := toMongoFilter(match)
+		if err != nil {
+			return nil, true, err
+		}
+		return bson.M{
+			"$elemMatch": elemFilter,
+		}, true, nil
+	}
+	if null, ok := filterNull(value); ok {
+		if null {
+			return bson.M{"$type": mongoNullType}, true, nil
+		}
+		return bson.M{"$exists": true, "$not": bson.M{"$type": mongoNullType}}, true, nil
+	}
+	return nil, false, nil
+}
+
+// mongoNullType is the BSON type number of null.
+const mongoNullType = 10
+
+// mongoDateClause returns the query of a date range on the property. The dates stored as MongoDB dates
+// and as RFC3339 strings are compared separately, as MongoDB compares only values of the same type.
+func mongoDateClause(property string, dates *dateRange) (bson.M, error) {
+	dateQuery := bson.M{}
+	stringQuery := bson.M{}
+	for operator, bound := range map[string]interface{}{"$gte": dates.since, "$lte": dates.until} {
+		if bound == nil {
+			continue
+		}
+		t, err := dateBound(bound)
+		if err != nil {
+			return nil, err
+		}
+		dateQuery[operator] = t
+		stringQuery[operator] = dateString(t)
+	}
+	return bson.M{
+		"$or": []bson.M{
+			{property: dateQuery},
+			{property: stringQuery},
+		},
+	}, nil
+}
+
+// mongoNotFound returns ErrNotFound for mgo.ErrNotFound (unless RawNotFoundErrors is set), or the error as is.
+func mongoNotFound(err error) error {
+	if err == mgo.ErrNotFound && !RawNotFoundErrors {
+		return ErrNotFound(err)
+	}
+	return err
+}
+
+// toMongoQuery translates the filter specifications of the filter. Unlike in toMongoFilter, the other
+// values are always exact matches.
+func toMongoQuery(filter Filter) (Filter, error) {
+	query := Filter{}
+	dateClauses := []bson.M{}
+	for key, value := range filter {
+		if dates, ok := filterDateRange(value); ok {
+			clause, err := mongoDateClause(key, dates)
+			if err != nil {
+				return nil, ErrInvalidInput(err)
+			}
+			dateClauses = append(dateClauses, clause)
+			continue
+		}
+		spec, ok, err := mongoFilterSpec(value)
+		if err != nil {
+			return nil, ErrInvalidInput(err)
+		}
+		if ok {
+			query[key] = spec
+			continue
+		}
+		query[key] = value
+	}
+	if len(dateClauses) > 0 {
+		query["$and"] = dateClauses
+	}
+	return query, nil
 }
 
 func toMongoFilter(filter Filter) (map[string]interface{}, error) {
 	mgf := map[string]interface{}{}
+	dateClauses := []bson.M{}
 	for key, value := range filter {
-		if specs, ok := value.(map[string]string); ok {
-			if pattern, ok := specs["$pattern"]; ok {
-				mongoPattern := toMongoPattern(pattern)
-				mgf[key] = bson.M{
-					"$regex": mongoPattern,
-				}
-				continue
+		if dates, ok := filterDateRange(value); ok {
+			clause, err := mongoDateClause(key, dates)
+			if err != nil {
+				return nil, err
 			}
-			return nil, fmt.Errorf("unknown filter specification - supported type is $pattern")
+			dateClauses = append(dateClauses, clause)
+			continue
+		}
+		spec, ok, err := mongoFilterSpec(value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			mgf[key] = spec
+			continue
 		}
 		// if filter key contains multiple values to search by
 		if val, ok := value.(string); ok {
@@ -446,10 +1047,38 @@ func toMongoFilter(filter Filter) (map[string]interface{}, error) {
 		}
 		mgf[key] = value // copy over the key=>value pairs to do exact matching
 	}
+	if len(dateClauses) > 0 {
+		mgf["$and"] = dateClauses
+	}
 	return mgf, nil
 }
 
+// mongoRegex returns the $regex query of the pattern.
+func (p *patternFilter) mongoRegex() bson.M {
+	var regex string
+	switch p.kind {
+	case patternPrefix:
+		regex = "^" + regexp.QuoteMeta(p.value)
+	case patternSuffix:
+		regex = regexp.QuoteMeta(p.value) + "$"
+	default:
+		regex = toMongoRegex(p.value, !p.unanchored)
+	}
+	query := bson.M{
+		"$regex": regex,
+	}
+	if p.caseInsensitive {
+		query["$options"] = "i"
+	}
+	return query
+}
+
 func toMongoPattern(pattern string) string {
+	return toMongoRegex(pattern, true)
+}
+
+// toMongoRegex converts the pattern to a regex. Unanchored patterns match anywhere in the value.
+func toMongoRegex(pattern string, anchored bool) string {
 	mongoPattern := ""
 
 	prev := '\000'
@@ -468,7 +1097,7 @@ func toMongoPattern(pattern string) string {
 			mongoPattern += ".*"
 		}
 		if r != '\000' {
-			mongoPattern += string(r)
+			mongoPattern += regexp.QuoteMeta(string(r))
 		}
 
 		prev = r
@@ -478,6 +1107,9 @@ func toMongoPattern(pattern string) string {
 		mongoPattern += ".*"
 	}
 
+	if !anchored {
+		return mongoPattern
+	}
 	if !strings.HasPrefix(mongoPattern, ".*") {
 		mongoPattern = "^" + mongoPattern
 	}
@@ -0,0 +1,114 @@
+package backends
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Supported MongoDB authentication mechanisms (value of the "authMechanism" backend option).
+const (
+	// MongoAuthSCRAMSHA1 is the default challenge-response mechanism.
+	MongoAuthSCRAMSHA1 = "SCRAM-SHA-1"
+	// MongoAuthX509 authenticates with the TLS client certificate.
+	MongoAuthX509 = "MONGODB-X509"
+	// MongoAuthPLAIN is used for LDAP authentication.
+	MongoAuthPLAIN = "PLAIN"
+	// MongoAuthGSSAPI is used for Kerberos authentication. It needs a cgo build with the "sasl" tag and the
+	// Cyrus SASL library; in other builds the connection fails with "SASL support not enabled during build".
+	MongoAuthGSSAPI = "GSSAPI"
+)
+
+// NewDialInfo builds the mgo.DialInfo from the DB config and the additional mongodb backend options:
+//  * authMechanism - one of SCRAM-SHA-1 (default), MONGODB-X509, PLAIN (LDAP) or GSSAPI (Kerberos).
+//  * authSource - the database holding the user credentials. Defaults to "$external" for
+//    MONGODB-X509, PLAIN and GSSAPI, and to the configured database otherwise.
+//  * gssapiServiceName, gssapiServiceHost - Kerberos service name and host. GSSAPI works only in builds
+//    with the "sasl" tag (go build -tags sasl), which link the Cyrus SASL library with cgo.
+//  * tls - enables TLS connection to the server.
+//  * tlsCertificateKeyFile - PEM file with the client certificate and private key (required for MONGODB-X509).
+//  * tlsCAFile - PEM file with the CA certificates used to verify the server.
+//  * tlsInsecure - skips the server certificate verification.
+func NewDialInfo(conf *config.DBInfo, options BackendOptions) (*mgo.DialInfo, error) {
+	dialInfo := &mgo.DialInfo{
+		Addrs:    []string{conf.Host},
+		Username: conf.Username,
+		Password: conf.Password,
+		Database: conf.DatabaseName,
+		Timeout:  30 * time.Second,
+	}
+
+	mechanism := options.GetString("authMechanism")
+	switch mechanism {
+	case "", MongoAuthSCRAMSHA1:
+	case MongoAuthX509, MongoAuthPLAIN, MongoAuthGSSAPI:
+		dialInfo.Source = "$external"
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("unknown auth mechanism %s", mechanism))
+	}
+	dialInfo.Mechanism = mechanism
+
+	if authSource := options.GetString("authSource"); authSource != "" {
+		dialInfo.Source = authSource
+	}
+
+	if mechanism == MongoAuthGSSAPI {
+		dialInfo.Service = options.GetString("gssapiServiceName")
+		dialInfo.ServiceHost = options.GetString("gssapiServiceHost")
+	}
+
+	if mechanism == MongoAuthX509 && options.GetString("tlsCertificateKeyFile") == "" {
+		return nil, ErrInvalidInput("tlsCertificateKeyFile is required for MONGODB-X509 authentication")
+	}
+
+	if options.GetBool("tls") || mechanism == MongoAuthX509 {
+		tlsConfig, err := mongoTLSConfig(options)
+		if err != nil {
+			return nil, err
+		}
+		dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+	}
+
+	return dialInfo, nil
+}
+
+func mongoTLSConfig(options BackendOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: options.GetBool("tlsInsecure"),
+	}
+
+	if certFile := options.GetString("tlsCertificateKeyFile"); certFile != "" {
+		pem, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(pem, pem)
+		if err != nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid client certificate: %s", err.Error()))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile := options.GetString("tlsCAFile"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidInput("no valid CA certificates found in the tlsCAFile")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,43 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestNewDialInfo(t *testing.T) {
+	conf := &config.DBInfo{
+		Host:         "localhost:27017",
+		DatabaseName: "testdb",
+		Username:     "user",
+		Password:     "pass",
+	}
+
+	dialInfo, err := NewDialInfo(conf, BackendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialInfo.Mechanism != "" || dialInfo.Source != "" || dialInfo.DialServer != nil {
+		t.Fatal("Expected default dial info. Got: ", dialInfo)
+	}
+
+	dialInfo, err = NewDialInfo(conf, BackendOptions{
+		"authMechanism":     "GSSAPI",
+		"gssapiServiceName": "mongodb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialInfo.Source != "$external" || dialInfo.Service != "mongodb" {
+		t.Fatal("Expected GSSAPI dial info. Got: ", dialInfo)
+	}
+
+	if _, err = NewDialInfo(conf, BackendOptions{"authMechanism": "MONGODB-X509"}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input when no client certificate is given, got: ", err)
+	}
+
+	if _, err = NewDialInfo(conf, BackendOptions{"authMechanism": "SCRAM-SHA-256"}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected SCRAM-SHA-256 to be rejected, got: ", err)
+	}
+}
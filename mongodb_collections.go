@@ -0,0 +1,303 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mongoNamespaceExists is the error code of MongoDB for creating a collection that already exists.
+const mongoNamespaceExists = 48
+
+// CollectionOptions are the options of a MongoDB collection, applied when the repository is defined.
+type CollectionOptions struct {
+	// Capped creates a capped collection of MaxBytes, holding at most MaxDocs documents (if set). The oldest
+	// documents are removed when the collection is full, as in a log.
+	Capped   bool
+	MaxBytes int
+	MaxDocs  int
+	// Collation is the default collation of the collection, used by the queries and indexes without one.
+	Collation *Collation
+	// Validator is the server-side validator, a query document such as {"$jsonSchema": {...}}.
+	Validator map[string]interface{}
+	// SchemaValidator validates the documents on the server with the document schema of the repository
+	// (property "schema"). It is used if Validator is not set.
+	SchemaValidator bool
+	// ValidationLevel is "strict" (default) or "moderate" (the existing invalid documents can be updated).
+	ValidationLevel string
+	// ValidationAction is "error" (default) or "warn" (the invalid documents are saved and logged by the server).
+	ValidationAction string
+	// TimeSeries creates a time-series collection (MongoDB 5.0 or later).
+	TimeSeries *TimeSeriesOptions
+}
+
+// Granularities of the time-series collections, the typical interval between the measurements of a series.
+const (
+	GranularitySeconds = "seconds"
+	GranularityMinutes = "minutes"
+	GranularityHours   = "hours"
+)
+
+// TimeSeriesOptions are the options of a time-series collection. The measurements are stored in buckets by
+// their metadata and time, which takes much less storage and speeds up the queries by time range. The TTL
+// of the repository, if enabled, expires the measurements by the time field.
+type TimeSeriesOptions struct {
+	// TimeField is the property holding the time of the measurement (required).
+	TimeField string
+	// MetaField is the property holding the metadata identifying the series, for example the sensor.
+	MetaField string
+	// Granularity is GranularitySeconds (default), GranularityMinutes or GranularityHours.
+	Granularity string
+}
+
+// GetCollectionOptions returns the MongoDB collection options of the repository (property
+// "collectionOptions"), or nil if not set. The options can be given as *CollectionOptions, or as a map:
+//
+//	"collectionOptions": map[string]interface{}{
+//		"capped":    true,
+//		"maxBytes":  10485760,
+//		"maxDocs":   10000,
+//		"collation": map[string]interface{}{"locale": "en", "strength": 2},
+//		"validator": map[string]interface{}{"$jsonSchema": schema},
+//	}
+//
+// or, for a time-series collection:
+//
+//	"collectionOptions": map[string]interface{}{
+//		"timeSeries": map[string]interface{}{"timeField": "timestamp", "metaField": "sensor", "granularity": "minutes"},
+//	}
+func (m RepositoryDefinitionMap) GetCollectionOptions() *CollectionOptions {
+	if value, ok := m["collectionOptions"]; ok {
+		options, err := parseCollectionOptions(value)
+		if err != nil {
+			panic(err)
+		}
+		return options
+	}
+	return nil
+}
+
+func parseCollectionOptions(value interface{}) (*CollectionOptions, error) {
+	switch co := value.(type) {
+	case *CollectionOptions:
+		return co, nil
+	case CollectionOptions:
+		return &co, nil
+	case map[string]interface{}:
+		options := BackendOptions(co)
+		collectionOptions := &CollectionOptions{
+			Capped:           options.GetBool("capped"),
+			MaxBytes:         options.GetInt("maxBytes"),
+			MaxDocs:          options.GetInt("maxDocs"),
+			SchemaValidator:  options.GetBool("schemaValidator"),
+			ValidationLevel:  options.GetString("validationLevel"),
+			ValidationAction: options.GetString("validationAction"),
+		}
+		if collation, ok := co["collation"].(map[string]interface{}); ok {
+			collectionOptions.Collation = &Collation{
+				Locale:   BackendOptions(collation).GetString("locale"),
+				Strength: BackendOptions(collation).GetInt("strength"),
+			}
+		}
+		if validator, ok := co["validator"].(map[string]interface{}); ok {
+			collectionOptions.Validator = validator
+		}
+		if timeSeries, ok := co["timeSeries"].(map[string]interface{}); ok {
+			collectionOptions.TimeSeries = &TimeSeriesOptions{
+				TimeField:   BackendOptions(timeSeries).GetString("timeField"),
+				MetaField:   BackendOptions(timeSeries).GetString("metaField"),
+				Granularity: BackendOptions(timeSeries).GetString("granularity"),
+			}
+		}
+		return collectionOptions, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("invalid collection options %v", value))
+}
+
+// validCollectionOptions checks the collection options of the repository definition.
+func validCollectionOptions(repoDef RepositoryDefinition) error {
+	options := repoDef.GetCollectionOptions()
+	if options == nil {
+		return nil
+	}
+	if options.Capped && options.MaxBytes <= 0 {
+		return ErrInvalidInput("a capped collection needs maxBytes")
+	}
+	if !options.Capped && (options.MaxBytes > 0 || options.MaxDocs > 0) {
+		return ErrInvalidInput("maxBytes and maxDocs are allowed only for capped collections")
+	}
+	if options.SchemaValidator && options.Validator == nil && repoDef.GetSchema() == nil {
+		return ErrInvalidInput("schemaValidator needs the schema of the repository")
+	}
+	switch options.ValidationLevel {
+	case "", "off", "strict", "moderate":
+	default:
+		return ErrInvalidInput(fmt.Sprintf("unknown validationLevel %s", options.ValidationLevel))
+	}
+	switch options.ValidationAction {
+	case "", "error", "warn":
+	default:
+		return ErrInvalidInput(fmt.Sprintf("unknown validationAction %s", options.ValidationAction))
+	}
+	if timeSeries := options.TimeSeries; timeSeries != nil {
+		if timeSeries.TimeField == "" {
+			return ErrInvalidInput("a time-series collection needs the timeField")
+		}
+		switch timeSeries.Granularity {
+		case "", GranularitySeconds, GranularityMinutes, GranularityHours:
+		default:
+			return ErrInvalidInput(fmt.Sprintf("unknown granularity %s", timeSeries.Granularity))
+		}
+		if options.Capped {
+			return ErrInvalidInput("a time-series collection can not be capped")
+		}
+		if repoDef.EnableTTL() && (repoDef.GetTTLAttribute() != timeSeries.TimeField || repoDef.GetTTLMode() != TTLFixed) {
+			return ErrInvalidInput("the TTL of a time-series collection must be fixed, on the timeField")
+		}
+		for _, index := range repoDef.GetIndexes() {
+			if index.Unique() {
+				return ErrInvalidInput(fmt.Sprintf("the time-series collections do not support the unique index %s", index.GetName()))
+			}
+		}
+	}
+	return nil
+}
+
+// isTimeSeries checks if the repository is stored in a MongoDB time-series collection.
+func isTimeSeries(repoDef RepositoryDefinition) bool {
+	options := repoDef.GetCollectionOptions()
+	return options != nil && options.TimeSeries != nil
+}
+
+// ensureMongoCollection creates the collection with the collection options of the repository. If the
+// collection already exists, its validator is updated with the collMod command; a collection can not be
+// made capped, nor its collation changed, once it exists.
+func ensureMongoCollection(db *mgo.Database, name string, repoDef RepositoryDefinition) error {
+	options := repoDef.GetCollectionOptions()
+	if options == nil {
+		return nil
+	}
+	command := mongoCreateCommand(name, options, repoDef.GetSchema())
+	if options.TimeSeries != nil && repoDef.EnableTTL() {
+		// the time-series collections expire the measurements instead of a TTL index
+		command = append(command, bson.DocElem{Name: "expireAfterSeconds", Value: repoDef.GetTTL()})
+	}
+	err := db.Run(command, nil)
+	if qe, ok := err.(*mgo.QueryError); ok && qe.Code == mongoNamespaceExists {
+		modify := mongoCollModCommand(name, options, repoDef.GetSchema())
+		if modify == nil {
+			return nil
+		}
+		log.Printf("Updating the validator of %s.\n", name)
+		return db.Run(modify, nil)
+	}
+	return err
+}
+
+// mongoCreateCommand returns the create command of the collection.
+func mongoCreateCommand(name string, options *CollectionOptions, schema *DocumentSchema) bson.D {
+	command := bson.D{{Name: "create", Value: name}}
+	if options.Capped {
+		command = append(command, bson.DocElem{Name: "capped", Value: true}, bson.DocElem{Name: "size", Value: options.MaxBytes})
+		if options.MaxDocs > 0 {
+			command = append(command, bson.DocElem{Name: "max", Value: options.MaxDocs})
+		}
+	}
+	if timeSeries := options.TimeSeries; timeSeries != nil {
+		spec := bson.M{"timeField": timeSeries.TimeField}
+		if timeSeries.MetaField != "" {
+			spec["metaField"] = timeSeries.MetaField
+		}
+		if timeSeries.Granularity != "" {
+			spec["granularity"] = timeSeries.Granularity
+		}
+		command = append(command, bson.DocElem{Name: "timeseries", Value: spec})
+	}
+	if options.Collation != nil {
+		collation := bson.M{"locale": options.Collation.Locale}
+		if options.Collation.Strength > 0 {
+			collation["strength"] = options.Collation.Strength
+		}
+		command = append(command, bson.DocElem{Name: "collation", Value: collation})
+	}
+	return append(command, mongoValidatorOptions(options, schema)...)
+}
+
+// mongoCollModCommand returns the collMod command setting the validator of an existing collection, or nil
+// if the options have no validator.
+func mongoCollModCommand(name string, options *CollectionOptions, schema *DocumentSchema) bson.D {
+	validator := mongoValidatorOptions(options, schema)
+	if len(validator) == 0 {
+		return nil
+	}
+	return append(bson.D{{Name: "collMod", Value: name}}, validator...)
+}
+
+// mongoValidatorOptions returns the validator, validationLevel and validationAction options.
+func mongoValidatorOptions(options *CollectionOptions, schema *DocumentSchema) bson.D {
+	validator := options.Validator
+	if validator == nil && options.SchemaValidator && schema != nil {
+		validator = map[string]interface{}{"$jsonSchema": mongoJSONSchema(schema)}
+	}
+	if validator == nil {
+		return nil
+	}
+	result := bson.D{{Name: "validator", Value: validator}}
+	if options.ValidationLevel != "" {
+		result = append(result, bson.DocElem{Name: "validationLevel", Value: options.ValidationLevel})
+	}
+	if options.ValidationAction != "" {
+		result = append(result, bson.DocElem{Name: "validationAction", Value: options.ValidationAction})
+	}
+	return result
+}
+
+// mongoJSONSchema converts the document schema to the $jsonSchema of MongoDB, which has no "integer" type
+// (the integers are "int" or "long" BSON types) and no "format" keyword.
+func mongoJSONSchema(schema *DocumentSchema) map[string]interface{} {
+	result := map[string]interface{}{}
+	switch schema.Type {
+	case "":
+	case "integer":
+		result["bsonType"] = []string{"int", "long"}
+	default:
+		result["type"] = schema.Type
+	}
+	if len(schema.Properties) > 0 {
+		properties := map[string]interface{}{}
+		for name, property := range schema.Properties {
+			properties[name] = mongoJSONSchema(property)
+		}
+		result["properties"] = properties
+	}
+	if len(schema.Required) > 0 {
+		result["required"] = schema.Required
+	}
+	if schema.AdditionalProperties != nil {
+		result["additionalProperties"] = *schema.AdditionalProperties
+	}
+	if schema.Items != nil {
+		result["items"] = mongoJSONSchema(schema.Items)
+	}
+	if len(schema.Enum) > 0 {
+		result["enum"] = schema.Enum
+	}
+	if schema.Minimum != nil {
+		result["minimum"] = *schema.Minimum
+	}
+	if schema.Maximum != nil {
+		result["maximum"] = *schema.Maximum
+	}
+	if schema.MinLength != nil {
+		result["minLength"] = *schema.MinLength
+	}
+	if schema.MaxLength != nil {
+		result["maxLength"] = *schema.MaxLength
+	}
+	if schema.Pattern != "" {
+		result["pattern"] = schema.Pattern
+	}
+	return result
+}
@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGetCollectionOptions(t *testing.T) {
+	def := (&CollectionConfig{
+		CollectionOptions: map[string]interface{}{
+			"capped":          true,
+			"maxBytes":        1048576,
+			"maxDocs":         float64(1000),
+			"collation":       map[string]interface{}{"locale": "en", "strength": 2},
+			"validationLevel": "moderate",
+		},
+	}).Definition("logs")
+
+	options := def.GetCollectionOptions()
+	if options == nil || !options.Capped || options.MaxBytes != 1048576 || options.MaxDocs != 1000 {
+		t.Fatalf("Unexpected options: %+v", options)
+	}
+	if options.Collation == nil || options.Collation.Locale != "en" || options.Collation.Strength != 2 {
+		t.Fatalf("Unexpected collation: %+v", options.Collation)
+	}
+	if err := validCollectionOptions(def); err != nil {
+		t.Fatal(err)
+	}
+	if (RepositoryDefinitionMap{}).GetCollectionOptions() != nil {
+		t.Fatal("Expected no options by default")
+	}
+}
+
+func TestValidCollectionOptions(t *testing.T) {
+	invalid := []*CollectionOptions{
+		{Capped: true},
+		{MaxDocs: 10},
+		{SchemaValidator: true},
+		{Validator: map[string]interface{}{}, ValidationLevel: "loose"},
+		{Validator: map[string]interface{}{}, ValidationAction: "ignore"},
+	}
+	for _, options := range invalid {
+		if err := validCollectionOptions(RepositoryDefinitionMap{"collectionOptions": options}); !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %+v. Got: %v", options, err)
+		}
+	}
+}
+
+func TestMongoCreateCommand(t *testing.T) {
+	options := &CollectionOptions{
+		Capped:           true,
+		MaxBytes:         4096,
+		MaxDocs:          10,
+		Collation:        &Collation{Locale: "en"},
+		Validator:        map[string]interface{}{"level": bson.M{"$in": []string{"info", "error"}}},
+		ValidationAction: "warn",
+	}
+	expected := bson.D{
+		{Name: "create", Value: "logs"},
+		{Name: "capped", Value: true},
+		{Name: "size", Value: 4096},
+		{Name: "max", Value: 10},
+		{Name: "collation", Value: bson.M{"locale": "en"}},
+		{Name: "validator", Value: options.Validator},
+		{Name: "validationAction", Value: "warn"},
+	}
+	if command := mongoCreateCommand("logs", options, nil); !reflect.DeepEqual(command, expected) {
+		t.Fatalf("Expected %v, got %v", expected, command)
+	}
+
+	modify := mongoCollModCommand("logs", options, nil)
+	if len(modify) != 3 || modify[0].Name != "collMod" || modify[1].Name != "validator" {
+		t.Fatal("Expected collMod with the validator. Got: ", modify)
+	}
+	if modify := mongoCollModCommand("logs", &CollectionOptions{Capped: true, MaxBytes: 4096}, nil); modify != nil {
+		t.Fatal("Expected no collMod without a validator. Got: ", modify)
+	}
+}
+
+func TestMongoSchemaValidator(t *testing.T) {
+	minimum := 0.0
+	schema := &DocumentSchema{
+		Type:     "object",
+		Required: []string{"email"},
+		Properties: map[string]*DocumentSchema{
+			"email": {Type: "string", Format: "email"},
+			"age":   {Type: "integer", Minimum: &minimum},
+		},
+	}
+	validator := mongoValidatorOptions(&CollectionOptions{SchemaValidator: true}, schema)
+	if len(validator) != 1 {
+		t.Fatal("Expected the validator. Got: ", validator)
+	}
+	expected := map[string]interface{}{
+		"$jsonSchema": map[string]interface{}{
+			"type":     "object",
+			"required": []string{"email"},
+			"properties": map[string]interface{}{
+				"email": map[string]interface{}{"type": "string"},
+				"age":   map[string]interface{}{"bsonType": []string{"int", "long"}, "minimum": 0.0},
+			},
+		},
+	}
+	if !reflect.DeepEqual(validator[0].Value, expected) {
+		t.Fatalf("Expected %v, got %v", expected, validator[0].Value)
+	}
+}
@@ -0,0 +1,370 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mongoIndexDef is a MongoDB index with the options that mgo.Index does not support.
+type mongoIndexDef struct {
+	mgo.Index
+	partialFilter map[string]interface{}
+	collation     *Collation
+	// expireAt is set for TTL indexes on a date attribute that holds the expiration time (expireAfterSeconds=0)
+	expireAt bool
+}
+
+// needsCommand returns true if the index can be created only with the createIndexes command.
+func (d *mongoIndexDef) needsCommand() bool {
+	return d.partialFilter != nil || d.collation != nil || d.expireAt
+}
+
+// isTTL returns true for TTL indexes.
+func (d *mongoIndexDef) isTTL() bool {
+	return d.ExpireAfter > 0 || d.expireAt
+}
+
+// mongoIndex returns the MongoDB index for the index definition.
+func mongoIndex(index Index) *mongoIndexDef {
+	def := &mongoIndexDef{
+		Index: mgo.Index{
+			Key:        index.GetFields(),
+			Unique:     index.Unique(),
+			DropDups:   index.DropDups(),
+			Background: true,
+			Sparse:     index.Sparse(),
+		},
+		partialFilter: index.GetPartialFilter(),
+		collation:     index.GetCollation(),
+	}
+	// the generated names do not follow the MongoDB naming, so only explicitly set names are used
+	if name := index.GetName(); name != indexNameFromFields(index.GetFields()...) {
+		def.Name = name
+	}
+	if def.needsCommand() {
+		// partial indexes must not be sparse
+		def.Sparse = false
+		if def.Name == "" {
+			def.Name = mongoIndexName(def.Key)
+		}
+	}
+	return def
+}
+
+// mongoTTLIndex returns the MongoDB TTL index on the TTL attribute.
+func mongoTTLIndex(repoDef RepositoryDefinition) (*mongoIndexDef, error) {
+	TTLField := repoDef.GetTTLAttribute()
+	if TTLField == "" {
+		return nil, ErrBackendError("TTL attribute is reqired when TTL is enabled")
+	}
+
+	index := &mongoIndexDef{
+		Index: mgo.Index{
+			Key:        []string{TTLField},
+			Unique:     false,
+			DropDups:   false,
+			Background: true,
+			Sparse:     true,
+		},
+	}
+
+	switch repoDef.GetTTLMode() {
+	case TTLExpireAt:
+		index.expireAt = true
+		index.Name = mongoIndexName(index.Key)
+	case TTLFixed, "":
+		if repoDef.GetTTL() == 0 {
+			return nil, ErrBackendError("TTL value is missing and must be greater than zero")
+		}
+		index.ExpireAfter = time.Duration(repoDef.GetTTL()) * time.Second
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("unknown TTL mode %s", repoDef.GetTTLMode()))
+	}
+
+	return index, nil
+}
+
+// mongoIndexes returns all MongoDB indexes declared in the repository definition, including the TTL index.
+func mongoIndexes(repoDef RepositoryDefinition) ([]*mongoIndexDef, error) {
+	indexes := []*mongoIndexDef{}
+	for _, index := range repoDef.GetIndexes() {
+		indexes = append(indexes, mongoIndex(index))
+	}
+	if repoDef.EnableTTL() && !isTimeSeries(repoDef) {
+		index, err := mongoTTLIndex(repoDef)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// ensureMongoIndex creates the index if it does not exist.
+func ensureMongoIndex(collection *mgo.Collection, index *mongoIndexDef) error {
+	if !index.needsCommand() {
+		return collection.EnsureIndex(index.Index)
+	}
+
+	spec := bson.M{
+		"key":        mongoIndexKeyDoc(index.Key),
+		"name":       index.Name,
+		"background": index.Background,
+	}
+	if index.Unique {
+		spec["unique"] = true
+	}
+	if index.Sparse {
+		spec["sparse"] = true
+	}
+	if index.isTTL() {
+		spec["expireAfterSeconds"] = int(index.ExpireAfter / time.Second)
+	}
+	if index.partialFilter != nil {
+		spec["partialFilterExpression"] = index.partialFilter
+	}
+	if index.collation != nil {
+		collation := bson.M{"locale": index.collation.Locale}
+		if index.collation.Strength > 0 {
+			collation["strength"] = index.collation.Strength
+		}
+		spec["collation"] = collation
+	}
+
+	return collection.Database.Run(bson.D{
+		{Name: "createIndexes", Value: collection.Name},
+		{Name: "indexes", Value: []bson.M{spec}},
+	}, nil)
+}
+
+// updateMongoTTL changes the expiration of the existing TTL index with the collMod command.
+func updateMongoTTL(collection *mgo.Collection, index *mongoIndexDef) error {
+	return collection.Database.Run(bson.D{
+		{Name: "collMod", Value: collection.Name},
+		{Name: "index", Value: bson.M{
+			"keyPattern":         mongoIndexKeyDoc(index.Key),
+			"expireAfterSeconds": int(index.ExpireAfter / time.Second),
+		}},
+	}, nil)
+}
+
+// mongoIndexInfo is an existing index, as returned by the listIndexes command.
+type mongoIndexInfo struct {
+	Name                    string                 `bson:"name"`
+	Key                     bson.D                 `bson:"key"`
+	Unique                  bool                   `bson:"unique"`
+	Sparse                  bool                   `bson:"sparse"`
+	ExpireAfterSeconds      interface{}            `bson:"expireAfterSeconds"`
+	PartialFilterExpression map[string]interface{} `bson:"partialFilterExpression"`
+	Collation               *struct {
+		Locale   string `bson:"locale"`
+		Strength int    `bson:"strength"`
+	} `bson:"collation"`
+}
+
+// fields returns the index key in the mgo notation ("-field" for descending order).
+func (i *mongoIndexInfo) fields() []string {
+	fields := []string{}
+	for _, elem := range i.Key {
+		if fmt.Sprintf("%v", elem.Value) == "-1" {
+			fields = append(fields, "-"+elem.Name)
+			continue
+		}
+		fields = append(fields, elem.Name)
+	}
+	return fields
+}
+
+func (i *mongoIndexInfo) expireAfter() time.Duration {
+	switch seconds := i.ExpireAfterSeconds.(type) {
+	case int:
+		return time.Duration(seconds) * time.Second
+	case int32:
+		return time.Duration(seconds) * time.Second
+	case int64:
+		return time.Duration(seconds) * time.Second
+	case float64:
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// listMongoIndexes returns the existing indexes of the collection.
+func listMongoIndexes(collection *mgo.Collection) ([]*mongoIndexInfo, error) {
+	result := struct {
+		Cursor struct {
+			FirstBatch []*mongoIndexInfo `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}{}
+	err := collection.Database.Run(bson.D{
+		{Name: "listIndexes", Value: collection.Name},
+		{Name: "cursor", Value: bson.M{"batchSize": 1000}},
+	}, &result)
+	if err != nil {
+		if qe, ok := err.(*mgo.QueryError); ok && qe.Code == 26 {
+			// NamespaceNotFound - the collection does not exist yet
+			return []*mongoIndexInfo{}, nil
+		}
+		return nil, err
+	}
+	return result.Cursor.FirstBatch, nil
+}
+
+// ReconcileIndexes brings the indexes of the collection in line with the indexes declared in the repository
+// definition. Missing indexes are created, and indexes on the same fields but with different options (unique,
+// sparse, TTL, name, partial filter or collation) are dropped and rebuilt.
+// If dropStale is true, indexes that are not declared any more are dropped (the _id index is always kept).
+func ReconcileIndexes(collection *mgo.Collection, repoDef RepositoryDefinition, dropStale bool) error {
+	declared, err := mongoIndexes(repoDef)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listMongoIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	existingByKey := map[string]*mongoIndexInfo{}
+	for _, index := range existing {
+		existingByKey[mongoIndexKey(index.fields())] = index
+	}
+
+	declaredKeys := map[string]bool{}
+	for _, index := range declared {
+		key := mongoIndexKey(index.Key)
+		declaredKeys[key] = true
+
+		current, ok := existingByKey[key]
+		if ok && sameMongoIndex(current, index) {
+			continue
+		}
+		if ok && onlyTTLChanged(current, index) {
+			log.Printf("Updating the TTL of index %s on %s.\n", current.Name, collection.FullName)
+			if err = updateMongoTTL(collection, index); err != nil {
+				return err
+			}
+			continue
+		}
+		if ok {
+			log.Printf("Rebuilding index %s on %s: the index options have changed.\n", current.Name, collection.FullName)
+			if err = collection.DropIndexName(current.Name); err != nil {
+				return err
+			}
+		}
+		if err = ensureMongoIndex(collection, index); err != nil {
+			return err
+		}
+
+		Events.Publish(&Event{
+			Type:       EventIndexCreated,
+			Backend:    "mongodb",
+			Repository: collection.Name,
+			Index:      key,
+		})
+	}
+
+	if !dropStale {
+		return nil
+	}
+
+	staleKeys := []string{}
+	for key := range existingByKey {
+		if !declaredKeys[key] && existingByKey[key].Name != "_id_" {
+			staleKeys = append(staleKeys, key)
+		}
+	}
+	sort.Strings(staleKeys)
+
+	for _, key := range staleKeys {
+		index := existingByKey[key]
+		log.Printf("Dropping index %s on %s: the index is not declared.\n", index.Name, collection.FullName)
+		if err = collection.DropIndexName(index.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameMongoIndex checks if the existing index has the options of the declared index.
+// DropDups and Background are not compared, as the server does not report them.
+func sameMongoIndex(existing *mongoIndexInfo, declared *mongoIndexDef) bool {
+	if declared.Name != "" && declared.Name != existing.Name {
+		return false
+	}
+	if existing.Unique != declared.Unique ||
+		existing.Sparse != declared.Sparse ||
+		(existing.ExpireAfterSeconds != nil) != declared.isTTL() ||
+		existing.expireAfter() != declared.ExpireAfter {
+		return false
+	}
+	if !sameJSON(existing.PartialFilterExpression, declared.partialFilter) {
+		return false
+	}
+	if (existing.Collation == nil) != (declared.collation == nil) {
+		return false
+	}
+	if declared.collation != nil {
+		strength := declared.collation.Strength
+		if strength == 0 {
+			strength = 3
+		}
+		return existing.Collation.Locale == declared.collation.Locale && existing.Collation.Strength == strength
+	}
+	return true
+}
+
+// onlyTTLChanged checks if the existing TTL index differs from the declared one only in the expiration,
+// which can be updated without rebuilding the index.
+func onlyTTLChanged(existing *mongoIndexInfo, declared *mongoIndexDef) bool {
+	if existing.ExpireAfterSeconds == nil || !declared.isTTL() {
+		return false
+	}
+	updated := *existing
+	updated.ExpireAfterSeconds = int(declared.ExpireAfter / time.Second)
+	return sameMongoIndex(&updated, declared)
+}
+
+// sameJSON compares the values by their JSON representation, so the number types do not matter.
+func sameJSON(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+func mongoIndexKey(key []string) string {
+	return strings.Join(key, ",")
+}
+
+// mongoIndexKeyDoc returns the ordered key document of the index.
+func mongoIndexKeyDoc(key []string) bson.D {
+	doc := bson.D{}
+	for _, field := range key {
+		if strings.HasPrefix(field, "-") {
+			doc = append(doc, bson.DocElem{Name: field[1:], Value: -1})
+			continue
+		}
+		doc = append(doc, bson.DocElem{Name: strings.TrimPrefix(field, "+"), Value: 1})
+	}
+	return doc
+}
+
+// mongoIndexName returns the default MongoDB name of the index, for example "tenant_1_created_at_-1".
+func mongoIndexName(key []string) string {
+	parts := []string{}
+	for _, elem := range mongoIndexKeyDoc(key) {
+		parts = append(parts, fmt.Sprintf("%s_%v", elem.Name, elem.Value))
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,143 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestMongoIndexes(t *testing.T) {
+	indexes, err := mongoIndexes(RepositoryDefinitionMap{
+		"indexes": []Index{
+			NewUniqueIndex("email"),
+			NewIndexSpec("tenant", "-created_at").Named("tenant_recent"),
+			NewIndexSpec("username").AsUnique().CaseInsensitive("en").Partial(map[string]interface{}{"deleted": false}),
+		},
+		"enableTtl":    true,
+		"ttl":          60,
+		"ttlAttribute": "created_at",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 4 {
+		t.Fatal("Expected 4 indexes. Got: ", len(indexes))
+	}
+	if !indexes[0].Unique || indexes[0].Key[0] != "email" || indexes[0].Name != "" || indexes[0].needsCommand() {
+		t.Fatal("Unexpected index: ", indexes[0])
+	}
+	if indexes[1].Name != "tenant_recent" || indexes[1].Key[1] != "-created_at" {
+		t.Fatal("Unexpected named index: ", indexes[1])
+	}
+	if !indexes[2].needsCommand() || indexes[2].Name != "username_1" || indexes[2].collation.Strength != 2 || indexes[2].Sparse {
+		t.Fatal("Unexpected collation index: ", indexes[2])
+	}
+	if indexes[3].ExpireAfter != time.Minute || indexes[3].Key[0] != "created_at" {
+		t.Fatal("Unexpected TTL index: ", indexes[3])
+	}
+
+	if indexes[0].Sparse || indexes[0].DropDups {
+		t.Fatal("Expected the index not to be sparse and not to drop duplicates by default")
+	}
+	sparse := mongoIndex(NewIndexSpec("phone").AsUnique().AsSparse().WithDropDups())
+	if !sparse.Sparse || !sparse.DropDups {
+		t.Fatal("Expected a sparse index that drops duplicates. Got: ", sparse)
+	}
+
+	if _, err = mongoIndexes(RepositoryDefinitionMap{"enableTtl": true, "ttl": 60}); err == nil {
+		t.Fatal("Expected an error for missing TTL attribute")
+	}
+}
+
+func TestMongoIndexName(t *testing.T) {
+	if name := mongoIndexName([]string{"tenant", "-created_at"}); name != "tenant_1_created_at_-1" {
+		t.Fatal("Unexpected index name: ", name)
+	}
+}
+
+func TestSameMongoIndex(t *testing.T) {
+	existing := &mongoIndexInfo{
+		Name:   "email_1",
+		Key:    bson.D{{Name: "email", Value: 1}},
+		Unique: true,
+		Sparse: true,
+	}
+	declared := func(index mgo.Index) *mongoIndexDef {
+		return &mongoIndexDef{Index: index}
+	}
+
+	if !sameMongoIndex(existing, declared(mgo.Index{Key: []string{"email"}, Unique: true, Sparse: true, DropDups: true})) {
+		t.Fatal("Expected the indexes to match")
+	}
+	if sameMongoIndex(existing, declared(mgo.Index{Key: []string{"email"}, Unique: false, Sparse: true})) {
+		t.Fatal("Expected the change of uniqueness to be detected")
+	}
+	if sameMongoIndex(existing, declared(mgo.Index{Key: []string{"email"}, Unique: true, Sparse: true, ExpireAfter: time.Hour})) {
+		t.Fatal("Expected the change of TTL to be detected")
+	}
+	if sameMongoIndex(existing, declared(mgo.Index{Name: "email_ci", Key: []string{"email"}, Unique: true, Sparse: true})) {
+		t.Fatal("Expected the change of name to be detected")
+	}
+
+	caseInsensitive := mongoIndex(NewIndexSpec("email").AsUnique().CaseInsensitive("en"))
+	if sameMongoIndex(existing, caseInsensitive) {
+		t.Fatal("Expected the change of collation to be detected")
+	}
+
+	existing.Sparse = false
+	existing.Collation = &struct {
+		Locale   string `bson:"locale"`
+		Strength int    `bson:"strength"`
+	}{"en", 2}
+	existing.PartialFilterExpression = map[string]interface{}{"deleted": false}
+	if sameMongoIndex(existing, caseInsensitive) {
+		t.Fatal("Expected the change of partial filter to be detected")
+	}
+	if !sameMongoIndex(existing, mongoIndex(NewIndexSpec("email").AsUnique().CaseInsensitive("en").Partial(map[string]interface{}{"deleted": false}))) {
+		t.Fatal("Expected the indexes to match")
+	}
+
+	if fields := existing.fields(); len(fields) != 1 || fields[0] != "email" {
+		t.Fatal("Unexpected fields: ", fields)
+	}
+}
+
+func TestMongoTTLIndex(t *testing.T) {
+	index, err := mongoTTLIndex(RepositoryDefinitionMap{
+		"enableTtl":    true,
+		"ttlMode":      TTLExpireAt,
+		"ttlAttribute": "expires_at",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !index.isTTL() || !index.needsCommand() || index.ExpireAfter != 0 || index.Name != "expires_at_1" {
+		t.Fatal("Unexpected expireAt TTL index: ", index)
+	}
+
+	if _, err = mongoTTLIndex(RepositoryDefinitionMap{"ttlMode": "sometimes", "ttlAttribute": "expires_at"}); err == nil {
+		t.Fatal("Expected an error for unknown TTL mode")
+	}
+
+	existing := &mongoIndexInfo{
+		Name:               "created_at_1",
+		Key:                bson.D{{Name: "created_at", Value: 1}},
+		Sparse:             true,
+		ExpireAfterSeconds: 3600,
+	}
+	fixed, _ := mongoTTLIndex(RepositoryDefinitionMap{"ttl": 60, "ttlAttribute": "created_at"})
+	if sameMongoIndex(existing, fixed) || !onlyTTLChanged(existing, fixed) {
+		t.Fatal("Expected only the TTL to be changed")
+	}
+
+	existing.Unique = true
+	if onlyTTLChanged(existing, fixed) {
+		t.Fatal("Expected the index to be rebuilt when other options change")
+	}
+
+	if sameMongoIndex(&mongoIndexInfo{Name: "created_at_1", Key: bson.D{{Name: "created_at", Value: 1}}, Sparse: true}, fixed) {
+		t.Fatal("Expected a missing TTL to be detected")
+	}
+}
@@ -1,10 +1,15 @@
 package backends
 
 import (
+	"fmt"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestToMongoPattern(t *testing.T) {
@@ -45,6 +50,111 @@ func TestToMongoPattern(t *testing.T) {
 
 }
 
+func TestToMongoFilterPatternOptions(t *testing.T) {
+	filter := NewFilter().
+		MatchPatternWith("name", "jo%n", PatternOptions{CaseInsensitive: true, Unanchored: true}).
+		MatchPrefix("code", "a.b%").
+		MatchSuffix("email", "@example.com").
+		MatchPattern("version", "1.%")
+
+	mongoFilter, err := toMongoFilter(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":    bson.M{"$regex": "jo.*n", "$options": "i"},
+		"code":    bson.M{"$regex": `^a\.b%`},
+		"email":   bson.M{"$regex": `@example\.com$`},
+		"version": bson.M{"$regex": `^1\..*`},
+	}
+	if !reflect.DeepEqual(mongoFilter, expected) {
+		t.Fatalf("Expected %v, got %v", expected, mongoFilter)
+	}
+
+	if _, err := toMongoFilter(Filter{"name": map[string]string{"$unknown": "x"}}); err == nil {
+		t.Fatal("Expected an error for an unknown filter specification")
+	}
+}
+
+func TestToMongoQueryNullFilters(t *testing.T) {
+	filter := NewFilter().
+		Exists("deletedAt", false).
+		IsNull("manager", true).
+		IsNull("email", false).
+		Match("tags", "a,b")
+
+	query, err := toMongoQuery(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Filter{
+		"deletedAt": map[string]interface{}{"$exists": false},
+		"manager":   bson.M{"$type": mongoNullType},
+		"email":     bson.M{"$exists": true, "$not": bson.M{"$type": mongoNullType}},
+		"tags":      "a,b",
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("Expected %v, got %v", expected, query)
+	}
+}
+
+func TestToMongoQueryDateRange(t *testing.T) {
+	since := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	query, err := toMongoQuery(NewFilter().Since("createdAt", since).Match("active", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Filter{
+		"active": true,
+		"$and": []bson.M{{
+			"$or": []bson.M{
+				{"createdAt": bson.M{"$gte": since}},
+				{"createdAt": bson.M{"$gte": "2019-05-01T00:00:00Z"}},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(query, expected) {
+		t.Fatalf("Expected %v, got %v", expected, query)
+	}
+
+	if _, err := toMongoQuery(Filter{"createdAt": map[string]interface{}{"$since": "yesterday"}}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid date, got ", err)
+	}
+}
+
+func TestToMongoFilterArrayFilters(t *testing.T) {
+	filter := NewFilter().
+		Contains("tags", "go", "aws").
+		ElemMatch("roles", NewFilter().Match("name", "admin").MatchPattern("scope", "bill%"))
+
+	mongoFilter, err := toMongoFilter(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"tags": map[string]interface{}{"$all": []interface{}{"go", "aws"}},
+		"roles": bson.M{"$elemMatch": map[string]interface{}{
+			"name":  "admin",
+			"scope": bson.M{"$regex": "^bill.*"},
+		}},
+	}
+	if !reflect.DeepEqual(mongoFilter, expected) {
+		t.Fatalf("Expected %v, got %v", expected, mongoFilter)
+	}
+}
+
+func TestMongoNotFound(t *testing.T) {
+	if err := mongoNotFound(mgo.ErrNotFound); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound, got: ", err)
+	}
+
+	RawNotFoundErrors = true
+	defer func() { RawNotFoundErrors = false }()
+	if err := mongoNotFound(mgo.ErrNotFound); err != mgo.ErrNotFound {
+		t.Fatal("Expected mgo.ErrNotFound, got: ", err)
+	}
+}
+
 type TestEntry struct {
 	ID    string `json:"id" bson:"id"`
 	Value string `json:"value" bson:"value"`
@@ -128,3 +238,104 @@ func TestMongoDBIntergration(t *testing.T) {
 		t.Fatal("Expected exactly 1 result, but got: ", len(*resArr))
 	}
 }
+
+func BenchmarkToMongoFilter(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		filter := NewFilter().Match("tenant", "t1").MatchPrefix("name", "jo").Contains("tags", "go")
+		if _, err := toMongoFilter(filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMongoMapIDs(b *testing.B) {
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{}}
+	ids := make([]bson.ObjectId, 100)
+	for i := range ids {
+		ids[i] = bson.NewObjectId()
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		results := make([]*map[string]interface{}, len(ids))
+		for j, id := range ids {
+			results[j] = &map[string]interface{}{"_id": id, "name": "John"}
+		}
+		b.StartTimer()
+		if err := repo.mapIDs(&results); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type rotatingProvider struct {
+	callbacks []func(credentials *DBCredentials)
+}
+
+func (p *rotatingProvider) GetCredentials() (*DBCredentials, error) {
+	return &DBCredentials{Username: "app", Password: "first"}, nil
+}
+
+func (p *rotatingProvider) OnRotate(callback func(credentials *DBCredentials)) {
+	p.callbacks = append(p.callbacks, callback)
+}
+
+func (p *rotatingProvider) Close() {}
+
+func (p *rotatingProvider) rotate(credentials *DBCredentials) {
+	for _, callback := range p.callbacks {
+		callback(credentials)
+	}
+}
+
+func TestMongoCredentialsRotatedWhileDisconnected(t *testing.T) {
+	provider := &rotatingProvider{}
+	credentialsSource := newMongoCredentials(&mgo.DialInfo{Username: "app", Password: "first", Database: "app"})
+
+	dialed := []string{}
+	session := &mgo.Session{}
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		info := credentialsSource.dialInfo()
+		dialed = append(dialed, info.Username+":"+info.Password)
+		if len(dialed) == 1 {
+			return nil, nil, fmt.Errorf("no reachable servers")
+		}
+		return session, &Capabilities{}, nil
+	}, "app", time.Millisecond, time.Millisecond)
+	watchMongoCredentials(provider, &SecretWatcher{}, &config.DBInfo{}, credentialsSource, connector.current)
+
+	// the credentials are rotated while the connection is down
+	provider.rotate(&DBCredentials{Username: "app-2", Password: "second"})
+	connector.run()
+
+	if len(dialed) != 2 || dialed[0] != "app-2:second" || dialed[1] != "app-2:second" {
+		t.Fatal("Expected the reconnects to use the rotated credentials. Got: ", dialed)
+	}
+	if s, err := connector.get(); err != nil || s != session {
+		t.Fatal("Expected the connector to reconnect. Got: ", err)
+	}
+}
+
+func TestMongoCredentialsSecretRotated(t *testing.T) {
+	os.Setenv("BACKENDS_TEST_MONGO_PASS", "first")
+	defer os.Unsetenv("BACKENDS_TEST_MONGO_PASS")
+
+	conf := &config.DBInfo{Username: "app", Password: "env:BACKENDS_TEST_MONGO_PASS"}
+	watcher, err := NewSecretWatcher(time.Minute, []string{conf.Username, conf.Password}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+	credentialsSource := newMongoCredentials(&mgo.DialInfo{Username: "app", Password: "first"})
+	watchMongoCredentials(nil, watcher, conf, credentialsSource, func() *mgo.Session {
+		// the connection is down
+		return nil
+	})
+
+	os.Setenv("BACKENDS_TEST_MONGO_PASS", "second")
+	watcher.Check()
+	if info := credentialsSource.dialInfo(); info.Password != "second" {
+		t.Fatal("Expected the reconnects to use the rotated secret. Got: ", info.Password)
+	}
+}
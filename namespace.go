@@ -0,0 +1,46 @@
+package backends
+
+// namespacedDefinition is a repository definition with the name of the collection or table changed
+// by the namespace of the backend.
+type namespacedDefinition struct {
+	RepositoryDefinition
+	name string
+}
+
+// GetName returns the namespaced name.
+func (d *namespacedDefinition) GetName() string {
+	return d.name
+}
+
+// NamespacedName returns the name of the collection or table of the repository with the name on the
+// backend: the name with the "namePrefix" and "nameSuffix" backend options. For example, with the
+// "namePrefix" option "staging_", the "users" repository is stored in the "staging_users" collection.
+func NamespacedName(backend Backend, name string) string {
+	return namespacedName(optionsFromBackend(backend), name)
+}
+
+func namespacedName(options BackendOptions, name string) string {
+	return options.GetString("namePrefix") + name + options.GetString("nameSuffix")
+}
+
+// namespaceDefinition returns the definition with the namespaced name, or the definition as it is if the
+// backend has no namespace. The repositories are still defined and looked up by their names; only the
+// collections and tables are namespaced.
+func namespaceDefinition(def RepositoryDefinition, options BackendOptions) RepositoryDefinition {
+	name := namespacedName(options, def.GetName())
+	if name == def.GetName() {
+		return def
+	}
+	if defMap, ok := def.(RepositoryDefinitionMap); ok {
+		namespaced := RepositoryDefinitionMap{}
+		for key, value := range defMap {
+			namespaced[key] = value
+		}
+		namespaced["name"] = name
+		return namespaced
+	}
+	return &namespacedDefinition{
+		RepositoryDefinition: def,
+		name:                 name,
+	}
+}
@@ -0,0 +1,52 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+type customDefinition struct {
+	RepositoryDefinitionMap
+}
+
+func TestNamespacedRepositories(t *testing.T) {
+	ctx := context.WithValue(context.Background(), OPTIONS_CTX_KEY, BackendOptions{
+		"namePrefix": "staging_",
+		"nameSuffix": "_v2",
+	})
+	built := []string{}
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		built = append(built, def.GetName())
+		return repoBuilderFn(def, backend)
+	}, func() {})
+
+	repo, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.DefineRepository("orders", &customDefinition{RepositoryDefinitionMap{"name": "orders", "hashKey": "id"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != 2 || built[0] != "staging_users_v2" || built[1] != "staging_orders_v2" {
+		t.Fatal("Expected the namespaced names. Got: ", built)
+	}
+
+	if same, err := backend.GetRepository("users"); err != nil || same != repo {
+		t.Fatal("Expected the repository by its name. Got: ", err)
+	}
+	if def := backend.(*RepositoriesBackend).RepositoryDefinitions()["users"]; def.GetName() != "users" || def.GetHashKey() != "id" {
+		t.Fatal("Expected the definition as defined. Got: ", def)
+	}
+	if name := NamespacedName(backend, "users"); name != "staging_users_v2" {
+		t.Fatal("Expected the namespaced name. Got: ", name)
+	}
+}
+
+func TestNamespaceDefinitionWithoutNamespace(t *testing.T) {
+	def := RepositoryDefinitionMap{"name": "users"}
+	if namespaced := namespaceDefinition(def, BackendOptions{}); namespaced.GetName() != "users" {
+		t.Fatal("Expected the definition as it is. Got: ", namespaced.GetName())
+	}
+}
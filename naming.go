@@ -0,0 +1,82 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Naming strategies of the struct fields without a bson or json name ("fieldNaming" property).
+const (
+	// FieldNamingLowercase stores the fields by their lower-case names: "UserID" as "userid". It is the default.
+	FieldNamingLowercase = "lowercase"
+	// FieldNamingAsIs stores the fields by their Go names: "UserID" as "UserID".
+	FieldNamingAsIs = "asIs"
+	// FieldNamingSnakeCase stores the fields by their snake_case names: "UserID" as "user_id".
+	FieldNamingSnakeCase = "snake_case"
+	// FieldNamingCamelCase stores the fields by their camelCase names: "UserID" as "userID".
+	FieldNamingCamelCase = "camelCase"
+)
+
+// GetFieldNaming returns the naming strategy of the struct fields without a bson or json name
+// ("fieldNaming" property), or an empty string for the default (lowercase).
+func (m RepositoryDefinitionMap) GetFieldNaming() string {
+	if naming, ok := m["fieldNaming"]; ok {
+		return naming.(string)
+	}
+	return ""
+}
+
+// validFieldNaming returns an error if the naming strategy is not known.
+func validFieldNaming(naming string) error {
+	switch naming {
+	case "", FieldNamingLowercase, FieldNamingAsIs, FieldNamingSnakeCase, FieldNamingCamelCase:
+		return nil
+	}
+	return ErrInvalidInput(fmt.Sprintf("unknown field naming %s", naming))
+}
+
+// fieldNameOf returns the property name of the Go field name with the naming strategy.
+func fieldNameOf(name, naming string) string {
+	switch naming {
+	case FieldNamingAsIs:
+		return name
+	case FieldNamingSnakeCase:
+		return strings.Join(nameWords(name), "_")
+	case FieldNamingCamelCase:
+		// the first word is in lower case, the others are kept
+		first := nameWords(name)[0]
+		return first + string([]rune(name)[len([]rune(first)):])
+	}
+	return strings.ToLower(name)
+}
+
+// nameWords splits the Go name into lower-case words: "HTTPServerID" into "http", "server" and "id".
+func nameWords(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		// a word starts at an upper-case letter after a lower-case letter or a digit, and at the last
+		// upper-case letter of an initialism followed by a lower-case letter
+		if !unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	return append(words, strings.ToLower(string(runes[start:])))
+}
+
+// foldName returns the name in lower case without underscores and dashes, so the names of a field with
+// all naming strategies match: "userID", "user_id" and "UserID" are all "userid".
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
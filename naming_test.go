@@ -0,0 +1,96 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+type namingAddress struct {
+	StreetName string
+}
+
+type namingUser struct {
+	UserID     string
+	FirstName  string
+	HTTPServer string
+	Email      string `json:"email"`
+	Address    *namingAddress
+}
+
+func TestFieldNameOf(t *testing.T) {
+	names := map[string][]string{
+		"UserID":     {"userid", "UserID", "user_id", "userID"},
+		"FirstName":  {"firstname", "FirstName", "first_name", "firstName"},
+		"HTTPServer": {"httpserver", "HTTPServer", "http_server", "httpServer"},
+		"ID":         {"id", "ID", "id", "id"},
+		"Address2":   {"address2", "Address2", "address2", "address2"},
+	}
+	strategies := []string{FieldNamingLowercase, FieldNamingAsIs, FieldNamingSnakeCase, FieldNamingCamelCase}
+	for name, expected := range names {
+		for i, naming := range strategies {
+			if property := fieldNameOf(name, naming); property != expected[i] {
+				t.Fatalf("Expected %s for %s with %s. Got: %s", expected[i], name, naming, property)
+			}
+		}
+	}
+}
+
+func TestInterfaceToMapNaming(t *testing.T) {
+	user := &namingUser{UserID: "u1", FirstName: "Ann", HTTPServer: "web", Email: "ann@example.com", Address: &namingAddress{StreetName: "Main"}}
+	expected := map[string][]string{
+		FieldNamingLowercase: {"userid", "firstname", "httpserver", "email", "streetname"},
+		FieldNamingAsIs:      {"UserID", "FirstName", "HTTPServer", "email", "StreetName"},
+		FieldNamingSnakeCase: {"user_id", "first_name", "http_server", "email", "street_name"},
+		FieldNamingCamelCase: {"userID", "firstName", "httpServer", "email", "streetName"},
+	}
+	for naming, properties := range expected {
+		record, err := interfaceToMap(user, naming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, property := range properties[:4] {
+			if _, ok := (*record)[property]; !ok {
+				t.Fatalf("Expected the property %s with %s. Got: %v", property, naming, *record)
+			}
+		}
+		address := (*record)["address"]
+		if naming == FieldNamingAsIs {
+			address = (*record)["Address"]
+		}
+		if _, ok := address.(map[string]interface{})[properties[4]]; !ok {
+			t.Fatalf("Expected the nested property %s with %s. Got: %v", properties[4], naming, address)
+		}
+
+		// the records are read back with any naming strategy
+		result := &namingUser{}
+		if err := MapToInterface(record, result); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, user) {
+			t.Fatalf("Expected %+v with %s. Got: %+v", user, naming, result)
+		}
+	}
+}
+
+func TestNewRepoDefFromStructNaming(t *testing.T) {
+	def, err := NewRepoDefFromStruct(&struct {
+		_         struct{} `backend:"name=users,fieldNaming=snake_case"`
+		FirstName string   `backend:"index"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.GetFieldNaming() != FieldNamingSnakeCase || def.GetIndexes()[0].GetFields()[0] != "first_name" {
+		t.Fatal("Expected the snake_case property names. Got: ", def)
+	}
+	if _, ok := def.GetSchema().Properties["first_name"]; !ok {
+		t.Fatal("Expected the snake_case schema properties. Got: ", def.GetSchema().Properties)
+	}
+
+	_, err = NewRepoDefFromStruct(&struct {
+		_ struct{} `backend:"fieldNaming=kebab"`
+	}{})
+	if !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown naming strategy. Got: ", err)
+	}
+}
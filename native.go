@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"gopkg.in/mgo.v2"
+)
+
+// NativeRepository is implemented by the repositories that expose the handle of the underlying database driver.
+type NativeRepository interface {
+	// Native returns the backend specific handle: *MongoNative for MongoDB and *DynamoNative for DynamoDB.
+	Native() (interface{}, error)
+}
+
+// MongoNative is the native handle of a MongoDB repository. The session is a copy of the backend session
+// and must be closed after use.
+type MongoNative struct {
+	Session    *mgo.Session
+	Database   *mgo.Database
+	Collection *mgo.Collection
+}
+
+// Close closes the session of the handle.
+func (n *MongoNative) Close() {
+	n.Session.Close()
+}
+
+// DynamoNative is the native handle of a DynamoDB repository.
+type DynamoNative struct {
+	Client    *dynamodb.DynamoDB
+	DB        *dynamo.DB
+	TableName string
+}
+
+// Native returns the backend specific handle of the repository, for queries that the Repository interface
+// does not support. Use NativeMongo and NativeDynamo for the typed handles.
+func Native(repo Repository) (interface{}, error) {
+	if r, ok := repo.(NativeRepository); ok {
+		return r.Native()
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("native access is not supported on %T", repo))
+}
+
+// NativeMongo returns the native handle of a MongoDB repository. For example, to run an aggregation:
+//
+//	native, err := backends.NativeMongo(ordersRepo)
+//	if err != nil {
+//		return err
+//	}
+//	defer native.Close()
+//	err = native.Collection.Pipe(pipeline).All(&results)
+func NativeMongo(repo Repository) (*MongoNative, error) {
+	native, err := Native(repo)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := native.(*MongoNative); ok {
+		return n, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("%T is not a MongoDB repository", repo))
+}
+
+// NativeDynamo returns the native handle of a DynamoDB repository.
+func NativeDynamo(repo Repository) (*DynamoNative, error) {
+	native, err := Native(repo)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := native.(*DynamoNative); ok {
+		return n, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("%T is not a DynamoDB repository", repo))
+}
+
+// Native returns a *MongoNative handle with a copy of the session.
+func (s *MongoSession) Native() (interface{}, error) {
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+	session, collection := s.GetCollection()
+	return &MongoNative{
+		Session:    session,
+		Database:   collection.Database,
+		Collection: collection,
+	}, nil
+}
+
+// Native returns a *DynamoNative handle with a client that shares the session of the backend.
+func (c *DynamoCollection) Native() (interface{}, error) {
+	if c.session == nil {
+		return nil, ErrBackendError("dynamo session not configured")
+	}
+	return &DynamoNative{
+		Client:    dynamodb.New(c.session),
+		DB:        dynamo.New(c.session),
+		TableName: c.RepositoryDefinition.GetName(),
+	}, nil
+}
+
+// Native returns the handle of the repository on the active backend.
+func (r *failoverRepository) Native() (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return Native(repository)
+}
@@ -0,0 +1,27 @@
+package backends
+
+import (
+	"testing"
+)
+
+func TestNativeDynamo(t *testing.T) {
+	users := testTxCollection(t, RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+
+	native, err := NativeDynamo(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if native.TableName != "users" || native.Client == nil || native.DB == nil {
+		t.Fatal("Unexpected handle: ", native)
+	}
+
+	if _, err := NativeMongo(users); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a DynamoDB repository. Got: ", err)
+	}
+}
+
+func TestNativeNotSupported(t *testing.T) {
+	if _, err := Native(&memoryRepo{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a repository without native access. Got: ", err)
+	}
+}
@@ -0,0 +1,259 @@
+package backends
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// JOURNAL_CTX_KEY is the backend context key for the offline journal (WriteJournal).
+var JOURNAL_CTX_KEY = "OFFLINE_JOURNAL"
+
+// DefaultOfflineReplayInterval is how often the offline journal is replayed by default.
+const DefaultOfflineReplayInterval = 10 * time.Second
+
+// ReplayConflictAction is what happens with a journal entry that failed to replay.
+type ReplayConflictAction string
+
+const (
+	// ReplaySkip removes the entry from the journal.
+	ReplaySkip ReplayConflictAction = "skip"
+	// ReplayRetry stops the replay and keeps the entry in the journal, to be replayed again later.
+	ReplayRetry ReplayConflictAction = "retry"
+)
+
+// ReplayConflictHandler is called when a journal entry fails to replay, for example because the record was
+// changed or deleted while the write was queued. The handler may resolve the conflict on the repository (which
+// applies the writes directly, not through the journal) and return ReplaySkip.
+type ReplayConflictHandler func(repo Repository, entry *JournalEntry, err error) ReplayConflictAction
+
+// GetReplayConflictHandler returns the ReplayConflictHandler set with the "replayConflictHandler" option, or nil.
+func (o BackendOptions) GetReplayConflictHandler() ReplayConflictHandler {
+	if handler, ok := o["replayConflictHandler"].(ReplayConflictHandler); ok {
+		return handler
+	}
+	if handler, ok := o["replayConflictHandler"].(func(Repository, *JournalEntry, error) ReplayConflictAction); ok {
+		return handler
+	}
+	return nil
+}
+
+// isUnreachable checks if the error is caused by a lost connection to the database.
+func isUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsErrBackendUnavailable(err) || err == io.EOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if code := awsErrorCode(err); code == "RequestError" || code == request.ErrCodeResponseTimeout {
+		return true
+	}
+	return strings.Contains(err.Error(), "no reachable servers")
+}
+
+type fileJournal struct {
+	*memoryJournal
+	path string
+}
+
+// NewFileJournal creates a WriteJournal that keeps the entries in a file, one JSON object per line, so the
+// writes survive a restart. The entries already in the file are loaded. The journal keeps up to size entries
+// (DefaultJournalSize if zero), with the overflow policy (OverflowReject if empty). The values are stored as
+// JSON, so for example the dates are replayed as strings.
+func NewFileJournal(path string, size int, overflow string) (WriteJournal, error) {
+	if err := validOverflow(overflow); err != nil {
+		return nil, err
+	}
+	journal := &fileJournal{
+		memoryJournal: newMemoryJournal(size, overflow),
+		path:          path,
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			// the last line may be partially written if the process stopped while writing it
+			log.Printf("WARNING: skipped an invalid entry of the journal %s: %s\n", path, err.Error())
+			continue
+		}
+		journal.entries = append(journal.entries, entry)
+		journal.next = entry.Sequence
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// Append records the entry and writes it to the file.
+func (j *fileJournal) Append(entry *JournalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	dropped, err := j.append(entry)
+	if err != nil {
+		return err
+	}
+	if dropped {
+		err = j.rewrite()
+	} else {
+		err = j.write(entry)
+	}
+	if err != nil {
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	return err
+}
+
+// Remove removes the entries up to the sequence and rewrites the file.
+func (j *fileJournal) Remove(sequence int64) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.remove(sequence)
+	return j.rewrite()
+}
+
+// write appends the entry to the file and syncs it to the disk.
+func (j *fileJournal) write(entry *JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// rewrite replaces the file with the entries of the journal.
+func (j *fileJournal) rewrite() error {
+	tmp := j.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, entry := range j.entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// journalFileName returns the name of the journal file of the database, so the primary and the standby
+// cluster have separate journals.
+func journalFileName(dbInfo *config.DBInfo) string {
+	server := dbInfo.Host
+	if server == "" {
+		server = dbInfo.AWSEndpoint
+	}
+	if server == "" {
+		server = dbInfo.AWSRegion
+	}
+	return unsafeFileChars.ReplaceAllString(fmt.Sprintf("%s-%s", dbInfo.DatabaseName, server), "_") + ".journal"
+}
+
+// withOfflineJournal adds the offline journal to the backend context if the "offlineJournal" option (the
+// directory of the journal files) is set.
+func withOfflineJournal(ctx context.Context, dbInfo *config.DBInfo, options BackendOptions) (context.Context, error) {
+	dir := options.GetString("offlineJournal")
+	if dir == "" {
+		return ctx, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	journal, err := NewFileJournal(filepath.Join(dir, journalFileName(dbInfo)), options.GetInt("maintenanceJournalSize"), options.GetString("maintenanceOverflow"))
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, JOURNAL_CTX_KEY, journal), nil
+}
+
+// startOfflineReplay replays the offline journal in the background while the backend is offline, once its
+// health check passes, until the backend is closed.
+func (m *RepositoriesBackend) startOfflineReplay(state *maintenanceState, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultOfflineReplayInterval
+	}
+	stop := make(chan struct{})
+	m.OnShutdown(func() {
+		close(stop)
+	})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+			if err := m.replayOffline(state); err != nil {
+				log.Printf("WARN: failed to replay the offline journal: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+// replayOffline replays the offline journal if the backend is offline and reachable. During maintenance the
+// journal is replayed when the maintenance ends.
+func (m *RepositoriesBackend) replayOffline(state *maintenanceState) error {
+	state.mutex.RLock()
+	offline := state.offline && state.mode == MaintenanceOff
+	state.mutex.RUnlock()
+	if !offline {
+		return nil
+	}
+	if err := m.Ping(); err != nil {
+		return nil
+	}
+	return m.replayJournal(state, func() {
+		log.Println("The offline journal is replayed, the writes are applied again.")
+	})
+}
@@ -0,0 +1,160 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"gopkg.in/mgo.v2"
+)
+
+func TestFileJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.journal")
+
+	journal, err := NewFileJournal(path, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Append(&JournalEntry{Repository: "users", Operation: JournalSave, Object: map[string]interface{}{"name": "alice"}})
+	journal.Append(&JournalEntry{Repository: "users", Operation: JournalDeleteOne, Filter: Filter{"id": "1"}})
+	journal.Append(&JournalEntry{Repository: "users", Operation: JournalDeleteAll, Filter: Filter{"name": "bob"}})
+	if err := journal.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileJournal(path, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := reopened.Entries()
+	if len(entries) != 2 || entries[0].Sequence != 2 || entries[0].Filter["id"] != "1" || entries[1].Operation != JournalDeleteAll {
+		t.Fatalf("Expected the entries to be loaded from the file. Got: %+v", entries)
+	}
+	reopened.Append(&JournalEntry{Repository: "users", Operation: JournalSave})
+	if entries, _ = reopened.Entries(); entries[2].Sequence != 4 {
+		t.Fatal("Expected the sequence to continue. Got: ", entries[2].Sequence)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	for _, err := range []error{
+		ErrBackendUnavailable("connecting"),
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")},
+		awserr.New("RequestError", "send request failed", nil),
+		errors.New("no reachable servers"),
+	} {
+		if !isUnreachable(err) {
+			t.Fatal("Expected the error to be unreachable: ", err)
+		}
+	}
+	if isUnreachable(nil) || isUnreachable(ErrNotFound("not found")) {
+		t.Fatal("Expected the error not to be unreachable")
+	}
+}
+
+func TestOfflineJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := BackendOptions{"offlineJournal": dir}
+	ctx, err := withOfflineJournal(context.Background(), &config.DBInfo{DatabaseName: "app", Host: "mongo:27017"}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := newMaintenanceState(ctx, options)
+
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		return nil, nil, errors.New("no reachable servers")
+	}, "app", time.Second, time.Second)
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{"name": "users"}, connector: connector, maintenance: state}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "2", "name": "alice"}, nil); err == nil || !IsErrWriteQueued(err) {
+		t.Fatal("Expected the write to be queued while unreachable. Got: ", err)
+	}
+	if !state.offline {
+		t.Fatal("Expected the backend to be offline")
+	}
+	if err := repo.DeleteOne(Filter{"id": "1"}); err == nil || !IsErrWriteQueued(err) {
+		t.Fatal("Expected the following writes to be queued. Got: ", err)
+	}
+	if err := repo.DeleteOne(Filter{"id": "3"}); err == nil || !IsErrWriteQueued(err) {
+		t.Fatal("Expected the following writes to be queued. Got: ", err)
+	}
+
+	// the backend is restarted and connects again
+	ctx, _ = withOfflineJournal(context.Background(), &config.DBInfo{DatabaseName: "app", Host: "mongo:27017"}, options)
+	conflicts := []string{}
+	ctx = context.WithValue(ctx, OPTIONS_CTX_KEY, BackendOptions{
+		"replayConflictHandler": ReplayConflictHandler(func(repo Repository, entry *JournalEntry, err error) ReplayConflictAction {
+			conflicts = append(conflicts, entry.Filter["id"].(string))
+			return ReplaySkip
+		}),
+	})
+	memory := &memoryRepo{records: []map[string]interface{}{{"id": "1", "name": "bob"}}}
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return memory, nil
+	}, nil).(*RepositoriesBackend)
+	defer backend.Shutdown()
+	if _, err := backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := maintenanceFromBackend(backend)
+	if !restarted.offline {
+		t.Fatal("Expected the backend to start offline with the journaled writes")
+	}
+	if err := backend.replayOffline(restarted); err != nil {
+		t.Fatal(err)
+	}
+	if len(memory.records) != 1 || memory.records[0]["name"] != "alice" {
+		t.Fatalf("Expected the journal to be replayed in order. Got: %+v", memory.records)
+	}
+	if len(conflicts) != 0 {
+		t.Fatal("Expected the missing record to be ignored on delete. Got: ", conflicts)
+	}
+	if entries, _ := restarted.journal.Entries(); len(entries) != 0 || restarted.offline {
+		t.Fatal("Expected the backend to be online with an empty journal")
+	}
+}
+
+func TestReplayConflictHandler(t *testing.T) {
+	memory := &memoryRepo{}
+	options := BackendOptions{
+		"replayConflictHandler": ReplayConflictHandler(func(repo Repository, entry *JournalEntry, err error) ReplayConflictAction {
+			if !IsErrNotFound(err) {
+				t.Fatal("Expected the error of the replay. Got: ", err)
+			}
+			return ReplayRetry
+		}),
+	}
+	backend := NewRepositoriesBackend(context.WithValue(context.Background(), OPTIONS_CTX_KEY, options), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return memory, nil
+	}, nil).(*RepositoriesBackend)
+	backend.DefineRepository("users", RepositoryDefinitionMap{"name": "users"})
+
+	backend.SetMaintenance(MaintenanceQueue)
+	state := maintenanceFromBackend(backend)
+	state.journal.Append(&JournalEntry{Repository: "users", Operation: JournalSave, Object: map[string]interface{}{"name": "alice"}, Filter: Filter{"id": "1"}})
+
+	if err := backend.SetMaintenance(MaintenanceOff); err == nil {
+		t.Fatal("Expected the replay to stop on the retried entry")
+	}
+	if entries, _ := state.journal.Entries(); len(entries) != 1 || state.mode != MaintenanceQueue {
+		t.Fatal("Expected the entry to be kept and the backend to stay in maintenance")
+	}
+}
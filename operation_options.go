@@ -0,0 +1,202 @@
+package backends
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/guregu/dynamo"
+)
+
+// OperationOptions are the options of the operations on a repository view returned by WithOptions.
+type OperationOptions struct {
+	// Timeout limits the time of each request to the database.
+	Timeout time.Duration
+	// ReadPreference routes the reads on MongoDB.
+	ReadPreference ReadPreference
+	// ConsistentRead chooses strongly (true) or eventually consistent reads on DynamoDB.
+	ConsistentRead *bool
+	// Projection are the properties of the records read by GetOne and GetAll. All properties are read if it is empty.
+	// The id (and the key of a DynamoDB table) is always read.
+	Projection []string
+	// TraceAttributes are added to the events published for the operations, for example the name of the service
+	// or the id of the request.
+	TraceAttributes map[string]string
+	// Context is the context of the operations, see WithContext. The context of the repository is kept if it is nil.
+	Context context.Context
+}
+
+// Option sets an option of the operations on a repository.
+type Option func(options *OperationOptions)
+
+// TimeoutOption limits the time of each request to the database.
+func TimeoutOption(timeout time.Duration) Option {
+	return func(options *OperationOptions) {
+		options.Timeout = timeout
+	}
+}
+
+// ReadPreferenceOption routes the reads according to the preference.
+func ReadPreferenceOption(preference ReadPreference) Option {
+	return func(options *OperationOptions) {
+		options.ReadPreference = preference
+	}
+}
+
+// ConsistentReadOption chooses strongly or eventually consistent reads.
+func ConsistentReadOption(consistent bool) Option {
+	return func(options *OperationOptions) {
+		options.ConsistentRead = &consistent
+	}
+}
+
+// ProjectionOption reads only the given properties of the records.
+func ProjectionOption(properties ...string) Option {
+	return func(options *OperationOptions) {
+		options.Projection = append(options.Projection, properties...)
+	}
+}
+
+// TraceAttributeOption adds the attribute to the events published for the operations.
+func TraceAttributeOption(key, value string) Option {
+	return func(options *OperationOptions) {
+		if options.TraceAttributes == nil {
+			options.TraceAttributes = map[string]string{}
+		}
+		options.TraceAttributes[key] = value
+	}
+}
+
+// OperationOptionsRepository is implemented by the repositories that support the operation options.
+type OperationOptionsRepository interface {
+	// WithOperationOptions returns a view of the repository that runs the operations with the options.
+	WithOperationOptions(options OperationOptions) Repository
+}
+
+// WithOptions returns a view of the repository that runs the operations with the options. For example, to
+// read only the names of the users within a second:
+//
+//	repo := backends.WithOptions(usersRepo, backends.TimeoutOption(time.Second), backends.ProjectionOption("name"))
+//	users, err := repo.GetAll(filter, &User{}, "", "", 0, 0)
+//
+// The options that the repository does not support are ignored, like with WithReadPreference and
+// WithConsistentRead.
+func WithOptions(repo Repository, options ...Option) Repository {
+	operation := OperationOptions{}
+	for _, option := range options {
+		option(&operation)
+	}
+	if operation.ReadPreference != "" {
+		repo = WithReadPreference(repo, operation.ReadPreference)
+	}
+	if operation.ConsistentRead != nil {
+		repo = WithConsistentRead(repo, *operation.ConsistentRead)
+	}
+	if r, ok := repo.(OperationOptionsRepository); ok {
+		return r.WithOperationOptions(operation)
+	}
+	return repo
+}
+
+// WithOperationOptions returns a copy of the MongoSession that runs the operations with the options.
+func (s *MongoSession) WithOperationOptions(options OperationOptions) Repository {
+	sessionCopy := *s
+	if options.Context == nil {
+		options.Context = s.operation.Context
+	}
+	sessionCopy.operation = options
+	return &sessionCopy
+}
+
+// projection returns the selected fields of the find queries, or nil to read all fields.
+func (s *MongoSession) projection() map[string]interface{} {
+	if len(s.operation.Projection) == 0 {
+		return nil
+	}
+	selected := map[string]interface{}{}
+	for _, property := range s.operation.Projection {
+		if property == "id" && !s.repoDef.IsCustomID() {
+			// the id is read from _id, which is always returned
+			continue
+		}
+		selected[property] = 1
+	}
+	return selected
+}
+
+type traceAttributesKey struct{}
+
+// traceAttributes returns the trace attributes bound to the context of a DynamoDB request.
+func traceAttributes(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	attributes, _ := ctx.Value(traceAttributesKey{}).(map[string]string)
+	return attributes
+}
+
+// WithOperationOptions returns a copy of the DynamoCollection that runs the operations with the options.
+// The requests are made with a copy of the session that sets the timeout and the trace attributes on
+// their context.
+func (c *DynamoCollection) WithOperationOptions(options OperationOptions) Repository {
+	collectionCopy := *c
+	if options.Context == nil {
+		options.Context = c.operation.Context
+	}
+	collectionCopy.operation = options
+	if options.Timeout > 0 || len(options.TraceAttributes) > 0 {
+		sess := c.session.Copy()
+		sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+			Name: "backends.OperationOptions",
+			Fn: func(r *request.Request) {
+				ctx := r.Context()
+				if len(options.TraceAttributes) > 0 {
+					ctx = context.WithValue(ctx, traceAttributesKey{}, options.TraceAttributes)
+				}
+				if options.Timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+					r.Handlers.Complete.PushBack(func(*request.Request) {
+						cancel()
+					})
+				}
+				r.SetContext(ctx)
+			},
+		})
+		table := dynamo.New(sess).Table(c.Table.Name())
+		collectionCopy.Table = &table
+		collectionCopy.session = sess
+	}
+	return &collectionCopy
+}
+
+// projection returns the properties read by the queries and the scans, with the key of the table, or nil
+// to read all properties.
+func (c *DynamoCollection) projection() []string {
+	if len(c.operation.Projection) == 0 {
+		return nil
+	}
+	properties := []string{}
+	selected := map[string]bool{}
+	keys := []string{c.RepositoryDefinition.GetHashKey(), c.RepositoryDefinition.GetRangeKey()}
+	for _, property := range append(keys, c.operation.Projection...) {
+		if property != "" && !selected[property] {
+			selected[property] = true
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// projectScan sets the projection on the scan. The names are quoted, as they may be reserved words.
+func (c *DynamoCollection) projectScan(scan *dynamo.Scan) *dynamo.Scan {
+	properties := c.projection()
+	if properties == nil {
+		return scan
+	}
+	quoted := make([]string, len(properties))
+	for i, property := range properties {
+		quoted[i] = "'" + property + "'"
+	}
+	return scan.Project(quoted...)
+}
@@ -0,0 +1,91 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+)
+
+func TestWithOptionsMongo(t *testing.T) {
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{}}
+	view, ok := WithOptions(repo,
+		TimeoutOption(time.Second),
+		ReadPreferenceOption(ReadSecondary),
+		ProjectionOption("id", "name"),
+		TraceAttributeOption("service", "billing"),
+	).(*MongoSession)
+	if !ok {
+		t.Fatal("Expected a MongoSession")
+	}
+	if view.readPreference != ReadSecondary || view.operation.Timeout != time.Second {
+		t.Fatalf("Expected the options on the view. Got: %+v", view.operation)
+	}
+	if view.operation.TraceAttributes["service"] != "billing" {
+		t.Fatal("Expected the trace attributes. Got: ", view.operation.TraceAttributes)
+	}
+	if projection := view.projection(); !reflect.DeepEqual(projection, map[string]interface{}{"name": 1}) {
+		t.Fatal("Expected the projection without the id. Got: ", projection)
+	}
+	if repo.readPreference != "" || repo.projection() != nil {
+		t.Fatal("Expected the original repository to be unchanged")
+	}
+}
+
+func TestWithOptionsDynamo(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := dynamo.New(sess).Table("users")
+	repo := &DynamoCollection{
+		Table:                &table,
+		RepositoryDefinition: RepositoryDefinitionMap{"hashKey": "id", "rangeKey": "email"},
+		session:              sess,
+	}
+
+	view, ok := WithOptions(repo, ConsistentReadOption(true), ProjectionOption("name", "id")).(*DynamoCollection)
+	if !ok {
+		t.Fatal("Expected a DynamoCollection")
+	}
+	if !view.consistentRead || view.session != sess {
+		t.Fatal("Expected consistent reads with the same session")
+	}
+	if projection := view.projection(); !reflect.DeepEqual(projection, []string{"id", "email", "name"}) {
+		t.Fatal("Expected the projection with the key. Got: ", projection)
+	}
+
+	view = WithOptions(repo, TimeoutOption(time.Minute), TraceAttributeOption("service", "billing")).(*DynamoCollection)
+	if view.session == sess || view.Table.Name() != "users" {
+		t.Fatal("Expected the table with a copy of the session")
+	}
+	req, _ := dynamodb.New(view.session).ListTablesRequest(&dynamodb.ListTablesInput{})
+	req.Handlers.Validate.Run(req)
+	if _, ok := req.Context().Deadline(); !ok {
+		t.Fatal("Expected the timeout on the request context")
+	}
+	if attributes := traceAttributes(req.Context()); attributes["service"] != "billing" {
+		t.Fatal("Expected the trace attributes on the request context. Got: ", attributes)
+	}
+	req.Handlers.Complete.Run(req)
+	if req.Context().Err() == nil {
+		t.Fatal("Expected the context to be canceled when the request completes")
+	}
+
+	other, _ := dynamodb.New(sess).ListTablesRequest(&dynamodb.ListTablesInput{})
+	other.Handlers.Validate.Run(other)
+	if _, ok := other.Context().Deadline(); ok {
+		t.Fatal("Expected the session of the repository to be unchanged")
+	}
+}
+
+func TestWithOptionsUnsupported(t *testing.T) {
+	repo := &memoryRepo{}
+	if WithOptions(repo, TimeoutOption(time.Second), ProjectionOption("name")) != repo {
+		t.Fatal("Expected the repository to be returned unchanged")
+	}
+}
@@ -0,0 +1,84 @@
+package backends
+
+import (
+	"strconv"
+	"time"
+)
+
+// BackendOptions holds additional, backend specific, configuration that is not part of config.DBInfo.
+// The options are registered per backend type with BackendManager.SetBackendOptions and are
+// available to the BackendBuilder through BackendManager.GetBackendOptions.
+type BackendOptions map[string]interface{}
+
+// GetString returns the string value of the option, or empty string if not set.
+func (o BackendOptions) GetString(name string) string {
+	if value, ok := o[name]; ok {
+		if str, ok := value.(string); ok {
+			return str
+		}
+	}
+	return ""
+}
+
+// GetBool returns the boolean value of the option, or false if not set.
+func (o BackendOptions) GetBool(name string) bool {
+	if value, ok := o[name]; ok {
+		if b, ok := value.(bool); ok {
+			return b
+		}
+	}
+	return false
+}
+
+// GetInt returns the integer value of the option, or 0 if not set or not a number.
+func (o BackendOptions) GetInt(name string) int {
+	if value, ok := o[name]; ok {
+		switch v := value.(type) {
+		case int:
+			return v
+		case int32:
+			return int(v)
+		case int64:
+			return int(v)
+		case float64:
+			// options loaded from JSON
+			return int(v)
+		case string:
+			if i, err := strconv.Atoi(v); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// GetDuration returns the duration value of the option. The value can be given as
+// time.Duration, as a string parsable by time.ParseDuration, or as a number of seconds.
+func (o BackendOptions) GetDuration(name string) time.Duration {
+	value, ok := o[name]
+	if !ok {
+		return 0
+	}
+	switch d := value.(type) {
+	case time.Duration:
+		return d
+	case string:
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return 0
+		}
+		return duration
+	}
+	return time.Duration(o.GetInt(name)) * time.Second
+}
+
+// OPTIONS_CTX_KEY is the backend context key for the backend options.
+var OPTIONS_CTX_KEY = "BACKEND_OPTIONS"
+
+// optionsFromBackend returns the options the backend was built with, or empty options.
+func optionsFromBackend(backend Backend) BackendOptions {
+	if options, ok := backend.GetFromContext(OPTIONS_CTX_KEY).(BackendOptions); ok {
+		return options
+	}
+	return BackendOptions{}
+}
@@ -0,0 +1,45 @@
+package backends
+
+// Pattern filter kinds.
+const (
+	patternLike   = "$pattern"
+	patternPrefix = "$prefix"
+	patternSuffix = "$suffix"
+)
+
+// patternFilter is a pattern filter value: a MatchPattern pattern, or a MatchPrefix or MatchSuffix value.
+type patternFilter struct {
+	kind  string
+	value string
+
+	caseInsensitive bool
+	unanchored      bool
+}
+
+// parsePatternFilter returns the pattern of the filter value, or false if the value is not a pattern.
+func parsePatternFilter(value interface{}) (*patternFilter, bool) {
+	specs := map[string]string{}
+	switch v := value.(type) {
+	case map[string]string:
+		specs = v
+	case map[string]interface{}:
+		for key, spec := range v {
+			if s, ok := spec.(string); ok {
+				specs[key] = s
+			}
+		}
+	default:
+		return nil, false
+	}
+	for _, kind := range []string{patternLike, patternPrefix, patternSuffix} {
+		if pattern, ok := specs[kind]; ok {
+			return &patternFilter{
+				kind:            kind,
+				value:           pattern,
+				caseInsensitive: specs["$caseInsensitive"] == "true",
+				unanchored:      kind == patternLike && specs["$anchored"] == "false",
+			}, true
+		}
+	}
+	return nil, false
+}
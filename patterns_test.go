@@ -0,0 +1,32 @@
+package backends
+
+import "testing"
+
+func TestParsePatternFilter(t *testing.T) {
+	filter := NewFilter().
+		MatchPattern("a", "Jo%").
+		MatchPatternWith("b", "john", PatternOptions{CaseInsensitive: true, Unanchored: true}).
+		MatchPrefix("c", "50%").
+		MatchSuffix("d", ".com").
+		Match("e", "exact")
+
+	cases := map[string]patternFilter{
+		"a": {kind: patternLike, value: "Jo%"},
+		"b": {kind: patternLike, value: "john", caseInsensitive: true, unanchored: true},
+		"c": {kind: patternPrefix, value: "50%"},
+		"d": {kind: patternSuffix, value: ".com"},
+	}
+	for property, expected := range cases {
+		pattern, ok := parsePatternFilter(filter[property])
+		if !ok || *pattern != expected {
+			t.Errorf("Unexpected pattern for %s: %+v", property, pattern)
+		}
+	}
+
+	if _, ok := parsePatternFilter(filter["e"]); ok {
+		t.Error("Expected an exact match not to be a pattern")
+	}
+	if _, ok := parsePatternFilter(map[string]interface{}{"$pattern": "Jo%"}); !ok {
+		t.Error("Expected a pattern in map[string]interface{}")
+	}
+}
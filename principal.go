@@ -0,0 +1,89 @@
+package backends
+
+import (
+	"context"
+)
+
+// PRINCIPAL_CTX_KEY is the context key for the Principal acting on the repositories.
+var PRINCIPAL_CTX_KEY = "BACKENDS_CALLER_PRINCIPAL"
+
+// Types of principals.
+const (
+	// PrincipalUser is an end user.
+	PrincipalUser = "user"
+	// PrincipalService is a service acting on its own behalf.
+	PrincipalService = "service"
+)
+
+// Principal is the identity of the user or the service that acts on the repositories. It is recorded as the
+// actor in the audit trail and in the CreatedByField and UpdatedByField of the records.
+type Principal struct {
+	// ID is the id of the user or the name of the service.
+	ID string
+	// Type is PrincipalUser or PrincipalService.
+	Type string
+	// Tenant is the tenant the principal acts for, if the service is multi-tenant.
+	Tenant string
+}
+
+// WithPrincipal returns a copy of the context that carries the principal. Set it once per request, for example
+// in the authentication middleware:
+//
+//	ctx = backends.WithPrincipal(ctx, backends.Principal{ID: userID, Type: backends.PrincipalUser, Tenant: tenantID})
+//	_, err := backends.WithContext(repo, ctx).Save(&order, nil)
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, PRINCIPAL_CTX_KEY, principal)
+}
+
+// PrincipalFromContext returns the principal of the context, and false if it is not set.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	if ctx == nil {
+		return Principal{}, false
+	}
+	principal, ok := ctx.Value(PRINCIPAL_CTX_KEY).(Principal)
+	return principal, ok
+}
+
+// TenantFromContext returns the tenant of the principal, or empty string if not set.
+func TenantFromContext(ctx context.Context) string {
+	principal, _ := PrincipalFromContext(ctx)
+	return principal.Tenant
+}
+
+// ContextRepository is implemented by the repositories that run their operations with a context.
+type ContextRepository interface {
+	// WithContext returns a view of the repository that runs the operations with the context.
+	WithContext(ctx context.Context) Repository
+}
+
+// WithContext returns a view of the repository that runs the operations with the context, so the principal
+// of the context is recorded in the saved records and in the audit trail. The wrapping repositories
+// (auditing, idempotent and redacting) pass the context to the wrapped repository. If the repository does not
+// support a context, it is returned unchanged.
+func WithContext(repo Repository, ctx context.Context) Repository {
+	if r, ok := repo.(ContextRepository); ok {
+		return r.WithContext(ctx)
+	}
+	return repo
+}
+
+// ContextOption runs the operations with the context.
+func ContextOption(ctx context.Context) Option {
+	return func(options *OperationOptions) {
+		options.Context = ctx
+	}
+}
+
+// WithContext returns a copy of the MongoSession that runs the operations with the context.
+func (s *MongoSession) WithContext(ctx context.Context) Repository {
+	sessionCopy := *s
+	sessionCopy.operation.Context = ctx
+	return &sessionCopy
+}
+
+// WithContext returns a copy of the DynamoCollection that runs the operations with the context.
+func (c *DynamoCollection) WithContext(ctx context.Context) Repository {
+	collectionCopy := *c
+	collectionCopy.operation.Context = ctx
+	return &collectionCopy
+}
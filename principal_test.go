@@ -0,0 +1,53 @@
+package backends
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrincipalFromContext(t *testing.T) {
+	if _, ok := PrincipalFromContext(context.Background()); ok {
+		t.Fatal("Expected no principal")
+	}
+	ctx := WithPrincipal(context.Background(), Principal{ID: "u1", Type: PrincipalUser, Tenant: "acme"})
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.ID != "u1" || principal.Type != PrincipalUser {
+		t.Fatalf("Expected the principal. Got: %+v", principal)
+	}
+	if tenant := TenantFromContext(ctx); tenant != "acme" {
+		t.Fatal("Expected the tenant of the principal. Got: ", tenant)
+	}
+	if actor := ActorFromContext(ctx); actor != "u1" {
+		t.Fatal("Expected the principal as the actor. Got: ", actor)
+	}
+	if actor := ActorFromContext(WithActor(ctx, "admin")); actor != "admin" {
+		t.Fatal("Expected the actor set with WithActor. Got: ", actor)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx := WithPrincipal(context.Background(), Principal{ID: "u1"})
+
+	repo := &MongoSession{}
+	view, ok := WithContext(repo, ctx).(*MongoSession)
+	if !ok || view.operation.Context != ctx || repo.operation.Context != nil {
+		t.Fatal("Expected a copy of the repository with the context")
+	}
+	if withOptions := WithOptions(view, TimeoutOption(1)).(*MongoSession); withOptions.operation.Context != ctx {
+		t.Fatal("Expected the context to be kept with the options")
+	}
+
+	auditor, err := NewAuditor(&memoryRepo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := auditor.Wrap(repo, "users").WithContext(ctx).(*AuditingRepository)
+	if inner := audited.Repository.(*MongoSession); inner.operation.Context != ctx {
+		t.Fatal("Expected the context to be passed to the wrapped repository")
+	}
+
+	memory := &memoryRepo{}
+	if WithContext(memory, ctx) != memory {
+		t.Fatal("Expected the repository to be returned unchanged")
+	}
+}
@@ -0,0 +1,158 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// SortSpec is a property the records are sorted by.
+type SortSpec struct {
+	Property   string
+	Descending bool
+}
+
+// SortBy returns the sort of the order and the sorting ("asc" or "desc") parameters of GetAll.
+func SortBy(order, sorting string) []SortSpec {
+	if order == "" {
+		return nil
+	}
+	return []SortSpec{{Property: order, Descending: sorting == "desc"}}
+}
+
+// Query selects the records read by Find.
+type Query struct {
+	// Filter matches the records.
+	Filter Filter
+	// Sort are the properties the records are sorted by, in order of precedence.
+	Sort []SortSpec
+	// Limit is the maximal number of records (the page size with a cursor). All matched records are read if it is 0.
+	Limit int
+	// Offset is the number of matched records that are skipped.
+	Offset int
+	// Projection are the properties of the records to read. All properties are read if it is empty.
+	Projection []string
+	// Cursor is the cursor of the page to read, returned by the previous Find.
+	Cursor string
+}
+
+// QueryRepository is implemented by the repositories that run the Query natively.
+type QueryRepository interface {
+	// Find returns the records selected by the query and the cursor of the next page.
+	Find(query Query, resultsTypeHint interface{}) (interface{}, string, error)
+}
+
+// Find returns the records selected by the query, as GetAll does, and the cursor of the next page:
+//
+//	users, next, err := backends.Find(repo, backends.Query{
+//		Filter: backends.Filter{"team": team},
+//		Sort:   []backends.SortSpec{{Property: "lastName"}, {Property: "age", Descending: true}},
+//		Limit:  50,
+//	}, &User{})
+//
+// On the repositories that support cursors (see GetPage), the records are read page by page if the query has
+// a cursor, or a limit without an offset and a sort. The cursor of the next page is empty when there are no more
+// records, and always empty on the other repositories. Sorting by multiple properties is supported on MongoDB.
+func Find(repo Repository, query Query, resultsTypeHint interface{}) (interface{}, string, error) {
+	if r, ok := repo.(QueryRepository); ok {
+		return r.Find(query, resultsTypeHint)
+	}
+	if len(query.Projection) > 0 {
+		repo = WithOptions(repo, ProjectionOption(query.Projection...))
+	}
+
+	if r, ok := repo.(CursorRepository); ok && (query.Cursor != "" || query.Limit > 0 && query.Offset == 0 && len(query.Sort) == 0) {
+		if query.Offset != 0 || len(query.Sort) > 0 {
+			return nil, "", ErrInvalidInput("a query with a cursor cannot have an offset or a sort")
+		}
+		if query.Limit <= 0 {
+			return nil, "", ErrInvalidInput("a query with a cursor must have a limit")
+		}
+		return r.GetPage(query.Filter, resultsTypeHint, query.Limit, query.Cursor)
+	}
+	if query.Cursor != "" {
+		return nil, "", ErrInvalidInput(fmt.Sprintf("cursors are not supported on %T", repo))
+	}
+	if len(query.Sort) > 1 {
+		return nil, "", ErrInvalidInput(fmt.Sprintf("sorting by multiple properties is not supported on %T", repo))
+	}
+
+	order, sorting := "", ""
+	if len(query.Sort) == 1 {
+		order, sorting = query.Sort[0].Property, "asc"
+		if query.Sort[0].Descending {
+			sorting = "desc"
+		}
+	}
+	results, err := repo.GetAll(query.Filter, resultsTypeHint, order, sorting, query.Limit, query.Offset)
+	return results, "", err
+}
+
+// Find runs the query on the active backend.
+func (r *failoverRepository) Find(query Query, resultsTypeHint interface{}) (interface{}, string, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, "", err
+	}
+	return Find(repository, query, resultsTypeHint)
+}
+
+// Find returns the records selected by the query. MongoDB does not support cursors, so the next cursor is
+// always empty.
+func (s *MongoSession) Find(query Query, resultsTypeHint interface{}) (interface{}, string, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, "", err
+	}
+	defer done()
+
+	if query.Cursor != "" {
+		return nil, "", ErrInvalidInput(fmt.Sprintf("cursors are not supported on %T", s))
+	}
+	if err := checkQueryFields(s.repoDef, query.Filter, ""); err != nil {
+		return nil, "", err
+	}
+	for _, spec := range query.Sort {
+		if err := checkQueryFields(s.repoDef, nil, spec.Property); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, "", err
+	}
+
+	session, c := s.getReadCollection()
+	defer session.Close()
+
+	resultsTypeHint = AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultsTypeHint)
+
+	// Create a pointer to a slice value and set it to the slice
+	slicePointer := reflect.New(results.Type())
+	slicePointer.Elem().Set(results)
+
+	repo := *s
+	if len(query.Projection) > 0 {
+		repo.operation.Projection = query.Projection
+	}
+	mongoQuery, err := repo.findQuery(c, query.Filter, query.Sort, query.Limit, query.Offset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = mongoQuery.All(slicePointer.Interface())
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, "", ErrNotFound(err)
+		}
+		return nil, "", err
+	}
+	s.reportUsage("GetAll", slicePointer.Elem().Len(), 0)
+
+	if err = s.mapIDs(slicePointer.Interface()); err != nil {
+		return nil, "", err
+	}
+
+	return slicePointer.Interface(), "", nil
+}
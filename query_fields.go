@@ -0,0 +1,70 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetFilterableFields returns the properties the records may be filtered on ("filterableFields" property),
+// or nil if any property may be used in a filter.
+func (m RepositoryDefinitionMap) GetFilterableFields() []string {
+	return stringList(m["filterableFields"])
+}
+
+// GetSortableFields returns the properties the records may be sorted by ("sortableFields" property),
+// or nil if the records may be sorted by any property.
+func (m RepositoryDefinitionMap) GetSortableFields() []string {
+	return stringList(m["sortableFields"])
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// checkQueryFields checks that the filter and the order use only the declared filterable and sortable
+// properties of the repository. The key properties (id, the hash and range keys and the bootstrap key)
+// are always allowed. A declared property also allows its nested properties ("address" allows "address.city").
+// Returns ErrInvalidInput for the first property that is not allowed.
+func checkQueryFields(repoDef RepositoryDefinition, filter Filter, order string) error {
+	filterable := repoDef.GetFilterableFields()
+	if filterable != nil {
+		for property := range filter {
+			if !isQueryFieldAllowed(repoDef, filterable, property) {
+				return ErrInvalidInput(fmt.Sprintf("filtering on %s is not allowed", property))
+			}
+		}
+	}
+	sortable := repoDef.GetSortableFields()
+	if sortable != nil && order != "" {
+		property := strings.TrimPrefix(order, "-")
+		if !isQueryFieldAllowed(repoDef, sortable, property) {
+			return ErrInvalidInput(fmt.Sprintf("sorting by %s is not allowed", property))
+		}
+	}
+	return nil
+}
+
+func isQueryFieldAllowed(repoDef RepositoryDefinition, allowed []string, property string) bool {
+	keys := []string{"id", "_id", repoDef.GetHashKey(), repoDef.GetRangeKey()}
+	if bootstrap := repoDef.GetBootstrap(); bootstrap != nil {
+		keys = append(keys, bootstrap.Key...)
+	}
+	for _, field := range append(keys, allowed...) {
+		if field != "" && (property == field || strings.HasPrefix(property, field+".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package backends
+
+import "testing"
+
+func TestCheckQueryFields(t *testing.T) {
+	repoDef := RepositoryDefinitionMap{
+		"name":             "users",
+		"hashKey":          "email",
+		"filterableFields": []interface{}{"name", "address"},
+		"sortableFields":   []string{"createdAt"},
+	}
+
+	allowed := []struct {
+		filter Filter
+		order  string
+	}{
+		{NewFilter().Match("name", "john"), ""},
+		{NewFilter().Match("address.city", "Skopje"), ""},
+		{NewFilter().Match("id", "1").Match("email", "john@example.com"), ""},
+		{NewFilter(), "createdAt"},
+		{NewFilter(), "-createdAt"},
+		{nil, "email"},
+	}
+	for _, c := range allowed {
+		if err := checkQueryFields(repoDef, c.filter, c.order); err != nil {
+			t.Errorf("Expected %v ordered by %q to be allowed, got %s", c.filter, c.order, err)
+		}
+	}
+
+	rejected := []struct {
+		filter Filter
+		order  string
+	}{
+		{NewFilter().Match("password", "secret"), ""},
+		{NewFilter().Match("addresses", "x"), ""},
+		{NewFilter(), "name"},
+		{NewFilter(), "-password"},
+	}
+	for _, c := range rejected {
+		err := checkQueryFields(repoDef, c.filter, c.order)
+		if !IsErrInvalidInput(err) {
+			t.Errorf("Expected %v ordered by %q to be rejected, got %v", c.filter, c.order, err)
+		}
+	}
+}
+
+func TestCheckQueryFieldsUnrestricted(t *testing.T) {
+	repoDef := RepositoryDefinitionMap{"name": "users"}
+	if repoDef.GetFilterableFields() != nil || repoDef.GetSortableFields() != nil {
+		t.Fatal("Expected no field restrictions")
+	}
+	if err := checkQueryFields(repoDef, NewFilter().Match("password", "secret"), "-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	repoDef["filterableFields"] = []string{}
+	if err := checkQueryFields(repoDef, NewFilter().Match("name", "john"), ""); !IsErrInvalidInput(err) {
+		t.Errorf("Expected an empty list to allow the key fields only, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sortedMemoryRepo records the order and the sorting of GetAll.
+type sortedMemoryRepo struct {
+	*memoryRepo
+	order   string
+	sorting string
+}
+
+func (r *sortedMemoryRepo) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	r.order, r.sorting = order, sorting
+	return r.memoryRepo.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+// pagedMemoryRepo returns the records page by page, with the index of the next record as the cursor.
+type pagedMemoryRepo struct {
+	*memoryRepo
+}
+
+func (r *pagedMemoryRepo) GetPage(filter Filter, resultsTypeHint interface{}, pageSize int, cursor string) (interface{}, string, error) {
+	offset := 0
+	if cursor != "" {
+		offset = int(cursor[0] - '0')
+	}
+	results, _ := r.memoryRepo.GetAll(filter, resultsTypeHint, "", "", pageSize, offset)
+	next := ""
+	if offset+pageSize < len(r.records) {
+		next = string(rune('0' + offset + pageSize))
+	}
+	return results, next, nil
+}
+
+func TestFind(t *testing.T) {
+	memory := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "name": "Ann", "team": "a"},
+		{"id": "2", "name": "Bob", "team": "a"},
+		{"id": "3", "name": "Eve", "team": "b"},
+	}}
+
+	repo := &sortedMemoryRepo{memoryRepo: memory}
+	results, next, err := Find(repo, Query{
+		Filter: Filter{"team": "a"},
+		Sort:   []SortSpec{{Property: "name", Descending: true}},
+		Limit:  1,
+	}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := *results.(*[]map[string]interface{})
+	if len(records) != 1 || records[0]["name"] != "Ann" || next != "" {
+		t.Fatalf("Expected the first record of the team. Got: %v %q", records, next)
+	}
+	if repo.order != "name" || repo.sorting != "desc" {
+		t.Fatalf("Expected GetAll sorted by name descending. Got: %s %s", repo.order, repo.sorting)
+	}
+
+	if _, _, err := Find(repo, Query{Sort: []SortSpec{{Property: "team"}, {Property: "name"}}}, map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for multiple sort properties. Got: ", err)
+	}
+	if _, _, err := Find(repo, Query{Cursor: "1", Limit: 1}, map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a cursor. Got: ", err)
+	}
+}
+
+func TestFindPages(t *testing.T) {
+	repo := &pagedMemoryRepo{&memoryRepo{records: []map[string]interface{}{
+		{"id": "1"}, {"id": "2"}, {"id": "3"},
+	}}}
+
+	ids := []interface{}{}
+	query := Query{Limit: 2}
+	for {
+		results, next, err := Find(repo, query, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range *results.(*[]map[string]interface{}) {
+			ids = append(ids, record["id"])
+		}
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+	if !reflect.DeepEqual(ids, []interface{}{"1", "2", "3"}) {
+		t.Fatal("Expected all records page by page. Got: ", ids)
+	}
+
+	if _, _, err := Find(repo, Query{Cursor: "2", Offset: 1, Limit: 1}, map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a cursor with an offset. Got: ", err)
+	}
+	if _, _, err := Find(repo, Query{Cursor: "2"}, map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a cursor without a limit. Got: ", err)
+	}
+}
+
+func TestMongoSort(t *testing.T) {
+	fields := mongoSort([]SortSpec{{Property: "lastName"}, {Property: "age", Descending: true}, {}})
+	if !reflect.DeepEqual(fields, []string{"lastName", "-age"}) {
+		t.Fatal("Expected the sort fields. Got: ", fields)
+	}
+	if sort := SortBy("", "desc"); sort != nil {
+		t.Fatal("Expected no sort without an order. Got: ", sort)
+	}
+	if sort := SortBy("name", "desc"); !reflect.DeepEqual(sort, []SortSpec{{Property: "name", Descending: true}}) {
+		t.Fatal("Expected the descending sort. Got: ", sort)
+	}
+}
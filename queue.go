@@ -0,0 +1,177 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// QueueReady is the state of the messages waiting to be claimed, or claimed and not acknowledged yet.
+	QueueReady = "ready"
+	// QueueDead is the state of the messages that failed MaxAttempts times. They are not claimed again.
+	QueueDead = "dead"
+)
+
+// queueClaimAttempts is the number of messages tried by Claim when the claimed messages are moved to
+// the dead letters.
+const queueClaimAttempts = 10
+
+// QueueConfig configures the Queue.
+type QueueConfig struct {
+	// MaxAttempts is the number of times a message is claimed before it is moved to the dead letters
+	// (state QueueDead). Defaults to 5.
+	MaxAttempts int
+}
+
+// QueueMessage is a message in the queue.
+type QueueMessage struct {
+	ID      string      `json:"id,omitempty" bson:"id,omitempty"`
+	Payload interface{} `json:"payload" bson:"payload"`
+	State   string      `json:"state" bson:"state"`
+	// Attempts is the number of times the message was claimed.
+	Attempts int `json:"attempts" bson:"attempts"`
+	// VisibleAt is the time the message can be claimed (again).
+	VisibleAt  time.Time `json:"visibleAt" bson:"visibleAt"`
+	EnqueuedAt time.Time `json:"enqueuedAt" bson:"enqueuedAt"`
+	// Receipt identifies the claim of the message. Only the consumer holding the last claim can acknowledge it.
+	Receipt string `json:"receipt,omitempty" bson:"receipt,omitempty"`
+	// LastError is the reason of the last Nack.
+	LastError string `json:"lastError,omitempty" bson:"lastError,omitempty"`
+}
+
+// Decode decodes the payload of the message into the value.
+func (m *QueueMessage) Decode(value interface{}) error {
+	return MapToInterface(m.Payload, value)
+}
+
+// Queue is a persistent queue of messages kept in a repository. A message is claimed by one consumer at a
+// time with an atomic GetAndUpdate, so the repository must support atomic operations (see AtomicRepository):
+//
+//	queue := backends.NewQueue(jobsRepo, backends.QueueConfig{MaxAttempts: 3})
+//	_, err := queue.Enqueue(&Job{Report: "daily"})
+//
+//	message, err := queue.Claim(time.Minute)
+//	if err := process(message); err != nil {
+//		return queue.Nack(message, 10*time.Second, err)
+//	}
+//	return queue.Ack(message)
+//
+// A claimed message that is not acknowledged within the visibility timeout (the consumer crashed) can be
+// claimed again by another consumer. The messages are not claimed in a guaranteed order, and the times are
+// kept with the precision of a second.
+type Queue struct {
+	repo   Repository
+	config QueueConfig
+}
+
+// NewQueue returns the queue keeping the messages in the repository.
+func NewQueue(repo Repository, config QueueConfig) *Queue {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	return &Queue{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Enqueue adds a message with the payload to the queue.
+func (q *Queue) Enqueue(payload interface{}) (*QueueMessage, error) {
+	now := queueTime(time.Now())
+	message := &QueueMessage{
+		Payload:    payload,
+		State:      QueueReady,
+		VisibleAt:  now,
+		EnqueuedAt: now,
+	}
+	saved, err := q.repo.Save(message, nil)
+	if err != nil {
+		return nil, err
+	}
+	enqueued := &QueueMessage{}
+	if err := MapToInterface(saved, enqueued); err != nil {
+		return nil, err
+	}
+	return enqueued, nil
+}
+
+// Claim claims a message for the visibility timeout. The message is not claimed by other consumers until
+// it is acknowledged (Ack), returned to the queue (Nack) or the timeout passes. Returns ErrNotFound if no
+// message can be claimed.
+func (q *Queue) Claim(visibilityTimeout time.Duration) (*QueueMessage, error) {
+	if visibilityTimeout <= 0 {
+		return nil, ErrInvalidInput("the visibility timeout must be positive")
+	}
+	for attempt := 0; attempt < queueClaimAttempts; attempt++ {
+		receipt, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		now := queueTime(time.Now())
+		filter := NewFilter().Match("state", QueueReady).Until("visibleAt", now)
+		claim := map[string]interface{}{
+			// rounded up, so the message is not visible before the timeout
+			"visibleAt": queueTime(now.Add(visibilityTimeout + time.Second - 1)),
+			"receipt":   receipt.String(),
+		}
+
+		result, err := GetAndUpdate(q.repo, filter, &claim, &map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		message := &QueueMessage{}
+		if err := MapToInterface(result, message); err != nil {
+			return nil, err
+		}
+
+		// the claims of the consumers that did not acknowledge the message are counted as failures
+		if message.Attempts >= q.config.MaxAttempts {
+			if err := q.update(message, map[string]interface{}{"state": QueueDead}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		message.Attempts++
+		if err := q.update(message, map[string]interface{}{"attempts": message.Attempts}); err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+	return nil, ErrNotFound(fmt.Sprintf("no message claimed after %d attempts", queueClaimAttempts))
+}
+
+// Ack acknowledges the processed message and deletes it from the queue. Returns ErrNotFound if the
+// visibility timeout passed and the message was claimed again.
+func (q *Queue) Ack(message *QueueMessage) error {
+	return q.repo.DeleteOne(Filter{"id": message.ID, "receipt": message.Receipt})
+}
+
+// Nack returns the message that failed to the queue, to be claimed again after the delay. A message that
+// failed MaxAttempts times is moved to the dead letters. Returns ErrNotFound if the visibility timeout
+// passed and the message was claimed again.
+func (q *Queue) Nack(message *QueueMessage, delay time.Duration, reason error) error {
+	update := map[string]interface{}{
+		"visibleAt": queueTime(time.Now().Add(delay)),
+		"receipt":   "",
+	}
+	if reason != nil {
+		update["lastError"] = reason.Error()
+	}
+	if message.Attempts >= q.config.MaxAttempts {
+		update["state"] = QueueDead
+	}
+	return q.update(message, update)
+}
+
+// update updates the message, if it is still claimed with the receipt of the message.
+func (q *Queue) update(message *QueueMessage, update map[string]interface{}) error {
+	_, err := q.repo.Save(&update, Filter{"id": message.ID, "receipt": message.Receipt})
+	return err
+}
+
+// queueTime truncates the time to seconds, so the times stored as strings are compared correctly.
+func queueTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
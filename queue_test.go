@@ -0,0 +1,111 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// queueMemoryRepo is a memoryRepo generating the ids and supporting GetAndUpdate with the date ranges.
+type queueMemoryRepo struct {
+	*memoryRepo
+	next int
+}
+
+func (r *queueMemoryRepo) Save(object interface{}, filter Filter) (interface{}, error) {
+	if filter != nil {
+		return r.memoryRepo.Save(object, filter)
+	}
+	payload, err := InterfaceToMap(object)
+	if err != nil {
+		return nil, err
+	}
+	r.next++
+	(*payload)["id"] = fmt.Sprint(r.next)
+	return r.memoryRepo.Save(payload, nil)
+}
+
+func (r *queueMemoryRepo) PopOne(filter Filter, result interface{}) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *queueMemoryRepo) GetAndUpdate(filter Filter, update interface{}, result interface{}) (interface{}, error) {
+	payload, err := InterfaceToMap(update)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range r.records {
+		if matchesDatedFilter(record, filter) {
+			for k, v := range *payload {
+				record[k] = v
+			}
+			return result, MapToInterface(record, result)
+		}
+	}
+	return nil, ErrNotFound("not found")
+}
+
+func TestQueue(t *testing.T) {
+	repo := &queueMemoryRepo{memoryRepo: &memoryRepo{}}
+	queue := NewQueue(repo, QueueConfig{})
+
+	if _, err := queue.Enqueue(map[string]interface{}{"report": "daily"}); err != nil {
+		t.Fatal(err)
+	}
+	message, err := queue.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := map[string]interface{}{}
+	if err := message.Decode(&job); err != nil || job["report"] != "daily" || message.Attempts != 1 {
+		t.Fatal("Expected the claimed message. Got: ", message, job, err)
+	}
+	if _, err := queue.Claim(time.Minute); !IsErrNotFound(err) {
+		t.Fatal("Expected the claimed message not to be claimed again. Got: ", err)
+	}
+
+	if err := queue.Nack(message, 0, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	retried, err := queue.Claim(time.Minute)
+	if err != nil || retried.ID != message.ID || retried.Attempts != 2 || retried.LastError != "failed" {
+		t.Fatal("Expected the message to be claimed again. Got: ", retried, err)
+	}
+	if err := queue.Ack(message); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound for an old claim. Got: ", err)
+	}
+	if err := queue.Ack(retried); err != nil || len(repo.records) != 0 {
+		t.Fatal("Expected the message to be deleted. Got: ", repo.records, err)
+	}
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	repo := &queueMemoryRepo{memoryRepo: &memoryRepo{}}
+	queue := NewQueue(repo, QueueConfig{MaxAttempts: 2})
+	if _, err := queue.Enqueue(map[string]interface{}{"report": "daily"}); err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := queue.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the consumer crashed and the visibility timeout passed
+	repo.records[0]["visibleAt"] = time.Now().Add(-time.Minute)
+	if message, err = queue.Claim(time.Minute); err != nil || message.Attempts != 2 {
+		t.Fatal("Expected the message to be claimed again. Got: ", message, err)
+	}
+	if err := queue.Nack(message, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if repo.records[0]["state"] != QueueDead {
+		t.Fatal("Expected the message to be moved to the dead letters. Got: ", repo.records[0])
+	}
+	if _, err := queue.Claim(time.Minute); !IsErrNotFound(err) {
+		t.Fatal("Expected the dead letters not to be claimed. Got: ", err)
+	}
+	if _, err := NewQueue(&memoryRepo{}, QueueConfig{}).Claim(time.Minute); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a repository without atomic operations. Got: ", err)
+	}
+}
@@ -0,0 +1,172 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RawQueryRepository is implemented by the repositories that can execute backend specific queries.
+type RawQueryRepository interface {
+	// ExecuteRaw executes the query and returns the results as a slice of the type of the hint.
+	ExecuteRaw(query interface{}, resultsTypeHint interface{}) (interface{}, error)
+}
+
+// ExecuteRaw executes a backend specific query on the repository and maps the results with MapToInterface
+// into a slice of the type of the hint, as GetAll does. The query is:
+//
+//	MongoDB: an aggregation pipeline ([]bson.M) or a find filter (bson.M)
+//	DynamoDB: a *dynamodb.QueryInput or *dynamodb.ScanInput (the table name defaults to the table of the repository)
+//
+// For example:
+//
+//	results, err := backends.ExecuteRaw(ordersRepo, []bson.M{
+//		{"$match": bson.M{"status": "paid"}},
+//		{"$group": bson.M{"_id": "$customer", "total": bson.M{"$sum": "$amount"}}},
+//	}, &CustomerTotal{})
+//	totals := results.([]*CustomerTotal)
+func ExecuteRaw(repo Repository, query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	if r, ok := repo.(RawQueryRepository); ok {
+		return r.ExecuteRaw(query, resultsTypeHint)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("raw queries are not supported on %T", repo))
+}
+
+// mapRawResults maps the records into a slice of the type of the hint.
+func mapRawResults(records []map[string]interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	resultHint := AsPtr(resultsTypeHint)
+	results := NewSliceOfType(resultHint)
+	for _, item := range records {
+		record, err := CreateNewAsExample(resultHint)
+		if err != nil {
+			return nil, err
+		}
+		if err = MapToInterface(item, record); err != nil {
+			return nil, err
+		}
+		results = reflect.Append(results, reflect.ValueOf(record))
+	}
+	return results.Interface(), nil
+}
+
+// mongoRawQuery returns the aggregation pipeline or the find filter of a raw MongoDB query.
+func mongoRawQuery(query interface{}) (pipeline interface{}, filter interface{}, err error) {
+	switch q := query.(type) {
+	case []bson.M, []interface{}, []map[string]interface{}:
+		return q, nil, nil
+	case bson.M, map[string]interface{}:
+		return nil, q, nil
+	case Filter:
+		filter, err := toMongoFilter(q)
+		if err != nil {
+			return nil, nil, ErrInvalidInput(err)
+		}
+		return nil, filter, nil
+	}
+	return nil, nil, ErrInvalidInput(fmt.Sprintf("unsupported MongoDB query %T, expected a pipeline or a filter", query))
+}
+
+// ExecuteRaw runs an aggregation pipeline or a find filter on the collection. The ObjectId in _id
+// is mapped to id as in GetAll.
+func (s *MongoSession) ExecuteRaw(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	pipeline, filter, err := mongoRawQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, c := s.getReadCollection()
+	defer session.Close()
+
+	documents := []bson.M{}
+	if pipeline != nil {
+		err = c.Pipe(pipeline).All(&documents)
+	} else {
+		err = c.Find(filter).All(&documents)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for _, document := range documents {
+		records = append(records, map[string]interface{}(document))
+	}
+	if err = s.mapIDs(records); err != nil {
+		return nil, err
+	}
+	return mapRawResults(records, resultsTypeHint)
+}
+
+// ExecuteRaw runs a Query or a Scan request on the table, following the pagination keys unless the
+// request has a Limit. PartiQL statements are not supported by the AWS SDK version of the backend.
+// Expired records are not filtered out.
+func (c *DynamoCollection) ExecuteRaw(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	done, err := c.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if c.session == nil {
+		return nil, ErrBackendError("dynamo session not configured")
+	}
+	svc := dynamodb.New(c.session)
+
+	items := []map[string]*dynamodb.AttributeValue{}
+	switch input := query.(type) {
+	case *dynamodb.QueryInput:
+		if input.TableName == nil {
+			input.TableName = aws.String(c.RepositoryDefinition.GetName())
+		}
+		err = svc.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			items = append(items, page.Items...)
+			return input.Limit == nil
+		})
+	case *dynamodb.ScanInput:
+		if input.TableName == nil {
+			input.TableName = aws.String(c.RepositoryDefinition.GetName())
+		}
+		err = svc.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			items = append(items, page.Items...)
+			return input.Limit == nil
+		})
+	case string:
+		return nil, ErrInvalidInput("PartiQL statements are not supported, use a *dynamodb.QueryInput or *dynamodb.ScanInput")
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("unsupported DynamoDB query %T, expected a *dynamodb.QueryInput or *dynamodb.ScanInput", query))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for _, item := range items {
+		record, err := unmarshalRecord(item)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return mapRawResults(records, resultsTypeHint)
+}
+
+// ExecuteRaw executes the query on the active backend.
+func (r *failoverRepository) ExecuteRaw(query interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return ExecuteRaw(repository, query, resultsTypeHint)
+}
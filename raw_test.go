@@ -0,0 +1,53 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type rawTotal struct {
+	Customer string  `json:"_id"`
+	Total    float64 `json:"total"`
+}
+
+func TestMapRawResults(t *testing.T) {
+	results, err := mapRawResults([]map[string]interface{}{
+		{"_id": "john", "total": 10.5},
+		{"_id": "jane", "total": 3.0},
+	}, &rawTotal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := results.([]*rawTotal)
+	if len(totals) != 2 || totals[0].Customer != "john" || totals[0].Total != 10.5 {
+		t.Fatal("Unexpected results: ", totals)
+	}
+}
+
+func TestMongoRawQuery(t *testing.T) {
+	if pipeline, _, err := mongoRawQuery([]bson.M{{"$match": bson.M{"status": "paid"}}}); err != nil || pipeline == nil {
+		t.Fatal("Expected a pipeline: ", err)
+	}
+	if _, filter, err := mongoRawQuery(bson.M{"status": "paid"}); err != nil || filter == nil {
+		t.Fatal("Expected a filter: ", err)
+	}
+	if _, _, err := mongoRawQuery("db.orders.find()"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for an unsupported query. Got: ", err)
+	}
+}
+
+func TestDynamoExecuteRawUnsupported(t *testing.T) {
+	users := testTxCollection(t, RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+
+	if _, err := ExecuteRaw(users, `SELECT * FROM "users"`, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a PartiQL statement. Got: ", err)
+	}
+	if _, err := ExecuteRaw(users, &dynamodb.GetItemInput{}, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for an unsupported request. Got: ", err)
+	}
+	if _, err := ExecuteRaw(&memoryRepo{}, bson.M{}, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected error for a repository without raw queries. Got: ", err)
+	}
+}
@@ -0,0 +1,85 @@
+package backends
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+)
+
+// ReadPreference defines to which members of a replica set the read operations are routed.
+type ReadPreference string
+
+const (
+	// ReadPrimary routes all reads to the primary.
+	ReadPrimary ReadPreference = "primary"
+	// ReadPrimaryPreferred reads from the primary if available, otherwise from a secondary.
+	ReadPrimaryPreferred ReadPreference = "primaryPreferred"
+	// ReadSecondary routes all reads to secondaries.
+	ReadSecondary ReadPreference = "secondary"
+	// ReadSecondaryPreferred reads from a secondary if available, otherwise from the primary.
+	ReadSecondaryPreferred ReadPreference = "secondaryPreferred"
+	// ReadNearest reads from the member with the lowest latency.
+	ReadNearest ReadPreference = "nearest"
+)
+
+var mongoReadModes = map[ReadPreference]mgo.Mode{
+	ReadPrimary:            mgo.Primary,
+	ReadPrimaryPreferred:   mgo.PrimaryPreferred,
+	ReadSecondary:          mgo.Secondary,
+	ReadSecondaryPreferred: mgo.SecondaryPreferred,
+	ReadNearest:            mgo.Nearest,
+}
+
+// ReadPreferenceRepository is implemented by the repositories that can route reads
+// according to a ReadPreference.
+type ReadPreferenceRepository interface {
+	// WithReadPreference returns a view of the repository that uses the given read preference
+	// for GetOne and GetAll. Writes always go to the primary.
+	WithReadPreference(preference ReadPreference) Repository
+}
+
+// WithReadPreference returns a view of the repository that routes the reads according to the
+// given preference. For example, to run a heavy report on the secondaries:
+// 		results, err := backends.WithReadPreference(repo, backends.ReadSecondaryPreferred).GetAll(...)
+// If the repository does not support read preferences (DynamoDB), it is returned unchanged.
+func WithReadPreference(repo Repository, preference ReadPreference) Repository {
+	if r, ok := repo.(ReadPreferenceRepository); ok {
+		return r.WithReadPreference(preference)
+	}
+	return repo
+}
+
+// GetReadPreference returns the default read preference for the repository ("readPreference" property).
+func (m RepositoryDefinitionMap) GetReadPreference() string {
+	if preference, ok := m["readPreference"]; ok {
+		return preference.(string)
+	}
+	return ""
+}
+
+// WithReadPreference returns a copy of the MongoSession that reads with the given preference.
+func (s *MongoSession) WithReadPreference(preference ReadPreference) Repository {
+	sessionCopy := *s
+	sessionCopy.readPreference = preference
+	return &sessionCopy
+}
+
+// getReadCollection returns the collection and a session (to be closed after) for read operations.
+// The session mode is set according to the read preference of the repository, except in a Session.
+func (s *MongoSession) getReadCollection() (*mgo.Session, *mgo.Collection) {
+	session, c := s.GetCollection()
+	if mode, ok := mongoReadModes[s.readPreference]; ok && s.pinned == nil {
+		session.SetMode(mode, false)
+	}
+	return session, c
+}
+
+func validReadPreference(preference string) error {
+	if preference == "" {
+		return nil
+	}
+	if _, ok := mongoReadModes[ReadPreference(preference)]; !ok {
+		return ErrInvalidInput(fmt.Sprintf("unknown read preference %s", preference))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package backends
+
+import "testing"
+
+func TestWithReadPreference(t *testing.T) {
+	repo := &MongoSession{
+		repoDef: RepositoryDefinitionMap{"readPreference": "primary"},
+	}
+
+	secondary, ok := WithReadPreference(repo, ReadSecondaryPreferred).(*MongoSession)
+	if !ok {
+		t.Fatal("Expected a MongoSession")
+	}
+	if secondary.readPreference != ReadSecondaryPreferred {
+		t.Fatal("Expected secondaryPreferred. Got: ", secondary.readPreference)
+	}
+	if repo.readPreference != "" {
+		t.Fatal("Expected the original repository to be unchanged")
+	}
+
+	dynamoRepo := &DynamoCollection{}
+	if WithReadPreference(dynamoRepo, ReadSecondary) != dynamoRepo {
+		t.Fatal("Expected the repository to be returned unchanged")
+	}
+}
+
+func TestValidReadPreference(t *testing.T) {
+	if err := validReadPreference("nearest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validReadPreference("somewhere"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected invalid input. Got: ", err)
+	}
+}
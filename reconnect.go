@@ -0,0 +1,223 @@
+package backends
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// MONGO_CONNECTOR_CTX_KEY is the backend context key for the lazy MongoDB connector.
+var MONGO_CONNECTOR_CTX_KEY = "MONGO_CONNECTOR"
+
+// ErrBackendUnavailable is an error class for errors returned when the backend is not (yet) connected to the database.
+var ErrBackendUnavailable = ErrorClass("backend unavailable")
+
+// IsErrBackendUnavailable check of the error is of the ErrBackendUnavailable class.
+func IsErrBackendUnavailable(err error) bool {
+	return IsErrorOfType(err, ErrBackendUnavailable(""))
+}
+
+const (
+	defaultReconnectInitialInterval = 1 * time.Second
+	defaultReconnectMaxInterval     = 1 * time.Minute
+)
+
+// mongoConnectFn dials the database and returns the session and the detected server capabilities.
+type mongoConnectFn func() (*mgo.Session, *Capabilities, error)
+
+// permanentError is a connection error that retrying does not fix, for example a required feature that the
+// server does not support.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// unwrapPermanent returns the cause of a permanentError, or the error itself.
+func unwrapPermanent(err error) error {
+	if permanent, ok := err.(*permanentError); ok {
+		return permanent.err
+	}
+	return err
+}
+
+// mongoConnector connects to MongoDB in the background, retrying with exponential backoff
+// until the connection succeeds or the connector is closed.
+type mongoConnector struct {
+	connect         mongoConnectFn
+	database        string
+	initialInterval time.Duration
+	maxInterval     time.Duration
+
+	session      *mgo.Session
+	capabilities *Capabilities
+	lastErr      error
+	failed       error
+	onConnect    []func(session *mgo.Session)
+	closed       bool
+	stop         chan struct{}
+	mutex        *sync.Mutex
+}
+
+func newMongoConnector(connect mongoConnectFn, database string, initialInterval, maxInterval time.Duration) *mongoConnector {
+	if initialInterval <= 0 {
+		initialInterval = defaultReconnectInitialInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = defaultReconnectMaxInterval
+	}
+	if maxInterval < initialInterval {
+		maxInterval = initialInterval
+	}
+	return &mongoConnector{
+		connect:         connect,
+		database:        database,
+		initialInterval: initialInterval,
+		maxInterval:     maxInterval,
+		stop:            make(chan struct{}),
+		mutex:           &sync.Mutex{},
+	}
+}
+
+// start begins connecting in the background.
+func (c *mongoConnector) start() {
+	Events.Publish(&Event{
+		Type:     EventBackendDegraded,
+		Backend:  "mongodb",
+		Database: c.database,
+		Error:    ErrBackendUnavailable("connecting"),
+	})
+	go c.run()
+}
+
+func (c *mongoConnector) run() {
+	interval := c.initialInterval
+	for {
+		session, capabilities, err := c.connect()
+		if err == nil {
+			c.connected(session, capabilities)
+			return
+		}
+		if permanent, ok := err.(*permanentError); ok {
+			c.mutex.Lock()
+			c.failed = permanent.err
+			c.mutex.Unlock()
+			log.Printf("ERROR: failed to connect to MongoDB, not retrying: %s\n", permanent.err.Error())
+			return
+		}
+
+		c.mutex.Lock()
+		c.lastErr = err
+		c.mutex.Unlock()
+		log.Printf("WARN: failed to connect to MongoDB, retrying in %s: %s\n", interval, err.Error())
+
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(interval):
+		}
+		interval = nextBackoff(interval, c.maxInterval)
+	}
+}
+
+func (c *mongoConnector) connected(session *mgo.Session, capabilities *Capabilities) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		session.Close()
+		return
+	}
+	c.session = session
+	c.capabilities = capabilities
+	c.lastErr = nil
+	callbacks := c.onConnect
+	c.onConnect = nil
+	c.mutex.Unlock()
+
+	log.Println("Connected to MongoDB.")
+	Events.Publish(&Event{
+		Type:     EventBackendConnected,
+		Backend:  "mongodb",
+		Database: c.database,
+	})
+
+	for _, callback := range callbacks {
+		callback(session)
+	}
+}
+
+// current returns the session, or nil if not connected yet.
+func (c *mongoConnector) current() *mgo.Session {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.session
+}
+
+// get returns the session, or ErrBackendUnavailable if not connected yet. If the connection failed
+// permanently, the error of the connection is returned.
+func (c *mongoConnector) get() (*mgo.Session, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.session != nil {
+		return c.session, nil
+	}
+	if c.failed != nil {
+		return nil, c.failed
+	}
+	if c.lastErr != nil {
+		return nil, ErrBackendUnavailable(c.lastErr)
+	}
+	return nil, ErrBackendUnavailable("connecting")
+}
+
+// whenConnected calls the callback once the connection is established. If already connected, the
+// callback is called immediately.
+func (c *mongoConnector) whenConnected(callback func(session *mgo.Session)) {
+	c.mutex.Lock()
+	session := c.session
+	if session == nil {
+		c.onConnect = append(c.onConnect, callback)
+	}
+	c.mutex.Unlock()
+
+	if session != nil {
+		callback(session)
+	}
+}
+
+// Capabilities returns the capabilities of the server, or empty capabilities if not connected yet.
+func (c *mongoConnector) Capabilities() *Capabilities {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.capabilities == nil {
+		return &Capabilities{}
+	}
+	return c.capabilities
+}
+
+// close stops the connection retries and closes the session.
+func (c *mongoConnector) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.stop)
+	if c.session != nil {
+		c.session.Close()
+	}
+}
+
+// nextBackoff doubles the retry interval, up to max.
+func nextBackoff(interval, max time.Duration) time.Duration {
+	interval *= 2
+	if interval > max {
+		return max
+	}
+	return interval
+}
@@ -0,0 +1,92 @@
+package backends
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestNextBackoff(t *testing.T) {
+	if next := nextBackoff(time.Second, time.Minute); next != 2*time.Second {
+		t.Fatal("Expected the interval to double. Got: ", next)
+	}
+	if next := nextBackoff(40*time.Second, time.Minute); next != time.Minute {
+		t.Fatal("Expected the interval to be capped. Got: ", next)
+	}
+}
+
+func TestMongoConnectorRetries(t *testing.T) {
+	attempts := make(chan int, 10)
+	count := 0
+	session := &mgo.Session{}
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		count++
+		attempts <- count
+		if count < 3 {
+			return nil, nil, fmt.Errorf("no reachable servers")
+		}
+		return session, &Capabilities{ServerVersion: "4.2.0"}, nil
+	}, "test", time.Millisecond, 5*time.Millisecond)
+
+	if _, err := connector.get(); err == nil || !IsErrBackendUnavailable(err) {
+		t.Fatal("Expected ErrBackendUnavailable before connecting. Got: ", err)
+	}
+
+	connected := make(chan *mgo.Session, 1)
+	connector.whenConnected(func(s *mgo.Session) {
+		connected <- s
+	})
+
+	connector.start()
+
+	select {
+	case s := <-connected:
+		if s != session {
+			t.Fatal("Expected the connected session")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connector to connect")
+	}
+
+	if len(attempts) != 3 {
+		t.Fatal("Expected 3 attempts. Got: ", len(attempts))
+	}
+	if s, err := connector.get(); err != nil || s != session {
+		t.Fatal("Expected the session once connected. Got: ", err)
+	}
+	if connector.Capabilities().ServerVersion != "4.2.0" {
+		t.Fatal("Expected the detected capabilities")
+	}
+}
+
+func TestMongoConnectorClose(t *testing.T) {
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		return nil, nil, fmt.Errorf("no reachable servers")
+	}, "test", time.Millisecond, time.Millisecond)
+	connector.start()
+	connector.close()
+	connector.close()
+
+	if _, err := connector.get(); !IsErrBackendUnavailable(err) {
+		t.Fatal("Expected ErrBackendUnavailable. Got: ", err)
+	}
+}
+
+func TestMongoConnectorPermanentError(t *testing.T) {
+	attempts := 0
+	required := ErrBackendError("Transactions are required but not supported by the server")
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		attempts++
+		return nil, nil, &permanentError{required}
+	}, "test", time.Millisecond, time.Millisecond)
+	connector.run()
+
+	if attempts != 1 {
+		t.Fatal("Expected no retries after a permanent error. Got attempts: ", attempts)
+	}
+	if _, err := connector.get(); err != required {
+		t.Fatal("Expected the permanent error. Got: ", err)
+	}
+}
@@ -0,0 +1,243 @@
+package backends
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ROLE_CTX_KEY is the context key for the role of the caller, used by the redaction policies.
+var ROLE_CTX_KEY = "BACKENDS_CALLER_ROLE"
+
+// WithRole returns a copy of the context that carries the role of the caller.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, ROLE_CTX_KEY, role)
+}
+
+// RoleFromContext returns the role of the caller, or empty string if not set.
+func RoleFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if role, ok := ctx.Value(ROLE_CTX_KEY).(string); ok {
+		return role
+	}
+	return ""
+}
+
+// RedactionRule lists the properties removed (Strip) or replaced with their SHA-256 hash (Hash)
+// from the results. The properties are matched by the name of the map key, or by the
+// bson/json name of the struct field.
+type RedactionRule struct {
+	Strip []string
+	Hash  []string
+}
+
+// RedactionPolicy defines the redaction rules per caller role.
+type RedactionPolicy struct {
+	// Rules maps the role to the redaction rule for that role. Roles mapped to nil see the full records.
+	Rules map[string]*RedactionRule
+
+	// Default is applied to callers with a role that has no entry in Rules, and to callers without a role.
+	Default *RedactionRule
+
+	// RoleResolver returns the role of the caller from the context. Defaults to RoleFromContext.
+	RoleResolver func(ctx context.Context) string
+}
+
+// RuleFor returns the redaction rule for the role, or nil if nothing should be redacted.
+func (p *RedactionPolicy) RuleFor(role string) *RedactionRule {
+	if rule, ok := p.Rules[role]; ok {
+		return rule
+	}
+	return p.Default
+}
+
+// Redact removes or hashes the properties of the value according to the rule for the given role.
+// The value can be a map, a pointer to a struct or map, or a slice of those; it is modified in place.
+func (p *RedactionPolicy) Redact(role string, value interface{}) error {
+	rule := p.RuleFor(role)
+	if rule == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(value), rule)
+}
+
+func (p *RedactionPolicy) roleFrom(ctx context.Context) string {
+	if p.RoleResolver != nil {
+		return p.RoleResolver(ctx)
+	}
+	return RoleFromContext(ctx)
+}
+
+// RedactingRepository wraps a Repository and redacts the results based on the role of the caller.
+// The role is taken from the context bound with WithContext:
+// 		repo := backends.NewRedactingRepository(usersRepo, policy)
+// 		user, err := repo.WithContext(ctx).GetOne(filter, &User{})
+type RedactingRepository struct {
+	Repository
+	policy *RedactionPolicy
+	ctx    context.Context
+}
+
+// NewRedactingRepository wraps the repository with the redaction policy.
+// Without a bound context, the results are redacted with the Default rule of the policy.
+func NewRedactingRepository(repo Repository, policy *RedactionPolicy) *RedactingRepository {
+	return &RedactingRepository{
+		Repository: repo,
+		policy:     policy,
+		ctx:        context.Background(),
+	}
+}
+
+// WithContext returns a copy of the repository that redacts the results for the caller in the context.
+func (r *RedactingRepository) WithContext(ctx context.Context) Repository {
+	return &RedactingRepository{
+		Repository: WithContext(r.Repository, ctx),
+		policy:     r.policy,
+		ctx:        ctx,
+	}
+}
+
+// GetOne fetches one record and redacts it.
+func (r *RedactingRepository) GetOne(filter Filter, result interface{}) (interface{}, error) {
+	record, err := r.Repository.GetOne(filter, result)
+	if err != nil {
+		return nil, err
+	}
+	return r.redact(record)
+}
+
+// GetAll fetches the matched records and redacts them.
+func (r *RedactingRepository) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	records, err := r.Repository.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return r.redact(records)
+}
+
+// Save saves the object and redacts the returned record.
+func (r *RedactingRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	record, err := r.Repository.Save(object, filter)
+	if err != nil {
+		return nil, err
+	}
+	return r.redact(record)
+}
+
+func (r *RedactingRepository) redact(value interface{}) (interface{}, error) {
+	if err := r.policy.Redact(r.policy.roleFrom(r.ctx), value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func redactValue(value reflect.Value, rule *RedactionRule) error {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return redactValue(value.Elem(), rule)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := redactValue(value.Index(i), rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		return redactMap(value, rule)
+	case reflect.Struct:
+		return redactStruct(value, rule)
+	}
+	return ErrInvalidInput(fmt.Sprintf("cannot redact value of type %s", value.Type()))
+}
+
+func redactMap(value reflect.Value, rule *RedactionRule) error {
+	if value.Type().Key().Kind() != reflect.String {
+		return ErrInvalidInput("cannot redact map with non-string keys")
+	}
+	for _, name := range rule.Strip {
+		value.SetMapIndex(reflect.ValueOf(name).Convert(value.Type().Key()), reflect.Value{})
+	}
+	for _, name := range rule.Hash {
+		key := reflect.ValueOf(name).Convert(value.Type().Key())
+		prop := value.MapIndex(key)
+		if !prop.IsValid() {
+			continue
+		}
+		hashed := reflect.ValueOf(redactionHash(prop.Interface()))
+		if !hashed.Type().AssignableTo(value.Type().Elem()) {
+			value.SetMapIndex(key, reflect.Zero(value.Type().Elem()))
+			continue
+		}
+		value.SetMapIndex(key, hashed)
+	}
+	return nil
+}
+
+func redactStruct(value reflect.Value, rule *RedactionRule) error {
+	if !value.CanSet() {
+		return ErrInvalidInput("cannot redact struct value, pass a pointer")
+	}
+	valueType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		name := fieldName(valueType.Field(i))
+		switch {
+		case containsString(rule.Strip, name):
+			field.Set(reflect.Zero(field.Type()))
+		case containsString(rule.Hash, name):
+			if field.Kind() == reflect.String {
+				field.SetString(redactionHash(field.Interface()))
+			} else {
+				// only string fields can hold the hash
+				field.Set(reflect.Zero(field.Type()))
+			}
+		}
+	}
+	return nil
+}
+
+// fieldName returns the property name of the struct field, the same way InterfaceToMap resolves it.
+func fieldName(field reflect.StructField) string {
+	if name, _ := fieldTag(field); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// fieldTag returns the name and the options of the bson tag of the field, or of the json tag if there is
+// no bson tag.
+func fieldTag(field reflect.StructField) (string, string) {
+	tag, ok := field.Tag.Lookup("bson")
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+	if comma := strings.Index(tag, ","); comma >= 0 {
+		return tag[:comma], tag[comma+1:]
+	}
+	return tag, ""
+}
+
+func redactionHash(value interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v", value)))
+	return hex.EncodeToString(sum[:])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
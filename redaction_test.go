@@ -0,0 +1,94 @@
+package backends
+
+import (
+	"context"
+	"testing"
+)
+
+type redactedUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	Age   int    `json:"age"`
+}
+
+var redactionPolicy = &RedactionPolicy{
+	Rules: map[string]*RedactionRule{
+		"admin": nil,
+	},
+	Default: &RedactionRule{
+		Strip: []string{"phone", "age"},
+		Hash:  []string{"email"},
+	},
+}
+
+func TestRedactStruct(t *testing.T) {
+	user := &redactedUser{ID: "1", Email: "john@example.com", Phone: "555", Age: 30}
+	if err := redactionPolicy.Redact("user", user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Phone != "" || user.Age != 0 {
+		t.Fatal("Expected phone and age to be stripped. Got: ", user)
+	}
+	if user.Email == "john@example.com" || user.Email != redactionHash("john@example.com") {
+		t.Fatal("Expected the email to be hashed. Got: ", user.Email)
+	}
+	if user.ID != "1" {
+		t.Fatal("Expected the id to be kept")
+	}
+
+	admin := &redactedUser{ID: "1", Email: "john@example.com", Phone: "555", Age: 30}
+	if err := redactionPolicy.Redact("admin", admin); err != nil {
+		t.Fatal(err)
+	}
+	if admin.Phone != "555" || admin.Email != "john@example.com" {
+		t.Fatal("Expected no redaction for admin. Got: ", admin)
+	}
+
+	if err := redactionPolicy.Redact("user", redactedUser{}); err == nil {
+		t.Fatal("Expected an error for a struct passed by value")
+	}
+}
+
+func TestRedactingRepository(t *testing.T) {
+	repo := NewRedactingRepository(&memoryRepo{
+		records: []map[string]interface{}{
+			{"id": "1", "email": "john@example.com", "phone": "555"},
+			{"id": "2", "email": "jane@example.com", "phone": "556"},
+		},
+	}, redactionPolicy)
+
+	all, err := repo.WithContext(WithRole(context.Background(), "user")).GetAll(nil, map[string]interface{}{}, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := *(all.(*[]map[string]interface{}))
+	if len(records) != 2 {
+		t.Fatal("Expected 2 records. Got: ", len(records))
+	}
+	for _, record := range records {
+		if _, ok := record["phone"]; ok {
+			t.Fatal("Expected the phone to be stripped. Got: ", record)
+		}
+		if record["email"] == "john@example.com" || record["email"] == "jane@example.com" {
+			t.Fatal("Expected the email to be hashed. Got: ", record)
+		}
+	}
+
+	user, err := repo.WithContext(WithRole(context.Background(), "admin")).GetOne(Filter{"id": "1"}, &redactedUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.(*redactedUser).Phone != "555" {
+		t.Fatal("Expected the full record for admin. Got: ", user)
+	}
+
+	// no role in the context
+	user, err = repo.GetOne(Filter{"id": "2"}, &redactedUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.(*redactedUser).Phone != "" {
+		t.Fatal("Expected the default rule to apply. Got: ", user)
+	}
+}
@@ -0,0 +1,419 @@
+package backends
+
+import "fmt"
+
+// The types of the relations between the repositories.
+const (
+	// RelationHasMany relates a record to the records of another repository holding its id in the foreign key.
+	RelationHasMany = "hasMany"
+	// RelationBelongsTo relates a record to the record of another repository with the id in its foreign key.
+	RelationBelongsTo = "belongsTo"
+)
+
+// What happens to the related records of a hasMany relation when a record is deleted.
+const (
+	// OnDeleteRestrict fails the delete with ErrConflict if the record has related records. This is the default.
+	OnDeleteRestrict = "restrict"
+	// OnDeleteCascade deletes the related records, and their related records.
+	OnDeleteCascade = "cascade"
+	// OnDeleteNullify sets the foreign key of the related records to null.
+	OnDeleteNullify = "nullify"
+)
+
+// Relation is a relation of the records of a repository to the records of another repository.
+type Relation struct {
+	// Name is the name of the relation, for example "orders".
+	Name string `json:"-" yaml:"-"`
+	// Type is RelationHasMany or RelationBelongsTo.
+	Type string `json:"type" yaml:"type"`
+	// Repository is the name of the related repository.
+	Repository string `json:"repository" yaml:"repository"`
+	// ForeignKey is the property holding the id of the related record: in the records of the related
+	// repository for hasMany, in the records of this repository for belongsTo.
+	ForeignKey string `json:"foreignKey" yaml:"foreignKey"`
+	// OnDelete is OnDeleteRestrict (the default), OnDeleteCascade or OnDeleteNullify. Only for hasMany.
+	OnDelete string `json:"onDelete,omitempty" yaml:"onDelete,omitempty"`
+}
+
+// GetRelations returns the relations of the repository (property "relations"), sorted by name. The
+// relations are given as a map of the relation name to *Relation, or to a map:
+//
+//	"relations": map[string]interface{}{
+//		"orders": map[string]interface{}{"type": "hasMany", "repository": "orders", "foreignKey": "userId", "onDelete": "cascade"},
+//	}
+func (m RepositoryDefinitionMap) GetRelations() []*Relation {
+	if value, ok := m["relations"]; ok {
+		relations, err := parseRelations(value)
+		if err != nil {
+			panic(err)
+		}
+		return relations
+	}
+	return nil
+}
+
+func parseRelations(value interface{}) ([]*Relation, error) {
+	named := map[string]interface{}{}
+	switch rv := value.(type) {
+	case map[string]*Relation:
+		for name, relation := range rv {
+			named[name] = relation
+		}
+	case map[string]interface{}:
+		named = rv
+	default:
+		return nil, ErrInvalidInput(fmt.Sprintf("invalid relations %v", value))
+	}
+
+	relations := []*Relation{}
+	for _, name := range sortedKeys(named) {
+		relation := &Relation{}
+		switch r := named[name].(type) {
+		case *Relation:
+			*relation = *r
+		case Relation:
+			*relation = r
+		case map[string]interface{}:
+			options := BackendOptions(r)
+			relation.Type = options.GetString("type")
+			relation.Repository = options.GetString("repository")
+			relation.ForeignKey = options.GetString("foreignKey")
+			relation.OnDelete = options.GetString("onDelete")
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid relation %s: %v", name, named[name]))
+		}
+		relation.Name = name
+		if err := relation.validate(); err != nil {
+			return nil, err
+		}
+		relations = append(relations, relation)
+	}
+	return relations, nil
+}
+
+func (r *Relation) validate() error {
+	if r.Type != RelationHasMany && r.Type != RelationBelongsTo {
+		return ErrInvalidInput(fmt.Sprintf("unknown type %s of the relation %s", r.Type, r.Name))
+	}
+	if r.Repository == "" || r.ForeignKey == "" {
+		return ErrInvalidInput(fmt.Sprintf("the relation %s needs the repository and the foreign key", r.Name))
+	}
+	switch r.OnDelete {
+	case "", OnDeleteRestrict, OnDeleteCascade, OnDeleteNullify:
+	default:
+		return ErrInvalidInput(fmt.Sprintf("unknown onDelete %s of the relation %s", r.OnDelete, r.Name))
+	}
+	return nil
+}
+
+// GetChildren returns the records related to the parent record (by its id) with the hasMany relation of
+// the repository. For example, to get the orders of a user:
+//
+//	orders, err := backends.GetChildren(backend, "users", "orders", userID, &Order{})
+func GetChildren(backend Backend, repository, relation string, parentID interface{}, resultsTypeHint interface{}) (interface{}, error) {
+	rel, err := repositoryRelation(backend, repository, relation, RelationHasMany)
+	if err != nil {
+		return nil, err
+	}
+	children, err := backend.GetRepository(rel.Repository)
+	if err != nil {
+		return nil, err
+	}
+	return children.GetAll(Filter{rel.ForeignKey: parentID}, resultsTypeHint, "", "", 0, 0)
+}
+
+// GetParent returns the record related to the record with the belongsTo relation of the repository.
+// Returns ErrNotFound if the foreign key of the record is not set, or there is no such record.
+func GetParent(backend Backend, repository, relation string, record interface{}, result interface{}) (interface{}, error) {
+	rel, err := repositoryRelation(backend, repository, relation, RelationBelongsTo)
+	if err != nil {
+		return nil, err
+	}
+	document, err := toAuditMap(record)
+	if err != nil {
+		return nil, err
+	}
+	parentID := document[rel.ForeignKey]
+	if parentID == nil {
+		return nil, ErrNotFound(fmt.Sprintf("the record has no %s", rel.ForeignKey))
+	}
+	parents, err := backend.GetRepository(rel.Repository)
+	if err != nil {
+		return nil, err
+	}
+	return parents.GetOne(Filter{"id": parentID}, result)
+}
+
+// CascadeDelete deletes the records of the repository matched by the filter, and handles the records
+// related with the hasMany relations according to their OnDelete. The restrictions are checked for all
+// records before any record is deleted. If all repositories are DynamoDB tables, the writes run in a single
+// transaction, if they fit in one. Returns the number of deleted records, including the related ones.
+func CascadeDelete(backend Backend, repository string, filter Filter) (int, error) {
+	repo, def, err := relatedRepository(backend, repository)
+	if err != nil {
+		return 0, err
+	}
+	records, err := readAllRecords(repo, filter)
+	if err != nil {
+		return 0, err
+	}
+	return deleteWithRelations(backend, repository, repo, def, records)
+}
+
+// WithRelations returns the repository with the relations enforced on the writes: Save fails with
+// ErrInvalidInput if the foreign key of a belongsTo relation refers to a record that does not exist, and
+// the deletes handle the related records as CascadeDelete.
+func WithRelations(backend Backend, repository string) (Repository, error) {
+	repo, def, err := relatedRepository(backend, repository)
+	if err != nil {
+		return nil, err
+	}
+	return &relationalRepository{Repository: repo, backend: backend, name: repository, def: def}, nil
+}
+
+type relationalRepository struct {
+	Repository
+	backend Backend
+	name    string
+	def     RepositoryDefinition
+}
+
+// Save saves the object, if the records it refers to exist.
+func (r *relationalRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	document, err := toAuditMap(object)
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range r.def.GetRelations() {
+		parentID, ok := document[relation.ForeignKey]
+		if relation.Type != RelationBelongsTo || !ok || parentID == nil {
+			continue
+		}
+		parents, err := r.backend.GetRepository(relation.Repository)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parents.GetOne(Filter{"id": parentID}, &map[string]interface{}{}); err != nil {
+			if IsErrNotFound(err) {
+				return nil, ErrInvalidInput(fmt.Sprintf("the %s %v of the relation %s does not exist", relation.Repository, parentID, relation.Name))
+			}
+			return nil, err
+		}
+	}
+	return r.Repository.Save(object, filter)
+}
+
+// DeleteOne deletes the matched record and handles its related records.
+func (r *relationalRepository) DeleteOne(filter Filter) error {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(copyFilter(filter), &record); err != nil {
+		return err
+	}
+	_, err := deleteWithRelations(r.backend, r.name, r.Repository, r.def, []map[string]interface{}{record})
+	return err
+}
+
+// DeleteAll deletes the matched records and handles their related records.
+func (r *relationalRepository) DeleteAll(filter Filter) error {
+	records, err := readAllRecords(r.Repository, filter)
+	if err != nil {
+		return err
+	}
+	_, err = deleteWithRelations(r.backend, r.name, r.Repository, r.def, records)
+	return err
+}
+
+// relationWrite is a write of a delete with relations: the delete of a record, or the clearing of its
+// foreign key if the foreign key is set.
+type relationWrite struct {
+	repo       Repository
+	def        RepositoryDefinition
+	record     map[string]interface{}
+	foreignKey string
+}
+
+// deleteWithRelations plans the deletes of the records and their related records, failing with ErrConflict
+// if a relation restricts the delete, then runs the writes. Returns the number of deleted records.
+func deleteWithRelations(backend Backend, name string, repo Repository, def RepositoryDefinition, records []map[string]interface{}) (int, error) {
+	writes := []*relationWrite{}
+	visited := map[string]bool{}
+	for _, record := range records {
+		var err error
+		if writes, err = planDelete(backend, name, repo, def, record, visited, writes); err != nil {
+			return 0, err
+		}
+	}
+	return runRelationWrites(writes)
+}
+
+// planDelete adds the writes of the related records of the record, then the delete of the record.
+func planDelete(backend Backend, name string, repo Repository, def RepositoryDefinition, record map[string]interface{}, visited map[string]bool, writes []*relationWrite) ([]*relationWrite, error) {
+	key := fmt.Sprintf("%s:%v", name, record["id"])
+	if visited[key] {
+		return writes, nil
+	}
+	visited[key] = true
+
+	for _, relation := range def.GetRelations() {
+		if relation.Type != RelationHasMany {
+			continue
+		}
+		children, childDef, err := relatedRepository(backend, relation.Repository)
+		if err != nil {
+			return nil, err
+		}
+		related, err := readAllRecords(children, Filter{relation.ForeignKey: record["id"]})
+		if err != nil {
+			return nil, err
+		}
+		switch relation.OnDelete {
+		case OnDeleteCascade:
+			for _, child := range related {
+				if writes, err = planDelete(backend, relation.Repository, children, childDef, child, visited, writes); err != nil {
+					return nil, err
+				}
+			}
+		case OnDeleteNullify:
+			for _, child := range related {
+				writes = append(writes, &relationWrite{repo: children, def: childDef, record: child, foreignKey: relation.ForeignKey})
+			}
+		default:
+			if len(related) > 0 {
+				return nil, ErrConflict(fmt.Sprintf("the record %v of %s has %d related records in %s (relation %s)",
+					record["id"], name, len(related), relation.Repository, relation.Name))
+			}
+		}
+	}
+	return append(writes, &relationWrite{repo: repo, def: def, record: record}), nil
+}
+
+// runRelationWrites runs the writes in a single transaction if all repositories support transactions,
+// otherwise one by one. Returns the number of deleted records.
+func runRelationWrites(writes []*relationWrite) (int, error) {
+	if tx := relationTransaction(writes); tx != nil {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return countRelationDeletes(writes), nil
+	}
+
+	deleted := 0
+	for _, write := range writes {
+		if write.foreignKey != "" {
+			update := map[string]interface{}{write.foreignKey: nil}
+			if _, err := write.repo.Save(&update, Filter{"id": write.record["id"]}); err != nil && !IsErrNotFound(err) {
+				return deleted, err
+			}
+			continue
+		}
+		if err := write.repo.DeleteOne(Filter{"id": write.record["id"]}); err != nil {
+			if IsErrNotFound(err) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// relationTransaction returns the DynamoDB transaction of the writes, or nil if a repository is not a
+// DynamoDB table or the writes do not fit in a transaction.
+func relationTransaction(writes []*relationWrite) *DynamoTransaction {
+	if len(writes) == 0 {
+		return nil
+	}
+	for _, write := range writes {
+		repo := write.repo
+		if r, ok := repo.(*failoverRepository); ok {
+			active, err := r.active()
+			if err != nil {
+				return nil
+			}
+			repo = active
+		}
+		if _, ok := repo.(*DynamoCollection); !ok {
+			return nil
+		}
+	}
+
+	tx := NewDynamoTransaction()
+	for _, write := range writes {
+		key := Filter{}
+		for _, attribute := range []string{write.def.GetHashKey(), write.def.GetRangeKey()} {
+			if attribute != "" {
+				key[attribute] = write.record[attribute]
+			}
+		}
+		if write.foreignKey != "" {
+			tx.Update(write.repo, key, &map[string]interface{}{write.foreignKey: nil})
+		} else {
+			tx.Delete(write.repo, key)
+		}
+	}
+	if len(tx.writes) > maxDynamoTransactionWrites {
+		return nil
+	}
+	return tx
+}
+
+func countRelationDeletes(writes []*relationWrite) int {
+	deleted := 0
+	for _, write := range writes {
+		if write.foreignKey == "" {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// repositoryRelation returns the relation of the repository with the name and the type.
+func repositoryRelation(backend Backend, repository, name, relationType string) (*Relation, error) {
+	_, def, err := relatedRepository(backend, repository)
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range def.GetRelations() {
+		if relation.Name == name {
+			if relation.Type != relationType {
+				return nil, ErrInvalidInput(fmt.Sprintf("the relation %s of %s is not %s", name, repository, relationType))
+			}
+			return relation, nil
+		}
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("%s has no relation %s", repository, name))
+}
+
+// relatedRepository returns the repository and its definition from the backend.
+func relatedRepository(backend Backend, name string) (Repository, RepositoryDefinition, error) {
+	definer, ok := backend.(interface {
+		RepositoryDefinitions() map[string]RepositoryDefinition
+	})
+	if !ok {
+		return nil, nil, ErrInvalidInput(fmt.Sprintf("the relations are not supported on %T", backend))
+	}
+	def, ok := definer.RepositoryDefinitions()[name]
+	if !ok {
+		return nil, nil, ErrInvalidInput(fmt.Sprintf("repository %s is not defined", name))
+	}
+	repo, err := backend.GetRepository(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, def, nil
+}
+
+// readAllRecords reads all records of the repository matched by the filter.
+func readAllRecords(repo Repository, filter Filter) ([]map[string]interface{}, error) {
+	records := []map[string]interface{}{}
+	for {
+		page, err := readRecords(repo, copyFilter(filter), defaultTransferBatchSize, len(records))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page...)
+		if len(page) < defaultTransferBatchSize {
+			return records, nil
+		}
+	}
+}
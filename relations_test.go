@@ -0,0 +1,161 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// newRelationsBackend returns a backend of users, orders, items and notes in memory, deleting the items
+// of the orders according to itemsOnDelete.
+func newRelationsBackend(t *testing.T, itemsOnDelete string) (Backend, map[string]*memoryRepo) {
+	repos := map[string]*memoryRepo{
+		"users": {records: []map[string]interface{}{{"id": "u1"}, {"id": "u2"}}},
+		"orders": {records: []map[string]interface{}{
+			{"id": "o1", "userId": "u1"},
+			{"id": "o2", "userId": "u1"},
+			{"id": "o3", "userId": "u2"},
+		}},
+		"items": {records: []map[string]interface{}{{"id": "i1", "orderId": "o1"}, {"id": "i2", "orderId": "o3"}}},
+		"notes": {records: []map[string]interface{}{{"id": "n1", "userId": "u1"}}},
+	}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return repos[def.GetName()], nil
+	}, nil)
+
+	definitions := map[string]RepositoryDefinitionMap{
+		"users": {"name": "users", "relations": map[string]interface{}{
+			"orders": map[string]interface{}{"type": "hasMany", "repository": "orders", "foreignKey": "userId", "onDelete": "cascade"},
+			"notes":  map[string]interface{}{"type": "hasMany", "repository": "notes", "foreignKey": "userId", "onDelete": "nullify"},
+		}},
+		"orders": {"name": "orders", "relations": map[string]interface{}{
+			"user":  map[string]interface{}{"type": "belongsTo", "repository": "users", "foreignKey": "userId"},
+			"items": map[string]interface{}{"type": "hasMany", "repository": "items", "foreignKey": "orderId", "onDelete": itemsOnDelete},
+		}},
+		"items": {"name": "items", "relations": map[string]interface{}{
+			"order": map[string]interface{}{"type": "belongsTo", "repository": "orders", "foreignKey": "orderId"},
+		}},
+		"notes": {"name": "notes"},
+	}
+	for name, def := range definitions {
+		if _, err := backend.DefineRepository(name, def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return backend, repos
+}
+
+func TestGetRelations(t *testing.T) {
+	relations := RepositoryDefinitionMap{"relations": map[string]interface{}{
+		"user":   map[string]interface{}{"type": "belongsTo", "repository": "users", "foreignKey": "userId"},
+		"events": &Relation{Type: RelationHasMany, Repository: "events", ForeignKey: "orderId"},
+	}}.GetRelations()
+	if len(relations) != 2 || relations[0].Name != "events" || relations[1].Repository != "users" {
+		t.Fatal("Expected the relations sorted by name. Got: ", relations)
+	}
+
+	invalid := []interface{}{
+		map[string]interface{}{"x": map[string]interface{}{"type": "hasOne", "repository": "a", "foreignKey": "b"}},
+		map[string]interface{}{"x": map[string]interface{}{"type": "hasMany", "repository": "a"}},
+		map[string]interface{}{"x": map[string]interface{}{"type": "hasMany", "repository": "a", "foreignKey": "b", "onDelete": "ignore"}},
+	}
+	for _, value := range invalid {
+		if _, err := parseRelations(value); !IsErrInvalidInput(err) {
+			t.Fatal("Expected ErrInvalidInput for ", value, ". Got: ", err)
+		}
+	}
+}
+
+func TestGetChildrenAndParent(t *testing.T) {
+	backend, _ := newRelationsBackend(t, OnDeleteCascade)
+
+	orders, err := GetChildren(backend, "users", "orders", "u1", &map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := *orders.(*[]map[string]interface{}); len(records) != 2 {
+		t.Fatal("Expected the orders of the user. Got: ", records)
+	}
+	user := map[string]interface{}{}
+	if _, err := GetParent(backend, "orders", "user", map[string]interface{}{"id": "o3", "userId": "u2"}, &user); err != nil || user["id"] != "u2" {
+		t.Fatal("Expected the user of the order. Got: ", user, err)
+	}
+	if _, err := GetParent(backend, "orders", "user", map[string]interface{}{"id": "o4"}, &user); err == nil || !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound without the foreign key. Got: ", err)
+	}
+	if _, err := GetChildren(backend, "orders", "user", "o1", &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a belongsTo relation. Got: ", err)
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	backend, repos := newRelationsBackend(t, OnDeleteCascade)
+
+	deleted, err := CascadeDelete(backend, "users", Filter{"id": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 4 || len(repos["users"].records) != 1 || len(repos["orders"].records) != 1 || len(repos["items"].records) != 1 {
+		t.Fatal("Expected the user, its orders and their items to be deleted. Got: ", deleted, repos["orders"].records, repos["items"].records)
+	}
+	if note := repos["notes"].records[0]; note["userId"] != nil {
+		t.Fatal("Expected the foreign key of the note to be cleared. Got: ", note)
+	}
+}
+
+func TestWithRelations(t *testing.T) {
+	backend, repos := newRelationsBackend(t, OnDeleteRestrict)
+
+	orders, err := WithRelations(backend, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.Save(&map[string]interface{}{"id": "o4", "userId": "u9"}, nil); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a missing user. Got: ", err)
+	}
+	if _, err := orders.Save(&map[string]interface{}{"id": "o4", "userId": "u2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.DeleteOne(Filter{"id": "o1"}); !IsErrConflict(err) {
+		t.Fatal("Expected ErrConflict for an order with items. Got: ", err)
+	}
+	if err := orders.DeleteAll(Filter{"userId": "u2"}); !IsErrConflict(err) {
+		t.Fatal("Expected ErrConflict for an order with items. Got: ", err)
+	}
+	if len(repos["orders"].records) != 4 {
+		t.Fatal("Expected no order to be deleted. Got: ", repos["orders"].records)
+	}
+	if err := orders.DeleteOne(Filter{"id": "o2"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repos["orders"].records) != 3 {
+		t.Fatal("Expected the order without items to be deleted. Got: ", repos["orders"].records)
+	}
+}
+
+func TestRelationTransaction(t *testing.T) {
+	users := testTxCollection(t, RepositoryDefinitionMap{"name": "users", "hashKey": "id"})
+	tokens := testTxCollection(t, RepositoryDefinitionMap{"name": "tokens", "hashKey": "userId", "rangeKey": "token"})
+	writes := []*relationWrite{
+		{repo: tokens, def: tokens.RepositoryDefinition, record: map[string]interface{}{"userId": "u1", "token": "t1"}},
+		{repo: users, def: users.RepositoryDefinition, record: map[string]interface{}{"id": "u2"}, foreignKey: "invitedBy"},
+		{repo: users, def: users.RepositoryDefinition, record: map[string]interface{}{"id": "u1"}},
+	}
+
+	tx := relationTransaction(writes)
+	if tx == nil || tx.err != nil {
+		t.Fatal("Expected a transaction. Got: ", tx)
+	}
+	if len(tx.writes) != 3 || tx.writes[0].kind != txDelete || tx.writes[1].kind != txUpdate || tx.writes[2].table != "users" {
+		t.Fatal("Unexpected writes: ", tx.writes)
+	}
+	if count := countRelationDeletes(writes); count != 2 {
+		t.Fatal("Expected 2 deletes. Got: ", count)
+	}
+
+	mixed := append(writes, &relationWrite{repo: &memoryRepo{}, def: RepositoryDefinitionMap{}, record: map[string]interface{}{"id": "n1"}})
+	if tx := relationTransaction(mixed); tx != nil {
+		t.Fatal("Expected no transaction for a repository without transactions")
+	}
+}
@@ -0,0 +1,115 @@
+package backends
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// RepositoryDefinitions returns the definitions of all repositories defined on the backend, by name.
+func (m *RepositoriesBackend) RepositoryDefinitions() map[string]RepositoryDefinition {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	definitions := map[string]RepositoryDefinition{}
+	for name, def := range m.definitions {
+		definitions[name] = def
+	}
+	return definitions
+}
+
+// Reload applies a new connection configuration to the running backends. The backends with changed
+// configuration are built again, and the repositories defined on the old backend are defined on the new one.
+// The backends removed from the configuration are closed, and the added ones are built on the first call
+// to GetBackend.
+// All new backends are built before any of them replaces a running backend. If building a backend or
+// a repository fails, the new backends are closed, the running ones are kept and the error is returned.
+// Otherwise the backends are swapped at once and the replaced backends are closed, waiting for their
+// in-flight operations until the context is done; the first close error is returned.
+// The backends and repositories obtained before the reload must not be used after it, get them again
+// with GetBackend and GetRepository.
+func (m *DefaultBackendManager) Reload(ctx context.Context, dbConfig map[string]*config.DBInfo) error {
+	m.mutex.Lock()
+
+	built := map[string]Backend{}
+	for _, backendType := range m.backendsOrder {
+		dbInfo, ok := dbConfig[backendType]
+		if !ok || dbInfo == nil || reflect.DeepEqual(dbInfo, m.dbConfig[backendType]) {
+			continue
+		}
+		backend, err := m.rebuildBackend(backendType, dbInfo, m.backends[backendType])
+		if err != nil {
+			m.mutex.Unlock()
+			closeBackends(ctx, built)
+			return err
+		}
+		built[backendType] = backend
+	}
+
+	closing := []Backend{}
+	order := []string{}
+	for _, backendType := range m.backendsOrder {
+		backend := m.backends[backendType]
+		if dbInfo, ok := dbConfig[backendType]; !ok || dbInfo == nil {
+			closing = append(closing, backend)
+			delete(m.backends, backendType)
+			continue
+		}
+		if newBackend, ok := built[backendType]; ok {
+			closing = append(closing, backend)
+			m.backends[backendType] = newBackend
+		}
+		order = append(order, backendType)
+	}
+	m.backendsOrder = order
+
+	m.dbConfig = map[string]*config.DBInfo{}
+	for backendType, dbInfo := range dbConfig {
+		m.dbConfig[backendType] = dbInfo
+	}
+	m.mutex.Unlock()
+
+	// the old backends are closed outside the lock, so the new ones can be used while they drain
+	var firstErr error
+	for i := len(closing) - 1; i >= 0; i-- {
+		if err := closing[i].Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rebuildBackend builds a backend with the new configuration and defines on it the repositories
+// of the running backend.
+func (m *DefaultBackendManager) rebuildBackend(backendType string, dbInfo *config.DBInfo, running Backend) (Backend, error) {
+	backend, err := m.newBackend(backendType, dbInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	definer, ok := running.(interface {
+		RepositoryDefinitions() map[string]RepositoryDefinition
+	})
+	if !ok {
+		return backend, nil
+	}
+	definitions := definer.RepositoryDefinitions()
+	names := map[string]interface{}{}
+	for name := range definitions {
+		names[name] = nil
+	}
+	for _, name := range sortedKeys(names) {
+		if _, err := backend.DefineRepository(name, definitions[name]); err != nil {
+			backend.Close(context.Background())
+			return nil, err
+		}
+	}
+	return backend, nil
+}
+
+func closeBackends(ctx context.Context, backends map[string]Backend) {
+	for _, backend := range backends {
+		backend.Close(ctx)
+	}
+}
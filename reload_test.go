@@ -0,0 +1,95 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func newReloadManager(closed map[string]int) BackendManager {
+	manager := NewBackendManager(map[string]*config.DBInfo{
+		"primary":   &config.DBInfo{Host: "db1:27017"},
+		"secondary": &config.DBInfo{Host: "db2:27017"},
+		"archive":   &config.DBInfo{Host: "db3:27017"},
+	})
+	builder := func(dbInfo *config.DBInfo, manager BackendManager) (Backend, error) {
+		if dbInfo.Host == "unreachable" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		host := dbInfo.Host
+		return NewRepositoriesBackend(context.Background(), dbInfo, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+			return &memoryRepo{}, nil
+		}, func() {
+			closed[host]++
+		}), nil
+	}
+	for _, backendType := range []string{"primary", "secondary", "archive"} {
+		manager.SupportBackend(backendType, builder, map[string]interface{}{})
+	}
+	return manager
+}
+
+func TestBackendManagerReload(t *testing.T) {
+	closed := map[string]int{}
+	manager := newReloadManager(closed)
+
+	primary, _ := manager.GetBackend("primary")
+	secondary, _ := manager.GetBackend("secondary")
+	manager.GetBackend("archive")
+	if _, err := primary.DefineRepository("users", &RepositoryDefinitionMap{"name": "users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := manager.Reload(context.Background(), map[string]*config.DBInfo{
+		"primary":   &config.DBInfo{Host: "db4:27017"},
+		"secondary": &config.DBInfo{Host: "db2:27017"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := manager.GetBackend("primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded == primary || reloaded.GetConfig().Host != "db4:27017" {
+		t.Fatal("Expected the primary backend to be rebuilt")
+	}
+	if _, err := reloaded.GetRepository("users"); err != nil {
+		t.Fatal("Expected the repositories to be defined on the new backend: ", err)
+	}
+	if unchanged, _ := manager.GetBackend("secondary"); unchanged != secondary {
+		t.Fatal("Expected the unchanged backend to be kept")
+	}
+	if _, err := manager.GetBackend("archive"); err == nil {
+		t.Fatal("Expected the removed backend not to be configured")
+	}
+	if closed["db1:27017"] != 1 || closed["db3:27017"] != 1 || closed["db2:27017"] != 0 {
+		t.Fatal("Expected the replaced and removed backends to be closed. Got: ", closed)
+	}
+}
+
+func TestBackendManagerReloadFailure(t *testing.T) {
+	closed := map[string]int{}
+	manager := newReloadManager(closed)
+
+	primary, _ := manager.GetBackend("primary")
+	manager.GetBackend("secondary")
+
+	err := manager.Reload(context.Background(), map[string]*config.DBInfo{
+		"primary":   &config.DBInfo{Host: "db4:27017"},
+		"secondary": &config.DBInfo{Host: "unreachable"},
+	})
+	if err == nil {
+		t.Fatal("Expected the reload to fail")
+	}
+
+	if backend, _ := manager.GetBackend("primary"); backend != primary {
+		t.Fatal("Expected the running backend to be kept")
+	}
+	if closed["db4:27017"] != 1 || closed["db1:27017"] != 0 {
+		t.Fatal("Expected only the new backend to be closed. Got: ", closed)
+	}
+}
@@ -0,0 +1,100 @@
+package backends
+
+import "fmt"
+
+// SaveResult holds the metadata of a saved record.
+type SaveResult struct {
+	// Object is the saved record, as returned by Save.
+	Object interface{}
+	// ID is the id of the record.
+	ID string
+	// Inserted is true if a new record was created, and false if an existing record was updated.
+	Inserted bool
+	// Matched is the number of records matched by the filter of an update.
+	Matched int
+	// Modified is the number of records written. An updated record is counted even if none of its values changed.
+	Modified int
+	// Version is the version of the record after the save (the first version is 1),
+	// or 0 if the repository does not keep versions.
+	Version int
+}
+
+// SaveResultRepository is implemented by the repositories that return more metadata about the saved
+// record than can be read from the object returned by Save.
+type SaveResultRepository interface {
+	// SaveWithResult saves the object like Save and returns the metadata of the saved record.
+	SaveWithResult(object interface{}, filter Filter) (*SaveResult, error)
+}
+
+// SaveWithResult saves the object (creates a new record if the filter is nil, otherwise updates the matched
+// record) and returns the metadata of the saved record, so no follow-up GetOne is needed. For example:
+//
+//	result, err := backends.SaveWithResult(repo, user, nil)
+//	// result.ID is the generated id, result.Inserted is true
+//
+// The metadata of the repositories that do not implement SaveResultRepository is read from the saved object.
+func SaveWithResult(repo Repository, object interface{}, filter Filter) (*SaveResult, error) {
+	if r, ok := repo.(SaveResultRepository); ok {
+		return r.SaveWithResult(object, filter)
+	}
+	saved, err := repo.Save(object, filter)
+	if err != nil {
+		return nil, err
+	}
+	return newSaveResult(saved, filter)
+}
+
+// newSaveResult returns the metadata of the record returned by Save.
+func newSaveResult(saved interface{}, filter Filter) (*SaveResult, error) {
+	result := &SaveResult{
+		Object:   saved,
+		Inserted: filter == nil,
+		Modified: 1,
+	}
+	if filter != nil {
+		result.Matched = 1
+	}
+
+	document, err := toAuditMap(saved)
+	if err != nil {
+		return nil, err
+	}
+	switch id := document["id"].(type) {
+	case string:
+		result.ID = id
+	case nil:
+	default:
+		result.ID = fmt.Sprint(id)
+	}
+	return result, nil
+}
+
+// SaveWithResult saves the record on the active backend.
+func (r *failoverRepository) SaveWithResult(object interface{}, filter Filter) (*SaveResult, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return SaveWithResult(repository, object, filter)
+}
+
+// SaveWithResult saves the object like Save and returns the metadata of the saved record with the version
+// of the record: the number of its previous versions in the history plus one.
+func (r *VersionedRepository) SaveWithResult(object interface{}, filter Filter) (*SaveResult, error) {
+	saved, err := r.Save(object, filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := newSaveResult(saved, filter)
+	if err != nil {
+		return nil, err
+	}
+	if result.ID != "" {
+		versions, err := r.GetVersions(result.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.Version = len(versions) + 1
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package backends
+
+import "testing"
+
+func TestSaveWithResult(t *testing.T) {
+	repo := &memoryRepo{}
+
+	result, err := SaveWithResult(repo, &map[string]interface{}{"id": "1", "name": "John"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != "1" || !result.Inserted || result.Matched != 0 || result.Modified != 1 || result.Version != 0 {
+		t.Fatalf("Unexpected insert result: %+v", result)
+	}
+
+	result, err = SaveWithResult(repo, &map[string]interface{}{"name": "Johnny"}, Filter{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != "1" || result.Inserted || result.Matched != 1 || result.Modified != 1 {
+		t.Fatalf("Unexpected update result: %+v", result)
+	}
+	if saved := result.Object.(map[string]interface{}); saved["name"] != "Johnny" {
+		t.Fatal("Expected the saved record. Got: ", saved)
+	}
+
+	if _, err = SaveWithResult(repo, &map[string]interface{}{"name": "Jack"}, Filter{"id": "2"}); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound. Got: ", err)
+	}
+}
+
+func TestVersionedSaveWithResult(t *testing.T) {
+	repo := NewVersionedRepository(&memoryRepo{}, &memoryRepo{})
+
+	result, err := SaveWithResult(repo, &map[string]interface{}{"id": "1", "name": "John"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != 1 {
+		t.Fatal("Expected version 1. Got: ", result.Version)
+	}
+
+	for _, name := range []string{"Johnny", "Jack"} {
+		if result, err = SaveWithResult(repo, &map[string]interface{}{"name": name}, Filter{"id": "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.Version != 3 {
+		t.Fatal("Expected version 3. Got: ", result.Version)
+	}
+}
@@ -0,0 +1,146 @@
+package backends
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/guregu/dynamo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SequencesCollection is the MongoDB collection that holds the counters of the "sequence" ID generator,
+// one document per collection.
+const SequencesCollection = "sequences"
+
+// sequenceCounter is a counter of the "sequence" ID generator.
+type sequenceCounter struct {
+	Name  string `bson:"_id" dynamo:"name"`
+	Value int64  `bson:"value" dynamo:"value"`
+}
+
+// SequenceRepository is implemented by the repositories that keep named counters, incremented atomically.
+type SequenceRepository interface {
+	// NextSequence increments the counter with the name and returns its value.
+	NextSequence(name string) (int64, error)
+}
+
+// NextSequence increments the counter with the name and returns its value: 1 on the first call, then
+// consecutive numbers across all instances of the services, for example for invoice or ticket numbers:
+//
+//	number, err := backends.NextSequence(backend, "invoices")
+//
+// The counters are kept in the sequences collection (table) of the backend, defined on the first call.
+// On MongoDB, this is the collection of the "sequence" ID generator, so a counter named after a
+// collection continues the ids of that collection.
+func NextSequence(backend Backend, name string) (int64, error) {
+	if name == "" {
+		return 0, ErrInvalidInput("the sequence needs a name")
+	}
+	repo, err := backend.GetOrCreateRepository(SequencesCollection, RepositoryDefinitionMap{
+		"name":          SequencesCollection,
+		"hashKey":       "name",
+		"hashKeyType":   "S",
+		"readCapacity":  int64(1),
+		"writeCapacity": int64(1),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := repo.(SequenceRepository); ok {
+		return r.NextSequence(name)
+	}
+	return 0, ErrInvalidInput(fmt.Sprintf("sequences are not supported on %T", repo))
+}
+
+// NextSequence increments the counter on the active backend.
+func (r *failoverRepository) NextSequence(name string) (int64, error) {
+	repository, err := r.active()
+	if err != nil {
+		return 0, err
+	}
+	if sequences, ok := repository.(SequenceRepository); ok {
+		return sequences.NextSequence(name)
+	}
+	return 0, ErrInvalidInput(fmt.Sprintf("sequences are not supported on %T", repository))
+}
+
+// NextSequence increments the counter (the document with the name as _id) with $inc in findAndModify.
+func (s *MongoSession) NextSequence(name string) (int64, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if err := s.checkConnected(); err != nil {
+		return 0, err
+	}
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	counter := &sequenceCounter{}
+	_, err = c.FindId(name).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"value": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
+
+// NextSequence increments the counter (the item with the name) with the ADD update expression.
+func (c *DynamoCollection) NextSequence(name string) (int64, error) {
+	counter := &sequenceCounter{}
+	if err := c.Table.Update("name", name).Add("value", 1).Value(counter); err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
+
+// nextSequence increments the counter of the collection in the sequences collection and returns its value.
+func (s *MongoSession) nextSequence() (string, error) {
+	session, _ := s.getWriteCollection()
+	defer session.Close()
+
+	counter := &sequenceCounter{}
+	_, err := session.DB(s.databaseName).C(SequencesCollection).FindId(s.collectionName).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"value": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, counter)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(counter.Value, 10), nil
+}
+
+// newDynamoSequence creates the sequence table ("<table>-sequence") if the repository uses the
+// "sequence" ID generator. Returns nil otherwise.
+func newDynamoSequence(svc *dynamodb.DynamoDB, db *dynamo.DB, repoDef RepositoryDefinition) (*dynamo.Table, error) {
+	if repoDef.GetIDGenerator() != IDSequence {
+		return nil, nil
+	}
+	tableName := repoDef.GetName() + "-sequence"
+	if err := createOnDemandTable(svc, tableName, "name"); err != nil {
+		return nil, err
+	}
+	table := db.Table(tableName)
+	return &table, nil
+}
+
+// nextSequence increments the counter of the table in the sequence table and returns its value.
+func (c *DynamoCollection) nextSequence() (string, error) {
+	if c.sequence == nil {
+		return "", ErrBackendError("the sequence table is not created")
+	}
+	counter := &sequenceCounter{}
+	err := c.sequence.Update("name", c.RepositoryDefinition.GetName()).Add("value", 1).Value(counter)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(counter.Value, 10), nil
+}
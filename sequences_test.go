@@ -0,0 +1,51 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+// counterRepo is a memoryRepo keeping the named counters.
+type counterRepo struct {
+	*memoryRepo
+	counters map[string]int64
+}
+
+func (r *counterRepo) NextSequence(name string) (int64, error) {
+	r.counters[name]++
+	return r.counters[name], nil
+}
+
+func TestNextSequence(t *testing.T) {
+	var repo Repository = &counterRepo{memoryRepo: &memoryRepo{}, counters: map[string]int64{}}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		if def.GetName() != SequencesCollection || def.GetHashKey() != "name" {
+			t.Fatal("Unexpected repository: ", def)
+		}
+		return repo, nil
+	}, nil)
+
+	for expected := int64(1); expected <= 3; expected++ {
+		value, err := NextSequence(backend, "invoices")
+		if err != nil || value != expected {
+			t.Fatal("Expected the next number of the sequence. Got: ", value, err)
+		}
+	}
+	if value, err := NextSequence(backend, "tickets"); err != nil || value != 1 {
+		t.Fatal("Expected a counter per name. Got: ", value, err)
+	}
+	if _, err := NextSequence(backend, ""); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without a name. Got: ", err)
+	}
+}
+
+func TestNextSequenceNotSupported(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, func(def RepositoryDefinition, backend Backend) (Repository, error) {
+		return &memoryRepo{}, nil
+	}, nil)
+	if _, err := NextSequence(backend, "invoices"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+}
@@ -0,0 +1,141 @@
+package backends
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Session is a handle for the operations of one logical request, for example a multi-step request handler.
+// The reads made through the repositories of the session see the writes made before them through the
+// session, in any repository of the backend (read-your-writes):
+//
+//	session, err := backend.Session(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer session.Close()
+//
+//	orders, _ := session.GetRepository("orders")
+//	items, _ := session.GetRepository("items")
+//
+// On MongoDB, the operations of the session are made on one session in the strong mode, which reuses one
+// connection to the primary. The read preferences of the repositories are not applied. On DynamoDB, the reads
+// of the session are strongly consistent (except on the global secondary indexes, which are always
+// eventually consistent). The writes made outside the session may not be visible.
+type Session struct {
+	backend      Backend
+	ctx          context.Context
+	mongo        *mgo.Session
+	mutex        *sync.Mutex
+	repositories map[string]Repository
+	closed       bool
+}
+
+// SessionRepository is implemented by the repositories that can run their operations in a Session.
+type SessionRepository interface {
+	// InSession returns a view of the repository that runs the operations in the session.
+	InSession(session *Session) Repository
+}
+
+// NewBackendSession creates a Session on the backend, with the context of the operations. The repositories of the
+// session are the repositories of the backend, running in the session if they support it.
+func NewBackendSession(backend Backend, ctx context.Context) *Session {
+	return &Session{
+		backend:      backend,
+		ctx:          ctx,
+		mutex:        &sync.Mutex{},
+		repositories: map[string]Repository{},
+	}
+}
+
+// Context returns the context of the operations of the session.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// GetRepository returns the repository with the name, running the operations in the session.
+func (s *Session) GetRepository(name string) (Repository, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil, ErrInvalidInput("the session is closed")
+	}
+	if repo, ok := s.repositories[name]; ok {
+		return repo, nil
+	}
+	repo, err := s.backend.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := repo.(SessionRepository); ok {
+		repo = r.InSession(s)
+	} else if s.ctx != nil {
+		repo = WithContext(repo, s.ctx)
+	}
+	s.repositories[name] = repo
+	return repo, nil
+}
+
+// Close ends the session and releases its connection. The repositories of the session must not be used
+// after the session is closed.
+func (s *Session) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.mongo != nil {
+		s.mongo.Close()
+	}
+}
+
+// Session creates a Session with read-your-writes consistency across the repositories of the backend.
+// The session must be closed after the request.
+func (m *RepositoriesBackend) Session(ctx context.Context) (*Session, error) {
+	session := NewBackendSession(m, ctx)
+
+	var base *mgo.Session
+	if connector, ok := m.GetFromContext(MONGO_CONNECTOR_CTX_KEY).(*mongoConnector); ok {
+		current, err := connector.get()
+		if err != nil {
+			return nil, err
+		}
+		base = current
+	} else if current, ok := m.GetFromContext(MONGO_CTX_KEY).(*mgo.Session); ok {
+		base = current
+	}
+	if base != nil {
+		session.mongo = base.Copy()
+		session.mongo.SetMode(mgo.Strong, true)
+	}
+	return session, nil
+}
+
+// Session creates a Session on the active backend. The session stays on the backend that was active when
+// it was created.
+func (b *FailoverBackend) Session(ctx context.Context) (*Session, error) {
+	return b.Active().Session(ctx)
+}
+
+// InSession returns a copy of the MongoSession that runs the operations on the connection of the session.
+func (s *MongoSession) InSession(session *Session) Repository {
+	sessionCopy := *s
+	sessionCopy.pinned = session.mongo
+	if session.ctx != nil {
+		sessionCopy.operation.Context = session.ctx
+	}
+	return &sessionCopy
+}
+
+// InSession returns a copy of the DynamoCollection with strongly consistent reads.
+func (c *DynamoCollection) InSession(session *Session) Repository {
+	collectionCopy := *c
+	collectionCopy.consistentRead = true
+	if session.ctx != nil {
+		collectionCopy.operation.Context = session.ctx
+	}
+	return &collectionCopy
+}
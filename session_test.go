@@ -0,0 +1,68 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"gopkg.in/mgo.v2"
+)
+
+func TestBackendSession(t *testing.T) {
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{}, repoBuilderFn, nil).(*RepositoriesBackend)
+	if _, err := backend.DefineRepository("users", &collectionInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithPrincipal(context.Background(), Principal{ID: "u1"})
+	session, err := backend.Session(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := session.GetRepository("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, ok := repo.(*DynamoCollection)
+	if !ok || !collection.consistentRead || collection.operation.Context != ctx {
+		t.Fatal("Expected a consistent view of the repository with the context of the session")
+	}
+	if original, _ := backend.GetRepository("users"); original.(*DynamoCollection).consistentRead {
+		t.Fatal("Expected the repository of the backend to be unchanged")
+	}
+	if again, _ := session.GetRepository("users"); again != repo {
+		t.Fatal("Expected the same repository within the session")
+	}
+	if _, err := session.GetRepository("orders"); err == nil {
+		t.Fatal("Expected an error for an unknown repository")
+	}
+
+	session.Close()
+	if _, err := session.GetRepository("users"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput on a closed session. Got: ", err)
+	}
+}
+
+func TestMongoSessionInSession(t *testing.T) {
+	pinned := &mgo.Session{}
+	ctx := context.Background()
+	repo := &MongoSession{repoDef: RepositoryDefinitionMap{}, readPreference: ReadSecondary}
+	view := repo.InSession(&Session{mongo: pinned, ctx: ctx}).(*MongoSession)
+	if view.pinned != pinned || view.operation.Context != ctx || repo.pinned != nil {
+		t.Fatal("Expected a copy of the repository on the session connection")
+	}
+}
+
+func TestSessionUnavailable(t *testing.T) {
+	connector := newMongoConnector(func() (*mgo.Session, *Capabilities, error) {
+		return nil, nil, errors.New("no reachable servers")
+	}, "app", time.Second, time.Second)
+	ctx := context.WithValue(context.Background(), MONGO_CONNECTOR_CTX_KEY, connector)
+	backend := NewRepositoriesBackend(ctx, &config.DBInfo{}, repoBuilderFn, nil)
+
+	if _, err := backend.Session(context.Background()); err == nil || !IsErrBackendUnavailable(err) {
+		t.Fatal("Expected ErrBackendUnavailable before the backend connects. Got: ", err)
+	}
+}
@@ -0,0 +1,290 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NewRepoDefFromStruct returns the repository definition derived from the model struct, so the struct is
+// the single source of truth for the indexes, the keys, the TTL attribute and the document schema. The
+// fields are configured with the "backend" tag:
+//
+//	type User struct {
+//		_         struct{}  `backend:"name=users"`
+//		ID        string    `json:"id,omitempty"`
+//		Email     string    `json:"email" backend:"unique,required"`
+//		TenantID  string    `json:"tenantId" backend:"index=tenant_created"`
+//		CreatedAt time.Time `json:"createdAt" backend:"index=tenant_created"`
+//		ExpiresAt time.Time `json:"expiresAt,omitempty" backend:"ttl=0"`
+//	}
+//
+// The options of the fields are:
+//
+//	index          a non-unique index on the field
+//	index=<name>   a compound index of all fields with the index name, in the order of the fields
+//	unique         a unique index on the field (unique=<name> for a compound unique index)
+//	sparse         the index of the field is sparse
+//	required       the property is required by the schema
+//	ttl[=<sec>]    the TTL attribute, with the TTL in seconds after its value (default 0)
+//	hashKey        the DynamoDB hash key, with the key type derived from the field type
+//	rangeKey       the DynamoDB range key
+//
+// The options of the repository are set on a blank field (_): name=<name> (defaults to the struct name
+// with the first letter in lower case), customId, fieldNaming=<strategy> and attribution=<mode>. The properties are named as
+// the repository stores them (see "Mapping structs to records"), and their schema types are derived from the field types. The
+// returned definition can be changed before the repository is defined.
+func NewRepoDefFromStruct(model interface{}) (RepositoryDefinitionMap, error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrInvalidInput(fmt.Sprintf("the model must be a struct, got %T", model))
+	}
+
+	def := RepositoryDefinitionMap{"name": lowerFirst(t.Name())}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name != "_" {
+			continue
+		}
+		for _, option := range splitTagOptions(field.Tag.Get("backend")) {
+			key, value := option[0], option[1]
+			switch key {
+			case "name":
+				def["name"] = value
+			case "customId":
+				def["customId"] = true
+			case "fieldNaming":
+				if err := validFieldNaming(value); err != nil {
+					return nil, err
+				}
+				def["fieldNaming"] = value
+			case "attribution":
+				if err := validAttribution(value); err != nil {
+					return nil, err
+				}
+				def["attribution"] = value
+			default:
+				return nil, ErrInvalidInput(fmt.Sprintf("unknown repository option %s of %s", key, t.Name()))
+			}
+		}
+	}
+
+	indexes := []*IndexSpec{}
+	named := map[string]*IndexSpec{}
+	addToIndex := func(name, property string, unique bool) *IndexSpec {
+		if name == "" {
+			index := NewIndexSpec(property)
+			indexes = append(indexes, index)
+			return index
+		}
+		index, ok := named[name]
+		if !ok {
+			index = NewIndexSpec().Named(name)
+			named[name] = index
+			indexes = append(indexes, index)
+		}
+		index.Fields = append(index.Fields, property)
+		return index
+	}
+
+	naming := def.GetFieldNaming()
+	schema := &DocumentSchema{Type: "object", Properties: map[string]*DocumentSchema{}}
+	fields, _ := documentFields(t, naming)
+	for _, codecField := range fields {
+		field := t.FieldByIndex(codecField.index)
+		property := codecField.name
+		schema.Properties[property] = fieldSchema(field.Type, codecField.omitEmpty, naming, map[reflect.Type]bool{t: true})
+
+		fieldIndexes := []*IndexSpec{}
+		sparse := false
+		for _, option := range splitTagOptions(field.Tag.Get("backend")) {
+			key, value := option[0], option[1]
+			switch key {
+			case "index", "unique":
+				index := addToIndex(value, property, key == "unique")
+				if key == "unique" {
+					index.AsUnique()
+				}
+				if attributeType := dynamoAttributeType(field.Type); attributeType != "" {
+					index.WithAttributeType(property, attributeType)
+				}
+				fieldIndexes = append(fieldIndexes, index)
+			case "sparse":
+				sparse = true
+			case "required":
+				schema.Required = append(schema.Required, property)
+			case "ttl":
+				if !isTTLType(field.Type) {
+					return nil, ErrInvalidInput(fmt.Sprintf("the TTL attribute %s must be a time or an integer", property))
+				}
+				ttl := 0
+				if value != "" {
+					var err error
+					if ttl, err = strconv.Atoi(value); err != nil {
+						return nil, ErrInvalidInput(fmt.Sprintf("invalid TTL %s of %s", value, property))
+					}
+				}
+				def["enableTtl"] = true
+				def["ttlAttribute"] = property
+				def["ttl"] = ttl
+			case "hashKey", "rangeKey":
+				if _, ok := def[key]; ok {
+					return nil, ErrInvalidInput(fmt.Sprintf("%s is set on several fields of %s", key, t.Name()))
+				}
+				attributeType := dynamoAttributeType(field.Type)
+				if attributeType == "" {
+					return nil, ErrInvalidInput(fmt.Sprintf("%s %s must be a string, a number or bytes", key, property))
+				}
+				def[key] = property
+				def[key+"Type"] = attributeType
+			default:
+				return nil, ErrInvalidInput(fmt.Sprintf("unknown option %s of the field %s", key, field.Name))
+			}
+		}
+		if sparse {
+			for _, index := range fieldIndexes {
+				index.AsSparse()
+			}
+		}
+	}
+
+	if len(indexes) > 0 {
+		defIndexes := []Index{}
+		for _, index := range indexes {
+			defIndexes = append(defIndexes, index)
+		}
+		def["indexes"] = defIndexes
+	}
+	def["schema"] = schema
+	return def, nil
+}
+
+// splitTagOptions returns the options of the tag as pairs of the key and the value.
+func splitTagOptions(tag string) [][2]string {
+	options := [][2]string{}
+	for _, option := range strings.Split(tag, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		pair := [2]string{option, ""}
+		if eq := strings.Index(option, "="); eq >= 0 {
+			pair = [2]string{option[:eq], option[eq+1:]}
+		}
+		options = append(options, pair)
+	}
+	return options
+}
+
+// fieldSchema returns the schema of the values of the field type. The fields that can be nil, and are
+// stored as null unless they are omitted when empty, accept any value.
+func fieldSchema(t reflect.Type, omitEmpty bool, naming string, visited map[reflect.Type]bool) *DocumentSchema {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		if !omitEmpty {
+			return &DocumentSchema{}
+		}
+	}
+	return typeSchema(t, naming, visited)
+}
+
+// typeSchema returns the schema of the values of the type, as they are stored with the naming strategy.
+func typeSchema(t reflect.Type, naming string, visited map[reflect.Type]bool) *DocumentSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &DocumentSchema{Type: "string", Format: "date-time"}
+	case t == objectIDType:
+		return &DocumentSchema{Type: "string"}
+	case isDecimalType(t):
+		return &DocumentSchema{Type: "number"}
+	case implementsMarshaler(t) || implementsMarshaler(reflect.PtrTo(t)):
+		// custom encoding
+		return &DocumentSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &DocumentSchema{Type: "string"}
+	case reflect.Bool:
+		return &DocumentSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &DocumentSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &DocumentSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// bytes
+			return &DocumentSchema{}
+		}
+		return &DocumentSchema{Type: "array", Items: fieldSchema(t.Elem(), false, naming, visited)}
+	case reflect.Map:
+		return &DocumentSchema{Type: "object"}
+	case reflect.Struct:
+		if visited[t] {
+			return &DocumentSchema{Type: "object"}
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		schema := &DocumentSchema{Type: "object", Properties: map[string]*DocumentSchema{}}
+		fields, _ := documentFields(t, naming)
+		for _, field := range fields {
+			schema.Properties[field.name] = fieldSchema(t.FieldByIndex(field.index).Type, field.omitEmpty, naming, visited)
+		}
+		return schema
+	}
+	return &DocumentSchema{}
+}
+
+// dynamoAttributeType returns the DynamoDB type of the key attribute of the field type, or "" if the
+// type cannot be a key.
+func dynamoAttributeType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "S"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "N"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "B"
+		}
+	}
+	if t == timeType {
+		return "S"
+	}
+	return ""
+}
+
+func isTTLType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return t == timeType
+}
+
+func lowerFirst(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
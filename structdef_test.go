@@ -0,0 +1,97 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+type structDefAddress struct {
+	City string `json:"city"`
+}
+
+type structDefUser struct {
+	_         struct{}          `backend:"name=users,customId"`
+	ID        string            `json:"id,omitempty" backend:"hashKey"`
+	Email     string            `json:"email" backend:"unique,required"`
+	TenantID  string            `json:"tenantId" backend:"index=tenant_age"`
+	Age       int               `json:"age" backend:"index=tenant_age"`
+	Nickname  string            `json:"nickname,omitempty" backend:"index,sparse"`
+	Tags      []string          `json:"tags,omitempty"`
+	Address   *structDefAddress `json:"address"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt int64             `json:"expiresAt,omitempty" backend:"ttl"`
+}
+
+func TestNewRepoDefFromStruct(t *testing.T) {
+	def, err := NewRepoDefFromStruct(&structDefUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.GetName() != "users" || !def.IsCustomID() {
+		t.Fatal("Expected the repository options. Got: ", def)
+	}
+	if def.GetHashKey() != "id" || def.GetHashKeyType() != "S" {
+		t.Fatal("Expected the hash key. Got: ", def.GetHashKey(), def.GetHashKeyType())
+	}
+	if !def.EnableTTL() || def.GetTTLAttribute() != "expiresAt" || def.GetTTL() != 0 {
+		t.Fatal("Expected the TTL attribute. Got: ", def)
+	}
+
+	indexes := def.GetIndexes()
+	if len(indexes) != 3 {
+		t.Fatal("Expected 3 indexes. Got: ", len(indexes))
+	}
+	if indexes[0].GetName() != "email" || !indexes[0].Unique() {
+		t.Fatal("Expected a unique index on the email. Got: ", indexes[0])
+	}
+	if fields := indexes[1].GetFields(); indexes[1].GetName() != "tenant_age" || len(fields) != 2 || fields[1] != "age" || indexes[1].Unique() {
+		t.Fatal("Expected a compound index. Got: ", indexes[1])
+	}
+	if attributeType := indexes[1].(SecondaryIndex).GetAttributeType("age"); attributeType != "N" {
+		t.Fatal("Expected the number attribute type. Got: ", attributeType)
+	}
+	if !indexes[2].Sparse() || indexes[2].GetFields()[0] != "nickname" {
+		t.Fatal("Expected a sparse index on the nickname. Got: ", indexes[2])
+	}
+
+	schema := def.GetSchema()
+	if schema.Properties["age"].Type != "integer" || schema.Properties["createdAt"].Format != "date-time" ||
+		schema.Properties["tags"].Items.Type != "string" || schema.Properties["address"].Type != "" {
+		t.Fatal("Expected the types of the fields. Got: ", schema.Properties)
+	}
+	if len(schema.Required) != 1 || schema.Required[0] != "email" {
+		t.Fatal("Expected the email to be required. Got: ", schema.Required)
+	}
+
+	user := &structDefUser{Email: "ann@example.com", Age: 30, Tags: []string{"a"}, CreatedAt: time.Now()}
+	if errors := schema.Validate(user, false); len(errors) != 0 {
+		t.Fatal("Expected the record of the struct to be valid. Got: ", errors[0])
+	}
+	if errors := schema.Validate(map[string]interface{}{"email": "ann@example.com", "age": "30"}, false); len(errors) != 1 {
+		t.Fatal("Expected a type error. Got: ", errors)
+	}
+}
+
+func TestNewRepoDefFromStructInvalid(t *testing.T) {
+	invalid := []interface{}{
+		"users",
+		&struct {
+			Name string `backend:"indexed"`
+		}{},
+		&struct {
+			Expires string `backend:"ttl"`
+		}{},
+		&struct {
+			A string `backend:"hashKey"`
+			B string `backend:"hashKey"`
+		}{},
+		&struct {
+			_ struct{} `backend:"table=users"`
+		}{},
+	}
+	for _, model := range invalid {
+		if _, err := NewRepoDefFromStruct(model); err == nil || !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %#v. Got: %v", model, err)
+		}
+	}
+}
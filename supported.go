@@ -2,21 +2,135 @@ package backends
 
 import "github.com/Microkubes/microservice-tools/config"
 
+// collectionRules are the conditional requirements of the collection properties.
+var collectionRules = []*ValidationRule{
+	{When: map[string]interface{}{"enableTTL": true}, Require: []string{"TTL", "ttlAttribute"}},
+	{When: map[string]interface{}{"ttlMode": TTLExpireAt}, Optional: []string{"TTL"}},
+}
+
+// autoScalingSchema is the schema of the DynamoDB auto-scaling configuration.
+var autoScalingSchema = map[string]interface{}{
+	"minRead":           "int",
+	"maxRead":           "int",
+	"minWrite":          "int",
+	"maxWrite":          "int",
+	"targetUtilization": "int",
+	SchemaRequired:      []string{"minRead", "maxRead", "minWrite", "maxWrite"},
+}
+
+// archiveSchema is the schema of the archival policy of the repositories.
+var archiveSchema = map[string]interface{}{
+	"attribute":    "string",
+	"after":        "string:duration",
+	SchemaRequired: []string{"attribute", "after"},
+}
+
+// relationsSchema is the schema of the relations to the other repositories, by relation name.
+var relationsSchema = map[string]interface{}{
+	"string": map[string]interface{}{
+		"type":         "string",
+		"repository":   "string",
+		"foreignKey":   "string",
+		"onDelete":     "string",
+		SchemaRequired: []string{"type", "repository", "foreignKey"},
+	},
+}
+
 // addSupported adds new backends
 func addSupported(manager BackendManager) {
 	manager.SupportBackend("mongodb", MongoDBBackendBuilder, map[string]interface{}{
 		"dbName":   "string",
-		"host":     "string",
+		"host":     "string:hostport",
 		"database": "string",
 		"collections": map[string]interface{}{
 			"string": map[string]interface{}{
-				"indexes":   "string array",
-				"enableTTL": "bool",
-				"TTL":       "int",
+				"indexes":          "string array",
+				"enableTTL":        "bool",
+				"TTL":              "int",
+				"ttlMode":          "string",
+				"ttlAttribute":     "string",
+				"uniqueIndexes":    "string array",
+				"customId":         "bool",
+				"idGenerator":      "string",
+				"idType":           "string",
+				"fieldNaming":      "string",
+				"attribution":      "string",
+				"filterableFields": "string array",
+				"sortableFields":   "string array",
+				"timestamps":       "bool",
+				"schema":           map[string]interface{}{},
+				SchemaRules:        collectionRules,
+				"database":         "string",
+				"archive":          archiveSchema,
+				"relations":        relationsSchema,
+				"collectionOptions": map[string]interface{}{
+					"capped":   "bool",
+					"maxBytes": "int",
+					"maxDocs":  "int",
+					"collation": map[string]interface{}{
+						"locale":   "string",
+						"strength": "int",
+					},
+					"validator":        map[string]interface{}{},
+					"schemaValidator":  "bool",
+					"validationLevel":  "string",
+					"validationAction": "string",
+					"timeSeries": map[string]interface{}{
+						"timeField":    "string",
+						"metaField":    "string",
+						"granularity":  "string",
+						SchemaRequired: []string{"timeField"},
+					},
+				},
+				"bootstrap": map[string]interface{}{
+					"key":        "string array",
+					"onConflict": "string",
+					"documents":  "object array",
+				},
 			},
 		},
 		"user": "string",
 		"pass": "string",
+		"options": map[string]interface{}{
+			"authMechanism":              "string",
+			"authSource":                 "string",
+			"gssapiServiceName":          "string",
+			"gssapiServiceHost":          "string",
+			"tls":                        "bool",
+			"tlsCertificateKeyFile":      "string",
+			"tlsCAFile":                  "string",
+			"tlsInsecure":                "bool",
+			"credentialsRefreshInterval": "string:duration",
+			"requireTransactions":        "bool",
+			"requireChangeStreams":       "bool",
+			"requireCollation":           "bool",
+			"lazyConnect":                "bool",
+			"reconcileIndexes":           "bool",
+			"reportCapacity":             "bool",
+			"maintenanceJournalSize":     "int",
+			"maintenanceOverflow":        "string",
+			"offlineJournal":             "string",
+			"offlineReplayInterval":      "string:duration",
+			"dropStaleIndexes":           "bool",
+			"reconnectInitialInterval":   "string:duration",
+			"reconnectMaxInterval":       "string:duration",
+			"namePrefix":                 "string",
+			"nameSuffix":                 "string",
+			"standby": map[string]interface{}{
+				"host":     "string:hostport",
+				"database": "string",
+				"user":     "string",
+				"pass":     "string",
+			},
+			"failoverThreshold":   "int",
+			"healthCheckInterval": "string:duration",
+			"autoFailback":        "bool",
+			"writeConcern": map[string]interface{}{
+				"w":        "int or string",
+				"j":        "bool",
+				"wtimeout": "int",
+			},
+		},
 	})
 
 	manager.SupportBackend("dynamodb", DynamoDBBackendBuilder, map[string]interface{}{
@@ -26,10 +140,65 @@ func addSupported(manager BackendManager) {
 		"database":    "string",
 		"collections": map[string]interface{}{
 			"string": map[string]interface{}{
-				"indexes":   "string array",
-				"enableTTL": "bool",
-				"TTL":       "int",
+				"indexes":          "string array",
+				"enableTTL":        "bool",
+				"TTL":              "int",
+				"ttlMode":          "string",
+				"ttlAttribute":     "string",
+				"uniqueIndexes":    "string array",
+				"customId":         "bool",
+				"idGenerator":      "string",
+				"idType":           "string",
+				"fieldNaming":      "string",
+				"attribution":      "string",
+				"filterableFields": "string array",
+				"sortableFields":   "string array",
+				"timestamps":       "bool",
+				"consistentRead":   "bool",
+				"billingMode":      "string",
+				"autoScaling":      autoScalingSchema,
+				"archive":          archiveSchema,
+				"relations":        relationsSchema,
+				"schema":           map[string]interface{}{},
+				SchemaRules:        collectionRules,
+				"bootstrap": map[string]interface{}{
+					"key":        "string array",
+					"onConflict": "string",
+					"documents":  "object array",
+				},
+			},
+		},
+		"options": map[string]interface{}{
+			"credentialsRefreshInterval": "string:duration",
+			"assumeRoleArn":              "string",
+			"assumeRoleExternalId":       "string",
+			"assumeRoleSessionName":      "string",
+			"assumeRoleDuration":         "string:duration",
+			"requireTransactions":        "bool",
+			"requireChangeStreams":       "bool",
+			"billingMode":                "string",
+			"autoScaling":                autoScalingSchema,
+			"standby": map[string]interface{}{
+				"awsRegion":   "string",
+				"endpoint":    "string",
+				"credentials": "string",
 			},
+			"failoverThreshold":      "int",
+			"healthCheckInterval":    "string:duration",
+			"autoFailback":           "bool",
+			"streamLeaseTable":       "string",
+			"streamLeaseDuration":    "string:duration",
+			"streamPollInterval":     "string:duration",
+			"streamStartFromLatest":  "bool",
+			"retryMode":              "string",
+			"maxRetries":             "int",
+			"reportCapacity":         "bool",
+			"maintenanceJournalSize": "int",
+			"maintenanceOverflow":    "string",
+			"offlineJournal":         "string",
+			"offlineReplayInterval":  "string:duration",
+			"namePrefix":             "string",
+			"nameSuffix":             "string",
 		},
 	})
 }
@@ -0,0 +1,358 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AppendRepository is implemented by the repositories with an append-only write path for the
+// measurements of a time series.
+type AppendRepository interface {
+	// Append inserts the records without reading them back. The records are validated and get IDs and
+	// timestamps as in Save, but are not mapped back into the objects.
+	Append(records ...interface{}) error
+}
+
+// Append inserts the records in the repository. For example, to store a batch of measurements:
+//
+//	err := backends.Append(metricsRepo, &Measurement{Sensor: "s1", Value: 21.5}, &Measurement{Sensor: "s2", Value: 19})
+//
+// Returns an error if the repository does not support appending records.
+func Append(repo Repository, records ...interface{}) error {
+	if r, ok := repo.(AppendRepository); ok {
+		return r.Append(records...)
+	}
+	return ErrInvalidInput(fmt.Sprintf("appending records is not supported on %T", repo))
+}
+
+// Aggregation operators of the rollups.
+const (
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateCount = "count"
+)
+
+// Aggregate is a value computed for each bucket of a rollup.
+type Aggregate struct {
+	// Name is the key of the value in RollupBucket.Values.
+	Name string
+	// Op is AggregateSum, AggregateAvg, AggregateMin, AggregateMax or AggregateCount.
+	Op string
+	// Field is the aggregated property. It is not used by AggregateCount.
+	Field string
+}
+
+// RollupQuery groups the records matched by the filter into buckets of Interval by their time, and
+// aggregates the values of each bucket.
+type RollupQuery struct {
+	// Filter selects the records.
+	Filter Filter
+	// TimeField is the property holding the time of the record. The timeField of the time-series collection
+	// is used if not set.
+	TimeField string
+	// From and To limit the records to the range [From, To). The zero times are not used.
+	From time.Time
+	To   time.Time
+	// Interval is the length of the buckets.
+	Interval time.Duration
+	// GroupBy splits the buckets by the values of the properties, for example by sensor.
+	GroupBy []string
+	// Aggregates are the values computed for the buckets.
+	Aggregates []*Aggregate
+}
+
+// RollupBucket is the aggregated values of the records in a time interval.
+type RollupBucket struct {
+	// Start is the start of the interval.
+	Start time.Time
+	// Group is the values of the GroupBy properties of the bucket.
+	Group map[string]interface{}
+	// Values is the aggregated values, by the name of the aggregate.
+	Values map[string]float64
+}
+
+// RollupRepository is implemented by the repositories that can aggregate the records by time.
+type RollupRepository interface {
+	// Rollup returns the buckets of the query ordered by their start time.
+	Rollup(query *RollupQuery) ([]*RollupBucket, error)
+}
+
+// Rollup aggregates the records of the repository by time. For example, the hourly average
+// temperature of each sensor in the last day:
+//
+//	buckets, err := backends.Rollup(metricsRepo, &backends.RollupQuery{
+//		From:       time.Now().Add(-24 * time.Hour),
+//		Interval:   time.Hour,
+//		GroupBy:    []string{"sensor"},
+//		Aggregates: []*backends.Aggregate{{Name: "temperature", Op: backends.AggregateAvg, Field: "value"}},
+//	})
+//
+// Returns an error if the repository does not support rollups.
+func Rollup(repo Repository, query *RollupQuery) ([]*RollupBucket, error) {
+	if r, ok := repo.(RollupRepository); ok {
+		return r.Rollup(query)
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("rollups are not supported on %T", repo))
+}
+
+// Append inserts the records in the repository on the active backend.
+func (r *failoverRepository) Append(records ...interface{}) error {
+	repository, err := r.active()
+	if err != nil {
+		return err
+	}
+	return Append(repository, records...)
+}
+
+// Rollup aggregates the records of the repository on the active backend.
+func (r *failoverRepository) Rollup(query *RollupQuery) ([]*RollupBucket, error) {
+	repository, err := r.active()
+	if err != nil {
+		return nil, err
+	}
+	return Rollup(repository, query)
+}
+
+// Append inserts the records with an unordered bulk insert, so the server does not stop on the first
+// failed record. The time field of a time-series collection is set to the current time if missing.
+func (s *MongoSession) Append(records ...interface{}) error {
+	done, err := s.tracker.track()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.maintenance.check(s.repoDef); err != nil {
+		return err
+	}
+	if err := s.checkConnected(); err != nil {
+		return err
+	}
+
+	timeField := ""
+	if options := s.repoDef.GetCollectionOptions(); options != nil && options.TimeSeries != nil {
+		timeField = options.TimeSeries.TimeField
+	}
+
+	documents := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		document, err := s.appendDocument(record, timeField)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, document)
+	}
+
+	session, c := s.getWriteCollection()
+	defer session.Close()
+
+	bulk := c.Bulk()
+	bulk.Unordered()
+	bulk.Insert(documents...)
+	if _, err := bulk.Run(); err != nil {
+		if mgo.IsDup(err) {
+			return mongoDuplicateKeyError(err, s.repoDef)
+		}
+		return err
+	}
+	return nil
+}
+
+// appendDocument returns the document inserted for the record by Append.
+func (s *MongoSession) appendDocument(record interface{}, timeField string) (map[string]interface{}, error) {
+	payload, err := interfaceToMap(record, s.repoDef.GetFieldNaming())
+	if err != nil {
+		return nil, err
+	}
+	// the record is not changed
+	document := make(map[string]interface{}, len(*payload)+1)
+	for key, value := range mongoValues(*payload) {
+		document[key] = value
+	}
+
+	if err := validateDocument(document, s.repoDef, true); err != nil {
+		return nil, err
+	}
+	applyTimestamps(document, s.repoDef, true)
+	if err := applyAttribution(document, s.repoDef, true, ActorFromContext(s.operation.Context)); err != nil {
+		return nil, err
+	}
+
+	if timeField != "" {
+		switch value := document[timeField].(type) {
+		case nil:
+			document[timeField] = time.Now().UTC()
+		case time.Time:
+		case string:
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, ErrInvalidInput(fmt.Sprintf("invalid time %s in %s", value, timeField))
+			}
+			document[timeField] = t
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid time %v in %s", value, timeField))
+		}
+	}
+
+	if err := generateID(document, s.repoDef.GetIDGenerator(), "", s.nextSequence); err != nil {
+		return nil, err
+	}
+	id, err := s.newRecordID(document)
+	if err != nil {
+		return nil, err
+	}
+	document["_id"] = id
+	if !s.repoDef.IsCustomID() {
+		delete(document, "id")
+	}
+	return document, nil
+}
+
+// Rollup runs the aggregation pipeline of the query on the collection.
+func (s *MongoSession) Rollup(query *RollupQuery) ([]*RollupBucket, error) {
+	done, err := s.tracker.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	pipeline, err := mongoRollupPipeline(query, s.repoDef)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	session, c := s.getReadCollection()
+	defer session.Close()
+
+	documents := []bson.M{}
+	if err := c.Pipe(pipeline).All(&documents); err != nil {
+		return nil, err
+	}
+	return mongoRollupBuckets(query, documents), nil
+}
+
+// mongoRollupPipeline returns the aggregation pipeline of the rollup. The records are grouped by the start
+// of their interval, the time truncated to a multiple of the interval since the Unix epoch.
+func mongoRollupPipeline(query *RollupQuery, repoDef RepositoryDefinition) ([]bson.M, error) {
+	if query == nil {
+		return nil, ErrInvalidInput("the rollup query is nil")
+	}
+	timeField := query.TimeField
+	if timeField == "" {
+		if options := repoDef.GetCollectionOptions(); options != nil && options.TimeSeries != nil {
+			timeField = options.TimeSeries.TimeField
+		}
+	}
+	if timeField == "" {
+		return nil, ErrInvalidInput("the rollup needs the time field")
+	}
+	if query.Interval < time.Millisecond {
+		return nil, ErrInvalidInput("the rollup interval must be at least a millisecond")
+	}
+	if len(query.Aggregates) == 0 {
+		return nil, ErrInvalidInput("the rollup needs an aggregate")
+	}
+
+	match, err := toMongoFilter(query.Filter)
+	if err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		timeRange := bson.M{}
+		if !query.From.IsZero() {
+			timeRange["$gte"] = query.From
+		}
+		if !query.To.IsZero() {
+			timeRange["$lt"] = query.To
+		}
+		match[timeField] = timeRange
+	}
+
+	millis := bson.M{"$toLong": "$" + timeField}
+	id := bson.M{
+		"start": bson.M{"$toDate": bson.M{"$subtract": []interface{}{
+			millis, bson.M{"$mod": []interface{}{millis, int64(query.Interval / time.Millisecond)}},
+		}}},
+	}
+	for i, field := range query.GroupBy {
+		id[fmt.Sprintf("g%d", i)] = "$" + field
+	}
+
+	group := bson.M{"_id": id}
+	for _, aggregate := range query.Aggregates {
+		if aggregate.Name == "" || aggregate.Name == "_id" || strings.ContainsAny(aggregate.Name, ".$") {
+			return nil, ErrInvalidInput(fmt.Sprintf("invalid aggregate name %q", aggregate.Name))
+		}
+		switch aggregate.Op {
+		case AggregateCount:
+			group[aggregate.Name] = bson.M{"$sum": 1}
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+			if aggregate.Field == "" {
+				return nil, ErrInvalidInput(fmt.Sprintf("the aggregate %s needs the field", aggregate.Name))
+			}
+			group[aggregate.Name] = bson.M{"$" + aggregate.Op: "$" + aggregate.Field}
+		default:
+			return nil, ErrInvalidInput(fmt.Sprintf("unknown aggregate operator %s", aggregate.Op))
+		}
+	}
+
+	return []bson.M{
+		{"$match": match},
+		{"$group": group},
+		{"$sort": bson.M{"_id.start": 1}},
+	}, nil
+}
+
+// mongoRollupBuckets converts the results of the rollup pipeline to buckets. The buckets with the same start
+// are ordered by their group, so the results are stable.
+func mongoRollupBuckets(query *RollupQuery, documents []bson.M) []*RollupBucket {
+	buckets := make([]*RollupBucket, 0, len(documents))
+	for _, document := range documents {
+		id, _ := document["_id"].(bson.M)
+		bucket := &RollupBucket{
+			Group:  map[string]interface{}{},
+			Values: map[string]float64{},
+		}
+		if start, ok := id["start"].(time.Time); ok {
+			bucket.Start = start.UTC()
+		}
+		for i, field := range query.GroupBy {
+			bucket.Group[field] = id[fmt.Sprintf("g%d", i)]
+		}
+		for _, aggregate := range query.Aggregates {
+			if value, ok := jsonNumber(document[aggregate.Name]); ok {
+				bucket.Values[aggregate.Name] = value
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if !buckets[i].Start.Equal(buckets[j].Start) {
+			return buckets[i].Start.Before(buckets[j].Start)
+		}
+		return fmt.Sprint(groupValues(query, buckets[i])) < fmt.Sprint(groupValues(query, buckets[j]))
+	})
+	return buckets
+}
+
+// groupValues returns the values of the GroupBy properties of the bucket, in order.
+func groupValues(query *RollupQuery, bucket *RollupBucket) []interface{} {
+	values := make([]interface{}, 0, len(query.GroupBy))
+	for _, field := range query.GroupBy {
+		values = append(values, bucket.Group[field])
+	}
+	return values
+}
@@ -0,0 +1,189 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func timeSeriesDefinition() RepositoryDefinitionMap {
+	return RepositoryDefinitionMap{
+		"name": "metrics",
+		"collectionOptions": map[string]interface{}{
+			"timeSeries": map[string]interface{}{"timeField": "timestamp", "metaField": "sensor", "granularity": "minutes"},
+		},
+	}
+}
+
+func TestTimeSeriesOptions(t *testing.T) {
+	def := timeSeriesDefinition()
+	options := def.GetCollectionOptions()
+	expected := &TimeSeriesOptions{TimeField: "timestamp", MetaField: "sensor", Granularity: GranularityMinutes}
+	if !reflect.DeepEqual(options.TimeSeries, expected) {
+		t.Fatalf("Unexpected time-series options: %+v", options.TimeSeries)
+	}
+	if err := validCollectionOptions(def); err != nil {
+		t.Fatal(err)
+	}
+	if !isTimeSeries(def) || isTimeSeries(RepositoryDefinitionMap{}) {
+		t.Fatal("isTimeSeries: unexpected result")
+	}
+
+	command := mongoCreateCommand("metrics", options, nil)
+	if len(command) != 2 || command[1].Name != "timeseries" ||
+		!reflect.DeepEqual(command[1].Value, bson.M{"timeField": "timestamp", "metaField": "sensor", "granularity": "minutes"}) {
+		t.Fatalf("Unexpected create command: %v", command)
+	}
+}
+
+func TestValidTimeSeriesOptions(t *testing.T) {
+	invalid := []RepositoryDefinitionMap{
+		{"collectionOptions": &CollectionOptions{TimeSeries: &TimeSeriesOptions{}}},
+		{"collectionOptions": &CollectionOptions{TimeSeries: &TimeSeriesOptions{TimeField: "ts", Granularity: "days"}}},
+		{"collectionOptions": &CollectionOptions{Capped: true, MaxBytes: 1024, TimeSeries: &TimeSeriesOptions{TimeField: "ts"}}},
+		{
+			"collectionOptions": &CollectionOptions{TimeSeries: &TimeSeriesOptions{TimeField: "ts"}},
+			"enableTtl":         true, "ttl": 60, "ttlAttribute": "created",
+		},
+		{
+			"collectionOptions": &CollectionOptions{TimeSeries: &TimeSeriesOptions{TimeField: "ts"}},
+			"indexes":           []Index{NewUniqueIndex("sensor")},
+		},
+	}
+	for _, def := range invalid {
+		if err := validCollectionOptions(def); !IsErrInvalidInput(err) {
+			t.Errorf("Expected ErrInvalidInput for %v. Got: %v", def, err)
+		}
+	}
+
+	def := RepositoryDefinitionMap{
+		"collectionOptions": &CollectionOptions{TimeSeries: &TimeSeriesOptions{TimeField: "ts"}},
+		"enableTtl":         true, "ttl": 60, "ttlAttribute": "ts",
+	}
+	if err := validCollectionOptions(def); err != nil {
+		t.Fatal(err)
+	}
+	// the measurements expire with the collection option, not a TTL index
+	indexes, err := mongoIndexes(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 0 {
+		t.Fatalf("Expected no TTL index. Got: %v", indexes)
+	}
+}
+
+func TestMongoRollupPipeline(t *testing.T) {
+	from := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	query := &RollupQuery{
+		Filter:   Filter{"region": "eu"},
+		From:     from,
+		Interval: time.Hour,
+		GroupBy:  []string{"sensor"},
+		Aggregates: []*Aggregate{
+			{Name: "avg", Op: AggregateAvg, Field: "value"},
+			{Name: "n", Op: AggregateCount},
+		},
+	}
+	pipeline, err := mongoRollupPipeline(query, timeSeriesDefinition())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	millis := bson.M{"$toLong": "$timestamp"}
+	expected := []bson.M{
+		{"$match": map[string]interface{}{"region": "eu", "timestamp": bson.M{"$gte": from}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"start": bson.M{"$toDate": bson.M{"$subtract": []interface{}{
+					millis, bson.M{"$mod": []interface{}{millis, int64(3600000)}},
+				}}},
+				"g0": "$sensor",
+			},
+			"avg": bson.M{"$avg": "$value"},
+			"n":   bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id.start": 1}},
+	}
+	if !reflect.DeepEqual(pipeline, expected) {
+		t.Fatalf("Unexpected pipeline:\n%v\nExpected:\n%v", pipeline, expected)
+	}
+}
+
+func TestMongoRollupPipelineInvalid(t *testing.T) {
+	avg := []*Aggregate{{Name: "avg", Op: AggregateAvg, Field: "value"}}
+	invalid := []*RollupQuery{
+		nil,
+		{Aggregates: avg},
+		{Interval: time.Minute},
+		{Interval: time.Minute, Aggregates: []*Aggregate{{Name: "a.b", Op: AggregateCount}}},
+		{Interval: time.Minute, Aggregates: []*Aggregate{{Name: "p", Op: "median", Field: "value"}}},
+		{Interval: time.Minute, Aggregates: []*Aggregate{{Name: "s", Op: AggregateSum}}},
+	}
+	for _, query := range invalid {
+		if _, err := mongoRollupPipeline(query, timeSeriesDefinition()); !IsErrInvalidInput(err) {
+			t.Errorf("Expected ErrInvalidInput for %+v. Got: %v", query, err)
+		}
+	}
+	// without a time-series collection, the query needs the time field
+	if _, err := mongoRollupPipeline(&RollupQuery{Interval: time.Minute, Aggregates: avg}, RepositoryDefinitionMap{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput without the time field. Got: ", err)
+	}
+}
+
+func TestMongoRollupBuckets(t *testing.T) {
+	hour := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	query := &RollupQuery{
+		GroupBy:    []string{"sensor"},
+		Aggregates: []*Aggregate{{Name: "avg", Op: AggregateAvg, Field: "value"}, {Name: "n", Op: AggregateCount}},
+	}
+	buckets := mongoRollupBuckets(query, []bson.M{
+		{"_id": bson.M{"start": hour, "g0": "s2"}, "avg": 20.5, "n": 2},
+		{"_id": bson.M{"start": hour, "g0": "s1"}, "avg": 19.0, "n": 1},
+	})
+	if len(buckets) != 2 || buckets[0].Group["sensor"] != "s1" || buckets[1].Group["sensor"] != "s2" {
+		t.Fatalf("Unexpected buckets: %v", buckets)
+	}
+	if !buckets[1].Start.Equal(hour) || buckets[1].Values["avg"] != 20.5 || buckets[1].Values["n"] != 2 {
+		t.Fatalf("Unexpected bucket: %+v", buckets[1])
+	}
+}
+
+func TestAppendNotSupported(t *testing.T) {
+	if err := Append(&DynamoCollection{}, &map[string]interface{}{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+	if _, err := Rollup(&DynamoCollection{}, &RollupQuery{}); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput. Got: ", err)
+	}
+}
+
+func TestMongoAppendDocument(t *testing.T) {
+	s := &MongoSession{repoDef: timeSeriesDefinition()}
+	record := &map[string]interface{}{"sensor": "s1", "value": 21.5, "timestamp": "2021-06-01T10:00:00Z"}
+	document, err := s.appendDocument(record, "timestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document["_id"]; !ok {
+		t.Fatal("Expected the document to have an _id. Got: ", document)
+	}
+	if ts, ok := document["timestamp"].(time.Time); !ok || !ts.Equal(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatal("Expected the parsed timestamp. Got: ", document["timestamp"])
+	}
+	if _, ok := (*record)["_id"]; ok {
+		t.Fatal("Expected the record to be unchanged")
+	}
+
+	if document, err = s.appendDocument(&map[string]interface{}{"value": 1}, "timestamp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document["timestamp"].(time.Time); !ok {
+		t.Fatal("Expected the current time for a missing timestamp. Got: ", document["timestamp"])
+	}
+	if _, err = s.appendDocument(&map[string]interface{}{"timestamp": "yesterday"}, "timestamp"); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid time. Got: ", err)
+	}
+}
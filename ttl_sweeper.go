@@ -0,0 +1,217 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ExpiringRepository is implemented by repositories that can delete the expired records themselves
+// (for example with a single DELETE ... WHERE query). It is used by the TTLSweeper instead of scanning the records.
+type ExpiringRepository interface {
+	// DeleteExpired deletes up to limit records that expired before the given time.
+	// Returns the number of deleted records.
+	DeleteExpired(before time.Time, limit int) (int, error)
+}
+
+// SweeperConfig configures the TTLSweeper.
+type SweeperConfig struct {
+	// Interval between the sweeps. Defaults to 1 minute.
+	Interval time.Duration
+	// Jitter is the maximal random delay added to every interval, so multiple instances do not sweep at the same time.
+	Jitter time.Duration
+	// BatchSize is the maximal number of records deleted in one batch. Defaults to 100.
+	BatchSize int
+}
+
+// TTLSweeper periodically deletes the expired records of a repository, for backends without native TTL support.
+// The records expire according to the TTL settings of the repository definition (enableTtl, ttl, ttlAttribute, ttlMode).
+type TTLSweeper struct {
+	repo   Repository
+	def    RepositoryDefinition
+	config SweeperConfig
+	stop   chan struct{}
+	once   *sync.Once
+}
+
+// NewTTLSweeper creates a sweeper for the repository. Call Start to begin sweeping in the background:
+// 		sweeper := backends.NewTTLSweeper(repo, repoDef, backends.SweeperConfig{Interval: time.Minute})
+// 		sweeper.Start()
+// 		backend.(*backends.RepositoriesBackend).OnShutdown(sweeper.Stop)
+func NewTTLSweeper(repo Repository, def RepositoryDefinition, config SweeperConfig) *TTLSweeper {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &TTLSweeper{
+		repo:   repo,
+		def:    def,
+		config: config,
+		stop:   make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// Start runs the sweeps in the background until Stop is called.
+func (s *TTLSweeper) Start() {
+	if !s.def.EnableTTL() {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(s.nextInterval()):
+			}
+			if _, err := s.Sweep(); err != nil {
+				log.Printf("ERROR: failed to delete the expired records from %s: %s\n", s.def.GetName(), err.Error())
+			}
+		}
+	}()
+}
+
+// Stop stops the background sweeps.
+func (s *TTLSweeper) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *TTLSweeper) nextInterval() time.Duration {
+	if s.config.Jitter <= 0 {
+		return s.config.Interval
+	}
+	return s.config.Interval + time.Duration(rand.Int63n(int64(s.config.Jitter)))
+}
+
+// Sweep deletes the expired records in batches. Returns the number of deleted records.
+func (s *TTLSweeper) Sweep() (int, error) {
+	if !s.def.EnableTTL() {
+		return 0, nil
+	}
+
+	expiring, ok := s.repo.(ExpiringRepository)
+	if !ok {
+		return s.sweepByQuery()
+	}
+
+	before, err := s.expiredBefore()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for {
+		deleted, err := expiring.DeleteExpired(before, s.config.BatchSize)
+		total += deleted
+		if err != nil || deleted < s.config.BatchSize || s.stopped() {
+			return total, err
+		}
+	}
+}
+
+// expiredBefore returns the time before which the values of the TTL attribute are expired.
+func (s *TTLSweeper) expiredBefore() (time.Time, error) {
+	switch s.def.GetTTLMode() {
+	case TTLExpireAt:
+		return time.Now(), nil
+	case TTLFixed, "":
+		return time.Now().Add(-time.Duration(s.def.GetTTL()) * time.Second), nil
+	}
+	return time.Time{}, ErrInvalidInput(fmt.Sprintf("unknown TTL mode %s", s.def.GetTTLMode()))
+}
+
+// sweepByQuery deletes the expired records in batches, queried with an Until filter on the TTL attribute.
+func (s *TTLSweeper) sweepByQuery() (int, error) {
+	before, err := s.expiredBefore()
+	if err != nil {
+		return 0, err
+	}
+	filter := NewFilter().Until(s.def.GetTTLAttribute(), before)
+
+	total := 0
+	for {
+		deleted, found, err := s.deleteBatch(filter)
+		total += deleted
+		if err != nil || found < s.config.BatchSize || s.stopped() {
+			return total, err
+		}
+	}
+}
+
+// deleteBatch deletes a batch of the records matched by the filter. Returns the number of deleted and
+// the number of matched records.
+func (s *TTLSweeper) deleteBatch(filter Filter) (int, int, error) {
+	results, err := s.repo.GetAll(filter, map[string]interface{}{}, "", "", s.config.BatchSize, 0)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	ids := []interface{}{}
+	err = IterateOverSlice(results, func(i int, item interface{}) error {
+		record, err := toAuditMap(item)
+		if err != nil {
+			return err
+		}
+		if record["id"] == nil {
+			return ErrInvalidInput(fmt.Sprintf("can not delete an expired record without id from %s", s.def.GetName()))
+		}
+		ids = append(ids, record["id"])
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := s.repo.DeleteOne(Filter{"id": id}); err != nil {
+			if IsErrNotFound(err) {
+				continue
+			}
+			return deleted, len(ids), err
+		}
+		deleted++
+	}
+	return deleted, len(ids), nil
+}
+
+func (s *TTLSweeper) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// asTime parses the value of the TTL attribute: time.Time, RFC3339 string or Unix timestamp in seconds.
+func asTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0), true
+		}
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	}
+	return time.Time{}, false
+}
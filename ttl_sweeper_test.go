@@ -0,0 +1,106 @@
+package backends
+
+import (
+	"testing"
+	"time"
+)
+
+type expiringMemoryRepo struct {
+	*memoryRepo
+	calls int
+}
+
+func (r *expiringMemoryRepo) DeleteExpired(before time.Time, limit int) (int, error) {
+	r.calls++
+	deleted := 0
+	for i := 0; i < len(r.records) && deleted < limit; {
+		if r.records[i]["expires_at"].(time.Time).Before(before) {
+			r.records = append(r.records[:i], r.records[i+1:]...)
+			deleted++
+			continue
+		}
+		i++
+	}
+	return deleted, nil
+}
+
+type batchCountingRepo struct {
+	*datedMemoryRepo
+	limits []int
+}
+
+func (r *batchCountingRepo) GetAll(filter Filter, resultsTypeHint interface{}, order string, sorting string, limit int, offset int) (interface{}, error) {
+	r.limits = append(r.limits, limit)
+	return r.datedMemoryRepo.GetAll(filter, resultsTypeHint, order, sorting, limit, offset)
+}
+
+func TestTTLSweeperQuery(t *testing.T) {
+	now := time.Now()
+	repo := &batchCountingRepo{datedMemoryRepo: &datedMemoryRepo{&memoryRepo{
+		records: []map[string]interface{}{
+			{"id": "1", "created_at": now.Add(-2 * time.Hour)},
+			{"id": "2", "created_at": now},
+			{"id": "3", "created_at": now.Add(-3 * time.Hour).Unix()},
+			{"id": "4"},
+		},
+	}}}
+	sweeper := NewTTLSweeper(repo, RepositoryDefinitionMap{
+		"enableTtl":    true,
+		"ttl":          3600,
+		"ttlAttribute": "created_at",
+	}, SweeperConfig{BatchSize: 1})
+
+	deleted, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || len(repo.records) != 2 || repo.records[0]["id"] != "2" || repo.records[1]["id"] != "4" {
+		t.Fatal("Expected the expired records to be deleted. Got: ", deleted, repo.records)
+	}
+	if len(repo.limits) != 3 || repo.limits[0] != 1 {
+		t.Fatal("Expected the expired records to be queried in batches until a batch is short. Got: ", repo.limits)
+	}
+}
+
+func TestTTLSweeperExpiringRepository(t *testing.T) {
+	now := time.Now()
+	repo := &expiringMemoryRepo{
+		memoryRepo: &memoryRepo{
+			records: []map[string]interface{}{
+				{"id": "1", "expires_at": now.Add(-time.Minute)},
+				{"id": "2", "expires_at": now.Add(-time.Minute)},
+				{"id": "3", "expires_at": now.Add(time.Hour)},
+			},
+		},
+	}
+	sweeper := NewTTLSweeper(repo, RepositoryDefinitionMap{
+		"enableTtl":    true,
+		"ttlMode":      TTLExpireAt,
+		"ttlAttribute": "expires_at",
+	}, SweeperConfig{BatchSize: 1})
+
+	deleted, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || len(repo.records) != 1 {
+		t.Fatal("Expected 2 expired records to be deleted. Got: ", deleted)
+	}
+	if repo.calls != 3 {
+		t.Fatal("Expected the records to be deleted in batches. Got calls: ", repo.calls)
+	}
+}
+
+func TestTTLSweeperInterval(t *testing.T) {
+	sweeper := NewTTLSweeper(&memoryRepo{}, RepositoryDefinitionMap{}, SweeperConfig{
+		Interval: time.Second,
+		Jitter:   time.Second,
+	})
+	for i := 0; i < 10; i++ {
+		if interval := sweeper.nextInterval(); interval < time.Second || interval >= 2*time.Second {
+			t.Fatal("Interval out of range: ", interval)
+		}
+	}
+	sweeper.Stop()
+	sweeper.Stop()
+}
@@ -0,0 +1,331 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationResult holds the outcome of validating a backend configuration
+// against the backend properties schema.
+type ValidationResult struct {
+	Valid bool `json:"valid"`
+	// Errors holds the validation errors as "path: message" strings.
+	Errors []string `json:"errors"`
+	// Details holds the same validation errors in structured form.
+	Details []*ValidationError `json:"details"`
+}
+
+// ValidationError is a validation error of a single configuration property.
+type ValidationError struct {
+	// Path is the JSON pointer to the property, for example "/collections/users/TTL".
+	Path string `json:"path"`
+	// Code is the failed rule: "required", "type", "format", or the name of the failed JSON Schema keyword.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Expected and Actual are set for mismatched values, for example "int" and "number" for a type error.
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+func newValidationResult() *ValidationResult {
+	return &ValidationResult{
+		Valid:   true,
+		Errors:  []string{},
+		Details: []*ValidationError{},
+	}
+}
+
+// addError records a validation error for the property on the given path.
+func (r *ValidationResult) addError(path validationPath, code, message string) {
+	r.addMismatch(path, code, message, "", "")
+}
+
+// addTypeError records a type mismatch for the property on the given path.
+func (r *ValidationResult) addTypeError(path validationPath, expected, actual string) {
+	r.addMismatch(path, "type", fmt.Sprintf("expected %s, got %s", expected, actual), expected, actual)
+}
+
+// addMismatch records a validation error with the expected and the actual value.
+func (r *ValidationResult) addMismatch(path validationPath, code, message, expected, actual string) {
+	r.Valid = false
+	r.Errors = append(r.Errors, fmt.Sprintf("%s: %s", path, message))
+	r.Details = append(r.Details, &ValidationError{
+		Path:     path.Pointer(),
+		Code:     code,
+		Message:  message,
+		Expected: expected,
+		Actual:   actual,
+	})
+}
+
+// validationPath is the path to a configuration property, with one element per object key or array index.
+type validationPath []string
+
+// with returns the path to the child property.
+func (p validationPath) with(key string) validationPath {
+	path := make(validationPath, len(p), len(p)+1)
+	copy(path, p)
+	return append(path, key)
+}
+
+// String returns the path in dot notation ("collections.users.TTL"), or "$" for the whole configuration.
+func (p validationPath) String() string {
+	if len(p) == 0 {
+		return "$"
+	}
+	return strings.Join(p, ".")
+}
+
+// Pointer returns the path as JSON pointer (RFC 6901), "" for the whole configuration.
+func (p validationPath) Pointer() string {
+	pointer := ""
+	for _, key := range p {
+		pointer += "/" + strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+	}
+	return pointer
+}
+
+// ValidateBackend validates the backend configuration against the schema of the
+// backend properties (as registered with BackendManager.SupportBackend).
+// The schema is a map of property => type, where the type can be one of:
+// "string", "bool", "int", "int or string", "string array", "object array" or a nested schema map.
+// The type can reference named validators, for example "string:hostport" (see RegisterValidator).
+// A nested schema with a single "string" key describes a map with arbitrary keys
+// (for example collection names) where every value is validated against the nested schema.
+// Properties that are not present in the configuration are not validated, unless they are listed
+// in SchemaRequired or required by a conditional ValidationRule (SchemaRules).
+// The schema can also be a JSON Schema (draft-07) document, recognized by the "$schema" keyword
+// or by a root "type": "object" with "properties". See ToJSONSchema to convert the schema for external tools.
+func ValidateBackend(backendConf map[string]interface{}, schema map[string]interface{}) *ValidationResult {
+	result := newValidationResult()
+	if isJSONSchema(schema) {
+		validateJSONSchema(backendConf, schema, result)
+		return result
+	}
+	validateObject(validationPath{}, backendConf, schema, result)
+	return result
+}
+
+// ValidateConfig validates the JSON database configuration against the schema of the configured backend.
+// The configuration can be the whole service configuration (with a "database" section) or
+// just the database section:
+// 		{
+// 			"dbName": "mongodb",
+// 			"dbInfo": {
+// 				"host": "mongo:27017",
+// 				"database": "users"
+// 			}
+// 		}
+// The properties of "dbInfo" are validated together with the properties of the database section.
+// The environment variable references (${VAR} and ${VAR:-default}) are expanded before the validation.
+// An error is returned only if the configuration cannot be parsed or a referenced variable is not set.
+func ValidateConfig(data []byte, manager BackendManager) (*ValidationResult, error) {
+	backendConf, err := parseBackendConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newValidationResult()
+
+	backendType, ok := backendConf["dbName"].(string)
+	if !ok || backendType == "" {
+		result.addError(validationPath{"dbName"}, "required", "backend type is required")
+		return result, nil
+	}
+
+	schema, err := manager.GetRequiredBackendProperties(backendType)
+	if err != nil {
+		result.addMismatch(validationPath{"dbName"}, "unsupported", fmt.Sprintf("backend %s is not supported", backendType), "", backendType)
+		return result, nil
+	}
+
+	return ValidateBackend(backendConf, schema), nil
+}
+
+// ValidateConfigWithSchema validates the JSON database configuration against the given schema instead of
+// the schema of the configured backend, for example a JSON Schema loaded with LoadJSONSchema. See ValidateConfig.
+func ValidateConfigWithSchema(data []byte, schema map[string]interface{}) (*ValidationResult, error) {
+	backendConf, err := parseBackendConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateBackend(backendConf, schema), nil
+}
+
+// parseBackendConfig parses the JSON database configuration and expands the environment variables (see ExpandEnv).
+// See flattenBackendConfig.
+func parseBackendConfig(data []byte) (map[string]interface{}, error) {
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, ErrInvalidInput(err)
+	}
+	conf, err := expandEnvConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return flattenBackendConfig(conf), nil
+}
+
+// flattenBackendConfig returns the database section of the configuration with the "dbInfo" properties merged into it.
+func flattenBackendConfig(conf map[string]interface{}) map[string]interface{} {
+	if database, ok := conf["database"].(map[string]interface{}); ok {
+		conf = database
+	}
+
+	backendConf := map[string]interface{}{}
+	for key, value := range conf {
+		if key == "dbInfo" {
+			continue
+		}
+		backendConf[key] = value
+	}
+	if dbInfo, ok := conf["dbInfo"].(map[string]interface{}); ok {
+		for key, value := range dbInfo {
+			backendConf[key] = value
+		}
+	}
+	return backendConf
+}
+
+// ValidateConfigFile reads the JSON database configuration from a file and validates it. See ValidateConfig.
+func ValidateConfigFile(path string, manager BackendManager) (*ValidationResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateConfig(data, manager)
+}
+
+func validateObject(path validationPath, object map[string]interface{}, schema map[string]interface{}, result *ValidationResult) {
+	if valueSchema, ok := schema["string"]; ok && len(schema) == 1 {
+		// map with arbitrary keys
+		for _, key := range sortedKeys(object) {
+			validateValue(path.with(key), object[key], valueSchema, result)
+		}
+		return
+	}
+
+	validateRequired(path, object, schema, result)
+
+	for _, key := range sortedKeys(object) {
+		propSchema, ok := schema[key]
+		if !ok || strings.HasPrefix(key, "$") {
+			continue
+		}
+		validateValue(path.with(key), object[key], propSchema, result)
+	}
+}
+
+func validateValue(path validationPath, value interface{}, schema interface{}, result *ValidationResult) {
+	if nested, ok := schema.(map[string]interface{}); ok {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			result.addTypeError(path, "object", typeName(value))
+			return
+		}
+		validateObject(path, object, nested, result)
+		return
+	}
+
+	propType, ok := schema.(string)
+	if !ok {
+		result.addError(path, "schema", "invalid schema definition")
+		return
+	}
+
+	propType, validatorNames := parseTypeSpec(propType)
+	if !isOfType(value, propType) {
+		result.addTypeError(path, propType, typeName(value))
+		return
+	}
+	applyValidators(path, value, validatorNames, result)
+}
+
+func isOfType(value interface{}, propType string) bool {
+	switch propType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "int":
+		switch v := value.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case "int or string":
+		return isOfType(value, "int") || isOfType(value, "string")
+	case "string array":
+		if _, ok := value.([]string); ok {
+			return true
+		}
+		return isArrayOf(value, func(item interface{}) bool {
+			_, ok := item.(string)
+			return ok
+		})
+	case "object array":
+		if _, ok := value.([]map[string]interface{}); ok {
+			return true
+		}
+		return isArrayOf(value, func(item interface{}) bool {
+			_, ok := item.(map[string]interface{})
+			return ok
+		})
+	}
+	return false
+}
+
+func isArrayOf(value interface{}, check func(item interface{}) bool) bool {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range arr {
+		if !check(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int32, int64, float32, float64:
+		return "number"
+	case []interface{}, []string, []map[string]interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return strings.Join([]string{path, key}, ".")
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
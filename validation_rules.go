@@ -0,0 +1,199 @@
+package backends
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	// SchemaRequired is the key of the required properties in the backend properties schema.
+	SchemaRequired = "$required"
+	// SchemaRules is the key of the conditional validation rules in the backend properties schema.
+	SchemaRules = "$rules"
+)
+
+// ValidationRule is a conditional requirement of the backend properties schema. The rule is active
+// when all properties in When have the given values. Active rules make the Require properties required
+// and the Optional properties optional, even if they are listed in SchemaRequired or required by another rule.
+// For example, the TTL properties of a collection:
+// 		"$rules": []*backends.ValidationRule{
+// 			{When: map[string]interface{}{"enableTTL": true}, Require: []string{"TTL", "ttlAttribute"}},
+// 			{When: map[string]interface{}{"ttlMode": "expireAt"}, Optional: []string{"TTL"}},
+// 		}
+// In JSON configuration, the rules are given as objects with "when", "require" and "optional" properties.
+type ValidationRule struct {
+	When     map[string]interface{}
+	Require  []string
+	Optional []string
+}
+
+// matches checks if the rule is active for the object.
+func (r *ValidationRule) matches(object map[string]interface{}) bool {
+	for key, expected := range r.When {
+		value, ok := object[key]
+		if !ok || !reflect.DeepEqual(normalizeJSONValue(value), normalizeJSONValue(expected)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ValidationRule) String() string {
+	conditions := []string{}
+	for _, key := range sortedKeys(r.When) {
+		conditions = append(conditions, fmt.Sprintf("%s is %v", key, r.When[key]))
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// schemaRules returns the conditional rules of the schema.
+func schemaRules(schema map[string]interface{}) []*ValidationRule {
+	switch rules := schema[SchemaRules].(type) {
+	case []*ValidationRule:
+		return rules
+	case []interface{}:
+		result := []*ValidationRule{}
+		for _, item := range rules {
+			if rule, ok := item.(*ValidationRule); ok {
+				result = append(result, rule)
+				continue
+			}
+			ruleMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rule := &ValidationRule{
+				Require:  toStringSlice(ruleMap["require"]),
+				Optional: toStringSlice(ruleMap["optional"]),
+			}
+			rule.When, _ = ruleMap["when"].(map[string]interface{})
+			result = append(result, rule)
+		}
+		return result
+	}
+	return nil
+}
+
+// validateRequired checks the required properties of the object, including the requirements of the active rules.
+func validateRequired(path validationPath, object map[string]interface{}, schema map[string]interface{}, result *ValidationResult) {
+	required := map[string]string{}
+	for _, name := range toStringSlice(schema[SchemaRequired]) {
+		required[name] = "is required"
+	}
+
+	rules := schemaRules(schema)
+	for _, rule := range rules {
+		if !rule.matches(object) {
+			continue
+		}
+		for _, name := range rule.Require {
+			if _, ok := required[name]; !ok {
+				required[name] = fmt.Sprintf("is required when %s", rule)
+			}
+		}
+	}
+	for _, rule := range rules {
+		if !rule.matches(object) {
+			continue
+		}
+		for _, name := range rule.Optional {
+			delete(required, name)
+		}
+	}
+
+	for _, name := range sortedStringKeys(required) {
+		if _, ok := object[name]; !ok {
+			result.addError(path.with(name), "required", required[name])
+		}
+	}
+}
+
+// jsonSchemaRequirements converts the required properties and the rules of the schema to JSON Schema.
+// Unconditionally required properties are returned as "required", the conditional requirements as
+// "if"/"then" schemas to be added to "allOf".
+func jsonSchemaRequirements(schema map[string]interface{}) ([]interface{}, []interface{}) {
+	required := []interface{}{}
+	conditional := []interface{}{}
+
+	base := map[string]bool{}
+	for _, name := range toStringSlice(schema[SchemaRequired]) {
+		base[name] = true
+	}
+	rules := schemaRules(schema)
+
+	requiredWhen := map[string][]interface{}{}
+	optionalWhen := map[string][]interface{}{}
+	properties := map[string]interface{}{}
+	for name := range base {
+		properties[name] = nil
+	}
+	for _, rule := range rules {
+		for _, name := range rule.Require {
+			requiredWhen[name] = append(requiredWhen[name], rule.jsonSchemaCondition())
+			properties[name] = nil
+		}
+		for _, name := range rule.Optional {
+			optionalWhen[name] = append(optionalWhen[name], rule.jsonSchemaCondition())
+		}
+	}
+
+	for _, name := range sortedKeys(properties) {
+		if base[name] && len(optionalWhen[name]) == 0 {
+			required = append(required, name)
+			continue
+		}
+		conditions := []interface{}{}
+		if !base[name] {
+			conditions = append(conditions, map[string]interface{}{"anyOf": requiredWhen[name]})
+		}
+		if len(optionalWhen[name]) > 0 {
+			conditions = append(conditions, map[string]interface{}{
+				"not": map[string]interface{}{"anyOf": optionalWhen[name]},
+			})
+		}
+		conditional = append(conditional, map[string]interface{}{
+			"if":   map[string]interface{}{"allOf": conditions},
+			"then": map[string]interface{}{"required": []interface{}{name}},
+		})
+	}
+	return required, conditional
+}
+
+// jsonSchemaCondition returns the JSON Schema that matches the objects for which the rule is active.
+func (r *ValidationRule) jsonSchemaCondition() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	for _, key := range sortedKeys(r.When) {
+		properties[key] = map[string]interface{}{"const": r.When[key]}
+		required = append(required, key)
+	}
+	return map[string]interface{}{
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return []string{}
+}
+
+func sortedStringKeys(object map[string]string) []string {
+	keys := map[string]interface{}{}
+	for key := range object {
+		keys[key] = nil
+	}
+	return sortedKeys(keys)
+}
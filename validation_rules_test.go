@@ -0,0 +1,83 @@
+package backends
+
+import (
+	"testing"
+)
+
+var memoryBackendSchema = map[string]interface{}{
+	"type":        "string",
+	"credentials": "string",
+	"collections": map[string]interface{}{
+		"string": map[string]interface{}{
+			"enableTTL":    "bool",
+			"TTL":          "int",
+			"ttlAttribute": "string",
+			"ttlMode":      "string",
+			SchemaRules:    collectionRules,
+		},
+	},
+	SchemaRequired: []string{"type", "credentials"},
+	SchemaRules: []interface{}{
+		map[string]interface{}{
+			"when":     map[string]interface{}{"type": "memory"},
+			"optional": []interface{}{"credentials"},
+		},
+	},
+}
+
+func TestValidateRequired(t *testing.T) {
+	result := ValidateBackend(parseConfig(t, `{"type": "dynamodb"}`), memoryBackendSchema)
+	if len(result.Errors) != 1 || result.Errors[0] != "credentials: is required" {
+		t.Fatal("Expected credentials to be required, got: ", result.Errors)
+	}
+
+	result = ValidateBackend(parseConfig(t, `{"type": "memory"}`), memoryBackendSchema)
+	if !result.Valid {
+		t.Fatal("Expected credentials to be optional for the memory backend, got: ", result.Errors)
+	}
+}
+
+func TestValidateConditionalRules(t *testing.T) {
+	result := ValidateBackend(parseConfig(t, `{
+		"type": "memory",
+		"collections": {
+			"events": {"enableTTL": true, "ttlMode": "expireAt", "ttlAttribute": "expires"},
+			"sessions": {"enableTTL": true},
+			"users": {"enableTTL": false}
+		}
+	}`), memoryBackendSchema)
+
+	expected := []string{
+		"collections.sessions.TTL: is required when enableTTL is true",
+		"collections.sessions.ttlAttribute: is required when enableTTL is true",
+	}
+	if len(result.Errors) != len(expected) {
+		t.Fatal("Expected 2 errors, got: ", result.Errors)
+	}
+	for i, message := range expected {
+		if result.Errors[i] != message {
+			t.Errorf("Expected %q, got %q", message, result.Errors[i])
+		}
+	}
+	if result.Details[0].Code != "required" || result.Details[0].Path != "/collections/sessions/TTL" {
+		t.Errorf("Unexpected detail: %+v", result.Details[0])
+	}
+}
+
+func TestConditionalRulesJSONSchema(t *testing.T) {
+	schema := ToJSONSchema(memoryBackendSchema)
+
+	configs := []string{
+		`{"type": "dynamodb"}`,
+		`{"type": "memory"}`,
+		`{"type": "memory", "collections": {"sessions": {"enableTTL": true}}}`,
+		`{"type": "memory", "collections": {"events": {"enableTTL": true, "ttlMode": "expireAt", "ttlAttribute": "expires"}}}`,
+	}
+	for _, conf := range configs {
+		expected := ValidateBackend(parseConfig(t, conf), memoryBackendSchema)
+		result := ValidateBackend(parseConfig(t, conf), schema)
+		if result.Valid != expected.Valid {
+			t.Errorf("Expected valid=%v for %s, got errors: %v", expected.Valid, conf, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package backends
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var backendSchema = map[string]interface{}{
+	"dbName":   "string",
+	"host":     "string",
+	"database": "string",
+	"collections": map[string]interface{}{
+		"string": map[string]interface{}{
+			"indexes":   "string array",
+			"enableTTL": "bool",
+			"TTL":       "int",
+			"bootstrap": map[string]interface{}{
+				"key":        "string array",
+				"onConflict": "string",
+				"documents":  "object array",
+			},
+		},
+	},
+}
+
+func parseConfig(t *testing.T, conf string) map[string]interface{} {
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(conf), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestValidateBackendValid(t *testing.T) {
+	conf := parseConfig(t, `{
+		"dbName": "mongodb",
+		"host": "localhost:27017",
+		"database": "users",
+		"collections": {
+			"roles": {
+				"indexes": ["name"],
+				"enableTTL": false,
+				"TTL": 0,
+				"bootstrap": {
+					"key": ["name"],
+					"onConflict": "skip",
+					"documents": [{"name": "admin"}, {"name": "user"}]
+				}
+			}
+		}
+	}`)
+
+	result := ValidateBackend(conf, backendSchema)
+	if !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+}
+
+func TestValidateBackendInvalid(t *testing.T) {
+	conf := parseConfig(t, `{
+		"host": 27017,
+		"collections": {
+			"roles": {
+				"TTL": 1.5,
+				"bootstrap": {
+					"documents": ["admin"]
+				}
+			}
+		}
+	}`)
+
+	result := ValidateBackend(conf, backendSchema)
+	if result.Valid {
+		t.Fatal("Expected the config to be invalid")
+	}
+	if len(result.Errors) != 3 {
+		t.Fatal("Expected 3 errors, got: ", result.Errors)
+	}
+	if result.Errors[0] != "collections.roles.TTL: expected int, got number" {
+		t.Fatal("Unexpected error message: ", result.Errors[0])
+	}
+}
+
+func TestValidateBackendIntOrString(t *testing.T) {
+	schema := map[string]interface{}{"w": "int or string"}
+	for _, conf := range []string{`{"w": 1}`, `{"w": "majority"}`} {
+		if result := ValidateBackend(parseConfig(t, conf), schema); !result.Valid {
+			t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+		}
+	}
+	if result := ValidateBackend(parseConfig(t, `{"w": true}`), schema); result.Valid {
+		t.Fatal("Expected a bool to be invalid")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	manager := NewBackendSupport(nil)
+
+	result, err := ValidateConfig([]byte(`{
+		"database": {
+			"dbName": "mongodb",
+			"dbInfo": {
+				"host": "mongo:27017",
+				"database": "users",
+				"user": "restapi",
+				"pass": 1234
+			}
+		}
+	}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || len(result.Errors) != 1 || result.Errors[0] != "pass: expected string, got number" {
+		t.Fatal("Expected exactly one error for pass. Got: ", result.Errors)
+	}
+
+	result, err = ValidateConfig([]byte(`{"dbName": "unknown"}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid {
+		t.Fatal("Expected unsupported backend to be invalid")
+	}
+
+	if _, err = ValidateConfig([]byte(`{not json`), manager); err == nil {
+		t.Fatal("Expected parse error")
+	}
+}
+
+func TestValidationResultDetails(t *testing.T) {
+	conf := parseConfig(t, `{
+		"host": 27017,
+		"collections": {
+			"roles/v1": {
+				"TTL": 1.5
+			}
+		}
+	}`)
+
+	result := ValidateBackend(conf, backendSchema)
+	if len(result.Details) != len(result.Errors) {
+		t.Fatalf("Expected a detail for every error, got %d details for %d errors", len(result.Details), len(result.Errors))
+	}
+
+	detail := result.Details[0]
+	if detail.Path != "/collections/roles~1v1/TTL" {
+		t.Errorf("Expected JSON pointer /collections/roles~1v1/TTL, got %s", detail.Path)
+	}
+	if detail.Code != "type" || detail.Expected != "int" || detail.Actual != "number" {
+		t.Errorf("Unexpected detail: %+v", detail)
+	}
+	if result.Details[1].Path != "/host" {
+		t.Errorf("Expected /host, got %s", result.Details[1].Path)
+	}
+}
+
+func TestValidationResultDetailsJSONSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"dbName"},
+		"properties": map[string]interface{}{
+			"host": map[string]interface{}{"type": "string", "format": "hostname"},
+		},
+	}
+
+	result := ValidateBackend(parseConfig(t, `{"host": "not a host"}`), schema)
+	codes := map[string]*ValidationError{}
+	for _, detail := range result.Details {
+		codes[detail.Code] = detail
+	}
+
+	if required, ok := codes["required"]; !ok || required.Path != "/dbName" {
+		t.Errorf("Expected required error on /dbName, got %v", result.Errors)
+	}
+	if format, ok := codes["format"]; !ok || format.Path != "/host" || format.Expected != "hostname" || format.Actual != "not a host" {
+		t.Errorf("Expected format error on /host, got %v", result.Errors)
+	}
+}
+
+func TestValidateConfigDetails(t *testing.T) {
+	manager := NewBackendSupport(nil)
+
+	result, err := ValidateConfig([]byte(`{"dbName": "unknown"}`), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Details) != 1 || result.Details[0].Code != "unsupported" || result.Details[0].Actual != "unknown" {
+		t.Fatal("Expected unsupported backend detail, got: ", result.Details)
+	}
+}
@@ -0,0 +1,132 @@
+package backends
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValueValidator validates a configuration value. It returns an error describing the problem
+// if the value is not valid.
+type ValueValidator func(value interface{}) error
+
+var validators = struct {
+	sync.RWMutex
+	byName map[string]ValueValidator
+}{
+	byName: map[string]ValueValidator{
+		"hostport": validateHostPort,
+		"duration": validateDuration,
+		"regex":    validateRegex,
+	},
+}
+
+// RegisterValidator registers a named validator that can be referenced from the backend properties
+// schema. In the property map, validators are appended to the type, separated by colons:
+// 		"host":  "string:hostport",
+// 		"names": "string array:regex",
+// The validators of an array type are applied to every item. In a JSON Schema document, the named
+// validators are referenced as "format". Registering a validator with an existing name replaces it.
+// The built-in validators are "hostport", "duration" and "regex".
+func RegisterValidator(name string, validator ValueValidator) {
+	validators.Lock()
+	defer validators.Unlock()
+	validators.byName[name] = validator
+}
+
+func getValidator(name string) (ValueValidator, bool) {
+	validators.RLock()
+	defer validators.RUnlock()
+	validator, ok := validators.byName[name]
+	return validator, ok
+}
+
+// parseTypeSpec splits the property type into the base type and the names of the validators.
+func parseTypeSpec(spec string) (string, []string) {
+	parts := strings.Split(spec, ":")
+	return parts[0], parts[1:]
+}
+
+// applyValidators validates the value with the named validators.
+func applyValidators(path validationPath, value interface{}, names []string, result *ValidationResult) {
+	if len(names) == 0 {
+		return
+	}
+	if items, ok := value.([]interface{}); ok {
+		for i, item := range items {
+			applyValidators(path.with(strconv.Itoa(i)), item, names, result)
+		}
+		return
+	}
+	if items, ok := value.([]string); ok {
+		for i, item := range items {
+			applyValidators(path.with(strconv.Itoa(i)), item, names, result)
+		}
+		return
+	}
+	for _, name := range names {
+		validator, ok := getValidator(name)
+		if !ok {
+			result.addError(path, "schema", fmt.Sprintf("unknown validator %s", name))
+			continue
+		}
+		if err := validator(value); err != nil {
+			result.addMismatch(path, "format", err.Error(), name, fmt.Sprintf("%v", value))
+		}
+	}
+}
+
+// validateHostPort validates a "host:port" address, or a comma separated list of addresses
+// (MongoDB seed list). The port is optional and must be a number between 1 and 65535.
+func validateHostPort(value interface{}) error {
+	addresses, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected host:port, got %s", typeName(value))
+	}
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		host, port := address, ""
+		if strings.Contains(address, ":") {
+			var err error
+			if host, port, err = net.SplitHostPort(address); err != nil {
+				return fmt.Errorf("invalid address %s", address)
+			}
+			number, err := strconv.Atoi(port)
+			if err != nil || number < 1 || number > 65535 {
+				return fmt.Errorf("invalid port %s in %s", port, address)
+			}
+		}
+		if net.ParseIP(host) == nil && !hostnamePattern.MatchString(host) {
+			return fmt.Errorf("invalid host %s in %s", host, address)
+		}
+	}
+	return nil
+}
+
+// validateDuration validates a duration string, such as "30s" or "1h30m".
+func validateDuration(value interface{}) error {
+	duration, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected duration, got %s", typeName(value))
+	}
+	if _, err := time.ParseDuration(duration); err != nil {
+		return fmt.Errorf("invalid duration %s", duration)
+	}
+	return nil
+}
+
+// validateRegex validates a regular expression.
+func validateRegex(value interface{}) error {
+	pattern, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected regular expression, got %s", typeName(value))
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid regular expression: %s", err)
+	}
+	return nil
+}
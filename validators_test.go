@@ -0,0 +1,114 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-tools/config"
+)
+
+func TestBuiltInValidators(t *testing.T) {
+	cases := []struct {
+		validator ValueValidator
+		value     interface{}
+		valid     bool
+	}{
+		{validateHostPort, "mongo:27017", true},
+		{validateHostPort, "localhost", true},
+		{validateHostPort, "10.0.0.1:27017, 10.0.0.2:27017", true},
+		{validateHostPort, "[::1]:27017", true},
+		{validateHostPort, "192.168.1.90:89-9", false},
+		{validateHostPort, "mongo:70000", false},
+		{validateHostPort, "mongo_db:27017", false},
+		{validateHostPort, 27017, false},
+		{validateDuration, "1h30m", true},
+		{validateDuration, "5 minutes", false},
+		{validateRegex, "^[a-z]+$", true},
+		{validateRegex, "([a-z]", false},
+	}
+
+	for _, c := range cases {
+		err := c.validator(c.value)
+		if c.valid && err != nil {
+			t.Errorf("Expected %v to be valid, got %s", c.value, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected %v to be invalid", c.value)
+		}
+	}
+}
+
+func TestValidateBackendWithValidators(t *testing.T) {
+	schema := map[string]interface{}{
+		"host":     "string:hostport",
+		"interval": "string:duration",
+		"patterns": "string array:regex",
+	}
+
+	result := ValidateBackend(parseConfig(t, `{"host": "mongo:27017", "interval": "5m", "patterns": ["^a", "b$"]}`), schema)
+	if !result.Valid {
+		t.Fatal("Expected the config to be valid. Got errors: ", result.Errors)
+	}
+
+	result = ValidateBackend(parseConfig(t, `{"host": "192.168.1.90:89-9", "interval": "5", "patterns": ["^a", "("]}`), schema)
+	if len(result.Details) != 3 {
+		t.Fatal("Expected 3 errors, got: ", result.Errors)
+	}
+	paths := []string{}
+	for _, detail := range result.Details {
+		if detail.Code != "format" {
+			t.Errorf("Expected format error, got %s", detail.Code)
+		}
+		paths = append(paths, detail.Path)
+	}
+	if strings.Join(paths, ",") != "/host,/interval,/patterns/1" {
+		t.Errorf("Unexpected error paths: %v", paths)
+	}
+	if result.Details[0].Expected != "hostport" || result.Details[0].Actual != "192.168.1.90:89-9" {
+		t.Errorf("Unexpected detail: %+v", result.Details[0])
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	RegisterValidator("region", func(value interface{}) error {
+		if s, ok := value.(string); !ok || !strings.HasPrefix(s, "eu-") {
+			return fmt.Errorf("only EU regions are allowed")
+		}
+		return nil
+	})
+
+	result := ValidateBackend(parseConfig(t, `{"awsRegion": "us-east-1"}`), map[string]interface{}{
+		"awsRegion": "string:region",
+	})
+	if result.Valid || result.Errors[0] != "awsRegion: only EU regions are allowed" {
+		t.Fatal("Expected region error, got: ", result.Errors)
+	}
+
+	// JSON Schema references the validators as format
+	schema := ToJSONSchema(map[string]interface{}{"awsRegion": "string:region"})
+	result = ValidateBackend(parseConfig(t, `{"awsRegion": "us-east-1"}`), schema)
+	if result.Valid {
+		t.Fatal("Expected region error with JSON Schema")
+	}
+
+	result = ValidateBackend(parseConfig(t, `{"awsRegion": "us-east-1"}`), map[string]interface{}{
+		"awsRegion": "string:unknown",
+	})
+	if result.Valid || result.Details[0].Code != "schema" {
+		t.Fatal("Expected unknown validator error, got: ", result.Errors)
+	}
+}
+
+func TestValidateConfigHost(t *testing.T) {
+	result, err := ValidateConfig([]byte(`{
+		"dbName": "mongodb",
+		"dbInfo": {"host": "192.168.1.90:89-9"}
+	}`), NewBackendSupport(map[string]*config.DBInfo{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid {
+		t.Fatal("Expected the invalid host to be reported")
+	}
+}
@@ -0,0 +1,242 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DBCredentials holds database credentials issued by a CredentialsProvider.
+type DBCredentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsProvider provides short-lived database credentials. When the credentials
+// are rotated, the provider calls the registered OnRotate callbacks so the backends can
+// re-establish their sessions.
+// A provider is set with the "credentialsProvider" backend option and takes precedence over
+// the user and pass in the DB config.
+type CredentialsProvider interface {
+	GetCredentials() (*DBCredentials, error)
+	OnRotate(callback func(credentials *DBCredentials))
+	Close()
+}
+
+// VaultConfig holds the configuration for the Vault credentials provider.
+type VaultConfig struct {
+	// Address of the Vault server. Defaults to the VAULT_ADDR environment variable.
+	Address string
+	// Token used to authenticate with Vault. Defaults to the VAULT_TOKEN environment variable.
+	Token string
+	// Mount is the path where the database secrets engine is mounted. Defaults to "database".
+	Mount string
+	// Role is the name of the database role to generate credentials for.
+	Role string
+	// HTTPClient is the client used to call Vault. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+type vaultSecret struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"data"`
+}
+
+// VaultCredentialsProvider fetches dynamic database credentials from the HashiCorp Vault
+// database secrets engine, renews the lease in background and fetches new credentials
+// once the lease can no longer be renewed.
+type VaultCredentialsProvider struct {
+	config      VaultConfig
+	credentials *DBCredentials
+	lease       *vaultSecret
+	callbacks   []func(credentials *DBCredentials)
+	mutex       *sync.Mutex
+	stop        chan struct{}
+	once        *sync.Once
+}
+
+// NewVaultCredentialsProvider creates new VaultCredentialsProvider, fetches the initial credentials
+// and starts renewing the lease in background.
+func NewVaultCredentialsProvider(config VaultConfig) (*VaultCredentialsProvider, error) {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.Mount == "" {
+		config.Mount = "database"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Address == "" || config.Role == "" {
+		return nil, ErrInvalidInput("vault address and role are required")
+	}
+
+	provider := &VaultCredentialsProvider{
+		config:    config,
+		callbacks: []func(credentials *DBCredentials){},
+		mutex:     &sync.Mutex{},
+		stop:      make(chan struct{}),
+		once:      &sync.Once{},
+	}
+
+	if err := provider.fetch(); err != nil {
+		return nil, err
+	}
+
+	go provider.renewLoop()
+
+	return provider, nil
+}
+
+// GetCredentials returns the current credentials.
+func (p *VaultCredentialsProvider) GetCredentials() (*DBCredentials, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.credentials, nil
+}
+
+// OnRotate registers a callback called with the new credentials when they are rotated.
+func (p *VaultCredentialsProvider) OnRotate(callback func(credentials *DBCredentials)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.callbacks = append(p.callbacks, callback)
+}
+
+// Close stops renewing the lease.
+func (p *VaultCredentialsProvider) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
+
+func (p *VaultCredentialsProvider) renewLoop() {
+	for {
+		p.mutex.Lock()
+		wait := time.Duration(p.lease.LeaseDuration) * time.Second * 2 / 3
+		p.mutex.Unlock()
+		if wait <= 0 {
+			wait = time.Minute
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(wait):
+		}
+
+		if err := p.renew(); err == nil {
+			continue
+		}
+
+		// the lease cannot be renewed (max TTL reached or revoked) - rotate
+		if err := p.fetch(); err != nil {
+			log.Println("ERROR: failed to fetch database credentials from Vault: ", err.Error())
+			continue
+		}
+
+		p.mutex.Lock()
+		credentials := p.credentials
+		callbacks := append([]func(credentials *DBCredentials){}, p.callbacks...)
+		p.mutex.Unlock()
+
+		for _, callback := range callbacks {
+			callback(credentials)
+		}
+	}
+}
+
+func (p *VaultCredentialsProvider) fetch() error {
+	secret := &vaultSecret{}
+	path := fmt.Sprintf("/v1/%s/creds/%s", strings.Trim(p.config.Mount, "/"), p.config.Role)
+	if err := p.call(http.MethodGet, path, nil, secret); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.lease = secret
+	p.credentials = &DBCredentials{
+		Username: secret.Data.Username,
+		Password: secret.Data.Password,
+	}
+	return nil
+}
+
+func (p *VaultCredentialsProvider) renew() error {
+	p.mutex.Lock()
+	lease := p.lease
+	p.mutex.Unlock()
+
+	if !lease.Renewable {
+		return ErrBackendError("lease is not renewable")
+	}
+
+	renewed := &vaultSecret{}
+	err := p.call(http.MethodPut, "/v1/sys/leases/renew", map[string]interface{}{
+		"lease_id":  lease.LeaseID,
+		"increment": lease.LeaseDuration,
+	}, renewed)
+	if err != nil {
+		return err
+	}
+	if renewed.LeaseDuration < lease.LeaseDuration {
+		// Vault caps the renewal at the max TTL - rotate before the credentials expire
+		return ErrBackendError("lease is reaching its max TTL")
+	}
+
+	p.mutex.Lock()
+	p.lease.LeaseDuration = renewed.LeaseDuration
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *VaultCredentialsProvider) call(method, path string, body interface{}, result interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(p.config.Address, "/")+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ErrBackendError(fmt.Sprintf("vault returned status %d for %s", resp.StatusCode, path))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// GetCredentialsProvider returns the CredentialsProvider set with the "credentialsProvider" option, or nil.
+func (o BackendOptions) GetCredentialsProvider() CredentialsProvider {
+	if provider, ok := o["credentialsProvider"].(CredentialsProvider); ok {
+		return provider
+	}
+	return nil
+}
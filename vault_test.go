@@ -0,0 +1,49 @@
+package backends
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultCredentialsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/database/creds/readwrite" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+			"lease_id": "database/creds/readwrite/1234",
+			"lease_duration": 3600,
+			"renewable": true,
+			"data": {"username": "v-token-readwrite", "password": "secret"}
+		}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewVaultCredentialsProvider(VaultConfig{
+		Address: server.URL,
+		Token:   "test-token",
+		Role:    "readwrite",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+
+	credentials, err := provider.GetCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.Username != "v-token-readwrite" || credentials.Password != "secret" {
+		t.Fatal("Unexpected credentials: ", credentials)
+	}
+
+	if _, err = NewVaultCredentialsProvider(VaultConfig{Address: server.URL, Token: "wrong", Role: "readwrite"}); err == nil {
+		t.Fatal("Expected an error for invalid token")
+	}
+}
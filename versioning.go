@@ -0,0 +1,213 @@
+package backends
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HistorySuffix is appended to the collection name to get the name of the history collection.
+const HistorySuffix = "_history"
+
+// maxVersionConflicts is how many times a version is numbered again when another instance saved the same
+// version of the record first.
+const maxVersionConflicts = 10
+
+// RecordVersion is a previous version of a record, kept in the history collection.
+type RecordVersion struct {
+	RecordID string                 `json:"recordId" bson:"recordId"`
+	Version  int                    `json:"version" bson:"version"`
+	Time     time.Time              `json:"time" bson:"time"`
+	Deleted  bool                   `json:"deleted" bson:"deleted"`
+	Document map[string]interface{} `json:"document" bson:"document"`
+}
+
+// VersionedRepository wraps a Repository and keeps the previous versions of the records in a history repository.
+// Before every update or delete, the current version of the record (identified by the "id" property) is copied
+// into the history.
+type VersionedRepository struct {
+	Repository
+	history Repository
+}
+
+// NewVersionedRepository wraps the repository and keeps the history in the history repository.
+// The history repository must have a unique index on (recordId, version), so two instances of the service
+// cannot save the same version of a record.
+func NewVersionedRepository(repo Repository, history Repository) *VersionedRepository {
+	return &VersionedRepository{
+		Repository: repo,
+		history:    history,
+	}
+}
+
+// DefineVersionedRepository defines the repository and its history repository (named <collection>_history)
+// on the backend, and returns the versioned repository.
+func DefineVersionedRepository(backend Backend, name string, def RepositoryDefinition) (*VersionedRepository, error) {
+	repo, err := backend.DefineRepository(name, def)
+	if err != nil {
+		return nil, err
+	}
+
+	historyDef := RepositoryDefinitionMap{
+		"name":          def.GetName() + HistorySuffix,
+		"indexes":       []Index{NewNonUniqueIndex("recordId"), NewIndexSpec("recordId", "version").AsUnique()},
+		"hashKey":       "id",
+		"hashKeyType":   "S",
+		"readCapacity":  def.GetReadCapacity(),
+		"writeCapacity": def.GetWriteCapacity(),
+	}
+	if database := def.GetDatabase(); database != "" {
+		historyDef["database"] = database
+	}
+
+	history, err := backend.DefineRepository(name+HistorySuffix, historyDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVersionedRepository(repo, history), nil
+}
+
+// Save saves the object. If an existing record is updated, its previous version is kept in the history.
+func (r *VersionedRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	if filter != nil {
+		if err := r.archive(filter, false); err != nil && !IsErrNotFound(err) {
+			return nil, err
+		}
+	}
+	return r.Repository.Save(object, filter)
+}
+
+// DeleteOne deletes the record and keeps its last version in the history.
+func (r *VersionedRepository) DeleteOne(filter Filter) error {
+	if err := r.archive(filter, true); err != nil {
+		return err
+	}
+	return r.Repository.DeleteOne(filter)
+}
+
+// DeleteAll deletes the matched records and keeps their last versions in the history.
+func (r *VersionedRepository) DeleteAll(filter Filter) error {
+	records, err := r.Repository.GetAll(copyFilter(filter), map[string]interface{}{}, "", "", 0, 0)
+	if err != nil && !IsErrNotFound(err) {
+		return err
+	}
+
+	err = IterateOverSlice(records, func(i int, item interface{}) error {
+		document, err := toAuditMap(item)
+		if err != nil {
+			return err
+		}
+		return r.addVersion(document, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Repository.DeleteAll(filter)
+}
+
+// GetVersions returns the previous versions of the record, oldest first.
+func (r *VersionedRepository) GetVersions(id string) ([]*RecordVersion, error) {
+	results, err := r.history.GetAll(Filter{"recordId": id}, map[string]interface{}{}, "version", "asc", 0, 0)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return []*RecordVersion{}, nil
+		}
+		return nil, err
+	}
+
+	versions := []*RecordVersion{}
+	err = IterateOverSlice(results, func(i int, item interface{}) error {
+		version := &RecordVersion{}
+		if err := MapToInterface(item, version); err != nil {
+			return err
+		}
+		versions = append(versions, version)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// RestoreVersion replaces the record with the given previous version. The current version of the record is kept
+// in the history, so the restore can be undone as well. Deleted records are re-created.
+func (r *VersionedRepository) RestoreVersion(id string, version int) (interface{}, error) {
+	versions, err := r.GetVersions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var restore *RecordVersion
+	for _, v := range versions {
+		if v.Version == version {
+			restore = v
+			break
+		}
+	}
+	if restore == nil {
+		return nil, ErrNotFound(fmt.Sprintf("version %d of record %s", version, id))
+	}
+
+	document := map[string]interface{}{}
+	for k, v := range restore.Document {
+		document[k] = v
+	}
+
+	result, err := r.Save(&document, Filter{"id": id})
+	if err != nil && IsErrNotFound(err) {
+		// the record has been deleted
+		return r.Repository.Save(&document, nil)
+	}
+	return result, err
+}
+
+func (r *VersionedRepository) archive(filter Filter, deleted bool) error {
+	current := map[string]interface{}{}
+	result, err := r.Repository.GetOne(copyFilter(filter), &current)
+	if err != nil {
+		return err
+	}
+	document, err := toAuditMap(result)
+	if err != nil {
+		return err
+	}
+	return r.addVersion(document, deleted)
+}
+
+// addVersion saves the document as the next version of the record. If another instance saved the same
+// version first, the unique index on (recordId, version) rejects it and the next version is taken again.
+func (r *VersionedRepository) addVersion(document map[string]interface{}, deleted bool) error {
+	id, ok := document["id"].(string)
+	if !ok || id == "" {
+		return ErrInvalidInput("versioned records must have a string id")
+	}
+
+	for attempt := 0; ; attempt++ {
+		versions, err := r.GetVersions(id)
+		if err != nil {
+			return err
+		}
+		next := 1
+		if len(versions) > 0 {
+			next = versions[len(versions)-1].Version + 1
+		}
+
+		_, err = r.history.Save(&RecordVersion{
+			RecordID: id,
+			Version:  next,
+			Time:     time.Now().UTC(),
+			Deleted:  deleted,
+			Document: document,
+		}, nil)
+		if err == nil || !IsErrAlreadyExists(err) || attempt >= maxVersionConflicts {
+			return err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package backends
+
+import "testing"
+
+func TestVersionedRepository(t *testing.T) {
+	users := &memoryRepo{}
+	history := &memoryRepo{}
+	repo := NewVersionedRepository(users, history)
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "name": "John"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "Johnny"}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"name": "Jack"}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := repo.GetVersions("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatal("Expected 2 previous versions. Got: ", len(versions))
+	}
+	if versions[0].Version != 1 || versions[0].Document["name"] != "John" {
+		t.Fatal("Unexpected first version: ", versions[0])
+	}
+	if versions[1].Version != 2 || versions[1].Document["name"] != "Johnny" {
+		t.Fatal("Unexpected second version: ", versions[1])
+	}
+
+	if _, err = repo.RestoreVersion("1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if users.records[0]["name"] != "John" {
+		t.Fatal("Expected the first version to be restored. Got: ", users.records[0])
+	}
+
+	if _, err = repo.RestoreVersion("1", 10); !IsErrNotFound(err) {
+		t.Fatal("Expected ErrNotFound for unknown version. Got: ", err)
+	}
+
+	// restore a deleted record
+	if err = repo.DeleteOne(Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ = repo.GetVersions("1")
+	last := versions[len(versions)-1]
+	if !last.Deleted || last.Document["name"] != "John" {
+		t.Fatal("Expected the deleted version in the history. Got: ", last)
+	}
+	if _, err = repo.RestoreVersion("1", last.Version); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.records) != 1 || users.records[0]["name"] != "John" {
+		t.Fatal("Expected the deleted record to be restored. Got: ", users.records)
+	}
+}
+
+// racingHistory is a history repository where another instance saves the same version first.
+type racingHistory struct {
+	*memoryRepo
+	conflicts int
+}
+
+func (r *racingHistory) Save(object interface{}, filter Filter) (interface{}, error) {
+	version := object.(*RecordVersion)
+	for _, record := range r.records {
+		if record["recordId"] == version.RecordID && record["version"] == version.Version {
+			return nil, ErrAlreadyExists("duplicate version")
+		}
+	}
+	if r.conflicts > 0 {
+		r.conflicts--
+		r.records = append(r.records, map[string]interface{}{"recordId": version.RecordID, "version": version.Version})
+		return nil, ErrAlreadyExists("duplicate version")
+	}
+	return r.memoryRepo.Save(object, filter)
+}
+
+func TestVersionedRepositoryConflict(t *testing.T) {
+	users := &memoryRepo{records: []map[string]interface{}{{"id": "1", "name": "John"}}}
+	history := &racingHistory{memoryRepo: &memoryRepo{}, conflicts: 2}
+	repo := NewVersionedRepository(users, history)
+
+	if _, err := repo.Save(&map[string]interface{}{"name": "Johnny"}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := repo.GetVersions("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[2].Version != 3 || versions[2].Document["name"] != "John" {
+		t.Fatal("Expected the version to be numbered after the concurrent versions. Got: ", versions)
+	}
+
+	history.conflicts = maxVersionConflicts + 1
+	if _, err := repo.Save(&map[string]interface{}{"name": "Jack"}, Filter{"id": "1"}); !IsErrAlreadyExists(err) {
+		t.Fatal("Expected ErrAlreadyExists after too many conflicts. Got: ", err)
+	}
+}
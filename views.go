@@ -0,0 +1,290 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ViewSource is a source repository of a materialized view.
+type ViewSource struct {
+	// Name identifies the source in Apply and Wrap.
+	Name string
+	// Repository is the source repository.
+	Repository Repository
+	// Project returns the records of the view derived from the source record. The records are saved by
+	// their "id": a record with the id of an existing record updates its properties, so several sources
+	// can fill the parts of the same record, and a join can read the related records from other
+	// repositories. Return no records to exclude the source record from the view.
+	Project func(record map[string]interface{}) ([]map[string]interface{}, error)
+	// Remove, if set, returns the filter of the view records to delete when the source record with the
+	// key is deleted or excluded. By default the view record with the id of the source record is deleted.
+	Remove func(key map[string]interface{}) (Filter, error)
+}
+
+// MaterializedView is a repository of records derived from the records of the source repositories, such
+// as the read models of the dashboards. The view is kept up to date from the changes of the sources (see
+// Run, Apply and Wrap), and can be rebuilt from all source records with Rebuild:
+//
+//	view := backends.NewMaterializedView("orderSummaries", summariesRepo, &backends.ViewSource{
+//		Name:       "orders",
+//		Repository: ordersRepo,
+//		Project: func(order map[string]interface{}) ([]map[string]interface{}, error) {
+//			customer := map[string]interface{}{}
+//			if _, err := customersRepo.GetOne(backends.Filter{"id": order["customerId"]}, &customer); err != nil {
+//				return nil, err
+//			}
+//			return []map[string]interface{}{{"id": order["id"], "total": order["total"], "customer": customer["name"]}}, nil
+//		},
+//	})
+//	go view.Run(ctx)
+type MaterializedView struct {
+	Name    string
+	Target  Repository
+	Sources []*ViewSource
+}
+
+// NewMaterializedView returns the view keeping its records in the target repository.
+func NewMaterializedView(name string, target Repository, sources ...*ViewSource) *MaterializedView {
+	return &MaterializedView{
+		Name:    name,
+		Target:  target,
+		Sources: sources,
+	}
+}
+
+func (v *MaterializedView) source(name string) (*ViewSource, error) {
+	for _, source := range v.Sources {
+		if source.Name == name {
+			return source, nil
+		}
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("%s is not a source of the view %s", name, v.Name))
+}
+
+// Run follows the changes of all sources and applies them to the view until the context is done. The
+// sources must support change streams (see Watch). Returns nil when the context is done, or the first
+// error of a source.
+func (v *MaterializedView) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(v.Sources))
+	for _, source := range v.Sources {
+		go func(source *ViewSource) {
+			errs <- Watch(ctx, source.Repository, func(event *ChangeEvent) error {
+				return v.apply(source, event)
+			})
+		}(source)
+	}
+
+	var first error
+	for range v.Sources {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			cancel()
+		}
+	}
+	return first
+}
+
+// Apply updates the view with the change of a record of the source with the name. Use it to feed the
+// view from the events of the application, if the source does not support change streams.
+func (v *MaterializedView) Apply(source string, event *ChangeEvent) error {
+	s, err := v.source(source)
+	if err != nil {
+		return err
+	}
+	return v.apply(s, event)
+}
+
+func (v *MaterializedView) apply(source *ViewSource, event *ChangeEvent) error {
+	if event.Operation == ChangeDelete {
+		return v.remove(source, event.Key)
+	}
+	document := event.Document
+	if document == nil {
+		// the streams of the keys only
+		records, err := readRecords(source.Repository, Filter(event.Key), 1, 0)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return v.remove(source, event.Key)
+		}
+		document = records[0]
+	}
+
+	projected, err := v.project(source, document)
+	if err != nil || len(projected) > 0 {
+		return err
+	}
+	return v.remove(source, event.Key)
+}
+
+// project saves the view records of the source record, and returns them.
+func (v *MaterializedView) project(source *ViewSource, record map[string]interface{}) ([]map[string]interface{}, error) {
+	projected, err := source.Project(record)
+	if err != nil {
+		return nil, err
+	}
+	for _, viewRecord := range projected {
+		if viewRecord["id"] == nil {
+			return nil, ErrInvalidInput(fmt.Sprintf("a record of the view %s has no id", v.Name))
+		}
+		if err := importRecord(v.Target, viewRecord, []string{"id"}); err != nil {
+			return nil, err
+		}
+	}
+	return projected, nil
+}
+
+// remove deletes the view records of the deleted (or excluded) source record.
+func (v *MaterializedView) remove(source *ViewSource, key map[string]interface{}) error {
+	filter := Filter{"id": key["id"]}
+	if source.Remove != nil {
+		var err error
+		if filter, err = source.Remove(key); err != nil {
+			return err
+		}
+	}
+	if err := v.Target.DeleteAll(filter); err != nil && !IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Rebuild projects all records of the sources to the view, and deletes the view records that no source
+// record is projected to. The view can be read during the rebuild. Returns the number of saved view records.
+func (v *MaterializedView) Rebuild(ctx context.Context) (int, error) {
+	written := map[string]bool{}
+	for _, source := range v.Sources {
+		for offset := 0; ; offset += defaultTransferBatchSize {
+			if err := ctx.Err(); err != nil {
+				return len(written), err
+			}
+			records, err := readRecords(source.Repository, nil, defaultTransferBatchSize, offset)
+			if err != nil {
+				return len(written), err
+			}
+			for _, record := range records {
+				projected, err := v.project(source, record)
+				if err != nil {
+					return len(written), err
+				}
+				for _, viewRecord := range projected {
+					written[fmt.Sprint(viewRecord["id"])] = true
+				}
+			}
+			if len(records) < defaultTransferBatchSize {
+				break
+			}
+		}
+	}
+
+	stale := []interface{}{}
+	for offset := 0; ; offset += defaultTransferBatchSize {
+		records, err := readRecords(v.Target, nil, defaultTransferBatchSize, offset)
+		if err != nil {
+			return len(written), err
+		}
+		for _, record := range records {
+			if !written[fmt.Sprint(record["id"])] {
+				stale = append(stale, record["id"])
+			}
+		}
+		if len(records) < defaultTransferBatchSize {
+			break
+		}
+	}
+	for _, id := range stale {
+		if err := v.Target.DeleteOne(Filter{"id": id}); err != nil && !IsErrNotFound(err) {
+			return len(written), err
+		}
+	}
+	return len(written), nil
+}
+
+// Wrap returns the repository of the source with the name, updating the view on every write. Use it for
+// the sources that do not support change streams, when all writes go through this service. If the record
+// is saved, but the view cannot be updated, the saved record is returned together with the error.
+func (v *MaterializedView) Wrap(source string) (Repository, error) {
+	s, err := v.source(source)
+	if err != nil {
+		return nil, err
+	}
+	return &viewSourceRepository{Repository: s.Repository, view: v, source: s}, nil
+}
+
+// viewSourceRepository updates the view after the writes to the source repository.
+type viewSourceRepository struct {
+	Repository
+	view   *MaterializedView
+	source *ViewSource
+	mutex  sync.Mutex
+}
+
+// Save saves the record and projects the saved record to the view.
+func (r *viewSourceRepository) Save(object interface{}, filter Filter) (interface{}, error) {
+	result, err := r.Repository.Save(object, filter)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := toAuditMap(result)
+	if err != nil {
+		return result, err
+	}
+	if saved == nil || saved["id"] == nil {
+		return result, ErrInvalidInput(fmt.Sprintf("the record saved to the view %s has no id", r.view.Name))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// the record is read back, so the view gets all of its properties
+	event := &ChangeEvent{Operation: ChangeUpdate, Key: map[string]interface{}{"id": saved["id"]}}
+	return result, r.view.apply(r.source, event)
+}
+
+// DeleteOne deletes the record and its view records.
+func (r *viewSourceRepository) DeleteOne(filter Filter) error {
+	record := map[string]interface{}{}
+	if _, err := r.Repository.GetOne(copyFilter(filter), &record); err != nil {
+		return err
+	}
+	if err := r.Repository.DeleteOne(filter); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.view.remove(r.source, map[string]interface{}{"id": record["id"]})
+}
+
+// DeleteAll deletes the records and their view records.
+func (r *viewSourceRepository) DeleteAll(filter Filter) error {
+	ids := []interface{}{}
+	for offset := 0; ; offset += defaultTransferBatchSize {
+		records, err := readRecords(r.Repository, copyFilter(filter), defaultTransferBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			ids = append(ids, record["id"])
+		}
+		if len(records) < defaultTransferBatchSize {
+			break
+		}
+	}
+	if err := r.Repository.DeleteAll(filter); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, id := range ids {
+		if err := r.view.remove(r.source, map[string]interface{}{"id": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
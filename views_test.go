@@ -0,0 +1,108 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newOrderSummaries(orders, customers, summaries Repository) *MaterializedView {
+	return NewMaterializedView("orderSummaries", summaries, &ViewSource{
+		Name:       "orders",
+		Repository: orders,
+		Project: func(order map[string]interface{}) ([]map[string]interface{}, error) {
+			if order["status"] == "cancelled" {
+				return nil, nil
+			}
+			customer := map[string]interface{}{}
+			if _, err := customers.GetOne(Filter{"id": order["customerId"]}, &customer); err != nil {
+				return nil, err
+			}
+			return []map[string]interface{}{{"id": order["id"], "total": order["total"], "customer": customer["name"]}}, nil
+		},
+	})
+}
+
+func TestMaterializedViewApply(t *testing.T) {
+	customers := &memoryRepo{records: []map[string]interface{}{{"id": "c1", "name": "ann"}}}
+	summaries := &memoryRepo{}
+	view := newOrderSummaries(&memoryRepo{}, customers, summaries)
+
+	events := []*ChangeEvent{
+		{Operation: ChangeInsert, Key: map[string]interface{}{"id": "1"}, Document: map[string]interface{}{"id": "1", "customerId": "c1", "total": 10}},
+		{Operation: ChangeInsert, Key: map[string]interface{}{"id": "2"}, Document: map[string]interface{}{"id": "2", "customerId": "c1", "total": 20}},
+		{Operation: ChangeUpdate, Key: map[string]interface{}{"id": "1"}, Document: map[string]interface{}{"id": "1", "customerId": "c1", "total": 15}},
+	}
+	for _, event := range events {
+		if err := view.Apply("orders", event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(summaries.records) != 2 || summaries.records[0]["total"] != 15 || summaries.records[1]["customer"] != "ann" {
+		t.Fatal("Expected the projected records. Got: ", summaries.records)
+	}
+
+	cancelled := &ChangeEvent{Operation: ChangeUpdate, Key: map[string]interface{}{"id": "1"}, Document: map[string]interface{}{"id": "1", "status": "cancelled"}}
+	if err := view.Apply("orders", cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.Apply("orders", &ChangeEvent{Operation: ChangeDelete, Key: map[string]interface{}{"id": "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries.records) != 0 {
+		t.Fatal("Expected the excluded and deleted records to be removed. Got: ", summaries.records)
+	}
+	if err := view.Apply("invoices", events[0]); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an unknown source. Got: ", err)
+	}
+}
+
+func TestMaterializedViewRebuild(t *testing.T) {
+	orders := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "customerId": "c1", "total": 10},
+		{"id": "2", "customerId": "c1", "total": 20, "status": "cancelled"},
+	}}
+	customers := &memoryRepo{records: []map[string]interface{}{{"id": "c1", "name": "ann"}}}
+	summaries := &memoryRepo{records: []map[string]interface{}{
+		{"id": "1", "total": 5, "customer": "old"},
+		{"id": "3", "total": 30},
+	}}
+	view := newOrderSummaries(orders, customers, summaries)
+
+	count, err := view.Rebuild(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(summaries.records) != 1 || summaries.records[0]["customer"] != "ann" {
+		t.Fatal("Expected the view to be rebuilt without the stale records. Got: ", count, summaries.records)
+	}
+	if err := view.Run(context.Background()); !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for a source without change streams. Got: ", err)
+	}
+}
+
+func TestMaterializedViewWrap(t *testing.T) {
+	orders := &memoryRepo{}
+	customers := &memoryRepo{records: []map[string]interface{}{{"id": "c1", "name": "ann"}}}
+	summaries := &memoryRepo{}
+	repo, err := newOrderSummaries(orders, customers, summaries).Wrap("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Save(&map[string]interface{}{"id": "1", "customerId": "c1", "total": 10}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(&map[string]interface{}{"total": 12}, Filter{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries.records) != 1 || fmt.Sprint(summaries.records[0]["total"]) != "12" {
+		t.Fatal("Expected the view to follow the writes. Got: ", summaries.records)
+	}
+	if err := repo.DeleteAll(Filter{"customerId": "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(orders.records) != 0 || len(summaries.records) != 0 {
+		t.Fatal("Expected the records to be deleted from the view. Got: ", summaries.records)
+	}
+}
@@ -0,0 +1,134 @@
+package backends
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// WriteConcern defines the level of acknowledgment requested from MongoDB for write operations.
+type WriteConcern struct {
+	// W is the number of members that must acknowledge the write. 0 means fire-and-forget.
+	// Defaults to 1 when the write concern is given as a map without "w".
+	W int
+	// WMode is a write concern mode, like "majority". Takes precedence over W.
+	WMode string
+	// Journal requires the write to be committed to the journal.
+	Journal bool
+	// WTimeout is the time limit for the write concern.
+	WTimeout time.Duration
+}
+
+// ToSafe converts the write concern to mgo.Safe. Returns nil for unacknowledged (fire-and-forget) writes.
+func (w *WriteConcern) ToSafe() *mgo.Safe {
+	if w.W == 0 && w.WMode == "" && !w.Journal {
+		return nil
+	}
+	return &mgo.Safe{
+		W:        w.W,
+		WMode:    w.WMode,
+		J:        w.Journal,
+		WTimeout: int(w.WTimeout / time.Millisecond),
+	}
+}
+
+// GetWriteConcern returns the write concern of the repository ("writeConcern" property), or nil if not set.
+// Returns ErrInvalidInput if the value is not a valid write concern. The write concern can be given as
+// *WriteConcern, or as a map:
+// 		"writeConcern": map[string]interface{}{
+// 			"w":        "majority",
+// 			"j":        true,
+// 			"wtimeout": 5000,
+// 		}
+func (m RepositoryDefinitionMap) GetWriteConcern() (*WriteConcern, error) {
+	if value, ok := m["writeConcern"]; ok {
+		return parseWriteConcern(value)
+	}
+	return nil, nil
+}
+
+// GetWriteConcern returns the backend level write concern ("writeConcern" option), or nil if not set.
+func (o BackendOptions) GetWriteConcern() (*WriteConcern, error) {
+	if value, ok := o["writeConcern"]; ok {
+		return parseWriteConcern(value)
+	}
+	return nil, nil
+}
+
+func parseWriteConcern(value interface{}) (*WriteConcern, error) {
+	switch wc := value.(type) {
+	case *WriteConcern:
+		return wc, nil
+	case WriteConcern:
+		return &wc, nil
+	case map[string]interface{}:
+		// the writes are acknowledged by the primary unless "w" is 0
+		writeConcern := &WriteConcern{W: 1}
+		switch w := wc["w"].(type) {
+		case nil:
+		case string:
+			if n, err := strconv.Atoi(w); err == nil {
+				writeConcern.W = n
+			} else {
+				writeConcern.WMode = w
+			}
+		default:
+			n, err := writeConcernInt("w", w)
+			if err != nil {
+				return nil, err
+			}
+			writeConcern.W = n
+		}
+		if j, ok := wc["j"]; ok {
+			journal, isBool := j.(bool)
+			if !isBool {
+				return nil, ErrInvalidInput(fmt.Sprintf("invalid write concern j %v, expected a bool", j))
+			}
+			writeConcern.Journal = journal
+		}
+		if wtimeout, ok := wc["wtimeout"]; ok {
+			n, err := writeConcernInt("wtimeout", wtimeout)
+			if err != nil {
+				return nil, err
+			}
+			writeConcern.WTimeout = time.Duration(n) * time.Millisecond
+		}
+		return writeConcern, nil
+	}
+	return nil, ErrInvalidInput(fmt.Sprintf("invalid write concern %v", value))
+}
+
+// writeConcernInt returns the integer value of the "w" or "wtimeout" property of the write concern.
+func writeConcernInt(name string, value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case float64:
+		// loaded from JSON
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, ErrInvalidInput(fmt.Sprintf("invalid write concern %s %v, expected a number", name, value))
+}
+
+// getWriteCollection returns the collection and a session (to be closed after) for write operations.
+// If the repository defines a write concern, it overrides the backend level write concern.
+func (s *MongoSession) getWriteCollection() (*mgo.Session, *mgo.Collection) {
+	session, c := s.GetCollection()
+	if s.writeConcern != nil {
+		session.SetSafe(s.writeConcern.ToSafe())
+	}
+	return session, c
+}
@@ -0,0 +1,76 @@
+package backends
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-tools/config"
+	"gopkg.in/mgo.v2"
+)
+
+func TestGetWriteConcern(t *testing.T) {
+	def := RepositoryDefinitionMap{
+		"writeConcern": map[string]interface{}{
+			"w":        "majority",
+			"j":        true,
+			"wtimeout": 5000,
+		},
+	}
+
+	writeConcern, err := def.GetWriteConcern()
+	if err != nil || writeConcern == nil {
+		t.Fatal("Expected write concern")
+	}
+	if writeConcern.WMode != "majority" || !writeConcern.Journal || writeConcern.WTimeout != 5*time.Second {
+		t.Fatal("Unexpected write concern: ", writeConcern)
+	}
+
+	safe := writeConcern.ToSafe()
+	if safe == nil || safe.WMode != "majority" || !safe.J || safe.WTimeout != 5000 {
+		t.Fatal("Unexpected mgo.Safe: ", safe)
+	}
+
+	fireAndForget, _ := RepositoryDefinitionMap{
+		"writeConcern": map[string]interface{}{"w": 0},
+	}.GetWriteConcern()
+	if fireAndForget.ToSafe() != nil {
+		t.Fatal("Expected unacknowledged writes")
+	}
+
+	for _, value := range []map[string]interface{}{{"wtimeout": 5000}, {"j": false}} {
+		acknowledged, err := RepositoryDefinitionMap{"writeConcern": value}.GetWriteConcern()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if safe := acknowledged.ToSafe(); safe == nil || safe.W != 1 {
+			t.Fatalf("Expected the writes to be acknowledged by default for %v. Got: %v", value, safe)
+		}
+	}
+
+	for _, value := range []interface{}{2, int32(2), int64(2), float64(2), "2"} {
+		writeConcern, err := RepositoryDefinitionMap{"writeConcern": map[string]interface{}{"w": value}}.GetWriteConcern()
+		if err != nil || writeConcern.W != 2 {
+			t.Fatalf("Expected w 2 for %#v. Got: %v, %v", value, writeConcern, err)
+		}
+	}
+
+	for _, value := range []map[string]interface{}{{"w": true}, {"w": 1.5}, {"wtimeout": "5s"}, {"wtimeout": []int{1}}, {"j": "yes"}} {
+		if _, err := (RepositoryDefinitionMap{"writeConcern": value}).GetWriteConcern(); err == nil || !IsErrInvalidInput(err) {
+			t.Fatalf("Expected ErrInvalidInput for %v. Got: %v", value, err)
+		}
+	}
+
+	if writeConcern, _ := (RepositoryDefinitionMap{}).GetWriteConcern(); writeConcern != nil {
+		t.Fatal("Expected no write concern")
+	}
+
+	if _, err := (RepositoryDefinitionMap{"writeConcern": "majority"}).GetWriteConcern(); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected ErrInvalidInput for an invalid write concern. Got: ", err)
+	}
+	backend := NewRepositoriesBackend(context.Background(), &config.DBInfo{DatabaseName: "app"}, MongoDBRepoBuilder, nil)
+	backend.SetInContext(MONGO_CTX_KEY, &mgo.Session{})
+	if _, err := MongoDBRepoBuilder(RepositoryDefinitionMap{"name": "users", "writeConcern": 1}, backend); err == nil || !IsErrInvalidInput(err) {
+		t.Fatal("Expected the builder to reject the invalid write concern. Got: ", err)
+	}
+}